@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"github.com/up9inc/mizu/shared/kubernetes"
 	"io/ioutil"
+	"math/rand"
 	v1 "k8s.io/api/core/v1"
 	"mizuserver/pkg/api"
 	"mizuserver/pkg/config"
 	"mizuserver/pkg/controllers"
 	"mizuserver/pkg/database"
+	"mizuserver/pkg/filterExpression"
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/middlewares"
 	"mizuserver/pkg/models"
 	"mizuserver/pkg/providers"
 	"mizuserver/pkg/routes"
+	"mizuserver/pkg/sensitiveDataFiltering"
+	"mizuserver/pkg/sinks"
 	"mizuserver/pkg/up9"
 	"mizuserver/pkg/utils"
 	"net/http"
@@ -24,7 +30,9 @@ import (
 	"path"
 	"path/filepath"
 	"plugin"
-	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -41,35 +49,123 @@ import (
 var tapperMode = flag.Bool("tap", false, "Run in tapper mode without API")
 var apiServerMode = flag.Bool("api-server", false, "Run in API server mode with API")
 var standaloneMode = flag.Bool("standalone", false, "Run in standalone tapper and API mode")
-var apiServerAddress = flag.String("api-server-address", "", "Address of mizu API server")
-var namespace = flag.String("namespace", "", "Resolve IPs if they belong to resources in this namespace (default is all)")
+var apiServerAddress = flag.String("api-server-address", "", "Address of mizu API server, a comma separated list of addresses is tried in turn until one connects")
+var namespaces = newNamespacesFlag("namespace", "Resolve IPs if they belong to resources in this namespace, repeat it to resolve across several namespaces (default is all)")
 var harsReaderMode = flag.Bool("hars-read", false, "Run in hars-read mode")
 var harsDir = flag.String("hars-dir", "", "Directory to read hars from")
+var pcapReaderMode = flag.Bool("pcap-read", false, "Run in pcap-read mode, dissecting the packets of --pcap-dir and --pcap-file instead of tapping")
+var pcapDir = flag.String("pcap-dir", "", "Directory to read the .pcap, .pcapng and .cap files from in pcap-read mode")
+var pcapFile = flag.String("pcap-file", "", "A pcap or pcapng file to read in pcap-read mode, read after the files of --pcap-dir")
+var configFile = flag.String("config-file", "", "Path of the config file (default is the mizu config path)")
+var healthzPort = flag.Int("healthz-port", 0, "Port serving /healthz in tapper mode, which has no API (default is not serving it)")
+var dryRun = flag.Bool("dry-run", false, "Print the tap targets, filtering options and extensions of --tap or --standalone and exit without tapping")
+var output = flag.String("output", outputWebSocket, "Destination of the entries captured in --tap mode: websocket to the api server, stdout or file:<path> as json lines, or otlp:<collector url> as OTLP/HTTP spans")
+var apiServerCaFile = flag.String("api-server-ca-file", "", "CA bundle verifying the certificate of a wss:// api server (default is the system CAs)")
+var apiServerCertFile = flag.String("api-server-cert-file", "", "Client certificate presented to a wss:// api server for mutual TLS, requires --api-server-key-file")
+var apiServerKeyFile = flag.String("api-server-key-file", "", "Key of the client certificate of --api-server-cert-file")
+var apiServerInsecureSkipVerify = flag.Bool("api-server-insecure-skip-verify", false, "Skip verifying the certificate of a wss:// api server, for development only")
+var bindHost = flag.String("bind-host", "", "Host the API server listens on (default is the config serverBindHost, all the interfaces when unset)")
+var port = flag.Int("port", 0, "Port the API server listens on (default is the config serverPort, 8899 when unset)")
+var maxEntries = flag.Int64("max-entries", 0, "Max number of entries kept in the database, the oldest are deleted beyond it (default is the config maxEntries)")
+
+var startupGrace *utils.StartupGrace
+var apiServerAddresses *socketAddresses // the addresses of --api-server-address, tapper mode only
+var socketCompression *api.CompressionStats // nil unless compressing the tapped entries is enabled, tapper mode only
+var socketTlsConfig *tls.Config // nil unless a CA bundle, a client certificate or skipping the verification is configured, tapper mode only
+var entryRedactor *sensitiveDataFiltering.Redactor // nil unless redacting headers or body fields is configured
 
 var extensions []*tapApi.Extension             // global
 var extensionsMap map[string]*tapApi.Extension // global
+var extensionsMutex sync.Mutex                 // guards extensions and extensionsMap, and serializes their loads
 
 const (
 	socketConnectionRetries = 10
 	socketConnectionRetryDelay = time.Second * 2
+	defaultSocketMaxRetryDelay = time.Second * 30
 	socketHandshakeTimeout = time.Second * 2
+	outputWebSocket = "websocket"
+	outputStdout = "stdout"
+	outputFilePrefix = "file:"
+	outputOtlpPrefix = "otlp:"
+	otlpBatchSize = 100
+	otlpExportInterval = time.Second * 5
+	memoryGuardCheckInterval = time.Second
+	defaultStartupGraceWindow = time.Second * 30
+	defaultShutdownTimeout = time.Second * 10
 )
 
 func main() {
 	logLevel := determineLogLevel()
 	logger.InitLoggerStderrOnly(logLevel)
+	startupGrace = utils.NewStartupGrace(getStartupGraceWindow())
 	flag.Parse()
-	if err := config.LoadConfig(); err != nil {
+	if err := config.LoadConfig(*configFile); err != nil {
 		logger.Log.Fatalf("Error loading config file %v", err)
 	}
-	loadExtensions()
+	if *maxEntries > 0 {
+		config.Config.MaxEntries = *maxEntries
+	}
+	if *bindHost != "" {
+		config.Config.ServerBindHost = *bindHost
+	}
+	if *port != 0 {
+		config.Config.ServerPort = *port
+	}
+	if err := utils.ValidateServerPort(config.Config.ServerPort); err != nil {
+		logger.Log.Fatalf("Error configuring the server %v", err)
+	}
+	config.Flags = config.RuntimeFlags{
+		TapperMode:       *tapperMode,
+		ApiServerMode:    *apiServerMode,
+		StandaloneMode:   *standaloneMode,
+		HarsReaderMode:   *harsReaderMode,
+		PcapReaderMode:   *pcapReaderMode,
+		Namespaces:       *namespaces,
+		HarsDir:          *harsDir,
+		PcapDir:          *pcapDir,
+		PcapFile:         *pcapFile,
+		ApiServerAddress: *apiServerAddress,
+		Output:           *output,
+	}
+	if err := utils.InitOutboundProxy(config.Config.OutboundProxy); err != nil {
+		logger.Log.Fatalf("Error configuring the outbound proxy %v", err)
+	}
+	// unlike the optional features, the entries aren't captured unredacted when the redaction is misconfigured
+	var err error
+	if entryRedactor, err = sensitiveDataFiltering.NewRedactor(config.Config.Redaction); err != nil {
+		logger.Log.Fatalf("Error configuring the redaction %v", err)
+	}
+	if loadedExtensions, loadErrors := loadExtensions(getExtensionsDir()); len(loadedExtensions) == 0 {
+		logger.Log.Fatalf("No extension was loaded: %v", loadErrors)
+	}
+	if *dryRun {
+		if !*tapperMode && !*standaloneMode {
+			logger.Log.Fatalf("The flag --dry-run must be provided with --tap or --standalone")
+		}
+		printDryRunReport()
+		os.Exit(0)
+	}
+	startExtensionsReloader()
+	startMemoryGuard()
+	if *tapperMode {
+		providers.RegisterTapperMetrics(providers.MetricsRegistry)
+	}
+	pushgatewayPusher := startPushgatewayPusher()
 
-	if !*tapperMode && !*apiServerMode && !*standaloneMode && !*harsReaderMode {
-		panic("One of the flags --tap, --api or --standalone or --hars-read must be provided")
+	if !*tapperMode && !*apiServerMode && !*standaloneMode && !*harsReaderMode && !*pcapReaderMode {
+		panic("One of the flags --tap, --api or --standalone or --hars-read or --pcap-read must be provided")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// the readers drain their channels once signaled, they stop before the shutdown timeout to write a partial batch
+	drainCtx, cancelDrain := newDrainContext(ctx, getShutdownTimeout()*3/4)
+	defer cancelDrain()
+
+	// shutdown drains the channels of the mode, the entries tapped before the signal are written before exiting
+	var shutdown func()
 	if *standaloneMode {
-		api.StartResolving(*namespace)
+		api.StartResolving(*namespaces)
 
 		outputItemsChannel := make(chan *tapApi.OutputChannelItem)
 		filteredOutputItemsChannel := make(chan *tapApi.OutputChannelItem)
@@ -77,16 +173,39 @@ func main() {
 		filteringOptions := getTrafficFilteringOptions()
 		hostMode := os.Getenv(shared.HostModeEnvVar) == "1"
 		tapOpts := &tap.TapOpts{HostMode: hostMode}
-		tap.StartPassiveTapper(tapOpts, outputItemsChannel, extensions, filteringOptions)
-
-		go filterItems(outputItemsChannel, filteredOutputItemsChannel)
-		go api.StartReadingEntries(filteredOutputItemsChannel, nil, extensionsMap)
-
-		hostApi(nil)
+		tap.StartPassiveTapper(tapOpts, outputItemsChannel, getLoadedExtensions(), filteringOptions)
+
+		go filterItemsAndClose(outputItemsChannel, filteredOutputItemsChannel, filteringOptions)
+		entriesRead := startReadingEntries(drainCtx, filteredOutputItemsChannel, nil)
+
+		serverStopped := hostApi(ctx, nil)
+		shutdown = func() {
+			tap.StopPassiveTapper()
+			close(outputItemsChannel)
+			<-entriesRead
+			<-serverStopped
+			closeWebSockets()
+		}
 	} else if *tapperMode {
-		logger.Log.Infof("Starting tapper, websocket address: %s", *apiServerAddress)
-		if *apiServerAddress == "" {
-			panic("API server address must be provided with --api-server-address when using --tap")
+		if *output == outputWebSocket {
+			logger.Log.Infof("Starting tapper, websocket address: %s", *apiServerAddress)
+			apiServerAddresses = newSocketAddresses(*apiServerAddress)
+			if apiServerAddresses == nil {
+				panic("API server address must be provided with --api-server-address when using --tap")
+			}
+			if isWebSocketCompressionEnabled() {
+				socketCompression = &api.CompressionStats{}
+			}
+			var err error
+			if socketTlsConfig, err = utils.NewClientTlsConfig(*apiServerCaFile, *apiServerCertFile, *apiServerKeyFile, *apiServerInsecureSkipVerify); err != nil {
+				panic(fmt.Sprintf("Error configuring the TLS of the api server connection: %v", err))
+			}
+			if *apiServerInsecureSkipVerify {
+				logger.Log.Warningf("The certificate of the api server isn't verified, --api-server-insecure-skip-verify is for development only")
+			}
+			providers.SetSubsystemReady(providers.SocketPipeSubsystem, false)
+		} else {
+			logger.Log.Infof("Starting tapper, output: %s", *output)
 		}
 
 		tapTargets := getTapTargets()
@@ -95,102 +214,341 @@ func main() {
 			logger.Log.Infof("Filtering for the following authorities: %v", tap.GetFilterIPs())
 		}
 
+		if *healthzPort > 0 {
+			go hostHealthz(*healthzPort)
+		}
+
 		filteredOutputItemsChannel := make(chan *tapApi.OutputChannelItem)
 
 		filteringOptions := getTrafficFilteringOptions()
 		hostMode := os.Getenv(shared.HostModeEnvVar) == "1"
 		tapOpts := &tap.TapOpts{HostMode: hostMode}
-		tap.StartPassiveTapper(tapOpts, filteredOutputItemsChannel, extensions, filteringOptions)
-		socketConnection, err := dialSocketWithRetry(*apiServerAddress, socketConnectionRetries, socketConnectionRetryDelay)
+		tap.StartPassiveTapper(tapOpts, filteredOutputItemsChannel, getLoadedExtensions(), filteringOptions)
+		sink, err := newEntrySink(*output)
 		if err != nil {
-			panic(fmt.Sprintf("Error connecting to socket server at %s %v", *apiServerAddress, err))
+			panic(fmt.Sprintf("Error creating the %s output: %v", *output, err))
 		}
-		logger.Log.Infof("Connected successfully to websocket %s", *apiServerAddress)
 
-		go pipeTapChannelToSocket(socketConnection, filteredOutputItemsChannel)
+		// the api server limits the entries of all the tappers again, each tapper only sends as many as the limit
+		rateLimiter, _ := filtering.NewRateLimiter(filteringOptions.MaxEntriesPerSecond, filteringOptions.RateLimitSampleEvery)
+		entriesSent := make(chan struct{})
+		go func() {
+			defer close(entriesSent)
+			pipeTapChannelToSink(sink, filteredOutputItemsChannel, rateLimiter)
+		}()
+		shutdown = func() {
+			tap.StopPassiveTapper()
+			close(filteredOutputItemsChannel)
+			<-entriesSent
+		}
 	} else if *apiServerMode {
+		providers.SetSubsystemReady(providers.DatabaseSubsystem, false)
 		database.InitDataBase(config.Config.AgentDatabasePath)
-		api.StartResolving(*namespace)
+		providers.SetSubsystemReady(providers.DatabaseSubsystem, database.IsInitialized())
+		providers.RestoreTapStatus()
+		api.StartResolving(*namespaces)
 
 		outputItemsChannel := make(chan *tapApi.OutputChannelItem)
 		filteredOutputItemsChannel := make(chan *tapApi.OutputChannelItem)
 
-		go filterItems(outputItemsChannel, filteredOutputItemsChannel)
-		go api.StartReadingEntries(filteredOutputItemsChannel, nil, extensionsMap)
+		go filterItemsAndClose(outputItemsChannel, filteredOutputItemsChannel, getTrafficFilteringOptions())
+		entriesRead := startReadingEntries(drainCtx, filteredOutputItemsChannel, nil)
 
 		syncEntriesConfig := getSyncEntriesConfig()
 		if syncEntriesConfig != nil {
-			if err := up9.SyncEntries(syncEntriesConfig); err != nil {
-				panic(fmt.Sprintf("Error syncing entries, err: %v", err))
+			up9.StartSyncingEntries(syncEntriesConfig)
+		}
+		startExportScheduler()
+		startSnapshotScheduler()
+
+		serverStopped := hostApi(ctx, outputItemsChannel)
+		shutdown = func() {
+			<-serverStopped
+			// the tappers resend the entries that weren't acknowledged once they reconnect
+			closeWebSockets()
+			close(outputItemsChannel)
+			<-entriesRead
+			providers.SetSubsystemReady(providers.DatabaseSubsystem, false)
+			if err := database.Close(); err != nil {
+				logger.Log.Errorf("Failed closing the database: %v", err)
 			}
 		}
-
-		hostApi(outputItemsChannel)
 	} else if *harsReaderMode {
+		database.InitDataBase(config.Config.AgentDatabasePath)
 		outputItemsChannel := make(chan *tapApi.OutputChannelItem, 1000)
 		filteredHarChannel := make(chan *tapApi.OutputChannelItem)
 
-		go filterItems(outputItemsChannel, filteredHarChannel)
-		go api.StartReadingEntries(filteredHarChannel, harsDir, extensionsMap)
-		hostApi(nil)
+		go filterItems(outputItemsChannel, filteredHarChannel, getTrafficFilteringOptions())
+		// the files are read again on the next start, so they aren't drained
+		entriesRead := startReadingEntries(ctx, filteredHarChannel, harsDir)
+
+		serverStopped := hostApi(ctx, nil)
+		shutdown = func() {
+			<-entriesRead
+			<-serverStopped
+			if err := database.Close(); err != nil {
+				logger.Log.Errorf("Failed closing the database: %v", err)
+			}
+		}
+	} else if *pcapReaderMode {
+		pcapFiles, err := getPcapFiles(*pcapDir, *pcapFile)
+		if err != nil {
+			panic(fmt.Sprintf("Error listing the pcap files: %v", err))
+		}
+		if len(pcapFiles) == 0 {
+			panic("A pcap file must be provided with --pcap-dir or --pcap-file when using --pcap-read")
+		}
+
+		database.InitDataBase(config.Config.AgentDatabasePath)
+		api.StartResolving(*namespaces)
+
+		outputItemsChannel := make(chan *tapApi.OutputChannelItem, 1000)
+		filteredOutputItemsChannel := make(chan *tapApi.OutputChannelItem)
+
+		filteringOptions := getTrafficFilteringOptions()
+		go filterItemsAndClose(outputItemsChannel, filteredOutputItemsChannel, filteringOptions)
+		// like the hars, the files are read again on the next start, so the unread packets aren't drained
+		entriesRead := startReadingEntries(ctx, filteredOutputItemsChannel, nil)
+
+		dissectedItemsChannel := make(chan *tapApi.OutputChannelItem)
+		go func() {
+			tapOpts := &tap.TapOpts{HostMode: false}
+			if err := tap.ReadPcapFiles(tapOpts, dissectedItemsChannel, getLoadedExtensions(), filteringOptions, pcapFiles); err != nil {
+				logger.Log.Errorf("Error reading pcap files: %v", err)
+			}
+			close(dissectedItemsChannel)
+			logger.Log.Infof("Done reading %d pcap files", len(pcapFiles))
+		}()
+		go decodeItemsAndClose(dissectedItemsChannel, outputItemsChannel)
+
+		serverStopped := hostApi(ctx, nil)
+		shutdown = func() {
+			<-entriesRead
+			<-serverStopped
+			closeWebSockets()
+			if err := database.Close(); err != nil {
+				logger.Log.Errorf("Failed closing the database: %v", err)
+			}
+		}
+	}
+
+	<-ctx.Done()
+	stop()
+	logger.Log.Info("Shutting down, draining the channels")
+	shutdownTimeout := getShutdownTimeout()
+	time.AfterFunc(shutdownTimeout, func() {
+		logger.Log.Errorf("Exiting before the channels were drained, the shutdown took over %v", shutdownTimeout)
+		os.Exit(1)
+	})
+	// the schedulers wait for a running export or snapshot, they read the database the shutdown closes
+	if sinks.ActiveExportScheduler != nil {
+		sinks.ActiveExportScheduler.Stop()
+	}
+	if database.ActiveSnapshotScheduler != nil {
+		database.ActiveSnapshotScheduler.Stop()
 	}
+	shutdown()
 
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
-	<-signalChan
+	if pushgatewayPusher != nil {
+		if err := pushgatewayPusher.Stop(); err != nil {
+			logger.Log.Errorf("Failed pushing final metrics to pushgateway: %v", err)
+		}
+	}
 
 	logger.Log.Info("Exiting")
 }
 
-func loadExtensions() {
+// lookupDissector opens the plugin of an extension and finds its dissector, the tests replace it
+var lookupDissector = func(extensionPath string) (*plugin.Plugin, tapApi.Dissector, error) {
+	plug, err := plugin.Open(extensionPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	dissector, err := lookupExtensionDissector(plug.Lookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plug, dissector, nil
+}
+
+// lookupExtensionDissector finds the dissector of an extension built against the tapApi version of the agent
+func lookupExtensionDissector(lookup func(symName string) (plugin.Symbol, error)) (tapApi.Dissector, error) {
+	symApiVersion, err := lookup("ApiVersion")
+	if err != nil {
+		return nil, fmt.Errorf("the plugin doesn't declare the extensions api version it's built against, expected version %q: %v", tapApi.ApiVersion, err)
+	}
+	if err := tapApi.CheckApiVersion(symApiVersion); err != nil {
+		return nil, err
+	}
+	symDissector, err := lookup("Dissector")
+	if err != nil {
+		return nil, err
+	}
+	dissector, ok := symDissector.(tapApi.Dissector)
+	if !ok {
+		return nil, fmt.Errorf("the Dissector of the plugin is a %T", symDissector)
+	}
+	return dissector, nil
+}
+
+// getPcapFiles returns the pcap files of pcapDir sorted by name, followed by pcapFile
+func getPcapFiles(pcapDir string, pcapFile string) ([]string, error) {
+	var pcapFiles []string
+	if pcapDir != "" {
+		files, err := ioutil.ReadDir(pcapDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			switch strings.ToLower(filepath.Ext(file.Name())) {
+			case ".pcap", ".pcapng", ".cap":
+				if !file.IsDir() {
+					pcapFiles = append(pcapFiles, path.Join(pcapDir, file.Name()))
+				}
+			}
+		}
+	}
+	if pcapFile != "" {
+		pcapFiles = append(pcapFiles, pcapFile)
+	}
+	return pcapFiles, nil
+}
+
+func getExtensionsDir() string {
 	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-	extensionsDir := path.Join(dir, "./extensions/")
+	return path.Join(dir, "./extensions/")
+}
+
+// builtInExtensions are selected and filtered along the extension files, by their names. They only analyze the entries
+// the tap emits by itself, e.g. the tls handshakes, so they're mapped by their protocols but never dissect a stream.
+var builtInExtensions = map[string]*tapApi.Extension{tap.TlsProtocol.Name: tap.TlsExtension}
+
+// loadExtensions registers the extensions of the dir that load, the extensions that fail to load are skipped and
+// returned as errors. The loaded extensions replace the previous ones at once, unless none was loaded.
+func loadExtensions(extensionsDir string) ([]*tapApi.Extension, []error) {
+	extensionsMutex.Lock()
+	defer extensionsMutex.Unlock()
 
 	files, err := ioutil.ReadDir(extensionsDir)
 	if err != nil {
-		logger.Log.Fatal(err)
-	}
-	extensions = make([]*tapApi.Extension, len(files))
-	extensionsMap = make(map[string]*tapApi.Extension)
-	for i, file := range files {
-		filename := file.Name()
-		logger.Log.Infof("Loading extension: %s\n", filename)
-		extension := &tapApi.Extension{
-			Path: path.Join(extensionsDir, filename),
-		}
-		plug, _ := plugin.Open(extension.Path)
-		extension.Plug = plug
-		symDissector, err := plug.Lookup("Dissector")
-
-		var dissector tapApi.Dissector
-		var ok bool
-		dissector, ok = symDissector.(tapApi.Dissector)
-		if err != nil || !ok {
-			panic(fmt.Sprintf("Failed to load the extension: %s\n", extension.Path))
-		}
-		dissector.Register(extension)
-		extension.Dissector = dissector
-		extensions[i] = extension
-		extensionsMap[extension.Protocol.Name] = extension
-	}
-
-	sort.Slice(extensions, func(i, j int) bool {
-		return extensions[i].Protocol.Priority < extensions[j].Protocol.Priority
-	})
+		return nil, []error{err}
+	}
+	fileNames := make([]string, 0, len(files)+len(builtInExtensions))
+	for _, file := range files {
+		fileNames = append(fileNames, file.Name())
+	}
+	for name := range builtInExtensions {
+		fileNames = append(fileNames, name)
+	}
+	fileNames, skippedFileNames := tapApi.SelectExtensionFiles(fileNames, config.Config.ExtensionsOrder, config.Config.MaxExtensions)
+	if len(skippedFileNames) > 0 {
+		logger.Log.Warningf("Skipped loading the extensions %s, at most %d extensions are loaded", strings.Join(skippedFileNames, ", "), config.Config.MaxExtensions)
+	}
+
+	loadedExtensions := make([]*tapApi.Extension, 0, len(fileNames))
+	loadedExtensionsMap := make(map[string]*tapApi.Extension)
+	registeredExtensions := make([]*tapApi.Extension, 0, len(fileNames)) // the disabled extensions included
+	var loadErrors []error
+	for _, filename := range fileNames {
+		extension, isBuiltIn := builtInExtensions[filename]
+		if !isBuiltIn {
+			logger.Log.Infof("Loading extension: %s\n", filename)
+			extension = &tapApi.Extension{
+				Path: path.Join(extensionsDir, filename),
+			}
+			plug, dissector, err := lookupDissector(extension.Path)
+			if err != nil {
+				logger.Log.Errorf("Failed to load the extension %s: %v", filename, err)
+				loadErrors = append(loadErrors, fmt.Errorf("extension %s: %v", filename, err))
+				continue
+			}
+			extension.Plug = plug
+			dissector.Register(extension)
+			extension.Dissector = dissector
+		}
+		registeredExtensions = append(registeredExtensions, extension)
+		if !tapApi.IsExtensionEnabled(extension, config.Config.EnabledProtocols, config.Config.DisabledProtocols) {
+			logger.Log.Infof("Skipped the extension %s, its protocol %s isn't enabled", filename, extension.Protocol.Name)
+			continue
+		}
+		loadedExtensionsMap[extension.Protocol.Name] = extension
+		for _, extraProtocol := range extension.ExtraProtocols {
+			loadedExtensionsMap[extraProtocol.Name] = extension
+		}
+		if !isBuiltIn {
+			loadedExtensions = append(loadedExtensions, extension)
+		}
+	}
+	configuredProtocols := append(append([]string{}, config.Config.EnabledProtocols...), config.Config.DisabledProtocols...)
+	if missingProtocols := tapApi.MissingProtocols(registeredExtensions, configuredProtocols); len(missingProtocols) > 0 {
+		logger.Log.Warningf("No loaded extension has the configured protocols %s", strings.Join(missingProtocols, ", "))
+	}
+	if len(loadedExtensions) == 0 {
+		return loadedExtensions, loadErrors
+	}
+
+	tapApi.SortExtensions(loadedExtensions)
 
-	for _, extension := range extensions {
+	for _, extension := range loadedExtensions {
 		logger.Log.Infof("Extension Properties: %+v\n", extension)
 	}
 
+	portConflicts := tapApi.ResolvePortConflicts(loadedExtensions, getExtensionPortOwners())
+	for _, conflict := range portConflicts {
+		reason := "by priority"
+		if conflict.Configured {
+			reason = "as configured"
+		}
+		logger.Log.Warningf("Port %s is claimed by the %s extensions, %s was selected %s", conflict.Port, strings.Join(conflict.Extensions, ", "), conflict.Selected, reason)
+	}
+
+	extensions, extensionsMap = loadedExtensions, loadedExtensionsMap
 	controllers.InitExtensionsMap(extensionsMap)
+	controllers.InitExtensionPortConflicts(portConflicts)
+	return extensions, loadErrors
 }
 
-func hostApi(socketHarOutputChannel chan<- *tapApi.OutputChannelItem) {
-	app := gin.Default()
+func getLoadedExtensions() []*tapApi.Extension {
+	extensionsMutex.Lock()
+	defer extensionsMutex.Unlock()
+	return extensions
+}
+
+// startExtensionsReloader loads the extensions dir again on SIGHUP. Go plugins can't be unloaded, so a changed
+// extension is only picked up under a new file name.
+func startExtensionsReloader() {
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go func() {
+		for range reloadSignals {
+			reloadExtensions(getExtensionsDir())
+		}
+	}()
+}
+
+// reloadExtensions keeps the loaded extensions when the reload loads none, the tapper dissects the new connections
+// with the reloaded extensions
+func reloadExtensions(extensionsDir string) {
+	reloadedExtensions, loadErrors := loadExtensions(extensionsDir)
+	if len(reloadedExtensions) == 0 {
+		logger.Log.Errorf("Kept the loaded extensions, no extension was reloaded: %v", loadErrors)
+		return
+	}
+	if *tapperMode || *standaloneMode {
+		tap.UpdateExtensions(reloadedExtensions, getExtensionPortOwners())
+	}
+	logger.Log.Infof("Reloaded %d extensions", len(reloadedExtensions))
+}
+
+// hostApi serves the api until ctx is done, the returned channel is closed once the server stopped
+func hostApi(ctx context.Context, socketHarOutputChannel chan<- *tapApi.OutputChannelItem) <-chan struct{} {
+	app := gin.New()
+	app.Use(middlewares.Logger(gin.DefaultWriter), gin.Recovery())
 
 	app.GET("/echo", func(c *gin.Context) {
 		c.String(http.StatusOK, "Here is Mizu agent")
 	})
+	routes.HealthzRoutes(app)
 
 	eventHandlers := api.RoutesEventHandlers{
 		SocketOutChannel: socketHarOutputChannel,
@@ -204,18 +562,37 @@ func hostApi(socketHarOutputChannel chan<- *tapApi.OutputChannelItem) {
 	routes.EntriesRoutes(app)
 	routes.MetadataRoutes(app)
 	routes.StatusRoutes(app)
+	routes.MetricsRoutes(app)
+	routes.FlowsRoutes(app)
+	routes.FilterRoutes(app)
+	routes.AdminRoutes(app)
+	routes.CaptureRoutes(app)
 	routes.NotFoundRoute(app)
 
 	if config.Config.DaemonMode {
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
 		if _, err := startMizuTapperSyncer(ctx); err != nil {
 			logger.Log.Fatalf("error initializing tapper syncer: %+v", err)
 		}
 	}
 
-	utils.StartServer(app)
+	serverStopped := make(chan struct{})
+	go func() {
+		defer close(serverStopped)
+		if err := utils.StartServer(ctx, app, config.Config.ServerBindHost, config.Config.ServerPort); err != nil {
+			logger.Log.Fatalf("Error starting the server: %v", err)
+		}
+	}()
+	return serverStopped
+}
+
+// hostHealthz serves the probes and the metrics of a tapper, which doesn't host the API
+func hostHealthz(port int) {
+	app := gin.New()
+	routes.HealthzRoutes(app)
+	routes.MetricsRoutes(app)
+	if err := app.Run(fmt.Sprintf(":%d", port)); err != nil {
+		logger.Log.Errorf("Failed serving /healthz on port %d: %v", port, err)
+	}
 }
 
 func DisableRootStaticCache() gin.HandlerFunc {
@@ -229,10 +606,19 @@ func DisableRootStaticCache() gin.HandlerFunc {
 	}
 }
 
+// CORSMiddleware allows the configured origins, credentials are only allowed with them since they're ignored with any
+// origin
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		if len(config.Config.AllowedOrigins) == 0 {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Writer.Header().Add("Vary", "Origin")
+			if origin := c.GetHeader("Origin"); isOriginAllowed(origin, config.Config.AllowedOrigins) {
+				c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
 
@@ -245,6 +631,34 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// isOriginAllowed matches the origin exactly or, for the patterns with a wildcard subdomain such as
+// https://*.example.com, any subdomain of the domain, though not the domain itself
+func isOriginAllowed(origin string, allowedOrigins []string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, allowedOrigin := range allowedOrigins {
+		allowedOrigin = strings.ToLower(allowedOrigin)
+		wildcardIndex := strings.Index(allowedOrigin, "*.")
+		if wildcardIndex < 0 {
+			if origin == allowedOrigin {
+				return true
+			}
+			continue
+		}
+
+		prefix, suffix := allowedOrigin[:wildcardIndex], allowedOrigin[wildcardIndex+1:]
+		if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) || len(origin) <= len(prefix)+len(suffix) {
+			continue
+		}
+		if subdomain := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
 func parseEnvVar(env string) map[string][]string {
 	var mapOfList map[string][]string
 
@@ -267,6 +681,54 @@ func getTapTargets() []string {
 	return tappedAddressesPerNodeDict[nodeName]
 }
 
+type dryRunExtension struct {
+	Name  string   `json:"name"`
+	Path  string   `json:"path"`
+	Ports []string `json:"ports"`
+}
+
+// dryRunReport is what a tapper would capture, the tap targets are nil when every pod of the node is tapped
+type dryRunReport struct {
+	Mode             string                          `json:"mode"`
+	HostMode         bool                            `json:"hostMode"`
+	TapTargets       []string                        `json:"tapTargets"`
+	FilteringOptions *tapApi.TrafficFilteringOptions `json:"filteringOptions"`
+	Extensions       []dryRunExtension               `json:"extensions"`
+}
+
+func getDryRunReport() *dryRunReport {
+	report := &dryRunReport{
+		Mode:             "standalone",
+		HostMode:         os.Getenv(shared.HostModeEnvVar) == "1",
+		FilteringOptions: getTrafficFilteringOptions(),
+	}
+	if *tapperMode {
+		report.Mode = "tap"
+		report.TapTargets = getTapTargets()
+	}
+	for _, extension := range getLoadedExtensions() {
+		report.Extensions = append(report.Extensions, dryRunExtension{Name: extension.Protocol.Name, Path: extension.Path, Ports: extension.Protocol.Ports})
+	}
+	return report
+}
+
+// printDryRunReport writes the report to stdout, the logs go to stderr
+func printDryRunReport() {
+	reportJson, err := json.MarshalIndent(getDryRunReport(), "", "  ")
+	if err != nil {
+		logger.Log.Fatalf("Failed marshaling the dry run report: %v", err)
+	}
+	fmt.Println(string(reportJson))
+}
+
+// getExtensionPortOwners returns the configured owners of conflicting ports, tappers read them from the filtering options env var
+func getExtensionPortOwners() map[string]string {
+	if *tapperMode || *standaloneMode {
+		return getTrafficFilteringOptions().ExtensionPortOwners
+	}
+	return config.Config.MizuApiFilteringOptions.ExtensionPortOwners
+}
+
 func getTrafficFilteringOptions() *tapApi.TrafficFilteringOptions {
 	filteringOptionsJson := os.Getenv(shared.MizuFilteringOptionsEnvVar)
 	if filteringOptionsJson == "" {
@@ -279,53 +741,379 @@ func getTrafficFilteringOptions() *tapApi.TrafficFilteringOptions {
 	if err != nil {
 		panic(fmt.Sprintf("env var %s's value of %s is invalid! json must match the api.TrafficFilteringOptions struct %v", shared.MizuFilteringOptionsEnvVar, filteringOptionsJson, err))
 	}
+	filteringOptions.ProtocolAllowlist = normalizeProtocolAllowlist(filteringOptions.ProtocolAllowlist)
+	if _, err := filtering.NewIgnoredPaths(filteringOptions.IgnoredPathPatterns); err != nil {
+		panic(fmt.Sprintf("env var %s's value of %s is invalid! %v", shared.MizuFilteringOptionsEnvVar, filteringOptionsJson, err))
+	}
+	if _, err := filtering.NewRateLimiter(filteringOptions.MaxEntriesPerSecond, filteringOptions.RateLimitSampleEvery); err != nil {
+		panic(fmt.Sprintf("env var %s's value of %s is invalid! %v", shared.MizuFilteringOptionsEnvVar, filteringOptionsJson, err))
+	}
 
 	return &filteringOptions
 }
 
-func filterItems(inChannel <-chan *tapApi.OutputChannelItem, outChannel chan *tapApi.OutputChannelItem) {
-	for message := range inChannel {
+// normalizeProtocolAllowlist lower cases the protocol names, matching the names the extensions register
+func normalizeProtocolAllowlist(protocols []string) []string {
+	normalized := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		if protocol = strings.ToLower(strings.TrimSpace(protocol)); protocol != "" {
+			normalized = append(normalized, protocol)
+		}
+	}
+	return normalized
+}
+
+// newProtocolAllowlist returns nil when every protocol is allowed
+func newProtocolAllowlist(protocols []string) map[string]bool {
+	if len(protocols) == 0 {
+		return nil
+	}
+	allowlist := make(map[string]bool, len(protocols))
+	for _, protocol := range protocols {
+		allowlist[protocol] = true
+	}
+	return allowlist
+}
+
+func isProtocolAllowed(allowlist map[string]bool, protocol string) bool {
+	return allowlist == nil || allowlist[protocol]
+}
+
+func filterItems(inChannel <-chan *tapApi.OutputChannelItem, outChannel chan *tapApi.OutputChannelItem, filteringOptions *tapApi.TrafficFilteringOptions) {
+	protocolAllowlist := newProtocolAllowlist(filteringOptions.ProtocolAllowlist)
+	// the patterns were validated when the options were parsed
+	ignoredPaths, _ := filtering.NewIgnoredPaths(filteringOptions.IgnoredPathPatterns)
+	rateLimiter, _ := filtering.NewRateLimiter(filteringOptions.MaxEntriesPerSecond, filteringOptions.RateLimitSampleEvery)
+	filtering.StartEndpointSampling(config.Config.EndpointSampling)
+	defer filtering.StopEndpointSampling()
+	filtering.ActiveNamespaceSampler = filtering.NewNamespaceSampler(config.Config.NamespaceSampling)
+	directionFilter, err := filtering.NewDirectionFilter(config.Config.ProtocolDirections)
+	if err != nil {
+		logger.Log.Errorf("Disabled protocol direction filtering: %v", err)
+	}
+	filtering.ActiveCaptureSchedule, err = filtering.NewCaptureSchedule(config.Config.CaptureSchedule)
+	if err != nil {
+		logger.Log.Errorf("Disabled capture schedule: %v", err)
+	}
+	shouldKeep := func(message *tapApi.OutputChannelItem) bool {
+		if filtering.ActiveCaptureSchedule != nil && !filtering.ActiveCaptureSchedule.IsActive(time.Now()) {
+			return false
+		}
+
 		if message.ConnectionInfo.IsOutgoing && api.CheckIsServiceIP(message.ConnectionInfo.ServerIP) {
+			return false
+		}
+
+		if !isProtocolAllowed(protocolAllowlist, message.Protocol.Name) {
+			return false
+		}
+
+		if ignoredPaths != nil && !ignoredPaths.ShouldKeep(message) {
+			return false
+		}
+
+		if directionFilter != nil && !directionFilter.ShouldKeep(message.Protocol.Name, message.ConnectionInfo.IsOutgoing) {
+			return false
+		}
+
+		if endpointSampler := filtering.GetActiveEndpointSampler(); endpointSampler != nil && !endpointSampler.ShouldKeep(filtering.GetItemSamplingPath(message)) {
+			return false
+		}
+
+		if filtering.ActiveNamespaceSampler != nil && !filtering.ActiveNamespaceSampler.ShouldKeep(api.ResolveNamespace(message.ConnectionInfo), message.ConnectionInfo) {
+			return false
+		}
+
+		if filtering.ActiveMemoryGuard != nil && filtering.ActiveMemoryGuard.ShouldDrop() {
+			return false
+		}
+
+		// last so only the entries kept by the rest of the filtering count toward the rate
+		if rateLimiter != nil && !rateLimiter.ShouldKeep(time.Now()) {
+			providers.EntryRateLimited()
+			return false
+		}
+
+		return true
+	}
+	filtering.RunFilterWorkers(config.Config.FilterWorkers, inChannel, outChannel, func(message *tapApi.OutputChannelItem) bool {
+		providers.EntryTapped()
+		if shouldKeep(message) {
+			// the kept entries are redacted before they're read, stored and broadcast
+			if entryRedactor != nil {
+				entryRedactor.Redact(message)
+			}
+			api.RedactItemQueryParams(message, config.Config.QueryParams)
+			return true
+		}
+		providers.EntryFilteredOut()
+		// the tapper resends the entries that aren't acknowledged, dropped entries included
+		api.AckEntry(message)
+		return false
+	})
+}
+
+// filterItemsAndClose closes outChannel once inChannel was closed and its items were filtered
+func filterItemsAndClose(inChannel <-chan *tapApi.OutputChannelItem, outChannel chan *tapApi.OutputChannelItem, filteringOptions *tapApi.TrafficFilteringOptions) {
+	filterItems(inChannel, outChannel, filteringOptions)
+	close(outChannel)
+}
+
+// decodeItemsAndClose decodes the payloads of the items dissected by this process like the payloads of the items
+// received from the tappers, which the extensions analyze, and closes outChannel once inChannel was closed
+func decodeItemsAndClose(inChannel <-chan *tapApi.OutputChannelItem, outChannel chan<- *tapApi.OutputChannelItem) {
+	for item := range inChannel {
+		decodedItem, err := models.DecodeOutputChannelItem(item)
+		if err != nil {
+			logger.Log.Errorf("Dropped an item that failed to decode: %v", err)
 			continue
 		}
+		outChannel <- decodedItem
+	}
+	close(outChannel)
+}
+
+// startReadingEntries returns a channel closed once the entries of the channel were all written
+func startReadingEntries(ctx context.Context, harChannel <-chan *tapApi.OutputChannelItem, workingDir *string) <-chan struct{} {
+	entriesRead := make(chan struct{})
+	go func() {
+		defer close(entriesRead)
+		api.StartReadingEntries(ctx, harChannel, workingDir)
+	}()
+	return entriesRead
+}
+
+// newDrainContext returns a context done drainTimeout after ctx is done, or once it's cancelled
+func newDrainContext(ctx context.Context, drainTimeout time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drainCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(drainTimeout):
+			cancel()
+		case <-drainCtx.Done():
+		}
+	}()
+	return drainCtx, cancel
+}
+
+// closeWebSockets leaves the sockets half of the shutdown timeout to answer the close frame
+func closeWebSockets() {
+	ctx, cancel := context.WithTimeout(context.Background(), getShutdownTimeout()/2)
+	defer cancel()
+	api.CloseWebSockets(ctx)
+}
+
+func getShutdownTimeout() time.Duration {
+	if config.Config.ShutdownTimeoutMs <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(config.Config.ShutdownTimeoutMs) * time.Millisecond
+}
 
-		outChannel <- message
+func getWebSocketEncoding() models.MessageEncoding {
+	encoding, err := models.ParseMessageEncoding(os.Getenv(shared.WebSocketEncodingEnvVar))
+	if err != nil {
+		logger.Log.Warningf("env var %s is invalid, using json: %v", shared.WebSocketEncodingEnvVar, err)
+		return models.MessageEncodingJson
 	}
+	return encoding
 }
 
-func pipeTapChannelToSocket(connection *websocket.Conn, messageDataChannel <-chan *tapApi.OutputChannelItem) {
-	if connection == nil {
-		panic("Websocket connection is nil")
+// isWebSocketCompressionEnabled returns whether the tapper offers permessage-deflate to the api server, it's off by
+// default since compressing costs the tappers cpu
+func isWebSocketCompressionEnabled() bool {
+	value := os.Getenv(shared.WebSocketCompressionEnvVar)
+	if value == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Log.Warningf("env var %s's value of %s is invalid, sending uncompressed frames", shared.WebSocketCompressionEnvVar, value)
+		return false
 	}
+	return enabled
+}
+
+func isCompressionNegotiated(response *http.Response) bool {
+	return response != nil && strings.Contains(response.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+}
 
+func getStartupGraceWindow() time.Duration {
+	windowMs := os.Getenv(shared.StartupGraceWindowMsEnvVar)
+	if windowMs == "" {
+		return defaultStartupGraceWindow
+	}
+	window, err := strconv.Atoi(windowMs)
+	if err != nil || window < 0 {
+		logger.Log.Warningf("env var %s's value of %s is invalid, using the default startup grace window", shared.StartupGraceWindowMsEnvVar, windowMs)
+		return defaultStartupGraceWindow
+	}
+	return time.Duration(window) * time.Millisecond
+}
+
+func getSocketMaxRetryDelay() time.Duration {
+	delayMs := os.Getenv(shared.SocketMaxRetryDelayMsEnvVar)
+	if delayMs == "" {
+		return defaultSocketMaxRetryDelay
+	}
+	delay, err := strconv.Atoi(delayMs)
+	if err != nil || delay <= 0 {
+		logger.Log.Warningf("env var %s's value of %s is invalid, using the default socket max retry delay", shared.SocketMaxRetryDelayMsEnvVar, delayMs)
+		return defaultSocketMaxRetryDelay
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+func startMemoryGuard() {
+	if config.Config.MemoryLimitBytes <= 0 {
+		return
+	}
+
+	filtering.ActiveMemoryGuard = filtering.NewMemoryGuard(uint64(config.Config.MemoryLimitBytes), filtering.ReadProcessRss, tap.SetNewStreamsPaused)
+	filtering.ActiveMemoryGuard.Start(memoryGuardCheckInterval)
+}
+
+func startExportScheduler() {
+	scheduler, err := sinks.NewExportScheduler(config.Config.ScheduledExports, queryExportEntries)
+	if err != nil {
+		logger.Log.Errorf("Disabled scheduled exports: %v", err)
+		return
+	}
+	if scheduler != nil {
+		scheduler.Start()
+		sinks.ActiveExportScheduler = scheduler
+	}
+}
+
+func startSnapshotScheduler() {
+	if config.Config.DatabaseSnapshots != nil && database.IsInMemory() {
+		logger.Log.Errorf("Disabled database snapshots: the entries are kept in memory")
+		return
+	}
+	scheduler, err := database.NewSnapshotScheduler(config.Config.DatabaseSnapshots, config.Config.AgentDatabasePath)
+	if err != nil {
+		logger.Log.Errorf("Disabled database snapshots: %v", err)
+		return
+	}
+	if scheduler != nil {
+		scheduler.Start()
+		database.ActiveSnapshotScheduler = scheduler
+	}
+}
+
+func queryExportEntries(filter string, from time.Time, to time.Time) ([]tapApi.MizuEntry, error) {
+	query := &database.EntriesQuery{
+		Conditions: []database.Condition{
+			database.TimestampCondition(">=", from.UnixNano()/int64(time.Millisecond)),
+			database.TimestampCondition("<", to.UnixNano()/int64(time.Millisecond)),
+		},
+		OrderBy: database.OrderByTimestamp,
+	}
+	if filter != "" {
+		expression, err := filterExpression.Parse(filter)
+		if err != nil {
+			return nil, err
+		}
+		query.Conditions = append(query.Conditions, expression)
+	}
+
+	return database.Entries.Find(context.Background(), query)
+}
+
+func startPushgatewayPusher() *sinks.PushgatewayPusher {
+	pusher, err := sinks.NewPushgatewayPusher(config.Config.Pushgateway, providers.MetricsRegistry, getProcessName())
+	if err != nil {
+		logger.Log.Errorf("Disabled pushing metrics to pushgateway: %v", err)
+		return nil
+	}
+	if pusher != nil {
+		pusher.Start()
+	}
+	return pusher
+}
+
+// getProcessName names the tappers after their node and the other modes after their pod
+func getProcessName() string {
+	if nodeName := os.Getenv(shared.NodeNameEnvVar); *tapperMode && nodeName != "" {
+		return nodeName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Log.Warningf("Failed reading the hostname: %v", err)
+	}
+	return hostname
+}
+
+// newEntrySink returns the sink of the --output, the websocket sink is connected to the api server before it's returned
+func newEntrySink(output string) (api.EntrySink, error) {
+	// the constructors return typed nil sinks on errors, which mustn't end up in a non nil interface
+	var sink api.EntrySink
+	var err error
+	switch {
+	case output == outputWebSocket:
+		return newWebSocketSink(), nil
+	case output == outputStdout:
+		return api.NewStdoutSink(), nil
+	case strings.HasPrefix(output, outputFilePrefix) && len(output) > len(outputFilePrefix):
+		sink, err = api.NewFileSink(strings.TrimPrefix(output, outputFilePrefix))
+	case strings.HasPrefix(output, outputOtlpPrefix):
+		sink, err = api.NewOtlpSink(strings.TrimPrefix(output, outputOtlpPrefix), otlpBatchSize, otlpExportInterval)
+	default:
+		return nil, fmt.Errorf("unknown output %s, expected %s, %s, %s<path> or %s<collector url>", output, outputWebSocket, outputStdout, outputFilePrefix, outputOtlpPrefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func newWebSocketSink() api.EntrySink {
+	socketConnection, err := dialSocketWithRetry(apiServerAddresses, socketConnectionRetries, socketConnectionRetryDelay, getSocketMaxRetryDelay())
+	if err != nil {
+		panic(fmt.Sprintf("Error connecting to socket server at %s %v", *apiServerAddress, err))
+	}
+	logger.Log.Infof("Connected successfully to websocket %s", apiServerAddresses.getActive())
+
+	sender := api.NewTappedEntrySender(func() (*websocket.Conn, error) {
+		return dialSocketWithRetry(apiServerAddresses, socketConnectionRetries, socketConnectionRetryDelay, getSocketMaxRetryDelay())
+	}, config.Config.MaxUnackedEntries)
+	sender.SetKeepalive(config.Config.SocketKeepalive)
+	if socketCompression != nil {
+		sender.SetCompressionStats(socketCompression)
+	}
+	return api.NewWebSocketSink(sender, socketConnection)
+}
+
+// pipeTapChannelToSink writes the captured items to the sink until the channel is closed, then closes the sink. The
+// items over the rate of rateLimiter, unless it's nil, are dropped before they're written.
+func pipeTapChannelToSink(sink api.EntrySink, messageDataChannel <-chan *tapApi.OutputChannelItem, rateLimiter *filtering.RateLimiter) {
 	if messageDataChannel == nil {
 		panic("Channel of captured messages is nil")
 	}
 
 	for messageData := range messageDataChannel {
-		marshaledData, err := models.CreateWebsocketTappedEntryMessage(messageData)
-		if err != nil {
-			logger.Log.Errorf("error converting message to json %v, err: %s, (%v,%+v)", messageData, err, err, err)
+		providers.EntryTapped()
+		if rateLimiter != nil && !rateLimiter.ShouldKeep(time.Now()) {
+			providers.EntryRateLimited()
+			providers.EntryFilteredOut()
 			continue
 		}
-
-		// NOTE: This is where the `*tapApi.OutputChannelItem` leaves the code
-		// and goes into the intermediate WebSocket.
-		err = connection.WriteMessage(websocket.TextMessage, marshaledData)
-		if err != nil {
-			logger.Log.Errorf("error sending message through socket server %v, err: %s, (%v,%+v)", messageData, err, err, err)
-			if errors.Is(err, syscall.EPIPE) {
-				logger.Log.Warning("detected socket disconnection, reestablishing socket connection")
-				connection, err = dialSocketWithRetry(*apiServerAddress, socketConnectionRetries, socketConnectionRetryDelay)
-				if err != nil {
-					logger.Log.Fatalf("error reestablishing socket connection: %v", err)
-				} else {
-					logger.Log.Info("recovered connection successfully")
-				}
-			}
-			continue
+		// redacted before the entry is serialized, the unredacted values never leave the tapper
+		if entryRedactor != nil {
+			entryRedactor.Redact(messageData)
+		}
+		if err := sink.Write(messageData); err != nil {
+			logger.Log.Errorf("error writing message %v to the output, err: %v", messageData, err)
 		}
 	}
+	if err := sink.Close(); err != nil {
+		logger.Log.Errorf("error closing the output, err: %v", err)
+	}
 }
 
 func getSyncEntriesConfig() *shared.SyncEntriesConfig {
@@ -351,26 +1139,136 @@ func determineLogLevel() (logLevel logging.Level) {
 	return
 }
 
-func dialSocketWithRetry(socketAddress string, retryAmount int, retryDelay time.Duration) (*websocket.Conn, error) {
+// namespacesFlag collects the namespaces of a repeated flag
+type namespacesFlag []string
+
+func newNamespacesFlag(name string, usage string) *namespacesFlag {
+	namespaces := &namespacesFlag{}
+	flag.Var(namespaces, name, usage)
+	return namespaces
+}
+
+func (namespaces *namespacesFlag) String() string {
+	return strings.Join(*namespaces, ",")
+}
+
+func (namespaces *namespacesFlag) Set(namespace string) error {
+	*namespaces = append(*namespaces, namespace)
+	return nil
+}
+
+// socketAddresses are the addresses of the api servers a tapper fails over between, the one that connected last is
+// the active address
+type socketAddresses struct {
+	addresses []string
+	active    int
+	lock      sync.Mutex
+}
+
+// newSocketAddresses returns nil when the comma separated list has no address
+func newSocketAddresses(addressesList string) *socketAddresses {
+	var addresses []string
+	for _, address := range strings.Split(addressesList, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	return &socketAddresses{addresses: addresses}
+}
+
+// getRotation returns the addresses starting from the active one
+func (socketAddresses *socketAddresses) getRotation() []string {
+	socketAddresses.lock.Lock()
+	defer socketAddresses.lock.Unlock()
+	rotation := make([]string, 0, len(socketAddresses.addresses))
+	for i := range socketAddresses.addresses {
+		rotation = append(rotation, socketAddresses.addresses[(socketAddresses.active+i)%len(socketAddresses.addresses)])
+	}
+	return rotation
+}
+
+func (socketAddresses *socketAddresses) getActive() string {
+	socketAddresses.lock.Lock()
+	defer socketAddresses.lock.Unlock()
+	return socketAddresses.addresses[socketAddresses.active]
+}
+
+func (socketAddresses *socketAddresses) setActive(address string) {
+	socketAddresses.lock.Lock()
+	defer socketAddresses.lock.Unlock()
+	for i, candidate := range socketAddresses.addresses {
+		if candidate == address && i != socketAddresses.active {
+			logger.Log.Infof("Switched the api server address from %s to %s", socketAddresses.addresses[socketAddresses.active], address)
+			socketAddresses.active = i
+		}
+	}
+}
+
+// dialSocketWithRetry tries the addresses in turn, starting from the active one, and waits once all of them failed.
+// The wait is twice as long after every failed round up to maxDelay and randomized so the tappers don't retry all at once.
+func dialSocketWithRetry(socketAddresses *socketAddresses, retryAmount int, baseDelay time.Duration, maxDelay time.Duration) (*websocket.Conn, error) {
 	var lastErr error
+	jitter := rand.New(rand.NewSource(time.Now().UnixNano()))
 	dialer := &websocket.Dialer{ // we use our own dialer instead of the default due to the default's 45 sec handshake timeout, we occasionally encounter hanging socket handshakes when tapper tries to connect to api too soon
 		Proxy:            http.ProxyFromEnvironment,
 		HandshakeTimeout: socketHandshakeTimeout,
+		Subprotocols:     models.GetSubprotocols(getWebSocketEncoding()),
+		TLSClientConfig:  socketTlsConfig, // used by the wss:// addresses only
 	}
-	for i := 1; i < retryAmount; i++ {
-		socketConnection, _, err := dialer.Dial(socketAddress, nil)
-		if err != nil {
+	if socketCompression != nil {
+		dialer.EnableCompression = true
+		dialer.NetDialContext = socketCompression.DialContext
+	}
+	var requestHeader http.Header
+	if config.Config != nil && config.Config.WebSocketToken != "" {
+		requestHeader = http.Header{"Authorization": {"Bearer " + config.Config.WebSocketToken}}
+	}
+	for i := 1; i <= retryAmount; i++ {
+		for _, socketAddress := range socketAddresses.getRotation() {
+			socketConnection, response, err := dialer.Dial(socketAddress, requestHeader)
+			if err == nil {
+				if dialer.EnableCompression && !isCompressionNegotiated(response) {
+					logger.Log.Infof("The api server at %s didn't negotiate compression, sending uncompressed frames", socketAddress)
+				}
+				socketAddresses.setActive(socketAddress)
+				return socketConnection, nil
+			}
+			lastErr = fmt.Errorf("%s: %v", socketAddress, err)
 			if i < retryAmount {
-				logger.Log.Infof("socket connection to %s failed: %v, retrying %d out of %d in %d seconds...", socketAddress, err, i, retryAmount, retryDelay / time.Second)
-				time.Sleep(retryDelay)
+				// the api server is expected to be unreachable while it starts
+				startupGrace.Warningf("socket connection to %s failed: %v", socketAddress, err)
 			}
-		} else {
-			return socketConnection, nil
+		}
+		if i < retryAmount {
+			retryDelay := getJitteredRetryDelay(getRetryDelay(i, baseDelay, maxDelay), jitter)
+			startupGrace.Warningf("socket connection failed, retrying %d out of %d in %v...", i, retryAmount, retryDelay.Round(time.Millisecond))
+			time.Sleep(retryDelay)
 		}
 	}
 	return nil, lastErr
 }
 
+// getRetryDelay returns the delay after the attempt, starting from 1, before the jitter
+func getRetryDelay(attempt int, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// getJitteredRetryDelay randomizes the delay between its half and itself
+func getJitteredRetryDelay(delay time.Duration, jitter *rand.Rand) time.Duration {
+	half := delay / 2
+	return half + time.Duration(jitter.Int63n(int64(delay-half)+1))
+}
+
 
 func startMizuTapperSyncer(ctx context.Context) (*kubernetes.MizuTapperSyncer, error){
 	provider, err := kubernetes.NewProviderInCluster()
@@ -381,6 +1279,7 @@ func startMizuTapperSyncer(ctx context.Context) (*kubernetes.MizuTapperSyncer, e
 	tapperSyncer, err := kubernetes.CreateAndStartMizuTapperSyncer(ctx, provider, kubernetes.TapperSyncerConfig{
 		TargetNamespaces:         config.Config.TargetNamespaces,
 		PodFilterRegex:           config.Config.TapTargetRegex.Regexp,
+		PodLabelSelector:         config.Config.TapTargetLabelSelector,
 		MizuResourcesNamespace:   config.Config.MizuResourcesNamespace,
 		AgentImage:               config.Config.AgentImage,
 		TapperResources:          config.Config.TapperResources,
@@ -389,6 +1288,7 @@ func startMizuTapperSyncer(ctx context.Context) (*kubernetes.MizuTapperSyncer, e
 		IgnoredUserAgents:        config.Config.IgnoredUserAgents,
 		MizuApiFilteringOptions:  config.Config.MizuApiFilteringOptions,
 		MizuServiceAccountExists: true, //assume service account exists since daemon mode will not function without it anyway
+		TapTargetRules:           config.Config.TapTargetRules,
 	})
 
 	if err != nil {
@@ -410,6 +1310,7 @@ func startMizuTapperSyncer(ctx context.Context) (*kubernetes.MizuTapperSyncer, e
 					logger.Log.Debug("mizuTapperSyncer pod changes channel closed, ending listener loop")
 					return
 				}
+				providers.TappedPodsChanged()
 				tapStatus := shared.TapStatus{Pods: kubernetes.GetPodInfosForPods(tapperSyncer.CurrentlyTappedPods)}
 
 				serializedTapStatus, err := json.Marshal(shared.CreateWebSocketStatusMessage(tapStatus))
@@ -417,7 +1318,7 @@ func startMizuTapperSyncer(ctx context.Context) (*kubernetes.MizuTapperSyncer, e
 					logger.Log.Fatalf("error serializing tap status: %v", err)
 				}
 				api.BroadcastToBrowserClients(serializedTapStatus)
-				providers.TapStatus.Pods = tapStatus.Pods
+				providers.SetTappedPods(tapStatus.Pods)
 			case <-ctx.Done():
 				logger.Log.Debug("mizuTapperSyncer event listener loop exiting due to context done")
 				return
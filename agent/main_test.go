@@ -0,0 +1,775 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/holder"
+	"mizuserver/pkg/providers"
+	"mizuserver/pkg/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"plugin"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const fakePluginContent = "fake plugin"
+const fakePluginOtherApiVersionContent = "fake plugin built against api version 0"
+const fakePluginWithoutApiVersionContent = "fake plugin without api version"
+
+type fakeDissector struct {
+	tapApi.Dissector
+	protocol *tapApi.Protocol
+}
+
+func (d *fakeDissector) Register(extension *tapApi.Extension) {
+	extension.Protocol = d.protocol
+}
+
+// useFakePlugins makes the files with the fake plugin contents load as extensions named by the files, the other files
+// are opened as plugins
+func useFakePlugins(t *testing.T) {
+	previousLookupDissector, previousConfig := lookupDissector, config.Config
+	t.Cleanup(func() { lookupDissector, config.Config = previousLookupDissector, previousConfig })
+	config.Config = &shared.MizuAgentConfig{}
+
+	lookupDissector = func(extensionPath string) (*plugin.Plugin, tapApi.Dissector, error) {
+		content, err := ioutil.ReadFile(extensionPath)
+		if err != nil {
+			return previousLookupDissector(extensionPath)
+		}
+		apiVersion := tapApi.ApiVersion
+		symbols := map[string]plugin.Symbol{
+			"ApiVersion": &apiVersion,
+			"Dissector":  &fakeDissector{protocol: &tapApi.Protocol{Name: strings.TrimSuffix(path.Base(extensionPath), ".so")}},
+		}
+		switch string(content) {
+		case fakePluginContent:
+		case fakePluginOtherApiVersionContent:
+			apiVersion = "0"
+		case fakePluginWithoutApiVersionContent:
+			delete(symbols, "ApiVersion")
+		default:
+			return previousLookupDissector(extensionPath)
+		}
+		dissector, err := lookupExtensionDissector(func(symName string) (plugin.Symbol, error) {
+			if symbol, ok := symbols[symName]; ok {
+				return symbol, nil
+			}
+			return nil, fmt.Errorf("symbol %s not found", symName)
+		})
+		return nil, dissector, err
+	}
+}
+
+func writeExtensionFiles(t *testing.T, files map[string]string) string {
+	extensionsDir, err := ioutil.TempDir("", "mizu-extensions-test")
+	if err != nil {
+		t.Fatalf("failed to create extensions dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(extensionsDir) })
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(extensionsDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write extension file: %v", err)
+		}
+	}
+	return extensionsDir
+}
+
+func TestLoadExtensionsSkipsUnloadable(t *testing.T) {
+	useFakePlugins(t)
+	extensionsDir := writeExtensionFiles(t, map[string]string{
+		"amqp.so":    fakePluginContent,
+		"corrupt.so": "not a plugin",
+		"redis.so":   fakePluginContent,
+	})
+
+	loadedExtensions, loadErrors := loadExtensions(extensionsDir)
+	if len(loadedExtensions) != 2 || extensionsMap["amqp"] == nil || extensionsMap["redis"] == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp and redis", loadedExtensions)
+	}
+	if len(loadErrors) != 1 || !strings.Contains(loadErrors[0].Error(), "corrupt.so") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "an error of corrupt.so", loadErrors)
+	}
+}
+
+func TestLoadExtensionsChecksApiVersion(t *testing.T) {
+	useFakePlugins(t)
+	extensionsDir := writeExtensionFiles(t, map[string]string{
+		"amqp.so":  fakePluginContent,
+		"kafka.so": fakePluginOtherApiVersionContent,
+		"redis.so": fakePluginWithoutApiVersionContent,
+	})
+
+	loadedExtensions, loadErrors := loadExtensions(extensionsDir)
+	if len(loadedExtensions) != 1 || extensionsMap["amqp"] == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp", loadedExtensions)
+	}
+	if len(loadErrors) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 2, loadErrors)
+	}
+	expectedMismatch := fmt.Sprintf("extension kafka.so: the extension is built against version \"0\" of the extensions api while the agent is built against version %q", tapApi.ApiVersion)
+	if !strings.Contains(loadErrors[0].Error(), expectedMismatch) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedMismatch, loadErrors[0])
+	}
+	if !strings.Contains(loadErrors[1].Error(), "redis.so: the plugin doesn't declare the extensions api version") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the missing version of redis.so", loadErrors[1])
+	}
+}
+
+func TestLoadExtensionsNoneLoaded(t *testing.T) {
+	useFakePlugins(t)
+	extensionsDir := writeExtensionFiles(t, map[string]string{"corrupt.so": "not a plugin"})
+
+	if loadedExtensions, loadErrors := loadExtensions(extensionsDir); len(loadedExtensions) != 0 || len(loadErrors) != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "no extensions", loadedExtensions, loadErrors)
+	}
+	if loadedExtensions, loadErrors := loadExtensions(path.Join(extensionsDir, "missing")); len(loadedExtensions) != 0 || len(loadErrors) != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "no extensions", loadedExtensions, loadErrors)
+	}
+}
+
+func TestLoadExtensionsFiltersProtocols(t *testing.T) {
+	tests := []struct {
+		name              string
+		enabledProtocols  []string
+		disabledProtocols []string
+		expectedLoaded    []string
+		expectedTls       bool
+	}{
+		{name: "allowlist", enabledProtocols: []string{"redis", "amqp", "grpc"}, expectedLoaded: []string{"amqp", "redis"}},
+		{name: "allowlist with tls", enabledProtocols: []string{"redis", "tls"}, expectedLoaded: []string{"redis"}, expectedTls: true},
+		{name: "denylist", disabledProtocols: []string{"kafka", "grpc"}, expectedLoaded: []string{"amqp", "redis"}, expectedTls: true},
+		{name: "denylist with tls", disabledProtocols: []string{"tls"}, expectedLoaded: []string{"amqp", "kafka", "redis"}},
+		{name: "allowlist and denylist", enabledProtocols: []string{"amqp", "kafka"}, disabledProtocols: []string{"kafka"}, expectedLoaded: []string{"amqp"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFakePlugins(t)
+			config.Config.EnabledProtocols, config.Config.DisabledProtocols = test.enabledProtocols, test.disabledProtocols
+			extensionsDir := writeExtensionFiles(t, map[string]string{
+				"amqp.so":  fakePluginContent,
+				"kafka.so": fakePluginContent,
+				"redis.so": fakePluginContent,
+			})
+
+			loadedExtensions, loadErrors := loadExtensions(extensionsDir)
+			loaded := make([]string, 0)
+			for _, extension := range loadedExtensions {
+				loaded = append(loaded, extension.Protocol.Name)
+			}
+			sort.Strings(loaded)
+			if !reflect.DeepEqual(loaded, test.expectedLoaded) || len(loadErrors) != 0 {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", test.expectedLoaded, loaded, loadErrors)
+			}
+			// the built-in tls extension is mapped but never loaded for dissecting
+			expectedMapped := len(test.expectedLoaded)
+			if test.expectedTls {
+				expectedMapped++
+			}
+			if len(extensionsMap) != expectedMapped || (extensionsMap["tls"] != nil) != test.expectedTls {
+				t.Errorf("unexpected result - expected: %v %v, actual: %v", test.expectedLoaded, test.expectedTls, extensionsMap)
+			}
+			for _, protocolName := range test.expectedLoaded {
+				if extensionsMap[protocolName] == nil {
+					t.Errorf("unexpected result - expected: %v, actual: %v", protocolName, extensionsMap)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadExtensionsLimitsBuiltInExtensions(t *testing.T) {
+	useFakePlugins(t)
+	config.Config.MaxExtensions = 2
+	extensionsDir := writeExtensionFiles(t, map[string]string{"amqp.so": fakePluginContent, "redis.so": fakePluginContent})
+
+	if loadedExtensions, _ := loadExtensions(extensionsDir); len(loadedExtensions) != 2 || extensionsMap["tls"] != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp and redis", extensionsMap)
+	}
+
+	// the built-in extension is selected first once it's ordered
+	config.Config.ExtensionsOrder = []string{"tls"}
+	if loadedExtensions, _ := loadExtensions(extensionsDir); len(loadedExtensions) != 1 || extensionsMap["tls"] == nil || extensionsMap["amqp"] == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp and tls", extensionsMap)
+	}
+}
+
+func TestReloadExtensions(t *testing.T) {
+	useFakePlugins(t)
+	extensionsDir := writeExtensionFiles(t, map[string]string{"amqp.so": fakePluginContent})
+	if loadedExtensions, _ := loadExtensions(extensionsDir); len(loadedExtensions) != 1 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 1, len(loadedExtensions))
+	}
+
+	// the entries are analyzed with the extensions while they're reloaded
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if holder.GetExtensionsMap()["amqp"] == nil {
+				t.Errorf("unexpected result - expected: %v, actual: %v", "amqp", holder.GetExtensionsMap())
+				return
+			}
+		}
+	}()
+	if err := ioutil.WriteFile(path.Join(extensionsDir, "redis.so"), []byte(fakePluginContent), 0644); err != nil {
+		t.Fatalf("failed to write extension file: %v", err)
+	}
+	reloadExtensions(extensionsDir)
+	<-done
+	if extensionsMap := holder.GetExtensionsMap(); len(extensionsMap) != 3 || extensionsMap["redis"] == nil || extensionsMap["tls"] == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp, redis and tls", extensionsMap)
+	}
+
+	// a reload that loads nothing keeps the loaded extensions
+	os.Remove(path.Join(extensionsDir, "amqp.so"))
+	if err := ioutil.WriteFile(path.Join(extensionsDir, "redis.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatalf("failed to write extension file: %v", err)
+	}
+	reloadExtensions(extensionsDir)
+	if extensionsMap := holder.GetExtensionsMap(); len(extensionsMap) != 3 || len(getLoadedExtensions()) != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp, redis and tls", extensionsMap)
+	}
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt       int
+		expectedDelay time.Duration
+	}{
+		{attempt: 1, expectedDelay: 2 * time.Second},
+		{attempt: 2, expectedDelay: 4 * time.Second},
+		{attempt: 4, expectedDelay: 16 * time.Second},
+		{attempt: 5, expectedDelay: 30 * time.Second},
+		{attempt: 100, expectedDelay: 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		if delay := getRetryDelay(test.attempt, 2*time.Second, 30*time.Second); delay != test.expectedDelay {
+			t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedDelay, delay)
+		}
+	}
+}
+
+func TestGetJitteredRetryDelay(t *testing.T) {
+	jitter := rand.New(rand.NewSource(1))
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		delay := getJitteredRetryDelay(4*time.Second, jitter)
+		if delay < 2*time.Second || delay > 4*time.Second {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", "2s to 4s", delay)
+		}
+		delays[delay] = true
+	}
+	if len(delays) < 90 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "randomized delays", len(delays))
+	}
+}
+
+func TestDialSocketWithRetryReturnsLastError(t *testing.T) {
+	previousStartupGrace := startupGrace
+	startupGrace = utils.NewStartupGrace(0)
+	t.Cleanup(func() { startupGrace = previousStartupGrace })
+
+	// a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	connection, err := dialSocketWithRetry(newSocketAddresses("ws://"+address+"/wsTapper"), 2, time.Millisecond, time.Millisecond)
+	if connection != nil || err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "connection refused", connection, err)
+	}
+}
+
+func TestDialSocketWithRetryFailsOver(t *testing.T) {
+	previousStartupGrace := startupGrace
+	startupGrace = utils.NewStartupGrace(0)
+	t.Cleanup(func() { startupGrace = previousStartupGrace })
+
+	failedDials := 0
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failedDials++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingServer.Close)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connection, err := upgrader.Upgrade(w, r, nil); err == nil {
+			connection.Close()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	failingAddress := "ws" + strings.TrimPrefix(failingServer.URL, "http") + "/wsTapper"
+	address := "ws" + strings.TrimPrefix(server.URL, "http") + "/wsTapper"
+	addresses := newSocketAddresses(failingAddress + ", " + address)
+
+	for i := 0; i < 2; i++ {
+		connection, err := dialSocketWithRetry(addresses, 2, time.Millisecond, time.Millisecond)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		connection.Close()
+	}
+
+	if active := addresses.getActive(); active != address {
+		t.Errorf("unexpected result - expected: %v, actual: %v", address, active)
+	}
+	// the dials after the failover start from the address that connected
+	if failedDials != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, failedDials)
+	}
+}
+
+func TestGetPcapFiles(t *testing.T) {
+	pcapDir := t.TempDir()
+	for _, name := range []string{"b.pcapng", "a.pcap", "c.CAP", "notes.txt"} {
+		ioutil.WriteFile(path.Join(pcapDir, name), nil, 0600)
+	}
+	os.Mkdir(path.Join(pcapDir, "nested.pcap"), 0700)
+
+	pcapFiles, err := getPcapFiles(pcapDir, "/captures/extra.pcap")
+	expectedFiles := []string{path.Join(pcapDir, "a.pcap"), path.Join(pcapDir, "b.pcapng"), path.Join(pcapDir, "c.CAP"), "/captures/extra.pcap"}
+	if err != nil || strings.Join(pcapFiles, ",") != strings.Join(expectedFiles, ",") {
+		t.Errorf("unexpected result - expected: %v, actual: %v (%v)", expectedFiles, pcapFiles, err)
+	}
+
+	if _, err := getPcapFiles(path.Join(pcapDir, "missing"), ""); err == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "an error", err)
+	}
+	if pcapFiles, _ := getPcapFiles("", ""); len(pcapFiles) != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, len(pcapFiles))
+	}
+}
+
+func TestDecodeItemsAndClose(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "http://orders/orders?id=1", nil)
+	inChannel := make(chan *tapApi.OutputChannelItem, 2)
+	outChannel := make(chan *tapApi.OutputChannelItem, 2)
+	inChannel <- &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair:     &tapApi.RequestResponsePair{Request: tapApi.GenericMessage{IsRequest: true, Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpRequest, Data: request}}},
+	}
+	close(inChannel)
+
+	decodeItemsAndClose(inChannel, outChannel)
+	item := <-outChannel
+	payload, ok := item.Pair.Request.Payload.(map[string]interface{})
+	if !ok || payload["method"] != http.MethodGet {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "a decoded payload", item.Pair.Request.Payload)
+	}
+	if _, ok := payload["details"].(map[string]interface{}); !ok {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the har details", payload)
+	}
+	if _, ok := <-outChannel; ok {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a closed channel", "another item")
+	}
+}
+
+func TestNewDrainContext(t *testing.T) {
+	ctx, cancelSignal := context.WithCancel(context.Background())
+	drainCtx, cancelDrain := newDrainContext(ctx, 50*time.Millisecond)
+	defer cancelDrain()
+
+	cancelSignal()
+	select {
+	case <-drainCtx.Done():
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "draining", "done at the signal")
+	case <-time.After(20 * time.Millisecond):
+	}
+	select {
+	case <-drainCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "done after the drain timeout", "still draining")
+	}
+
+	// cancelling it ends the drain without a signal
+	drainCtx, cancelDrain = newDrainContext(context.Background(), time.Hour)
+	cancelDrain()
+	if drainCtx.Err() == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", context.Canceled, drainCtx.Err())
+	}
+}
+
+func TestNewSocketAddresses(t *testing.T) {
+	tests := []struct {
+		addressesList string
+		expected      []string
+	}{
+		{addressesList: "ws://mizu-api-server/wsTapper", expected: []string{"ws://mizu-api-server/wsTapper"}},
+		{addressesList: "ws://a/wsTapper, ws://b/wsTapper,", expected: []string{"ws://a/wsTapper", "ws://b/wsTapper"}},
+		{addressesList: " , ", expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.addressesList, func(t *testing.T) {
+			addresses := newSocketAddresses(test.addressesList)
+			var actual []string
+			if addresses != nil {
+				actual = addresses.getRotation()
+			}
+			if strings.Join(actual, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestProtocolAllowlist(t *testing.T) {
+	tests := []struct {
+		name             string
+		filteringOptions string
+		allowed          []string
+		dropped          []string
+	}{
+		{name: "no options", filteringOptions: "", allowed: []string{"http", "kafka", "redis"}},
+		{name: "empty", filteringOptions: `{"ProtocolAllowlist": []}`, allowed: []string{"http", "kafka", "redis"}},
+		{name: "single protocol", filteringOptions: `{"ProtocolAllowlist": ["http"]}`, allowed: []string{"http"}, dropped: []string{"kafka", "redis"}},
+		{name: "multiple protocols", filteringOptions: `{"ProtocolAllowlist": [" HTTP ", "kafka", ""]}`, allowed: []string{"http", "kafka"}, dropped: []string{"redis", "amqp"}},
+	}
+
+	previousFilteringOptions, hadFilteringOptions := os.LookupEnv(shared.MizuFilteringOptionsEnvVar)
+	t.Cleanup(func() {
+		if hadFilteringOptions {
+			os.Setenv(shared.MizuFilteringOptionsEnvVar, previousFilteringOptions)
+		} else {
+			os.Unsetenv(shared.MizuFilteringOptionsEnvVar)
+		}
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv(shared.MizuFilteringOptionsEnvVar, test.filteringOptions)
+			allowlist := newProtocolAllowlist(getTrafficFilteringOptions().ProtocolAllowlist)
+
+			for _, protocol := range test.allowed {
+				if !isProtocolAllowed(allowlist, protocol) {
+					t.Errorf("unexpected result - expected: %v, actual: %v (%s)", true, false, protocol)
+				}
+			}
+			for _, protocol := range test.dropped {
+				if isProtocolAllowed(allowlist, protocol) {
+					t.Errorf("unexpected result - expected: %v, actual: %v (%s)", false, true, protocol)
+				}
+			}
+		})
+	}
+}
+
+func TestDialSocketWithRetryCompression(t *testing.T) {
+	tests := []struct {
+		name                string
+		serverCompression   bool
+		expectedCompression bool
+	}{
+		{name: "negotiated", serverCompression: true, expectedCompression: true},
+		{name: "not negotiated", serverCompression: false, expectedCompression: false},
+	}
+
+	previousSocketCompression := socketCompression
+	t.Cleanup(func() { socketCompression = previousSocketCompression })
+	message := []byte(strings.Repeat(`{"method":"GET","path":"/api/v1/orders","status":200}`, 100))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			socketCompression = &api.CompressionStats{}
+			upgrader := websocket.Upgrader{EnableCompression: test.serverCompression}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if connection, err := upgrader.Upgrade(w, r, nil); err == nil {
+					connection.ReadMessage()
+					connection.Close()
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			connection, err := dialSocketWithRetry(newSocketAddresses("ws"+strings.TrimPrefix(server.URL, "http")), 1, time.Millisecond, time.Millisecond)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer connection.Close()
+			_, handshakeBytes := socketCompression.GetTotals()
+			if err := connection.WriteMessage(websocket.TextMessage, message); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			_, wireBytes := socketCompression.GetTotals()
+			if isCompressed := wireBytes-handshakeBytes < uint64(len(message)); isCompressed != test.expectedCompression {
+				t.Errorf("unexpected result - expected: %v, actual: %v (%d bytes written for %d)", test.expectedCompression, isCompressed, wireBytes-handshakeBytes, len(message))
+			}
+		})
+	}
+}
+
+func TestDialSocketWithRetryTls(t *testing.T) {
+	previousStartupGrace, previousSocketTlsConfig := startupGrace, socketTlsConfig
+	startupGrace = utils.NewStartupGrace(0)
+	t.Cleanup(func() { startupGrace, socketTlsConfig = previousStartupGrace, previousSocketTlsConfig })
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connection, err := upgrader.Upgrade(w, r, nil); err == nil {
+			connection.Close()
+		}
+	}))
+	t.Cleanup(server.Close)
+	// the certificate of the test server is self signed
+	caFile := path.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatalf("failed to write the ca bundle: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		caFile             string
+		insecureSkipVerify bool
+		expectedError      bool
+	}{
+		{name: "system cas", expectedError: true},
+		{name: "ca bundle", caFile: caFile, expectedError: false},
+		{name: "insecure skip verify", insecureSkipVerify: true, expectedError: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			if socketTlsConfig, err = utils.NewClientTlsConfig(test.caFile, "", "", test.insecureSkipVerify); err != nil {
+				t.Fatalf("failed to create the tls config: %v", err)
+			}
+			connection, err := dialSocketWithRetry(newSocketAddresses("wss"+strings.TrimPrefix(server.URL, "https")+"/wsTapper"), 1, time.Millisecond, time.Millisecond)
+			if connection != nil {
+				connection.Close()
+			}
+			if (err != nil) != test.expectedError {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestNewEntrySink(t *testing.T) {
+	tests := []struct {
+		output        string
+		expectedError bool
+	}{
+		{output: outputStdout, expectedError: false},
+		{output: outputFilePrefix + path.Join(t.TempDir(), "entries.jsonl"), expectedError: false},
+		{output: outputFilePrefix, expectedError: true},
+		{output: outputOtlpPrefix + "http://localhost:4318", expectedError: false},
+		{output: outputOtlpPrefix + "localhost:4318", expectedError: true},
+		{output: "kafka", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.output, func(t *testing.T) {
+			sink, err := newEntrySink(test.output)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", test.expectedError, err)
+			}
+			if sink != nil {
+				sink.Close()
+			}
+		})
+	}
+}
+
+func TestGetTrafficFilteringOptionsIgnoredPathPatterns(t *testing.T) {
+	tests := []struct {
+		name             string
+		filteringOptions string
+		expectedPanic    bool
+	}{
+		{name: "valid patterns", filteringOptions: `{"IgnoredPathPatterns": ["^/health$", "/metrics"]}`, expectedPanic: false},
+		{name: "invalid pattern", filteringOptions: `{"IgnoredPathPatterns": ["^/health$", "/users/(["]}`, expectedPanic: true},
+	}
+
+	previousFilteringOptions, hadFilteringOptions := os.LookupEnv(shared.MizuFilteringOptionsEnvVar)
+	t.Cleanup(func() {
+		if hadFilteringOptions {
+			os.Setenv(shared.MizuFilteringOptionsEnvVar, previousFilteringOptions)
+		} else {
+			os.Unsetenv(shared.MizuFilteringOptionsEnvVar)
+		}
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv(shared.MizuFilteringOptionsEnvVar, test.filteringOptions)
+			defer func() {
+				if panicked := recover() != nil; panicked != test.expectedPanic {
+					t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedPanic, panicked)
+				}
+			}()
+			getTrafficFilteringOptions()
+		})
+	}
+}
+
+func TestGetDryRunReport(t *testing.T) {
+	useFakePlugins(t)
+	extensionsDir := writeExtensionFiles(t, map[string]string{"amqp.so": fakePluginContent, "redis.so": fakePluginContent})
+	if loadedExtensions, _ := loadExtensions(extensionsDir); len(loadedExtensions) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(loadedExtensions))
+	}
+
+	previousTapperMode := *tapperMode
+	t.Cleanup(func() { *tapperMode = previousTapperMode })
+	*tapperMode = true
+	for name, value := range map[string]string{
+		shared.NodeNameEnvVar:                   "node-1",
+		shared.TappedAddressesPerNodeDictEnvVar: `{"node-1": ["10.0.0.1", "10.0.0.2"], "node-2": ["10.0.0.3"]}`,
+		shared.MizuFilteringOptionsEnvVar:       `{"ProtocolAllowlist": ["amqp"]}`,
+	} {
+		previousValue, hadValue := os.LookupEnv(name)
+		name := name
+		t.Cleanup(func() {
+			if hadValue {
+				os.Setenv(name, previousValue)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+		os.Setenv(name, value)
+	}
+
+	report := getDryRunReport()
+
+	if report.Mode != "tap" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "tap", report.Mode)
+	}
+	if strings.Join(report.TapTargets, ",") != "10.0.0.1,10.0.0.2" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "10.0.0.1,10.0.0.2", report.TapTargets)
+	}
+	if strings.Join(report.FilteringOptions.ProtocolAllowlist, ",") != "amqp" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp", report.FilteringOptions.ProtocolAllowlist)
+	}
+	var extensionNames []string
+	for _, extension := range report.Extensions {
+		extensionNames = append(extensionNames, extension.Name)
+	}
+	if strings.Join(extensionNames, ",") != "amqp,redis" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "amqp,redis", extensionNames)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name                string
+		allowedOrigins      []string
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{name: "empty list", allowedOrigins: nil, origin: "https://mizu.example.com", expectedOrigin: "*", expectedCredentials: ""},
+		{name: "exact match", allowedOrigins: []string{"https://mizu.example.com"}, origin: "https://mizu.example.com", expectedOrigin: "https://mizu.example.com", expectedCredentials: "true"},
+		{name: "exact mismatch", allowedOrigins: []string{"https://mizu.example.com"}, origin: "https://evil.example.com", expectedOrigin: "", expectedCredentials: ""},
+		{name: "wildcard subdomain", allowedOrigins: []string{"https://*.example.com"}, origin: "https://mizu.staging.example.com", expectedOrigin: "https://mizu.staging.example.com", expectedCredentials: "true"},
+		{name: "wildcard doesn't match the domain", allowedOrigins: []string{"https://*.example.com"}, origin: "https://example.com", expectedOrigin: "", expectedCredentials: ""},
+		{name: "wildcard doesn't match a lookalike domain", allowedOrigins: []string{"https://*.example.com"}, origin: "https://mizu.example.com.evil.io", expectedOrigin: "", expectedCredentials: ""},
+		{name: "wildcard doesn't match another scheme", allowedOrigins: []string{"https://*.example.com"}, origin: "http://mizu.example.com", expectedOrigin: "", expectedCredentials: ""},
+		{name: "no origin", allowedOrigins: []string{"https://mizu.example.com"}, origin: "", expectedOrigin: "", expectedCredentials: ""},
+	}
+
+	previousConfig := config.Config
+	t.Cleanup(func() { config.Config = previousConfig })
+	gin.SetMode(gin.TestMode)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Config = &shared.MizuAgentConfig{AllowedOrigins: test.allowedOrigins}
+			app := gin.New()
+			app.Use(CORSMiddleware())
+			app.GET("/echo", func(c *gin.Context) { c.String(http.StatusOK, "") })
+
+			request := httptest.NewRequest(http.MethodGet, "/echo", nil)
+			if test.origin != "" {
+				request.Header.Set("Origin", test.origin)
+			}
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, request)
+
+			if origin := response.Header().Get("Access-Control-Allow-Origin"); origin != test.expectedOrigin {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedOrigin, origin)
+			}
+			if credentials := response.Header().Get("Access-Control-Allow-Credentials"); credentials != test.expectedCredentials {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedCredentials, credentials)
+			}
+		})
+	}
+}
+
+type recordingSink struct {
+	written []*tapApi.OutputChannelItem
+}
+
+func (sink *recordingSink) Write(item *tapApi.OutputChannelItem) error {
+	sink.written = append(sink.written, item)
+	return nil
+}
+
+func (sink *recordingSink) Close() error {
+	return nil
+}
+
+func TestPipeTapChannelToSinkLimitsRate(t *testing.T) {
+	rateLimiter, _ := filtering.NewRateLimiter(2, 0)
+	channel := make(chan *tapApi.OutputChannelItem, 5)
+	for i := 0; i < 5; i++ {
+		channel <- &tapApi.OutputChannelItem{Protocol: tapApi.Protocol{Name: "redis"}}
+	}
+	close(channel)
+
+	tappedBefore := getMetricValue(t, "mizu_tapped_entries_total")
+	filteredOutBefore := getMetricValue(t, "mizu_filtered_out_entries_total")
+	rateLimitedBefore := getMetricValue(t, "mizu_rate_limited_entries_total")
+
+	sink := &recordingSink{}
+	pipeTapChannelToSink(sink, channel, rateLimiter)
+	if len(sink.written) != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, len(sink.written))
+	}
+
+	// the tapper doesn't run filterItems, its entries are counted as they're sent
+	if tapped := getMetricValue(t, "mizu_tapped_entries_total") - tappedBefore; tapped != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 5, tapped)
+	}
+	if filteredOut := getMetricValue(t, "mizu_filtered_out_entries_total") - filteredOutBefore; filteredOut != 3 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 3, filteredOut)
+	}
+	if rateLimited := getMetricValue(t, "mizu_rate_limited_entries_total") - rateLimitedBefore; rateLimited != 3 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 3, rateLimited)
+	}
+}
+
+func getMetricValue(t *testing.T, name string) float64 {
+	metricFamilies, err := providers.MetricsRegistry.Gather()
+	if err != nil {
+		t.Fatalf("failed gathering metrics: %v", err)
+	}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == name {
+			return metricFamily.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("metric %s wasn't gathered", name)
+	return 0
+}
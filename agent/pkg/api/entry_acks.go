@@ -0,0 +1,57 @@
+package api
+
+import (
+	"mizuserver/pkg/models"
+	"sync"
+
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type entryAck struct {
+	socketId int
+	sequence uint64
+}
+
+// pendingEntryAcks holds the socket and the sequence of the entries tappers are waiting to have acknowledged
+var pendingEntryAcks sync.Map
+
+func expectEntryAck(item *tapApi.OutputChannelItem, socketId int, sequence uint64) {
+	if sequence != 0 {
+		pendingEntryAcks.Store(item, entryAck{socketId: socketId, sequence: sequence})
+	}
+}
+
+// AckEntry acknowledges an entry once it was persisted or dropped, entries that weren't sent with a sequence need no
+// acknowledgement. A tapper that reconnected since it sent the entry resends it, so it's stored at least once.
+func AckEntry(item *tapApi.OutputChannelItem) {
+	value, ok := pendingEntryAcks.LoadAndDelete(item)
+	if !ok {
+		return
+	}
+	ack := value.(entryAck)
+
+	message, err := models.CreateWebsocketTappedEntryAckMessage(ack.sequence)
+	if err != nil {
+		logger.Log.Errorf("Error creating ack of entry %d: %v", ack.sequence, err)
+		return
+	}
+	if err := SendToSocket(ack.socketId, message); err != nil {
+		logger.Log.Debugf("Error sending ack of entry %d to socket ID %d: %v", ack.sequence, ack.socketId, err)
+	}
+}
+
+// getEntrySource returns the socket of the tapper that sent an entry which isn't acknowledged yet, -1 for the entries
+// tapped by this process or sent without a sequence
+func getEntrySource(item *tapApi.OutputChannelItem) int {
+	value, ok := pendingEntryAcks.Load(item)
+	if !ok {
+		return -1
+	}
+	return value.(entryAck).socketId
+}
+
+// forgetEntryAck leaves an entry that wasn't stored unacknowledged, the tapper resends it once it reconnects
+func forgetEntryAck(item *tapApi.OutputChannelItem) {
+	pendingEntryAcks.Delete(item)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"mizuserver/pkg/config"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// EntryBatcher groups entries and hands them to flush once the batch reaches maxSize entries or once interval passed
+// since the last flush, an empty batch is never flushed
+type EntryBatcher struct {
+	maxSize int
+	flush   func(batch []*tapApi.BaseEntryDetails)
+	batch   []*tapApi.BaseEntryDetails
+	lock    sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+const (
+	defaultEntryBroadcastBatchInterval = time.Second
+	defaultEntryBroadcastBatchMaxSize  = 100
+)
+
+// NewEntryBroadcastBatcher returns nil when the broadcasts aren't batched, the interval and the size that aren't
+// positive are defaulted
+func NewEntryBroadcastBatcher(batchConfig *shared.EntryBroadcastBatchConfig) *EntryBatcher {
+	if batchConfig == nil {
+		return nil
+	}
+	interval := defaultEntryBroadcastBatchInterval
+	if batchConfig.IntervalMs > 0 {
+		interval = time.Duration(batchConfig.IntervalMs) * time.Millisecond
+	}
+	maxSize := defaultEntryBroadcastBatchMaxSize
+	if batchConfig.MaxSize > 0 {
+		maxSize = batchConfig.MaxSize
+	}
+	return NewEntryBatcher(maxSize, interval, broadcastEntryBatch)
+}
+
+func NewEntryBatcher(maxSize int, interval time.Duration, flush func(batch []*tapApi.BaseEntryDetails)) *EntryBatcher {
+	batcher := &EntryBatcher{maxSize: maxSize, flush: flush, stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(batcher.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				batcher.Flush()
+			case <-batcher.stop:
+				return
+			}
+		}
+	}()
+
+	return batcher
+}
+
+func (batcher *EntryBatcher) Add(entry *tapApi.BaseEntryDetails) {
+	batcher.lock.Lock()
+	batcher.batch = append(batcher.batch, entry)
+	var fullBatch []*tapApi.BaseEntryDetails
+	if len(batcher.batch) >= batcher.maxSize {
+		fullBatch = batcher.batch
+		batcher.batch = nil
+	}
+	batcher.lock.Unlock()
+
+	if fullBatch != nil {
+		batcher.flush(fullBatch)
+	}
+}
+
+func (batcher *EntryBatcher) Flush() {
+	batcher.lock.Lock()
+	batch := batcher.batch
+	batcher.batch = nil
+	batcher.lock.Unlock()
+
+	if len(batch) > 0 {
+		batcher.flush(batch)
+	}
+}
+
+// Stop stops the periodic flushes and flushes the partial batch, the batcher mustn't be used once it's stopped
+func (batcher *EntryBatcher) Stop() {
+	close(batcher.stop)
+	<-batcher.stopped
+	batcher.Flush()
+}
+
+func broadcastEntryBatch(batch []*tapApi.BaseEntryDetails) {
+	messages, err := CreateEntryBatchMessages(batch, config.Config.MaxBroadcastEntryBytes)
+	if err != nil {
+		logger.Log.Errorf("Failed creating entry batch message: %v", err)
+		return
+	}
+	for _, message := range messages {
+		BroadcastToBrowserClients(message)
+	}
+}
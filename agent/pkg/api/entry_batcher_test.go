@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"mizuserver/pkg/api"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type batchRecorder struct {
+	batches [][]string
+	lock    sync.Mutex
+}
+
+func (recorder *batchRecorder) flush(batch []*tapApi.BaseEntryDetails) {
+	ids := make([]string, 0)
+	for _, entry := range batch {
+		ids = append(ids, entry.Id)
+	}
+
+	recorder.lock.Lock()
+	recorder.batches = append(recorder.batches, ids)
+	recorder.lock.Unlock()
+}
+
+func (recorder *batchRecorder) getBatches() [][]string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return recorder.batches
+}
+
+func TestEntryBatcherSizeTrigger(t *testing.T) {
+	recorder := &batchRecorder{}
+	batcher := api.NewEntryBatcher(3, time.Hour, recorder.flush)
+	defer batcher.Stop()
+
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+		batcher.Add(&tapApi.BaseEntryDetails{Id: id})
+	}
+
+	batches := recorder.getBatches()
+	if len(batches) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(batches))
+	}
+	if batches[0][0] != "1" || batches[0][2] != "3" || batches[1][0] != "4" || batches[1][2] != "6" {
+		t.Errorf("unexpected batches %v", batches)
+	}
+
+	batcher.Flush()
+	if batches := recorder.getBatches(); len(batches) != 3 || len(batches[2]) != 1 || batches[2][0] != "7" {
+		t.Errorf("unexpected batches %v", batches)
+	}
+}
+
+func TestEntryBatcherIntervalTrigger(t *testing.T) {
+	recorder := &batchRecorder{}
+	batcher := api.NewEntryBatcher(100, 50*time.Millisecond, recorder.flush)
+	defer batcher.Stop()
+
+	batcher.Add(&tapApi.BaseEntryDetails{Id: "1"})
+	batcher.Add(&tapApi.BaseEntryDetails{Id: "2"})
+
+	if batches := recorder.getBatches(); len(batches) != 0 {
+		t.Fatalf("batch flushed before the interval passed %v", batches)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.getBatches()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// further ticks must not flush empty batches
+	time.Sleep(150 * time.Millisecond)
+
+	batches := recorder.getBatches()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Errorf("unexpected batches %v", batches)
+	}
+}
+
+func TestEntryBatcherStop(t *testing.T) {
+	recorder := &batchRecorder{}
+	batcher := api.NewEntryBatcher(100, 20*time.Millisecond, recorder.flush)
+
+	batcher.Add(&tapApi.BaseEntryDetails{Id: "1"})
+	batcher.Stop()
+	if batches := recorder.getBatches(); len(batches) != 1 || len(batches[0]) != 1 || batches[0][0] != "1" {
+		t.Errorf("unexpected batches %v", batches)
+	}
+}
+
+func TestEntryBroadcastBatcherZeroValueConfig(t *testing.T) {
+	// a ticker of a zero interval panics, the zero values are defaulted
+	if batcher := api.NewEntryBroadcastBatcher(&shared.EntryBroadcastBatchConfig{}); batcher == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a batcher", batcher)
+	}
+}
+
+func TestEntryBroadcastBatcherNotConfigured(t *testing.T) {
+	if batcher := api.NewEntryBroadcastBatcher(nil); batcher != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, batcher)
+	}
+}
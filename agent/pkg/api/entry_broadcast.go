@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/utils"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const entryReferencePreviewBytes = 256
+
+// CreateEntryMessage returns the message of the entry, or a reference to it when the message is larger than
+// maxSizeBytes so a single entry can't exceed the max message size of the clients. 0 means no limit.
+func CreateEntryMessage(baseEntry *tapApi.BaseEntryDetails, maxSizeBytes int) ([]byte, error) {
+	message, err := models.CreateBaseEntryWebSocketMessage(baseEntry)
+	if err != nil || maxSizeBytes <= 0 || len(message) <= maxSizeBytes {
+		return message, err
+	}
+	return models.CreateEntryReferenceWebSocketMessage(newEntryReference(baseEntry, len(message)))
+}
+
+// CreateEntryBatchMessages returns the batch messages of the entries that fit in maxSizeBytes on their own, split so
+// none of the batch messages exceeds maxSizeBytes, followed by a reference message for each of the others. There's no
+// batch message when none of the entries fit.
+func CreateEntryBatchMessages(batch []*tapApi.BaseEntryDetails, maxSizeBytes int) ([][]byte, error) {
+	if maxSizeBytes <= 0 {
+		batchMessage, err := models.CreateBaseEntryBatchWebSocketMessage(batch)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{batchMessage}, nil
+	}
+
+	// the size of a batch message is the size of the empty one plus the encoded entries separated by commas
+	emptyBatchMessage, err := models.CreateBaseEntryBatchWebSocketMessage([]*tapApi.BaseEntryDetails{})
+	if err != nil {
+		return nil, err
+	}
+	var batchMessages, referenceMessages [][]byte
+	fitting := make([]*tapApi.BaseEntryDetails, 0, len(batch))
+	fittingSize := len(emptyBatchMessage)
+	addBatchMessage := func() error {
+		batchMessage, err := models.CreateBaseEntryBatchWebSocketMessage(fitting)
+		if err != nil {
+			return err
+		}
+		batchMessages = append(batchMessages, batchMessage)
+		fitting, fittingSize = make([]*tapApi.BaseEntryDetails, 0, len(batch)), len(emptyBatchMessage)
+		return nil
+	}
+
+	for _, baseEntry := range batch {
+		encodedEntry, err := json.Marshal(baseEntry)
+		if err != nil {
+			return nil, err
+		}
+		if len(emptyBatchMessage)+len(encodedEntry) > maxSizeBytes {
+			message, err := models.CreateBaseEntryWebSocketMessage(baseEntry)
+			if err != nil {
+				return nil, err
+			}
+			referenceMessage, err := models.CreateEntryReferenceWebSocketMessage(newEntryReference(baseEntry, len(message)))
+			if err != nil {
+				return nil, err
+			}
+			referenceMessages = append(referenceMessages, referenceMessage)
+			continue
+		}
+
+		if len(fitting) > 0 && fittingSize+1+len(encodedEntry) > maxSizeBytes {
+			if err := addBatchMessage(); err != nil {
+				return nil, err
+			}
+		}
+		if len(fitting) > 0 {
+			fittingSize++
+		}
+		fitting = append(fitting, baseEntry)
+		fittingSize += len(encodedEntry)
+	}
+
+	if len(fitting) > 0 {
+		if err := addBatchMessage(); err != nil {
+			return nil, err
+		}
+	}
+	return append(batchMessages, referenceMessages...), nil
+}
+
+func newEntryReference(baseEntry *tapApi.BaseEntryDetails, sizeBytes int) *models.EntryReference {
+	reference := &models.EntryReference{
+		Id:         baseEntry.Id,
+		Protocol:   baseEntry.Protocol,
+		Method:     baseEntry.Method,
+		StatusCode: baseEntry.StatusCode,
+		Timestamp:  baseEntry.Timestamp,
+		SizeBytes:  sizeBytes,
+	}
+	reference.Preview, reference.PreviewTruncated = utils.TruncateUTF8([]byte(baseEntry.Summary), entryReferencePreviewBytes)
+	return reference
+}
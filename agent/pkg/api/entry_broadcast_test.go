@@ -0,0 +1,151 @@
+package api_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/models"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newBroadcastEntry(id string, summaryLength int) *tapApi.BaseEntryDetails {
+	return &tapApi.BaseEntryDetails{
+		Id:         id,
+		Protocol:   tapApi.Protocol{Name: "http"},
+		Method:     "GET",
+		StatusCode: 200,
+		Timestamp:  1600000000000,
+		Summary:    strings.Repeat("a", summaryLength),
+	}
+}
+
+func getMessageType(t *testing.T, message []byte) shared.WebSocketMessageType {
+	var metadata shared.WebSocketMessageMetadata
+	if err := json.Unmarshal(message, &metadata); err != nil {
+		t.Fatalf("failed to unmarshal message: %v", err)
+	}
+	return metadata.MessageType
+}
+
+func TestCreateEntryMessage(t *testing.T) {
+	tests := []struct {
+		name                string
+		summaryLength       int
+		maxSizeBytes        int
+		expectedMessageType shared.WebSocketMessageType
+	}{
+		{name: "normal entry", summaryLength: 100, maxSizeBytes: 1000, expectedMessageType: shared.WebSocketMessageTypeEntry},
+		{name: "oversized entry", summaryLength: 5000, maxSizeBytes: 1000, expectedMessageType: shared.WebSocketMessageTypeEntryReference},
+		{name: "no limit", summaryLength: 5000, maxSizeBytes: 0, expectedMessageType: shared.WebSocketMessageTypeEntry},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := api.CreateEntryMessage(newBroadcastEntry("a", test.summaryLength), test.maxSizeBytes)
+			if err != nil {
+				t.Fatalf("failed to create entry message: %v", err)
+			}
+			if messageType := getMessageType(t, message); messageType != test.expectedMessageType {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedMessageType, messageType)
+			}
+			if test.maxSizeBytes > 0 && len(message) > test.maxSizeBytes {
+				t.Errorf("unexpected result - expected at most: %v, actual: %v", test.maxSizeBytes, len(message))
+			}
+		})
+	}
+}
+
+func TestCreateEntryMessageReference(t *testing.T) {
+	baseEntry := newBroadcastEntry("large", 5000)
+	fullMessage, _ := models.CreateBaseEntryWebSocketMessage(baseEntry)
+	message, err := api.CreateEntryMessage(baseEntry, 1000)
+	if err != nil {
+		t.Fatalf("failed to create entry message: %v", err)
+	}
+
+	var referenceMessage models.WebSocketEntryReferenceMessage
+	if err := json.Unmarshal(message, &referenceMessage); err != nil {
+		t.Fatalf("failed to unmarshal message: %v", err)
+	}
+	reference := referenceMessage.Data
+	if reference.Id != "large" || reference.Method != "GET" || reference.StatusCode != 200 || reference.Protocol.Name != "http" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", baseEntry.Id, reference)
+	}
+	if reference.SizeBytes != len(fullMessage) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", len(fullMessage), reference.SizeBytes)
+	}
+	if !reference.PreviewTruncated || !strings.HasPrefix(baseEntry.Summary, reference.Preview) || len(reference.Preview) == 0 {
+		t.Errorf("unexpected result - expected a truncated preview, actual: %v %v", reference.PreviewTruncated, len(reference.Preview))
+	}
+}
+
+func TestCreateEntryBatchMessages(t *testing.T) {
+	batch := []*tapApi.BaseEntryDetails{newBroadcastEntry("a", 10), newBroadcastEntry("large", 5000), newBroadcastEntry("b", 10)}
+	messages, err := api.CreateEntryBatchMessages(batch, 1000)
+	if err != nil {
+		t.Fatalf("failed to create entry batch messages: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(messages))
+	}
+
+	var batchMessage models.WebSocketEntryBatchMessage
+	if err := json.Unmarshal(messages[0], &batchMessage); err != nil {
+		t.Fatalf("failed to unmarshal message: %v", err)
+	}
+	if batchMessage.MessageType != shared.WebSocketMessageTypeEntryBatch || len(batchMessage.Data) != 2 || batchMessage.Data[0].Id != "a" || batchMessage.Data[1].Id != "b" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "entries a and b", batchMessage.Data)
+	}
+	if messageType := getMessageType(t, messages[1]); messageType != shared.WebSocketMessageTypeEntryReference {
+		t.Errorf("unexpected result - expected: %v, actual: %v", shared.WebSocketMessageTypeEntryReference, messageType)
+	}
+
+	// a batch of oversized entries only has references
+	messages, _ = api.CreateEntryBatchMessages(batch[1:2], 1000)
+	if len(messages) != 1 || getMessageType(t, messages[0]) != shared.WebSocketMessageTypeEntryReference {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, len(messages))
+	}
+}
+
+func TestCreateEntryBatchMessagesSplitBySize(t *testing.T) {
+	batch := make([]*tapApi.BaseEntryDetails, 0)
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"} {
+		batch = append(batch, newBroadcastEntry(id, 100))
+	}
+	const maxSizeBytes = 1000
+	if wholeBatchMessage, _ := models.CreateBaseEntryBatchWebSocketMessage(batch); len(wholeBatchMessage) <= maxSizeBytes {
+		t.Fatalf("unexpected result - expected more than: %v, actual: %v", maxSizeBytes, len(wholeBatchMessage))
+	}
+
+	messages, err := api.CreateEntryBatchMessages(batch, maxSizeBytes)
+	if err != nil {
+		t.Fatalf("failed to create entry batch messages: %v", err)
+	}
+	if len(messages) < 2 {
+		t.Fatalf("unexpected result - expected at least: %v, actual: %v", 2, len(messages))
+	}
+
+	ids := make([]string, 0)
+	for _, message := range messages {
+		if len(message) > maxSizeBytes {
+			t.Errorf("unexpected result - expected at most: %v, actual: %v", maxSizeBytes, len(message))
+		}
+		var batchMessage models.WebSocketEntryBatchMessage
+		if err := json.Unmarshal(message, &batchMessage); err != nil {
+			t.Fatalf("failed to unmarshal message: %v", err)
+		}
+		if batchMessage.MessageType != shared.WebSocketMessageTypeEntryBatch {
+			t.Errorf("unexpected result - expected: %v, actual: %v", shared.WebSocketMessageTypeEntryBatch, batchMessage.MessageType)
+		}
+		for _, baseEntry := range batchMessage.Data {
+			ids = append(ids, baseEntry.Id)
+		}
+	}
+	if expected := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, ids)
+	}
+}
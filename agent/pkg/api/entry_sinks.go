@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"mizuserver/pkg/providers"
+	"os"
+
+	"github.com/gorilla/websocket"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// EntrySink is a destination of the entries a tapper captured, a sink retries or drops the entries it can't deliver on
+// its own. A sink is written by a single goroutine and isn't written once it's closed.
+type EntrySink interface {
+	Write(item *tapApi.OutputChannelItem) error
+	// Close returns once the written entries were delivered or given up on
+	Close() error
+}
+
+// WebSocketSink sends the entries to the api server, the sender reconnects and keeps the entries while the connection
+// is down
+type WebSocketSink struct {
+	items chan *tapApi.OutputChannelItem
+	done  chan struct{}
+}
+
+func NewWebSocketSink(sender *TappedEntrySender, connection *websocket.Conn) *WebSocketSink {
+	sink := &WebSocketSink{items: make(chan *tapApi.OutputChannelItem), done: make(chan struct{})}
+	providers.SetSubsystemReady(providers.SocketPipeSubsystem, true)
+	go func() {
+		defer close(sink.done)
+		defer providers.SetSubsystemReady(providers.SocketPipeSubsystem, false)
+		sender.Run(connection, sink.items)
+	}()
+	return sink
+}
+
+func (sink *WebSocketSink) Write(item *tapApi.OutputChannelItem) error {
+	sink.items <- item
+	return nil
+}
+
+func (sink *WebSocketSink) Close() error {
+	close(sink.items)
+	<-sink.done
+	return nil
+}
+
+// JsonLinesSink writes every entry as a line of json
+type JsonLinesSink struct {
+	writer io.Writer
+	closer io.Closer // nil when the writer isn't owned by the sink
+}
+
+func NewStdoutSink() *JsonLinesSink {
+	return &JsonLinesSink{writer: os.Stdout}
+}
+
+// NewFileSink appends the entries to the file, it's created if it doesn't exist
+func NewFileSink(filePath string) (*JsonLinesSink, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonLinesSink{writer: file, closer: file}, nil
+}
+
+func (sink *JsonLinesSink) Write(item *tapApi.OutputChannelItem) error {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = sink.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (sink *JsonLinesSink) Close() error {
+	if sink.closer == nil {
+		return nil
+	}
+	return sink.closer.Close()
+}
@@ -0,0 +1,127 @@
+package api_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/models"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func readJsonLines(t *testing.T, data string) []tapApi.OutputChannelItem {
+	var items []tapApi.OutputChannelItem
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		var item tapApi.OutputChannelItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			t.Fatalf("failed to unmarshal line %s: %v", scanner.Text(), err)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestFileSinkAppendsJsonLines(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "entries.jsonl")
+
+	// every sink appends to the entries of the previous ones
+	for _, timestamps := range [][]int64{{1, 2}, {3}} {
+		sink, err := api.NewFileSink(filePath)
+		if err != nil {
+			t.Fatalf("failed to create file sink: %v", err)
+		}
+		for _, timestamp := range timestamps {
+			if err := sink.Write(&tapApi.OutputChannelItem{Timestamp: timestamp, Protocol: tapApi.Protocol{Name: "http"}}); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", filePath, err)
+	}
+	items := readJsonLines(t, string(data))
+	if len(items) != 3 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 3, len(items))
+	}
+	for i, item := range items {
+		if item.Timestamp != int64(i+1) || item.Protocol.Name != "http" {
+			t.Errorf("unexpected result - expected: %v, actual: %+v", i+1, item)
+		}
+	}
+}
+
+func TestFileSinkInvalidPath(t *testing.T) {
+	if _, err := api.NewFileSink(path.Join(t.TempDir(), "missing", "entries.jsonl")); err == nil {
+		t.Errorf("unexpected result - expected: an error, actual: %v", nil)
+	}
+}
+
+func TestStdoutSinkWritesJsonLines(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	previousStdout := os.Stdout
+	os.Stdout = writer
+	sink := api.NewStdoutSink()
+	os.Stdout = previousStdout
+
+	for timestamp := int64(1); timestamp <= 2; timestamp++ {
+		if err := sink.Write(&tapApi.OutputChannelItem{Timestamp: timestamp}); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	// stdout outlives the sink
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	writer.Close()
+
+	data, _ := ioutil.ReadAll(reader)
+	items := readJsonLines(t, string(data))
+	if len(items) != 2 || items[0].Timestamp != 1 || items[1].Timestamp != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %s", "entries 1 and 2", data)
+	}
+}
+
+func TestWebSocketSink(t *testing.T) {
+	address, connections := startFakeApiServer(t)
+	dialer := &websocket.Dialer{Subprotocols: models.GetSubprotocols(models.MessageEncodingJson)}
+	connection, _, err := dialer.Dial(address, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	sink := api.NewWebSocketSink(api.NewTappedEntrySender(nil, 0), connection)
+	serverConnection := acceptConnection(t, connections)
+	if err := sink.Write(&tapApi.OutputChannelItem{Timestamp: 7}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if entry := readTappedEntry(t, serverConnection); entry.Data.Timestamp != 7 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 7, entry.Data.Timestamp)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		sink.Close()
+		close(closed)
+	}()
+	serverConnection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := serverConnection.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", websocket.CloseNormalClosure, err)
+	}
+	<-closed
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const harFileLabel = "harFile"
+
+type harFile struct {
+	path    string
+	modTime int64
+}
+
+// FindHarFiles returns the HAR files under rootDir and its subdirectories, the least recently modified first. The
+// symlinked directories are followed once each, a link back to a walked directory can't make the walk loop.
+func FindHarFiles(rootDir string) ([]string, error) {
+	realRootDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var harFiles []harFile
+	walkedDirs := map[string]bool{realRootDir: true}
+	if err := walkHarFiles(rootDir, walkedDirs, &harFiles); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(harFiles, func(i, j int) bool { return harFiles[i].modTime < harFiles[j].modTime })
+	filePaths := make([]string, 0, len(harFiles))
+	for _, file := range harFiles {
+		filePaths = append(filePaths, file.path)
+	}
+	return filePaths, nil
+}
+
+func walkHarFiles(dir string, walkedDirs map[string]bool, harFiles *[]harFile) error {
+	return filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// the files removed or renamed while walking are picked up by the next walk, if at all
+			if filePath != dir {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if filePath == dir {
+				return nil
+			}
+			if !markWalked(filePath, walkedDirs) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil
+		}
+		if entry.Type()&fs.ModeSymlink != 0 && info.IsDir() {
+			if !markWalked(filePath, walkedDirs) {
+				return nil
+			}
+			if err := walkHarFiles(filePath, walkedDirs, harFiles); err != nil {
+				logger.Log.Debugf("Failed walking %s: %v", filePath, err)
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && IsHarFileName(entry.Name()) {
+			*harFiles = append(*harFiles, harFile{path: filePath, modTime: info.ModTime().UnixNano()})
+		}
+		return nil
+	})
+}
+
+// markWalked records a directory by its path with the symlinks resolved, it returns false for a directory that was
+// already walked through another path
+func markWalked(dir string, walkedDirs map[string]bool) bool {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	if walkedDirs[realDir] {
+		logger.Log.Debugf("Skipping %s, it was already walked", dir)
+		return false
+	}
+	walkedDirs[realDir] = true
+	return true
+}
+
+// getHarFileLabels labels the items of a HAR file with its path relative to rootDir, e.g. billing/2021-06-01.har
+func getHarFileLabels(rootDir string, filePath string) tapApi.EntryLabels {
+	if rootDir == "" {
+		return nil
+	}
+	relativePath, err := filepath.Rel(rootDir, filePath)
+	if err != nil {
+		return nil
+	}
+	return tapApi.EntryLabels{harFileLabel: filepath.ToSlash(relativePath)}
+}
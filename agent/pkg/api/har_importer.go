@@ -0,0 +1,364 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	defaultHarImportMaxConcurrentFiles = 4
+	defaultHarImportPrefetchEntries    = 100
+	failedHarFileSuffix                = ".failed"
+	gzippedHarFileSuffix               = ".har.gz"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type HarImportProgress struct {
+	PendingFiles    int `json:"pendingFiles"`
+	OpenFiles       int `json:"openFiles"`
+	PeakOpenFiles   int `json:"peakOpenFiles"`
+	ImportedFiles   int `json:"importedFiles"`
+	FailedFiles     int `json:"failedFiles"`
+	ImportedEntries int `json:"importedEntries"`
+}
+
+// HarImporter streams the entries of HAR files as http items, files are decoded one entry at a time so memory
+// depends on the number of concurrently open files and the prefetch size, not on the size of the files.
+type HarImporter struct {
+	maxConcurrentFiles int
+	prefetchEntries    int
+	protocol           tapApi.Protocol
+	progress           HarImportProgress
+	lock               sync.Mutex
+}
+
+func NewHarImporter(config *shared.HarImportConfig, protocol tapApi.Protocol) *HarImporter {
+	importer := &HarImporter{
+		maxConcurrentFiles: defaultHarImportMaxConcurrentFiles,
+		prefetchEntries:    defaultHarImportPrefetchEntries,
+		protocol:           protocol,
+	}
+	if config != nil && config.MaxConcurrentFiles > 0 {
+		importer.maxConcurrentFiles = config.MaxConcurrentFiles
+	}
+	if config != nil && config.PrefetchEntries > 0 {
+		importer.prefetchEntries = config.PrefetchEntries
+	}
+	return importer
+}
+
+type harDirSummary struct {
+	files   int
+	entries int
+}
+
+// Import sends the entries of the files to outputItems and removes every file once it's read, files that fail to
+// decode are renamed with a .failed suffix. The entries are labeled with the path of their file relative to rootDir.
+// The entries of concurrently read files interleave, but the entries of a file are sent in its order. It returns after
+// all the entries were sent.
+func (importer *HarImporter) Import(rootDir string, filePaths []string, outputItems chan<- *tapApi.OutputChannelItem) {
+	prefetched := make(chan *tapApi.OutputChannelItem, importer.prefetchEntries)
+	forwarded := make(chan struct{})
+	go func() {
+		for item := range prefetched {
+			outputItems <- item
+		}
+		close(forwarded)
+	}()
+
+	importer.updateProgress(func(progress *HarImportProgress) { progress.PendingFiles += len(filePaths) })
+
+	dirSummaries := map[string]*harDirSummary{}
+	var summariesLock sync.Mutex
+	openFiles := make(chan struct{}, importer.maxConcurrentFiles)
+	var wg sync.WaitGroup
+	for _, filePath := range filePaths {
+		openFiles <- struct{}{}
+		wg.Add(1)
+		go func(filePath string) {
+			defer wg.Done()
+			defer func() { <-openFiles }()
+			entriesCount, ok := importer.importFile(rootDir, filePath, prefetched)
+			if !ok {
+				return
+			}
+
+			summariesLock.Lock()
+			defer summariesLock.Unlock()
+			dir := getRelativeDir(rootDir, filePath)
+			if dirSummaries[dir] == nil {
+				dirSummaries[dir] = &harDirSummary{}
+			}
+			dirSummaries[dir].files++
+			dirSummaries[dir].entries += entriesCount
+		}(filePath)
+	}
+	wg.Wait()
+
+	close(prefetched)
+	<-forwarded
+
+	for dir, summary := range dirSummaries {
+		logger.Log.Infof("Loaded %d files and %d entries of %s", summary.files, summary.entries, dir)
+	}
+}
+
+func getRelativeDir(rootDir string, filePath string) string {
+	dir := filepath.Dir(filePath)
+	if relativeDir, err := filepath.Rel(rootDir, dir); err == nil && rootDir != "" {
+		return filepath.ToSlash(relativeDir)
+	}
+	return dir
+}
+
+func (importer *HarImporter) GetProgress() HarImportProgress {
+	importer.lock.Lock()
+	defer importer.lock.Unlock()
+	return importer.progress
+}
+
+// importFile returns the number of entries imported and whether the whole file was read
+func (importer *HarImporter) importFile(rootDir string, filePath string, prefetched chan<- *tapApi.OutputChannelItem) (int, bool) {
+	importer.updateProgress(func(progress *HarImportProgress) {
+		progress.PendingFiles--
+		progress.OpenFiles++
+		if progress.OpenFiles > progress.PeakOpenFiles {
+			progress.PeakOpenFiles = progress.OpenFiles
+		}
+	})
+
+	entriesCount, err := importer.readEntries(filePath, getHarFileLabels(rootDir, filePath), prefetched)
+
+	importer.updateProgress(func(progress *HarImportProgress) {
+		progress.OpenFiles--
+		if err != nil {
+			progress.FailedFiles++
+		} else {
+			progress.ImportedFiles++
+		}
+	})
+
+	if err != nil {
+		logger.Log.Errorf("Failed importing %s after %d entries: %v", filePath, entriesCount, err)
+		if renameErr := os.Rename(filePath, filePath+failedHarFileSuffix); renameErr != nil {
+			logger.Log.Errorf("Failed renaming %s: %v", filePath, renameErr)
+		}
+		return entriesCount, false
+	}
+
+	progress := importer.GetProgress()
+	logger.Log.Infof("Imported %d entries of %s, %d files imported, %d pending", entriesCount, filePath, progress.ImportedFiles, progress.PendingFiles)
+	if err := os.Remove(filePath); err != nil {
+		logger.Log.Errorf("Failed removing %s: %v", filePath, err)
+	}
+	return entriesCount, true
+}
+
+func (importer *HarImporter) readEntries(filePath string, labels tapApi.EntryLabels, prefetched chan<- *tapApi.OutputChannelItem) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader, err := newHarReader(file)
+	if err != nil {
+		return 0, err
+	}
+	decoder := json.NewDecoder(reader)
+	if err := seekHarEntries(decoder); err != nil {
+		return 0, err
+	}
+
+	entriesCount := 0
+	for decoder.More() {
+		var entry har.Entry
+		if err := decoder.Decode(&entry); err != nil {
+			return entriesCount, err
+		}
+		item, err := importer.newOutputItem(&entry)
+		if err != nil {
+			logger.Log.Debugf("Skipping HAR entry of %s: %v", filePath, err)
+			continue
+		}
+		item.SourceLabels = labels
+
+		prefetched <- item
+		entriesCount++
+		importer.updateProgress(func(progress *HarImportProgress) { progress.ImportedEntries++ })
+	}
+	return entriesCount, nil
+}
+
+// IsHarFileName returns whether a file is a HAR to import, plain or gzipped
+func IsHarFileName(name string) bool {
+	return strings.HasSuffix(name, ".har") || strings.HasSuffix(name, gzippedHarFileSuffix)
+}
+
+// newHarReader decompresses the files starting with the gzip magic bytes as they're read, whatever their name is
+func newHarReader(file io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return reader, nil
+	}
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(gzipReader), nil
+}
+
+// seekHarEntries advances the decoder to the first element of log.entries, skipping the other fields of the HAR
+func seekHarEntries(decoder *json.Decoder) error {
+	for _, key := range []string{"log", "entries"} {
+		if err := seekObjectKey(decoder, key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '[')
+}
+
+func seekObjectKey(decoder *json.Decoder, key string) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("no %s in HAR", key)
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid HAR, expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// newOutputItem builds the item the http extension would have emitted for the entry, after it went through the socket
+func (importer *HarImporter) newOutputItem(entry *har.Entry) (*tapApi.OutputChannelItem, error) {
+	if entry.Request == nil || entry.Response == nil {
+		return nil, fmt.Errorf("entry without a request or a response")
+	}
+	requestUrl, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	requestDetails, err := toDetailsMap(entry.Request)
+	if err != nil {
+		return nil, err
+	}
+	setMissingLists(requestDetails, "headers", "queryString")
+	// captured requests hold the request uri, the host is in the headers
+	requestDetails["url"] = requestUrl.RequestURI()
+	if getHeaderValue(entry.Request.Headers, "Host") == "" {
+		headers, _ := requestDetails["headers"].([]interface{})
+		requestDetails["headers"] = append(headers, map[string]interface{}{"name": "Host", "value": requestUrl.Host})
+	}
+
+	responseDetails, err := toDetailsMap(entry.Response)
+	if err != nil {
+		return nil, err
+	}
+	setMissingLists(responseDetails, "headers")
+	if content, ok := responseDetails["content"].(map[string]interface{}); ok && content["encoding"] == nil {
+		// the text of the content is always base64 encoded by the har package
+		content["encoding"] = "base64"
+	}
+
+	serverPort := requestUrl.Port()
+	if serverPort == "" {
+		serverPort = "80"
+		if requestUrl.Scheme == "https" {
+			serverPort = "443"
+		}
+	}
+	serverIP := requestUrl.Hostname()
+	if ip := net.ParseIP(serverIP); ip == nil {
+		serverIP = ""
+	}
+
+	return &tapApi.OutputChannelItem{
+		Protocol:  importer.protocol,
+		Timestamp: entry.StartedDateTime.UnixNano() / int64(1000000),
+		ConnectionInfo: &tapApi.ConnectionInfo{
+			ServerIP:   serverIP,
+			ServerPort: serverPort,
+		},
+		Pair: &tapApi.RequestResponsePair{
+			Request: tapApi.GenericMessage{
+				IsRequest:   true,
+				CaptureTime: entry.StartedDateTime,
+				Payload:     map[string]interface{}{"details": requestDetails},
+			},
+			Response: tapApi.GenericMessage{
+				IsRequest:   false,
+				CaptureTime: entry.StartedDateTime.Add(time.Duration(entry.Time) * time.Millisecond),
+				Payload:     map[string]interface{}{"details": responseDetails},
+			},
+		},
+	}, nil
+}
+
+func toDetailsMap(value interface{}) (map[string]interface{}, error) {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(valueBytes, &details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// setMissingLists replaces the lists omitted from the HAR, the entries pipeline expects them to be present
+func setMissingLists(details map[string]interface{}, keys ...string) {
+	for _, key := range keys {
+		if _, ok := details[key].([]interface{}); !ok {
+			details[key] = []interface{}{}
+		}
+	}
+}
+
+func (importer *HarImporter) updateProgress(update func(progress *HarImportProgress)) {
+	importer.lock.Lock()
+	defer importer.lock.Unlock()
+	update(&importer.progress)
+}
@@ -0,0 +1,376 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/api"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func writeHarFile(t *testing.T, dir string, name string, entriesCount int) string {
+	filePath := path.Join(dir, name)
+	if err := ioutil.WriteFile(filePath, marshalHar(t, name, entriesCount), 0644); err != nil {
+		t.Fatalf("failed writing har: %v", err)
+	}
+	return filePath
+}
+
+func writeGzippedHarFile(t *testing.T, dir string, name string, entriesCount int) string {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	if _, err := gzipWriter.Write(marshalHar(t, name, entriesCount)); err != nil {
+		t.Fatalf("failed compressing har: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed compressing har: %v", err)
+	}
+	filePath := path.Join(dir, name)
+	if err := ioutil.WriteFile(filePath, gzipped.Bytes(), 0644); err != nil {
+		t.Fatalf("failed writing har: %v", err)
+	}
+	return filePath
+}
+
+func marshalHar(t *testing.T, name string, entriesCount int) []byte {
+	entries := make([]*har.Entry, 0, entriesCount)
+	for i := 0; i < entriesCount; i++ {
+		entries = append(entries, &har.Entry{
+			StartedDateTime: time.Unix(1600000000, 0),
+			Time:            12,
+			Request: &har.Request{
+				Method:      "GET",
+				URL:         fmt.Sprintf("http://10.0.0.1:8080/items/%d?name=%s", i, name),
+				HTTPVersion: "HTTP/1.1",
+			},
+			Response: &har.Response{
+				Status:      200,
+				StatusText:  "OK",
+				HTTPVersion: "HTTP/1.1",
+				Content:     &har.Content{MimeType: "application/json", Text: []byte(`{"id": 1}`)},
+			},
+		})
+	}
+
+	harBytes, err := json.Marshal(&har.HAR{Log: &har.Log{Version: "1.2", Creator: &har.Creator{Name: "test"}, Entries: entries}})
+	if err != nil {
+		t.Fatalf("failed marshaling har: %v", err)
+	}
+	return harBytes
+}
+
+func TestHarImporterBoundedImport(t *testing.T) {
+	const filesCount, entriesPerFile, maxConcurrentFiles, prefetchEntries = 40, 25, 3, 5
+
+	dir := t.TempDir()
+	filePaths := make([]string, 0, filesCount)
+	for i := 0; i < filesCount; i++ {
+		filePaths = append(filePaths, writeHarFile(t, dir, fmt.Sprintf("%d.har", i), entriesPerFile))
+	}
+
+	importer := api.NewHarImporter(&shared.HarImportConfig{MaxConcurrentFiles: maxConcurrentFiles, PrefetchEntries: prefetchEntries}, tapApi.Protocol{Name: "http"})
+	outputItems := make(chan *tapApi.OutputChannelItem)
+	go func() {
+		importer.Import(dir, filePaths, outputItems)
+		close(outputItems)
+	}()
+
+	receivedCount := 0
+	for item := range outputItems {
+		receivedCount++
+		// the entries decoded ahead of the consumer are the prefetched ones and the one being forwarded
+		if ahead := importer.GetProgress().ImportedEntries - receivedCount; ahead > prefetchEntries+1 {
+			t.Fatalf("unexpected result - expected at most: %v, actual: %v", prefetchEntries+1, ahead)
+		}
+		if item.Protocol.Name != "http" || item.ConnectionInfo.ServerIP != "10.0.0.1" || item.ConnectionInfo.ServerPort != "8080" {
+			t.Fatalf("unexpected result - expected: %v, actual: %v %v", "http 10.0.0.1:8080", item.Protocol.Name, item.ConnectionInfo)
+		}
+		if receivedCount%50 == 0 {
+			// a slow consumer must not make the importer read ahead
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	expectedProgress := api.HarImportProgress{ImportedFiles: filesCount, ImportedEntries: filesCount * entriesPerFile}
+	progress := importer.GetProgress()
+	if receivedCount != filesCount*entriesPerFile {
+		t.Errorf("unexpected result - expected: %v, actual: %v", filesCount*entriesPerFile, receivedCount)
+	}
+	if progress.PeakOpenFiles > maxConcurrentFiles || progress.PeakOpenFiles == 0 {
+		t.Errorf("unexpected result - expected at most: %v, actual: %v", maxConcurrentFiles, progress.PeakOpenFiles)
+	}
+	progress.PeakOpenFiles = 0
+	if progress != expectedProgress {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedProgress, progress)
+	}
+	if remainingFiles, _ := ioutil.ReadDir(dir); len(remainingFiles) != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, len(remainingFiles))
+	}
+}
+
+func TestHarImporterEntryDetails(t *testing.T) {
+	dir := t.TempDir()
+	filePath := writeHarFile(t, dir, "single.har", 1)
+
+	importer := api.NewHarImporter(nil, tapApi.Protocol{Name: "http"})
+	outputItems := make(chan *tapApi.OutputChannelItem, 1)
+	importer.Import(dir, []string{filePath}, outputItems)
+	item := <-outputItems
+
+	requestDetails := item.Pair.Request.Payload.(map[string]interface{})["details"].(map[string]interface{})
+	if requestDetails["url"] != "/items/0?name=single.har" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "/items/0?name=single.har", requestDetails["url"])
+	}
+	expectedHost := map[string]interface{}{"name": "Host", "value": "10.0.0.1:8080"}
+	if headers := requestDetails["headers"].([]interface{}); len(headers) != 1 || fmt.Sprint(headers[0]) != fmt.Sprint(expectedHost) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedHost, headers)
+	}
+	content := item.Pair.Response.Payload.(map[string]interface{})["details"].(map[string]interface{})["content"].(map[string]interface{})
+	if content["encoding"] != "base64" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "base64", content["encoding"])
+	}
+	if elapsed := item.Pair.Response.CaptureTime.Sub(item.Pair.Request.CaptureTime); elapsed != 12*time.Millisecond {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 12*time.Millisecond, elapsed)
+	}
+}
+
+func TestHarImporterInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	validPath := writeHarFile(t, dir, "valid.har", 2)
+	invalidPath := path.Join(dir, "invalid.har")
+	if err := ioutil.WriteFile(invalidPath, []byte(`{"log": {"entries": [{"startedDateTime": 3`), 0644); err != nil {
+		t.Fatalf("failed writing har: %v", err)
+	}
+
+	importer := api.NewHarImporter(nil, tapApi.Protocol{Name: "http"})
+	outputItems := make(chan *tapApi.OutputChannelItem, 10)
+	importer.Import(dir, []string{invalidPath, validPath}, outputItems)
+
+	expectedProgress := api.HarImportProgress{PeakOpenFiles: importer.GetProgress().PeakOpenFiles, ImportedFiles: 1, FailedFiles: 1, ImportedEntries: 2}
+	if progress := importer.GetProgress(); progress != expectedProgress || len(outputItems) != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", expectedProgress, progress, len(outputItems))
+	}
+	if _, err := os.Stat(invalidPath + ".failed"); err != nil {
+		t.Errorf("expected the invalid file to be renamed: %v", err)
+	}
+}
+
+func TestHarImporterGzippedFiles(t *testing.T) {
+	const entriesCount = 30
+
+	dir := t.TempDir()
+	filePaths := map[string]string{
+		"plain":                  writeHarFile(t, dir, "plain.har", entriesCount),
+		"gzipped":                writeGzippedHarFile(t, dir, "gzipped.har.gz", entriesCount),
+		"gzipped without suffix": writeGzippedHarFile(t, dir, "gzipped.har", entriesCount),
+	}
+
+	for name, filePath := range filePaths {
+		t.Run(name, func(t *testing.T) {
+			importer := api.NewHarImporter(nil, tapApi.Protocol{Name: "http"})
+			outputItems := make(chan *tapApi.OutputChannelItem, entriesCount)
+			importer.Import(dir, []string{filePath}, outputItems)
+
+			expectedProgress := api.HarImportProgress{PeakOpenFiles: 1, ImportedFiles: 1, ImportedEntries: entriesCount}
+			if progress := importer.GetProgress(); progress != expectedProgress || len(outputItems) != entriesCount {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", expectedProgress, progress, len(outputItems))
+			}
+		})
+	}
+}
+
+func TestIsHarFileName(t *testing.T) {
+	expected := map[string]bool{"a.har": true, "a.har.gz": true, "a.har.failed": false, "a.gz": false, "a.json": false}
+	for name, isHar := range expected {
+		if actual := api.IsHarFileName(name); actual != isHar {
+			t.Errorf("unexpected result - expected: %v, actual: %v for %v", isHar, actual, name)
+		}
+	}
+}
+
+func TestFindHarFilesRecursively(t *testing.T) {
+	dir := t.TempDir()
+	for _, subDir := range []string{"billing", "orders/eu"} {
+		if err := os.MkdirAll(path.Join(dir, subDir), 0755); err != nil {
+			t.Fatalf("failed creating dir: %v", err)
+		}
+	}
+	expected := map[string]bool{
+		writeHarFile(t, dir, "root.har", 1):                  true,
+		writeHarFile(t, dir, "billing/a.har", 1):             true,
+		writeGzippedHarFile(t, dir, "orders/eu/b.har.gz", 1): true,
+		writeHarFile(t, dir, "orders/eu/notes.txt", 1):       false,
+		writeHarFile(t, dir, "orders/eu/c.har.failed", 1):    false,
+	}
+	// a link back to the root must not make the walk loop or find the files twice
+	if err := os.Symlink(dir, path.Join(dir, "orders/eu/loop")); err != nil {
+		t.Fatalf("failed creating symlink: %v", err)
+	}
+
+	filePaths, err := api.FindHarFiles(dir)
+	if err != nil {
+		t.Fatalf("failed finding files: %v", err)
+	}
+	found := map[string]bool{}
+	for _, filePath := range filePaths {
+		if !expected[filePath] || found[filePath] {
+			t.Errorf("unexpected result - expected: %v, actual: %v", "a HAR file found once", filePath)
+		}
+		found[filePath] = true
+	}
+	if len(found) != 3 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 3, filePaths)
+	}
+}
+
+func TestHarImporterLabelsRelativePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(path.Join(dir, "billing"), 0755); err != nil {
+		t.Fatalf("failed creating dir: %v", err)
+	}
+	filePath := writeHarFile(t, dir, "billing/a.har", 2)
+
+	importer := api.NewHarImporter(nil, tapApi.Protocol{Name: "http"})
+	outputItems := make(chan *tapApi.OutputChannelItem, 2)
+	importer.Import(dir, []string{filePath}, outputItems)
+	close(outputItems)
+
+	received := 0
+	for item := range outputItems {
+		received++
+		if item.SourceLabels["harFile"] != "billing/a.har" {
+			t.Errorf("unexpected result - expected: %v, actual: %v", "billing/a.har", item.SourceLabels)
+		}
+	}
+	if received != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, received)
+	}
+}
+
+func TestHarImporterKeepsFileOrder(t *testing.T) {
+	const filesCount, entriesPerFile = 6, 50
+
+	dir := t.TempDir()
+	filePaths := make([]string, 0, filesCount)
+	for i := 0; i < filesCount; i++ {
+		filePaths = append(filePaths, writeHarFile(t, dir, fmt.Sprintf("%d.har", i), entriesPerFile))
+	}
+
+	importer := api.NewHarImporter(&shared.HarImportConfig{MaxConcurrentFiles: filesCount, PrefetchEntries: 1}, tapApi.Protocol{Name: "http"})
+	outputItems := make(chan *tapApi.OutputChannelItem)
+	go func() {
+		importer.Import(dir, filePaths, outputItems)
+		close(outputItems)
+	}()
+
+	// the files are read concurrently so their entries interleave, but the entries of a file keep its order
+	nextIndexes := map[string]int{}
+	for item := range outputItems {
+		fileName := item.SourceLabels["harFile"]
+		requestUrl := item.Pair.Request.Payload.(map[string]interface{})["details"].(map[string]interface{})["url"]
+		if expectedUrl := fmt.Sprintf("/items/%d?name=%s", nextIndexes[fileName], fileName); requestUrl != expectedUrl {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", expectedUrl, requestUrl)
+		}
+		nextIndexes[fileName]++
+	}
+	for _, filePath := range filePaths {
+		if received := nextIndexes[path.Base(filePath)]; received != entriesPerFile {
+			t.Errorf("unexpected result - expected: %v, actual: %v", entriesPerFile, received)
+		}
+	}
+}
+
+// writeLargeHarFile writes the entries one at a time, so the benchmark itself never holds the whole HAR in memory
+func writeLargeHarFile(b *testing.B, filePath string, entriesCount int, bodyBytes int) int64 {
+	file, err := os.Create(filePath)
+	if err != nil {
+		b.Fatalf("failed creating har: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString(`{"log": {"version": "1.2", "creator": {"name": "benchmark"}, "entries": [`)
+	body := bytes.Repeat([]byte("x"), bodyBytes)
+	for i := 0; i < entriesCount; i++ {
+		entry, err := json.Marshal(&har.Entry{
+			StartedDateTime: time.Unix(1600000000, 0),
+			Request:         &har.Request{Method: "POST", URL: fmt.Sprintf("http://10.0.0.1:8080/items/%d", i), HTTPVersion: "HTTP/1.1"},
+			Response:        &har.Response{Status: 200, HTTPVersion: "HTTP/1.1", Content: &har.Content{MimeType: "text/plain", Text: body}},
+		})
+		if err != nil {
+			b.Fatalf("failed marshaling entry: %v", err)
+		}
+		if i > 0 {
+			writer.WriteString(",")
+		}
+		writer.Write(entry)
+	}
+	writer.WriteString("]}}")
+	if err := writer.Flush(); err != nil {
+		b.Fatalf("failed writing har: %v", err)
+	}
+	info, _ := file.Stat()
+	return info.Size()
+}
+
+// BenchmarkHarImporterLargeFile imports a HAR much larger than the heap it's allowed to grow by, which only holds when
+// the entries are decoded one at a time
+func BenchmarkHarImporterLargeFile(b *testing.B) {
+	const entriesCount, bodyBytes, maxHeapGrowthBytes = 20000, 4096, 48 * 1000 * 1000
+
+	dir := b.TempDir()
+	filePath := path.Join(dir, "large.har")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		// the importer removes the files it read
+		fileSize := writeLargeHarFile(b, filePath, entriesCount, bodyBytes)
+		runtime.GC()
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		baseHeap := memStats.HeapAlloc
+		b.StartTimer()
+
+		importer := api.NewHarImporter(nil, tapApi.Protocol{Name: "http"})
+		outputItems := make(chan *tapApi.OutputChannelItem)
+		go func() {
+			importer.Import(dir, []string{filePath}, outputItems)
+			close(outputItems)
+		}()
+
+		var peakHeap uint64
+		received := 0
+		for range outputItems {
+			received++
+			if received%500 == 0 {
+				runtime.ReadMemStats(&memStats)
+				if memStats.HeapAlloc > peakHeap {
+					peakHeap = memStats.HeapAlloc
+				}
+			}
+		}
+
+		if received != entriesCount {
+			b.Fatalf("unexpected result - expected: %v, actual: %v", entriesCount, received)
+		}
+		var heapGrowth uint64
+		if peakHeap > baseHeap {
+			heapGrowth = peakHeap - baseHeap
+		}
+		if heapGrowth > maxHeapGrowthBytes {
+			b.Fatalf("unexpected result - expected heap growth at most: %v, actual: %v for a %v bytes HAR", maxHeapGrowthBytes, heapGrowth, fileSize)
+		}
+		b.ReportMetric(float64(heapGrowth), "peak-heap-growth-bytes")
+	}
+}
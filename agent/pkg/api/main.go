@@ -1,16 +1,18 @@
 package api
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/correlation"
 	"mizuserver/pkg/database"
+	"mizuserver/pkg/filtering"
 	"mizuserver/pkg/holder"
 	"mizuserver/pkg/providers"
+	"mizuserver/pkg/sensitiveDataFiltering"
+	"mizuserver/pkg/sinks"
 	"os"
-	"path"
-	"sort"
 	"strings"
 	"time"
 
@@ -26,14 +28,20 @@ import (
 )
 
 var k8sResolver *resolver.Resolver
+var dnsResolver *resolver.DnsResolver // resolves the addresses k8sResolver doesn't, nil unless reverse dns is configured
+var harImporter *HarImporter
 
-func StartResolving(namespace string) {
+// StartResolving resolves the addresses to the k8s objects of the namespaces, of every namespace when none is given
+func StartResolving(namespaces []string) {
+	dnsResolver = resolver.NewDnsResolver(config.Config.ReverseDns, nil)
 	errOut := make(chan error, 100)
-	res, err := resolver.NewFromInCluster(errOut, namespace)
+	res, err := resolver.NewFromInCluster(errOut, namespaces)
 	if err != nil {
 		logger.Log.Infof("error creating k8s resolver %s", err)
 		return
 	}
+	res.SetPodLabelKeys(config.Config.PodLabels)
+	res.SetCacheTtl(time.Duration(config.Config.ResolverCacheTtlMs) * time.Millisecond)
 	ctx := context.Background()
 	res.Start(ctx)
 	go func() {
@@ -49,104 +57,238 @@ func StartResolving(namespace string) {
 	holder.SetResolver(res)
 }
 
-func StartReadingEntries(harChannel <-chan *tapApi.OutputChannelItem, workingDir *string, extensionsMap map[string]*tapApi.Extension) {
+// StartReadingEntries analyzes the entries with the extensions of holder.GetExtensionsMap, each entry is analyzed with
+// the extensions loaded when it's read. It returns once the channel is closed or ctx is done, the entries of a partial
+// broadcast batch are flushed before it returns.
+func StartReadingEntries(ctx context.Context, harChannel <-chan *tapApi.OutputChannelItem, workingDir *string) {
 	if workingDir != nil && *workingDir != "" {
-		startReadingFiles(*workingDir)
+		httpExtension, ok := holder.GetExtensionsMap()["http"]
+		if !ok {
+			logger.Log.Errorf("Cannot read HAR files without the http extension")
+			return
+		}
+		harImporter = NewHarImporter(config.Config.HarImport, *httpExtension.Protocol)
+		importedItems := make(chan *tapApi.OutputChannelItem)
+		go startReadingFiles(ctx, *workingDir, importedItems)
+		startReadingChannel(ctx, importedItems)
 	} else {
-		startReadingChannel(harChannel, extensionsMap)
+		startReadingChannel(ctx, harChannel)
+	}
+}
+
+func GetHarImportProgress() *HarImportProgress {
+	if harImporter == nil {
+		return nil
 	}
+	progress := harImporter.GetProgress()
+	return &progress
 }
 
-func startReadingFiles(workingDir string) {
+func startReadingFiles(ctx context.Context, workingDir string, outputItems chan<- *tapApi.OutputChannelItem) {
 	if err := os.MkdirAll(workingDir, os.ModePerm); err != nil {
 		logger.Log.Errorf("Failed to make dir: %s, err: %v", workingDir, err)
 		return
 	}
 
-	for true {
-		dir, _ := os.Open(workingDir)
-		dirFiles, _ := dir.Readdir(-1)
-
-		var harFiles []os.FileInfo
-		for _, fileInfo := range dirFiles {
-			if strings.HasSuffix(fileInfo.Name(), ".har") {
-				harFiles = append(harFiles, fileInfo)
-			}
+	for ctx.Err() == nil {
+		harFilePaths, err := FindHarFiles(workingDir)
+		if err != nil {
+			logger.Log.Errorf("Failed finding HAR files in %s: %v", workingDir, err)
 		}
-		sort.Sort(utils.ByModTime(harFiles))
 
-		if len(harFiles) == 0 {
+		if len(harFilePaths) == 0 {
 			logger.Log.Infof("Waiting for new files\n")
-			time.Sleep(3 * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
 			continue
 		}
-		fileInfo := harFiles[0]
-		inputFilePath := path.Join(workingDir, fileInfo.Name())
-		file, err := os.Open(inputFilePath)
-		utils.CheckErr(err)
-
-		var inputHar har.HAR
-		decErr := json.NewDecoder(bufio.NewReader(file)).Decode(&inputHar)
-		utils.CheckErr(decErr)
 
-		rmErr := os.Remove(inputFilePath)
-		utils.CheckErr(rmErr)
+		harImporter.Import(workingDir, harFilePaths, outputItems)
 	}
 }
 
-func startReadingChannel(outputItems <-chan *tapApi.OutputChannelItem, extensionsMap map[string]*tapApi.Extension) {
+func startReadingChannel(ctx context.Context, outputItems <-chan *tapApi.OutputChannelItem) {
 	if outputItems == nil {
 		panic("Channel of captured messages is nil")
 	}
 
 	disableOASValidation := false
-	ctx := context.Background()
 	doc, contractContent, router, err := loadOAS(ctx)
 	if err != nil {
 		logger.Log.Infof("Disabled OAS validation: %s\n", err.Error())
 		disableOASValidation = true
 	}
 
-	for item := range outputItems {
-		providers.EntryAdded()
+	syslogSink, err := sinks.NewSyslogSink(config.Config.SyslogSink)
+	if err != nil {
+		logger.Log.Errorf("Disabled syslog forwarding: %v", err)
+	}
+
+	entryBatcher := NewEntryBroadcastBatcher(config.Config.EntryBroadcastBatching)
+
+	entryDeduplicator := correlation.NewEntryDeduplicator(config.Config.EntryDeduplicationWindowMs)
+
+	credentialDetector, err := sensitiveDataFiltering.NewCredentialDetector(config.Config.CredentialDetection)
+	if err != nil {
+		logger.Log.Errorf("Disabled credential detection: %v", err)
+	}
 
-		extension := extensionsMap[item.Protocol.Name]
+	piiDetector, err := sensitiveDataFiltering.NewPiiDetector(config.Config.PiiDetection)
+	if err != nil {
+		logger.Log.Errorf("Disabled PII detection: %v", err)
+	}
+
+	promotedHeaders := GetPromotedHeaders(config.Config.PromotedHeaders)
+
+	responseSampler, err := filtering.NewResponseSampler(config.Config.ResponseSampling)
+	if err != nil {
+		logger.Log.Errorf("Disabled response sampling: %v", err)
+	}
+
+	flowEntryCap, err := filtering.NewFlowEntryCap(config.Config.FlowEntryCap)
+	if err != nil {
+		logger.Log.Errorf("Disabled flow entry cap: %v", err)
+	}
+
+readingLoop:
+	for {
+		var item *tapApi.OutputChannelItem
+		var ok bool
+		select {
+		case <-ctx.Done():
+			logger.Log.Infof("Stopped reading the entries: %v", ctx.Err())
+			break readingLoop
+		case item, ok = <-outputItems:
+			if !ok {
+				break readingLoop
+			}
+		}
+
+		// the extension of the item may have been unloaded by a reload since it was dissected
+		extension, ok := holder.GetExtensionsMap()[item.Protocol.Name]
+		if !ok {
+			logger.Log.Warningf("Dropped a %s entry, its extension isn't loaded", item.Protocol.Name)
+			AckEntry(item)
+			continue
+		}
 		resolvedSource, resolvedDestionation := resolveIP(item.ConnectionInfo)
 		mizuEntry := extension.Dissector.Analyze(item, primitive.NewObjectID().Hex(), resolvedSource, resolvedDestionation)
+		LabelUnresolvedDestination(mizuEntry, config.Config.PortLabels)
+		ExtractQueryParams(mizuEntry, config.Config.QueryParams)
+		mizuEntry.SourceLabels, mizuEntry.DestinationLabels = resolveLabels(item.ConnectionInfo)
+		mizuEntry.SourceLabels = mergeLabels(mizuEntry.SourceLabels, item.SourceLabels)
+		if config.Config.FirstSeenOnly && !filtering.FirstSeen.ShouldKeep(mizuEntry.Method, mizuEntry.Path) {
+			AckEntry(item)
+			continue
+		}
+		// the status and the latency of an entry are only known once it was analyzed
+		if responseSampler != nil && !responseSampler.ShouldKeep(mizuEntry) {
+			AckEntry(item)
+			continue
+		}
+		if flowEntryCap != nil && !flowEntryCap.ShouldKeep(mizuEntry) {
+			AckEntry(item)
+			continue
+		}
+
+		providers.EntryAdded()
 		baseEntry := extension.Dissector.Summarize(mizuEntry)
-		mizuEntry.EstimatedSizeBytes = getEstimatedEntrySizeBytes(mizuEntry)
-		if extension.Protocol.Name == "http" {
+		baseEntry.DestinationLabel = mizuEntry.DestinationLabel
+		baseEntry.SourceLabels, baseEntry.DestinationLabels = mizuEntry.SourceLabels, mizuEntry.DestinationLabels
+		var harEntry *har.Entry
+		// the http extension also emits websocket closes, which aren't http pairs
+		if item.Protocol.Name == "http" {
 			if !disableOASValidation {
 				var httpPair tapApi.HTTPRequestResponsePair
 				json.Unmarshal([]byte(mizuEntry.Entry), &httpPair)
 
-				contract := handleOAS(ctx, doc, router, httpPair.Request.Payload.RawRequest, httpPair.Response.Payload.RawResponse, contractContent)
-				baseEntry.ContractStatus = contract.Status
-				mizuEntry.ContractStatus = contract.Status
-				mizuEntry.ContractRequestReason = contract.RequestReason
-				mizuEntry.ContractResponseReason = contract.ResponseReason
-				mizuEntry.ContractContent = contract.Content
+				// entries imported from HAR files have no raw request and response
+				if httpPair.Request.Payload.RawRequest != nil && httpPair.Response.Payload.RawResponse != nil {
+					contract := handleOAS(ctx, doc, router, httpPair.Request.Payload.RawRequest, httpPair.Response.Payload.RawResponse, contractContent)
+					baseEntry.ContractStatus = contract.Status
+					mizuEntry.ContractStatus = contract.Status
+					mizuEntry.ContractRequestReason = contract.RequestReason
+					mizuEntry.ContractResponseReason = contract.ResponseReason
+					mizuEntry.ContractContent = contract.Content
+				}
 			}
 
 			var pair tapApi.RequestResponsePair
 			json.Unmarshal([]byte(mizuEntry.Entry), &pair)
-			harEntry, err := utils.NewEntry(&pair)
+			harEntry, err = utils.NewEntry(&pair)
 			if err == nil {
 				rules, _, _ := models.RunValidationRulesState(*harEntry, mizuEntry.Service)
 				baseEntry.Rules = rules
+				mizuEntry.RequestSize = harEntry.Request.BodySize
+				mizuEntry.ResponseSize = harEntry.Response.BodySize
+
+				mizuEntry.RedirectChain, mizuEntry.RedirectHop = correlation.RedirectChains.Track(mizuEntry.EntryId, mizuEntry.SourceIp, harEntry.Request.URL, harEntry.Response.Status, getHeaderValue(harEntry.Response.Headers, "Location"), harEntry.StartedDateTime)
+				baseEntry.RedirectChain, baseEntry.RedirectHop = mizuEntry.RedirectChain, mizuEntry.RedirectHop
+
+				mizuEntry.Fields = PromoteHeaders(harEntry.Request.Headers, promotedHeaders)
+				baseEntry.Fields = mizuEntry.Fields
+			}
+		} else {
+			mizuEntry.RequestSize, mizuEntry.ResponseSize = getPayloadSizes(item.Pair)
+		}
+		mizuEntry.EstimatedSizeBytes = getEstimatedEntrySizeBytes(mizuEntry)
+		if credentialDetector != nil {
+			credentialDetector.FlagEntry(mizuEntry, harEntry)
+			baseEntry.CredentialLeak, baseEntry.CredentialDetector = mizuEntry.CredentialLeak, mizuEntry.CredentialDetector
+		}
+		if piiDetector != nil {
+			piiDetector.TagEntry(mizuEntry, harEntry)
+			baseEntry.PiiTypes = mizuEntry.PiiTypes
+		}
+		if config.Config.ResponseBodiesOnError {
+			filtering.OmitSuccessfulResponseBody(mizuEntry)
+		}
+		if entryDeduplicator != nil {
+			if storedEntry, isDuplicate := entryDeduplicator.Deduplicate(mizuEntry, getEntrySource(item)); isDuplicate {
+				database.UpdateEntry(storedEntry)
+				AckEntry(item)
+				continue
+			}
+		}
+		database.CreateEntryNotifying(mizuEntry, func(isWritten bool) {
+			if isWritten {
+				AckEntry(item)
+			} else {
+				forgetEntryAck(item)
 			}
+		})
+		if syslogSink != nil {
+			syslogSink.HandleEntry(mizuEntry)
 		}
-		database.CreateEntry(mizuEntry)
 
-		baseEntryBytes, _ := models.CreateBaseEntryWebSocketMessage(baseEntry)
+		if entryBatcher != nil {
+			entryBatcher.Add(baseEntry)
+			continue
+		}
+		baseEntryBytes, _ := CreateEntryMessage(baseEntry, config.Config.MaxBroadcastEntryBytes)
 		BroadcastToBrowserClients(baseEntryBytes)
 	}
+
+	if entryBatcher != nil {
+		entryBatcher.Stop()
+	}
+}
+
+func getHeaderValue(headers []har.Header, name string) string {
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
 }
 
 func resolveIP(connectionInfo *tapApi.ConnectionInfo) (resolvedSource string, resolvedDestination string) {
-	if k8sResolver != nil {
+	if k8sResolver != nil || dnsResolver != nil {
 		unresolvedSource := connectionInfo.ClientIP
-		resolvedSource = k8sResolver.Resolve(unresolvedSource)
+		resolvedSource = resolveAddress(unresolvedSource, connectionInfo.ClientIP)
 		if resolvedSource == "" {
 			logger.Log.Debugf("Cannot find resolved name to source: %s\n", unresolvedSource)
 			if os.Getenv("SKIP_NOT_RESOLVED_SOURCE") == "1" {
@@ -154,7 +296,7 @@ func resolveIP(connectionInfo *tapApi.ConnectionInfo) (resolvedSource string, re
 			}
 		}
 		unresolvedDestination := fmt.Sprintf("%s:%s", connectionInfo.ServerIP, connectionInfo.ServerPort)
-		resolvedDestination = k8sResolver.Resolve(unresolvedDestination)
+		resolvedDestination = resolveAddress(unresolvedDestination, connectionInfo.ServerIP)
 		if resolvedDestination == "" {
 			logger.Log.Debugf("Cannot find resolved name to dest: %s\n", unresolvedDestination)
 			if os.Getenv("SKIP_NOT_RESOLVED_DEST") == "1" {
@@ -165,6 +307,58 @@ func resolveIP(connectionInfo *tapApi.ConnectionInfo) (resolvedSource string, re
 	return resolvedSource, resolvedDestination
 }
 
+// resolveAddress resolves the address to its k8s object, or the ip of the address to its reverse dns name when no
+// object matches
+func resolveAddress(address string, ip string) string {
+	if k8sResolver != nil {
+		if resolved := k8sResolver.Resolve(address); resolved != "" {
+			return resolved
+		}
+	}
+	if dnsResolver != nil {
+		return dnsResolver.Resolve(ip)
+	}
+	return ""
+}
+
+// resolveLabels returns the configured labels of the source and destination pods, destinations reached through a
+// service ip have no pod labels
+func resolveLabels(connectionInfo *tapApi.ConnectionInfo) (sourceLabels tapApi.EntryLabels, destinationLabels tapApi.EntryLabels) {
+	if k8sResolver == nil {
+		return nil, nil
+	}
+	return k8sResolver.ResolveLabels(connectionInfo.ClientIP), k8sResolver.ResolveLabels(connectionInfo.ServerIP)
+}
+
+func mergeLabels(labels tapApi.EntryLabels, addedLabels tapApi.EntryLabels) tapApi.EntryLabels {
+	if len(addedLabels) == 0 {
+		return labels
+	}
+	merged := tapApi.EntryLabels{}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range addedLabels {
+		merged[key] = value
+	}
+	return merged
+}
+
+// ResolveNamespace returns the namespace of the destination of the connection, or of its source when the destination isn't resolved
+func ResolveNamespace(connectionInfo *tapApi.ConnectionInfo) string {
+	if k8sResolver == nil {
+		return ""
+	}
+
+	for _, address := range []string{fmt.Sprintf("%s:%s", connectionInfo.ServerIP, connectionInfo.ServerPort), connectionInfo.ServerIP, connectionInfo.ClientIP} {
+		// resolved names are in the form of <name>.<namespace>
+		if resolvedName := k8sResolver.Resolve(address); strings.Contains(resolvedName, ".") {
+			return resolvedName[strings.Index(resolvedName, ".")+1:]
+		}
+	}
+	return ""
+}
+
 func CheckIsServiceIP(address string) bool {
 	if k8sResolver == nil {
 		return false
@@ -182,10 +376,31 @@ func getEstimatedEntrySizeBytes(mizuEntry *tapApi.MizuEntry) int {
 	sizeBytes += len(mizuEntry.RequestSenderIp)
 	sizeBytes += len(mizuEntry.ResolvedDestination)
 	sizeBytes += len(mizuEntry.ResolvedSource)
+	for _, labels := range []tapApi.EntryLabels{mizuEntry.SourceLabels, mizuEntry.DestinationLabels, mizuEntry.Fields} {
+		for key, value := range labels {
+			sizeBytes += len(key) + len(value)
+		}
+	}
+	for _, param := range mizuEntry.QueryParams {
+		sizeBytes += len(param.Name) + len(param.Value)
+	}
 	sizeBytes += 8 // Status bytes (sqlite integer is always 8 bytes)
 	sizeBytes += 8 // Timestamp bytes
 	sizeBytes += 8 // SizeBytes bytes
 	sizeBytes += 1 // IsOutgoing bytes
+	sizeBytes += 8 // RequestSize bytes
+	sizeBytes += 8 // ResponseSize bytes
 
 	return sizeBytes
 }
+
+// non-HTTP protocols don't have a notion of body size, the size of their serialized payload is used instead
+func getPayloadSizes(pair *tapApi.RequestResponsePair) (requestSize int64, responseSize int64) {
+	if requestBytes, err := json.Marshal(pair.Request.Payload); err == nil {
+		requestSize = int64(len(requestBytes))
+	}
+	if responseBytes, err := json.Marshal(pair.Response.Payload); err == nil {
+		responseSize = int64(len(responseBytes))
+	}
+	return
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	otlpTracesPath     = "/v1/traces"
+	otlpRequestTimeout = 10 * time.Second
+	otlpServiceName    = "mizu"
+
+	// span kinds and status codes of the otlp trace proto
+	otlpSpanKindServer  = 2
+	otlpSpanKindClient  = 3
+	otlpStatusCodeError = 2
+)
+
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// OtlpSink exports the entries as spans to an OpenTelemetry collector with OTLP/HTTP and the json encoding. Spans are
+// exported in the background in batches of maxBatchSize, once a batch is full or every interval, so a slow or an
+// unavailable collector never holds the writes. A failed batch is kept for the next export as long as fewer than
+// maxBufferedSpans are waiting, the oldest spans are dropped beyond it.
+type OtlpSink struct {
+	tracesUrl        string
+	client           *http.Client
+	maxBatchSize     int
+	maxBufferedSpans int
+	spans            []*otlpSpan
+	lock             sync.Mutex
+	batchFull        chan struct{} // signaled by the writes once a batch is full
+	stop             chan struct{}
+	stopped          chan struct{}
+}
+
+// NewOtlpSink exports to the collector at endpoint, e.g. http://otel-collector:4318, spans are posted to its /v1/traces
+func NewOtlpSink(endpoint string, maxBatchSize int, interval time.Duration) (*OtlpSink, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") || endpointUrl.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %s, expected an http or https url", endpoint)
+	}
+	if maxBatchSize <= 0 {
+		return nil, fmt.Errorf("otlp batch size must be positive, got %d", maxBatchSize)
+	}
+	endpointUrl.Path = strings.TrimSuffix(endpointUrl.Path, "/") + otlpTracesPath
+
+	sink := &OtlpSink{
+		tracesUrl:        endpointUrl.String(),
+		client:           utils.NewOutboundHttpClient(otlpRequestTimeout),
+		maxBatchSize:     maxBatchSize,
+		maxBufferedSpans: maxBatchSize * 10,
+		batchFull:        make(chan struct{}, 1),
+		stop:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sink.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-sink.batchFull:
+			case <-sink.stop:
+				return
+			}
+			if err := sink.exportBuffered(); err != nil {
+				logger.Log.Errorf("%v", err)
+			}
+		}
+	}()
+
+	return sink, nil
+}
+
+// Write only buffers the span of the item, the export of a full batch is left to the background. The items without a
+// request-response pair have no span and are skipped.
+func (sink *OtlpSink) Write(item *tapApi.OutputChannelItem) error {
+	span := newOtlpSpan(item)
+	if span == nil {
+		return nil
+	}
+
+	sink.lock.Lock()
+	sink.spans = append(sink.spans, span)
+	isFull := len(sink.spans) >= sink.maxBatchSize
+	sink.lock.Unlock()
+
+	if isFull {
+		select {
+		case sink.batchFull <- struct{}{}:
+		default: // an export is already due
+		}
+	}
+	return nil
+}
+
+// Close stops the background exports and exports every buffered batch
+func (sink *OtlpSink) Close() error {
+	close(sink.stop)
+	<-sink.stopped
+	return sink.exportBuffered()
+}
+
+// exportBuffered exports the buffered spans batch by batch until none is left, it stops at the first failed batch
+func (sink *OtlpSink) exportBuffered() error {
+	for {
+		exportedCount, err := sink.export()
+		if err != nil || exportedCount == 0 {
+			return err
+		}
+	}
+}
+
+// export exports the oldest batch of the buffered spans, it's only called by a single goroutine at a time
+func (sink *OtlpSink) export() (int, error) {
+	sink.lock.Lock()
+	batch := sink.spans
+	if len(batch) > sink.maxBatchSize {
+		batch = batch[:sink.maxBatchSize]
+	}
+	sink.lock.Unlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	err := sink.post(batch)
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if err == nil {
+		sink.spans = sink.spans[len(batch):]
+		return len(batch), nil
+	}
+	if dropped := len(sink.spans) - sink.maxBufferedSpans; dropped > 0 {
+		logger.Log.Warningf("Dropping %d spans, the otlp collector is unavailable", dropped)
+		sink.spans = sink.spans[dropped:]
+	}
+	return 0, fmt.Errorf("error exporting %d spans to %s: %v", len(batch), sink.tracesUrl, err)
+}
+
+func (sink *OtlpSink) post(batch []*otlpSpan) error {
+	body, err := json.Marshal(otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{newOtlpStringAttribute("service.name", otlpServiceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpServiceName}, Spans: batch}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	response, err := sink.client.Post(sink.tracesUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("otlp collector responded with status %d: %.200s", response.StatusCode, responseBody)
+	}
+	return nil
+}
+
+// newOtlpSpan returns the span of the pair, it joins the trace of the traceparent or b3 headers of http requests,
+// it returns nil when the item has no pair
+func newOtlpSpan(item *tapApi.OutputChannelItem) *otlpSpan {
+	if item.Pair == nil {
+		return nil
+	}
+
+	span := &otlpSpan{
+		SpanId:            newOtlpId(8),
+		Name:              item.Protocol.Name,
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(item.Pair.Request.CaptureTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(item.Pair.Response.CaptureTime.UnixNano(), 10),
+		Attributes:        []otlpAttribute{newOtlpStringAttribute("mizu.protocol", item.Protocol.Name)},
+	}
+
+	if connectionInfo := item.ConnectionInfo; connectionInfo != nil {
+		if connectionInfo.IsOutgoing {
+			span.Kind = otlpSpanKindClient
+		}
+		span.Attributes = append(span.Attributes,
+			newOtlpStringAttribute("net.peer.ip", connectionInfo.ClientIP),
+			newOtlpStringAttribute("net.peer.port", connectionInfo.ClientPort),
+			newOtlpStringAttribute("net.host.ip", connectionInfo.ServerIP),
+			newOtlpStringAttribute("net.host.port", connectionInfo.ServerPort),
+		)
+	}
+
+	if request := getPairHttpRequest(item.Pair); request != nil {
+		span.TraceId, span.ParentSpanId = getRequestTraceContext(request.Header)
+		span.Name = request.Method
+		span.Attributes = append(span.Attributes, newOtlpStringAttribute("http.method", request.Method))
+		if request.URL != nil {
+			span.Name = fmt.Sprintf("%s %s", request.Method, request.URL.Path)
+			span.Attributes = append(span.Attributes, newOtlpStringAttribute("http.target", request.URL.RequestURI()))
+		}
+	}
+	if response := getPairHttpResponse(item.Pair); response != nil {
+		span.Attributes = append(span.Attributes, newOtlpIntAttribute("http.status_code", int64(response.StatusCode)))
+		if response.StatusCode >= http.StatusInternalServerError {
+			span.Status.Code = otlpStatusCodeError
+		}
+	}
+
+	if span.TraceId == "" {
+		span.TraceId = newOtlpId(16)
+	}
+	return span
+}
+
+func getPairHttpRequest(pair *tapApi.RequestResponsePair) *http.Request {
+	if payload, ok := pair.Request.Payload.(tapApi.HTTPPayload); ok {
+		if request, ok := payload.Data.(*http.Request); ok {
+			return request
+		}
+	}
+	return nil
+}
+
+func getPairHttpResponse(pair *tapApi.RequestResponsePair) *http.Response {
+	if payload, ok := pair.Response.Payload.(tapApi.HTTPPayload); ok {
+		if response, ok := payload.Data.(*http.Response); ok {
+			return response
+		}
+	}
+	return nil
+}
+
+// getRequestTraceContext returns the trace id and the parent span id of the w3c traceparent header, or of the b3
+// headers when there's no valid traceparent, both are empty when the request carries no trace
+func getRequestTraceContext(header http.Header) (string, string) {
+	if match := traceparentPattern.FindStringSubmatch(strings.ToLower(header.Get("traceparent"))); match != nil {
+		return match[1], match[2]
+	}
+
+	traceId, spanId := strings.ToLower(header.Get("X-B3-TraceId")), strings.ToLower(header.Get("X-B3-SpanId"))
+	if single := strings.Split(strings.ToLower(header.Get("b3")), "-"); traceId == "" && len(single) >= 2 {
+		traceId, spanId = single[0], single[1]
+	}
+	if len(traceId) == 16 {
+		// 64 bit b3 trace ids are left padded to the 128 bit of otlp
+		traceId = strings.Repeat("0", 16) + traceId
+	}
+	if !isHexId(traceId, 16) {
+		return "", ""
+	}
+	if !isHexId(spanId, 8) {
+		spanId = ""
+	}
+	return traceId, spanId
+}
+
+func isHexId(id string, length int) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == length && strings.Trim(id, "0") != ""
+}
+
+func newOtlpId(length int) string {
+	id := make([]byte, length)
+	if _, err := rand.Read(id); err != nil {
+		logger.Log.Errorf("Error generating an otlp id: %v", err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// the json encoding of the otlp ExportTraceServiceRequest, ids are hex strings and 64 bit integers are strings
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func newOtlpStringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAttributeValue{StringValue: &value}}
+}
+
+func newOtlpIntAttribute(key string, value int64) otlpAttribute {
+	intValue := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpAttributeValue{IntValue: &intValue}}
+}
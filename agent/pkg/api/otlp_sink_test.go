@@ -0,0 +1,256 @@
+package api_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/api"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type exportedSpan struct {
+	TraceId           string `json:"traceId"`
+	SpanId            string `json:"spanId"`
+	ParentSpanId      string `json:"parentSpanId"`
+	Name              string `json:"name"`
+	Kind              int    `json:"kind"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string `json:"endTimeUnixNano"`
+	Attributes        []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+			IntValue    string `json:"intValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func (span *exportedSpan) getAttribute(key string) string {
+	for _, attribute := range span.Attributes {
+		if attribute.Key == key {
+			return attribute.Value.StringValue + attribute.Value.IntValue
+		}
+	}
+	return ""
+}
+
+type fakeCollector struct {
+	server        *httptest.Server
+	exports       [][]exportedSpan
+	failing       bool
+	failedExports int
+	lock          sync.Mutex
+}
+
+func newFakeCollector(t *testing.T) *fakeCollector {
+	collector := &fakeCollector{}
+	collector.server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v1/traces" || request.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export - path: %s, content type: %s", request.URL.Path, request.Header.Get("Content-Type"))
+		}
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Errorf("failed decoding export: %v", err)
+		}
+
+		collector.lock.Lock()
+		defer collector.lock.Unlock()
+		if collector.failing {
+			collector.failedExports++
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var spans []exportedSpan
+		for _, resourceSpans := range body.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+		collector.exports = append(collector.exports, spans)
+	}))
+	t.Cleanup(collector.server.Close)
+	return collector
+}
+
+func (collector *fakeCollector) setFailing(failing bool) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.failing = failing
+}
+
+func (collector *fakeCollector) getExports() [][]exportedSpan {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	return append([][]exportedSpan{}, collector.exports...)
+}
+
+func (collector *fakeCollector) getFailedExports() int {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	return collector.failedExports
+}
+
+// waitForCollector waits for the background exports of the sink to reach the collector
+func waitForCollector(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", "a background export", "none within 5s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newHttpItem(path string, header http.Header, statusCode int, start time.Time, latency time.Duration) *tapApi.OutputChannelItem {
+	requestUrl, _ := url.Parse(path)
+	return &tapApi.OutputChannelItem{
+		Protocol:       tapApi.Protocol{Name: "http"},
+		ConnectionInfo: &tapApi.ConnectionInfo{ClientIP: "10.0.0.1", ClientPort: "51000", ServerIP: "10.0.0.2", ServerPort: "80"},
+		Pair: &tapApi.RequestResponsePair{
+			Request: tapApi.GenericMessage{IsRequest: true, CaptureTime: start, Payload: tapApi.HTTPPayload{
+				Type: tapApi.TypeHttpRequest,
+				Data: &http.Request{Method: http.MethodGet, URL: requestUrl, Header: header},
+			}},
+			Response: tapApi.GenericMessage{CaptureTime: start.Add(latency), Payload: tapApi.HTTPPayload{
+				Type: tapApi.TypeHttpResponse,
+				Data: &http.Response{StatusCode: statusCode},
+			}},
+		},
+	}
+}
+
+func TestOtlpSinkExportsBatches(t *testing.T) {
+	collector := newFakeCollector(t)
+	sink, err := api.NewOtlpSink(collector.server.URL, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("failed creating sink: %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	items := []*tapApi.OutputChannelItem{
+		newHttpItem("/users?id=1", http.Header{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}, 200, start, 30*time.Millisecond),
+		{Protocol: tapApi.Protocol{Name: "kafka"}},
+		newHttpItem("/orders", http.Header{"X-B3-Traceid": {"463ac35c9f6413ad"}, "X-B3-Spanid": {"a2fb4a1d1a96d312"}}, 503, start, time.Second),
+		newHttpItem("/health", http.Header{}, 200, start, 0),
+	}
+	for _, item := range items {
+		if err := sink.Write(item); err != nil {
+			t.Fatalf("failed writing: %v", err)
+		}
+	}
+
+	// the kafka item has no pair so the first batch is only full on the third write, it's exported in the background
+	waitForCollector(t, func() bool { return len(collector.getExports()) > 0 })
+	if exports := collector.getExports(); len(exports[0]) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "a batch of 2 spans", exports)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed closing: %v", err)
+	}
+	exports := collector.getExports()
+	if len(exports) != 2 || len(exports[1]) != 1 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "the remaining span exported by close at the latest", exports)
+	}
+
+	first, second, third := exports[0][0], exports[0][1], exports[1][0]
+	if first.TraceId != "0af7651916cd43dd8448eb211c80319c" || first.ParentSpanId != "b7ad6b7169203331" || len(first.SpanId) != 16 {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the traceparent trace", first)
+	}
+	if first.Name != "GET /users" || first.getAttribute("http.target") != "/users?id=1" || first.getAttribute("http.status_code") != "200" {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "GET /users with status 200", first)
+	}
+	if first.getAttribute("net.peer.ip") != "10.0.0.1" || first.getAttribute("net.host.ip") != "10.0.0.2" {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the connection ips", first)
+	}
+	if first.StartTimeUnixNano != "1000000000000" || first.EndTimeUnixNano != "1000030000000" || first.Status.Code != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "a 30ms span", first)
+	}
+	if second.TraceId != "0000000000000000463ac35c9f6413ad" || second.ParentSpanId != "a2fb4a1d1a96d312" || second.Status.Code != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the b3 trace with an error status", second)
+	}
+	if len(third.TraceId) != 32 || third.ParentSpanId != "" || third.TraceId == first.TraceId {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "a new trace", third)
+	}
+}
+
+func TestOtlpSinkRetriesFailedBatches(t *testing.T) {
+	collector := newFakeCollector(t)
+	sink, err := api.NewOtlpSink(collector.server.URL, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed creating sink: %v", err)
+	}
+
+	collector.setFailing(true)
+	// the writes never wait for the collector, the failure is only seen by the background export
+	if err := sink.Write(newHttpItem("/a", http.Header{}, 200, time.Now(), 0)); err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, err)
+	}
+	waitForCollector(t, func() bool { return collector.getFailedExports() > 0 })
+	collector.setFailing(false)
+	if err := sink.Write(newHttpItem("/b", http.Header{}, 200, time.Now(), 0)); err != nil {
+		t.Fatalf("failed writing: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed closing: %v", err)
+	}
+
+	var names []string
+	for _, export := range collector.getExports() {
+		for _, span := range export {
+			names = append(names, span.Name)
+		}
+	}
+	if len(names) != 2 || names[0] != "GET /a" || names[1] != "GET /b" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", []string{"GET /a", "GET /b"}, names)
+	}
+}
+
+func TestOtlpSinkDrainsBufferedBatchesOnClose(t *testing.T) {
+	collector := newFakeCollector(t)
+	sink, err := api.NewOtlpSink(collector.server.URL, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("failed creating sink: %v", err)
+	}
+
+	collector.setFailing(true)
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		if err := sink.Write(newHttpItem(path, http.Header{}, 200, time.Now(), 0)); err != nil {
+			t.Fatalf("failed writing: %v", err)
+		}
+	}
+	waitForCollector(t, func() bool { return collector.getFailedExports() > 0 })
+	collector.setFailing(false)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed closing: %v", err)
+	}
+
+	exportedCount := 0
+	for _, export := range collector.getExports() {
+		exportedCount += len(export)
+	}
+	if exportedCount != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 5, exportedCount)
+	}
+}
+
+func TestNewOtlpSinkInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "grpc://collector:4317"} {
+		if _, err := api.NewOtlpSink(endpoint, 10, time.Second); err == nil {
+			t.Errorf("unexpected result - expected: an error for %s, actual: %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package api
+
+import tapApi "github.com/up9inc/mizu/tap/api"
+
+// LabelUnresolvedDestination gives destinations the resolver doesn't know a best effort label by their port,
+// like https for 443. Names provided by the resolver are never replaced.
+func LabelUnresolvedDestination(mizuEntry *tapApi.MizuEntry, portLabels map[string]string) {
+	if mizuEntry.ResolvedDestination != "" {
+		return
+	}
+	mizuEntry.DestinationLabel = portLabels[mizuEntry.DestinationPort]
+}
@@ -0,0 +1,35 @@
+package api_test
+
+import (
+	"mizuserver/pkg/api"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestLabelUnresolvedDestination(t *testing.T) {
+	portLabels := map[string]string{"443": "https", "5432": "postgres"}
+
+	tests := []struct {
+		name                string
+		resolvedDestination string
+		destinationPort     string
+		portLabels          map[string]string
+		expectedLabel       string
+	}{
+		{name: "UnresolvedConfiguredPort", destinationPort: "5432", portLabels: portLabels, expectedLabel: "postgres"},
+		{name: "UnresolvedOtherPort", destinationPort: "8080", portLabels: portLabels, expectedLabel: ""},
+		{name: "ResolvedConfiguredPort", resolvedDestination: "db.default", destinationPort: "5432", portLabels: portLabels, expectedLabel: ""},
+		{name: "NoLabels", destinationPort: "443", portLabels: nil, expectedLabel: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &tapApi.MizuEntry{ResolvedDestination: test.resolvedDestination, DestinationPort: test.destinationPort}
+			api.LabelUnresolvedDestination(entry, test.portLabels)
+			if entry.DestinationLabel != test.expectedLabel || entry.ResolvedDestination != test.resolvedDestination {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", test.expectedLabel, entry.DestinationLabel, entry.ResolvedDestination)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"mizuserver/pkg/filterExpression"
+	"strings"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// GetPromotedHeaders returns the configured promoted headers by their lowercase names, headers promoted to a field
+// name that can't be filtered by are skipped
+func GetPromotedHeaders(promotedHeaders map[string]string) map[string]string {
+	fieldNames := make(map[string]string, len(promotedHeaders))
+	for header, fieldName := range promotedHeaders {
+		if !filterExpression.IsIdentifier(fieldName) {
+			logger.Log.Warningf("Not promoting header %s, %q isn't a valid field name", header, fieldName)
+			continue
+		}
+		fieldNames[strings.ToLower(header)] = fieldName
+	}
+	return fieldNames
+}
+
+// PromoteHeaders returns the fields of the promoted headers the request carries, the first value of a repeated header
+// is promoted. Values with line breaks, which only imported entries can have, aren't promoted.
+func PromoteHeaders(headers []har.Header, fieldNames map[string]string) tapApi.EntryLabels {
+	var fields tapApi.EntryLabels
+	for _, header := range headers {
+		fieldName, ok := fieldNames[strings.ToLower(header.Name)]
+		if !ok || strings.Contains(header.Value, "\n") {
+			continue
+		}
+		if fields == nil {
+			fields = tapApi.EntryLabels{}
+		}
+		if _, ok := fields[fieldName]; !ok {
+			fields[fieldName] = header.Value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,58 @@
+package api_test
+
+import (
+	"fmt"
+	"mizuserver/pkg/api"
+	"testing"
+
+	"github.com/google/martian/har"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestPromoteHeaders(t *testing.T) {
+	fieldNames := api.GetPromotedHeaders(map[string]string{
+		"X-Tenant-ID":  "tenantId",
+		"X-Request-Id": "requestId",
+		"X-Broken":     "broken field",
+	})
+
+	tests := []struct {
+		name           string
+		headers        []har.Header
+		expectedFields tapApi.EntryLabels
+	}{
+		{
+			name:           "Promoted",
+			headers:        []har.Header{{Name: "Accept", Value: "*/*"}, {Name: "x-tenant-id", Value: "acme"}, {Name: "X-Request-Id", Value: "r-1"}},
+			expectedFields: tapApi.EntryLabels{"tenantId": "acme", "requestId": "r-1"},
+		},
+		{
+			name:           "Repeated",
+			headers:        []har.Header{{Name: "X-Tenant-ID", Value: "acme"}, {Name: "X-Tenant-ID", Value: "globex"}},
+			expectedFields: tapApi.EntryLabels{"tenantId": "acme"},
+		},
+		{
+			name:           "Missing",
+			headers:        []har.Header{{Name: "Accept", Value: "*/*"}},
+			expectedFields: nil,
+		},
+		{
+			name:           "InvalidFieldName",
+			headers:        []har.Header{{Name: "X-Broken", Value: "value"}},
+			expectedFields: nil,
+		},
+		{
+			name:           "LineBreak",
+			headers:        []har.Header{{Name: "X-Tenant-ID", Value: "acme\nteam=fake"}},
+			expectedFields: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if fields := api.PromoteHeaders(test.headers, fieldNames); fmt.Sprint(fields) != fmt.Sprint(test.expectedFields) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedFields, fields)
+			}
+		})
+	}
+}
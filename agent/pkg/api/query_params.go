@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const redactedQueryParamValue = "[REDACTED]"
+
+// ExtractQueryParams stores the query params of http entries as fields, the params are unescaped so an encoded and a
+// plain value are the same. Redacted params are replaced in the url and the path as well.
+func ExtractQueryParams(mizuEntry *tapApi.MizuEntry, queryParamsConfig *shared.QueryParamsConfig) {
+	if queryParamsConfig == nil || mizuEntry.ProtocolName != "http" {
+		return
+	}
+	queryIndex := strings.IndexByte(mizuEntry.Path, '?')
+	if queryIndex < 0 {
+		return
+	}
+	rawQuery, fragment := mizuEntry.Path[queryIndex+1:], ""
+	if fragmentIndex := strings.IndexByte(rawQuery, '#'); fragmentIndex >= 0 {
+		rawQuery, fragment = rawQuery[:fragmentIndex], rawQuery[fragmentIndex:]
+	}
+
+	params, redactedQuery, isRedacted := parseQueryParams(rawQuery, queryParamsConfig)
+	mizuEntry.QueryParams = params
+
+	if isRedacted {
+		path := mizuEntry.Path[:queryIndex+1] + redactedQuery + fragment
+		if strings.HasSuffix(mizuEntry.Url, mizuEntry.Path) {
+			mizuEntry.Url = strings.TrimSuffix(mizuEntry.Url, mizuEntry.Path) + path
+		}
+		mizuEntry.Path = path
+	}
+}
+
+// parseQueryParams returns the params of the raw query and the raw query with the values of the redacted params
+// replaced, and whether any param was redacted
+func parseQueryParams(rawQuery string, queryParamsConfig *shared.QueryParamsConfig) (tapApi.EntryQueryParams, string, bool) {
+	var params tapApi.EntryQueryParams
+	isRedacted := false
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		rawName, rawValue := part, ""
+		if separatorIndex := strings.IndexByte(part, '='); separatorIndex >= 0 {
+			rawName, rawValue = part[:separatorIndex], part[separatorIndex+1:]
+		}
+		name, value := unescapeQueryParam(rawName), unescapeQueryParam(rawValue)
+		if queryParamsConfig.LowercaseNames {
+			name = strings.ToLower(name)
+		}
+		if isRedactedQueryParam(name, queryParamsConfig.RedactedParams) {
+			value = redactedQueryParamValue
+			parts[i] = rawName + "=" + url.QueryEscape(value)
+			isRedacted = true
+		}
+		params = append(params, tapApi.EntryQueryParam{Name: name, Value: value})
+	}
+	return params, strings.Join(parts, "&"), isRedacted
+}
+
+// RedactItemQueryParams replaces the values of the redacted query params in the request of an http item, before the
+// item is analyzed so its stored pair, and whatever is derived from it, never holds them. Both the dissected and the
+// decoded payloads are handled.
+func RedactItemQueryParams(item *tapApi.OutputChannelItem, queryParamsConfig *shared.QueryParamsConfig) {
+	if queryParamsConfig == nil || len(queryParamsConfig.RedactedParams) == 0 || item.Pair == nil || item.Protocol.Name != "http" {
+		return
+	}
+	for _, message := range []*tapApi.GenericMessage{&item.Pair.Request, &item.Pair.Response} {
+		switch payload := message.Payload.(type) {
+		case tapApi.HTTPPayload:
+			switch data := payload.Data.(type) {
+			case *http.Request:
+				redactRequestQueryParams(data, queryParamsConfig)
+			case *http.Response:
+				if data.Request != nil {
+					redactRequestQueryParams(data.Request, queryParamsConfig)
+				}
+			}
+		case map[string]interface{}:
+			redactDecodedQueryParams(payload, queryParamsConfig)
+		}
+	}
+}
+
+func redactRequestQueryParams(request *http.Request, queryParamsConfig *shared.QueryParamsConfig) {
+	if request.URL != nil && request.URL.RawQuery != "" {
+		_, request.URL.RawQuery, _ = parseQueryParams(request.URL.RawQuery, queryParamsConfig)
+	}
+	request.RequestURI = redactUrlQueryParams(request.RequestURI, queryParamsConfig)
+}
+
+// redactDecodedQueryParams redacts the har url and query string of a decoded payload, and the url of its raw request
+func redactDecodedQueryParams(payload map[string]interface{}, queryParamsConfig *shared.QueryParamsConfig) {
+	if details, ok := payload["details"].(map[string]interface{}); ok {
+		if harUrl, ok := details["url"].(string); ok {
+			details["url"] = redactUrlQueryParams(harUrl, queryParamsConfig)
+		}
+		queryString, _ := details["queryString"].([]interface{})
+		for _, param := range queryString {
+			if param, ok := param.(map[string]interface{}); ok {
+				if name, ok := param["name"].(string); ok && isRedactedQueryParam(name, queryParamsConfig.RedactedParams) {
+					param["value"] = redactedQueryParamValue
+				}
+			}
+		}
+	}
+	rawRequests := make([]map[string]interface{}, 0)
+	if rawRequest, ok := payload["rawRequest"].(map[string]interface{}); ok {
+		rawRequests = append(rawRequests, rawRequest)
+	}
+	if rawResponse, ok := payload["rawResponse"].(map[string]interface{}); ok {
+		if rawRequest, ok := rawResponse["Request"].(map[string]interface{}); ok {
+			rawRequests = append(rawRequests, rawRequest)
+		}
+	}
+	for _, rawRequest := range rawRequests {
+		if rawUrl, ok := rawRequest["URL"].(map[string]interface{}); ok {
+			if rawQuery, ok := rawUrl["RawQuery"].(string); ok && rawQuery != "" {
+				_, rawUrl["RawQuery"], _ = parseQueryParams(rawQuery, queryParamsConfig)
+			}
+		}
+		if requestUri, ok := rawRequest["RequestURI"].(string); ok {
+			rawRequest["RequestURI"] = redactUrlQueryParams(requestUri, queryParamsConfig)
+		}
+	}
+}
+
+// redactUrlQueryParams redacts the query of a url or a request uri, the fragment is kept
+func redactUrlQueryParams(rawUrl string, queryParamsConfig *shared.QueryParamsConfig) string {
+	queryIndex := strings.IndexByte(rawUrl, '?')
+	if queryIndex < 0 {
+		return rawUrl
+	}
+	rawQuery, fragment := rawUrl[queryIndex+1:], ""
+	if fragmentIndex := strings.IndexByte(rawQuery, '#'); fragmentIndex >= 0 {
+		rawQuery, fragment = rawQuery[:fragmentIndex], rawQuery[fragmentIndex:]
+	}
+	_, redactedQuery, _ := parseQueryParams(rawQuery, queryParamsConfig)
+	return rawUrl[:queryIndex+1] + redactedQuery + fragment
+}
+
+// unescapeQueryParam keeps the params that aren't valid query escapes as they were sent
+func unescapeQueryParam(rawText string) string {
+	text, err := url.QueryUnescape(rawText)
+	if err != nil {
+		return rawText
+	}
+	return text
+}
+
+func isRedactedQueryParam(name string, redactedParams []string) bool {
+	for _, redactedParam := range redactedParams {
+		if strings.EqualFold(name, redactedParam) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestExtractQueryParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		config         *shared.QueryParamsConfig
+		expectedParams tapApi.EntryQueryParams
+		expectedPath   string
+	}{
+		{
+			name:           "Repeated",
+			path:           "/search?tag=x&q=shoes&tag=y",
+			config:         &shared.QueryParamsConfig{},
+			expectedParams: tapApi.EntryQueryParams{{Name: "tag", Value: "x"}, {Name: "q", Value: "shoes"}, {Name: "tag", Value: "y"}},
+			expectedPath:   "/search?tag=x&q=shoes&tag=y",
+		},
+		{
+			name:           "Encoded",
+			path:           "/search?q=red+shoes&size%5B%5D=42%2F43&empty=&flag#results",
+			config:         &shared.QueryParamsConfig{},
+			expectedParams: tapApi.EntryQueryParams{{Name: "q", Value: "red shoes"}, {Name: "size[]", Value: "42/43"}, {Name: "empty", Value: ""}, {Name: "flag", Value: ""}},
+			expectedPath:   "/search?q=red+shoes&size%5B%5D=42%2F43&empty=&flag#results",
+		},
+		{
+			name:           "InvalidEscape",
+			path:           "/search?q=100%&&page=2",
+			config:         &shared.QueryParamsConfig{},
+			expectedParams: tapApi.EntryQueryParams{{Name: "q", Value: "100%"}, {Name: "page", Value: "2"}},
+			expectedPath:   "/search?q=100%&&page=2",
+		},
+		{
+			name:           "Redacted",
+			path:           "/login?user=bob&Token=abc&token=def",
+			config:         &shared.QueryParamsConfig{RedactedParams: []string{"token"}},
+			expectedParams: tapApi.EntryQueryParams{{Name: "user", Value: "bob"}, {Name: "Token", Value: "[REDACTED]"}, {Name: "token", Value: "[REDACTED]"}},
+			expectedPath:   "/login?user=bob&Token=%5BREDACTED%5D&token=%5BREDACTED%5D",
+		},
+		{
+			name:           "LowercaseNames",
+			path:           "/search?Q=Shoes",
+			config:         &shared.QueryParamsConfig{LowercaseNames: true},
+			expectedParams: tapApi.EntryQueryParams{{Name: "q", Value: "Shoes"}},
+			expectedPath:   "/search?Q=Shoes",
+		},
+		{
+			name:         "NoQuery",
+			path:         "/search",
+			config:       &shared.QueryParamsConfig{},
+			expectedPath: "/search",
+		},
+		{
+			name:         "NotConfigured",
+			path:         "/search?q=shoes",
+			expectedPath: "/search?q=shoes",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &tapApi.MizuEntry{ProtocolName: "http", Url: "http://shop" + test.path, Path: test.path}
+			api.ExtractQueryParams(entry, test.config)
+			if fmt.Sprint(entry.QueryParams) != fmt.Sprint(test.expectedParams) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedParams, entry.QueryParams)
+			}
+			if entry.Path != test.expectedPath || entry.Url != "http://shop"+test.expectedPath {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", test.expectedPath, entry.Path, entry.Url)
+			}
+		})
+	}
+}
+
+func TestEntryQueryParamsStorage(t *testing.T) {
+	params := tapApi.EntryQueryParams{{Name: "q", Value: "a b\nc"}, {Name: "q=", Value: "x&y"}, {Name: "empty", Value: ""}}
+	value, err := params.Value()
+	if err != nil {
+		t.Fatalf("failed to store query params: %v", err)
+	}
+	if expected := "\nq=a+b%0Ac\nq%3D=x%26y\nempty=\n"; value != expected {
+		t.Errorf("unexpected result - expected: %q, actual: %q", expected, value)
+	}
+
+	var scanned tapApi.EntryQueryParams
+	if err := scanned.Scan(value); err != nil || fmt.Sprint(scanned) != fmt.Sprint(params) {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", params, scanned, err)
+	}
+}
+
+func newQueryParamsTestItem(t *testing.T, isDecoded bool) *tapApi.OutputChannelItem {
+	request := httptest.NewRequest(http.MethodGet, "http://orders/search?q=shoes&api_key=secret-key#results", nil)
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+	item := &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair: &tapApi.RequestResponsePair{
+			Request:  tapApi.GenericMessage{IsRequest: true, Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpRequest, Data: request}},
+			Response: tapApi.GenericMessage{Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpResponse, Data: response}},
+		},
+	}
+	if !isDecoded {
+		return item
+	}
+	// the api server gets the payloads decoded from json
+	decodedItem, err := models.DecodeOutputChannelItem(item)
+	if err != nil {
+		t.Fatalf("failed to decode the item: %v", err)
+	}
+	return decodedItem
+}
+
+func TestRedactItemQueryParams(t *testing.T) {
+	queryParamsConfig := &shared.QueryParamsConfig{RedactedParams: []string{"API_KEY"}}
+
+	for _, isDecoded := range []bool{false, true} {
+		t.Run(fmt.Sprintf("decoded %v", isDecoded), func(t *testing.T) {
+			item := newQueryParamsTestItem(t, isDecoded)
+			api.RedactItemQueryParams(item, queryParamsConfig)
+
+			// the http extension stores the pair as the entry
+			entry, err := json.Marshal(item.Pair)
+			if err != nil {
+				t.Fatalf("failed to marshal the pair: %v", err)
+			}
+			if strings.Contains(string(entry), "secret-key") {
+				t.Errorf("unexpected result - expected: %v, actual: %s", "a redacted entry", entry)
+			}
+			for _, expected := range []string{"q=shoes", "shoes", "api_key=%5BREDACTED%5D"} {
+				if !strings.Contains(string(entry), expected) {
+					t.Errorf("unexpected result - expected: %v, actual: %s", expected, entry)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactItemQueryParamsNotConfigured(t *testing.T) {
+	item := newQueryParamsTestItem(t, true)
+	api.RedactItemQueryParams(item, &shared.QueryParamsConfig{})
+
+	if entry, _ := json.Marshal(item.Pair); !strings.Contains(string(entry), "secret-key") {
+		t.Errorf("unexpected result - expected: %v, actual: %s", "the query kept", entry)
+	}
+}
@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"context"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// startTestReader reads the entries of the channel and returns a channel closed once the reading returned
+func startTestReader(t *testing.T, ctx context.Context, items <-chan *tapApi.OutputChannelItem) <-chan struct{} {
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{}
+	entriesRead := make(chan struct{})
+	t.Cleanup(func() {
+		<-entriesRead
+		config.Config = previousConfig
+	})
+
+	go func() {
+		defer close(entriesRead)
+		api.StartReadingEntries(ctx, items, nil)
+	}()
+	return entriesRead
+}
+
+func assertReadingReturned(t *testing.T, entriesRead <-chan struct{}) {
+	select {
+	case <-entriesRead:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "the reading returned", "still reading")
+	}
+}
+
+func TestStartReadingEntriesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	entriesRead := startTestReader(t, ctx, make(chan *tapApi.OutputChannelItem))
+
+	select {
+	case <-entriesRead:
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "still reading", "the reading returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	assertReadingReturned(t, entriesRead)
+}
+
+func TestStartReadingEntriesChannelClosed(t *testing.T) {
+	items := make(chan *tapApi.OutputChannelItem)
+	entriesRead := startTestReader(t, context.Background(), items)
+
+	close(items)
+	assertReadingReturned(t, entriesRead)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+	"github.com/up9inc/mizu/shared/units"
+)
+
+const compressionStatsLogInterval = time.Minute
+
+// CompressionStats counts the bytes of the tapped entries a sender sent and the bytes written to the connections dialed
+// through it, their ratio is the compression achieved by permessage-deflate. The written bytes include the frame
+// headers and the other messages, so an uncompressed connection has a ratio a bit under 1.
+type CompressionStats struct {
+	messageBytes uint64
+	wireBytes    uint64
+}
+
+type countingConn struct {
+	net.Conn
+	written *uint64
+}
+
+func (conn *countingConn) Write(data []byte) (int, error) {
+	written, err := conn.Conn.Write(data)
+	atomic.AddUint64(conn.written, uint64(written))
+	return written, err
+}
+
+// DialContext dials like net.Dialer and counts the bytes written to the connection, it's meant for the NetDialContext
+// of a websocket.Dialer
+func (stats *CompressionStats) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, written: &stats.wireBytes}, nil
+}
+
+// GetTotals returns the bytes of the sent entries and the bytes written for them since the stats were created
+func (stats *CompressionStats) GetTotals() (messageBytes uint64, wireBytes uint64) {
+	return atomic.LoadUint64(&stats.messageBytes), atomic.LoadUint64(&stats.wireBytes)
+}
+
+func (stats *CompressionStats) addEntry(size int) {
+	atomic.AddUint64(&stats.messageBytes, uint64(size))
+}
+
+// logPeriodically logs the compression ratio of every interval anything was sent in, until stop is closed
+func (stats *CompressionStats) logPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMessageBytes, lastWireBytes := stats.GetTotals()
+	for {
+		select {
+		case <-ticker.C:
+			messageBytes, wireBytes := stats.GetTotals()
+			intervalMessageBytes, intervalWireBytes := messageBytes-lastMessageBytes, wireBytes-lastWireBytes
+			lastMessageBytes, lastWireBytes = messageBytes, wireBytes
+			if intervalMessageBytes == 0 || intervalWireBytes == 0 {
+				continue
+			}
+			logger.Log.Infof("Sent %s of tapped entries as %s through the socket, compression ratio %.2f", units.BytesToHumanReadable(int64(intervalMessageBytes)), units.BytesToHumanReadable(int64(intervalWireBytes)), float64(intervalMessageBytes)/float64(intervalWireBytes))
+		case <-stop:
+			return
+		}
+	}
+}
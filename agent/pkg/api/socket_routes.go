@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"mizuserver/pkg/middlewares"
+	"mizuserver/pkg/models"
 	"net/http"
 	"sync"
 	"time"
@@ -15,7 +18,7 @@ import (
 type EventHandlers interface {
 	WebSocketConnect(socketId int, isTapper bool)
 	WebSocketDisconnect(socketId int, isTapper bool)
-	WebSocketMessage(socketId int, message []byte)
+	WebSocketMessage(socketId int, message []byte, encoding models.MessageEncoding)
 }
 
 type SocketConnection struct {
@@ -25,14 +28,21 @@ type SocketConnection struct {
 	isTapper      bool
 }
 
+// compression (permessage-deflate, RFC 7692) is negotiated per client, clients that don't offer the extension get uncompressed frames
 var websocketUpgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+	EnableCompression: true,
+	Subprotocols:      []string{models.MsgpackSubprotocol, models.JsonSubprotocol},
 }
 
 var websocketIdsLock = sync.Mutex{}
 var connectedWebsockets map[int]*SocketConnection
 var connectedWebsocketIdCounter = 0
+var isClosingWebsockets = false          // guarded by websocketIdsLock, no socket is accepted once set
+var websocketHandlers = sync.WaitGroup{} // the handlers of the connected sockets
+
+const websocketCloseTimeout = time.Second
 
 func init() {
 	websocketUpgrader.CheckOrigin = func(r *http.Request) bool { return true } // like cors for web socket
@@ -40,10 +50,10 @@ func init() {
 }
 
 func WebSocketRoutes(app *gin.Engine, eventHandlers EventHandlers) {
-	app.GET("/ws", func(c *gin.Context) {
+	app.GET("/ws", middlewares.RequireWebSocketToken(), func(c *gin.Context) {
 		websocketHandler(c.Writer, c.Request, eventHandlers, false)
 	})
-	app.GET("/wsTapper", func(c *gin.Context) {
+	app.GET("/wsTapper", middlewares.RequireWebSocketToken(), func(c *gin.Context) {
 		websocketHandler(c.Writer, c.Request, eventHandlers, true)
 	})
 }
@@ -57,6 +67,15 @@ func websocketHandler(w http.ResponseWriter, r *http.Request, eventHandlers Even
 
 	websocketIdsLock.Lock()
 
+	if isClosingWebsockets {
+		websocketIdsLock.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(websocketCloseTimeout))
+		conn.Close()
+		return
+	}
+
+	websocketHandlers.Add(1)
+	defer websocketHandlers.Done()
 	connectedWebsocketIdCounter++
 	socketId := connectedWebsocketIdCounter
 	connectedWebsockets[socketId] = &SocketConnection{connection: conn, lock: &sync.Mutex{}, eventHandlers: eventHandlers, isTapper: isTapper}
@@ -69,13 +88,23 @@ func websocketHandler(w http.ResponseWriter, r *http.Request, eventHandlers Even
 
 	eventHandlers.WebSocketConnect(socketId, isTapper)
 
+	// only binary messages are in the negotiated encoding, text messages are json
+	socketEncoding := models.GetSubprotocolEncoding(conn.Subprotocol())
 	for {
-		_, msg, err := conn.ReadMessage()
+		messageType, msg, err := conn.ReadMessage()
 		if err != nil {
-			logger.Log.Errorf("Error reading message, socket id: %d, error: %v", socketId, err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Log.Infof("Socket closed, socket id: %d, reason: %v", socketId, err)
+			} else {
+				logger.Log.Errorf("Error reading message, socket id: %d, error: %v", socketId, err)
+			}
 			break
 		}
-		eventHandlers.WebSocketMessage(socketId, msg)
+		encoding := models.MessageEncodingJson
+		if messageType == websocket.BinaryMessage {
+			encoding = socketEncoding
+		}
+		eventHandlers.WebSocketMessage(socketId, msg, encoding)
 	}
 }
 
@@ -92,6 +121,44 @@ func socketCleanup(socketId int, socketConnection *SocketConnection) {
 	socketConnection.eventHandlers.WebSocketDisconnect(socketId, socketConnection.isTapper)
 }
 
+// CloseWebSockets refuses new sockets and sends a close frame to the connected ones, it returns once their handlers
+// exited. The sockets still connected when ctx is done are closed without waiting for their peers.
+func CloseWebSockets(ctx context.Context) {
+	websocketIdsLock.Lock()
+	isClosingWebsockets = true
+	var sockets []*SocketConnection
+	for _, socketObj := range connectedWebsockets {
+		if socketObj != nil {
+			sockets = append(sockets, socketObj)
+		}
+	}
+	websocketIdsLock.Unlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, socketObj := range sockets {
+		socketObj.lock.Lock()
+		err := socketObj.connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(websocketCloseTimeout))
+		socketObj.lock.Unlock()
+		if err != nil {
+			socketObj.connection.Close()
+		}
+	}
+
+	handlersExited := make(chan struct{})
+	go func() {
+		websocketHandlers.Wait()
+		close(handlersExited)
+	}()
+	select {
+	case <-handlersExited:
+	case <-ctx.Done():
+		for _, socketObj := range sockets {
+			socketObj.connection.Close()
+		}
+		<-handlersExited
+	}
+}
+
 var db = debounce.NewDebouncer(time.Second*5, func() {
 	logger.Log.Error("Successfully sent to socket")
 })
@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"mizuserver/pkg/config"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/up9inc/mizu/shared"
+)
+
+func TestWebSocketRoutesCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		name                string
+		offerCompression    bool
+		expectedCompression bool
+	}{
+		{name: "client offers compression", offerCompression: true, expectedCompression: true},
+		{name: "client without compression support", offerCompression: false, expectedCompression: false},
+	}
+
+	serverAddress := startTestSocketServer(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dialer := websocket.Dialer{EnableCompression: test.offerCompression}
+			connection, response, err := dialer.Dial(serverAddress+"/ws", nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			t.Cleanup(func() { connection.Close() })
+
+			negotiated := strings.Contains(response.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+			if negotiated != test.expectedCompression {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedCompression, negotiated)
+			}
+		})
+	}
+}
+
+func TestWebSocketRoutesRequireToken(t *testing.T) {
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{WebSocketToken: "websocket-secret"}
+	t.Cleanup(func() { config.Config = previousConfig })
+
+	tests := []struct {
+		name         string
+		path         string
+		header       http.Header
+		expectedCode int
+	}{
+		{name: "valid bearer token", path: "/ws", header: http.Header{"Authorization": {"Bearer websocket-secret"}}, expectedCode: http.StatusSwitchingProtocols},
+		{name: "valid token query param", path: "/ws?token=websocket-secret", expectedCode: http.StatusSwitchingProtocols},
+		{name: "valid tapper token", path: "/wsTapper", header: http.Header{"Authorization": {"Bearer websocket-secret"}}, expectedCode: http.StatusSwitchingProtocols},
+		{name: "missing token", path: "/ws", expectedCode: http.StatusUnauthorized},
+		{name: "missing tapper token", path: "/wsTapper", expectedCode: http.StatusUnauthorized},
+		{name: "wrong bearer token", path: "/ws", header: http.Header{"Authorization": {"Bearer guess"}}, expectedCode: http.StatusUnauthorized},
+		{name: "wrong token query param", path: "/ws?token=guess", expectedCode: http.StatusUnauthorized},
+		{name: "token without bearer", path: "/ws", header: http.Header{"Authorization": {"websocket-secret"}}, expectedCode: http.StatusUnauthorized},
+	}
+
+	serverAddress := startTestSocketServer(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connection, response, err := websocket.DefaultDialer.Dial(serverAddress+test.path, test.header)
+			if connection != nil {
+				t.Cleanup(func() { connection.Close() })
+			}
+			if response == nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			if response.StatusCode != test.expectedCode {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", test.expectedCode, response.StatusCode, err)
+			}
+		})
+	}
+}
+
+func TestWebSocketRoutesOpenWithoutToken(t *testing.T) {
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{}
+	t.Cleanup(func() { config.Config = previousConfig })
+
+	connection, _, err := websocket.DefaultDialer.Dial(startTestSocketServer(t)+"/ws", nil)
+	if err != nil {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "an open websocket", err)
+	}
+	connection.Close()
+}
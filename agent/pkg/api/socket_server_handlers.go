@@ -17,6 +17,9 @@ import (
 var browserClientSocketUUIDs = make([]int, 0)
 var socketListLock = sync.Mutex{}
 
+var incompatibleSchemaSocketIds = map[int]bool{} // the sockets warned about, a socket is only warned about once
+var incompatibleSchemaLock = sync.Mutex{}
+
 type RoutesEventHandlers struct {
 	EventHandlers
 	SocketOutChannel chan<- *tapApi.OutputChannelItem
@@ -27,6 +30,7 @@ func init() {
 }
 
 func (h *RoutesEventHandlers) WebSocketConnect(socketId int, isTapper bool) {
+	sendSchemaHandshake(socketId)
 	if isTapper {
 		logger.Log.Infof("Websocket event - Tapper connected, socket ID: %d", socketId)
 		providers.TapperAdded()
@@ -39,6 +43,9 @@ func (h *RoutesEventHandlers) WebSocketConnect(socketId int, isTapper bool) {
 }
 
 func (h *RoutesEventHandlers) WebSocketDisconnect(socketId int, isTapper bool) {
+	incompatibleSchemaLock.Lock()
+	delete(incompatibleSchemaSocketIds, socketId)
+	incompatibleSchemaLock.Unlock()
 	if isTapper {
 		logger.Log.Infof("Websocket event - Tapper disconnected, socket ID:  %d", socketId)
 		providers.TapperRemoved()
@@ -51,7 +58,11 @@ func (h *RoutesEventHandlers) WebSocketDisconnect(socketId int, isTapper bool) {
 }
 
 func BroadcastToBrowserClients(message []byte) {
-	for _, socketId := range browserClientSocketUUIDs {
+	socketListLock.Lock()
+	socketIds := append([]int{}, browserClientSocketUUIDs...)
+	socketListLock.Unlock()
+
+	for _, socketId := range socketIds {
 		go func(socketId int) {
 			err := SendToSocket(socketId, message)
 			if err != nil {
@@ -61,20 +72,36 @@ func BroadcastToBrowserClients(message []byte) {
 	}
 }
 
-func (h *RoutesEventHandlers) WebSocketMessage(_ int, message []byte) {
+func (h *RoutesEventHandlers) WebSocketMessage(socketId int, message []byte, encoding models.MessageEncoding) {
+	// tappers only send tapped entries in an encoding other than json
+	if encoding != models.MessageEncodingJson {
+		tappedEntryMessage, err := models.DecodeWebsocketTappedEntryMessage(message, encoding)
+		if err != nil || tappedEntryMessage.WebSocketMessageMetadata == nil || tappedEntryMessage.MessageType != shared.WebSocketMessageTypeTappedEntry {
+			logger.Log.Infof("Could not unmarshal %s websocket message %v\n", encoding, err)
+		} else {
+			checkSchemaVersion(socketId, tappedEntryMessage.WebSocketMessageMetadata)
+			expectEntryAck(tappedEntryMessage.Data, socketId, tappedEntryMessage.Sequence)
+			h.SocketOutChannel <- tappedEntryMessage.Data
+		}
+		return
+	}
+
 	var socketMessageBase shared.WebSocketMessageMetadata
 	err := json.Unmarshal(message, &socketMessageBase)
 	if err != nil {
 		logger.Log.Infof("Could not unmarshal websocket message %v\n", err)
 	} else {
+		if socketMessageBase.MessageType != shared.WebSocketMessageTypeSchemaHandshake {
+			checkSchemaVersion(socketId, &socketMessageBase)
+		}
 		switch socketMessageBase.MessageType {
 		case shared.WebSocketMessageTypeTappedEntry:
-			var tappedEntryMessage models.WebSocketTappedEntryMessage
-			err := json.Unmarshal(message, &tappedEntryMessage)
+			tappedEntryMessage, err := models.DecodeWebsocketTappedEntryMessage(message, encoding)
 			if err != nil {
 				logger.Log.Infof("Could not unmarshal message of message type %s %v\n", socketMessageBase.MessageType, err)
 			} else {
 				// NOTE: This is where the message comes back from the intermediate WebSocket to code.
+				expectEntryAck(tappedEntryMessage.Data, socketId, tappedEntryMessage.Sequence)
 				h.SocketOutChannel <- tappedEntryMessage.Data
 			}
 		case shared.WebSocketMessageTypeUpdateStatus:
@@ -83,7 +110,18 @@ func (h *RoutesEventHandlers) WebSocketMessage(_ int, message []byte) {
 			if err != nil {
 				logger.Log.Infof("Could not unmarshal message of message type %s %v\n", socketMessageBase.MessageType, err)
 			} else {
-				providers.TapStatus.Pods = statusMessage.TappingStatus.Pods
+				providers.SetTappedPods(statusMessage.TappingStatus.Pods)
+				BroadcastToBrowserClients(message)
+			}
+		case shared.WebSocketMessageTypeStreamInterruption:
+			var streamInterruptionMessage models.WebSocketStreamInterruptionMessage
+			err := json.Unmarshal(message, &streamInterruptionMessage)
+			if err != nil {
+				logger.Log.Infof("Could not unmarshal message of message type %s %v\n", socketMessageBase.MessageType, err)
+			} else if streamInterruptionMessage.Data == nil {
+				logger.Log.Infof("Stream interruption message of socket ID %d has no data", socketId)
+			} else {
+				logger.Log.Warningf("Tapper stream was interrupted for %d ms", streamInterruptionMessage.Data.GapMs)
 				BroadcastToBrowserClients(message)
 			}
 		case shared.WebsocketMessageTypeOutboundLink:
@@ -94,12 +132,46 @@ func (h *RoutesEventHandlers) WebSocketMessage(_ int, message []byte) {
 			} else {
 				handleTLSLink(outboundLinkMessage)
 			}
+		case shared.WebSocketMessageTypeSchemaHandshake:
+			var handshakeMessage shared.WebSocketSchemaHandshakeMessage
+			err := json.Unmarshal(message, &handshakeMessage)
+			if err != nil {
+				logger.Log.Infof("Could not unmarshal message of message type %s %v\n", socketMessageBase.MessageType, err)
+			} else if !handshakeMessage.HasCompatibleSchemaVersion() {
+				logger.Log.Warningf("Socket ID %d supports the message schema versions %v, this server reads the versions %v", socketId, handshakeMessage.SupportedVersions, shared.GetSupportedSchemaVersions())
+			}
 		default:
 			logger.Log.Infof("Received socket message of type %s for which no handlers are defined", socketMessageBase.MessageType)
 		}
 	}
 }
 
+func sendSchemaHandshake(socketId int) {
+	handshakeMessage, err := json.Marshal(shared.CreateWebSocketSchemaHandshakeMessage())
+	if err != nil {
+		logger.Log.Errorf("Error marshaling schema handshake message: %v", err)
+		return
+	}
+	if err := SendToSocket(socketId, handshakeMessage); err != nil {
+		logger.Log.Errorf("error sending schema handshake to socket ID %d: %v", socketId, err)
+	}
+}
+
+// checkSchemaVersion warns about the messages of an incompatible schema version, they're still handled since the
+// fields that didn't change are read as before
+func checkSchemaVersion(socketId int, metadata *shared.WebSocketMessageMetadata) {
+	if shared.IsCompatibleSchemaVersion(metadata.SchemaVersion) {
+		return
+	}
+	incompatibleSchemaLock.Lock()
+	isWarned := incompatibleSchemaSocketIds[socketId]
+	incompatibleSchemaSocketIds[socketId] = true
+	incompatibleSchemaLock.Unlock()
+	if !isWarned {
+		logger.Log.Warningf("Socket ID %d sent a %s message of schema version %d, this server reads the versions %v", socketId, metadata.MessageType, metadata.SchemaVersion, shared.GetSupportedSchemaVersions())
+	}
+}
+
 func handleTLSLink(outboundLinkMessage models.WebsocketOutboundLinkMessage) {
 	resolvedName := k8sResolver.Resolve(outboundLinkMessage.Data.DstIP)
 	if resolvedName != "" {
@@ -0,0 +1,309 @@
+package api_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/models"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func startTestSocketServer(t *testing.T) string {
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	api.WebSocketRoutes(app, &api.RoutesEventHandlers{})
+
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dialTestSocket(t *testing.T, address string) *websocket.Conn {
+	connection, _, err := websocket.DefaultDialer.Dial(address, nil)
+	if err != nil {
+		t.Fatalf("failed to dial %s: %v", address, err)
+	}
+	readSchemaHandshake(t, connection)
+	return connection
+}
+
+// readSchemaHandshake reads the handshake the server sends first on every socket
+func readSchemaHandshake(t *testing.T, connection *websocket.Conn) {
+	connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer connection.SetReadDeadline(time.Time{})
+
+	_, message, err := connection.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read schema handshake: %v", err)
+	}
+	var handshakeMessage shared.WebSocketSchemaHandshakeMessage
+	if err := json.Unmarshal(message, &handshakeMessage); err != nil || handshakeMessage.WebSocketMessageMetadata == nil {
+		t.Fatalf("failed to unmarshal schema handshake: %s %v", message, err)
+	}
+	if handshakeMessage.MessageType != shared.WebSocketMessageTypeSchemaHandshake {
+		t.Errorf("unexpected result - expected: %v, actual: %v", shared.WebSocketMessageTypeSchemaHandshake, handshakeMessage.MessageType)
+	}
+	if handshakeMessage.SchemaVersion != shared.WebSocketSchemaVersion || !handshakeMessage.HasCompatibleSchemaVersion() {
+		t.Errorf("unexpected result - expected: %v, actual: %s", shared.WebSocketSchemaVersion, message)
+	}
+}
+
+func TestWebSocketMessageStreamInterruptionBroadcast(t *testing.T) {
+	serverAddress := startTestSocketServer(t)
+
+	browserConnection := dialTestSocket(t, serverAddress+"/ws")
+	t.Cleanup(func() { browserConnection.Close() })
+
+	// the tapper loses its connection and reconnects
+	dialTestSocket(t, serverAddress+"/wsTapper").Close()
+	tapperConnection := dialTestSocket(t, serverAddress+"/wsTapper")
+	t.Cleanup(func() { tapperConnection.Close() })
+
+	interruptedAt := time.Now().Add(-3 * time.Second)
+	interruptionMessage, err := models.CreateWebsocketStreamInterruptionMessage(interruptedAt, interruptedAt.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("failed to create stream interruption message: %v", err)
+	}
+
+	// a message without data is skipped
+	if err := tapperConnection.WriteMessage(websocket.TextMessage, []byte(`{"messageType":"streamInterruption"}`)); err != nil {
+		t.Fatalf("failed to write tapper message: %v", err)
+	}
+
+	received := make(chan []byte, 1)
+	go func() {
+		_, message, err := browserConnection.ReadMessage()
+		if err == nil {
+			received <- message
+		}
+	}()
+
+	// the browser socket registration is asynchronous, resend until it is picked up
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-received:
+			var streamInterruptionMessage models.WebSocketStreamInterruptionMessage
+			if err := json.Unmarshal(message, &streamInterruptionMessage); err != nil {
+				t.Fatalf("failed to unmarshal broadcast message: %v", err)
+			}
+			if streamInterruptionMessage.MessageType != shared.WebSocketMessageTypeStreamInterruption {
+				t.Errorf("unexpected result - expected: %v, actual: %v", shared.WebSocketMessageTypeStreamInterruption, streamInterruptionMessage.MessageType)
+			}
+			if streamInterruptionMessage.Data.GapMs != 3000 {
+				t.Errorf("unexpected result - expected: %v, actual: %v", 3000, streamInterruptionMessage.Data.GapMs)
+			}
+			return
+		case <-ticker.C:
+			if err := tapperConnection.WriteMessage(websocket.TextMessage, interruptionMessage); err != nil {
+				t.Fatalf("failed to write tapper message: %v", err)
+			}
+		case <-timeout:
+			t.Fatal("stream interruption was not broadcast to the browser client")
+		}
+	}
+}
+
+func TestWebSocketTapperReconnectionBroadcast(t *testing.T) {
+	serverAddress := startTestSocketServer(t)
+
+	browserConnection := dialTestSocket(t, serverAddress+"/ws")
+	t.Cleanup(func() { browserConnection.Close() })
+	received := make(chan []byte, 10)
+	go func() {
+		for {
+			_, message, err := browserConnection.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- message
+		}
+	}()
+
+	// the browser socket registration is asynchronous, broadcast until it is picked up
+	probe := []byte(`{"messageType":"probe"}`)
+	registered := false
+	for deadline := time.Now().Add(5 * time.Second); !registered && time.Now().Before(deadline); {
+		api.BroadcastToBrowserClients(probe)
+		select {
+		case <-received:
+			registered = true
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if !registered {
+		t.Fatal("the browser socket wasn't registered")
+	}
+
+	const redialDelay = 200 * time.Millisecond
+	dialCount := 0
+	dial := func() (*websocket.Conn, error) {
+		dialCount++
+		if dialCount > 1 {
+			time.Sleep(redialDelay)
+		}
+		connection, _, err := websocket.DefaultDialer.Dial(serverAddress+"/wsTapper", nil)
+		return connection, err
+	}
+	tapperConnection, err := dial()
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	sender := api.NewTappedEntrySender(dial, 100)
+	items := make(chan *tapApi.OutputChannelItem)
+	done := make(chan struct{})
+	go func() {
+		sender.Run(tapperConnection, items)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(items)
+		<-done
+	})
+
+	// the connection drops, the tapper reconnects and reports the gap, which is broadcast to the browser
+	tapperConnection.Close()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-received:
+			var streamInterruptionMessage models.WebSocketStreamInterruptionMessage
+			if err := json.Unmarshal(message, &streamInterruptionMessage); err != nil || streamInterruptionMessage.WebSocketMessageMetadata == nil {
+				continue
+			}
+			if streamInterruptionMessage.MessageType != shared.WebSocketMessageTypeStreamInterruption {
+				continue
+			}
+			if streamInterruptionMessage.Data.GapMs < redialDelay.Milliseconds() {
+				t.Errorf("unexpected result - expected: at least %v, actual: %v", redialDelay.Milliseconds(), streamInterruptionMessage.Data.GapMs)
+			}
+			return
+		case <-timeout:
+			t.Fatal("the reconnection of the tapper was not broadcast to the browser client")
+		}
+	}
+}
+
+type testPayload struct {
+	method string
+	status int
+}
+
+func (payload testPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"details": map[string]interface{}{"method": payload.method, "status": payload.status}})
+}
+
+func TestWebSocketTappedEntryEncodings(t *testing.T) {
+	tests := []struct {
+		name                string
+		encoding            models.MessageEncoding
+		expectedSubprotocol string
+		messageType         int
+	}{
+		{name: "json", encoding: models.MessageEncodingJson, expectedSubprotocol: models.JsonSubprotocol, messageType: websocket.TextMessage},
+		{name: "msgpack", encoding: models.MessageEncodingMsgpack, expectedSubprotocol: models.MsgpackSubprotocol, messageType: websocket.BinaryMessage},
+	}
+
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	socketOutChannel := make(chan *tapApi.OutputChannelItem, 1)
+	api.WebSocketRoutes(app, &api.RoutesEventHandlers{SocketOutChannel: socketOutChannel})
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	serverAddress := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	captureTime := time.Unix(1600000000, 500).UTC()
+	item := &tapApi.OutputChannelItem{
+		Protocol:       tapApi.Protocol{Name: "http", Version: "1.1", Priority: 0},
+		Timestamp:      1600000000000,
+		ConnectionInfo: &tapApi.ConnectionInfo{ClientIP: "10.0.0.1", ClientPort: "41000", ServerIP: "10.0.0.2", ServerPort: "80", IsOutgoing: true},
+		Pair: &tapApi.RequestResponsePair{
+			Request:  tapApi.GenericMessage{IsRequest: true, CaptureTime: captureTime, Payload: testPayload{method: "GET"}},
+			Response: tapApi.GenericMessage{CaptureTime: captureTime.Add(time.Millisecond), Payload: testPayload{status: 200}},
+		},
+	}
+	expected, _ := json.Marshal(item)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: models.GetSubprotocols(test.encoding)}
+			connection, _, err := dialer.Dial(serverAddress+"/wsTapper", nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			t.Cleanup(func() { connection.Close() })
+			if connection.Subprotocol() != test.expectedSubprotocol {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedSubprotocol, connection.Subprotocol())
+			}
+
+			message, err := models.CreateWebsocketTappedEntryMessage(item, 0, test.encoding)
+			if err != nil {
+				t.Fatalf("failed to create tapped entry message: %v", err)
+			}
+			if err := connection.WriteMessage(test.messageType, message); err != nil {
+				t.Fatalf("failed to write tapper message: %v", err)
+			}
+
+			select {
+			case received := <-socketOutChannel:
+				actual, _ := json.Marshal(received)
+				if string(actual) != string(expected) {
+					t.Errorf("unexpected result - expected: %s, actual: %s", expected, actual)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("tapped entry was not received")
+			}
+		})
+	}
+}
+
+func TestWebSocketTappedEntryAck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	socketOutChannel := make(chan *tapApi.OutputChannelItem, 1)
+	api.WebSocketRoutes(app, &api.RoutesEventHandlers{SocketOutChannel: socketOutChannel})
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	tapperConnection := dialTestSocket(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/wsTapper")
+	t.Cleanup(func() { tapperConnection.Close() })
+
+	message, _ := models.CreateWebsocketTappedEntryMessage(&tapApi.OutputChannelItem{Timestamp: 1}, 7, models.MessageEncodingJson)
+	if err := tapperConnection.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatalf("failed to write tapper message: %v", err)
+	}
+
+	select {
+	case item := <-socketOutChannel:
+		// the entry is acknowledged once, after it was persisted
+		api.AckEntry(item)
+		api.AckEntry(item)
+	case <-time.After(5 * time.Second):
+		t.Fatal("tapped entry was not received")
+	}
+
+	tapperConnection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, ackMessage, err := tapperConnection.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read ack: %v", err)
+	}
+	var ack models.WebSocketTappedEntryAckMessage
+	if err := json.Unmarshal(ackMessage, &ack); err != nil || ack.MessageType != shared.WebSocketMessageTypeTappedEntryAck || ack.Data.Sequence != 7 {
+		t.Errorf("unexpected result - expected: %v, actual: %s %v", 7, ackMessage, err)
+	}
+
+	tapperConnection.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, extraMessage, err := tapperConnection.ReadMessage(); err == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %s", "a single ack", extraMessage)
+	}
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/providers"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	defaultMaxUnackedEntries  = 10000
+	unackedEntriesDropLogRate = 1000
+	defaultSocketWriteTimeout = 10 * time.Second
+	defaultSocketPingInterval = 30 * time.Second
+	defaultSocketPongTimeout  = 10 * time.Second
+)
+
+type unackedEntry struct {
+	sequence uint64
+	item     *tapApi.OutputChannelItem
+}
+
+// unackedEntries holds the sent entries by their sequence until they're acknowledged, the oldest entry is dropped to
+// make room once there are maxSize of them
+type unackedEntries struct {
+	maxSize      int
+	entries      map[uint64]*tapApi.OutputChannelItem
+	nextSequence uint64
+	oldest       uint64 // no entry is older, the entry itself may have been acknowledged
+	dropped      uint64
+	lock         sync.Mutex
+}
+
+func (unacked *unackedEntries) add(item *tapApi.OutputChannelItem) uint64 {
+	unacked.lock.Lock()
+	defer unacked.lock.Unlock()
+
+	if len(unacked.entries) >= unacked.maxSize {
+		delete(unacked.entries, unacked.oldest)
+		unacked.advanceOldest()
+		unacked.dropped++
+		if unacked.dropped%unackedEntriesDropLogRate == 1 {
+			logger.Log.Warningf("Dropped %d unacknowledged entries, the api server isn't acknowledging them", unacked.dropped)
+		}
+	}
+	sequence := unacked.nextSequence
+	unacked.nextSequence++
+	unacked.entries[sequence] = item
+	return sequence
+}
+
+func (unacked *unackedEntries) ack(sequence uint64) {
+	unacked.lock.Lock()
+	defer unacked.lock.Unlock()
+
+	delete(unacked.entries, sequence)
+	unacked.advanceOldest()
+}
+
+func (unacked *unackedEntries) advanceOldest() {
+	for unacked.oldest < unacked.nextSequence {
+		if _, ok := unacked.entries[unacked.oldest]; ok {
+			return
+		}
+		unacked.oldest++
+	}
+}
+
+// pending returns the entries by their sequence
+func (unacked *unackedEntries) pending() []unackedEntry {
+	unacked.lock.Lock()
+	defer unacked.lock.Unlock()
+
+	entries := make([]unackedEntry, 0, len(unacked.entries))
+	for sequence := unacked.oldest; sequence < unacked.nextSequence; sequence++ {
+		if item, ok := unacked.entries[sequence]; ok {
+			entries = append(entries, unackedEntry{sequence: sequence, item: item})
+		}
+	}
+	return entries
+}
+
+func (unacked *unackedEntries) count() int {
+	unacked.lock.Lock()
+	defer unacked.lock.Unlock()
+	return len(unacked.entries)
+}
+
+func (unacked *unackedEntries) droppedCount() uint64 {
+	unacked.lock.Lock()
+	defer unacked.lock.Unlock()
+	return unacked.dropped
+}
+
+// TappedEntrySender sends the entries of a tapper to the api server. An entry is kept until the api server
+// acknowledges persisting it and the kept entries are resent once the connection is reestablished, so an entry in
+// flight when the api server crashed isn't lost. The entries tapped while reconnecting are kept too and sent after
+// them. A write blocking past the write timeout or a ping left unanswered past the pong timeout breaks the connection,
+// so a half open connection is reestablished as well.
+type TappedEntrySender struct {
+	dial         func() (*websocket.Conn, error)
+	unacked      *unackedEntries
+	connection   *websocket.Conn
+	encoding     models.MessageEncoding
+	messageType  int
+	disconnected chan struct{}
+	compression  *CompressionStats // nil when the connections aren't dialed through it
+	writeTimeout time.Duration
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+}
+
+func NewTappedEntrySender(dial func() (*websocket.Conn, error), maxUnackedEntries int) *TappedEntrySender {
+	if maxUnackedEntries <= 0 {
+		maxUnackedEntries = defaultMaxUnackedEntries
+	}
+	return &TappedEntrySender{
+		dial:         dial,
+		unacked:      &unackedEntries{maxSize: maxUnackedEntries, entries: map[uint64]*tapApi.OutputChannelItem{}, nextSequence: 1, oldest: 1},
+		writeTimeout: defaultSocketWriteTimeout,
+		pingInterval: defaultSocketPingInterval,
+		pongTimeout:  defaultSocketPongTimeout,
+	}
+}
+
+// SetKeepalive overrides the default write timeout, ping interval and pong timeout with the ones set in the config,
+// it must be called before Run
+func (sender *TappedEntrySender) SetKeepalive(keepaliveConfig *shared.SocketKeepaliveConfig) {
+	if keepaliveConfig == nil {
+		return
+	}
+	if keepaliveConfig.WriteTimeoutMs > 0 {
+		sender.writeTimeout = time.Duration(keepaliveConfig.WriteTimeoutMs) * time.Millisecond
+	}
+	if keepaliveConfig.PingIntervalMs > 0 {
+		sender.pingInterval = time.Duration(keepaliveConfig.PingIntervalMs) * time.Millisecond
+	}
+	if keepaliveConfig.PongTimeoutMs > 0 {
+		sender.pongTimeout = time.Duration(keepaliveConfig.PongTimeoutMs) * time.Millisecond
+	}
+}
+
+// SetCompressionStats counts the sent entries in the stats and logs their compression ratio periodically while running
+func (sender *TappedEntrySender) SetCompressionStats(stats *CompressionStats) {
+	sender.compression = stats
+}
+
+// UnackedCount returns the number of entries the api server didn't acknowledge yet
+func (sender *TappedEntrySender) UnackedCount() int {
+	return sender.unacked.count()
+}
+
+// DroppedCount returns the number of entries dropped unacknowledged to make room for newer entries
+func (sender *TappedEntrySender) DroppedCount() uint64 {
+	return sender.unacked.droppedCount()
+}
+
+// Run sends the entries over the connection until the channel is closed, the connection is reestablished whenever it
+// breaks
+func (sender *TappedEntrySender) Run(connection *websocket.Conn, messageDataChannel <-chan *tapApi.OutputChannelItem) {
+	if sender.compression != nil {
+		stopLogging := make(chan struct{})
+		defer close(stopLogging)
+		go sender.compression.logPeriodically(compressionStatsLogInterval, stopLogging)
+	}
+	sender.setConnection(connection)
+	for {
+		select {
+		case messageData, ok := <-messageDataChannel:
+			if !ok {
+				sender.close()
+				return
+			}
+			// NOTE: This is where the `*tapApi.OutputChannelItem` leaves the code
+			// and goes into the intermediate WebSocket.
+			err := sender.send(sender.unacked.add(messageData), messageData)
+			if err == nil {
+				continue
+			}
+			providers.SocketSendFailed()
+			logger.Log.Errorf("error sending message through socket server %v, err: %s, (%v,%+v)", messageData, err, err, err)
+		case <-sender.disconnected:
+		}
+
+		logger.Log.Warning("detected socket disconnection, reestablishing socket connection")
+		if isChannelClosed := sender.reconnect(messageDataChannel); isChannelClosed {
+			sender.close()
+			return
+		}
+	}
+}
+
+// close ends the connection with a close frame, the acknowledgements of the entries in flight are read until the api
+// server answers it
+func (sender *TappedEntrySender) close() {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "tapper shutting down")
+	if err := sender.connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(websocketCloseTimeout)); err == nil {
+		select {
+		case <-sender.disconnected:
+		case <-time.After(websocketCloseTimeout):
+		}
+	}
+	sender.connection.Close()
+}
+
+func (sender *TappedEntrySender) setConnection(connection *websocket.Conn) {
+	sender.connection = connection
+	sender.encoding = models.GetSubprotocolEncoding(connection.Subprotocol())
+	sender.messageType = websocket.TextMessage
+	if sender.encoding != models.MessageEncodingJson {
+		logger.Log.Infof("Sending tapped entries encoded as %s", sender.encoding)
+		sender.messageType = websocket.BinaryMessage
+	}
+	sender.disconnected = sender.readAcks(connection)
+	go sender.pingPeriodically(connection, sender.disconnected)
+	if handshakeMessage, err := json.Marshal(shared.CreateWebSocketSchemaHandshakeMessage()); err == nil {
+		if err := sender.write(connection, websocket.TextMessage, handshakeMessage); err != nil {
+			logger.Log.Errorf("error sending schema handshake through socket server, err: %v", err)
+		}
+	}
+}
+
+// send only fails when the connection does, entries that can't be encoded are dropped
+func (sender *TappedEntrySender) send(sequence uint64, messageData *tapApi.OutputChannelItem) error {
+	marshaledData, err := models.CreateWebsocketTappedEntryMessage(messageData, sequence, sender.encoding)
+	if err != nil {
+		logger.Log.Errorf("error converting message to json %v, err: %s, (%v,%+v)", messageData, err, err, err)
+		sender.unacked.ack(sequence)
+		return nil
+	}
+	if err := sender.write(sender.connection, sender.messageType, marshaledData); err != nil {
+		return err
+	}
+	if sender.compression != nil {
+		sender.compression.addEntry(len(marshaledData))
+	}
+	return nil
+}
+
+// write fails once the write timeout passes, the connection is broken from then on
+func (sender *TappedEntrySender) write(connection *websocket.Conn, messageType int, data []byte) error {
+	if err := connection.SetWriteDeadline(time.Now().Add(sender.writeTimeout)); err != nil {
+		return err
+	}
+	return connection.WriteMessage(messageType, data)
+}
+
+// pingPeriodically pings the api server until the connection breaks, the connection is closed when a ping can't be
+// written so the reads fail right away instead of at the pong timeout
+func (sender *TappedEntrySender) pingPeriodically(connection *websocket.Conn, disconnected <-chan struct{}) {
+	ticker := time.NewTicker(sender.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(sender.writeTimeout)); err != nil {
+				logger.Log.Warningf("error pinging the api server, err: %v", err)
+				connection.Close()
+				return
+			}
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// readAcks returns a channel closed once the connection breaks, including when neither a message nor a pong arrived
+// within the pong timeout of the last expected ping
+func (sender *TappedEntrySender) readAcks(connection *websocket.Conn) chan struct{} {
+	disconnected := make(chan struct{})
+	extendReadDeadline := func() error {
+		return connection.SetReadDeadline(time.Now().Add(sender.pingInterval + sender.pongTimeout))
+	}
+	extendReadDeadline()
+	connection.SetPongHandler(func(string) error { return extendReadDeadline() })
+	go func() {
+		defer close(disconnected)
+		for {
+			_, message, err := connection.ReadMessage()
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					logger.Log.Warningf("The api server didn't answer the pings for %v, reconnecting", sender.pingInterval+sender.pongTimeout)
+				}
+				return
+			}
+			extendReadDeadline()
+			var handshakeMessage shared.WebSocketSchemaHandshakeMessage
+			if err := json.Unmarshal(message, &handshakeMessage); err == nil && handshakeMessage.WebSocketMessageMetadata != nil && handshakeMessage.MessageType == shared.WebSocketMessageTypeSchemaHandshake {
+				if !handshakeMessage.HasCompatibleSchemaVersion() {
+					logger.Log.Warningf("The api server supports the message schema versions %v, this tapper sends the version %d", handshakeMessage.SupportedVersions, shared.WebSocketSchemaVersion)
+				}
+				continue
+			}
+			var ackMessage models.WebSocketTappedEntryAckMessage
+			if err := json.Unmarshal(message, &ackMessage); err != nil || ackMessage.WebSocketMessageMetadata == nil || ackMessage.MessageType != shared.WebSocketMessageTypeTappedEntryAck || ackMessage.Data == nil {
+				continue
+			}
+			sender.unacked.ack(ackMessage.Data.Sequence)
+		}
+	}()
+	return disconnected
+}
+
+// reconnect replaces the connection and resends the unacknowledged entries over it, it returns whether the channel
+// was closed during the reconnection
+func (sender *TappedEntrySender) reconnect(messageDataChannel <-chan *tapApi.OutputChannelItem) bool {
+	interruptedAt := time.Now()
+	stopBuffering := make(chan struct{})
+	buffered := sender.bufferEntries(messageDataChannel, stopBuffering)
+	isChannelClosed := false
+	for {
+		sender.connection.Close()
+		providers.SocketReconnectionAttempted()
+		connection, err := sender.dial()
+		if err != nil {
+			logger.Log.Fatalf("error reestablishing socket connection: %v", err)
+		}
+		logger.Log.Info("recovered connection successfully")
+		sender.setConnection(connection)
+		sender.notifyStreamInterruption(connection, interruptedAt, time.Now())
+
+		// the buffered entries are the newest unacknowledged ones, so they're resent last
+		if stopBuffering != nil {
+			close(stopBuffering)
+			isChannelClosed = <-buffered
+			stopBuffering = nil
+		}
+		if err := sender.resend(); err != nil {
+			logger.Log.Errorf("error resending unacknowledged entries through socket server, err: %v", err)
+			continue
+		}
+		return isChannelClosed
+	}
+}
+
+// bufferEntries keeps the entries of the channel as unacknowledged until it's stopped, the returned channel tells
+// whether the entries channel was closed
+func (sender *TappedEntrySender) bufferEntries(messageDataChannel <-chan *tapApi.OutputChannelItem, stop <-chan struct{}) <-chan bool {
+	buffered := make(chan bool, 1)
+	go func() {
+		for {
+			select {
+			case messageData, ok := <-messageDataChannel:
+				if !ok {
+					<-stop
+					buffered <- true
+					return
+				}
+				sender.unacked.add(messageData)
+			case <-stop:
+				buffered <- false
+				return
+			}
+		}
+	}()
+	return buffered
+}
+
+func (sender *TappedEntrySender) resend() error {
+	pending := sender.unacked.pending()
+	if len(pending) > 0 {
+		logger.Log.Infof("Resending %d unacknowledged entries", len(pending))
+	}
+	for _, entry := range pending {
+		if err := sender.send(entry.sequence, entry.item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lets the API server (and through it the browser clients) know that the entries tapped during the reconnection arrive late
+func (sender *TappedEntrySender) notifyStreamInterruption(connection *websocket.Conn, interruptedAt time.Time, resumedAt time.Time) {
+	marshaledData, err := models.CreateWebsocketStreamInterruptionMessage(interruptedAt, resumedAt)
+	if err != nil {
+		logger.Log.Errorf("error converting stream interruption to json, err: %v", err)
+		return
+	}
+
+	if err := sender.write(connection, websocket.TextMessage, marshaledData); err != nil {
+		logger.Log.Errorf("error sending stream interruption through socket server, err: %v", err)
+	}
+}
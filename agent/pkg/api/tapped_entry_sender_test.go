@@ -0,0 +1,344 @@
+package api_test
+
+import (
+	"mizuserver/pkg/api"
+	"mizuserver/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// startFakeApiServer returns the address of a server handing over every tapper connection it accepts
+func startFakeApiServer(t *testing.T) (string, <-chan *websocket.Conn) {
+	connections := make(chan *websocket.Conn, 10)
+	upgrader := websocket.Upgrader{Subprotocols: []string{models.JsonSubprotocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connection, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		connections <- connection
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), connections
+}
+
+// startTestSender starts a sender whose reconnections wait for the redial gate to be closed, unless it's nil
+func startTestSender(t *testing.T, maxUnackedEntries int, redialGate <-chan struct{}, keepaliveConfig *shared.SocketKeepaliveConfig) (*api.TappedEntrySender, chan<- *tapApi.OutputChannelItem, <-chan *websocket.Conn) {
+	address, connections := startFakeApiServer(t)
+	dialCount := 0
+	dial := func() (*websocket.Conn, error) {
+		dialCount++
+		if dialCount > 1 && redialGate != nil {
+			<-redialGate
+		}
+		dialer := &websocket.Dialer{Subprotocols: models.GetSubprotocols(models.MessageEncodingJson)}
+		connection, _, err := dialer.Dial(address, nil)
+		return connection, err
+	}
+	connection, err := dial()
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	sender := api.NewTappedEntrySender(dial, maxUnackedEntries)
+	sender.SetKeepalive(keepaliveConfig)
+	items := make(chan *tapApi.OutputChannelItem)
+	done := make(chan struct{})
+	go func() {
+		sender.Run(connection, items)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(items)
+		<-done
+	})
+	return sender, items, connections
+}
+
+func acceptConnection(t *testing.T, connections <-chan *websocket.Conn) *websocket.Conn {
+	select {
+	case connection := <-connections:
+		t.Cleanup(func() { connection.Close() })
+		return connection
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tapper didn't connect")
+		return nil
+	}
+}
+
+// readTappedEntry skips the other messages, such as the stream interruption sent after a reconnection
+func readTappedEntry(t *testing.T, connection *websocket.Conn) *models.WebSocketTappedEntryMessage {
+	connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, message, err := connection.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read tapped entry: %v", err)
+		}
+		tappedEntryMessage, err := models.DecodeWebsocketTappedEntryMessage(message, models.MessageEncodingJson)
+		if err == nil && tappedEntryMessage.WebSocketMessageMetadata != nil && tappedEntryMessage.MessageType == shared.WebSocketMessageTypeTappedEntry {
+			return tappedEntryMessage
+		}
+	}
+}
+
+func waitForUnackedCount(t *testing.T, sender *api.TappedEntrySender, expected int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for sender.UnackedCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", expected, sender.UnackedCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTappedEntrySenderResendsAfterCrash(t *testing.T) {
+	sender, items, connections := startTestSender(t, 10, nil, nil)
+	items <- &tapApi.OutputChannelItem{Protocol: tapApi.Protocol{Name: "http"}, Timestamp: 1600000000000}
+
+	// the api server crashes after the entry was written to its socket
+	crashedConnection := acceptConnection(t, connections)
+	sent := readTappedEntry(t, crashedConnection)
+	crashedConnection.Close()
+
+	restartedConnection := acceptConnection(t, connections)
+	resent := readTappedEntry(t, restartedConnection)
+	if resent.Sequence != sent.Sequence || resent.Data.Timestamp != 1600000000000 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", sent.Sequence, resent.Sequence, resent.Data.Timestamp)
+	}
+	if count := sender.UnackedCount(); count != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, count)
+	}
+
+	ack, _ := models.CreateWebsocketTappedEntryAckMessage(resent.Sequence)
+	if err := restartedConnection.WriteMessage(websocket.TextMessage, ack); err != nil {
+		t.Fatalf("failed to write ack: %v", err)
+	}
+	waitForUnackedCount(t, sender, 0)
+}
+
+func TestTappedEntrySenderBoundsUnacked(t *testing.T) {
+	sender, items, connections := startTestSender(t, 2, nil, nil)
+	connection := acceptConnection(t, connections)
+
+	var sequences []uint64
+	for i := int64(1); i <= 3; i++ {
+		items <- &tapApi.OutputChannelItem{Timestamp: i}
+		sequences = append(sequences, readTappedEntry(t, connection).Sequence)
+	}
+	if count := sender.UnackedCount(); count != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, count)
+	}
+
+	// only the newest entries are resent, in order
+	connection.Close()
+	restartedConnection := acceptConnection(t, connections)
+	for _, expectedSequence := range sequences[1:] {
+		if resent := readTappedEntry(t, restartedConnection); resent.Sequence != expectedSequence {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expectedSequence, resent.Sequence)
+		}
+	}
+}
+
+func TestTappedEntrySenderBuffersWhileReconnecting(t *testing.T) {
+	redialGate := make(chan struct{})
+	sender, items, connections := startTestSender(t, 100, redialGate, nil)
+	connection := acceptConnection(t, connections)
+	for i := int64(1); i <= 3; i++ {
+		items <- &tapApi.OutputChannelItem{Timestamp: i}
+		readTappedEntry(t, connection)
+	}
+
+	// the entries tapped while the api server is unreachable are buffered
+	connection.Close()
+	for i := int64(4); i <= 6; i++ {
+		items <- &tapApi.OutputChannelItem{Timestamp: i}
+	}
+	waitForUnackedCount(t, sender, 6)
+	close(redialGate)
+	restartedConnection := acceptConnection(t, connections)
+	for i := int64(7); i <= 8; i++ {
+		items <- &tapApi.OutputChannelItem{Timestamp: i}
+	}
+
+	var lastSequence uint64
+	for expectedTimestamp := int64(1); expectedTimestamp <= 8; expectedTimestamp++ {
+		entry := readTappedEntry(t, restartedConnection)
+		if entry.Data.Timestamp != expectedTimestamp || entry.Sequence <= lastSequence {
+			t.Fatalf("unexpected result - expected: %v, actual: %v (sequence %v)", expectedTimestamp, entry.Data.Timestamp, entry.Sequence)
+		}
+		lastSequence = entry.Sequence
+	}
+	if dropped := sender.DroppedCount(); dropped != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, dropped)
+	}
+}
+
+func TestTappedEntrySenderDropsOldestWhenFull(t *testing.T) {
+	redialGate := make(chan struct{})
+	sender, items, connections := startTestSender(t, 3, redialGate, nil)
+	connection := acceptConnection(t, connections)
+	items <- &tapApi.OutputChannelItem{Timestamp: 1}
+	readTappedEntry(t, connection)
+
+	connection.Close()
+	for i := int64(2); i <= 5; i++ {
+		items <- &tapApi.OutputChannelItem{Timestamp: i}
+	}
+	waitForUnackedCount(t, sender, 3)
+	close(redialGate)
+
+	restartedConnection := acceptConnection(t, connections)
+	for expectedTimestamp := int64(3); expectedTimestamp <= 5; expectedTimestamp++ {
+		if entry := readTappedEntry(t, restartedConnection); entry.Data.Timestamp != expectedTimestamp {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expectedTimestamp, entry.Data.Timestamp)
+		}
+	}
+	if dropped := sender.DroppedCount(); dropped != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, dropped)
+	}
+}
+
+func TestTappedEntrySenderSendsCloseFrame(t *testing.T) {
+	address, connections := startFakeApiServer(t)
+	dialer := &websocket.Dialer{Subprotocols: models.GetSubprotocols(models.MessageEncodingJson)}
+	connection, _, err := dialer.Dial(address, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	sender := api.NewTappedEntrySender(nil, 0)
+	items := make(chan *tapApi.OutputChannelItem)
+	done := make(chan struct{})
+	go func() {
+		sender.Run(connection, items)
+		close(done)
+	}()
+	serverConnection := acceptConnection(t, connections)
+	close(items)
+
+	serverConnection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, handshake, err := serverConnection.ReadMessage()
+	if err != nil || !strings.Contains(string(handshake), string(shared.WebSocketMessageTypeSchemaHandshake)) {
+		t.Errorf("unexpected result - expected: %v, actual: %s %v", shared.WebSocketMessageTypeSchemaHandshake, handshake, err)
+	}
+	_, _, err = serverConnection.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", websocket.CloseNormalClosure, err)
+	}
+	<-done
+}
+
+func TestTappedEntrySenderCountsSentEntries(t *testing.T) {
+	address, connections := startFakeApiServer(t)
+	stats := &api.CompressionStats{}
+	dialer := &websocket.Dialer{Subprotocols: models.GetSubprotocols(models.MessageEncodingJson), NetDialContext: stats.DialContext}
+	connection, _, err := dialer.Dial(address, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	sender := api.NewTappedEntrySender(nil, 0)
+	sender.SetCompressionStats(stats)
+	items := make(chan *tapApi.OutputChannelItem)
+	done := make(chan struct{})
+	go func() {
+		sender.Run(connection, items)
+		close(done)
+	}()
+	serverConnection := acceptConnection(t, connections)
+
+	item := &tapApi.OutputChannelItem{Timestamp: 1}
+	items <- item
+	readTappedEntry(t, serverConnection)
+	close(items)
+	<-done
+
+	expected, _ := models.CreateWebsocketTappedEntryMessage(item, 1, models.MessageEncodingJson)
+	messageBytes, wireBytes := stats.GetTotals()
+	if messageBytes != uint64(len(expected)) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", len(expected), messageBytes)
+	}
+	// the frames aren't compressed, every byte of the entry is written along with the frame headers
+	if wireBytes <= messageBytes {
+		t.Errorf("unexpected result - expected: more than %v, actual: %v", messageBytes, wireBytes)
+	}
+}
+
+func expectReconnection(t *testing.T, connections <-chan *websocket.Conn, timeout time.Duration) *websocket.Conn {
+	select {
+	case connection := <-connections:
+		t.Cleanup(func() { connection.Close() })
+		return connection
+	case <-time.After(timeout):
+		t.Fatal("the tapper didn't reconnect")
+		return nil
+	}
+}
+
+func TestTappedEntrySenderWriteTimeout(t *testing.T) {
+	_, items, connections := startTestSender(t, 2, nil, &shared.SocketKeepaliveConfig{WriteTimeoutMs: 200, PingIntervalMs: 3600000})
+	stop := make(chan struct{})
+	sent := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+		<-sent
+	})
+
+	// the api server stops reading, the large entries fill the socket buffers until a write blocks
+	stuckConnection := acceptConnection(t, connections)
+	go func() {
+		defer close(sent)
+		payload := strings.Repeat("x", 1024*1024)
+		for i := int64(1); ; i++ {
+			select {
+			case items <- &tapApi.OutputChannelItem{Timestamp: i, Pair: &tapApi.RequestResponsePair{Request: tapApi.GenericMessage{Payload: payload}}}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	restartedConnection := expectReconnection(t, connections, 10*time.Second)
+	stuckConnection.Close()
+	// the entries the stuck connection didn't get to acknowledge are resent
+	if entry := readTappedEntry(t, restartedConnection); entry.Data.Timestamp == 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a resent entry", entry.Data.Timestamp)
+	}
+}
+
+func TestTappedEntrySenderPongTimeout(t *testing.T) {
+	_, _, connections := startTestSender(t, 10, nil, &shared.SocketKeepaliveConfig{PingIntervalMs: 50, PongTimeoutMs: 100})
+
+	// the api server never reads the connection, so the pings aren't answered
+	acceptConnection(t, connections)
+	expectReconnection(t, connections, 5*time.Second)
+}
+
+func TestTappedEntrySenderAnsweredPings(t *testing.T) {
+	_, _, connections := startTestSender(t, 10, nil, &shared.SocketKeepaliveConfig{PingIntervalMs: 50, PongTimeoutMs: 100})
+
+	// reading the connection answers the pings
+	answeringConnection := acceptConnection(t, connections)
+	go func() {
+		for {
+			if _, _, err := answeringConnection.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-connections:
+		t.Fatal("the tapper reconnected while the api server answered the pings")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -18,23 +18,29 @@ const (
 
 var Config *shared.MizuAgentConfig
 
-func LoadConfig() error {
+// LoadConfig reads the config from filePath, or from the default config path when filePath is empty. Only a missing
+// file at the default path falls back to the default config.
+func LoadConfig(filePath string) error {
 	if Config != nil {
 		return nil
 	}
-	filePath := fmt.Sprintf("%s%s", shared.ConfigDirPath, shared.ConfigFileName)
+	if filePath == "" {
+		filePath = fmt.Sprintf("%s%s", shared.ConfigDirPath, shared.ConfigFileName)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return applyDefaultConfig()
+		}
+	}
 
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return applyDefaultConfig()
-		}
-		return err
+		return fmt.Errorf("config file %s can't be read: %v", filePath, err)
 	}
 
-	if err = json.Unmarshal(content, &Config); err != nil {
-		return err
+	var loadedConfig *shared.MizuAgentConfig
+	if err = json.Unmarshal(content, &loadedConfig); err != nil {
+		return fmt.Errorf("config file %s is malformed: %v", filePath, err)
 	}
+	Config = loadedConfig
 	return nil
 }
 
@@ -0,0 +1,67 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/config"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	directory, err := ioutil.TempDir("", "mizu-config-test")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	filePath := path.Join(directory, "config.json")
+	if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return filePath
+}
+
+func resetConfig(t *testing.T) {
+	config.Config = nil
+	t.Cleanup(func() { config.Config = nil })
+}
+
+func TestLoadConfigOverride(t *testing.T) {
+	resetConfig(t)
+	filePath := writeTestConfigFile(t, `{"maxDBSizeBytes": 1000, "agentDatabasePath": "/tmp/override"}`)
+
+	if err := config.LoadConfig(filePath); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if config.Config.MaxDBSizeBytes != 1000 || config.Config.AgentDatabasePath != "/tmp/override" {
+		t.Errorf("unexpected result - expected: %v %v, actual: %v %v", 1000, "/tmp/override", config.Config.MaxDBSizeBytes, config.Config.AgentDatabasePath)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		filePath      string
+		expectedError string
+	}{
+		{name: "missing file", filePath: path.Join(os.TempDir(), "missing-mizu-config.json"), expectedError: "can't be read"},
+		{name: "directory", filePath: os.TempDir(), expectedError: "can't be read"},
+		{name: "malformed file", filePath: writeTestConfigFile(t, `{"maxDBSizeBytes": `), expectedError: "is malformed"},
+		{name: "invalid field type", filePath: writeTestConfigFile(t, `{"maxDBSizeBytes": "large"}`), expectedError: "is malformed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t)
+			err := config.LoadConfig(test.filePath)
+			if err == nil || !strings.Contains(err.Error(), test.filePath) || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedError, err)
+			}
+			if config.Config != nil {
+				t.Errorf("unexpected result - expected: %v, actual: %v", nil, config.Config)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+const (
+	redactedValue    = "[REDACTED]"
+	redactedUserInfo = "REDACTED" // brackets would be escaped in the user info of urls
+)
+
+// RuntimeFlags are the flags deciding the mode of the process, main sets them once the flags are parsed
+type RuntimeFlags struct {
+	TapperMode       bool     `json:"tapperMode"`
+	ApiServerMode    bool     `json:"apiServerMode"`
+	StandaloneMode   bool     `json:"standaloneMode"`
+	HarsReaderMode   bool     `json:"harsReaderMode"`
+	PcapReaderMode   bool     `json:"pcapReaderMode"`
+	Namespaces       []string `json:"namespaces"`
+	HarsDir          string   `json:"harsDir"`
+	PcapDir          string   `json:"pcapDir"`
+	PcapFile         string   `json:"pcapFile"`
+	ApiServerAddress string   `json:"apiServerAddress"`
+	Output           string   `json:"output"`
+}
+
+var Flags RuntimeFlags
+
+// EffectiveConfig is the config the process runs with, after the overrides of the env vars and the flags
+type EffectiveConfig struct {
+	Flags       RuntimeFlags              `json:"flags"`
+	Config      *shared.MizuAgentConfig   `json:"config"`
+	SyncEntries *shared.SyncEntriesConfig `json:"syncEntries"` // nil unless syncing the entries to up9 is configured
+}
+
+// GetEffectiveConfig returns a copy of the effective config with the tokens and the credentials of urls redacted
+func GetEffectiveConfig() *EffectiveConfig {
+	effectiveConfig := &EffectiveConfig{Flags: Flags}
+
+	if Config != nil {
+		redactedConfig := *Config
+		redactedConfig.AdminToken = redactString(redactedConfig.AdminToken)
+		redactedConfig.WebSocketToken = redactString(redactedConfig.WebSocketToken)
+		if redactedConfig.OutboundProxy != nil {
+			outboundProxy := *redactedConfig.OutboundProxy
+			outboundProxy.HttpProxy = redactUrlCredentials(outboundProxy.HttpProxy)
+			outboundProxy.HttpsProxy = redactUrlCredentials(outboundProxy.HttpsProxy)
+			redactedConfig.OutboundProxy = &outboundProxy
+		}
+		if redactedConfig.Pushgateway != nil {
+			pushgateway := *redactedConfig.Pushgateway
+			pushgateway.Url = redactUrlCredentials(pushgateway.Url)
+			redactedConfig.Pushgateway = &pushgateway
+		}
+		effectiveConfig.Config = &redactedConfig
+	}
+
+	// like the auth status, an invalid sync entries config is reported by the sync itself
+	if syncEntriesConfigJson := os.Getenv(shared.SyncEntriesConfigEnvVar); syncEntriesConfigJson != "" {
+		syncEntriesConfig := &shared.SyncEntriesConfig{}
+		if err := json.Unmarshal([]byte(syncEntriesConfigJson), syncEntriesConfig); err == nil {
+			syncEntriesConfig.Token = redactString(syncEntriesConfig.Token)
+			effectiveConfig.SyncEntries = syncEntriesConfig
+		}
+	}
+
+	return effectiveConfig
+}
+
+// redactString keeps empty values so it's still visible whether they're set
+func redactString(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+func redactUrlCredentials(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		// an unparsable url may still hold credentials
+		return redactString(rawUrl)
+	}
+	if parsedUrl.User == nil {
+		return rawUrl
+	}
+	parsedUrl.User = url.User(redactedUserInfo)
+	return parsedUrl.String()
+}
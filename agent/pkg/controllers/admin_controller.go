@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/holder"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/validation"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/op/go-logging"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+func GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, models.LogLevelResponse{Level: logging.GetLevel("").String()})
+}
+
+func SetLogLevel(c *gin.Context) {
+	logLevelRequest := &models.LogLevelRequest{}
+	if err := c.Bind(logLevelRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.Validate(logLevelRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	level, err := logging.LogLevel(logLevelRequest.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": true,
+			"msg":   err.Error(),
+		})
+		return
+	}
+
+	logging.SetLevel(level, "")
+	logger.Log.Infof("[Admin] log level changed to %s", level)
+	c.JSON(http.StatusOK, models.LogLevelResponse{Level: level.String()})
+}
+
+func ResetFirstSeenEndpoints(c *gin.Context) {
+	clearedCount := filtering.FirstSeen.Reset()
+	logger.Log.Infof("[Admin] reset %d first seen endpoints", clearedCount)
+	c.JSON(http.StatusOK, map[string]int{"clearedEndpoints": clearedCount})
+}
+
+func RefreshResolver(c *gin.Context) {
+	k8sResolver := holder.GetResolver()
+	if k8sResolver == nil {
+		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error": true,
+			"msg":   "resolver is not running",
+		})
+		return
+	}
+
+	resolvedCount, err := k8sResolver.Refresh(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": true,
+			"msg":   err.Error(),
+		})
+		return
+	}
+
+	logger.Log.Infof("[Admin] refreshed resolver, %d names resolved", resolvedCount)
+	c.JSON(http.StatusOK, map[string]int{"resolvedEntries": resolvedCount})
+}
+
+func GetResolverCache(c *gin.Context) {
+	k8sResolver := holder.GetResolver()
+	if k8sResolver == nil {
+		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error": true,
+			"msg":   "resolver is not running",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, k8sResolver.GetCacheInfo())
+}
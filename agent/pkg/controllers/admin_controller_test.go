@@ -0,0 +1,182 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/holder"
+	"mizuserver/pkg/resolver"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/op/go-logging"
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testAdminToken = "test-admin-token"
+
+func newAdminTestApp() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	config.Config = &shared.MizuAgentConfig{AdminToken: testAdminToken}
+
+	app := gin.New()
+	routes.AdminRoutes(app)
+	return app
+}
+
+func doAdminRequest(app *gin.Engine, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestSetLogLevelAffectsEmittedLogs(t *testing.T) {
+	app := newAdminTestApp()
+
+	var logOutput bytes.Buffer
+	logging.SetBackend(logging.NewLogBackend(&logOutput, "", 0))
+	t.Cleanup(func() { logging.SetLevel(logging.INFO, "") })
+
+	tests := []struct {
+		level          string
+		shouldBeLogged bool
+	}{
+		{level: "error", shouldBeLogged: false},
+		{level: "DEBUG", shouldBeLogged: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.level, func(t *testing.T) {
+			response := doAdminRequest(app, http.MethodPost, "/admin/loglevel", `{"level": "`+test.level+`"}`, testAdminToken)
+			if response.Code != http.StatusOK {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, response.Code)
+			}
+
+			logOutput.Reset()
+			logger.Log.Debug("debug message")
+			if logged := strings.Contains(logOutput.String(), "debug message"); logged != test.shouldBeLogged {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.shouldBeLogged, logged)
+			}
+
+			getResponse := doAdminRequest(app, http.MethodGet, "/admin/loglevel", "", testAdminToken)
+			expectedBody := `{"level":"` + strings.ToUpper(test.level) + `"}`
+			if getResponse.Body.String() != expectedBody {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedBody, getResponse.Body.String())
+			}
+		})
+	}
+}
+
+func TestSetLogLevelInvalid(t *testing.T) {
+	app := newAdminTestApp()
+
+	tests := []string{`{"level": "verbose"}`, `{}`}
+
+	for _, body := range tests {
+		t.Run(body, func(t *testing.T) {
+			response := doAdminRequest(app, http.MethodPost, "/admin/loglevel", body, testAdminToken)
+			if response.Code != http.StatusBadRequest {
+				t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusBadRequest, response.Code)
+			}
+		})
+	}
+}
+
+func TestLogLevelRequiresAdminToken(t *testing.T) {
+	app := newAdminTestApp()
+
+	tests := map[string]int{
+		"":             http.StatusUnauthorized,
+		"wrong-token":  http.StatusUnauthorized,
+		testAdminToken: http.StatusOK,
+	}
+
+	for token, expectedCode := range tests {
+		t.Run(token, func(t *testing.T) {
+			response := doAdminRequest(app, http.MethodGet, "/admin/loglevel", "", token)
+			if response.Code != expectedCode {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestRefreshResolver(t *testing.T) {
+	app := newAdminTestApp()
+	t.Cleanup(func() { holder.SetResolver(nil) })
+
+	holder.SetResolver(nil)
+	if response := doAdminRequest(app, http.MethodPost, "/admin/resolver/refresh", "", testAdminToken); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusServiceUnavailable, response.Code)
+	}
+
+	clientSet := fake.NewSimpleClientset()
+	holder.SetResolver(resolver.NewFromClientSet(clientSet, make(chan error), ""))
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "carts", Namespace: "shop"},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.244.0.5"}}}},
+	}
+	if _, err := clientSet.CoreV1().Endpoints("shop").Create(context.Background(), endpoints, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed creating endpoints: %v", err)
+	}
+
+	if response := doAdminRequest(app, http.MethodPost, "/admin/resolver/refresh", "", ""); response.Code != http.StatusUnauthorized {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusUnauthorized, response.Code)
+	}
+
+	response := doAdminRequest(app, http.MethodPost, "/admin/resolver/refresh", "", testAdminToken)
+	expectedBody := `{"resolvedEntries":1}`
+	if response.Code != http.StatusOK || response.Body.String() != expectedBody {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", expectedBody, response.Code, response.Body.String())
+	}
+	if resolved := holder.GetResolver().Resolve("10.244.0.5"); resolved != "carts.shop" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "carts.shop", resolved)
+	}
+}
+
+func TestGetResolverCache(t *testing.T) {
+	app := newAdminTestApp()
+	t.Cleanup(func() { holder.SetResolver(nil) })
+
+	holder.SetResolver(nil)
+	if response := doAdminRequest(app, http.MethodGet, "/admin/resolver/cache", "", testAdminToken); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusServiceUnavailable, response.Code)
+	}
+
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "carts", Namespace: "shop"},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.244.0.5"}}}},
+	}
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(endpoints), make(chan error), "shop")
+	if _, err := k8sResolver.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+	holder.SetResolver(k8sResolver)
+	k8sResolver.Resolve("10.244.0.5")
+
+	response := doAdminRequest(app, http.MethodGet, "/admin/resolver/cache", "", testAdminToken)
+	if response.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, response.Code)
+	}
+	var cacheInfo resolver.CacheInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &cacheInfo); err != nil {
+		t.Fatalf("failed to unmarshal the cache: %v", err)
+	}
+	if len(cacheInfo.Namespaces) != 1 || cacheInfo.Namespaces[0] != "shop" || cacheInfo.Hits != 1 || len(cacheInfo.Entries) != 1 || cacheInfo.Entries[0].Name != "carts.shop" {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "carts.shop resolved once", cacheInfo)
+	}
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/validation"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+func GetSampleRate(c *gin.Context) {
+	if !filtering.IsEndpointSamplingRunning() {
+		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error": true,
+			"msg":   "sampling is not running",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.SampleRateResponse{Rate: filtering.GetDefaultSampleRate()})
+}
+
+// SetSampleRate changes the default rate of the endpoint sampler, paths with a configured rate keep it
+func SetSampleRate(c *gin.Context) {
+	if !filtering.IsEndpointSamplingRunning() {
+		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error": true,
+			"msg":   "sampling is not running",
+		})
+		return
+	}
+
+	sampleRateRequest := &models.SampleRateRequest{}
+	if err := c.Bind(sampleRateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.Validate(sampleRateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	if err := filtering.SetDefaultSampleRate(*sampleRateRequest.Rate); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": true,
+			"msg":   err.Error(),
+		})
+		return
+	}
+
+	logger.Log.Infof("[Capture] sample rate changed to %v", *sampleRateRequest.Rate)
+	c.JSON(http.StatusOK, models.SampleRateResponse{Rate: *sampleRateRequest.Rate})
+}
@@ -0,0 +1,115 @@
+package controllers_test
+
+import (
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared"
+)
+
+func newCaptureTestApp(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	config.Config = &shared.MizuAgentConfig{AdminToken: testAdminToken}
+	filtering.StartEndpointSampling(nil)
+	t.Cleanup(filtering.StopEndpointSampling)
+
+	app := gin.New()
+	routes.CaptureRoutes(app)
+	return app
+}
+
+func countKept(sampler *filtering.EndpointSampler, path string, count int) int {
+	kept := 0
+	for i := 0; i < count; i++ {
+		if sampler.ShouldKeep(path) {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestSetSampleRateAffectsNextEntries(t *testing.T) {
+	app := newCaptureTestApp(t)
+	// the sampler is only created once the rate is set through the api
+	if sampler := filtering.GetActiveEndpointSampler(); sampler != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, sampler)
+	}
+
+	tests := []struct {
+		rate         string
+		expectedKept int
+	}{
+		{rate: "0.25", expectedKept: 25},
+		{rate: "0", expectedKept: 0},
+		{rate: "1", expectedKept: 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rate, func(t *testing.T) {
+			response := doAdminRequest(app, http.MethodPost, "/capture/sample-rate", `{"rate": `+test.rate+`}`, testAdminToken)
+			if response.Code != http.StatusOK {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, response.Code)
+			}
+
+			getResponse := doAdminRequest(app, http.MethodGet, "/capture/sample-rate", "", "")
+			if expectedBody := `{"rate":` + test.rate + `}`; getResponse.Body.String() != expectedBody {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedBody, getResponse.Body.String())
+			}
+			// a whole entry may have been accumulated before the change
+			if kept := countKept(filtering.GetActiveEndpointSampler(), "/orders", 100); kept < test.expectedKept || kept > test.expectedKept+1 {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedKept, kept)
+			}
+		})
+	}
+}
+
+func TestSetSampleRateRejected(t *testing.T) {
+	app := newCaptureTestApp(t)
+
+	tests := []struct {
+		name         string
+		body         string
+		token        string
+		expectedCode int
+	}{
+		{name: "no token", body: `{"rate": 0.5}`, expectedCode: http.StatusUnauthorized},
+		{name: "above 1", body: `{"rate": 1.5}`, token: testAdminToken, expectedCode: http.StatusBadRequest},
+		{name: "negative", body: `{"rate": -0.1}`, token: testAdminToken, expectedCode: http.StatusBadRequest},
+		{name: "missing rate", body: `{}`, token: testAdminToken, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := doAdminRequest(app, http.MethodPost, "/capture/sample-rate", test.body, test.token)
+			if response.Code != test.expectedCode {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedCode, response.Code)
+			}
+		})
+	}
+
+	if rate := filtering.GetDefaultSampleRate(); rate != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, rate)
+	}
+	if sampler := filtering.GetActiveEndpointSampler(); sampler != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, sampler)
+	}
+}
+
+func TestSampleRateSamplingNotRunning(t *testing.T) {
+	app := newCaptureTestApp(t)
+	filtering.StopEndpointSampling()
+
+	if response := doAdminRequest(app, http.MethodGet, "/capture/sample-rate", "", ""); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusServiceUnavailable, response.Code)
+	}
+	if response := doAdminRequest(app, http.MethodPost, "/capture/sample-rate", `{"rate": 0.5}`, testAdminToken); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusServiceUnavailable, response.Code)
+	}
+	if sampler := filtering.GetActiveEndpointSampler(); sampler != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, sampler)
+	}
+}
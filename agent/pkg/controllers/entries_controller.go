@@ -1,21 +1,32 @@
 package controllers
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared/logger"
 	tapApi "github.com/up9inc/mizu/tap/api"
+	"io"
+	"mizuserver/pkg/config"
 	"mizuserver/pkg/database"
+	"mizuserver/pkg/filterExpression"
+	"mizuserver/pkg/holder"
 	"mizuserver/pkg/models"
 	"mizuserver/pkg/utils"
 	"mizuserver/pkg/validation"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var extensionsMap map[string]*tapApi.Extension // global
+const exportEntriesPageSize = 500
 
+// InitExtensionsMap replaces the extensions the controllers read, the readers see either the old or the new map
 func InitExtensionsMap(ref map[string]*tapApi.Extension) {
-	extensionsMap = ref
+	holder.SetExtensionsMap(ref)
 }
 
 func GetEntries(c *gin.Context) {
@@ -23,20 +34,47 @@ func GetEntries(c *gin.Context) {
 
 	if err := c.BindQuery(entriesFilter); err != nil {
 		c.JSON(http.StatusBadRequest, err)
+		return
 	}
 	err := validation.Validate(entriesFilter)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err)
+		return
 	}
 
+	ctx, cancel := getQueryContext(c)
+	defer cancel()
+
 	order := database.OperatorToOrderMapping[entriesFilter.Operator]
 	operatorSymbol := database.OperatorToSymbolMapping[entriesFilter.Operator]
-	var entries []tapApi.MizuEntry
-	database.GetEntriesTable().
-		Order(fmt.Sprintf("timestamp %s", order)).
-		Where(fmt.Sprintf("timestamp %s %v", operatorSymbol, entriesFilter.Timestamp)).
-		Limit(entriesFilter.Limit).
-		Find(&entries)
+	lowercaseQueryParamNames := config.Config != nil && config.Config.QueryParams != nil && config.Config.QueryParams.LowercaseNames
+	query := &database.EntriesQuery{
+		Conditions: []database.Condition{
+			database.TimestampCondition(operatorSymbol, entriesFilter.Timestamp),
+			database.RequestSizeCondition(entriesFilter.MinRequestSize, entriesFilter.MaxRequestSize),
+			database.ResponseSizeCondition(entriesFilter.MinResponseSize, entriesFilter.MaxResponseSize),
+			database.QueryParamsCondition(entriesFilter.QueryParams, lowercaseQueryParamNames),
+		},
+		OrderBy: database.OrderByTimestamp,
+		Order:   order,
+		Limit:   entriesFilter.Limit,
+	}
+	if entriesFilter.Filter != "" {
+		expression, err := filterExpression.Parse(entriesFilter.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+			return
+		}
+		query.Conditions = append(query.Conditions, expression)
+	}
+	entries, queryErr := database.Entries.Find(ctx, query)
+	if ctx.Err() == context.DeadlineExceeded {
+		c.JSON(http.StatusGatewayTimeout, map[string]interface{}{"error": true, "msg": "entries query timed out"})
+		return
+	} else if queryErr != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": true, "msg": queryErr.Error()})
+		return
+	}
 
 	if len(entries) > 0 && order == database.OrderDesc {
 		// the entries always order from oldest to newest - we should reverse
@@ -58,20 +96,136 @@ func GetEntries(c *gin.Context) {
 			baseEntryDetails.Rules = rules
 		}
 
+		if entry.ProtocolName == "http" && config.Config != nil && config.Config.EntryPreviewBytes > 0 {
+			baseEntryDetails.Preview = getEntryPreview(&entry, config.Config.EntryPreviewBytes)
+		}
+
 		baseEntries = append(baseEntries, baseEntryDetails)
 	}
 
 	c.JSON(http.StatusOK, baseEntries)
 }
 
+// getQueryContext bounds the entries query by the request context and by the configured query timeout, if there is one
+func getQueryContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if config.Config != nil && config.Config.EntriesQueryTimeoutMs > 0 {
+		return context.WithTimeout(c.Request.Context(), time.Duration(config.Config.EntriesQueryTimeoutMs)*time.Millisecond)
+	}
+	return context.WithCancel(c.Request.Context())
+}
+
+// ExportEntries streams every stored entry as a json line, the entries at or after the optional since timestamp when
+// it's given. The entries are read a page at a time by their id so the database isn't locked for the whole export.
+func ExportEntries(c *gin.Context) {
+	since := int64(0)
+	if sinceParam := c.Query("since"); sinceParam != "" {
+		var err error
+		if since, err = strconv.ParseInt(sinceParam, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": fmt.Sprintf("invalid since %q", sinceParam)})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	var writer io.Writer = c.Writer
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Vary", "Accept-Encoding")
+		gzipWriter := gzip.NewWriter(c.Writer)
+		defer gzipWriter.Close()
+		writer = gzipWriter
+	}
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(writer)
+	lastId := uint(0)
+	for {
+		entries, err := database.Entries.Find(c.Request.Context(), &database.EntriesQuery{
+			Conditions: []database.Condition{database.IdAfterCondition(lastId), database.TimestampCondition(">=", since)},
+			OrderBy:    database.OrderById,
+			Limit:      exportEntriesPageSize,
+		})
+		if err != nil {
+			// the status was sent with the first entries, the export is cut short
+			logger.Log.Errorf("Failed exporting the entries after id %d: %v", lastId, err)
+			return
+		}
+		for i := range entries {
+			if err := encoder.Encode(&entries[i]); err != nil {
+				logger.Log.Debugf("Stopped exporting the entries: %v", err)
+				return
+			}
+		}
+		if len(entries) < exportEntriesPageSize {
+			return
+		}
+		lastId = entries[len(entries)-1].ID
+	}
+}
+
+func getEntryPreview(entry *tapApi.MizuEntry, previewBytes int) *tapApi.EntryPreview {
+	request, response, err := utils.GetHttpBodies(entry)
+	if err != nil {
+		return nil
+	}
+
+	preview := &tapApi.EntryPreview{}
+	preview.Request, preview.RequestTruncated = utils.TruncateUTF8(request.Data, previewBytes)
+	preview.Response, preview.ResponseTruncated = utils.TruncateUTF8(response.Data, previewBytes)
+	return preview
+}
+
+func GetEntryBody(c *gin.Context) {
+	entryData, err := database.Entries.FindByEntryId(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": fmt.Sprintf("entry %s not found", c.Param("entryId"))})
+		return
+	}
+	if entryData.ProtocolName != "http" {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": fmt.Sprintf("bodies of %s entries aren't supported", entryData.ProtocolName)})
+		return
+	}
+
+	request, response, err := utils.GetHttpBodies(entryData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+
+	var body *utils.EntryBody
+	switch c.Param("part") {
+	case "request":
+		body = request
+	case "response":
+		body = response
+	default:
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": "part must be either request or response"})
+		return
+	}
+
+	mimeType := body.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	// the body is downloaded and never rendered, a captured html or svg body would otherwise run in the origin of the UI
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s\"", entryData.EntryId, c.Param("part")))
+	c.Data(http.StatusOK, mimeType, body.Data)
+}
+
 func GetEntry(c *gin.Context) {
-	var entryData tapApi.MizuEntry
-	database.GetEntriesTable().
-		Where(map[string]string{"entryId": c.Param("entryId")}).
-		First(&entryData)
+	entryData, err := database.Entries.FindByEntryId(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": fmt.Sprintf("entry %s not found", c.Param("entryId"))})
+		return
+	}
 
-	extension := extensionsMap[entryData.ProtocolName]
-	protocol, representation, bodySize, _ := extension.Dissector.Represent(&entryData)
+	extension, ok := holder.GetExtensionsMap()[entryData.ProtocolName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": fmt.Sprintf("the %s extension isn't loaded", entryData.ProtocolName)})
+		return
+	}
+	protocol, representation, bodySize, _ := extension.Dissector.Represent(entryData)
 
 	var rules []map[string]interface{}
 	var isRulesEnabled bool
@@ -89,7 +243,7 @@ func GetEntry(c *gin.Context) {
 		Protocol:       protocol,
 		Representation: string(representation),
 		BodySize:       bodySize,
-		Data:           entryData,
+		Data:           *entryData,
 		Rules:          rules,
 		IsRulesEnabled: isRulesEnabled,
 	})
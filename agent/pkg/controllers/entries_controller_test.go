@@ -0,0 +1,468 @@
+package controllers_test
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/database"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+	"gorm.io/gorm"
+)
+
+var (
+	initDatabaseOnce sync.Once
+	testDatabaseDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testDatabaseDir != "" {
+		database.Close()
+		os.RemoveAll(testDatabaseDir)
+	}
+	os.Exit(code)
+}
+
+// the database is shared by the package tests since its size enforcer keeps watching the file it was initialized with,
+// TestMain removes it once they're done
+func initTestEntriesDatabase(t *testing.T, entries []tapApi.MizuEntry) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	initDatabaseOnce.Do(func() {
+		databaseDir, err := os.MkdirTemp("", "mizu-controllers-test")
+		if err != nil {
+			t.Fatalf("failed to create database dir: %v", err)
+		}
+		testDatabaseDir = databaseDir
+		database.InitDataBase(path.Join(databaseDir, "entries.db"))
+	})
+	database.GetEntriesTable().Where("1 = 1").Delete(&tapApi.MizuEntry{})
+	for i := range entries {
+		database.CreateEntry(&entries[i])
+	}
+
+	app := gin.New()
+	routes.EntriesRoutes(app)
+	return app
+}
+
+func getEntryIds(t *testing.T, app *gin.Engine, query string) []string {
+	req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1"+query, nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+
+	var baseEntries []tapApi.BaseEntryDetails
+	if err := json.Unmarshal(recorder.Body.Bytes(), &baseEntries); err != nil {
+		t.Fatalf("failed to unmarshal entries: %v", err)
+	}
+
+	ids := make([]string, 0)
+	for _, baseEntry := range baseEntries {
+		ids = append(ids, baseEntry.Id)
+	}
+	return ids
+}
+
+func TestGetEntriesSizeRange(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		{EntryId: "small", ProtocolName: "redis", Timestamp: 10, RequestSize: 10, ResponseSize: 5000},
+		{EntryId: "medium", ProtocolName: "redis", Timestamp: 20, RequestSize: 1000, ResponseSize: 500},
+		{EntryId: "large", ProtocolName: "redis", Timestamp: 30, RequestSize: 100000, ResponseSize: 50},
+	})
+
+	tests := []struct {
+		query       string
+		expectedIds []string
+	}{
+		{query: "", expectedIds: []string{"small", "medium", "large"}},
+		{query: "&minRequestSize=1000", expectedIds: []string{"medium", "large"}},
+		{query: "&maxRequestSize=1000", expectedIds: []string{"small", "medium"}},
+		{query: "&minRequestSize=11&maxRequestSize=99999", expectedIds: []string{"medium"}},
+		{query: "&minResponseSize=500", expectedIds: []string{"small", "medium"}},
+		{query: "&maxResponseSize=100", expectedIds: []string{"large"}},
+		{query: "&minRequestSize=1000&minResponseSize=100", expectedIds: []string{"medium"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			ids := getEntryIds(t, app, test.query)
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIds) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedIds, ids)
+			}
+		})
+	}
+}
+
+func TestGetEntriesPodLabels(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		{EntryId: "payments", ProtocolName: "redis", Timestamp: 10, DestinationLabels: tapApi.EntryLabels{"team": "payments", "env": "prod"}},
+		{EntryId: "shipping", ProtocolName: "redis", Timestamp: 20, SourceLabels: tapApi.EntryLabels{"team": "payments"}, DestinationLabels: tapApi.EntryLabels{"team": "shipping"}},
+		{EntryId: "unlabeled", ProtocolName: "redis", Timestamp: 30},
+	})
+
+	tests := []struct {
+		filter      string
+		expectedIds []string
+	}{
+		{filter: `destinationLabels.team == "payments"`, expectedIds: []string{"payments"}},
+		{filter: `sourceLabels.team == "payments" or destinationLabels.env == "prod"`, expectedIds: []string{"payments", "shipping"}},
+		{filter: `destinationLabels.team contains "ing"`, expectedIds: []string{"shipping"}},
+		{filter: `destinationLabels.env != "prod"`, expectedIds: []string{"shipping", "unlabeled"}},
+		{filter: `destinationLabels.tier == ""`, expectedIds: []string{"payments", "shipping", "unlabeled"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			ids := getEntryIds(t, app, "&filter="+url.QueryEscape(test.filter))
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIds) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedIds, ids)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	var baseEntries []tapApi.BaseEntryDetails
+	if err := json.Unmarshal(recorder.Body.Bytes(), &baseEntries); err != nil {
+		t.Fatalf("failed to unmarshal entries: %v", err)
+	}
+	expectedLabels := tapApi.EntryLabels{"team": "payments", "env": "prod"}
+	if len(baseEntries) != 3 || fmt.Sprint(baseEntries[0].DestinationLabels) != fmt.Sprint(expectedLabels) || baseEntries[2].DestinationLabels != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedLabels, baseEntries)
+	}
+}
+
+func TestGetEntriesPromotedHeaders(t *testing.T) {
+	acme := newTestHttpEntry("acme", 10, "", "", "")
+	acme.Fields = tapApi.EntryLabels{"tenantId": "acme", "requestId": "r-1"}
+	globex := newTestHttpEntry("globex", 20, "", "", "")
+	globex.Fields = tapApi.EntryLabels{"tenantId": "globex"}
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{acme, globex, newTestHttpEntry("anonymous", 30, "", "", "")})
+
+	tests := []struct {
+		filter      string
+		expectedIds []string
+	}{
+		{filter: `fields.tenantId == "acme"`, expectedIds: []string{"acme"}},
+		{filter: `fields.tenantId != "acme"`, expectedIds: []string{"globex", "anonymous"}},
+		{filter: `fields.tenantId == ""`, expectedIds: []string{"anonymous"}},
+		{filter: `fields.requestId contains "r-"`, expectedIds: []string{"acme"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			ids := getEntryIds(t, app, "&filter="+url.QueryEscape(test.filter))
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIds) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedIds, ids)
+			}
+		})
+	}
+}
+
+func TestGetEntriesQueryParams(t *testing.T) {
+	search := newTestHttpEntry("search", 10, "", "", "")
+	search.QueryParams = tapApi.EntryQueryParams{{Name: "q", Value: "a b"}, {Name: "tag", Value: "x"}, {Name: "tag", Value: "y"}}
+	encoded := newTestHttpEntry("encoded", 20, "", "", "")
+	encoded.QueryParams = tapApi.EntryQueryParams{{Name: "q", Value: "a=b&c"}, {Name: "debug", Value: ""}}
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{search, encoded, newTestHttpEntry("none", 30, "", "", "")})
+
+	tests := []struct {
+		query       string
+		expectedIds []string
+	}{
+		{query: "&queryParam=q=a+b", expectedIds: []string{"search"}},
+		{query: "&queryParam=tag=y", expectedIds: []string{"search"}},
+		{query: "&queryParam=tag=x&queryParam=tag=y", expectedIds: []string{"search"}},
+		{query: "&queryParam=tag=x&queryParam=q=other", expectedIds: []string{}},
+		{query: "&queryParam=" + url.QueryEscape("q=a=b&c"), expectedIds: []string{"encoded"}},
+		{query: "&queryParam=q", expectedIds: []string{"search", "encoded"}},
+		{query: "&queryParam=debug=", expectedIds: []string{"encoded"}},
+		{query: "&queryParam=ta", expectedIds: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			ids := getEntryIds(t, app, test.query)
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIds) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedIds, ids)
+			}
+		})
+	}
+}
+
+func TestGetEntriesSizeRangeInvalid(t *testing.T) {
+	app := initTestEntriesDatabase(t, nil)
+
+	tests := []string{"&minRequestSize=abc", "&maxResponseSize=-1", "&maxRequestSize=1.5"}
+
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1"+query, nil)
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusBadRequest, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestGetEntriesQueryTimeout(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{{EntryId: "a", Timestamp: 10}})
+
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{EntriesQueryTimeoutMs: 50}
+	t.Cleanup(func() { config.Config = previousConfig })
+
+	// simulates a slow query that only returns early when its context is cancelled
+	queryCancelled := make(chan bool, 1)
+	err := database.DB.Callback().Query().Before("gorm:query").Register("test:slow_query", func(db *gorm.DB) {
+		select {
+		case <-db.Statement.Context.Done():
+			queryCancelled <- true
+			_ = db.AddError(db.Statement.Context.Err())
+		case <-time.After(5 * time.Second):
+			queryCancelled <- false
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to register slow query callback: %v", err)
+	}
+	t.Cleanup(func() { _ = database.DB.Callback().Query().Remove("test:slow_query") })
+
+	req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusGatewayTimeout, recorder.Code)
+	}
+	if cancelled := <-queryCancelled; !cancelled {
+		t.Errorf("query was not cancelled")
+	}
+}
+
+func newTestHttpEntry(entryId string, timestamp int64, requestBody string, responseBody string, responseEncoding string) tapApi.MizuEntry {
+	request := map[string]interface{}{"details": map[string]interface{}{
+		"method": "POST", "url": "/orders", "httpVersion": "HTTP/1.1", "headers": []interface{}{}, "queryString": []interface{}{},
+		"postData": map[string]interface{}{"mimeType": "text/plain", "text": requestBody},
+	}}
+	response := map[string]interface{}{"details": map[string]interface{}{
+		"status": 200, "statusText": "OK", "httpVersion": "HTTP/1.1", "headers": []interface{}{},
+		"content": map[string]interface{}{"mimeType": "application/json", "encoding": responseEncoding, "text": responseBody},
+	}}
+	entry, _ := json.Marshal(map[string]interface{}{"request": map[string]interface{}{"payload": request}, "response": map[string]interface{}{"payload": response}})
+	return tapApi.MizuEntry{EntryId: entryId, ProtocolName: "http", Timestamp: timestamp, Entry: string(entry)}
+}
+
+func TestGetEntriesPreview(t *testing.T) {
+	largeBody := strings.Repeat("a", 10000)
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		newTestHttpEntry("short", 10, "hi", `{"ok":true}`, ""),
+		newTestHttpEntry("large", 20, largeBody, largeBody, ""),
+		// "é" is 2 bytes and "€" is 3 bytes, a byte cut at 8 falls inside a character
+		newTestHttpEntry("multibyte", 30, "ééé€€", "€€€", ""),
+		newTestHttpEntry("base64", 40, "", base64.StdEncoding.EncodeToString([]byte("decoded body")), "base64"),
+	})
+
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{EntryPreviewBytes: 8}
+	t.Cleanup(func() { config.Config = previousConfig })
+
+	req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	var baseEntries []tapApi.BaseEntryDetails
+	if err := json.Unmarshal(recorder.Body.Bytes(), &baseEntries); err != nil {
+		t.Fatalf("failed to unmarshal entries: %v", err)
+	}
+
+	expected := map[string]tapApi.EntryPreview{
+		"short":     {Request: "hi", Response: `{"ok":tr`, ResponseTruncated: true},
+		"large":     {Request: "aaaaaaaa", RequestTruncated: true, Response: "aaaaaaaa", ResponseTruncated: true},
+		"multibyte": {Request: "ééé", RequestTruncated: true, Response: "€€", ResponseTruncated: true},
+		"base64":    {Request: "", Response: "decoded ", ResponseTruncated: true},
+	}
+	for _, baseEntry := range baseEntries {
+		if baseEntry.Preview == nil || *baseEntry.Preview != expected[baseEntry.Id] {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[baseEntry.Id], baseEntry.Preview)
+		}
+	}
+	if len(baseEntries) != len(expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", len(expected), len(baseEntries))
+	}
+}
+
+func TestGetEntryBody(t *testing.T) {
+	largeBody := strings.Repeat("€", 5000)
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		newTestHttpEntry("large", 10, "request body", largeBody, ""),
+		newTestHttpEntry("binary", 20, "", base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 255}), "base64"),
+		{EntryId: "redis", ProtocolName: "redis", Timestamp: 30},
+	})
+
+	tests := []struct {
+		path             string
+		expectedStatus   int
+		expectedBody     string
+		expectedMimeType string
+	}{
+		{path: "/entries/large/body/response", expectedStatus: http.StatusOK, expectedBody: largeBody, expectedMimeType: "application/json"},
+		{path: "/entries/large/body/request", expectedStatus: http.StatusOK, expectedBody: "request body", expectedMimeType: "text/plain"},
+		{path: "/entries/binary/body/response", expectedStatus: http.StatusOK, expectedBody: string([]byte{0, 1, 2, 255}), expectedMimeType: "application/json"},
+		{path: "/entries/large/body/headers", expectedStatus: http.StatusBadRequest},
+		{path: "/entries/redis/body/response", expectedStatus: http.StatusBadRequest},
+		{path: "/entries/missing/body/response", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", test.expectedStatus, recorder.Code)
+			}
+			if test.expectedStatus != http.StatusOK {
+				return
+			}
+			if recorder.Body.String() != test.expectedBody {
+				t.Errorf("unexpected result - expected: %v bytes, actual: %v bytes", len(test.expectedBody), recorder.Body.Len())
+			}
+			if mimeType := recorder.Header().Get("Content-Type"); mimeType != test.expectedMimeType {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedMimeType, mimeType)
+			}
+			if contentTypeOptions := recorder.Header().Get("X-Content-Type-Options"); contentTypeOptions != "nosniff" {
+				t.Errorf("unexpected result - expected: %v, actual: %v", "nosniff", contentTypeOptions)
+			}
+			if disposition := recorder.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+				t.Errorf("unexpected result - expected: %v, actual: %v", "attachment", disposition)
+			}
+		})
+	}
+}
+
+func exportEntries(t *testing.T, app *gin.Engine, query string, acceptEncoding string) []tapApi.MizuEntry {
+	req := httptest.NewRequest(http.MethodGet, "/entries/export"+query, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "application/x-ndjson", contentType)
+	}
+
+	var body io.Reader = recorder.Body
+	if acceptEncoding == "gzip" {
+		if contentEncoding := recorder.Header().Get("Content-Encoding"); contentEncoding != "gzip" {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", "gzip", contentEncoding)
+		}
+		gzipReader, err := gzip.NewReader(recorder.Body)
+		if err != nil {
+			t.Fatalf("failed to read the gzipped export: %v", err)
+		}
+		body = gzipReader
+	}
+
+	entries := make([]tapApi.MizuEntry, 0)
+	decoder := json.NewDecoder(body)
+	for decoder.More() {
+		var entry tapApi.MizuEntry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("failed to decode an exported entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestExportEntries(t *testing.T) {
+	// more entries than a page of the export
+	entries := make([]tapApi.MizuEntry, 0)
+	for i := 0; i < 1200; i++ {
+		entries = append(entries, tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), ProtocolName: "redis", Entry: "{}", Timestamp: int64(i)})
+	}
+	app := initTestEntriesDatabase(t, entries)
+
+	var storedCount int64
+	database.GetEntriesTable().Count(&storedCount)
+	for _, acceptEncoding := range []string{"", "gzip"} {
+		exported := exportEntries(t, app, "", acceptEncoding)
+		if int64(len(exported)) != storedCount {
+			t.Errorf("unexpected result - expected: %v, actual: %v", storedCount, len(exported))
+		}
+		if len(exported) > 0 && (exported[0].EntryId != "entry-0" || exported[len(exported)-1].EntryId != "entry-1199") {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", "entry-0 to entry-1199", exported[0].EntryId, exported[len(exported)-1].EntryId)
+		}
+	}
+}
+
+func TestExportEntriesSince(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		{EntryId: "old", ProtocolName: "redis", Entry: "{}", Timestamp: 10},
+		{EntryId: "at", ProtocolName: "redis", Entry: "{}", Timestamp: 20},
+		{EntryId: "new", ProtocolName: "redis", Entry: "{}", Timestamp: 30},
+	})
+
+	exportedIds := make([]string, 0)
+	for _, entry := range exportEntries(t, app, "?since=20", "gzip") {
+		exportedIds = append(exportedIds, entry.EntryId)
+	}
+	if expected := []string{"at", "new"}; !reflect.DeepEqual(exportedIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, exportedIds)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/entries/export?since=yesterday", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestGetEntryNotRepresentable(t *testing.T) {
+	// no extension is loaded by the tests
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{{EntryId: "redis", ProtocolName: "redis", Timestamp: 10}})
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/entries/redis", expectedStatus: http.StatusBadRequest},
+		{path: "/entries/missing", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"mizuserver/pkg/holder"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+var extensionPortConflicts []tapApi.PortConflict // global
+var extensionPortConflictsMutex sync.RWMutex
+
+func InitExtensionPortConflicts(ref []tapApi.PortConflict) {
+	extensionPortConflictsMutex.Lock()
+	defer extensionPortConflictsMutex.Unlock()
+	extensionPortConflicts = ref
+}
+
+func getExtensionPortConflicts() []tapApi.PortConflict {
+	extensionPortConflictsMutex.RLock()
+	defer extensionPortConflictsMutex.RUnlock()
+	return extensionPortConflicts
+}
+
+type extensionResponse struct {
+	Name     string   `json:"name"`
+	LongName string   `json:"longName"`
+	Version  string   `json:"version"`
+	Priority uint8    `json:"priority"`
+	Ports    []string `json:"ports"`
+	Path     string   `json:"path"` // the .so file the extension was loaded from
+}
+
+type extensionsResponse struct {
+	Extensions    []extensionResponse   `json:"extensions"`
+	Count         int                   `json:"count"`
+	PortConflicts []tapApi.PortConflict `json:"portConflicts"`
+}
+
+// GetLoadedExtensions returns the loaded extensions in the order they're tried, an extension mapped by the names of
+// its extra protocols too is returned once
+func GetLoadedExtensions() []*tapApi.Extension {
+	extensionsMap := holder.GetExtensionsMap()
+	extensions := make([]*tapApi.Extension, 0, len(extensionsMap))
+	seen := make(map[*tapApi.Extension]bool, len(extensionsMap))
+	for _, extension := range extensionsMap {
+		if seen[extension] {
+			continue
+		}
+		seen[extension] = true
+		extensions = append(extensions, extension)
+	}
+	tapApi.SortExtensions(extensions)
+	return extensions
+}
+
+// GetExtensions returns the loaded extensions in the order they're tried and how their conflicting ports were resolved
+func GetExtensions(c *gin.Context) {
+	extensions := GetLoadedExtensions()
+
+	response := extensionsResponse{Extensions: make([]extensionResponse, 0, len(extensions)), Count: len(extensions), PortConflicts: getExtensionPortConflicts()}
+	for _, extension := range extensions {
+		response.Extensions = append(response.Extensions, extensionResponse{
+			Name:     extension.Protocol.Name,
+			LongName: extension.Protocol.LongName,
+			Version:  extension.Protocol.Version,
+			Priority: extension.Protocol.Priority,
+			Ports:    extension.Protocol.Ports,
+			Path:     extension.Path,
+		})
+	}
+	if response.PortConflicts == nil {
+		response.PortConflicts = make([]tapApi.PortConflict, 0)
+	}
+	c.JSON(http.StatusOK, response)
+}
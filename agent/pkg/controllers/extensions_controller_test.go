@@ -0,0 +1,97 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/controllers"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestGetExtensionsReportsPortConflicts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	extensions := []*tapApi.Extension{
+		{Protocol: &tapApi.Protocol{Name: "thrift", LongName: "Apache Thrift", Priority: 3, Ports: []string{"9090"}}},
+		{Protocol: &tapApi.Protocol{Name: "custom", LongName: "Custom RPC", Priority: 3, Ports: []string{"9090"}}},
+	}
+	tapApi.SortExtensions(extensions)
+	controllers.InitExtensionsMap(map[string]*tapApi.Extension{"thrift": extensions[1], "custom": extensions[0]})
+	controllers.InitExtensionPortConflicts(tapApi.ResolvePortConflicts(extensions, nil))
+	t.Cleanup(func() {
+		controllers.InitExtensionsMap(nil)
+		controllers.InitExtensionPortConflicts(nil)
+	})
+
+	app := gin.New()
+	routes.MetadataRoutes(app)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/extensions", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+
+	var response struct {
+		Extensions []struct {
+			Name  string   `json:"name"`
+			Ports []string `json:"ports"`
+		} `json:"extensions"`
+		PortConflicts []tapApi.PortConflict `json:"portConflicts"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(response.Extensions) != 2 || response.Extensions[0].Name != "custom" || response.Extensions[1].Name != "thrift" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "custom, thrift", response.Extensions)
+	}
+	// extensions of the same priority are selected by name
+	expectedConflicts := []tapApi.PortConflict{{Port: "9090", Extensions: []string{"custom", "thrift"}, Selected: "custom"}}
+	if !reflect.DeepEqual(response.PortConflicts, expectedConflicts) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedConflicts, response.PortConflicts)
+	}
+}
+
+func TestGetExtensionsMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	httpExtension := &tapApi.Extension{
+		Protocol:       &tapApi.Protocol{Name: "http", Version: "1.1", Priority: 0},
+		ExtraProtocols: []*tapApi.Protocol{{Name: "websocket", Version: "13"}},
+		Path:           "/app/extensions/http.so",
+	}
+	redisExtension := &tapApi.Extension{Protocol: &tapApi.Protocol{Name: "redis", Version: "3.x", Priority: 6}, Path: "/app/extensions/redis.so"}
+	controllers.InitExtensionsMap(map[string]*tapApi.Extension{"redis": redisExtension, "http": httpExtension, "websocket": httpExtension})
+	t.Cleanup(func() { controllers.InitExtensionsMap(nil) })
+
+	app := gin.New()
+	routes.MetadataRoutes(app)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/extensions", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+
+	type extension struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		Priority uint8  `json:"priority"`
+		Path     string `json:"path"`
+	}
+	var response struct {
+		Extensions []extension `json:"extensions"`
+		Count      int         `json:"count"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	expected := []extension{
+		{Name: "http", Version: "1.1", Priority: 0, Path: "/app/extensions/http.so"},
+		{Name: "redis", Version: "3.x", Priority: 6, Path: "/app/extensions/redis.so"},
+	}
+	if response.Count != 2 || !reflect.DeepEqual(response.Extensions, expected) {
+		t.Errorf("unexpected result - expected: %v %v, actual: %v %v", 2, expected, response.Count, response.Extensions)
+	}
+}
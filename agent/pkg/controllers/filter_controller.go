@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"mizuserver/pkg/filterExpression"
+	"mizuserver/pkg/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ValidateFilter(c *gin.Context) {
+	validationRequest := &models.FilterValidationRequest{}
+	if err := c.Bind(validationRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := filterExpression.Parse(validationRequest.Filter); err != nil {
+		response := models.FilterValidationResponse{Valid: false, Msg: err.Error()}
+		if syntaxError, ok := err.(*filterExpression.SyntaxError); ok {
+			response.Msg = syntaxError.Message
+			response.Position = &syntaxError.Position
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FilterValidationResponse{Valid: true})
+}
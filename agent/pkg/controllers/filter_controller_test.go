@@ -0,0 +1,80 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestValidateFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	routes.FilterRoutes(app)
+
+	tests := []struct {
+		filter           string
+		expectedValid    bool
+		expectedPosition *int
+	}{
+		{filter: `status >= 500 and method == "POST"`, expectedValid: true},
+		{filter: `status >= "500"`, expectedValid: false, expectedPosition: intPointer(10)},
+		{filter: `status >= 500 and`, expectedValid: false, expectedPosition: intPointer(17)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			body, _ := json.Marshal(models.FilterValidationRequest{Filter: test.filter})
+			req := httptest.NewRequest(http.MethodPost, "/filter/validate", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, req)
+
+			var response models.FilterValidationResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if response.Valid != test.expectedValid {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedValid, response.Valid)
+			}
+			if !reflect.DeepEqual(response.Position, test.expectedPosition) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedPosition, response.Position)
+			}
+			if !test.expectedValid && response.Msg == "" {
+				t.Errorf("expected an error message")
+			}
+		})
+	}
+}
+
+func TestGetEntriesFilterExpression(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		{EntryId: "get-ok", ProtocolName: "redis", Method: "GET", Path: "/api/users", Status: 200, Timestamp: 10},
+		{EntryId: "post-error", ProtocolName: "redis", Method: "POST", Path: "/api/orders", Status: 500, Timestamp: 20},
+		{EntryId: "get-error", ProtocolName: "redis", Method: "GET", Path: "/health", Status: 503, Timestamp: 30},
+	})
+
+	ids := getEntryIds(t, app, "&filter="+url.QueryEscape(`status >= 500 and path contains "/api"`))
+	if expectedIds := []string{"post-error"}; !reflect.DeepEqual(ids, expectedIds) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedIds, ids)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/entries/?limit=100&operator=gt&timestamp=1&filter="+url.QueryEscape(`status >=`), nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func intPointer(value int) *int {
+	return &value
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/database"
+	"mizuserver/pkg/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared/logger"
+	"github.com/up9inc/mizu/tap"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// isCapturingProcess returns whether the packets are captured by this process, the tappers of the api server mode
+// keep the packets and the markers of their connections to themselves
+func isCapturingProcess() bool {
+	return config.Flags.StandaloneMode || config.Flags.PcapReaderMode
+}
+
+func ExportFlowPcap(c *gin.Context) {
+	flow := c.Param("flow")
+	if !isCapturingProcess() {
+		c.JSON(http.StatusNotImplemented, map[string]interface{}{"error": true, "msg": "the packets are only retained by the process capturing them, flows are only exported in standalone and pcap-read modes"})
+		return
+	}
+
+	var pcap bytes.Buffer
+	found, err := tap.WriteFlowPcap(flow, &pcap)
+	switch {
+	case err == tap.ErrInvalidFlow:
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	case err == tap.ErrFlowPacketRetentionDisabled:
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": "packets are not retained by this process, set RETAIN_FLOW_PACKETS=1 to enable it"})
+		return
+	case err != nil:
+		logger.Log.Errorf("Failed writing pcap of flow %s: %v", flow, err)
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	case !found:
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": fmt.Sprintf("no packets were retained for flow %s", flow)})
+		return
+	}
+
+	fileName := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(flow)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pcap\"", fileName))
+	c.Data(http.StatusOK, "application/vnd.tcpdump.pcap", pcap.Bytes())
+}
+
+func GetFlowTimeline(c *gin.Context) {
+	flow := c.Param("flow")
+	flowCondition, err := getFlowCondition(flow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+
+	ctx, cancel := getQueryContext(c)
+	defer cancel()
+
+	entries, err := database.Entries.Find(ctx, &database.EntriesQuery{
+		Conditions: []database.Condition{flowCondition},
+		OrderBy:    database.OrderByTimestamp,
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		c.JSON(http.StatusGatewayTimeout, map[string]interface{}{"error": true, "msg": "entries query timed out"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+
+	// the markers are only known to the process that captured the connection, and only while its packets are retained
+	var openedAt, closedAt time.Time
+	if isCapturingProcess() {
+		openedAt, closedAt, err = tap.GetFlowLifecycle(flow)
+		if err != nil && err != tap.ErrFlowPacketRetentionDisabled {
+			logger.Log.Errorf("Failed getting lifecycle of flow %s: %v", flow, err)
+		}
+	}
+	if len(entries) == 0 && openedAt.IsZero() && closedAt.IsZero() {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": fmt.Sprintf("no entries were captured for flow %s", flow)})
+		return
+	}
+
+	c.JSON(http.StatusOK, getConnectionTimeline(flow, entries, openedAt, closedAt))
+}
+
+// getFlowCondition matches the entries of both directions of the connection of the flow
+func getFlowCondition(flow string) (database.Condition, error) {
+	srcIp, srcPort, dstIp, dstPort, err := tap.ParseFlowEndpoints(flow)
+	if err != nil {
+		return nil, err
+	}
+	return database.FlowCondition(srcIp, srcPort, dstIp, dstPort), nil
+}
+
+func getConnectionTimeline(flow string, entries []tapApi.MizuEntry, openedAt time.Time, closedAt time.Time) *models.ConnectionTimeline {
+	timeline := &models.ConnectionTimeline{Flow: flow, Events: make([]*models.ConnectionEvent, 0, len(entries)+2)}
+
+	var previousEnd *int64
+	if !openedAt.IsZero() {
+		openedAtMs := openedAt.UnixNano() / int64(time.Millisecond)
+		timeline.Events = append(timeline.Events, &models.ConnectionEvent{Type: models.ConnectionEventOpen, Timestamp: openedAtMs})
+		previousEnd = &openedAtMs
+	}
+	for i := range entries {
+		baseEntryDetails := &tapApi.BaseEntryDetails{}
+		if err := models.GetEntry(&entries[i], baseEntryDetails); err != nil {
+			continue
+		}
+
+		event := &models.ConnectionEvent{Type: models.ConnectionEventEntry, Timestamp: entries[i].Timestamp, Entry: baseEntryDetails}
+		if previousEnd != nil {
+			gapMs := entries[i].Timestamp - *previousEnd
+			event.GapMs = &gapMs
+		}
+		end := entries[i].Timestamp + entries[i].ElapsedTime
+		previousEnd = &end
+		timeline.Events = append(timeline.Events, event)
+	}
+	if !closedAt.IsZero() {
+		timeline.Events = append(timeline.Events, &models.ConnectionEvent{Type: models.ConnectionEventClose, Timestamp: closedAt.UnixNano() / int64(time.Millisecond)})
+	}
+	return timeline
+}
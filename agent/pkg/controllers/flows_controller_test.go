@@ -0,0 +1,115 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newTestConnectionEntry(entryId string, timestamp int64, elapsedTime int64, srcIp string, srcPort string, dstIp string, dstPort string) tapApi.MizuEntry {
+	entry := newTestHttpEntry(entryId, timestamp, "", "", "")
+	entry.ElapsedTime = elapsedTime
+	entry.SourceIp, entry.SourcePort, entry.DestinationIp, entry.DestinationPort = srcIp, srcPort, dstIp, dstPort
+	return entry
+}
+
+func TestGetFlowTimeline(t *testing.T) {
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{
+		newTestConnectionEntry("third", 1300, 20, "10.0.0.1", "41000", "10.0.0.2", "80"),
+		newTestConnectionEntry("first", 1000, 50, "10.0.0.1", "41000", "10.0.0.2", "80"),
+		newTestConnectionEntry("other connection", 1100, 10, "10.0.0.1", "41001", "10.0.0.2", "80"),
+		// pipelined, it started before the first entry ended
+		newTestConnectionEntry("second", 1040, 100, "10.0.0.1", "41000", "10.0.0.2", "80"),
+		// a request of the server over the same connection
+		newTestConnectionEntry("fourth", 1400, 5, "10.0.0.2", "80", "10.0.0.1", "41000"),
+	})
+	routes.FlowsRoutes(app)
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/flows/10.0.0.2:80-10.0.0.1:41000/timeline", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+	var timeline models.ConnectionTimeline
+	if err := json.Unmarshal(recorder.Body.Bytes(), &timeline); err != nil {
+		t.Fatalf("failed to unmarshal timeline: %v", err)
+	}
+
+	expected := []struct {
+		entryId string
+		gapMs   *int64
+	}{
+		{entryId: "first"},
+		{entryId: "second", gapMs: int64Pointer(-10)},
+		{entryId: "third", gapMs: int64Pointer(160)},
+		{entryId: "fourth", gapMs: int64Pointer(80)},
+	}
+	if len(timeline.Events) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(timeline.Events))
+	}
+	for i, event := range timeline.Events {
+		if event.Type != models.ConnectionEventEntry || event.Entry == nil || event.Entry.Id != expected[i].entryId {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", expected[i].entryId, event.Type, event.Entry)
+		}
+		if (event.GapMs == nil) != (expected[i].gapMs == nil) || (event.GapMs != nil && *event.GapMs != *expected[i].gapMs) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[i].gapMs, event.GapMs)
+		}
+	}
+}
+
+func TestGetFlowTimelineInvalid(t *testing.T) {
+	app := initTestEntriesDatabase(t, nil)
+	routes.FlowsRoutes(app)
+
+	tests := []struct {
+		flow         string
+		expectedCode int
+	}{
+		{flow: "10.0.0.1-10.0.0.2", expectedCode: http.StatusBadRequest},
+		{flow: "10.0.0.1:1-10.0.0.2:2", expectedCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/flows/"+test.flow+"/timeline", nil))
+		if recorder.Code != test.expectedCode {
+			t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedCode, recorder.Code)
+		}
+	}
+}
+
+func TestExportFlowPcapModes(t *testing.T) {
+	app := initTestEntriesDatabase(t, nil)
+	routes.FlowsRoutes(app)
+	previousFlags := config.Flags
+	t.Cleanup(func() { config.Flags = previousFlags })
+
+	tests := []struct {
+		name         string
+		flags        config.RuntimeFlags
+		expectedCode int
+	}{
+		// the packets are retained by the tappers, not by the api server
+		{name: "api server", flags: config.RuntimeFlags{ApiServerMode: true}, expectedCode: http.StatusNotImplemented},
+		{name: "standalone without retention", flags: config.RuntimeFlags{StandaloneMode: true}, expectedCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Flags = test.flags
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/flows/10.0.0.1:1-10.0.0.2:2/export.pcap", nil))
+			if recorder.Code != test.expectedCode {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedCode, recorder.Code)
+			}
+		})
+	}
+}
+
+func int64Pointer(value int64) *int64 {
+	return &value
+}
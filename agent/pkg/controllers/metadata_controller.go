@@ -3,11 +3,40 @@ package controllers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/up9inc/mizu/shared"
+	"mizuserver/pkg/holder"
 	"mizuserver/pkg/version"
 	"net/http"
+	"sort"
 )
 
 func GetVersion(c *gin.Context) {
 	resp := shared.VersionResponse{SemVer: version.SemVer}
 	c.JSON(http.StatusOK, resp)
 }
+
+// GetAgentVersion returns the build of the agent and the loaded extensions, sorted by name
+func GetAgentVersion(c *gin.Context) {
+	extensionsMap := holder.GetExtensionsMap()
+	extensions := make([]shared.ExtensionVersion, 0, len(extensionsMap))
+	for name, extension := range extensionsMap {
+		extensionVersion := shared.ExtensionVersion{Name: name}
+		if extension.Protocol != nil {
+			extensionVersion.LongName = extension.Protocol.LongName
+			extensionVersion.Version = extension.Protocol.Version
+		}
+		extensions = append(extensions, extensionVersion)
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].Name < extensions[j].Name })
+
+	c.JSON(http.StatusOK, shared.AgentVersionResponse{
+		SemVer:         version.SemVer,
+		Branch:         version.Branch,
+		GitCommitHash:  version.GitCommitHash,
+		BuildTimestamp: version.BuildTimestamp,
+		WebSocketProtocol: shared.WebSocketProtocolVersion{
+			Min: version.MinWebSocketProtocolVersion,
+			Max: version.MaxWebSocketProtocolVersion,
+		},
+		Extensions: extensions,
+	})
+}
@@ -0,0 +1,57 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/controllers"
+	"mizuserver/pkg/routes"
+	"mizuserver/pkg/version"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestGetAgentVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	semVer, gitCommitHash, buildTimestamp := version.SemVer, version.GitCommitHash, version.BuildTimestamp
+	version.SemVer, version.GitCommitHash, version.BuildTimestamp = "1.2.3", "abc123", "1630000000"
+	controllers.InitExtensionsMap(map[string]*tapApi.Extension{
+		"redis": {Protocol: &tapApi.Protocol{Name: "redis", LongName: "Redis Serialization Protocol", Version: "3.x"}},
+		"http":  {Protocol: &tapApi.Protocol{Name: "http", LongName: "Hypertext Transfer Protocol", Version: "1.1"}},
+	})
+	t.Cleanup(func() {
+		version.SemVer, version.GitCommitHash, version.BuildTimestamp = semVer, gitCommitHash, buildTimestamp
+		controllers.InitExtensionsMap(nil)
+	})
+
+	app := gin.New()
+	routes.MetadataRoutes(app)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+
+	var response shared.AgentVersionResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	expected := shared.AgentVersionResponse{
+		SemVer:            "1.2.3",
+		Branch:            version.Branch,
+		GitCommitHash:     "abc123",
+		BuildTimestamp:    "1630000000",
+		WebSocketProtocol: shared.WebSocketProtocolVersion{Min: version.MinWebSocketProtocolVersion, Max: version.MaxWebSocketProtocolVersion},
+		Extensions: []shared.ExtensionVersion{
+			{Name: "http", LongName: "Hypertext Transfer Protocol", Version: "1.1"},
+			{Name: "redis", LongName: "Redis Serialization Protocol", Version: "3.x"},
+		},
+	}
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, response)
+	}
+}
@@ -1,22 +1,38 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"mizuserver/pkg/api"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/database"
+	"mizuserver/pkg/filterExpression"
+	"mizuserver/pkg/filtering"
 	"mizuserver/pkg/holder"
+	"mizuserver/pkg/models"
 	"mizuserver/pkg/providers"
+	"mizuserver/pkg/sinks"
 	"mizuserver/pkg/up9"
 	"mizuserver/pkg/validation"
 	"net/http"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/up9inc/mizu/shared"
 	"github.com/up9inc/mizu/shared/logger"
+	"github.com/up9inc/mizu/tap"
 )
 
+// the entries of a sequence diagram at most, a longer one is unreadable anyway
+const maxSequenceDiagramEntries = 1000
+
 func HealthCheck(c *gin.Context) {
 	response := shared.HealthResponse{
-		TapStatus:    providers.TapStatus,
+		TapStatus:    providers.GetTapStatus(),
 		TappersCount: providers.TappersCount,
 	}
 	c.JSON(http.StatusOK, response)
@@ -34,7 +50,7 @@ func PostTappedPods(c *gin.Context) {
 		return
 	}
 	logger.Log.Infof("[Status] POST request: %d tapped pods", len(tapStatus.Pods))
-	providers.TapStatus.Pods = tapStatus.Pods
+	providers.SetTappedPods(tapStatus.Pods)
 	message := shared.CreateWebSocketStatusMessage(*tapStatus)
 	if jsonBytes, err := json.Marshal(message); err != nil {
 		logger.Log.Errorf("Could not Marshal message %v\n", err)
@@ -58,7 +74,7 @@ func GetAuthStatus(c *gin.Context) {
 }
 
 func GetTappingStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, providers.TapStatus)
+	c.JSON(http.StatusOK, providers.GetTapStatus())
 }
 
 func AnalyzeInformation(c *gin.Context) {
@@ -69,10 +85,194 @@ func GetGeneralStats(c *gin.Context) {
 	c.JSON(http.StatusOK, providers.GetGeneralStats())
 }
 
+func GetServiceMap(c *gin.Context) {
+	serviceMapRequest := &models.ServiceMapRequest{}
+	if err := c.BindQuery(serviceMapRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	entries, _ := database.Entries.Find(c.Request.Context(), &database.EntriesQuery{
+		Columns: []string{"resolvedSource", "resolvedDestination", "sourceIp", "destinationIp", "status", "elapsedTime"},
+	})
+
+	c.JSON(http.StatusOK, providers.BuildServiceMap(entries, serviceMapRequest.ExcludeUnresolved))
+}
+
+// GetSequenceDiagram writes the interactions of correlated entries, the oldest first, as a sequence diagram text
+func GetSequenceDiagram(c *gin.Context) {
+	sequenceDiagramRequest := &models.SequenceDiagramRequest{Format: providers.SequenceDiagramMermaid}
+	if err := c.BindQuery(sequenceDiagramRequest); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	var condition database.Condition
+	selectorsCount := 0
+	if sequenceDiagramRequest.Flow != "" {
+		selectorsCount++
+		flowCondition, err := getFlowCondition(sequenceDiagramRequest.Flow)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+			return
+		}
+		condition = flowCondition
+	}
+	if sequenceDiagramRequest.RedirectChain != "" {
+		selectorsCount++
+		condition = database.RedirectChainCondition(sequenceDiagramRequest.RedirectChain)
+	}
+	if sequenceDiagramRequest.Filter != "" {
+		selectorsCount++
+		expression, err := filterExpression.Parse(sequenceDiagramRequest.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+			return
+		}
+		condition = expression
+	}
+	if selectorsCount != 1 {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": "exactly one of flow, redirectChain or filter must be given"})
+		return
+	}
+
+	ctx, cancel := getQueryContext(c)
+	defer cancel()
+
+	entries, err := database.Entries.Find(ctx, &database.EntriesQuery{
+		Conditions: []database.Condition{condition},
+		OrderBy:    database.OrderByTimestamp,
+		Limit:      maxSequenceDiagramEntries,
+		Columns:    []string{"resolvedSource", "resolvedDestination", "sourceIp", "destinationIp", "method", "path", "status", "timestamp"},
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		c.JSON(http.StatusGatewayTimeout, map[string]interface{}{"error": true, "msg": "entries query timed out"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": true, "msg": "no entries match"})
+		return
+	}
+
+	diagram, err := providers.BuildSequenceDiagram(entries, sequenceDiagramRequest.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(diagram))
+}
+
+// PostApiCoverage reports the operations of the OpenAPI spec in the body observed in the captured http entries, the
+// contract the agent was started with is used when the body is empty
+func PostApiCoverage(c *gin.Context) {
+	spec, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": err.Error()})
+		return
+	}
+	if len(spec) == 0 {
+		if spec, err = ioutil.ReadFile(fmt.Sprintf("%s%s", shared.ConfigDirPath, shared.ContractFileName)); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": "no spec was provided and no contract is configured"})
+			return
+		}
+	}
+
+	// the spec isn't validated, coverage only needs its paths and a spec failing validation is still worth covering
+	loader := &openapi3.Loader{Context: c.Request.Context()}
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": fmt.Sprintf("invalid spec: %v", err)})
+		return
+	} else if len(doc.Paths) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": true, "msg": "the spec has no paths"})
+		return
+	}
+
+	entries, _ := database.Entries.Find(c.Request.Context(), &database.EntriesQuery{
+		Conditions: []database.Condition{database.ProtocolCondition("http")},
+		Columns:    []string{"method", "path", "status"},
+	})
+
+	c.JSON(http.StatusOK, providers.BuildApiCoverage(doc, entries))
+}
+
+// GetEffectiveConfig serves the loaded config and the mode flags, with the tokens and credentials redacted
+func GetEffectiveConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, config.GetEffectiveConfig())
+}
+
+func GetMemoryStatus(c *gin.Context) {
+	if filtering.ActiveMemoryGuard == nil {
+		c.JSON(http.StatusOK, filtering.MemoryGuardStatus{})
+		return
+	}
+	c.JSON(http.StatusOK, filtering.ActiveMemoryGuard.GetStatus())
+}
+
+func GetCaptureScheduleStatus(c *gin.Context) {
+	if filtering.ActiveCaptureSchedule == nil {
+		c.JSON(http.StatusOK, filtering.CaptureScheduleStatus{State: filtering.CaptureStateActive})
+		return
+	}
+	c.JSON(http.StatusOK, filtering.ActiveCaptureSchedule.GetStatus(time.Now()))
+}
+
+func GetNamespaceSamplingStats(c *gin.Context) {
+	if filtering.ActiveNamespaceSampler == nil {
+		c.JSON(http.StatusOK, map[string]filtering.NamespaceSamplingStats{})
+		return
+	}
+	c.JSON(http.StatusOK, filtering.ActiveNamespaceSampler.GetStats())
+}
+
+func GetScheduledExportsStatus(c *gin.Context) {
+	if sinks.ActiveExportScheduler == nil {
+		c.JSON(http.StatusOK, []sinks.ScheduledExportStatus{})
+		return
+	}
+	c.JSON(http.StatusOK, sinks.ActiveExportScheduler.GetStatus())
+}
+
+func GetHarImportProgress(c *gin.Context) {
+	progress := api.GetHarImportProgress()
+	if progress == nil {
+		c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": true,
+			"msg":   "HAR files are not being read",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
+
 func GetRecentTLSLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, providers.GetAllRecentTLSAddresses())
 }
 
+func GetRecentTLSCertificates(c *gin.Context) {
+	c.JSON(http.StatusOK, tap.GetRecentTLSHandshakes())
+}
+
 func GetCurrentResolvingInformation(c *gin.Context) {
 	c.JSON(http.StatusOK, holder.GetResolver().GetMap())
 }
+
+// GetHealthz answers the liveness and readiness probes, it fails with 503 while a subsystem isn't ready
+func GetHealthz(c *gin.Context) {
+	readiness := providers.GetReadiness()
+	if !readiness.Ready {
+		c.JSON(http.StatusServiceUnavailable, readiness)
+		return
+	}
+	c.JSON(http.StatusOK, readiness)
+}
+
+var metricsHandler = promhttp.HandlerFor(providers.MetricsRegistry, promhttp.HandlerOpts{})
+
+// GetMetrics serves the metrics pushed to the pushgateway for Prometheus to scrape
+func GetMetrics(c *gin.Context) {
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,164 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/providers"
+	"mizuserver/pkg/routes"
+	"mizuserver/pkg/sinks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestGetMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	providers.EntryTapped()
+	providers.EntryFilteredOut()
+
+	app := gin.New()
+	routes.MetricsRoutes(app)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", http.StatusOK, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != sinks.MetricsContentType {
+		t.Errorf("unexpected result - expected: %v, actual: %v", sinks.MetricsContentType, contentType)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE mizu_tapped_entries_total counter\nmizu_tapped_entries_total ",
+		"# TYPE mizu_filtered_out_entries_total counter\nmizu_filtered_out_entries_total ",
+		"# TYPE mizu_tapped_pods gauge\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected, body)
+		}
+	}
+	// the socket metrics are only registered by the tapper, which counts them
+	if strings.Contains(body, "mizu_socket_reconnections_total") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no socket metrics", body)
+	}
+}
+
+func TestPostApiCoverage(t *testing.T) {
+	observed := newTestHttpEntry("observed", 10, "", "", "")
+	observed.Method, observed.Path, observed.Status = "GET", "/users/7?verbose=true", 200
+	otherProtocol := observed
+	otherProtocol.EntryId, otherProtocol.ProtocolName, otherProtocol.Path = "other protocol", "grpc", "/users"
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{observed, otherProtocol})
+	routes.StatusRoutes(app)
+
+	spec := `{"openapi": "3.0.0", "info": {"title": "users", "version": "1"}, "paths": {
+		"/users": {"get": {"responses": {"200": {"description": "ok"}}}},
+		"/users/{id}": {"get": {"responses": {"200": {"description": "ok"}}}}
+	}}`
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/status/apiCoverage", strings.NewReader(spec)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected result - expected: %v, actual: %v %v", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var coverage models.ApiCoverage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &coverage); err != nil {
+		t.Fatalf("failed to unmarshal coverage: %v", err)
+	}
+	if coverage.CoveragePercent != 50 || len(coverage.Operations) != 2 || coverage.Operations[0].Observed || !coverage.Operations[1].Observed {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "/users/{id} observed only", coverage)
+	}
+
+	recorder = httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/status/apiCoverage", strings.NewReader(`{"openapi": 3`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestGetSequenceDiagram(t *testing.T) {
+	login := tapApi.MizuEntry{EntryId: "login", ProtocolName: "http", Timestamp: 10, Method: "POST", Path: "/login", Status: 302,
+		ResolvedSource: "frontend", ResolvedDestination: "auth", SourceIp: "10.0.0.1", SourcePort: "5000", DestinationIp: "10.0.0.2", DestinationPort: "80", RedirectChain: "login"}
+	home := tapApi.MizuEntry{EntryId: "home", ProtocolName: "http", Timestamp: 20, Method: "GET", Path: "/home", Status: 200,
+		ResolvedSource: "frontend", ResolvedDestination: "web", SourceIp: "10.0.0.1", SourcePort: "5001", DestinationIp: "10.0.0.3", DestinationPort: "80", RedirectChain: "login", RedirectHop: 1}
+	other := tapApi.MizuEntry{EntryId: "other", ProtocolName: "http", Timestamp: 30, Method: "GET", Path: "/other", Status: 200,
+		ResolvedSource: "frontend", ResolvedDestination: "auth", SourceIp: "10.0.0.1", SourcePort: "5000", DestinationIp: "10.0.0.2", DestinationPort: "80"}
+	app := initTestEntriesDatabase(t, []tapApi.MizuEntry{login, home, other})
+	routes.StatusRoutes(app)
+
+	tests := []struct {
+		query            string
+		expectedCode     int
+		expectedMessages []string
+	}{
+		{query: "redirectChain=login", expectedCode: http.StatusOK, expectedMessages: []string{"P1->>P2: POST /login", "P2-->>P1: 302", "P1->>P3: GET /home", "P3-->>P1: 200"}},
+		{query: "flow=10.0.0.2:80-10.0.0.1:5000", expectedCode: http.StatusOK, expectedMessages: []string{"P1->>P2: POST /login", "P1->>P2: GET /other"}},
+		{query: "filter=" + url.QueryEscape(`path == "/other"`) + "&format=plantuml", expectedCode: http.StatusOK, expectedMessages: []string{"@startuml", "P1 -> P2 : GET /other"}},
+		{query: "redirectChain=missing", expectedCode: http.StatusNotFound},
+		{query: "redirectChain=login&flow=10.0.0.2:80-10.0.0.1:5000", expectedCode: http.StatusBadRequest},
+		{query: "redirectChain=login&format=graphviz", expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status/sequenceDiagram?"+test.query, nil))
+		if recorder.Code != test.expectedCode {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v for %v", test.expectedCode, recorder.Code, recorder.Body.String(), test.query)
+			continue
+		}
+		body := recorder.Body.String()
+		for _, message := range test.expectedMessages {
+			if !strings.Contains(body, message+"\n") {
+				t.Errorf("unexpected result - expected: %v, actual: %v for %v", message, body, test.query)
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status/sequenceDiagram?redirectChain=login", nil))
+	expectedParticipants := "sequenceDiagram\n    participant P1 as frontend\n    participant P2 as auth\n    participant P3 as web\n"
+	if body := recorder.Body.String(); !strings.HasPrefix(body, expectedParticipants) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedParticipants, body)
+	}
+}
+
+func TestGetHealthz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	providers.ResetSubsystems()
+	defer providers.ResetSubsystems()
+
+	app := gin.New()
+	routes.HealthzRoutes(app)
+	getReadiness := func() (int, models.Readiness) {
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var readiness models.Readiness
+		if err := json.Unmarshal(recorder.Body.Bytes(), &readiness); err != nil {
+			t.Fatalf("failed to unmarshal readiness: %v", err)
+		}
+		return recorder.Code, readiness
+	}
+
+	providers.SetSubsystemReady(providers.DatabaseSubsystem, false)
+	providers.SetSubsystemReady(providers.SocketPipeSubsystem, true)
+	code, readiness := getReadiness()
+	if code != http.StatusServiceUnavailable || readiness.Ready || len(readiness.Subsystems) != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %+v", http.StatusServiceUnavailable, code, readiness)
+	}
+	if readiness.Subsystems[0].Name != providers.DatabaseSubsystem || readiness.Subsystems[0].Ready || !readiness.Subsystems[1].Ready {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "database not ready, socket pipe ready", readiness.Subsystems)
+	}
+
+	providers.SetSubsystemReady(providers.DatabaseSubsystem, true)
+	if code, readiness := getReadiness(); code != http.StatusOK || !readiness.Ready {
+		t.Errorf("unexpected result - expected: %v, actual: %v %+v", http.StatusOK, code, readiness)
+	}
+
+	providers.SetSubsystemReady(providers.SocketPipeSubsystem, false)
+	if code, _ := getReadiness(); code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusServiceUnavailable, code)
+	}
+}
@@ -0,0 +1,163 @@
+package correlation
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// EntryDeduplicator recognizes the same exchange reported by several tappers, e.g. when both the client and the server pods are tapped.
+// Entries are duplicates when they share the protocol, the flow endpoints and the request, and their timestamps are within the window.
+// The entries of a source are never merged with each other, so the repeated requests of a keep-alive connection are kept apart,
+// and an entry takes at most one duplicate from every other source, which pairs the repeated requests the sources report in order.
+type EntryDeduplicator struct {
+	windowMs    int64
+	recent      map[string][]*dedupEntry
+	lastPruneMs int64
+	lock        sync.Mutex
+}
+
+type dedupEntry struct {
+	entry   *tapApi.MizuEntry
+	sources []int // the tappers that reported the entry
+}
+
+func (stored *dedupEntry) isReportedBy(source int) bool {
+	for _, reportedBy := range stored.sources {
+		if reportedBy == source {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEntryDeduplicator returns nil when the window is 0, which disables deduplication
+func NewEntryDeduplicator(windowMs int) *EntryDeduplicator {
+	if windowMs <= 0 {
+		return nil
+	}
+
+	return &EntryDeduplicator{
+		windowMs: int64(windowMs),
+		recent:   make(map[string][]*dedupEntry),
+	}
+}
+
+// Deduplicate returns the entry to store and whether it is a duplicate of an entry that was already stored by another source.
+// A duplicate is merged into the stored entry, which keeps its ids while taking the data of the more complete of the two.
+func (deduplicator *EntryDeduplicator) Deduplicate(entry *tapApi.MizuEntry, source int) (*tapApi.MizuEntry, bool) {
+	deduplicator.lock.Lock()
+	defer deduplicator.lock.Unlock()
+
+	deduplicator.pruneOlderThan(entry.Timestamp - 2*deduplicator.windowMs)
+
+	fingerprint := getEntryFingerprint(entry)
+	for _, stored := range deduplicator.recent[fingerprint] {
+		if !stored.isReportedBy(source) && abs(stored.entry.Timestamp-entry.Timestamp) <= deduplicator.windowMs {
+			mergeEntries(stored.entry, entry)
+			stored.sources = append(stored.sources, source)
+			return stored.entry, true
+		}
+	}
+
+	deduplicator.recent[fingerprint] = append(deduplicator.recent[fingerprint], &dedupEntry{entry: entry, sources: []int{source}})
+	return entry, false
+}
+
+func (deduplicator *EntryDeduplicator) pruneOlderThan(timestampMs int64) {
+	if timestampMs-deduplicator.lastPruneMs < deduplicator.windowMs {
+		return
+	}
+	deduplicator.lastPruneMs = timestampMs
+
+	for fingerprint, entries := range deduplicator.recent {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.entry.Timestamp >= timestampMs {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == 0 {
+			delete(deduplicator.recent, fingerprint)
+		} else {
+			deduplicator.recent[fingerprint] = kept
+		}
+	}
+}
+
+// getEntryFingerprint doesn't include the status, a tapper that missed the response still reports the same exchange
+func getEntryFingerprint(entry *tapApi.MizuEntry) string {
+	source := net.JoinHostPort(entry.SourceIp, entry.SourcePort)
+	destination := net.JoinHostPort(entry.DestinationIp, entry.DestinationPort)
+	if destination < source {
+		source, destination = destination, source
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%s", entry.ProtocolName, source, destination, entry.Method, entry.Path)
+}
+
+func mergeEntries(stored *tapApi.MizuEntry, duplicate *tapApi.MizuEntry) {
+	if getCompleteness(duplicate) > getCompleteness(stored) {
+		merged := *duplicate
+		merged.ID, merged.CreatedAt, merged.EntryId = stored.ID, stored.CreatedAt, stored.EntryId
+		fillMissingFields(&merged, stored)
+		*stored = merged
+	} else {
+		fillMissingFields(stored, duplicate)
+	}
+}
+
+func fillMissingFields(target *tapApi.MizuEntry, source *tapApi.MizuEntry) {
+	if target.ResolvedSource == "" {
+		target.ResolvedSource = source.ResolvedSource
+	}
+	if target.ResolvedDestination == "" {
+		target.ResolvedDestination = source.ResolvedDestination
+	}
+	if target.SourceLabels == nil {
+		target.SourceLabels = source.SourceLabels
+	}
+	if target.DestinationLabels == nil {
+		target.DestinationLabels = source.DestinationLabels
+	}
+	if target.QueryParams == nil {
+		target.QueryParams = source.QueryParams
+	}
+	if target.Fields == nil {
+		target.Fields = source.Fields
+	}
+	if target.Service == "" {
+		target.Service = source.Service
+	}
+	if target.Status == 0 {
+		target.Status = source.Status
+	}
+	if target.ElapsedTime == 0 {
+		target.ElapsedTime = source.ElapsedTime
+	}
+	if target.RequestSize == 0 {
+		target.RequestSize = source.RequestSize
+	}
+	if target.ResponseSize == 0 {
+		target.ResponseSize = source.ResponseSize
+	}
+}
+
+// getCompleteness counts the filled fields that may be missing depending on where the exchange was captured, ties are broken by the entry size
+func getCompleteness(entry *tapApi.MizuEntry) int64 {
+	var filledFields int64
+	for _, isFilled := range []bool{entry.ResolvedSource != "", entry.ResolvedDestination != "", entry.Service != "", entry.Status != 0, entry.ElapsedTime != 0, entry.RequestSize != 0, entry.ResponseSize != 0} {
+		if isFilled {
+			filledFields++
+		}
+	}
+	return filledFields<<32 + int64(len(entry.Entry))
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,134 @@
+package correlation_test
+
+import (
+	"mizuserver/pkg/correlation"
+	"reflect"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newTestDedupEntry(entryId string, timestamp int64) *tapApi.MizuEntry {
+	return &tapApi.MizuEntry{
+		ProtocolName:    "http",
+		EntryId:         entryId,
+		Method:          "GET",
+		Path:            "/orders",
+		SourceIp:        "10.0.0.1",
+		SourcePort:      "41000",
+		DestinationIp:   "10.0.0.2",
+		DestinationPort: "80",
+		Timestamp:       timestamp,
+	}
+}
+
+func TestEntryDeduplicatorMergesEntriesFromDifferentNodes(t *testing.T) {
+	deduplicator := correlation.NewEntryDeduplicator(500)
+
+	// the client node captured the exchange first but couldn't resolve the destination and missed the response
+	clientNodeEntry := newTestDedupEntry("client-node", 1000)
+	clientNodeEntry.ID = 7
+	clientNodeEntry.ResolvedSource = "frontend.default"
+	clientNodeEntry.Entry = `{"request":{}}`
+
+	serverNodeEntry := newTestDedupEntry("server-node", 1120)
+	serverNodeEntry.ResolvedDestination = "orders.default"
+	serverNodeEntry.Status = 200
+	serverNodeEntry.ElapsedTime = 12
+	serverNodeEntry.ResponseSize = 512
+	serverNodeEntry.Entry = `{"request":{},"response":{}}`
+
+	if stored, isDuplicate := deduplicator.Deduplicate(clientNodeEntry, 1); isDuplicate || stored != clientNodeEntry {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", false, isDuplicate)
+	}
+
+	stored, isDuplicate := deduplicator.Deduplicate(serverNodeEntry, 2)
+	if !isDuplicate || stored != clientNodeEntry {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", true, isDuplicate)
+	}
+
+	expected := *serverNodeEntry
+	expected.ID, expected.EntryId, expected.ResolvedSource = 7, "client-node", "frontend.default"
+	if !reflect.DeepEqual(*stored, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, *stored)
+	}
+}
+
+func TestEntryDeduplicatorKeepsMoreCompleteStoredEntry(t *testing.T) {
+	deduplicator := correlation.NewEntryDeduplicator(500)
+
+	complete := newTestDedupEntry("complete", 1000)
+	complete.Status = 200
+	complete.ResolvedDestination = "orders.default"
+	partial := newTestDedupEntry("partial", 900)
+	partial.ResolvedSource = "frontend.default"
+	// the other node reports the flow from the opposite direction
+	partial.SourceIp, partial.SourcePort, partial.DestinationIp, partial.DestinationPort = "10.0.0.2", "80", "10.0.0.1", "41000"
+
+	deduplicator.Deduplicate(complete, 1)
+	stored, isDuplicate := deduplicator.Deduplicate(partial, 2)
+	if !isDuplicate || stored.EntryId != "complete" || stored.Status != 200 || stored.ResolvedSource != "frontend.default" || stored.SourceIp != "10.0.0.1" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "complete entry with the resolved source", *stored)
+	}
+}
+
+func TestEntryDeduplicatorDistinctEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		other func(entry *tapApi.MizuEntry)
+	}{
+		{name: "OutsideWindow", other: func(entry *tapApi.MizuEntry) { entry.Timestamp = 1501 }},
+		{name: "OtherPath", other: func(entry *tapApi.MizuEntry) { entry.Path = "/users" }},
+		{name: "OtherConnection", other: func(entry *tapApi.MizuEntry) { entry.SourcePort = "41001" }},
+		{name: "OtherProtocol", other: func(entry *tapApi.MizuEntry) { entry.ProtocolName = "redis" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deduplicator := correlation.NewEntryDeduplicator(500)
+			deduplicator.Deduplicate(newTestDedupEntry("first", 1000), 1)
+
+			other := newTestDedupEntry("second", 1000)
+			test.other(other)
+			if stored, isDuplicate := deduplicator.Deduplicate(other, 2); isDuplicate || stored != other {
+				t.Errorf("unexpected result - expected: %v, actual: %v", false, isDuplicate)
+			}
+		})
+	}
+}
+
+func TestEntryDeduplicatorKeepsRepeatedRequests(t *testing.T) {
+	deduplicator := correlation.NewEntryDeduplicator(500)
+
+	// both nodes report the two requests the client sent on a keep-alive connection
+	clientNodeFirst, clientNodeSecond := newTestDedupEntry("client-node-first", 1000), newTestDedupEntry("client-node-second", 1040)
+	serverNodeFirst, serverNodeSecond := newTestDedupEntry("server-node-first", 1010), newTestDedupEntry("server-node-second", 1050)
+	clientNodeFirst.Status, clientNodeSecond.Status = 200, 404
+	serverNodeFirst.ElapsedTime, serverNodeSecond.ElapsedTime = 5, 7
+
+	if stored, isDuplicate := deduplicator.Deduplicate(clientNodeFirst, 1); isDuplicate || stored != clientNodeFirst {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", clientNodeFirst.EntryId, stored.EntryId)
+	}
+	if stored, isDuplicate := deduplicator.Deduplicate(clientNodeSecond, 1); isDuplicate || stored != clientNodeSecond {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", clientNodeSecond.EntryId, stored.EntryId)
+	}
+	if stored, isDuplicate := deduplicator.Deduplicate(serverNodeFirst, 2); !isDuplicate || stored != clientNodeFirst {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", clientNodeFirst.EntryId, stored.EntryId)
+	}
+	if stored, isDuplicate := deduplicator.Deduplicate(serverNodeSecond, 2); !isDuplicate || stored != clientNodeSecond {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", clientNodeSecond.EntryId, stored.EntryId)
+	}
+
+	if clientNodeFirst.Status != 200 || clientNodeFirst.ElapsedTime != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "status 200 and latency 5", *clientNodeFirst)
+	}
+	if clientNodeSecond.Status != 404 || clientNodeSecond.ElapsedTime != 7 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "status 404 and latency 7", *clientNodeSecond)
+	}
+}
+
+func TestNewEntryDeduplicatorDisabled(t *testing.T) {
+	if deduplicator := correlation.NewEntryDeduplicator(0); deduplicator != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, deduplicator)
+	}
+}
@@ -0,0 +1,87 @@
+package correlation
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redirectFollowTimeout = 30 * time.Second
+
+var redirectStatusCodes = map[int]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+type pendingRedirect struct {
+	chainId   string
+	hop       int
+	expiresAt time.Time
+}
+
+// RedirectChainTracker links a redirect response to the request its client sends to the Location it points to,
+// the target may be on another host since requests are correlated by client ip and absolute url
+type RedirectChainTracker struct {
+	pending map[string]*pendingRedirect
+	lock    sync.Mutex
+}
+
+var RedirectChains = NewRedirectChainTracker()
+
+func NewRedirectChainTracker() *RedirectChainTracker {
+	return &RedirectChainTracker{pending: make(map[string]*pendingRedirect)}
+}
+
+// Track returns the chain the entry belongs to and its hop index in it, or an empty chain id for entries that aren't part of a redirect chain.
+// A new chain is named after the id of the entry that started it.
+func (tracker *RedirectChainTracker) Track(entryId string, clientIp string, requestUrl string, status int, location string, capturedAt time.Time) (string, int) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.removeExpired(capturedAt)
+
+	chainId, hop := "", 0
+	requestKey := getRedirectKey(clientIp, requestUrl)
+	if redirect, ok := tracker.pending[requestKey]; ok {
+		chainId, hop = redirect.chainId, redirect.hop+1
+		delete(tracker.pending, requestKey)
+	}
+
+	if redirectStatusCodes[status] && location != "" {
+		if target, err := resolveLocation(requestUrl, location); err == nil {
+			if chainId == "" {
+				chainId = entryId
+			}
+			tracker.pending[getRedirectKey(clientIp, target)] = &pendingRedirect{chainId: chainId, hop: hop, expiresAt: capturedAt.Add(redirectFollowTimeout)}
+		}
+	}
+
+	return chainId, hop
+}
+
+func (tracker *RedirectChainTracker) removeExpired(now time.Time) {
+	for key, redirect := range tracker.pending {
+		if now.After(redirect.expiresAt) {
+			delete(tracker.pending, key)
+		}
+	}
+}
+
+func resolveLocation(requestUrl string, location string) (string, error) {
+	base, err := url.Parse(requestUrl)
+	if err != nil {
+		return "", err
+	}
+	reference, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(reference).String(), nil
+}
+
+func getRedirectKey(clientIp string, rawUrl string) string {
+	if parsedUrl, err := url.Parse(rawUrl); err == nil {
+		parsedUrl.Fragment = ""
+		parsedUrl.Host = strings.ToLower(parsedUrl.Host)
+		rawUrl = parsedUrl.String()
+	}
+	return clientIp + " " + rawUrl
+}
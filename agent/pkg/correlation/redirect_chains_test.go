@@ -0,0 +1,62 @@
+package correlation_test
+
+import (
+	"mizuserver/pkg/correlation"
+	"testing"
+	"time"
+)
+
+type trackedEntry struct {
+	entryId    string
+	clientIp   string
+	requestUrl string
+	status     int
+	location   string
+}
+
+func TestRedirectChainTrackerTwoHops(t *testing.T) {
+	tracker := correlation.NewRedirectChainTracker()
+	now := time.Now()
+
+	entries := []trackedEntry{
+		{entryId: "a", clientIp: "10.0.0.1", requestUrl: "http://shop.local/old", status: 301, location: "/new"},
+		{entryId: "unrelated", clientIp: "10.0.0.2", requestUrl: "http://shop.local/new", status: 200},
+		{entryId: "b", clientIp: "10.0.0.1", requestUrl: "http://shop.local/new", status: 302, location: "http://Auth.local/login?next=%2Fnew#top"},
+		{entryId: "c", clientIp: "10.0.0.1", requestUrl: "http://auth.local/login?next=%2Fnew", status: 200},
+		{entryId: "d", clientIp: "10.0.0.1", requestUrl: "http://auth.local/login?next=%2Fnew", status: 200},
+	}
+	expected := []struct {
+		chainId string
+		hop     int
+	}{
+		{chainId: "a", hop: 0},
+		{chainId: "", hop: 0},
+		{chainId: "a", hop: 1},
+		{chainId: "a", hop: 2},
+		{chainId: "", hop: 0},
+	}
+
+	for i, entry := range entries {
+		t.Run(entry.entryId, func(t *testing.T) {
+			chainId, hop := tracker.Track(entry.entryId, entry.clientIp, entry.requestUrl, entry.status, entry.location, now.Add(time.Duration(i)*time.Millisecond))
+			if chainId != expected[i].chainId {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expected[i].chainId, chainId)
+			}
+			if hop != expected[i].hop {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expected[i].hop, hop)
+			}
+		})
+	}
+}
+
+func TestRedirectChainTrackerExpiredRedirect(t *testing.T) {
+	tracker := correlation.NewRedirectChainTracker()
+	now := time.Now()
+
+	tracker.Track("a", "10.0.0.1", "http://shop.local/old", 302, "/new", now)
+	chainId, _ := tracker.Track("b", "10.0.0.1", "http://shop.local/new", 200, "", now.Add(time.Minute))
+
+	if chainId != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", chainId)
+	}
+}
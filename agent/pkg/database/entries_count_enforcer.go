@@ -0,0 +1,91 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const entriesCountCheckInterval = 5 * time.Second
+
+// entriesWritten is set by the writes since the last check of the entries count, an idle database isn't counted
+var entriesWritten int32
+
+// entriesPruneLock makes the inserts wait while the entries beyond the max are deleted, the inserts are only dropped
+// while IsDBLocked is set by the size enforcer
+var entriesPruneLock sync.RWMutex
+
+func markEntriesWritten() {
+	atomic.StoreInt32(&entriesWritten, 1)
+}
+
+// entriesCountEnforcerStop stops the enforcer of the current database, nil unless the entries count is enforced. The
+// enforcer closes entriesCountEnforcerStopped once it returned.
+var entriesCountEnforcerStop, entriesCountEnforcerStopped chan struct{}
+
+// startEnforcingEntriesCount deletes the oldest entries beyond maxEntries until stopEnforcingEntriesCount is called, the
+// count is checked periodically rather than on every insert
+func startEnforcingEntriesCount(maxEntries int64) {
+	stopEnforcingEntriesCount()
+	if maxEntries <= 0 {
+		return
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	entriesCountEnforcerStop, entriesCountEnforcerStopped = stop, stopped
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(entriesCountCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if atomic.SwapInt32(&entriesWritten, 0) == 1 {
+					checkEntriesCount(maxEntries)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopEnforcingEntriesCount waits for a running check so it's done before the database is closed
+func stopEnforcingEntriesCount() {
+	if entriesCountEnforcerStop != nil {
+		close(entriesCountEnforcerStop)
+		<-entriesCountEnforcerStopped
+		entriesCountEnforcerStop, entriesCountEnforcerStopped = nil, nil
+	}
+}
+
+func checkEntriesCount(maxEntries int64) {
+	removed, err := PruneEntriesBeyond(maxEntries)
+	if err != nil {
+		logger.Log.Errorf("Error removing the db rows beyond the max of %d entries: %v", maxEntries, err)
+	} else if removed > 0 {
+		logger.Log.Infof("Removed %d rows beyond the max of %d entries", removed, maxEntries)
+	}
+}
+
+// PruneEntriesBeyond deletes the entries inserted first until maxEntries are left, through the index of their
+// insertion time. It returns the number of entries deleted.
+func PruneEntriesBeyond(maxEntries int64) (int64, error) {
+	var entriesCount int64
+	if err := GetEntriesTable().Count(&entriesCount).Error; err != nil {
+		return 0, err
+	}
+	if entriesCount <= maxEntries {
+		return 0, nil
+	}
+
+	entriesPruneLock.Lock()
+	defer entriesPruneLock.Unlock()
+
+	oldestEntries := GetEntriesTable().Select("id").Order("created_at, id").Limit(int(entriesCount - maxEntries))
+	result := GetEntriesTable().Where("id IN (?)", oldestEntries).Delete(&tapApi.MizuEntry{})
+	return result.RowsAffected, result.Error
+}
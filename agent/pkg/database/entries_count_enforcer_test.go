@@ -0,0 +1,82 @@
+package database_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/database"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestPruneEntriesBeyond(t *testing.T) {
+	directory, err := ioutil.TempDir("", "entries")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+	database.InitDataBase(path.Join(directory, "entries.db"))
+	for i := 0; i < 10; i++ {
+		database.CreateEntry(&tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), Entry: "{}"})
+	}
+
+	if removed, err := database.PruneEntriesBeyond(10); err != nil || removed != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", 0, removed, err)
+	}
+	if removed, err := database.PruneEntriesBeyond(4); err != nil || removed != 6 {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", 6, removed, err)
+	}
+
+	var entryIds []string
+	database.GetEntriesTable().Order("id").Pluck("entryId", &entryIds)
+	expected := []string{"entry-6", "entry-7", "entry-8", "entry-9"}
+	if !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+
+	var indexes []string
+	database.DB.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'mizu_entries' ORDER BY name").Scan(&indexes)
+	if expectedIndexes := []string{"idx_mizu_entries_created_at", "idx_mizu_entries_entry_id"}; !reflect.DeepEqual(indexes, expectedIndexes) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedIndexes, indexes)
+	}
+}
+
+func TestPruneEntriesBeyondKeepsConcurrentInserts(t *testing.T) {
+	directory, err := ioutil.TempDir("", "entries")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+	database.InitDataBase(path.Join(directory, "entries.db"))
+	for i := 0; i < 10; i++ {
+		database.CreateEntry(&tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), Entry: "{}"})
+	}
+
+	// the entries inserted while pruning wait for it rather than being dropped
+	written := make(chan bool, 50)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 10; i < 60; i++ {
+			database.CreateEntryNotifying(&tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), Entry: "{}"}, func(isWritten bool) { written <- isWritten })
+		}
+	}()
+	if _, err := database.PruneEntriesBeyond(5); err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, err)
+	}
+	<-done
+	close(written)
+
+	writtenCount := 0
+	for isWritten := range written {
+		if isWritten {
+			writtenCount++
+		}
+	}
+	if writtenCount != 50 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 50, writtenCount)
+	}
+}
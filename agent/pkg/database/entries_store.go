@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+	"gorm.io/gorm"
+)
+
+const (
+	OrderByTimestamp = "timestamp"
+	OrderById        = "id"
+)
+
+var ErrEntryNotFound = errors.New("entry not found")
+
+// Entries is the store of the entries the routes read, either the database or the entries kept in memory. It's nil
+// until the database was initialized.
+var Entries EntriesStore
+
+// EntriesStore is implemented by the database and by the ring buffer of the entries kept in memory, the routes read
+// through it so they're unaware of where the entries are kept
+type EntriesStore interface {
+	// Create assigns the ids of the entries and stores them
+	Create(entries ...*tapApi.MizuEntry) error
+	// Save replaces the stored entry of the same id
+	Save(entry *tapApi.MizuEntry) error
+	Find(ctx context.Context, query *EntriesQuery) ([]tapApi.MizuEntry, error)
+	// FindByEntryId returns ErrEntryNotFound unless an entry of the entryId is stored
+	FindByEntryId(entryId string) (*tapApi.MizuEntry, error)
+}
+
+// Condition restricts the entries read from the store. The database applies its sql as a where clause and the
+// entries kept in memory are matched one by one.
+type Condition interface {
+	ToSQL() (string, []interface{})
+	Matches(entry *tapApi.MizuEntry) bool
+}
+
+// EntriesQuery finds the entries matching all of the conditions
+type EntriesQuery struct {
+	Conditions []Condition
+	OrderBy    string   // OrderByTimestamp or OrderById, the order of the entries is unspecified when it's empty
+	Order      string   // OrderAsc or OrderDesc, OrderAsc when it's empty
+	Limit      int      // no limit when 0
+	Columns    []string // the columns read from the database, all of them when empty. The entries kept in memory are whole.
+}
+
+func (query *EntriesQuery) isDescending() bool {
+	return query.Order == OrderDesc
+}
+
+// condition is a Condition whose match is computed alongside its sql
+type condition struct {
+	sql     string
+	args    []interface{}
+	matches func(entry *tapApi.MizuEntry) bool
+}
+
+func (c *condition) ToSQL() (string, []interface{}) {
+	return c.sql, c.args
+}
+
+func (c *condition) Matches(entry *tapApi.MizuEntry) bool {
+	return c.matches(entry)
+}
+
+func compareNumbers(value int64, operator string, operand int64) bool {
+	switch operator {
+	case "<":
+		return value < operand
+	case "<=":
+		return value <= operand
+	case ">":
+		return value > operand
+	case ">=":
+		return value >= operand
+	}
+	return value == operand
+}
+
+// TimestampCondition compares the timestamp of the entries with one of <, <=, > or >=
+func TimestampCondition(operator string, timestamp int64) Condition {
+	return &condition{
+		sql:     fmt.Sprintf("timestamp %s ?", operator),
+		args:    []interface{}{timestamp},
+		matches: func(entry *tapApi.MizuEntry) bool { return compareNumbers(entry.Timestamp, operator, timestamp) },
+	}
+}
+
+// IdAfterCondition matches the entries stored after the entry of the id
+func IdAfterCondition(id uint) Condition {
+	return &condition{
+		sql:     "id > ?",
+		args:    []interface{}{id},
+		matches: func(entry *tapApi.MizuEntry) bool { return entry.ID > id },
+	}
+}
+
+func ProtocolCondition(protocolName string) Condition {
+	return &condition{
+		sql:     "protocolName = ?",
+		args:    []interface{}{protocolName},
+		matches: func(entry *tapApi.MizuEntry) bool { return entry.ProtocolName == protocolName },
+	}
+}
+
+func RedirectChainCondition(redirectChain string) Condition {
+	return &condition{
+		sql:     "redirectChain = ?",
+		args:    []interface{}{redirectChain},
+		matches: func(entry *tapApi.MizuEntry) bool { return entry.RedirectChain == redirectChain },
+	}
+}
+
+// FlowCondition matches the entries of both directions of the connection between the endpoints
+func FlowCondition(srcIp string, srcPort string, dstIp string, dstPort string) Condition {
+	return &condition{
+		sql:  "(sourceIp = ? AND sourcePort = ? AND destinationIp = ? AND destinationPort = ?) OR (sourceIp = ? AND sourcePort = ? AND destinationIp = ? AND destinationPort = ?)",
+		args: []interface{}{srcIp, srcPort, dstIp, dstPort, dstIp, dstPort, srcIp, srcPort},
+		matches: func(entry *tapApi.MizuEntry) bool {
+			return (entry.SourceIp == srcIp && entry.SourcePort == srcPort && entry.DestinationIp == dstIp && entry.DestinationPort == dstPort) ||
+				(entry.SourceIp == dstIp && entry.SourcePort == dstPort && entry.DestinationIp == srcIp && entry.DestinationPort == srcPort)
+		},
+	}
+}
+
+func sizeRangeCondition(column string, size func(entry *tapApi.MizuEntry) int64, minSize *int64, maxSize *int64) Condition {
+	conditions := []string{"1 = 1"}
+	args := make([]interface{}, 0)
+	if minSize != nil {
+		conditions = append(conditions, fmt.Sprintf("%s >= ?", column))
+		args = append(args, *minSize)
+	}
+	if maxSize != nil {
+		conditions = append(conditions, fmt.Sprintf("%s <= ?", column))
+		args = append(args, *maxSize)
+	}
+	return &condition{
+		sql:  strings.Join(conditions, " AND "),
+		args: args,
+		matches: func(entry *tapApi.MizuEntry) bool {
+			return (minSize == nil || size(entry) >= *minSize) && (maxSize == nil || size(entry) <= *maxSize)
+		},
+	}
+}
+
+// RequestSizeCondition matches the entries whose request size is within the given (optional) bounds
+func RequestSizeCondition(minSize *int64, maxSize *int64) Condition {
+	return sizeRangeCondition("requestSize", func(entry *tapApi.MizuEntry) int64 { return entry.RequestSize }, minSize, maxSize)
+}
+
+// ResponseSizeCondition matches the entries whose response size is within the given (optional) bounds
+func ResponseSizeCondition(minSize *int64, maxSize *int64) Condition {
+	return sizeRangeCondition("responseSize", func(entry *tapApi.MizuEntry) int64 { return entry.ResponseSize }, minSize, maxSize)
+}
+
+// QueryParamsCondition matches the entries with all of the params, a param is either name=value or a name alone
+// matching any value
+func QueryParamsCondition(params []string, lowercaseNames bool) Condition {
+	conditions := []string{"1 = 1"}
+	args := make([]interface{}, 0)
+	lines := make([]string, 0, len(params))
+	for _, param := range params {
+		name, value := param, ""
+		separatorIndex := strings.Index(param, "=")
+		if separatorIndex >= 0 {
+			name, value = param[:separatorIndex], param[separatorIndex+1:]
+		}
+		if lowercaseNames {
+			name = strings.ToLower(name)
+		}
+
+		// the line of a name alone is a prefix of the lines of every value
+		line := tapApi.QueryParamLine(name, value)
+		if separatorIndex >= 0 {
+			line += "\n"
+		}
+		conditions = append(conditions, "instr(queryParams, ?) > 0")
+		args = append(args, "\n"+line)
+		lines = append(lines, line)
+	}
+	return &condition{
+		sql:  strings.Join(conditions, " AND "),
+		args: args,
+		matches: func(entry *tapApi.MizuEntry) bool {
+			for _, line := range lines {
+				if !hasQueryParamLine(entry.QueryParams, line) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+func hasQueryParamLine(params tapApi.EntryQueryParams, line string) bool {
+	for _, param := range params {
+		if strings.HasPrefix(tapApi.QueryParamLine(param.Name, param.Value)+"\n", line) {
+			return true
+		}
+	}
+	return false
+}
+
+func createdAtRangeCondition(timeFrom time.Time, timeTo time.Time) Condition {
+	return &condition{
+		sql:  "created_at BETWEEN ? AND ?",
+		args: []interface{}{timeFrom.Format(TimeFormat), timeTo.Format(TimeFormat)},
+		matches: func(entry *tapApi.MizuEntry) bool {
+			return !entry.CreatedAt.Before(timeFrom) && !entry.CreatedAt.After(timeTo)
+		},
+	}
+}
+
+// databaseEntriesStore keeps the entries in the database table
+type databaseEntriesStore struct{}
+
+func (databaseEntriesStore) Create(entries ...*tapApi.MizuEntry) error {
+	entriesPruneLock.RLock()
+	defer entriesPruneLock.RUnlock()
+	var err error
+	if len(entries) == 1 {
+		err = GetEntriesTable().Create(entries[0]).Error
+	} else {
+		err = GetEntriesTable().CreateInBatches(entries, maxEntriesPerInsert).Error
+	}
+	if err == nil {
+		markEntriesWritten()
+	}
+	return err
+}
+
+func (databaseEntriesStore) Save(entry *tapApi.MizuEntry) error {
+	entriesPruneLock.RLock()
+	defer entriesPruneLock.RUnlock()
+	return GetEntriesTable().Save(entry).Error
+}
+
+func (databaseEntriesStore) Find(ctx context.Context, query *EntriesQuery) ([]tapApi.MizuEntry, error) {
+	statement := GetEntriesTable().WithContext(ctx)
+	if len(query.Columns) > 0 {
+		statement = statement.Select(query.Columns)
+	}
+	for _, condition := range query.Conditions {
+		sql, args := condition.ToSQL()
+		statement = statement.Where(sql, args...)
+	}
+	if query.OrderBy != "" {
+		order := OrderAsc
+		if query.isDescending() {
+			order = OrderDesc
+		}
+		statement = statement.Order(fmt.Sprintf("%s %s", query.OrderBy, order))
+	}
+	if query.Limit > 0 {
+		statement = statement.Limit(query.Limit)
+	}
+
+	var entries []tapApi.MizuEntry
+	err := statement.Find(&entries).Error
+	return entries, err
+}
+
+func (databaseEntriesStore) FindByEntryId(entryId string) (*tapApi.MizuEntry, error) {
+	var entry tapApi.MizuEntry
+	if err := GetEntriesTable().Where("entryId = ?", entryId).First(&entry).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
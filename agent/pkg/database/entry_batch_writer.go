@@ -0,0 +1,125 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	defaultEntriesFlushInterval = time.Second
+	maxEntriesPerInsert         = 200 // an insert statement has a variable per column of each entry, sqlite limits them
+)
+
+// entryBatchWriter accumulates the created entries and writes them in a single transaction once the batch is full or
+// the flush interval passed, whichever comes first
+type entryBatchWriter struct {
+	mutex     sync.Mutex
+	batch     []*tapApi.MizuEntry
+	onWritten []func(isWritten bool) // of the entries of the batch, nil for the entries nobody waits for
+	batchSize int
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+var activeEntryBatchWriter *entryBatchWriter // nil unless the writes of the entries are batched
+
+// newEntryBatchWriter returns nil when the writes aren't batched
+func newEntryBatchWriter(batchConfig *shared.DatabaseWriteBatchConfig) *entryBatchWriter {
+	if batchConfig == nil || batchConfig.Size < 2 {
+		return nil
+	}
+	flushInterval := defaultEntriesFlushInterval
+	if batchConfig.FlushIntervalMs > 0 {
+		flushInterval = time.Duration(batchConfig.FlushIntervalMs) * time.Millisecond
+	}
+
+	writer := &entryBatchWriter{
+		batch:     make([]*tapApi.MizuEntry, 0, batchConfig.Size),
+		onWritten: make([]func(isWritten bool), 0, batchConfig.Size),
+		batchSize: batchConfig.Size,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go writer.flushPeriodically(flushInterval)
+	return writer
+}
+
+// add calls onWritten, unless it's nil, once the batch of the entry was written or failed to be written. The batch has
+// a copy of the entry since the caller keeps changing it, e.g. the deduplicator merges the duplicates into it, while the
+// batch is flushed by another goroutine. The id of the entry is thus only assigned to the copy.
+func (writer *entryBatchWriter) add(entry *tapApi.MizuEntry, onWritten func(isWritten bool)) {
+	batchedEntry := *entry
+	writer.mutex.Lock()
+	writer.batch = append(writer.batch, &batchedEntry)
+	writer.onWritten = append(writer.onWritten, onWritten)
+	if len(writer.batch) < writer.batchSize {
+		writer.mutex.Unlock()
+		return
+	}
+	notify, _ := writer.flushLocked()
+	writer.mutex.Unlock()
+	notify()
+}
+
+func (writer *entryBatchWriter) flush() error {
+	writer.mutex.Lock()
+	notify, err := writer.flushLocked()
+	writer.mutex.Unlock()
+	notify()
+	return err
+}
+
+// flushLocked returns the notification of the callbacks of the written batch, it's called once the lock is released
+// so a slow callback doesn't hold the next writes
+func (writer *entryBatchWriter) flushLocked() (func(), error) {
+	if len(writer.batch) == 0 {
+		return func() {}, nil
+	}
+	batch, onWritten := writer.batch, writer.onWritten
+	writer.batch = make([]*tapApi.MizuEntry, 0, writer.batchSize)
+	writer.onWritten = make([]func(isWritten bool), 0, writer.batchSize)
+	err := Entries.Create(batch...)
+	if err != nil {
+		logger.Log.Errorf("Failed writing a batch of %d entries: %v", len(batch), err)
+	}
+	return func() {
+		for _, callback := range onWritten {
+			if callback != nil {
+				callback(err == nil)
+			}
+		}
+	}, err
+}
+
+func (writer *entryBatchWriter) flushPeriodically(flushInterval time.Duration) {
+	defer close(writer.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			writer.flush()
+		case <-writer.stop:
+			return
+		}
+	}
+}
+
+// close stops the periodic flushes and writes the partial batch
+func (writer *entryBatchWriter) close() error {
+	close(writer.stop)
+	<-writer.stopped
+	return writer.flush()
+}
+
+// FlushEntries writes the entries of the partial batch, it's a no-op unless the writes are batched
+func FlushEntries() error {
+	if activeEntryBatchWriter == nil {
+		return nil
+	}
+	return activeEntryBatchWriter.flush()
+}
@@ -0,0 +1,188 @@
+package database_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/correlation"
+	"mizuserver/pkg/database"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// initBatchedDataBase initializes a database in a temporary directory, the writes are batched unless batchConfig is nil
+func initBatchedDataBase(tb testing.TB, batchConfig *shared.DatabaseWriteBatchConfig) {
+	directory, err := ioutil.TempDir("", "entries")
+	if err != nil {
+		tb.Fatalf("failed to create directory: %v", err)
+	}
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{DatabaseWriteBatch: batchConfig}
+	tb.Cleanup(func() {
+		database.Close()
+		config.Config = previousConfig
+		os.RemoveAll(directory)
+	})
+	database.InitDataBase(path.Join(directory, "entries.db"))
+}
+
+func countWrittenEntries() int64 {
+	var count int64
+	database.GetEntriesTable().Count(&count)
+	return count
+}
+
+func createTestEntries(first int, count int) {
+	for i := first; i < first+count; i++ {
+		database.CreateEntry(&tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), Entry: "{}"})
+	}
+}
+
+func TestBatchedEntriesWrittenOnceBatchFull(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 5, FlushIntervalMs: 60000})
+
+	createTestEntries(0, 4)
+	if count := countWrittenEntries(); count != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, count)
+	}
+	createTestEntries(4, 3)
+	if count := countWrittenEntries(); count != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 5, count)
+	}
+}
+
+func TestBatchedEntriesWrittenOnceIntervalPassed(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 100, FlushIntervalMs: 20})
+
+	createTestEntries(0, 3)
+	deadline := time.Now().Add(5 * time.Second)
+	for countWrittenEntries() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", 3, countWrittenEntries())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatchedEntriesWrittenOnClose(t *testing.T) {
+	directory, err := ioutil.TempDir("", "entries")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	previousConfig := config.Config
+	config.Config = &shared.MizuAgentConfig{DatabaseWriteBatch: &shared.DatabaseWriteBatchConfig{Size: 100, FlushIntervalMs: 60000}}
+	t.Cleanup(func() {
+		config.Config = previousConfig
+		os.RemoveAll(directory)
+	})
+	databasePath := path.Join(directory, "entries.db")
+	database.InitDataBase(databasePath)
+
+	createTestEntries(0, 3)
+	if err := database.Close(); err != nil {
+		t.Fatalf("failed closing the database: %v", err)
+	}
+
+	config.Config = previousConfig
+	database.InitDataBase(databasePath)
+	t.Cleanup(func() { database.Close() })
+	if count := countWrittenEntries(); count != 3 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 3, count)
+	}
+}
+
+func TestUpdateBatchedEntry(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 100, FlushIntervalMs: 60000})
+
+	entry := &tapApi.MizuEntry{EntryId: "entry-0", Entry: "{}"}
+	database.CreateEntry(entry)
+	entry.Entry = `{"updated":true}`
+	database.UpdateEntry(entry)
+
+	var entries []tapApi.MizuEntry
+	database.GetEntriesTable().Find(&entries)
+	if len(entries) != 1 || entries[0].Entry != `{"updated":true}` {
+		t.Errorf("unexpected result - expected: %v, actual: %v", `one {"updated":true} entry`, entries)
+	}
+}
+
+func TestBatchedEntriesMergedWithDuplicates(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 100, FlushIntervalMs: 1})
+	deduplicator := correlation.NewEntryDeduplicator(500)
+
+	const exchangesCount = 50
+	for i := 0; i < exchangesCount; i++ {
+		clientNodeEntry := &tapApi.MizuEntry{ProtocolName: "http", EntryId: fmt.Sprintf("client-node-%d", i), Path: fmt.Sprintf("/orders/%d", i), Timestamp: 1000, Entry: "{}"}
+		deduplicator.Deduplicate(clientNodeEntry, 1)
+		database.CreateEntry(clientNodeEntry)
+		time.Sleep(2 * time.Millisecond)
+
+		// the server node reports the exchange once the batch of the client node entry was flushed by the interval
+		serverNodeEntry := &tapApi.MizuEntry{ProtocolName: "http", EntryId: fmt.Sprintf("server-node-%d", i), Path: fmt.Sprintf("/orders/%d", i), Timestamp: 1010, Status: 200, Entry: "{}"}
+		stored, isDuplicate := deduplicator.Deduplicate(serverNodeEntry, 2)
+		if !isDuplicate {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", true, isDuplicate)
+		}
+		database.UpdateEntry(stored)
+	}
+
+	var entries []tapApi.MizuEntry
+	database.GetEntriesTable().Find(&entries)
+	if len(entries) != exchangesCount {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", exchangesCount, len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Status != 200 || !strings.HasPrefix(entry.EntryId, "client-node") {
+			t.Errorf("unexpected result - expected: %v, actual: %v", "the merged entry of the client node", entry)
+		}
+	}
+}
+
+func TestBatchedEntryNotifiedOnceWritten(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 2, FlushIntervalMs: 60000})
+
+	notified := make([]bool, 0)
+	onWritten := func(isWritten bool) { notified = append(notified, isWritten) }
+	database.CreateEntryNotifying(&tapApi.MizuEntry{EntryId: "entry-0", Entry: "{}"}, onWritten)
+	if len(notified) != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no notification before the batch is written", notified)
+	}
+	database.CreateEntryNotifying(&tapApi.MizuEntry{EntryId: "entry-1", Entry: "{}"}, onWritten)
+	if expected := []bool{true, true}; !reflect.DeepEqual(notified, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, notified)
+	}
+	if count := countWrittenEntries(); count != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, count)
+	}
+}
+
+func TestEntriesNotBatchedBelowTwo(t *testing.T) {
+	initBatchedDataBase(t, &shared.DatabaseWriteBatchConfig{Size: 1, FlushIntervalMs: 60000})
+
+	createTestEntries(0, 2)
+	if count := countWrittenEntries(); count != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, count)
+	}
+}
+
+func benchmarkCreateEntry(b *testing.B, batchConfig *shared.DatabaseWriteBatchConfig) {
+	initBatchedDataBase(b, batchConfig)
+	b.ResetTimer()
+	createTestEntries(0, b.N)
+	database.FlushEntries()
+}
+
+func BenchmarkCreateEntry(b *testing.B) {
+	benchmarkCreateEntry(b, nil)
+}
+
+func BenchmarkCreateEntryBatched(b *testing.B) {
+	benchmarkCreateEntry(b, &shared.DatabaseWriteBatchConfig{Size: 500})
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"mizuserver/pkg/config"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	defaultInMemoryEntriesCapacity = 10000
+	inMemoryEntriesPerContextCheck = 1000
+)
+
+// inMemoryEntriesStore is a ring buffer of the newest entries, the oldest entry is overwritten once it's full. The
+// entries are copied in and out so the callers never share an entry with the readers of the store.
+type inMemoryEntriesStore struct {
+	lock     sync.RWMutex
+	entries  []tapApi.MizuEntry // the entry of id is at (id - 1) % capacity, the ids have no gaps
+	capacity uint
+	lastId   uint
+}
+
+func newInMemoryEntriesStore(capacity uint) *inMemoryEntriesStore {
+	return &inMemoryEntriesStore{entries: make([]tapApi.MizuEntry, 0), capacity: capacity}
+}
+
+// IsInMemory returns whether the entries are kept in memory instead of the database
+func IsInMemory() bool {
+	_, isInMemory := Entries.(*inMemoryEntriesStore)
+	return isInMemory
+}
+
+func getInMemoryEntriesConfig() *shared.InMemoryEntriesConfig {
+	if config.Config == nil {
+		return nil
+	}
+	return config.Config.InMemoryEntries
+}
+
+// getInMemoryEntriesCapacity returns 0 when the entries are kept in the database
+func getInMemoryEntriesCapacity(inMemoryEntries *shared.InMemoryEntriesConfig) uint {
+	if inMemoryEntries == nil {
+		return 0
+	}
+	if inMemoryEntries.Capacity > 0 {
+		return uint(inMemoryEntries.Capacity)
+	}
+	return defaultInMemoryEntriesCapacity
+}
+
+func (store *inMemoryEntriesStore) Create(entries ...*tapApi.MizuEntry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	now := time.Now()
+	for _, entry := range entries {
+		store.lastId++
+		entry.ID, entry.CreatedAt, entry.UpdatedAt = store.lastId, now, now
+		if uint(len(store.entries)) < store.capacity {
+			store.entries = append(store.entries, *entry)
+		} else {
+			store.entries[store.index(entry.ID)] = *entry
+		}
+	}
+	return nil
+}
+
+// Save is a no-op once the entry was evicted
+func (store *inMemoryEntriesStore) Save(entry *tapApi.MizuEntry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if entry.ID < store.firstId() || entry.ID > store.lastId {
+		return nil
+	}
+	entry.UpdatedAt = time.Now()
+	store.entries[store.index(entry.ID)] = *entry
+	return nil
+}
+
+// Find scans the entries from the oldest, the scan stops with the error of the context once it's done
+func (store *inMemoryEntriesStore) Find(ctx context.Context, query *EntriesQuery) ([]tapApi.MizuEntry, error) {
+	entries, err := store.findMatching(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case query.OrderBy == OrderByTimestamp && query.isDescending():
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp > entries[j].Timestamp })
+	case query.OrderBy == OrderByTimestamp:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+	case query.OrderBy == OrderById && query.isDescending():
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+// findMatching returns the matching entries by their ids
+func (store *inMemoryEntriesStore) findMatching(ctx context.Context, query *EntriesQuery) ([]tapApi.MizuEntry, error) {
+	// the first entries by their ids are the only ones needed
+	isLimitedScan := query.Limit > 0 && query.OrderBy == OrderById && !query.isDescending()
+
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	entries := make([]tapApi.MizuEntry, 0)
+	for id := store.firstId(); id <= store.lastId; id++ {
+		if (id-store.firstId())%inMemoryEntriesPerContextCheck == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		entry := &store.entries[store.index(id)]
+		if matchesAll(entry, query.Conditions) {
+			entries = append(entries, *entry)
+			if isLimitedScan && len(entries) == query.Limit {
+				break
+			}
+		}
+	}
+	return entries, nil
+}
+
+// FindByEntryId scans the entries from the newest
+func (store *inMemoryEntriesStore) FindByEntryId(entryId string) (*tapApi.MizuEntry, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	for id := store.lastId; id >= store.firstId(); id-- {
+		if entry := store.entries[store.index(id)]; entry.EntryId == entryId {
+			return &entry, nil
+		}
+	}
+	return nil, ErrEntryNotFound
+}
+
+// firstId is the id of the oldest entry kept, it's above lastId when there are no entries
+func (store *inMemoryEntriesStore) firstId() uint {
+	return store.lastId - uint(len(store.entries)) + 1
+}
+
+func (store *inMemoryEntriesStore) index(id uint) uint {
+	return (id - 1) % store.capacity
+}
+
+func matchesAll(entry *tapApi.MizuEntry, conditions []Condition) bool {
+	for _, condition := range conditions {
+		if !condition.Matches(entry) {
+			return false
+		}
+	}
+	return true
+}
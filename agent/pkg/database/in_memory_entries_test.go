@@ -0,0 +1,162 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/database"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func initInMemoryDataBase(t *testing.T, agentConfig *shared.MizuAgentConfig) string {
+	directory, err := ioutil.TempDir("", "entries")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	previousConfig := config.Config
+	config.Config = agentConfig
+	t.Cleanup(func() {
+		database.Close()
+		config.Config = previousConfig
+		os.RemoveAll(directory)
+	})
+	databasePath := path.Join(directory, "entries.db")
+	database.InitDataBase(databasePath)
+	return databasePath
+}
+
+func getStoredEntryIds(t *testing.T) []string {
+	entries, err := database.Entries.Find(context.Background(), &database.EntriesQuery{OrderBy: database.OrderById})
+	if err != nil {
+		t.Fatalf("failed finding the entries: %v", err)
+	}
+	entryIds := make([]string, 0)
+	for _, entry := range entries {
+		entryIds = append(entryIds, entry.EntryId)
+	}
+	return entryIds
+}
+
+func TestInMemoryEntriesEvictOldest(t *testing.T) {
+	databasePath := initInMemoryDataBase(t, &shared.MizuAgentConfig{InMemoryEntries: &shared.InMemoryEntriesConfig{Capacity: 3}})
+	if !database.IsInMemory() {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", true, false)
+	}
+
+	createTestEntries(0, 2)
+	if expected, entryIds := []string{"entry-0", "entry-1"}, getStoredEntryIds(t); !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+	createTestEntries(2, 5)
+	if expected, entryIds := []string{"entry-4", "entry-5", "entry-6"}, getStoredEntryIds(t); !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+
+	if entry, err := database.Entries.FindByEntryId("entry-5"); err != nil || entry.EntryId != "entry-5" {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "entry-5", entry, err)
+	}
+	if _, err := database.Entries.FindByEntryId("entry-3"); err != database.ErrEntryNotFound {
+		t.Errorf("unexpected result - expected: %v, actual: %v", database.ErrEntryNotFound, err)
+	}
+	if _, err := os.Stat(databasePath); !os.IsNotExist(err) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no database file", err)
+	}
+	if database.DB != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no database", database.DB)
+	}
+}
+
+func TestInMemoryBatchedEntriesEvictOldest(t *testing.T) {
+	initInMemoryDataBase(t, &shared.MizuAgentConfig{
+		InMemoryEntries:    &shared.InMemoryEntriesConfig{Capacity: 4},
+		DatabaseWriteBatch: &shared.DatabaseWriteBatchConfig{Size: 3, FlushIntervalMs: 60000},
+	})
+
+	createTestEntries(0, 7)
+	if err := database.FlushEntries(); err != nil {
+		t.Fatalf("failed flushing the entries: %v", err)
+	}
+	expected := make([]string, 0)
+	for i := 3; i < 7; i++ {
+		expected = append(expected, fmt.Sprintf("entry-%d", i))
+	}
+	if entryIds := getStoredEntryIds(t); !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+}
+
+func TestInMemoryEntriesDefaultCapacity(t *testing.T) {
+	initInMemoryDataBase(t, &shared.MizuAgentConfig{InMemoryEntries: &shared.InMemoryEntriesConfig{}})
+
+	createTestEntries(0, 20)
+	if entryIds := getStoredEntryIds(t); len(entryIds) != 20 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 20, len(entryIds))
+	}
+}
+
+func TestEntriesNotInMemoryByDefault(t *testing.T) {
+	databasePath := initInMemoryDataBase(t, &shared.MizuAgentConfig{})
+
+	if database.IsInMemory() {
+		t.Errorf("unexpected result - expected: %v, actual: %v", false, true)
+	}
+	if _, err := os.Stat(databasePath); err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a database file", err)
+	}
+}
+
+func TestInMemoryEntriesFind(t *testing.T) {
+	initInMemoryDataBase(t, &shared.MizuAgentConfig{InMemoryEntries: &shared.InMemoryEntriesConfig{Capacity: 4}})
+
+	for i, timestamp := range []int64{30, 10, 40, 20, 50} {
+		database.CreateEntry(&tapApi.MizuEntry{EntryId: fmt.Sprintf("entry-%d", i), ProtocolName: "http", Timestamp: timestamp})
+	}
+	entries, err := database.Entries.Find(context.Background(), &database.EntriesQuery{
+		Conditions: []database.Condition{database.TimestampCondition(">", 10)},
+		OrderBy:    database.OrderByTimestamp,
+		Order:      database.OrderDesc,
+		Limit:      2,
+	})
+	if err != nil {
+		t.Fatalf("failed finding the entries: %v", err)
+	}
+	entryIds := make([]string, 0)
+	for _, entry := range entries {
+		entryIds = append(entryIds, entry.EntryId)
+	}
+	if expected := []string{"entry-4", "entry-2"}; !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := database.Entries.Find(ctx, &database.EntriesQuery{}); err != context.Canceled {
+		t.Errorf("unexpected result - expected: %v, actual: %v", context.Canceled, err)
+	}
+}
+
+func TestInMemoryEntriesUpdate(t *testing.T) {
+	initInMemoryDataBase(t, &shared.MizuAgentConfig{InMemoryEntries: &shared.InMemoryEntriesConfig{Capacity: 2}})
+
+	entry := &tapApi.MizuEntry{EntryId: "entry-0", Entry: "{}"}
+	database.CreateEntry(entry)
+	entry.Entry = `{"updated":true}`
+	database.UpdateEntry(entry)
+	if stored, err := database.Entries.FindByEntryId("entry-0"); err != nil || stored.Entry != `{"updated":true}` {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", `{"updated":true}`, stored, err)
+	}
+
+	// an evicted entry isn't stored again
+	createTestEntries(1, 2)
+	database.UpdateEntry(entry)
+	if expected, entryIds := []string{"entry-1", "entry-2"}, getStoredEntryIds(t); !reflect.DeepEqual(entryIds, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, entryIds)
+	}
+}
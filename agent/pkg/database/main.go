@@ -1,7 +1,8 @@
 package database
 
 import (
-	"fmt"
+	"context"
+	"mizuserver/pkg/config"
 	"mizuserver/pkg/utils"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"github.com/up9inc/mizu/shared"
+	loggerShared "github.com/up9inc/mizu/shared/logger"
 	tapApi "github.com/up9inc/mizu/tap/api"
 )
 
@@ -40,39 +43,115 @@ func GetEntriesTable() *gorm.DB {
 }
 
 func CreateEntry(entry *tapApi.MizuEntry) {
+	CreateEntryNotifying(entry, nil)
+}
+
+// CreateEntryNotifying calls onWritten, unless it's nil, once the entry was written or wasn't. When the writes are
+// batched it's only called once the batch of the entry was flushed, so an entry isn't acknowledged before it's stored.
+func CreateEntryNotifying(entry *tapApi.MizuEntry, onWritten func(isWritten bool)) {
+	if IsDBLocked {
+		if onWritten != nil {
+			onWritten(false)
+		}
+		return
+	}
+	if activeEntryBatchWriter != nil {
+		activeEntryBatchWriter.add(entry, onWritten)
+		return
+	}
+	err := Entries.Create(entry)
+	if onWritten != nil {
+		onWritten(err == nil)
+	}
+}
+
+func UpdateEntry(entry *tapApi.MizuEntry) {
 	if IsDBLocked {
 		return
 	}
-	GetEntriesTable().Create(entry)
+	// an entry still pending in the batch has no id yet, saving it would insert it twice
+	_ = FlushEntries()
+	if entry.ID == 0 {
+		// the batch wrote a copy of the entry, the id was assigned to the copy
+		stored, err := Entries.FindByEntryId(entry.EntryId)
+		if err != nil {
+			return
+		}
+		entry.ID, entry.CreatedAt = stored.ID, stored.CreatedAt
+	}
+	_ = Entries.Save(entry)
 }
 
+// InitDataBase opens the database at databasePath, unless the entries are configured to be kept in memory. The
+// entries kept in memory skip the database entirely, it returns nil then.
 func InitDataBase(databasePath string) *gorm.DB {
+	stopEnforcingEntriesCount()
+	if activeEntryBatchWriter != nil {
+		_ = activeEntryBatchWriter.close()
+		activeEntryBatchWriter = nil
+	}
+	maxEntries := int64(0)
+	var batchConfig *shared.DatabaseWriteBatchConfig
+	if config.Config != nil {
+		maxEntries = config.Config.MaxEntries
+		batchConfig = config.Config.DatabaseWriteBatch
+	}
+
+	if inMemoryCapacity := getInMemoryEntriesCapacity(getInMemoryEntriesConfig()); inMemoryCapacity > 0 {
+		// the capacity bounds the entries count, and there's no file to bound the size of
+		DB, DBPath = nil, ""
+		Entries = newInMemoryEntriesStore(inMemoryCapacity)
+		activeEntryBatchWriter = newEntryBatchWriter(batchConfig)
+		return nil
+	}
+
 	DBPath = databasePath
 	DB, _ = gorm.Open(sqlite.Open(databasePath), &gorm.Config{
 		Logger: &utils.TruncatingLogger{LogLevel: logger.Warn, SlowThreshold: 500 * time.Millisecond},
 	})
-	_ = DB.AutoMigrate(&tapApi.MizuEntry{}) // this will ensure table is created
-	go StartEnforcingDatabaseSize()
+	Entries = databaseEntriesStore{}
+	_ = DB.AutoMigrate(&tapApi.MizuEntry{}, &tapStatusRecord{}) // this will ensure the tables are created
+	// the oldest entries are deleted by their insertion time when the entries count is enforced
+	DB.Exec("CREATE INDEX IF NOT EXISTS idx_mizu_entries_created_at ON mizu_entries (created_at)")
+	// the merged duplicates of the batched entries are saved by their entry id
+	DB.Exec("CREATE INDEX IF NOT EXISTS idx_mizu_entries_entry_id ON mizu_entries (entryId)")
+	StartEnforcingDatabaseSize() // watches the file before returning, its path may change by the next init
+	activeEntryBatchWriter = newEntryBatchWriter(batchConfig)
+	startEnforcingEntriesCount(maxEntries)
 	return DB
 }
 
+// IsInitialized returns whether the entries can be stored, either in the database or in memory
+func IsInitialized() bool {
+	return DB != nil || IsInMemory()
+}
+
+// Close closes the database once the last entries were written, it's a no-op when the database wasn't initialized
+func Close() error {
+	stopEnforcingEntriesCount()
+	if activeEntryBatchWriter != nil {
+		_ = activeEntryBatchWriter.close() // a failed batch is logged by the writer
+		activeEntryBatchWriter = nil
+	}
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 func GetEntriesFromDb(timeFrom time.Time, timeTo time.Time, protocolName *string) []tapApi.MizuEntry {
-	order := OrderDesc
-	protocolNameCondition := "1 = 1"
+	query := &EntriesQuery{Conditions: []Condition{createdAtRangeCondition(timeFrom, timeTo)}, OrderBy: OrderByTimestamp}
 	if protocolName != nil {
-		protocolNameCondition = fmt.Sprintf("protocolName = '%s'", *protocolName)
+		query.Conditions = append(query.Conditions, ProtocolCondition(*protocolName))
 	}
 
-	var entries []tapApi.MizuEntry
-	GetEntriesTable().
-		Where(protocolNameCondition).
-		Where(fmt.Sprintf("created_at BETWEEN '%s' AND '%s'", timeFrom.Format(TimeFormat), timeTo.Format(TimeFormat))).
-		Order(fmt.Sprintf("timestamp %s", order)).
-		Find(&entries)
-
-	if len(entries) > 0 {
-		// the entries always order from oldest to newest so we should revers
-		utils.ReverseSlice(entries)
+	entries, err := Entries.Find(context.Background(), query)
+	if err != nil {
+		loggerShared.Log.Errorf("Failed getting the entries from %v to %v: %v", timeFrom, timeTo, err)
 	}
 	return entries
 }
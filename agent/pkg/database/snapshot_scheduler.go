@@ -0,0 +1,183 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+const (
+	snapshotTimeFormat   = "20060102T150405.000Z"
+	snapshotFilePrefix   = "entries-"
+	snapshotFileSuffix   = ".db"
+	snapshotPagesPerStep = 256
+	snapshotStepDelay    = 5 * time.Millisecond
+)
+
+var ActiveSnapshotScheduler *SnapshotScheduler
+
+// SnapshotScheduler copies the database with the online backup api of SQLite, on connections of its own. The copy is
+// made a few pages at a time so writers wait for one step at most, a copy that keeps restarting because of the writes
+// is finished in a single step.
+type SnapshotScheduler struct {
+	databasePath string
+	directory    string
+	interval     time.Duration
+	maxSnapshots int
+	stop         chan struct{}
+	stopOnce     sync.Once
+	wg           sync.WaitGroup
+}
+
+// NewSnapshotScheduler returns nil when snapshots aren't configured
+func NewSnapshotScheduler(config *shared.DatabaseSnapshotConfig, databasePath string) (*SnapshotScheduler, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Directory == "" {
+		return nil, fmt.Errorf("database snapshot directory must be set")
+	}
+	if config.IntervalMs <= 0 {
+		return nil, fmt.Errorf("database snapshots must have a positive interval")
+	}
+	if config.MaxSnapshots < 0 {
+		return nil, fmt.Errorf("database snapshots max count can't be negative")
+	}
+	if err := os.MkdirAll(config.Directory, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &SnapshotScheduler{
+		databasePath: databasePath,
+		directory:    config.Directory,
+		interval:     time.Duration(config.IntervalMs) * time.Millisecond,
+		maxSnapshots: config.MaxSnapshots,
+		stop:         make(chan struct{}),
+	}, nil
+}
+
+func (scheduler *SnapshotScheduler) Start() {
+	scheduler.wg.Add(1)
+	go scheduler.schedule()
+}
+
+// Stop ends the scheduling and waits for the running snapshot
+func (scheduler *SnapshotScheduler) Stop() {
+	scheduler.stopOnce.Do(func() { close(scheduler.stop) })
+	scheduler.wg.Wait()
+}
+
+func (scheduler *SnapshotScheduler) schedule() {
+	defer scheduler.wg.Done()
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			snapshotPath, err := scheduler.Snapshot(now)
+			if err != nil {
+				logger.Log.Errorf("Failed taking a database snapshot: %v", err)
+				continue
+			}
+			logger.Log.Infof("Wrote database snapshot %s", snapshotPath)
+		case <-scheduler.stop:
+			return
+		}
+	}
+}
+
+// Snapshot writes a snapshot named by now and removes the oldest snapshots beyond the max count, it returns the path
+// of the snapshot
+func (scheduler *SnapshotScheduler) Snapshot(now time.Time) (string, error) {
+	snapshotPath := path.Join(scheduler.directory, fmt.Sprintf("%s%s%s", snapshotFilePrefix, now.UTC().Format(snapshotTimeFormat), snapshotFileSuffix))
+	// the copy is written to a temporary file first so a partial snapshot is never picked up
+	temporaryPath := snapshotPath + ".tmp"
+	if err := backupDatabase(scheduler.databasePath, temporaryPath); err != nil {
+		os.Remove(temporaryPath)
+		return "", err
+	}
+	if err := os.Rename(temporaryPath, snapshotPath); err != nil {
+		return "", err
+	}
+
+	if err := scheduler.removeOldSnapshots(); err != nil {
+		logger.Log.Errorf("Failed removing old database snapshots: %v", err)
+	}
+	return snapshotPath, nil
+}
+
+func backupDatabase(sourcePath string, destinationPath string) error {
+	sqliteDriver := &sqlite3.SQLiteDriver{}
+	source, err := sqliteDriver.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := sqliteDriver.Open(destinationPath)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	backup, err := destination.(*sqlite3.SQLiteConn).Backup("main", source.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+	maxSteps := 0
+	for steps := 0; ; steps++ {
+		pages := snapshotPagesPerStep
+		if maxSteps > 0 && steps >= maxSteps {
+			pages = -1
+		}
+		// a busy or locked source isn't an error, the step is retried
+		done, err := backup.Step(pages)
+		if err != nil {
+			backup.Close()
+			return err
+		}
+		if done {
+			break
+		}
+		if maxSteps == 0 {
+			maxSteps = 4 * (backup.PageCount()/snapshotPagesPerStep + 1)
+		}
+		time.Sleep(snapshotStepDelay)
+	}
+	return backup.Finish()
+}
+
+func (scheduler *SnapshotScheduler) removeOldSnapshots() error {
+	if scheduler.maxSnapshots == 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(scheduler.directory)
+	if err != nil {
+		return err
+	}
+
+	var snapshotNames []string
+	for _, file := range files {
+		if name := file.Name(); strings.HasPrefix(name, snapshotFilePrefix) && strings.HasSuffix(name, snapshotFileSuffix) {
+			snapshotNames = append(snapshotNames, name)
+		}
+	}
+	// the names sort by the time of the snapshots
+	sort.Strings(snapshotNames)
+	for len(snapshotNames) > scheduler.maxSnapshots {
+		if err := os.Remove(path.Join(scheduler.directory, snapshotNames[0])); err != nil {
+			return err
+		}
+		snapshotNames = snapshotNames[1:]
+	}
+	return nil
+}
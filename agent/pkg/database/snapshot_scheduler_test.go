@@ -0,0 +1,140 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/database"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDatabase(t *testing.T, databasePath string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(databasePath), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&tapApi.MizuEntry{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func insertEntries(t *testing.T, db *gorm.DB, count int) {
+	for i := 0; i < count; i++ {
+		if err := db.Create(&tapApi.MizuEntry{Entry: "{}", Method: "GET", Path: "/"}).Error; err != nil {
+			t.Errorf("failed to insert entry: %v", err)
+			return
+		}
+	}
+}
+
+func countEntries(t *testing.T, databasePath string) int64 {
+	db := openTestDatabase(t, databasePath)
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+
+	var integrity string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&integrity).Error; err != nil || integrity != "ok" {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "ok", integrity, err)
+	}
+	var count int64
+	db.Model(&tapApi.MizuEntry{}).Count(&count)
+	return count
+}
+
+func newTestScheduler(t *testing.T, maxSnapshots int) (*database.SnapshotScheduler, *gorm.DB, string) {
+	directory, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	databasePath := path.Join(directory, "entries.db")
+	db := openTestDatabase(t, databasePath)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	config := &shared.DatabaseSnapshotConfig{Directory: path.Join(directory, "snapshots"), IntervalMs: 1000, MaxSnapshots: maxSnapshots}
+	scheduler, err := database.NewSnapshotScheduler(config, databasePath)
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	return scheduler, db, config.Directory
+}
+
+func TestSnapshot(t *testing.T) {
+	scheduler, db, _ := newTestScheduler(t, 0)
+	insertEntries(t, db, 50)
+
+	// the ingestion goes on while the snapshot is taken
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		insertEntries(t, db, 50)
+	}()
+	snapshotPath, err := scheduler.Snapshot(time.Now())
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+
+	if count := countEntries(t, snapshotPath); count < 50 || count > 100 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "50 to 100 entries", count)
+	}
+}
+
+func TestSnapshotRotation(t *testing.T) {
+	scheduler, db, directory := newTestScheduler(t, 2)
+	insertEntries(t, db, 1)
+
+	start := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	var snapshotPaths []string
+	for i := 0; i < 4; i++ {
+		snapshotPath, err := scheduler.Snapshot(start.Add(time.Duration(i) * time.Minute))
+		if err != nil {
+			t.Fatalf("failed to take snapshot: %v", err)
+		}
+		snapshotPaths = append(snapshotPaths, snapshotPath)
+	}
+
+	files, _ := ioutil.ReadDir(directory)
+	if len(files) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(files))
+	}
+	for i, file := range files {
+		if expected := path.Base(snapshotPaths[i+2]); file.Name() != expected {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected, file.Name())
+		}
+	}
+	if count := countEntries(t, snapshotPaths[3]); count != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, count)
+	}
+}
+
+func TestNewSnapshotSchedulerInvalid(t *testing.T) {
+	tests := []*shared.DatabaseSnapshotConfig{
+		{IntervalMs: 1000},
+		{Directory: os.TempDir()},
+		{Directory: os.TempDir(), IntervalMs: 1000, MaxSnapshots: -1},
+	}
+
+	for _, config := range tests {
+		if _, err := database.NewSnapshotScheduler(config, "entries.db"); err == nil {
+			t.Errorf("unexpected result - expected an error, actual: %v", config)
+		}
+	}
+	if scheduler, err := database.NewSnapshotScheduler(nil, "entries.db"); scheduler != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, scheduler, err)
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/up9inc/mizu/shared"
+	"gorm.io/gorm/clause"
+)
+
+const tapStatusRecordId = 1
+
+// tapStatusRecord keeps the last known tap status in a single row, so a restarted api server reports the tapped pods
+// before the tapper syncer does
+type tapStatusRecord struct {
+	ID     uint   `gorm:"primarykey"`
+	Status string `gorm:"column:status"` // the json of the tap status
+}
+
+func (tapStatusRecord) TableName() string {
+	return "mizu_tap_status"
+}
+
+// SaveTapStatus replaces the persisted tap status, it's a no-op when the database wasn't initialized
+func SaveTapStatus(tapStatus *shared.TapStatus) error {
+	if DB == nil {
+		return nil
+	}
+	statusJson, err := json.Marshal(tapStatus)
+	if err != nil {
+		return err
+	}
+	// an upsert, saving the first status by its id would look it up and log the missing record as an error
+	return DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&tapStatusRecord{ID: tapStatusRecordId, Status: string(statusJson)}).Error
+}
+
+// LoadTapStatus returns the persisted tap status, nil when none was persisted or the database wasn't initialized
+func LoadTapStatus() (*shared.TapStatus, error) {
+	if DB == nil {
+		return nil, nil
+	}
+	var record tapStatusRecord
+	result := DB.Limit(1).Find(&record, tapStatusRecordId)
+	if result.Error != nil {
+		return nil, result.Error
+	} else if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	tapStatus := &shared.TapStatus{}
+	if err := json.Unmarshal([]byte(record.Status), tapStatus); err != nil {
+		return nil, err
+	}
+	return tapStatus, nil
+}
@@ -0,0 +1,45 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/database"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+func TestTapStatusRestoredAfterRestart(t *testing.T) {
+	directory, err := ioutil.TempDir("", "tap-status")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+	databasePath := path.Join(directory, "entries.db")
+	database.InitDataBase(databasePath)
+
+	if tapStatus, err := database.LoadTapStatus(); err != nil || tapStatus != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, tapStatus, err)
+	}
+
+	savedStatus := &shared.TapStatus{Pods: []shared.PodInfo{{Namespace: "shop", Name: "carts-0"}}, UpdatedAt: 1000}
+	if err := database.SaveTapStatus(&shared.TapStatus{Pods: []shared.PodInfo{{Namespace: "shop", Name: "orders-0"}}}); err != nil {
+		t.Fatalf("failed saving the tap status: %v", err)
+	}
+	if err := database.SaveTapStatus(savedStatus); err != nil {
+		t.Fatalf("failed saving the tap status: %v", err)
+	}
+
+	// the api server restarts
+	if err := database.Close(); err != nil {
+		t.Fatalf("failed closing the database: %v", err)
+	}
+	database.InitDataBase(databasePath)
+
+	tapStatus, err := database.LoadTapStatus()
+	if err != nil || !reflect.DeepEqual(tapStatus, savedStatus) {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", savedStatus, tapStatus, err)
+	}
+}
@@ -0,0 +1,128 @@
+package filterExpression
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind     tokenKind
+	value    string
+	position int
+}
+
+// SyntaxError describes why an expression can't be parsed, Position is the 0 based offset of the offending character
+type SyntaxError struct {
+	Message  string
+	Position int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func tokenize(expression string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			i++
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, value: "(", position: i})
+			i++
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, value: ")", position: i})
+			i++
+		case char == '"':
+			value, end, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value, position: i})
+			i = end
+		case unicode.IsDigit(char) || (char == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: string(runes[start:i]), position: start})
+		case unicode.IsLetter(char) || char == '_':
+			start := i
+			for i < len(runes) && isIdentifierRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, value: string(runes[start:i]), position: start})
+		default:
+			operator := matchOperator(runes[i:])
+			if operator == "" {
+				return nil, &SyntaxError{Message: fmt.Sprintf("unexpected character '%c'", char), Position: i}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, value: operator, position: i})
+			i += len(operator)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, position: len(runes)}), nil
+}
+
+// IsIdentifier returns whether the text is a single identifier, e.g. a key that can follow a field prefix
+func IsIdentifier(text string) bool {
+	for i, char := range text {
+		if !isIdentifierRune(char) || (i == 0 && !unicode.IsLetter(char) && char != '_') {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// isIdentifierRune also accepts the characters of label keys, such as app.kubernetes.io/part-of
+func isIdentifierRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' || char == '.' || char == '-' || char == '/'
+}
+
+func readString(runes []rune, start int) (string, int, error) {
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 >= len(runes) {
+				return "", 0, &SyntaxError{Message: "unterminated escape sequence", Position: i}
+			}
+			i++
+			value.WriteRune(runes[i])
+		case '"':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteRune(runes[i])
+		}
+	}
+	return "", 0, &SyntaxError{Message: "unterminated string", Position: start}
+}
+
+func matchOperator(runes []rune) string {
+	for _, operator := range comparisonOperators {
+		if strings.HasPrefix(string(runes), operator) {
+			return operator
+		}
+	}
+	return ""
+}
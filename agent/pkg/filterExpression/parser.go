@@ -0,0 +1,354 @@
+package filterExpression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	numberField
+	boolField
+)
+
+type field struct {
+	column string
+	kind   fieldKind
+	value  func(entry *tapApi.MizuEntry) interface{} // of the column, a float64 for the number fields
+}
+
+// fields maps the names usable in expressions to the entries table columns
+var fields = map[string]field{
+	"protocol":         {column: "protocolName", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.ProtocolName }},
+	"method":           {column: "method", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.Method }},
+	"path":             {column: "path", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.Path }},
+	"url":              {column: "url", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.Url }},
+	"service":          {column: "service", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.Service }},
+	"status":           {column: "status", kind: numberField, value: func(entry *tapApi.MizuEntry) interface{} { return float64(entry.Status) }},
+	"source":           {column: "resolvedSource", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.ResolvedSource }},
+	"destination":      {column: "resolvedDestination", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.ResolvedDestination }},
+	"destinationLabel": {column: "destinationLabel", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.DestinationLabel }},
+	"sourceIp":         {column: "sourceIp", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.SourceIp }},
+	"destIp":           {column: "destinationIp", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.DestinationIp }},
+	"elapsedTime":      {column: "elapsedTime", kind: numberField, value: func(entry *tapApi.MizuEntry) interface{} { return float64(entry.ElapsedTime) }},
+	"requestSize":      {column: "requestSize", kind: numberField, value: func(entry *tapApi.MizuEntry) interface{} { return float64(entry.RequestSize) }},
+	"responseSize":     {column: "responseSize", kind: numberField, value: func(entry *tapApi.MizuEntry) interface{} { return float64(entry.ResponseSize) }},
+	"outgoing":         {column: "isOutgoing", kind: boolField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.IsOutgoing }},
+	"credentialLeak":   {column: "credentialLeak", kind: boolField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.CredentialLeak }},
+	"piiTypes":         {column: "piiTypes", kind: stringField, value: func(entry *tapApi.MizuEntry) interface{} { return entry.PiiTypes }},
+}
+
+type labelColumn struct {
+	column string
+	labels func(entry *tapApi.MizuEntry) tapApi.EntryLabels
+}
+
+// labelColumns maps the prefixes of the pod label fields, e.g. destinationLabels.team, and of the promoted header
+// fields, e.g. fields.tenantId, to the columns holding them
+var labelColumns = map[string]labelColumn{
+	"sourceLabels":      {column: "sourceLabels", labels: func(entry *tapApi.MizuEntry) tapApi.EntryLabels { return entry.SourceLabels }},
+	"destinationLabels": {column: "destinationLabels", labels: func(entry *tapApi.MizuEntry) tapApi.EntryLabels { return entry.DestinationLabels }},
+	"fields":            {column: "fields", labels: func(entry *tapApi.MizuEntry) tapApi.EntryLabels { return entry.Fields }},
+}
+
+// labelValueSQL extracts the value of a label from its column, the labels are stored as "\nkey=value\n" lines.
+// Entries without the label have an empty value.
+const labelValueSQL = `(CASE WHEN instr(IFNULL(%[1]s, ''), %[2]s) = 0 THEN '' ` +
+	`ELSE substr(%[1]s, instr(%[1]s, %[2]s) + length(%[2]s), instr(substr(%[1]s, instr(%[1]s, %[2]s) + length(%[2]s)), char(10)) - 1) END)`
+
+const containsOperator = "contains"
+
+// Expression is a parsed filter expression that can be applied to the entries table, or to the entries kept in memory
+type Expression interface {
+	// ToSQL returns a parameterized condition and its arguments
+	ToSQL() (string, []interface{})
+	// Matches returns whether the entry satisfies the condition of ToSQL
+	Matches(entry *tapApi.MizuEntry) bool
+}
+
+type binaryExpression struct {
+	operator string
+	left     Expression
+	right    Expression
+}
+
+func (e *binaryExpression) ToSQL() (string, []interface{}) {
+	leftSQL, leftArgs := e.left.ToSQL()
+	rightSQL, rightArgs := e.right.ToSQL()
+	return fmt.Sprintf("(%s %s %s)", leftSQL, strings.ToUpper(e.operator), rightSQL), append(leftArgs, rightArgs...)
+}
+
+func (e *binaryExpression) Matches(entry *tapApi.MizuEntry) bool {
+	if e.operator == "and" {
+		return e.left.Matches(entry) && e.right.Matches(entry)
+	}
+	return e.left.Matches(entry) || e.right.Matches(entry)
+}
+
+type notExpression struct {
+	operand Expression
+}
+
+func (e *notExpression) ToSQL() (string, []interface{}) {
+	operandSQL, args := e.operand.ToSQL()
+	return fmt.Sprintf("(NOT %s)", operandSQL), args
+}
+
+func (e *notExpression) Matches(entry *tapApi.MizuEntry) bool {
+	return !e.operand.Matches(entry)
+}
+
+type comparison struct {
+	field    field
+	operator string
+	value    interface{}
+}
+
+func (e *comparison) ToSQL() (string, []interface{}) {
+	if e.operator == containsOperator {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(e.value.(string))
+		return fmt.Sprintf(`%s LIKE ? ESCAPE '\'`, e.field.column), []interface{}{"%" + escaped + "%"}
+	}
+	operator := e.operator
+	if operator == "==" {
+		operator = "="
+	}
+	return fmt.Sprintf("%s %s ?", e.field.column, operator), []interface{}{e.value}
+}
+
+func (e *comparison) Matches(entry *tapApi.MizuEntry) bool {
+	value := e.field.value(entry)
+	switch e.operator {
+	case containsOperator:
+		// like the LIKE of sqlite, which ignores the case of ascii letters
+		return strings.Contains(strings.ToLower(value.(string)), strings.ToLower(e.value.(string)))
+	case "==":
+		return value == e.value
+	case "!=":
+		return value != e.value
+	}
+
+	number, operand := value.(float64), e.value.(float64)
+	switch e.operator {
+	case "<":
+		return number < operand
+	case "<=":
+		return number <= operand
+	case ">":
+		return number > operand
+	case ">=":
+		return number >= operand
+	}
+	return false
+}
+
+type parser struct {
+	tokens  []token
+	current int
+}
+
+/*
+ * Parse parses a filter expression such as: method == "POST" and (status >= 500 or path contains "/api")
+ * Comparisons are combined with and, or and not (in order of increasing precedence for not, and, or) and parentheses.
+ */
+func Parse(expression string) (Expression, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &SyntaxError{Message: "empty expression", Position: 0}
+	}
+
+	result, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, &SyntaxError{Message: fmt.Sprintf("unexpected '%s'", next.value), Position: next.position}
+	}
+	return result, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.current]
+	if t.kind != tokenEOF {
+		p.current++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdentifier && strings.EqualFold(t.value, keyword)
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{operator: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{operator: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.isKeyword("not") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpression{operand: operand}, nil
+	}
+
+	if p.peek().kind == tokenOpenParen {
+		openParen := p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closeParen := p.next(); closeParen.kind != tokenCloseParen {
+			if closeParen.kind == tokenEOF {
+				return nil, &SyntaxError{Message: "unclosed parenthesis", Position: openParen.position}
+			}
+			return nil, &SyntaxError{Message: fmt.Sprintf("expected ')' but found '%s'", closeParen.value), Position: closeParen.position}
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expression, error) {
+	fieldToken := p.next()
+	if fieldToken.kind != tokenIdentifier {
+		return nil, unexpectedTokenError(fieldToken, "a field name")
+	}
+	fieldDefinition, ok := lookupField(fieldToken.value)
+	if !ok {
+		return nil, &SyntaxError{Message: fmt.Sprintf("unknown field '%s'", fieldToken.value), Position: fieldToken.position}
+	}
+
+	operatorToken := p.next()
+	isContains := operatorToken.kind == tokenIdentifier && strings.EqualFold(operatorToken.value, containsOperator)
+	if operatorToken.kind != tokenOperator && !isContains {
+		return nil, unexpectedTokenError(operatorToken, "an operator")
+	}
+	operator := operatorToken.value
+	if isContains {
+		operator = containsOperator
+	}
+
+	if !isOperatorSupported(fieldDefinition, operator) {
+		return nil, &SyntaxError{Message: fmt.Sprintf("operator '%s' can't be used with field '%s'", operator, fieldToken.value), Position: operatorToken.position}
+	}
+
+	value, err := parseValue(fieldToken.value, fieldDefinition, operator, p.next())
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparison{field: fieldDefinition, operator: operator, value: value}, nil
+}
+
+func lookupField(name string) (field, bool) {
+	if fieldDefinition, ok := fields[name]; ok {
+		return fieldDefinition, true
+	}
+
+	separatorIndex := strings.Index(name, ".")
+	if separatorIndex < 0 || separatorIndex == len(name)-1 {
+		return field{}, false
+	}
+	labelColumn, ok := labelColumns[name[:separatorIndex]]
+	if !ok {
+		return field{}, false
+	}
+	key := name[separatorIndex+1:]
+	// label keys are made of identifier characters only, they can't break out of the quoted literal
+	marker := fmt.Sprintf("(char(10) || '%s=')", key)
+	value := func(entry *tapApi.MizuEntry) interface{} {
+		return labelColumn.labels(entry)[key]
+	}
+	return field{column: fmt.Sprintf(labelValueSQL, labelColumn.column, marker), kind: stringField, value: value}, true
+}
+
+func isOperatorSupported(fieldDefinition field, operator string) bool {
+	switch operator {
+	case containsOperator:
+		return fieldDefinition.kind == stringField
+	case "==", "!=":
+		return true
+	default:
+		return fieldDefinition.kind == numberField
+	}
+}
+
+func parseValue(fieldName string, fieldDefinition field, operator string, valueToken token) (interface{}, error) {
+	switch fieldDefinition.kind {
+	case stringField:
+		if valueToken.kind == tokenString {
+			return valueToken.value, nil
+		}
+	case numberField:
+		if valueToken.kind == tokenNumber {
+			number, err := strconv.ParseFloat(valueToken.value, 64)
+			if err != nil {
+				return nil, &SyntaxError{Message: fmt.Sprintf("invalid number '%s'", valueToken.value), Position: valueToken.position}
+			}
+			return number, nil
+		}
+	case boolField:
+		if valueToken.kind == tokenIdentifier && (valueToken.value == "true" || valueToken.value == "false") {
+			return valueToken.value == "true", nil
+		}
+	}
+
+	if valueToken.kind == tokenEOF {
+		return nil, &SyntaxError{Message: fmt.Sprintf("missing value after '%s'", operator), Position: valueToken.position}
+	}
+	expectedKinds := map[fieldKind]string{stringField: "a string", numberField: "a number", boolField: "true or false"}
+	return nil, &SyntaxError{Message: fmt.Sprintf("field '%s' must be compared to %s", fieldName, expectedKinds[fieldDefinition.kind]), Position: valueToken.position}
+}
+
+func unexpectedTokenError(t token, expected string) error {
+	if t.kind == tokenEOF {
+		return &SyntaxError{Message: fmt.Sprintf("expected %s but the expression ended", expected), Position: t.position}
+	}
+	return &SyntaxError{Message: fmt.Sprintf("expected %s but found '%s'", expected, t.value), Position: t.position}
+}
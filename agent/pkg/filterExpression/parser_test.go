@@ -0,0 +1,156 @@
+package filterExpression_test
+
+import (
+	"mizuserver/pkg/filterExpression"
+	"reflect"
+	"strings"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestParseValid(t *testing.T) {
+	tests := []struct {
+		expression   string
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{expression: `method == "GET"`, expectedSQL: "method = ?", expectedArgs: []interface{}{"GET"}},
+		{expression: `status >= 500 and path contains "/api"`, expectedSQL: `(status >= ? AND path LIKE ? ESCAPE '\')`, expectedArgs: []interface{}{500.0, "%/api%"}},
+		{expression: `not outgoing == true or elapsedTime < 1.5`, expectedSQL: "((NOT isOutgoing = ?) OR elapsedTime < ?)", expectedArgs: []interface{}{true, 1.5}},
+		{expression: `service != "a" and (status == 404 or status == 500)`, expectedSQL: "(service != ? AND (status = ? OR status = ?))", expectedArgs: []interface{}{"a", 404.0, 500.0}},
+		{expression: `path contains "100%_\"x\""`, expectedSQL: `path LIKE ? ESCAPE '\'`, expectedArgs: []interface{}{`%100\%\_"x"%`}},
+		{expression: `requestSize > -1 AND responseSize <= 1024`, expectedSQL: "(requestSize > ? AND responseSize <= ?)", expectedArgs: []interface{}{-1.0, 1024.0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := filterExpression.Parse(test.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sql, args := expression.ToSQL()
+			if sql != test.expectedSQL {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedSQL, sql)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestParseLabelFields(t *testing.T) {
+	tests := []struct {
+		expression     string
+		expectedColumn string
+		expectedKey    string
+		expectedArgs   []interface{}
+	}{
+		{expression: `destinationLabels.team == "payments"`, expectedColumn: "destinationLabels", expectedKey: "'team='", expectedArgs: []interface{}{"payments"}},
+		{expression: `sourceLabels.app.kubernetes.io/part-of contains "shop"`, expectedColumn: "sourceLabels", expectedKey: "'app.kubernetes.io/part-of='", expectedArgs: []interface{}{"%shop%"}},
+		{expression: `fields.tenantId != "acme"`, expectedColumn: "fields", expectedKey: "'tenantId='", expectedArgs: []interface{}{"acme"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := filterExpression.Parse(test.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sql, args := expression.ToSQL()
+			if !strings.Contains(sql, test.expectedColumn) || !strings.Contains(sql, test.expectedKey) {
+				t.Errorf("unexpected result - expected: %v %v, actual: %v", test.expectedColumn, test.expectedKey, sql)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestParseOperatorPrecedence(t *testing.T) {
+	expression, err := filterExpression.Parse(`method == "A" or method == "B" and status == 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedSQL := "(method = ? OR (method = ? AND status = ?))"
+	if sql, _ := expression.ToSQL(); sql != expectedSQL {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedSQL, sql)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	entry := &tapApi.MizuEntry{
+		Method:            "POST",
+		Path:              "/API/orders",
+		Status:            503,
+		IsOutgoing:        true,
+		DestinationLabels: tapApi.EntryLabels{"team": "payments"},
+	}
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{expression: `method == "POST" and status >= 500`, expected: true},
+		{expression: `method == "GET" or status < 500`, expected: false},
+		{expression: `path contains "/api"`, expected: true},
+		{expression: `not outgoing == true`, expected: false},
+		{expression: `destinationLabels.team == "payments"`, expected: true},
+		{expression: `sourceLabels.team == ""`, expected: true},
+		{expression: `method != "POST" or (status == 503 and requestSize <= 0)`, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := filterExpression.Parse(test.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if matches := expression.Matches(entry); matches != test.expected {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, matches)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		expression       string
+		expectedPosition int
+	}{
+		{expression: ``, expectedPosition: 0},
+		{expression: `method = "GET"`, expectedPosition: 7},
+		{expression: `methd == "GET"`, expectedPosition: 0},
+		{expression: `method == "GET`, expectedPosition: 10},
+		{expression: `status == "500"`, expectedPosition: 10},
+		{expression: `method > "GET"`, expectedPosition: 7},
+		{expression: `status contains "5"`, expectedPosition: 7},
+		{expression: `status >=`, expectedPosition: 9},
+		{expression: `(status == 500 and method == "GET"`, expectedPosition: 0},
+		{expression: `status == 500 method == "GET"`, expectedPosition: 14},
+		{expression: `status == 500 and`, expectedPosition: 17},
+		{expression: `status == 500)`, expectedPosition: 13},
+		{expression: `outgoing == yes`, expectedPosition: 12},
+		{expression: `path == "a" # comment`, expectedPosition: 12},
+		{expression: `podLabels.team == "a"`, expectedPosition: 0},
+		{expression: `destinationLabels.team > "a"`, expectedPosition: 23},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			_, err := filterExpression.Parse(test.expression)
+			syntaxError, ok := err.(*filterExpression.SyntaxError)
+			if !ok {
+				t.Fatalf("expected a syntax error, actual: %v", err)
+			}
+			if syntaxError.Position != test.expectedPosition {
+				t.Errorf("unexpected result - expected: %v, actual: %v (%s)", test.expectedPosition, syntaxError.Position, syntaxError.Message)
+			}
+		})
+	}
+}
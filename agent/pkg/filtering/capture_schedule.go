@@ -0,0 +1,154 @@
+package filtering
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the agent image has no zoneinfo of its own
+
+	"github.com/up9inc/mizu/shared"
+)
+
+const (
+	CaptureStateActive = "active"
+	CaptureStateIdle   = "idle (outside schedule)"
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+type CaptureScheduleStatus struct {
+	State    string `json:"state"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type captureWindow struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+// CaptureSchedule decides whether the capture is active by the configured windows, the windows are evaluated in the
+// configured timezone so they follow its daylight saving changes.
+type CaptureSchedule struct {
+	location *time.Location
+	windows  []captureWindow
+}
+
+// ActiveCaptureSchedule is nil unless a capture schedule is configured
+var ActiveCaptureSchedule *CaptureSchedule
+
+// NewCaptureSchedule returns nil when no schedule is configured
+func NewCaptureSchedule(scheduleConfig *shared.CaptureScheduleConfig) (*CaptureSchedule, error) {
+	if scheduleConfig == nil {
+		return nil, nil
+	}
+	if len(scheduleConfig.Windows) == 0 {
+		return nil, fmt.Errorf("capture schedule must have at least one window")
+	}
+
+	location, err := time.LoadLocation(scheduleConfig.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture schedule timezone %q: %v", scheduleConfig.Timezone, err)
+	}
+	schedule := &CaptureSchedule{location: location}
+	for _, windowConfig := range scheduleConfig.Windows {
+		window := captureWindow{}
+		if window.days, err = parseWeekdays(windowConfig.Days); err != nil {
+			return nil, err
+		}
+		if window.start, err = parseTimeOfDay(windowConfig.Start); err != nil {
+			return nil, err
+		}
+		if window.end, err = parseTimeOfDay(windowConfig.End); err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return schedule, nil
+}
+
+// IsActive returns whether now is inside any of the windows
+func (schedule *CaptureSchedule) IsActive(now time.Time) bool {
+	localNow := now.In(schedule.location)
+	minute := localNow.Hour()*60 + localNow.Minute()
+	day := int(localNow.Weekday())
+	previousDay := (day + 6) % 7
+
+	for _, window := range schedule.windows {
+		if window.start < window.end {
+			if window.days[day] && minute >= window.start && minute < window.end {
+				return true
+			}
+			continue
+		}
+		// the window ends the day after it starts, a window ending when it starts lasts a whole day
+		if (window.days[day] && minute >= window.start) || (window.days[previousDay] && minute < window.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (schedule *CaptureSchedule) GetStatus(now time.Time) CaptureScheduleStatus {
+	status := CaptureScheduleStatus{State: CaptureStateIdle, Timezone: schedule.location.String()}
+	if schedule.IsActive(now) {
+		status.State = CaptureStateActive
+	}
+	return status
+}
+
+func parseWeekdays(days string) ([7]bool, error) {
+	var weekdays [7]bool
+	for _, item := range strings.Split(strings.ToLower(strings.TrimSpace(days)), ",") {
+		if item == "*" {
+			for i := range weekdays {
+				weekdays[i] = true
+			}
+			continue
+		}
+
+		first, last := item, item
+		if separatorIndex := strings.Index(item, "-"); separatorIndex >= 0 {
+			first, last = item[:separatorIndex], item[separatorIndex+1:]
+		}
+		firstDay, err := parseWeekday(first)
+		if err != nil {
+			return weekdays, err
+		}
+		lastDay, err := parseWeekday(last)
+		if err != nil {
+			return weekdays, err
+		}
+		// a range may wrap around the week, like fri-mon
+		for day := firstDay; ; day = (day + 1) % 7 {
+			weekdays[day] = true
+			if day == lastDay {
+				break
+			}
+		}
+	}
+	return weekdays, nil
+}
+
+func parseWeekday(day string) (int, error) {
+	day = strings.TrimSpace(day)
+	for i, name := range weekdayNames {
+		if day == name {
+			return i, nil
+		}
+	}
+	// cron numbers the days from 0 and takes 7 for sunday as well
+	if number, err := strconv.Atoi(day); err == nil && number >= 0 && number <= 7 {
+		return number % 7, nil
+	}
+	return 0, fmt.Errorf("invalid capture schedule day %q", day)
+}
+
+func parseTimeOfDay(timeOfDay string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(timeOfDay))
+	if err != nil {
+		return 0, fmt.Errorf("invalid capture schedule time %q, expected HH:MM", timeOfDay)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
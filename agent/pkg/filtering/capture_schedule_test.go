@@ -0,0 +1,108 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+func TestCaptureScheduleWindows(t *testing.T) {
+	schedule, err := filtering.NewCaptureSchedule(&shared.CaptureScheduleConfig{
+		Timezone: "America/New_York",
+		Windows: []shared.CaptureWindow{
+			{Days: "mon-fri", Start: "09:00", End: "17:00"},
+			{Days: "sat", Start: "22:00", End: "02:00"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		time           string
+		expectedActive bool
+	}{
+		// 2021-09-06 is a monday, new york is 4 hours behind utc in september
+		{name: "WeekdayInside", time: "2021-09-06T13:00:00Z", expectedActive: true},
+		{name: "WeekdayStart", time: "2021-09-06T09:00:00-04:00", expectedActive: true},
+		{name: "WeekdayEnd", time: "2021-09-06T17:00:00-04:00", expectedActive: false},
+		{name: "WeekdayBefore", time: "2021-09-06T12:59:00Z", expectedActive: false},
+		{name: "UtcDayIsTuesday", time: "2021-09-07T02:00:00Z", expectedActive: false},
+		{name: "Sunday", time: "2021-09-05T14:00:00-04:00", expectedActive: false},
+		{name: "SaturdayNight", time: "2021-09-04T23:30:00-04:00", expectedActive: true},
+		{name: "AfterSaturdayMidnight", time: "2021-09-05T01:59:00-04:00", expectedActive: true},
+		{name: "AfterSaturdayWindow", time: "2021-09-05T02:00:00-04:00", expectedActive: false},
+		// new york is 5 hours behind utc in december
+		{name: "Winter", time: "2021-12-06T14:30:00Z", expectedActive: true},
+		{name: "WinterBefore", time: "2021-12-06T13:30:00Z", expectedActive: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now, _ := time.Parse(time.RFC3339, test.time)
+			if active := schedule.IsActive(now); active != test.expectedActive {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedActive, active)
+			}
+
+			expectedState := filtering.CaptureStateIdle
+			if test.expectedActive {
+				expectedState = filtering.CaptureStateActive
+			}
+			if status := schedule.GetStatus(now); status.State != expectedState || status.Timezone != "America/New_York" {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedState, status)
+			}
+		})
+	}
+}
+
+func TestCaptureScheduleDays(t *testing.T) {
+	tests := []struct {
+		days         string
+		expectedDays []bool // sunday to saturday
+	}{
+		{days: "*", expectedDays: []bool{true, true, true, true, true, true, true}},
+		{days: "sat,sun", expectedDays: []bool{true, false, false, false, false, false, true}},
+		{days: "1-3,5", expectedDays: []bool{false, true, true, true, false, true, false}},
+		{days: "fri-mon", expectedDays: []bool{true, true, false, false, false, true, true}},
+		{days: "7", expectedDays: []bool{true, false, false, false, false, false, false}},
+	}
+
+	// 2021-09-05 is a sunday
+	sunday := time.Date(2021, 9, 5, 12, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.days, func(t *testing.T) {
+			schedule, err := filtering.NewCaptureSchedule(&shared.CaptureScheduleConfig{Windows: []shared.CaptureWindow{{Days: test.days, Start: "00:00", End: "23:59"}}})
+			if err != nil {
+				t.Fatalf("failed to create schedule: %v", err)
+			}
+			for day, expected := range test.expectedDays {
+				if active := schedule.IsActive(sunday.AddDate(0, 0, day)); active != expected {
+					t.Errorf("unexpected result - expected: %v, actual: %v (day %d)", expected, active, day)
+				}
+			}
+		})
+	}
+}
+
+func TestCaptureScheduleInvalid(t *testing.T) {
+	tests := []*shared.CaptureScheduleConfig{
+		{},
+		{Timezone: "Mars/Olympus", Windows: []shared.CaptureWindow{{Days: "*", Start: "09:00", End: "17:00"}}},
+		{Windows: []shared.CaptureWindow{{Days: "weekdays", Start: "09:00", End: "17:00"}}},
+		{Windows: []shared.CaptureWindow{{Days: "8", Start: "09:00", End: "17:00"}}},
+		{Windows: []shared.CaptureWindow{{Days: "*", Start: "9am", End: "17:00"}}},
+		{Windows: []shared.CaptureWindow{{Days: "*", Start: "09:00", End: "24:00"}}},
+	}
+
+	for _, config := range tests {
+		if _, err := filtering.NewCaptureSchedule(config); err == nil {
+			t.Errorf("unexpected result - expected an error, actual: %v", config)
+		}
+	}
+	if schedule, err := filtering.NewCaptureSchedule(nil); schedule != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, schedule, err)
+	}
+}
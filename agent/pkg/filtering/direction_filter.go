@@ -0,0 +1,39 @@
+package filtering
+
+import (
+	"fmt"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+// DirectionFilter drops the traffic of a protocol in the direction it isn't captured in
+type DirectionFilter struct {
+	directions map[string]shared.CaptureDirection
+}
+
+// NewDirectionFilter returns nil when no protocol is restricted to a direction
+func NewDirectionFilter(directions map[string]shared.CaptureDirection) (*DirectionFilter, error) {
+	if len(directions) == 0 {
+		return nil, nil
+	}
+
+	for protocolName, direction := range directions {
+		switch direction {
+		case shared.CaptureDirectionIncoming, shared.CaptureDirectionOutgoing, shared.CaptureDirectionBoth:
+		default:
+			return nil, fmt.Errorf("invalid capture direction %s of protocol %s", direction, protocolName)
+		}
+	}
+	return &DirectionFilter{directions: directions}, nil
+}
+
+func (filter *DirectionFilter) ShouldKeep(protocolName string, isOutgoing bool) bool {
+	switch filter.directions[protocolName] {
+	case shared.CaptureDirectionIncoming:
+		return !isOutgoing
+	case shared.CaptureDirectionOutgoing:
+		return isOutgoing
+	default:
+		return true
+	}
+}
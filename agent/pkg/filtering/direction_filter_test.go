@@ -0,0 +1,53 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+func TestDirectionFilterShouldKeep(t *testing.T) {
+	filter, err := filtering.NewDirectionFilter(map[string]shared.CaptureDirection{
+		"redis": shared.CaptureDirectionOutgoing,
+		"http":  shared.CaptureDirectionIncoming,
+		"kafka": shared.CaptureDirectionBoth,
+	})
+	if err != nil {
+		t.Fatalf("failed creating filter: %v", err)
+	}
+
+	tests := []struct {
+		protocolName string
+		isOutgoing   bool
+		expected     bool
+	}{
+		{protocolName: "redis", isOutgoing: true, expected: true},
+		{protocolName: "redis", isOutgoing: false, expected: false},
+		{protocolName: "http", isOutgoing: true, expected: false},
+		{protocolName: "http", isOutgoing: false, expected: true},
+		{protocolName: "kafka", isOutgoing: true, expected: true},
+		{protocolName: "kafka", isOutgoing: false, expected: true},
+		{protocolName: "amqp", isOutgoing: true, expected: true},
+		{protocolName: "amqp", isOutgoing: false, expected: true},
+	}
+
+	for _, test := range tests {
+		if actual := filter.ShouldKeep(test.protocolName, test.isOutgoing); actual != test.expected {
+			t.Errorf("unexpected result for %s outgoing %v - expected: %v, actual: %v", test.protocolName, test.isOutgoing, test.expected, actual)
+		}
+	}
+}
+
+func TestNewDirectionFilterInvalidDirection(t *testing.T) {
+	if _, err := filtering.NewDirectionFilter(map[string]shared.CaptureDirection{"redis": "outbound"}); err == nil {
+		t.Errorf("expected an error for an invalid direction")
+	}
+}
+
+func TestNewDirectionFilterDisabled(t *testing.T) {
+	filter, err := filtering.NewDirectionFilter(nil)
+	if filter != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, filter, err)
+	}
+}
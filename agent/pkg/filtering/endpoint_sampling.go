@@ -0,0 +1,175 @@
+package filtering
+
+import (
+	"fmt"
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// EndpointSampler keeps a configured fraction of the entries of every endpoint (normalized path).
+// Sampling is deterministic, every endpoint accumulates its rate per entry and an entry is kept whenever a whole entry was accumulated,
+// so the first entry of an endpoint is always kept.
+type EndpointSampler struct {
+	defaultRate float64
+	rates       map[string]float64
+	credits     map[string]float64
+	lock        sync.Mutex
+}
+
+// the sampler of filterItems, it's nil until the sampling is configured or its default rate is set through the api
+var activeEndpointSampler *EndpointSampler
+var isEndpointSamplingRunning bool
+var activeEndpointSamplerLock sync.RWMutex
+
+// StartEndpointSampling lets the default rate be set through the api while filterItems runs, a sampler is only created
+// before the rate is set when the sampling is configured
+func StartEndpointSampling(samplingConfig *shared.EndpointSamplingConfig) {
+	activeEndpointSamplerLock.Lock()
+	defer activeEndpointSamplerLock.Unlock()
+	activeEndpointSampler = NewEndpointSampler(samplingConfig)
+	isEndpointSamplingRunning = true
+}
+
+func StopEndpointSampling() {
+	activeEndpointSamplerLock.Lock()
+	defer activeEndpointSamplerLock.Unlock()
+	activeEndpointSampler = nil
+	isEndpointSamplingRunning = false
+}
+
+func IsEndpointSamplingRunning() bool {
+	activeEndpointSamplerLock.RLock()
+	defer activeEndpointSamplerLock.RUnlock()
+	return isEndpointSamplingRunning
+}
+
+// GetActiveEndpointSampler returns nil while every entry is kept
+func GetActiveEndpointSampler() *EndpointSampler {
+	activeEndpointSamplerLock.RLock()
+	defer activeEndpointSamplerLock.RUnlock()
+	return activeEndpointSampler
+}
+
+// GetDefaultSampleRate returns the rate of the paths without a rate of their own, 1 until a sampler is created
+func GetDefaultSampleRate() float64 {
+	if sampler := GetActiveEndpointSampler(); sampler != nil {
+		return sampler.GetDefaultRate()
+	}
+	return 1
+}
+
+// SetDefaultSampleRate changes the default rate of the active sampler, which is created when no sampling is configured
+func SetDefaultSampleRate(rate float64) error {
+	activeEndpointSamplerLock.Lock()
+	defer activeEndpointSamplerLock.Unlock()
+	if !isEndpointSamplingRunning {
+		return fmt.Errorf("sampling is not running")
+	}
+	sampler := activeEndpointSampler
+	if sampler == nil {
+		sampler = NewEndpointSampler(&shared.EndpointSamplingConfig{})
+	}
+	if err := sampler.SetDefaultRate(rate); err != nil {
+		return err
+	}
+	activeEndpointSampler = sampler
+	return nil
+}
+
+// NewEndpointSampler returns nil when no sampling is configured
+func NewEndpointSampler(samplingConfig *shared.EndpointSamplingConfig) *EndpointSampler {
+	if samplingConfig == nil {
+		return nil
+	}
+
+	sampler := &EndpointSampler{defaultRate: 1, rates: make(map[string]float64), credits: make(map[string]float64)}
+	if samplingConfig.DefaultRate != nil {
+		sampler.defaultRate = *samplingConfig.DefaultRate
+	}
+	for path, rate := range samplingConfig.Rates {
+		sampler.rates[utils.NormalizePath(path)] = rate
+	}
+	return sampler
+}
+
+func (sampler *EndpointSampler) GetDefaultRate() float64 {
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+	return sampler.defaultRate
+}
+
+// SetDefaultRate changes the rate of the paths without a rate of their own, starting with their next entry
+func (sampler *EndpointSampler) SetDefaultRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("sample rate must be between 0 and 1, got %v", rate)
+	}
+
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+	sampler.defaultRate = rate
+	return nil
+}
+
+// ShouldKeep decides whether the next entry of the path is kept
+func (sampler *EndpointSampler) ShouldKeep(path string) bool {
+	normalizedPath := utils.NormalizePath(path)
+
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	rate, ok := sampler.rates[normalizedPath]
+	if !ok {
+		rate = sampler.defaultRate
+	}
+
+	credit, ok := sampler.credits[normalizedPath]
+	if !ok {
+		credit = 1
+	} else {
+		credit += rate
+	}
+
+	if credit >= 1 {
+		sampler.credits[normalizedPath] = credit - 1
+		return true
+	}
+	sampler.credits[normalizedPath] = credit
+	return false
+}
+
+// GetItemSamplingPath returns the request path of http items and the protocol name of any other item,
+// the decision is made once per request-response pair so both sides are always kept or dropped together
+func GetItemSamplingPath(item *tapApi.OutputChannelItem) string {
+	if path, ok := getItemRequestPath(item); ok {
+		return path
+	}
+	return item.Protocol.Name
+}
+
+// getItemRequestPath returns the request path of http items, it returns false for the items of any other protocol.
+// The items the api server gets from the tappers have their payloads decoded, the path is read from their har url.
+func getItemRequestPath(item *tapApi.OutputChannelItem) (string, bool) {
+	if item.Pair == nil {
+		return "", false
+	}
+	switch payload := item.Pair.Request.Payload.(type) {
+	case tapApi.HTTPPayload:
+		if request, ok := payload.Data.(*http.Request); ok && request.URL != nil {
+			return request.URL.Path, true
+		}
+	case map[string]interface{}:
+		if details, ok := payload["details"].(map[string]interface{}); ok {
+			if harUrl, ok := details["url"].(string); ok {
+				if requestUrl, err := url.Parse(harUrl); err == nil {
+					return requestUrl.Path, true
+				}
+			}
+		}
+	}
+	return "", false
+}
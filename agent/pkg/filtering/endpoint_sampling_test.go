@@ -0,0 +1,82 @@
+package filtering_test
+
+import (
+	"fmt"
+	"mizuserver/pkg/filtering"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestEndpointSamplerRates(t *testing.T) {
+	defaultRate := 0.5
+	sampler := filtering.NewEndpointSampler(&shared.EndpointSamplingConfig{
+		DefaultRate: &defaultRate,
+		Rates: map[string]float64{
+			"/health":        0.1,
+			"/users/{param}": 0.25,
+			"/checkout":      1,
+		},
+	})
+
+	tests := []struct {
+		path         string
+		expectedKept int
+	}{
+		{path: "/health", expectedKept: 10},
+		{path: "/users/%d", expectedKept: 25},
+		{path: "/checkout", expectedKept: 100},
+		{path: "/orders", expectedKept: 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			kept := 0
+			for i := 0; i < 100; i++ {
+				path := test.path
+				if path == "/users/%d" {
+					path = fmt.Sprintf(path, i)
+				}
+				if sampler.ShouldKeep(path) {
+					kept++
+				}
+			}
+
+			if kept != test.expectedKept {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedKept, kept)
+			}
+		})
+	}
+}
+
+func TestEndpointSamplerNotConfigured(t *testing.T) {
+	if sampler := filtering.NewEndpointSampler(nil); sampler != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, sampler)
+	}
+}
+
+func TestGetItemSamplingPath(t *testing.T) {
+	httpItem := &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair: &tapApi.RequestResponsePair{
+			Request: tapApi.GenericMessage{Payload: tapApi.HTTPPayload{Data: &http.Request{URL: &url.URL{Path: "/users/7", RawQuery: "a=b"}}}},
+		},
+	}
+	redisItem := &tapApi.OutputChannelItem{Protocol: tapApi.Protocol{Name: "redis"}, Pair: &tapApi.RequestResponsePair{}}
+
+	if path := filtering.GetItemSamplingPath(httpItem); path != "/users/7" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "/users/7", path)
+	}
+	if path := filtering.GetItemSamplingPath(redisItem); path != "redis" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "redis", path)
+	}
+}
+
+func TestGetItemSamplingPathDecodedItem(t *testing.T) {
+	if path := filtering.GetItemSamplingPath(newDecodedHttpItem(t, "http://users/users/7?a=b")); path != "/users/7" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "/users/7", path)
+	}
+}
@@ -0,0 +1,135 @@
+package filtering
+
+import (
+	"sync"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	defaultFilterWorkers = 1
+	// reorderWindowPerWorker bounds the items held waiting for a slower item in ordered mode
+	reorderWindowPerWorker = 16
+)
+
+// ItemFilter decides whether an item is passed on, it's called concurrently when there are several workers
+type ItemFilter func(item *tapApi.OutputChannelItem) bool
+
+type sequencedItem struct {
+	sequence int
+	item     *tapApi.OutputChannelItem
+	keep     bool
+}
+
+// RunFilterWorkers passes the items of inChannel the filter keeps to outChannel, using the configured number of
+// workers. The workers may reorder items unless PreserveOrder is set, then the items kept are sent in the order
+// they were received. It returns once inChannel is closed and all of its items were handled.
+func RunFilterWorkers(workersConfig *shared.FilterWorkersConfig, inChannel <-chan *tapApi.OutputChannelItem, outChannel chan<- *tapApi.OutputChannelItem, filter ItemFilter) {
+	workers := defaultFilterWorkers
+	if workersConfig != nil && workersConfig.Count > 0 {
+		workers = workersConfig.Count
+	}
+
+	partitionBy := ""
+	if workersConfig != nil && workersConfig.PartitionBy != "" {
+		if IsValidPartitionBy(workersConfig.PartitionBy) {
+			partitionBy = workersConfig.PartitionBy
+		} else {
+			logger.Log.Errorf("Disabled filter workers partitioning, unknown partition by %q", workersConfig.PartitionBy)
+		}
+	}
+
+	if workers == 1 {
+		runFilterWorker(inChannel, outChannel, filter)
+	} else if partitionBy != "" {
+		runPartitionedFilterWorkers(workers, partitionBy, inChannel, outChannel, filter)
+	} else if workersConfig.PreserveOrder {
+		runOrderedFilterWorkers(workers, inChannel, outChannel, filter)
+	} else {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runFilterWorker(inChannel, outChannel, filter)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func runFilterWorker(inChannel <-chan *tapApi.OutputChannelItem, outChannel chan<- *tapApi.OutputChannelItem, filter ItemFilter) {
+	for item := range inChannel {
+		if filter(item) {
+			outChannel <- item
+		}
+	}
+}
+
+// runPartitionedFilterWorkers hands each partition of the items to its own worker, the items of a connection or a
+// stream are passed on in order while the partitions are filtered in parallel
+func runPartitionedFilterWorkers(workers int, partitionBy string, inChannel <-chan *tapApi.OutputChannelItem, outChannel chan<- *tapApi.OutputChannelItem, filter ItemFilter) {
+	var wg sync.WaitGroup
+	for _, partition := range PartitionItems(inChannel, workers, partitionBy) {
+		wg.Add(1)
+		go func(partition <-chan *tapApi.OutputChannelItem) {
+			defer wg.Done()
+			runFilterWorker(partition, outChannel, filter)
+		}(partition)
+	}
+	wg.Wait()
+}
+
+// runOrderedFilterWorkers numbers the items as they're received and sends every item once all the items before it
+// were handled, the window stops the intake while a slow item holds back too many handled ones.
+func runOrderedFilterWorkers(workers int, inChannel <-chan *tapApi.OutputChannelItem, outChannel chan<- *tapApi.OutputChannelItem, filter ItemFilter) {
+	window := make(chan struct{}, workers*reorderWindowPerWorker)
+	pending := make(chan sequencedItem, workers)
+	handled := make(chan sequencedItem, workers)
+
+	go func() {
+		sequence := 0
+		for item := range inChannel {
+			window <- struct{}{}
+			pending <- sequencedItem{sequence: sequence, item: item}
+			sequence++
+		}
+		close(pending)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sequenced := range pending {
+				sequenced.keep = filter(sequenced.item)
+				handled <- sequenced
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(handled)
+	}()
+
+	waiting := make(map[int]sequencedItem)
+	nextSequence := 0
+	for sequenced := range handled {
+		waiting[sequenced.sequence] = sequenced
+		for {
+			next, ok := waiting[nextSequence]
+			if !ok {
+				break
+			}
+			delete(waiting, nextSequence)
+			nextSequence++
+			if next.keep {
+				outChannel <- next.item
+			}
+			<-window
+		}
+	}
+}
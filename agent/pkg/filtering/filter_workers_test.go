@@ -0,0 +1,114 @@
+package filtering_test
+
+import (
+	"math/rand"
+	"mizuserver/pkg/filtering"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// runFilterWorkers filters items numbered in order by their timestamp and returns the timestamps of those passed on
+func runFilterWorkers(workersConfig *shared.FilterWorkersConfig, itemsCount int, filter filtering.ItemFilter) ([]int64, time.Duration) {
+	inChannel := make(chan *tapApi.OutputChannelItem)
+	outChannel := make(chan *tapApi.OutputChannelItem, itemsCount)
+	go func() {
+		for i := 0; i < itemsCount; i++ {
+			inChannel <- &tapApi.OutputChannelItem{Timestamp: int64(i)}
+		}
+		close(inChannel)
+	}()
+
+	start := time.Now()
+	filtering.RunFilterWorkers(workersConfig, inChannel, outChannel, filter)
+	elapsed := time.Since(start)
+	close(outChannel)
+
+	timestamps := make([]int64, 0, itemsCount)
+	for item := range outChannel {
+		timestamps = append(timestamps, item.Timestamp)
+	}
+	return timestamps, elapsed
+}
+
+func slowFilter(item *tapApi.OutputChannelItem) bool {
+	time.Sleep(2 * time.Millisecond)
+	return true
+}
+
+func TestFilterWorkersThroughputScales(t *testing.T) {
+	const itemsCount = 100
+
+	_, singleWorkerElapsed := runFilterWorkers(nil, itemsCount, slowFilter)
+	for _, preserveOrder := range []bool{false, true} {
+		t.Run("PreserveOrder"+strconv.FormatBool(preserveOrder), func(t *testing.T) {
+			timestamps, elapsed := runFilterWorkers(&shared.FilterWorkersConfig{Count: 8, PreserveOrder: preserveOrder}, itemsCount, slowFilter)
+			if len(timestamps) != itemsCount {
+				t.Errorf("unexpected result - expected: %v, actual: %v", itemsCount, len(timestamps))
+			}
+			if elapsed > singleWorkerElapsed/3 {
+				t.Errorf("unexpected result - expected less than: %v, actual: %v", singleWorkerElapsed/3, elapsed)
+			}
+		})
+	}
+}
+
+func TestFilterWorkersPreserveOrder(t *testing.T) {
+	const itemsCount = 500
+
+	// items are held for random durations and every third item is dropped
+	random := rand.New(rand.NewSource(1))
+	delays := make([]time.Duration, itemsCount)
+	for i := range delays {
+		delays[i] = time.Duration(random.Intn(500)) * time.Microsecond
+	}
+	filter := func(item *tapApi.OutputChannelItem) bool {
+		time.Sleep(delays[item.Timestamp])
+		return item.Timestamp%3 != 0
+	}
+
+	timestamps, _ := runFilterWorkers(&shared.FilterWorkersConfig{Count: 6, PreserveOrder: true}, itemsCount, filter)
+	expected := make([]int64, 0, itemsCount)
+	for i := int64(0); i < itemsCount; i++ {
+		if i%3 != 0 {
+			expected = append(expected, i)
+		}
+	}
+	if len(timestamps) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(timestamps))
+	}
+	for i := range expected {
+		if timestamps[i] != expected[i] {
+			t.Fatalf("unexpected result - expected: %v, actual: %v at %v", expected[i], timestamps[i], i)
+		}
+	}
+}
+
+func TestFilterWorkersDefaultToSingleWorker(t *testing.T) {
+	concurrent, maxConcurrent := 0, 0
+	filter := func(item *tapApi.OutputChannelItem) bool {
+		// a data race here fails the test under -race
+		concurrent++
+		if concurrent > maxConcurrent {
+			maxConcurrent = concurrent
+		}
+		time.Sleep(100 * time.Microsecond)
+		concurrent--
+		return true
+	}
+
+	for _, workersConfig := range []*shared.FilterWorkersConfig{nil, {Count: 0, PreserveOrder: true}, {Count: 1}} {
+		timestamps, _ := runFilterWorkers(workersConfig, 50, filter)
+		if maxConcurrent != 1 || len(timestamps) != 50 {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", "1 worker", maxConcurrent, len(timestamps))
+		}
+		for i, timestamp := range timestamps {
+			if timestamp != int64(i) {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", i, timestamp)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package filtering
+
+import (
+	"mizuserver/pkg/utils"
+	"sync"
+)
+
+// FirstSeenFilter keeps only the first entry of every endpoint (method + normalized path)
+type FirstSeenFilter struct {
+	seenEndpoints map[string]bool
+	lock          sync.Mutex
+}
+
+var FirstSeen = NewFirstSeenFilter()
+
+func NewFirstSeenFilter() *FirstSeenFilter {
+	return &FirstSeenFilter{seenEndpoints: make(map[string]bool)}
+}
+
+// ShouldKeep returns true only for the first entry seen of the endpoint
+func (filter *FirstSeenFilter) ShouldKeep(method string, path string) bool {
+	endpointKey := utils.GetEndpointKey(method, path)
+
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	if filter.seenEndpoints[endpointKey] {
+		return false
+	}
+	filter.seenEndpoints[endpointKey] = true
+	return true
+}
+
+// Reset forgets all seen endpoints, re-enabling their capture, and returns the amount of endpoints forgotten
+func (filter *FirstSeenFilter) Reset() int {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	seenCount := len(filter.seenEndpoints)
+	filter.seenEndpoints = make(map[string]bool)
+	return seenCount
+}
+
+func (filter *FirstSeenFilter) SeenCount() int {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	return len(filter.seenEndpoints)
+}
@@ -0,0 +1,50 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+)
+
+func TestFirstSeenFilterShouldKeep(t *testing.T) {
+	tests := []struct {
+		method       string
+		path         string
+		expectedKeep bool
+	}{
+		{method: "GET", path: "/users/1", expectedKeep: true},
+		{method: "GET", path: "/users/2", expectedKeep: false},
+		{method: "get", path: "/users/3?verbose=true", expectedKeep: false},
+		{method: "POST", path: "/users/1", expectedKeep: true},
+		{method: "GET", path: "/users", expectedKeep: true},
+		{method: "GET", path: "/users/", expectedKeep: false},
+		{method: "GET", path: "/users/0e8f2b1c-3b5a-4d7e-9f6a-1c2d3e4f5a6b", expectedKeep: false},
+		{method: "GET", path: "/users/me", expectedKeep: true},
+	}
+
+	filter := filtering.NewFirstSeenFilter()
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			if keep := filter.ShouldKeep(test.method, test.path); keep != test.expectedKeep {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedKeep, keep)
+			}
+		})
+	}
+}
+
+func TestFirstSeenFilterReset(t *testing.T) {
+	filter := filtering.NewFirstSeenFilter()
+	filter.ShouldKeep("GET", "/health")
+	filter.ShouldKeep("GET", "/metrics")
+
+	if filter.ShouldKeep("GET", "/health") {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", false, true)
+	}
+
+	if cleared := filter.Reset(); cleared != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, cleared)
+	}
+
+	if !filter.ShouldKeep("GET", "/health") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", true, false)
+	}
+}
@@ -0,0 +1,85 @@
+package filtering
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	"github.com/up9inc/mizu/tap"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const defaultMaxCappedFlows = 10000
+
+// FlowEntryCap keeps a number of entries per connection at most, so a long lived connection like a stream can't
+// dominate the storage. The entries of the most recently active connections are counted, the least recently active
+// connection is forgotten when there are more than maxFlows.
+type FlowEntryCap struct {
+	flows             map[string]*list.Element // of flowEntryCount by flow key
+	flowsOrder        *list.List               // the least recently seen flow first, forgotten first once there are maxFlows
+	maxEntriesPerFlow int
+	maxFlows          int
+	lock              sync.Mutex
+}
+
+type flowEntryCount struct {
+	flowKey string
+	entries int
+}
+
+// NewFlowEntryCap returns nil when no cap is configured
+func NewFlowEntryCap(capConfig *shared.FlowEntryCapConfig) (*FlowEntryCap, error) {
+	if capConfig == nil {
+		return nil, nil
+	}
+	if capConfig.MaxEntriesPerFlow <= 0 {
+		return nil, fmt.Errorf("flow entry cap max entries per flow must be positive, got %d", capConfig.MaxEntriesPerFlow)
+	}
+	if capConfig.MaxFlows < 0 {
+		return nil, fmt.Errorf("flow entry cap max flows can't be negative, got %d", capConfig.MaxFlows)
+	}
+
+	maxFlows := capConfig.MaxFlows
+	if maxFlows == 0 {
+		maxFlows = defaultMaxCappedFlows
+	}
+	return &FlowEntryCap{
+		flows:             make(map[string]*list.Element),
+		flowsOrder:        list.New(),
+		maxEntriesPerFlow: capConfig.MaxEntriesPerFlow,
+		maxFlows:          maxFlows,
+	}, nil
+}
+
+// ShouldKeep counts the entry in its connection, the entries of a connection beyond the cap aren't kept
+func (flowEntryCap *FlowEntryCap) ShouldKeep(entry *tapApi.MizuEntry) bool {
+	flowKey := tap.GetFlowKey(entry.SourceIp, entry.SourcePort, entry.DestinationIp, entry.DestinationPort)
+
+	flowEntryCap.lock.Lock()
+	defer flowEntryCap.lock.Unlock()
+
+	element, ok := flowEntryCap.flows[flowKey]
+	if ok {
+		flowEntryCap.flowsOrder.MoveToBack(element)
+	} else {
+		if flowEntryCap.flowsOrder.Len() >= flowEntryCap.maxFlows {
+			oldest := flowEntryCap.flowsOrder.Front()
+			flowEntryCap.flowsOrder.Remove(oldest)
+			delete(flowEntryCap.flows, oldest.Value.(*flowEntryCount).flowKey)
+		}
+		element = flowEntryCap.flowsOrder.PushBack(&flowEntryCount{flowKey: flowKey})
+		flowEntryCap.flows[flowKey] = element
+	}
+
+	flow := element.Value.(*flowEntryCount)
+	if flow.entries >= flowEntryCap.maxEntriesPerFlow {
+		return false
+	}
+	flow.entries++
+	if flow.entries == flowEntryCap.maxEntriesPerFlow {
+		logger.Log.Infof("Flow %s reached its cap of %d entries, its next entries are dropped", flowKey, flowEntryCap.maxEntriesPerFlow)
+	}
+	return true
+}
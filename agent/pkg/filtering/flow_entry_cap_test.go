@@ -0,0 +1,86 @@
+package filtering_test
+
+import (
+	"fmt"
+	"mizuserver/pkg/filtering"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newFlowEntry(clientPort int, timestamp int64) *tapApi.MizuEntry {
+	return &tapApi.MizuEntry{
+		SourceIp:        "10.0.0.1",
+		SourcePort:      fmt.Sprintf("%d", clientPort),
+		DestinationIp:   "10.0.0.2",
+		DestinationPort: "80",
+		Timestamp:       timestamp,
+	}
+}
+
+func TestFlowEntryCap(t *testing.T) {
+	flowEntryCap, err := filtering.NewFlowEntryCap(&shared.FlowEntryCapConfig{MaxEntriesPerFlow: 10})
+	if err != nil {
+		t.Fatalf("failed to create cap: %v", err)
+	}
+
+	chattyKept, quietKept := 0, 0
+	for i := int64(0); i < 1000; i++ {
+		if flowEntryCap.ShouldKeep(newFlowEntry(41000, i)) {
+			chattyKept++
+		}
+		if i%100 == 0 && flowEntryCap.ShouldKeep(newFlowEntry(41001, i)) {
+			quietKept++
+		}
+	}
+	if chattyKept != 10 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 10, chattyKept)
+	}
+	if quietKept != 10 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 10, quietKept)
+	}
+}
+
+func TestFlowEntryCapCountsBothDirections(t *testing.T) {
+	flowEntryCap, _ := filtering.NewFlowEntryCap(&shared.FlowEntryCapConfig{MaxEntriesPerFlow: 1})
+	request := newFlowEntry(41000, 1)
+	reversed := &tapApi.MizuEntry{SourceIp: request.DestinationIp, SourcePort: request.DestinationPort, DestinationIp: request.SourceIp, DestinationPort: request.SourcePort, Timestamp: 2}
+
+	if kept := []bool{flowEntryCap.ShouldKeep(request), flowEntryCap.ShouldKeep(reversed)}; !kept[0] || kept[1] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", []bool{true, false}, kept)
+	}
+}
+
+func TestFlowEntryCapMaxFlows(t *testing.T) {
+	flowEntryCap, _ := filtering.NewFlowEntryCap(&shared.FlowEntryCapConfig{MaxEntriesPerFlow: 1, MaxFlows: 2})
+	flowEntryCap.ShouldKeep(newFlowEntry(41000, 1))
+	flowEntryCap.ShouldKeep(newFlowEntry(41001, 2))
+	// the least recently active flow is forgotten for the third flow
+	flowEntryCap.ShouldKeep(newFlowEntry(41001, 3))
+	flowEntryCap.ShouldKeep(newFlowEntry(41002, 4))
+
+	if !flowEntryCap.ShouldKeep(newFlowEntry(41000, 5)) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the forgotten flow counted again", false)
+	}
+	if flowEntryCap.ShouldKeep(newFlowEntry(41002, 6)) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the capped flow dropped", true)
+	}
+}
+
+func TestNewFlowEntryCapInvalid(t *testing.T) {
+	tests := []*shared.FlowEntryCapConfig{
+		{},
+		{MaxEntriesPerFlow: -1},
+		{MaxEntriesPerFlow: 10, MaxFlows: -1},
+	}
+
+	for _, capConfig := range tests {
+		if _, err := filtering.NewFlowEntryCap(capConfig); err == nil {
+			t.Errorf("unexpected result - expected an error, actual: %v", capConfig)
+		}
+	}
+	if flowEntryCap, err := filtering.NewFlowEntryCap(nil); flowEntryCap != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, flowEntryCap, err)
+	}
+}
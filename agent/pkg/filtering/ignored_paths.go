@@ -0,0 +1,45 @@
+package filtering
+
+import (
+	"fmt"
+	"regexp"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// IgnoredPaths drops the http items whose request path matches any of the patterns, such as health checks and metrics
+// scrapes. A pattern matches anywhere in the path unless it's anchored, e.g. ^/health$ only matches /health.
+type IgnoredPaths struct {
+	patterns []*regexp.Regexp
+}
+
+// NewIgnoredPaths returns nil when no pattern is given
+func NewIgnoredPaths(patterns []string) (*IgnoredPaths, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	ignoredPaths := &IgnoredPaths{patterns: make([]*regexp.Regexp, 0, len(patterns))}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignored path pattern %s: %v", pattern, err)
+		}
+		ignoredPaths.patterns = append(ignoredPaths.patterns, compiled)
+	}
+	return ignoredPaths, nil
+}
+
+// ShouldKeep keeps the items of the protocols other than http, their paths aren't request paths
+func (ignoredPaths *IgnoredPaths) ShouldKeep(item *tapApi.OutputChannelItem) bool {
+	path, ok := getItemRequestPath(item)
+	if !ok {
+		return true
+	}
+	for _, pattern := range ignoredPaths.patterns {
+		if pattern.MatchString(path) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"mizuserver/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newHttpItem(path string) *tapApi.OutputChannelItem {
+	return &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair: &tapApi.RequestResponsePair{
+			Request: tapApi.GenericMessage{Payload: tapApi.HTTPPayload{Data: &http.Request{URL: &url.URL{Path: path}}}},
+		},
+	}
+}
+
+// newDecodedHttpItem returns an http item with its payloads decoded, like the api server gets it from a tapper
+func newDecodedHttpItem(t *testing.T, target string) *tapApi.OutputChannelItem {
+	item, err := models.DecodeOutputChannelItem(&tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair: &tapApi.RequestResponsePair{
+			Request: tapApi.GenericMessage{IsRequest: true, Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpRequest, Data: httptest.NewRequest(http.MethodGet, target, nil)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to decode the item: %v", err)
+	}
+	return item
+}
+
+func TestIgnoredPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		expected bool
+	}{
+		{name: "unanchored matches a prefix", patterns: []string{"/health"}, path: "/health", expected: false},
+		{name: "unanchored matches within the path", patterns: []string{"/health"}, path: "/api/healthz", expected: false},
+		{name: "unanchored doesn't match other paths", patterns: []string{"/health"}, path: "/users", expected: true},
+		{name: "anchored matches the whole path", patterns: []string{"^/health$"}, path: "/health", expected: false},
+		{name: "anchored doesn't match a longer path", patterns: []string{"^/health$"}, path: "/healthz", expected: true},
+		{name: "anchored doesn't match within the path", patterns: []string{"^/metrics"}, path: "/api/metrics", expected: true},
+		{name: "any of the patterns", patterns: []string{"^/health$", "^/metrics"}, path: "/metrics/prometheus", expected: false},
+		{name: "query isn't matched", patterns: []string{"probe=1"}, path: "/users", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ignoredPaths, err := filtering.NewIgnoredPaths(test.patterns)
+			if err != nil {
+				t.Fatalf("failed to create ignored paths: %v", err)
+			}
+
+			if kept := ignoredPaths.ShouldKeep(newHttpItem(test.path)); kept != test.expected {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, kept)
+			}
+		})
+	}
+}
+
+func TestIgnoredPathsDecodedItem(t *testing.T) {
+	ignoredPaths, _ := filtering.NewIgnoredPaths([]string{"^/health$"})
+
+	if kept := ignoredPaths.ShouldKeep(newDecodedHttpItem(t, "http://orders/health?probe=1")); kept {
+		t.Errorf("unexpected result - expected: %v, actual: %v", false, kept)
+	}
+	if kept := ignoredPaths.ShouldKeep(newDecodedHttpItem(t, "http://orders/users")); !kept {
+		t.Errorf("unexpected result - expected: %v, actual: %v", true, kept)
+	}
+}
+
+func TestIgnoredPathsKeepsOtherProtocols(t *testing.T) {
+	ignoredPaths, _ := filtering.NewIgnoredPaths([]string{".*"})
+	redisItem := &tapApi.OutputChannelItem{Protocol: tapApi.Protocol{Name: "redis"}, Pair: &tapApi.RequestResponsePair{}}
+
+	if kept := ignoredPaths.ShouldKeep(redisItem); !kept {
+		t.Errorf("unexpected result - expected: %v, actual: %v", true, kept)
+	}
+}
+
+func TestIgnoredPathsInvalidPattern(t *testing.T) {
+	if _, err := filtering.NewIgnoredPaths([]string{"^/health$", "/users/(["}); err == nil {
+		t.Errorf("unexpected result - expected: an error, actual: %v", err)
+	}
+}
+
+func TestIgnoredPathsNotConfigured(t *testing.T) {
+	if ignoredPaths, err := filtering.NewIgnoredPaths(nil); ignoredPaths != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, ignoredPaths)
+	}
+}
@@ -0,0 +1,61 @@
+package filtering
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/up9inc/mizu/tap"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	PartitionByConnection = "connection"
+	PartitionByStream     = "stream"
+)
+
+const partitionChannelSize = 64
+
+func IsValidPartitionBy(partitionBy string) bool {
+	return partitionBy == PartitionByConnection || partitionBy == PartitionByStream
+}
+
+// GetItemPartitionKey returns the flow of the connection of an item, followed by its HTTP/2 stream when partitioning
+// by stream. The items of the protocols without streams are keyed by their connection either way.
+func GetItemPartitionKey(item *tapApi.OutputChannelItem, partitionBy string) string {
+	if item.ConnectionInfo == nil {
+		return ""
+	}
+	connectionInfo := item.ConnectionInfo
+	flowKey := tap.GetFlowKey(connectionInfo.ClientIP, connectionInfo.ClientPort, connectionInfo.ServerIP, connectionInfo.ServerPort)
+	if partitionBy == PartitionByStream && item.Stream != 0 {
+		return fmt.Sprintf("%s/%d", flowKey, item.Stream)
+	}
+	return flowKey
+}
+
+// PartitionItems splits the items of inChannel into count channels by their partition key, all the items of a key
+// are sent to the same channel in the order they were received. The channels are closed once inChannel is closed.
+func PartitionItems(inChannel <-chan *tapApi.OutputChannelItem, count int, partitionBy string) []<-chan *tapApi.OutputChannelItem {
+	partitions := make([]chan *tapApi.OutputChannelItem, count)
+	readOnlyPartitions := make([]<-chan *tapApi.OutputChannelItem, count)
+	for i := range partitions {
+		partitions[i] = make(chan *tapApi.OutputChannelItem, partitionChannelSize)
+		readOnlyPartitions[i] = partitions[i]
+	}
+
+	go func() {
+		for item := range inChannel {
+			partitions[getPartitionIndex(GetItemPartitionKey(item, partitionBy), count)] <- item
+		}
+		for _, partition := range partitions {
+			close(partition)
+		}
+	}()
+	return readOnlyPartitions
+}
+
+func getPartitionIndex(key string, count int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(count))
+}
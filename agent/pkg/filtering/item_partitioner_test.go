@@ -0,0 +1,145 @@
+package filtering_test
+
+import (
+	"fmt"
+	"math/rand"
+	"mizuserver/pkg/filtering"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newConnectionItem(clientPort string, stream uint32, timestamp int64) *tapApi.OutputChannelItem {
+	return &tapApi.OutputChannelItem{
+		Timestamp: timestamp,
+		Stream:    stream,
+		ConnectionInfo: &tapApi.ConnectionInfo{
+			ClientIP:   "10.0.0.1",
+			ClientPort: clientPort,
+			ServerIP:   "10.0.0.2",
+			ServerPort: "443",
+		},
+	}
+}
+
+func TestGetItemPartitionKey(t *testing.T) {
+	connectionKey := filtering.GetItemPartitionKey(newConnectionItem("50000", 0, 0), filtering.PartitionByStream)
+	if connectionKey == "" {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "a connection key", connectionKey)
+	}
+
+	firstStream := filtering.GetItemPartitionKey(newConnectionItem("50000", 1, 0), filtering.PartitionByStream)
+	secondStream := filtering.GetItemPartitionKey(newConnectionItem("50000", 3, 0), filtering.PartitionByStream)
+	if firstStream == secondStream {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "different stream keys", firstStream)
+	}
+	for _, streamKey := range []string{firstStream, secondStream} {
+		if !strings.HasPrefix(streamKey, connectionKey+"/") {
+			t.Errorf("unexpected result - expected: %v, actual: %v", connectionKey+"/...", streamKey)
+		}
+	}
+
+	if key := filtering.GetItemPartitionKey(newConnectionItem("50000", 3, 0), filtering.PartitionByConnection); key != connectionKey {
+		t.Errorf("unexpected result - expected: %v, actual: %v", connectionKey, key)
+	}
+	if key := filtering.GetItemPartitionKey(newConnectionItem("50001", 1, 0), filtering.PartitionByStream); strings.HasPrefix(key, connectionKey) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "another connection", key)
+	}
+	if key := filtering.GetItemPartitionKey(&tapApi.OutputChannelItem{Stream: 1}, filtering.PartitionByStream); key != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", key)
+	}
+}
+
+func TestPartitionItems(t *testing.T) {
+	const itemsCount = 400
+
+	inChannel := make(chan *tapApi.OutputChannelItem)
+	go func() {
+		for i := 0; i < itemsCount; i++ {
+			inChannel <- newConnectionItem(fmt.Sprint(50000+i%3), uint32(1+2*(i%5)), int64(i))
+		}
+		close(inChannel)
+	}()
+
+	// the partitions are drained together, a partition that isn't read holds back all the others
+	partitions := filtering.PartitionItems(inChannel, 4, filtering.PartitionByStream)
+	received := make([][]*tapApi.OutputChannelItem, len(partitions))
+	var wg sync.WaitGroup
+	for index, partition := range partitions {
+		wg.Add(1)
+		go func(index int, partition <-chan *tapApi.OutputChannelItem) {
+			defer wg.Done()
+			for item := range partition {
+				received[index] = append(received[index], item)
+			}
+		}(index, partition)
+	}
+	wg.Wait()
+
+	partitionOfKey := make(map[string]int)
+	lastOfKey := make(map[string]int64)
+	receivedCount := 0
+	for index, items := range received {
+		for _, item := range items {
+			receivedCount++
+			key := filtering.GetItemPartitionKey(item, filtering.PartitionByStream)
+			if previous, ok := partitionOfKey[key]; ok && previous != index {
+				t.Errorf("unexpected result - expected: %v, actual: %v for %v", previous, index, key)
+			}
+			partitionOfKey[key] = index
+			if last, ok := lastOfKey[key]; ok && item.Timestamp <= last {
+				t.Errorf("unexpected result - expected after: %v, actual: %v for %v", last, item.Timestamp, key)
+			}
+			lastOfKey[key] = item.Timestamp
+		}
+	}
+
+	if receivedCount != itemsCount {
+		t.Errorf("unexpected result - expected: %v, actual: %v", itemsCount, receivedCount)
+	}
+	if len(partitionOfKey) != 15 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 15, len(partitionOfKey))
+	}
+}
+
+func TestFilterWorkersPartitionByStream(t *testing.T) {
+	const itemsCount = 300
+
+	random := rand.New(rand.NewSource(1))
+	delays := make([]time.Duration, itemsCount)
+	for i := range delays {
+		delays[i] = time.Duration(random.Intn(300)) * time.Microsecond
+	}
+	filter := func(item *tapApi.OutputChannelItem) bool {
+		time.Sleep(delays[item.Timestamp])
+		return true
+	}
+
+	inChannel := make(chan *tapApi.OutputChannelItem)
+	outChannel := make(chan *tapApi.OutputChannelItem, itemsCount)
+	go func() {
+		for i := 0; i < itemsCount; i++ {
+			inChannel <- newConnectionItem("50000", uint32(1+2*(i%7)), int64(i))
+		}
+		close(inChannel)
+	}()
+	filtering.RunFilterWorkers(&shared.FilterWorkersConfig{Count: 4, PartitionBy: filtering.PartitionByStream}, inChannel, outChannel, filter)
+	close(outChannel)
+
+	lastOfStream := make(map[uint32]int64)
+	received := 0
+	for item := range outChannel {
+		received++
+		if last, ok := lastOfStream[item.Stream]; ok && item.Timestamp <= last {
+			t.Errorf("unexpected result - expected after: %v, actual: %v for stream %v", last, item.Timestamp, item.Stream)
+		}
+		lastOfStream[item.Stream] = item.Timestamp
+	}
+	if received != itemsCount {
+		t.Errorf("unexpected result - expected: %v, actual: %v", itemsCount, received)
+	}
+}
@@ -0,0 +1,151 @@
+package filtering
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+const (
+	// load shedding engages above the engage ratio of the limit and disengages only once memory is back below the recover ratio
+	memoryGuardEngageRatio  = 0.9
+	memoryGuardRecoverRatio = 0.8
+)
+
+type MemoryReader func() (uint64, error)
+
+type MemoryGuardStatus struct {
+	Engaged      bool    `json:"engaged"`
+	RssBytes     uint64  `json:"rssBytes"`
+	LimitBytes   uint64  `json:"limitBytes"`
+	DropRate     float64 `json:"dropRate"`
+	DroppedItems uint64  `json:"droppedItems"`
+}
+
+// MemoryGuard sheds load when the process memory approaches the limit, the drop rate grows from 0.5 at the engage threshold
+// up to 1 at the limit itself
+type MemoryGuard struct {
+	limitBytes      uint64
+	readMemory      MemoryReader
+	onEngagedChange func(engaged bool)
+	status          MemoryGuardStatus
+	dropCredit      float64
+	lock            sync.Mutex
+}
+
+// ActiveMemoryGuard is nil unless a memory limit is configured
+var ActiveMemoryGuard *MemoryGuard
+
+func NewMemoryGuard(limitBytes uint64, readMemory MemoryReader, onEngagedChange func(engaged bool)) *MemoryGuard {
+	return &MemoryGuard{
+		limitBytes:      limitBytes,
+		readMemory:      readMemory,
+		onEngagedChange: onEngagedChange,
+		status:          MemoryGuardStatus{LimitBytes: limitBytes},
+	}
+}
+
+func (guard *MemoryGuard) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			guard.Check()
+		}
+	}()
+}
+
+// Check samples the memory usage and updates the drop rate
+func (guard *MemoryGuard) Check() {
+	rssBytes, err := guard.readMemory()
+	if err != nil {
+		logger.Log.Errorf("Failed reading memory usage: %v", err)
+		return
+	}
+
+	guard.lock.Lock()
+	wasEngaged := guard.status.Engaged
+	recoverThreshold := float64(guard.limitBytes) * memoryGuardRecoverRatio
+
+	guard.status.RssBytes = rssBytes
+	if !wasEngaged && float64(rssBytes) >= float64(guard.limitBytes)*memoryGuardEngageRatio {
+		guard.status.Engaged = true
+	} else if wasEngaged && float64(rssBytes) < recoverThreshold {
+		guard.status.Engaged = false
+	}
+
+	if guard.status.Engaged {
+		dropRate := (float64(rssBytes) - recoverThreshold) / (float64(guard.limitBytes) - recoverThreshold)
+		if dropRate > 1 {
+			dropRate = 1
+		} else if dropRate < 0 {
+			dropRate = 0
+		}
+		guard.status.DropRate = dropRate
+	} else {
+		guard.status.DropRate = 0
+		guard.dropCredit = 0
+	}
+	engaged := guard.status.Engaged
+	guard.lock.Unlock()
+
+	if engaged != wasEngaged {
+		if engaged {
+			logger.Log.Warningf("Memory usage %d bytes is close to the limit of %d bytes, shedding load", rssBytes, guard.limitBytes)
+		} else {
+			logger.Log.Infof("Memory usage recovered to %d bytes, stopped shedding load", rssBytes)
+		}
+		if guard.onEngagedChange != nil {
+			guard.onEngagedChange(engaged)
+		}
+	}
+}
+
+// ShouldDrop decides whether the next item is dropped according to the current drop rate
+func (guard *MemoryGuard) ShouldDrop() bool {
+	guard.lock.Lock()
+	defer guard.lock.Unlock()
+
+	if guard.status.DropRate == 0 {
+		return false
+	}
+
+	guard.dropCredit += guard.status.DropRate
+	if guard.dropCredit >= 1 {
+		guard.dropCredit -= 1
+		guard.status.DroppedItems++
+		return true
+	}
+	return false
+}
+
+func (guard *MemoryGuard) GetStatus() MemoryGuardStatus {
+	guard.lock.Lock()
+	defer guard.lock.Unlock()
+
+	return guard.status
+}
+
+// ReadProcessRss returns the resident set size of the current process
+func ReadProcessRss() (uint64, error) {
+	content, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected statm content: %s", content)
+	}
+
+	residentPages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return residentPages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,73 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+)
+
+const testMemoryLimit = 1000
+
+func TestMemoryGuardLoadShedding(t *testing.T) {
+	var rss uint64
+	var engagedChanges []bool
+	guard := filtering.NewMemoryGuard(testMemoryLimit, func() (uint64, error) { return rss, nil }, func(engaged bool) {
+		engagedChanges = append(engagedChanges, engaged)
+	})
+
+	tests := []struct {
+		name             string
+		rss              uint64
+		expectedEngaged  bool
+		expectedDropRate float64
+		expectedDropped  int
+	}{
+		{name: "below threshold", rss: 500, expectedEngaged: false, expectedDropRate: 0, expectedDropped: 0},
+		{name: "approaching limit", rss: 900, expectedEngaged: true, expectedDropRate: 0.5, expectedDropped: 50},
+		{name: "at limit", rss: 1000, expectedEngaged: true, expectedDropRate: 1, expectedDropped: 100},
+		{name: "between recover and engage thresholds", rss: 850, expectedEngaged: true, expectedDropRate: 0.25, expectedDropped: 25},
+		{name: "recovered", rss: 700, expectedEngaged: false, expectedDropRate: 0, expectedDropped: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rss = test.rss
+			guard.Check()
+
+			status := guard.GetStatus()
+			if status.Engaged != test.expectedEngaged {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedEngaged, status.Engaged)
+			}
+			if status.DropRate != test.expectedDropRate {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedDropRate, status.DropRate)
+			}
+
+			dropped := 0
+			for i := 0; i < 100; i++ {
+				if guard.ShouldDrop() {
+					dropped++
+				}
+			}
+			if dropped != test.expectedDropped {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedDropped, dropped)
+			}
+		})
+	}
+
+	expectedChanges := []bool{true, false}
+	if len(engagedChanges) != len(expectedChanges) || engagedChanges[0] != expectedChanges[0] || engagedChanges[1] != expectedChanges[1] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedChanges, engagedChanges)
+	}
+	if status := guard.GetStatus(); status.DroppedItems != 175 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 175, status.DroppedItems)
+	}
+}
+
+func TestReadProcessRss(t *testing.T) {
+	rss, err := filtering.ReadProcessRss()
+	if err != nil {
+		t.Fatalf("failed reading rss: %v", err)
+	}
+	if rss == 0 {
+		t.Errorf("unexpected result - expected a positive rss, actual: %v", rss)
+	}
+}
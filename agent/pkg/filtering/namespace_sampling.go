@@ -0,0 +1,113 @@
+package filtering
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type NamespaceSamplingStats struct {
+	Rate         float64 `json:"rate"`
+	SeenItems    uint64  `json:"seenItems"`
+	KeptItems    uint64  `json:"keptItems"`
+	ObservedRate float64 `json:"observedRate"`
+}
+
+// NamespaceSampler keeps a configured fraction of the flows of every namespace.
+// The decision is derived from a hash of the seed, the namespace and the flow tuple, so it is reproducible,
+// the same for all the items of a flow and independent between namespaces.
+type NamespaceSampler struct {
+	seed        string
+	defaultRate float64
+	rates       map[string]float64
+	stats       map[string]*NamespaceSamplingStats
+	lock        sync.Mutex
+}
+
+// ActiveNamespaceSampler is nil unless namespace sampling is configured
+var ActiveNamespaceSampler *NamespaceSampler
+
+// NewNamespaceSampler returns nil when no sampling is configured
+func NewNamespaceSampler(samplingConfig *shared.NamespaceSamplingConfig) *NamespaceSampler {
+	if samplingConfig == nil {
+		return nil
+	}
+
+	sampler := &NamespaceSampler{
+		seed:        samplingConfig.Seed,
+		defaultRate: 1,
+		rates:       make(map[string]float64),
+		stats:       make(map[string]*NamespaceSamplingStats),
+	}
+	if samplingConfig.DefaultRate != nil {
+		sampler.defaultRate = *samplingConfig.DefaultRate
+	}
+	for namespace, rate := range samplingConfig.Rates {
+		sampler.rates[namespace] = rate
+	}
+	return sampler
+}
+
+// ShouldKeep decides whether the items of the flow are kept, items of unresolved flows belong to the "" namespace
+func (sampler *NamespaceSampler) ShouldKeep(namespace string, connectionInfo *tapApi.ConnectionInfo) bool {
+	rate := sampler.GetRate(namespace)
+	keep := sampler.getFlowFraction(namespace, connectionInfo) < rate
+
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	stats, ok := sampler.stats[namespace]
+	if !ok {
+		stats = &NamespaceSamplingStats{Rate: rate}
+		sampler.stats[namespace] = stats
+	}
+	stats.SeenItems++
+	if keep {
+		stats.KeptItems++
+	}
+	stats.ObservedRate = float64(stats.KeptItems) / float64(stats.SeenItems)
+
+	return keep
+}
+
+func (sampler *NamespaceSampler) GetRate(namespace string) float64 {
+	if rate, ok := sampler.rates[namespace]; ok {
+		return rate
+	}
+	return sampler.defaultRate
+}
+
+// GetStats returns the configured and observed sample rate of every namespace seen so far
+func (sampler *NamespaceSampler) GetStats() map[string]NamespaceSamplingStats {
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	stats := make(map[string]NamespaceSamplingStats, len(sampler.stats))
+	for namespace, namespaceStats := range sampler.stats {
+		stats[namespace] = *namespaceStats
+	}
+	return stats
+}
+
+// getFlowFraction maps the flow uniformly into [0, 1)
+func (sampler *NamespaceSampler) getFlowFraction(namespace string, connectionInfo *tapApi.ConnectionInfo) float64 {
+	hash := fnv.New64a()
+	for _, part := range []string{sampler.seed, namespace, connectionInfo.ClientIP, connectionInfo.ClientPort, connectionInfo.ServerIP, connectionInfo.ServerPort} {
+		_, _ = hash.Write([]byte(part))
+		_, _ = hash.Write([]byte{0})
+	}
+	return float64(mix64(hash.Sum64())) / (math.MaxUint64 + 1.0)
+}
+
+// mix64 is the splitmix64 finalizer, fnv alone spreads inputs that differ only in their last bytes poorly
+func mix64(value uint64) uint64 {
+	value ^= value >> 30
+	value *= 0xbf58476d1ce4e5b9
+	value ^= value >> 27
+	value *= 0x94d049bb133111eb
+	value ^= value >> 31
+	return value
+}
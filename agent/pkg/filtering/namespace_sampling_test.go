@@ -0,0 +1,103 @@
+package filtering_test
+
+import (
+	"fmt"
+	"math"
+	"mizuserver/pkg/filtering"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const namespaceSamplingTestFlows = 10000
+
+func newTestFlow(i int) *tapApi.ConnectionInfo {
+	return &tapApi.ConnectionInfo{
+		ClientIP:   fmt.Sprintf("10.0.%d.%d", i/250, i%250),
+		ClientPort: fmt.Sprintf("%d", 30000+i%1000),
+		ServerIP:   "10.1.0.1",
+		ServerPort: "80",
+	}
+}
+
+func newTestNamespaceSampler(seed string, rates map[string]float64) *filtering.NamespaceSampler {
+	defaultRate := 0.5
+	return filtering.NewNamespaceSampler(&shared.NamespaceSamplingConfig{Seed: seed, DefaultRate: &defaultRate, Rates: rates})
+}
+
+func sampleTestFlows(sampler *filtering.NamespaceSampler, namespace string) []bool {
+	decisions := make([]bool, namespaceSamplingTestFlows)
+	for i := range decisions {
+		decisions[i] = sampler.ShouldKeep(namespace, newTestFlow(i))
+	}
+	return decisions
+}
+
+func countDifferences(a []bool, b []bool) int {
+	differences := 0
+	for i := range a {
+		if a[i] != b[i] {
+			differences++
+		}
+	}
+	return differences
+}
+
+func TestNamespaceSamplerRates(t *testing.T) {
+	sampler := newTestNamespaceSampler("seed", map[string]float64{"noisy": 0.1, "quiet": 1, "muted": 0})
+
+	tests := []struct {
+		namespace    string
+		expectedRate float64
+	}{
+		{namespace: "noisy", expectedRate: 0.1},
+		{namespace: "quiet", expectedRate: 1},
+		{namespace: "muted", expectedRate: 0},
+		{namespace: "other", expectedRate: 0.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.namespace, func(t *testing.T) {
+			sampleTestFlows(sampler, test.namespace)
+
+			stats := sampler.GetStats()[test.namespace]
+			if stats.Rate != test.expectedRate {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedRate, stats.Rate)
+			}
+			if math.Abs(stats.ObservedRate-test.expectedRate) > 0.02 {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedRate, stats.ObservedRate)
+			}
+		})
+	}
+}
+
+func TestNamespaceSamplerReproducible(t *testing.T) {
+	first := sampleTestFlows(newTestNamespaceSampler("seed", nil), "a")
+	second := sampleTestFlows(newTestNamespaceSampler("seed", nil), "a")
+	if differences := countDifferences(first, second); differences != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, differences)
+	}
+
+	otherSeed := sampleTestFlows(newTestNamespaceSampler("other-seed", nil), "a")
+	if differences := countDifferences(first, otherSeed); differences < namespaceSamplingTestFlows/3 {
+		t.Errorf("a different seed should give different decisions, differences: %v", differences)
+	}
+}
+
+func TestNamespaceSamplerIndependentNamespaces(t *testing.T) {
+	// with rate 0.5 uncorrelated namespaces disagree on about half of the same flows
+	sampler := newTestNamespaceSampler("seed", nil)
+	namespaceA := sampleTestFlows(sampler, "a")
+	namespaceB := sampleTestFlows(sampler, "b")
+	if differences := countDifferences(namespaceA, namespaceB); math.Abs(float64(differences)/namespaceSamplingTestFlows-0.5) > 0.05 {
+		t.Errorf("namespaces decisions are correlated, differences: %v", differences)
+	}
+
+	// changing the rate of a noisy namespace doesn't change another namespace's sample
+	noisyLimited := newTestNamespaceSampler("seed", map[string]float64{"b": 0.01})
+	sampleTestFlows(noisyLimited, "b")
+	if differences := countDifferences(namespaceA, sampleTestFlows(noisyLimited, "a")); differences != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, differences)
+	}
+}
@@ -0,0 +1,56 @@
+package filtering
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps maxPerSecond entries per second at most, instead of blocking the capture the entries over the
+// limit are dropped or, when sampleEvery is set, sampled 1 in sampleEvery. Seconds are counted from the first entry
+// of the window rather than aligned to the clock.
+type RateLimiter struct {
+	maxPerSecond int
+	sampleEvery  int
+	windowStart  time.Time
+	windowCount  int
+	overCount    int
+	lock         sync.Mutex
+}
+
+// NewRateLimiter returns nil when no limit is configured
+func NewRateLimiter(maxPerSecond int, sampleEvery int) (*RateLimiter, error) {
+	if maxPerSecond < 0 {
+		return nil, fmt.Errorf("max entries per second can't be negative, got %d", maxPerSecond)
+	}
+	if sampleEvery < 0 {
+		return nil, fmt.Errorf("rate limit sample every can't be negative, got %d", sampleEvery)
+	}
+	if maxPerSecond == 0 {
+		return nil, nil
+	}
+	return &RateLimiter{maxPerSecond: maxPerSecond, sampleEvery: sampleEvery}, nil
+}
+
+// ShouldKeep counts the entry in the second of now, the first of every sampleEvery entries over the limit is kept
+func (limiter *RateLimiter) ShouldKeep(now time.Time) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limiter.windowStart.IsZero() || now.Sub(limiter.windowStart) >= time.Second || now.Before(limiter.windowStart) {
+		limiter.windowStart = now
+		limiter.windowCount = 0
+		limiter.overCount = 0
+	}
+
+	if limiter.windowCount < limiter.maxPerSecond {
+		limiter.windowCount++
+		return true
+	}
+
+	limiter.overCount++
+	if limiter.sampleEvery > 0 && (limiter.overCount-1)%limiter.sampleEvery == 0 {
+		return true
+	}
+	return false
+}
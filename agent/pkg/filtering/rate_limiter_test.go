@@ -0,0 +1,87 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+	"time"
+)
+
+// countKept returns how many of count entries spread evenly over duration from start are kept
+func countKept(limiter *filtering.RateLimiter, start time.Time, duration time.Duration, count int) int {
+	kept := 0
+	for i := 0; i < count; i++ {
+		if limiter.ShouldKeep(start.Add(duration * time.Duration(i) / time.Duration(count))) {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestRateLimiterDropsOverTheLimit(t *testing.T) {
+	limiter, err := filtering.NewRateLimiter(10, 0)
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	if kept := countKept(limiter, start, time.Second, 25); kept != 10 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 10, kept)
+	}
+	// a new second starts a new window
+	if kept := countKept(limiter, start.Add(time.Second), time.Second, 5); kept != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 5, kept)
+	}
+	if kept := countKept(limiter, start.Add(3*time.Second), 10*time.Second, 100); kept != 100 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 100, kept)
+	}
+}
+
+func TestRateLimiterSamplesOverTheLimit(t *testing.T) {
+	limiter, err := filtering.NewRateLimiter(10, 4)
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+
+	// 10 entries within the limit and 1 in 4 of the 30 over it
+	start := time.Unix(1000, 0)
+	if kept := countKept(limiter, start, time.Second, 40); kept != 18 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 18, kept)
+	}
+	if kept := countKept(limiter, start.Add(time.Second), time.Second, 11); kept != 11 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 11, kept)
+	}
+}
+
+func TestRateLimiterClockGoingBack(t *testing.T) {
+	limiter, _ := filtering.NewRateLimiter(1, 0)
+
+	start := time.Unix(1000, 0)
+	if !limiter.ShouldKeep(start) || limiter.ShouldKeep(start) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", "only the first entry kept", "otherwise")
+	}
+	if !limiter.ShouldKeep(start.Add(-time.Minute)) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a new window", "the entry dropped")
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		maxPerSecond  int
+		sampleEvery   int
+		expectedNil   bool
+		expectedError bool
+	}{
+		{maxPerSecond: 0, sampleEvery: 0, expectedNil: true},
+		{maxPerSecond: 0, sampleEvery: 5, expectedNil: true},
+		{maxPerSecond: 100, sampleEvery: 0},
+		{maxPerSecond: -1, sampleEvery: 0, expectedNil: true, expectedError: true},
+		{maxPerSecond: 100, sampleEvery: -1, expectedNil: true, expectedError: true},
+	}
+
+	for _, test := range tests {
+		limiter, err := filtering.NewRateLimiter(test.maxPerSecond, test.sampleEvery)
+		if (err != nil) != test.expectedError || (limiter == nil) != test.expectedNil {
+			t.Errorf("unexpected result for %+v - limiter: %v, err: %v", test, limiter, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package filtering
+
+import (
+	"encoding/json"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// responseBodyPolicy defines, for a single protocol, what an error response is and how its body is removed
+type responseBodyPolicy struct {
+	isErrorResponse func(entry *tapApi.MizuEntry, responseDetails map[string]interface{}) bool
+	omitBody        func(responsePayload map[string]interface{}, responseDetails map[string]interface{})
+}
+
+var responseBodyPolicies = map[string]responseBodyPolicy{
+	"http": {
+		isErrorResponse: func(entry *tapApi.MizuEntry, _ map[string]interface{}) bool {
+			return entry.Status >= 400
+		},
+		omitBody: func(responsePayload map[string]interface{}, responseDetails map[string]interface{}) {
+			if content, ok := responseDetails["content"].(map[string]interface{}); ok {
+				content["text"] = ""
+			}
+			if rawResponse, ok := responsePayload["rawResponse"].(map[string]interface{}); ok {
+				delete(rawResponse, "Body")
+			}
+		},
+	},
+	"redis": {
+		isErrorResponse: func(_ *tapApi.MizuEntry, responseDetails map[string]interface{}) bool {
+			return responseDetails["type"] == "Error"
+		},
+		omitBody: func(_ map[string]interface{}, responseDetails map[string]interface{}) {
+			responseDetails["value"] = ""
+		},
+	},
+}
+
+// OmitSuccessfulResponseBody removes the response body of entries whose response isn't an error, keeping only its metadata.
+// Protocols without a known error definition are left untouched.
+func OmitSuccessfulResponseBody(entry *tapApi.MizuEntry) {
+	policy, ok := responseBodyPolicies[entry.ProtocolName]
+	if !ok {
+		return
+	}
+
+	root, responsePayload, responseDetails := parseResponse(entry)
+	if responseDetails == nil || policy.isErrorResponse(entry, responseDetails) {
+		return
+	}
+
+	policy.omitBody(responsePayload, responseDetails)
+	responseDetails["_bodyOmitted"] = true
+
+	if entryBytes, err := json.Marshal(root); err == nil {
+		entry.Entry = string(entryBytes)
+	}
+}
+
+// IsErrorResponse tells whether the response of the entry is an error, by the error definition of its protocol.
+// Entries of protocols without one are errors when their status is 400 or above.
+func IsErrorResponse(entry *tapApi.MizuEntry) bool {
+	policy, ok := responseBodyPolicies[entry.ProtocolName]
+	if !ok || entry.ProtocolName == "http" {
+		return entry.Status >= 400
+	}
+
+	_, _, responseDetails := parseResponse(entry)
+	return responseDetails != nil && policy.isErrorResponse(entry, responseDetails)
+}
+
+func parseResponse(entry *tapApi.MizuEntry) (map[string]interface{}, map[string]interface{}, map[string]interface{}) {
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Entry), &root); err != nil {
+		return nil, nil, nil
+	}
+	response, _ := root["response"].(map[string]interface{})
+	responsePayload, _ := response["payload"].(map[string]interface{})
+	responseDetails, _ := responsePayload["details"].(map[string]interface{})
+	return root, responsePayload, responseDetails
+}
@@ -0,0 +1,57 @@
+package filtering_test
+
+import (
+	"fmt"
+	"mizuserver/pkg/filtering"
+	"strings"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newHttpEntry(status int, body string) *tapApi.MizuEntry {
+	return &tapApi.MizuEntry{
+		ProtocolName: "http",
+		Status:       status,
+		Entry: fmt.Sprintf(`{"request":{"payload":{"details":{"postData":{"text":"request body"}}}},`+
+			`"response":{"payload":{"details":{"status":%d,"content":{"size":%d,"text":"%s"}},"rawResponse":{"Body":"%s"}}}}`, status, len(body), body, body),
+	}
+}
+
+func newRedisEntry(responseType string, value string) *tapApi.MizuEntry {
+	return &tapApi.MizuEntry{
+		ProtocolName: "redis",
+		Entry: fmt.Sprintf(`{"request":{"payload":{"details":{"command":"GET","key":"k"}}},`+
+			`"response":{"payload":{"details":{"type":"%s","value":"%s"}}}}`, responseType, value),
+	}
+}
+
+func TestOmitSuccessfulResponseBody(t *testing.T) {
+	tests := []struct {
+		name             string
+		entry            *tapApi.MizuEntry
+		body             string
+		expectedBodyKept bool
+	}{
+		{name: "http success", entry: newHttpEntry(200, "large response body"), body: "large response body", expectedBodyKept: false},
+		{name: "http redirect", entry: newHttpEntry(302, "moved body"), body: "moved body", expectedBodyKept: false},
+		{name: "http client error", entry: newHttpEntry(404, "not found body"), body: "not found body", expectedBodyKept: true},
+		{name: "http server error", entry: newHttpEntry(500, "stack trace body"), body: "stack trace body", expectedBodyKept: true},
+		{name: "redis success", entry: newRedisEntry("Bulk String", "cached value"), body: "cached value", expectedBodyKept: false},
+		{name: "redis error", entry: newRedisEntry("Error", "WRONGTYPE value"), body: "WRONGTYPE value", expectedBodyKept: true},
+		{name: "unknown protocol", entry: &tapApi.MizuEntry{ProtocolName: "kafka", Entry: `{"response":{"payload":{"details":{"value":"kafka body"}}}}`}, body: "kafka body", expectedBodyKept: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtering.OmitSuccessfulResponseBody(test.entry)
+
+			if bodyKept := strings.Contains(test.entry.Entry, test.body); bodyKept != test.expectedBodyKept {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedBodyKept, bodyKept)
+			}
+			if !strings.Contains(test.entry.Entry, "request body") && test.entry.ProtocolName == "http" {
+				t.Errorf("request body should always be kept")
+			}
+		})
+	}
+}
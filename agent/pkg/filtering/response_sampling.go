@@ -0,0 +1,85 @@
+package filtering
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// ResponseSampler samples entries once their response is known, so slow and error responses can be kept while the
+// rest is sampled. Like the EndpointSampler, every rule accumulates its rate per matching entry and an entry is kept
+// whenever a whole entry was accumulated.
+type ResponseSampler struct {
+	rules       []responseSamplingRule
+	defaultRate float64
+	credits     []float64
+	lock        sync.Mutex
+}
+
+type responseSamplingRule struct {
+	errors       bool
+	minElapsedMs int64
+	rate         float64
+}
+
+// NewResponseSampler returns nil when no sampling is configured
+func NewResponseSampler(samplingConfig *shared.ResponseSamplingConfig) (*ResponseSampler, error) {
+	if samplingConfig == nil {
+		return nil, nil
+	}
+	if samplingConfig.DefaultRate < 0 || samplingConfig.DefaultRate > 1 {
+		return nil, fmt.Errorf("response sampling default rate must be between 0 and 1, got %v", samplingConfig.DefaultRate)
+	}
+
+	sampler := &ResponseSampler{defaultRate: samplingConfig.DefaultRate}
+	for i, rule := range samplingConfig.Rules {
+		if !rule.Errors && rule.MinElapsedMs <= 0 {
+			return nil, fmt.Errorf("response sampling rule %d has no condition", i)
+		}
+		rate := 1.0
+		if rule.Rate != nil {
+			rate = *rule.Rate
+		}
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("response sampling rule %d rate must be between 0 and 1, got %v", i, rate)
+		}
+		sampler.rules = append(sampler.rules, responseSamplingRule{errors: rule.Errors, minElapsedMs: rule.MinElapsedMs, rate: rate})
+	}
+	// the last credit is the one of the entries matching no rule
+	sampler.credits = make([]float64, len(sampler.rules)+1)
+	for i := range sampler.credits {
+		sampler.credits[i] = 1
+	}
+	return sampler, nil
+}
+
+// ShouldKeep decides whether the entry is kept by the first rule it matches
+func (sampler *ResponseSampler) ShouldKeep(entry *tapApi.MizuEntry) bool {
+	ruleIndex, rate := len(sampler.rules), sampler.defaultRate
+	for i, rule := range sampler.rules {
+		if rule.matches(entry) {
+			ruleIndex, rate = i, rule.rate
+			break
+		}
+	}
+
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	credit := sampler.credits[ruleIndex]
+	if credit >= 1 {
+		sampler.credits[ruleIndex] = credit - 1 + rate
+		return true
+	}
+	sampler.credits[ruleIndex] = credit + rate
+	return false
+}
+
+func (rule *responseSamplingRule) matches(entry *tapApi.MizuEntry) bool {
+	if rule.minElapsedMs > 0 && entry.ElapsedTime < rule.minElapsedMs {
+		return false
+	}
+	return !rule.errors || IsErrorResponse(entry)
+}
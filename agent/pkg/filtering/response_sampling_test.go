@@ -0,0 +1,102 @@
+package filtering_test
+
+import (
+	"mizuserver/pkg/filtering"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newSampledEntry(status int, elapsedTime int64) *tapApi.MizuEntry {
+	entry := newHttpEntry(status, "body")
+	entry.ElapsedTime = elapsedTime
+	return entry
+}
+
+func TestResponseSampler(t *testing.T) {
+	sampler, err := filtering.NewResponseSampler(&shared.ResponseSamplingConfig{
+		Rules: []shared.ResponseSamplingRule{
+			{Errors: true},
+			{MinElapsedMs: 500},
+		},
+		DefaultRate: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sampler: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		entry        *tapApi.MizuEntry
+		expectedKept int
+	}{
+		{name: "client error", entry: newSampledEntry(404, 10), expectedKept: 100},
+		{name: "server error", entry: newSampledEntry(503, 10), expectedKept: 100},
+		{name: "slow success", entry: newSampledEntry(200, 500), expectedKept: 100},
+		{name: "fast success", entry: newSampledEntry(200, 499), expectedKept: 10},
+		{name: "redis error", entry: newRedisEntry("Error", "ERR"), expectedKept: 100},
+		{name: "fast redis success", entry: newRedisEntry("Bulk String", "value"), expectedKept: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept := 0
+			for i := 0; i < 100; i++ {
+				if sampler.ShouldKeep(test.entry) {
+					kept++
+				}
+			}
+
+			if kept != test.expectedKept {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedKept, kept)
+			}
+		})
+	}
+}
+
+func TestResponseSamplerRuleOrder(t *testing.T) {
+	rate := 0.5
+	// slow errors match the first rule only
+	sampler, _ := filtering.NewResponseSampler(&shared.ResponseSamplingConfig{
+		Rules: []shared.ResponseSamplingRule{
+			{Errors: true, MinElapsedMs: 1000, Rate: &rate},
+			{Errors: true},
+		},
+	})
+
+	slowErrorsKept, fastErrorsKept, successesKept := 0, 0, 0
+	for i := 0; i < 100; i++ {
+		if sampler.ShouldKeep(newSampledEntry(500, 2000)) {
+			slowErrorsKept++
+		}
+		if sampler.ShouldKeep(newSampledEntry(500, 10)) {
+			fastErrorsKept++
+		}
+		if sampler.ShouldKeep(newSampledEntry(200, 2000)) {
+			successesKept++
+		}
+	}
+
+	if slowErrorsKept != 50 || fastErrorsKept != 100 || successesKept != 1 {
+		t.Errorf("unexpected result - expected: %v %v %v, actual: %v %v %v", 50, 100, 1, slowErrorsKept, fastErrorsKept, successesKept)
+	}
+}
+
+func TestNewResponseSamplerInvalid(t *testing.T) {
+	invalidRate := 1.5
+	tests := []*shared.ResponseSamplingConfig{
+		{DefaultRate: -0.1},
+		{Rules: []shared.ResponseSamplingRule{{}}},
+		{Rules: []shared.ResponseSamplingRule{{Errors: true, Rate: &invalidRate}}},
+	}
+
+	for _, samplingConfig := range tests {
+		if _, err := filtering.NewResponseSampler(samplingConfig); err == nil {
+			t.Errorf("unexpected result - expected an error, actual: %v", samplingConfig)
+		}
+	}
+	if sampler, err := filtering.NewResponseSampler(nil); sampler != nil || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, sampler, err)
+	}
+}
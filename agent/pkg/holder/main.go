@@ -1,9 +1,18 @@
 package holder
 
-import "mizuserver/pkg/resolver"
+import (
+	"sync"
+
+	"mizuserver/pkg/resolver"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
 
 var k8sResolver *resolver.Resolver
 
+var extensionsMap map[string]*tapApi.Extension
+var extensionsMapMutex sync.RWMutex
+
 func SetResolver(param *resolver.Resolver) {
 	k8sResolver = param
 }
@@ -12,3 +21,15 @@ func GetResolver() *resolver.Resolver {
 	return k8sResolver
 }
 
+// SetExtensionsMap replaces the extensions by protocol name, the map mustn't be changed once it's set
+func SetExtensionsMap(ref map[string]*tapApi.Extension) {
+	extensionsMapMutex.Lock()
+	defer extensionsMapMutex.Unlock()
+	extensionsMap = ref
+}
+
+func GetExtensionsMap() map[string]*tapApi.Extension {
+	extensionsMapMutex.RLock()
+	defer extensionsMapMutex.RUnlock()
+	return extensionsMap
+}
@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"mizuserver/pkg/config"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const bearerPrefix = "Bearer "
+
+// RequireAdminToken rejects requests that don't carry the configured admin token as a bearer token.
+// Admin routes are disabled altogether when no admin token is configured.
+func RequireAdminToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.Config == nil || config.Config.AdminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{
+				"error": true,
+				"msg":   "admin routes are disabled, no admin token is configured",
+			})
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		token := strings.TrimPrefix(authHeader, bearerPrefix)
+		if !strings.HasPrefix(authHeader, bearerPrefix) || subtle.ConstantTimeCompare([]byte(token), []byte(config.Config.AdminToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": true,
+				"msg":   "invalid or missing admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
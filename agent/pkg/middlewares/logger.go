@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const redactedWebSocketToken = "[REDACTED]"
+
+// Logger logs the requests like the default logger of gin, with the websocket token query param redacted so the
+// browsers' websocket tokens never reach the logs
+func Logger(out io.Writer) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{Output: out, Formatter: func(params gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if params.IsOutputColor() {
+			statusColor, methodColor, resetColor = params.StatusCodeColor(), params.MethodColor(), params.ResetColor()
+		}
+		if params.Latency > time.Minute {
+			params.Latency = params.Latency - params.Latency%time.Second
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, params.StatusCode, resetColor,
+			params.Latency,
+			params.ClientIP,
+			methodColor, params.Method, resetColor,
+			redactWebSocketToken(params.Path),
+			params.ErrorMessage,
+		)
+	}})
+}
+
+// redactWebSocketToken replaces the value of the token query param of the path, the path is kept as is otherwise
+func redactWebSocketToken(path string) string {
+	queryIndex := strings.IndexByte(path, '?')
+	if queryIndex < 0 {
+		return path
+	}
+	// the params that fail to parse are dropped, a malformed param doesn't keep the token from being redacted
+	query, _ := url.ParseQuery(path[queryIndex+1:])
+	if _, ok := query[webSocketTokenQueryParam]; !ok {
+		return path
+	}
+	query.Set(webSocketTokenQueryParam, redactedWebSocketToken)
+	return path[:queryIndex+1] + query.Encode()
+}
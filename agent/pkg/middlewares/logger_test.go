@@ -0,0 +1,40 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"mizuserver/pkg/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoggerRedactsWebSocketToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	app := gin.New()
+	app.Use(middlewares.Logger(&logs))
+	app.GET("/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/ws?token=secret-token", expected: `"/ws?token=%5BREDACTED%5D"`},
+		{target: "/ws?token=secret-token&a=%zz", expected: `"/ws?token=%5BREDACTED%5D"`},
+		{target: "/ws?a=b", expected: `"/ws?a=b"`},
+		{target: "/ws", expected: `"/ws"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			logs.Reset()
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.target, nil))
+			if strings.Contains(logs.String(), "secret-token") || !strings.Contains(logs.String(), test.expected) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, logs.String())
+			}
+		})
+	}
+}
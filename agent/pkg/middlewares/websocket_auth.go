@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"mizuserver/pkg/config"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const webSocketTokenQueryParam = "token"
+
+// RequireWebSocketToken rejects the websocket upgrades that don't carry the configured websocket token, either as a
+// bearer token or as the token query param since browsers can't set headers on websockets.
+// The websockets are open to every client when no websocket token is configured.
+func RequireWebSocketToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.Config == nil || config.Config.WebSocketToken == "" {
+			c.Next()
+			return
+		}
+
+		token := c.Query(webSocketTokenQueryParam)
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, bearerPrefix) {
+			token = strings.TrimPrefix(authHeader, bearerPrefix)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.Config.WebSocketToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": true,
+				"msg":   "invalid or missing websocket token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+// MessageEncoding is the encoding of the tapped entries a tapper sends, negotiated as a subprotocol of the socket.
+// The other messages are always json.
+type MessageEncoding string
+
+const (
+	MessageEncodingJson    MessageEncoding = "json"
+	MessageEncodingMsgpack MessageEncoding = "msgpack"
+
+	JsonSubprotocol    = "mizu.json"
+	MsgpackSubprotocol = "mizu.msgpack"
+)
+
+var msgpackHandle = newMsgpackHandle()
+
+func newMsgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	// decode to the types json decodes to
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	return handle
+}
+
+func ParseMessageEncoding(value string) (MessageEncoding, error) {
+	switch MessageEncoding(value) {
+	case "", MessageEncodingJson:
+		return MessageEncodingJson, nil
+	case MessageEncodingMsgpack:
+		return MessageEncodingMsgpack, nil
+	default:
+		return "", fmt.Errorf("unknown message encoding %s", value)
+	}
+}
+
+// GetSubprotocols returns the subprotocols a tapper offers for the encoding, by preference, json is the fallback
+func GetSubprotocols(encoding MessageEncoding) []string {
+	if encoding == MessageEncodingMsgpack {
+		return []string{MsgpackSubprotocol, JsonSubprotocol}
+	}
+	return []string{JsonSubprotocol}
+}
+
+// GetSubprotocolEncoding returns the encoding of a negotiated subprotocol, sockets without one use json
+func GetSubprotocolEncoding(subprotocol string) MessageEncoding {
+	if subprotocol == MsgpackSubprotocol {
+		return MessageEncodingMsgpack
+	}
+	return MessageEncodingJson
+}
+
+func CreateWebsocketTappedEntryMessage(base *tapApi.OutputChannelItem, sequence uint64, encoding MessageEncoding) ([]byte, error) {
+	message := &WebSocketTappedEntryMessage{
+		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
+			MessageType:   shared.WebSocketMessageTypeTappedEntry,
+			SchemaVersion: shared.WebSocketSchemaVersion,
+		},
+		Sequence: sequence,
+		Data:     base,
+	}
+	if encoding != MessageEncodingMsgpack {
+		return json.Marshal(message)
+	}
+
+	item, err := DecodeOutputChannelItem(base)
+	if err != nil {
+		return nil, err
+	}
+	message.Data = item
+
+	var data []byte
+	err = codec.NewEncoderBytes(&data, msgpackHandle).Encode(message)
+	return data, err
+}
+
+func DecodeWebsocketTappedEntryMessage(message []byte, encoding MessageEncoding) (*WebSocketTappedEntryMessage, error) {
+	var tappedEntryMessage WebSocketTappedEntryMessage
+	var err error
+	if encoding == MessageEncodingMsgpack {
+		err = codec.NewDecoderBytes(message, msgpackHandle).Decode(&tappedEntryMessage)
+	} else {
+		err = json.Unmarshal(message, &tappedEntryMessage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tappedEntryMessage, nil
+}
+
+// DecodeOutputChannelItem returns a copy of the item with the payloads decoded like the api server decodes the items
+// of the tappers, for the items dissected by the api server itself
+func DecodeOutputChannelItem(base *tapApi.OutputChannelItem) (*tapApi.OutputChannelItem, error) {
+	pair, err := toDecodedPair(base.Pair)
+	if err != nil {
+		return nil, err
+	}
+	item := *base
+	item.Pair = pair
+	return &item, nil
+}
+
+// toDecodedPair replaces the payloads with the values their json decodes to. The payloads of the extensions are only
+// marshaled as json, the api server gets the same payloads under both encodings.
+func toDecodedPair(pair *tapApi.RequestResponsePair) (*tapApi.RequestResponsePair, error) {
+	if pair == nil {
+		return nil, nil
+	}
+	decodedPair := *pair
+	for _, message := range []*tapApi.GenericMessage{&decodedPair.Request, &decodedPair.Response} {
+		payloadBytes, err := json.Marshal(message.Payload)
+		if err != nil {
+			return nil, err
+		}
+		var payload interface{}
+		if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+			return nil, err
+		}
+		message.Payload = payload
+	}
+	return &decodedPair, nil
+}
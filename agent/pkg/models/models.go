@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 
 	tapApi "github.com/up9inc/mizu/tap/api"
 
@@ -17,9 +18,25 @@ func GetEntry(r *tapApi.MizuEntry, v tapApi.DataUnmarshaler) error {
 }
 
 type EntriesFilter struct {
-	Limit     int    `form:"limit" validate:"required,min=1,max=200"`
-	Operator  string `form:"operator" validate:"required,oneof='lt' 'gt'"`
-	Timestamp int64  `form:"timestamp" validate:"required,min=1"`
+	Limit           int      `form:"limit" validate:"required,min=1,max=200"`
+	Operator        string   `form:"operator" validate:"required,oneof='lt' 'gt'"`
+	Timestamp       int64    `form:"timestamp" validate:"required,min=1"`
+	MinRequestSize  *int64   `form:"minRequestSize" validate:"omitempty,min=0"`
+	MaxRequestSize  *int64   `form:"maxRequestSize" validate:"omitempty,min=0"`
+	MinResponseSize *int64   `form:"minResponseSize" validate:"omitempty,min=0"`
+	MaxResponseSize *int64   `form:"maxResponseSize" validate:"omitempty,min=0"`
+	Filter          string   `form:"filter"`
+	QueryParams     []string `form:"queryParam"` // name=value, or a name alone for entries with the param
+}
+
+type FilterValidationRequest struct {
+	Filter string `json:"filter"`
+}
+
+type FilterValidationResponse struct {
+	Valid    bool   `json:"valid"`
+	Msg      string `json:"msg,omitempty"`
+	Position *int   `json:"position,omitempty"`
 }
 
 type WebSocketEntryMessage struct {
@@ -27,9 +44,42 @@ type WebSocketEntryMessage struct {
 	Data *tapApi.BaseEntryDetails `json:"data,omitempty"`
 }
 
+type WebSocketEntryBatchMessage struct {
+	*shared.WebSocketMessageMetadata
+	Data []*tapApi.BaseEntryDetails `json:"data"`
+}
+
+type WebSocketEntryReferenceMessage struct {
+	*shared.WebSocketMessageMetadata
+	Data *EntryReference `json:"data"`
+}
+
+// EntryReference stands for an entry too large to broadcast, clients fetch the entry by its id
+type EntryReference struct {
+	Id               string          `json:"id"`
+	Protocol         tapApi.Protocol `json:"protocol"`
+	Method           string          `json:"method,omitempty"`
+	StatusCode       int             `json:"statusCode"`
+	Timestamp        int64           `json:"timestamp,omitempty"`
+	SizeBytes        int             `json:"sizeBytes"` // the size of the entry message that wasn't broadcast
+	Preview          string          `json:"preview"`   // the beginning of the summary
+	PreviewTruncated bool            `json:"previewTruncated"`
+}
+
 type WebSocketTappedEntryMessage struct {
 	*shared.WebSocketMessageMetadata
-	Data *tapApi.OutputChannelItem
+	Sequence uint64 `json:"sequence,omitempty"` // the api server acknowledges entries sent with a sequence
+	Data     *tapApi.OutputChannelItem
+}
+
+type WebSocketTappedEntryAckMessage struct {
+	*shared.WebSocketMessageMetadata
+	Data *TappedEntryAck `json:"data"`
+}
+
+// TappedEntryAck tells a tapper the entry it sent with the sequence was persisted, or dropped by the filtering
+type TappedEntryAck struct {
+	Sequence uint64 `json:"sequence"`
 }
 
 type WebsocketOutboundLinkMessage struct {
@@ -37,6 +87,119 @@ type WebsocketOutboundLinkMessage struct {
 	Data *tap.OutboundLink
 }
 
+type LogLevelRequest struct {
+	Level string `json:"level" validate:"required"`
+}
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+type SampleRateRequest struct {
+	Rate *float64 `json:"rate" validate:"required"`
+}
+
+type SampleRateResponse struct {
+	Rate float64 `json:"rate"`
+}
+
+type WebSocketStreamInterruptionMessage struct {
+	*shared.WebSocketMessageMetadata
+	Data *StreamInterruption `json:"data"`
+}
+
+// StreamInterruption describes a reconnection of the tapper to the API server, the entries tapped meanwhile are buffered and resent
+type StreamInterruption struct {
+	InterruptedAt int64 `json:"interruptedAt"`
+	ResumedAt     int64 `json:"resumedAt"`
+	GapMs         int64 `json:"gapMs"`
+}
+
+type ServiceMapRequest struct {
+	ExcludeUnresolved bool `form:"excludeUnresolved"`
+}
+
+// Readiness is ready when all the subsystems started by the process are
+type Readiness struct {
+	Ready      bool              `json:"ready"`
+	Subsystems []SubsystemStatus `json:"subsystems"`
+}
+
+type SubsystemStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Since int64  `json:"since"` // when the subsystem became ready or stopped being ready, in unix ms
+}
+
+// SequenceDiagramRequest selects the correlated entries of a sequence diagram by exactly one of a flow, a redirect
+// chain or a filter expression, e.g. on a promoted trace id header
+type SequenceDiagramRequest struct {
+	Flow          string `form:"flow"`
+	RedirectChain string `form:"redirectChain"`
+	Filter        string `form:"filter"`
+	Format        string `form:"format"` // mermaid, the default, or plantuml
+}
+
+type ServiceMapNode struct {
+	Name     string `json:"name"`
+	Resolved bool   `json:"resolved"`
+}
+
+// ServiceMapEdge aggregates all the captured calls from one workload to another
+type ServiceMapEdge struct {
+	Source       string  `json:"source"`
+	Destination  string  `json:"destination"`
+	CallCount    int     `json:"callCount"`
+	ErrorCount   int     `json:"errorCount"`
+	ErrorRate    float64 `json:"errorRate"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	MaxLatencyMs int64   `json:"maxLatencyMs"`
+}
+
+type ServiceMap struct {
+	Nodes []*ServiceMapNode `json:"nodes"`
+	Edges []*ServiceMapEdge `json:"edges"`
+}
+
+// ApiCoverage tells which operations of an OpenAPI spec were observed in the captured entries
+type ApiCoverage struct {
+	OperationsCount int                     `json:"operationsCount"`
+	CoveredCount    int                     `json:"coveredCount"`
+	CoveragePercent float64                 `json:"coveragePercent"`
+	Operations      []*ApiCoverageOperation `json:"operations"`
+}
+
+type ApiCoverageOperation struct {
+	Path        string `json:"path"`
+	Method      string `json:"method"`
+	Observed    bool   `json:"observed"`
+	CallCount   int    `json:"callCount"`
+	StatusCodes []int  `json:"statusCodes"`
+}
+
+const (
+	ConnectionEventOpen  = "open"
+	ConnectionEventEntry = "entry"
+	ConnectionEventClose = "close"
+)
+
+// ConnectionTimeline lists the entries of a single connection from oldest to newest, between the markers of its
+// opening and its closing when they were observed. The markers are only observed in standalone and pcap-read modes,
+// where the process serving the timeline captured the connection.
+type ConnectionTimeline struct {
+	Flow   string             `json:"flow"`
+	Events []*ConnectionEvent `json:"events"`
+}
+
+// ConnectionEvent is an entry or a marker of a ConnectionTimeline. GapMs of an entry is the time from the end of the
+// previous entry, or from the opening of the connection, to its start; it's negative when the requests were pipelined.
+type ConnectionEvent struct {
+	Type      string                   `json:"type"`
+	Timestamp int64                    `json:"timestamp"`
+	Entry     *tapApi.BaseEntryDetails `json:"entry,omitempty"`
+	GapMs     *int64                   `json:"gapMs,omitempty"`
+}
+
 type AuthStatus struct {
 	Email string `json:"email"`
 	Model string `json:"model"`
@@ -45,19 +208,32 @@ type AuthStatus struct {
 func CreateBaseEntryWebSocketMessage(base *tapApi.BaseEntryDetails) ([]byte, error) {
 	message := &WebSocketEntryMessage{
 		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
-			MessageType: shared.WebSocketMessageTypeEntry,
+			MessageType:   shared.WebSocketMessageTypeEntry,
+			SchemaVersion: shared.WebSocketSchemaVersion,
 		},
 		Data: base,
 	}
 	return json.Marshal(message)
 }
 
-func CreateWebsocketTappedEntryMessage(base *tapApi.OutputChannelItem) ([]byte, error) {
-	message := &WebSocketTappedEntryMessage{
+func CreateBaseEntryBatchWebSocketMessage(baseEntries []*tapApi.BaseEntryDetails) ([]byte, error) {
+	message := &WebSocketEntryBatchMessage{
 		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
-			MessageType: shared.WebSocketMessageTypeTappedEntry,
+			MessageType:   shared.WebSocketMessageTypeEntryBatch,
+			SchemaVersion: shared.WebSocketSchemaVersion,
 		},
-		Data: base,
+		Data: baseEntries,
+	}
+	return json.Marshal(message)
+}
+
+func CreateEntryReferenceWebSocketMessage(reference *EntryReference) ([]byte, error) {
+	message := &WebSocketEntryReferenceMessage{
+		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
+			MessageType:   shared.WebSocketMessageTypeEntryReference,
+			SchemaVersion: shared.WebSocketSchemaVersion,
+		},
+		Data: reference,
 	}
 	return json.Marshal(message)
 }
@@ -65,13 +241,40 @@ func CreateWebsocketTappedEntryMessage(base *tapApi.OutputChannelItem) ([]byte,
 func CreateWebsocketOutboundLinkMessage(base *tap.OutboundLink) ([]byte, error) {
 	message := &WebsocketOutboundLinkMessage{
 		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
-			MessageType: shared.WebsocketMessageTypeOutboundLink,
+			MessageType:   shared.WebsocketMessageTypeOutboundLink,
+			SchemaVersion: shared.WebSocketSchemaVersion,
 		},
 		Data: base,
 	}
 	return json.Marshal(message)
 }
 
+func CreateWebsocketStreamInterruptionMessage(interruptedAt time.Time, resumedAt time.Time) ([]byte, error) {
+	message := &WebSocketStreamInterruptionMessage{
+		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
+			MessageType:   shared.WebSocketMessageTypeStreamInterruption,
+			SchemaVersion: shared.WebSocketSchemaVersion,
+		},
+		Data: &StreamInterruption{
+			InterruptedAt: interruptedAt.UnixNano() / int64(time.Millisecond),
+			ResumedAt:     resumedAt.UnixNano() / int64(time.Millisecond),
+			GapMs:         resumedAt.Sub(interruptedAt).Milliseconds(),
+		},
+	}
+	return json.Marshal(message)
+}
+
+func CreateWebsocketTappedEntryAckMessage(sequence uint64) ([]byte, error) {
+	message := &WebSocketTappedEntryAckMessage{
+		WebSocketMessageMetadata: &shared.WebSocketMessageMetadata{
+			MessageType:   shared.WebSocketMessageTypeTappedEntryAck,
+			SchemaVersion: shared.WebSocketSchemaVersion,
+		},
+		Data: &TappedEntryAck{Sequence: sequence},
+	}
+	return json.Marshal(message)
+}
+
 // ExtendedHAR is the top level object of a HAR log.
 type ExtendedHAR struct {
 	Log *ExtendedLog `json:"log"`
@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"mizuserver/pkg/models"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type apiCoverageOperationKey struct {
+	path   string
+	method string
+}
+
+type apiCoverageTemplate struct {
+	path     string
+	segments []string
+}
+
+// BuildApiCoverage matches the entries to the operations of the spec, an entry is matched to the path template with
+// the most literal segments, under one of the base paths of the spec servers
+func BuildApiCoverage(doc *openapi3.T, entries []tapApi.MizuEntry) *models.ApiCoverage {
+	operations := map[apiCoverageOperationKey]*models.ApiCoverageOperation{}
+	templatesByMethod := map[string][]*apiCoverageTemplate{}
+	for path, pathItem := range doc.Paths {
+		template := &apiCoverageTemplate{path: path, segments: getPathSegments(NormalizeCoveragePath(path))}
+		for method := range pathItem.Operations() {
+			operations[apiCoverageOperationKey{path: path, method: method}] = &models.ApiCoverageOperation{Path: path, Method: method, StatusCodes: make([]int, 0)}
+			templatesByMethod[method] = append(templatesByMethod[method], template)
+		}
+	}
+	basePaths := getSpecBasePaths(doc)
+
+	statusCodes := map[apiCoverageOperationKey]map[int]bool{}
+	for _, entry := range entries {
+		method := strings.ToUpper(entry.Method)
+		template := matchPathTemplate(templatesByMethod[method], basePaths, NormalizeCoveragePath(entry.Path))
+		if template == nil {
+			continue
+		}
+
+		key := apiCoverageOperationKey{path: template.path, method: method}
+		operation := operations[key]
+		operation.Observed = true
+		operation.CallCount++
+		if statusCodes[key] == nil {
+			statusCodes[key] = map[int]bool{}
+		}
+		if entry.Status != 0 && !statusCodes[key][entry.Status] {
+			statusCodes[key][entry.Status] = true
+			operation.StatusCodes = append(operation.StatusCodes, entry.Status)
+		}
+	}
+
+	coverage := &models.ApiCoverage{Operations: make([]*models.ApiCoverageOperation, 0, len(operations))}
+	for _, operation := range operations {
+		sort.Ints(operation.StatusCodes)
+		if operation.Observed {
+			coverage.CoveredCount++
+		}
+		coverage.Operations = append(coverage.Operations, operation)
+	}
+	coverage.OperationsCount = len(coverage.Operations)
+	if coverage.OperationsCount > 0 {
+		coverage.CoveragePercent = float64(coverage.CoveredCount) * 100 / float64(coverage.OperationsCount)
+	}
+
+	sort.Slice(coverage.Operations, func(i, j int) bool {
+		if coverage.Operations[i].Path != coverage.Operations[j].Path {
+			return coverage.Operations[i].Path < coverage.Operations[j].Path
+		}
+		return coverage.Operations[i].Method < coverage.Operations[j].Method
+	})
+	return coverage
+}
+
+// NormalizeCoveragePath drops the scheme and host, the query, repeated slashes and the trailing slash of a path
+func NormalizeCoveragePath(path string) string {
+	if schemeEnd := strings.Index(path, "://"); schemeEnd != -1 {
+		path = path[schemeEnd+len("://"):]
+		if hostEnd := strings.Index(path, "/"); hostEnd != -1 {
+			path = path[hostEnd:]
+		} else {
+			path = "/"
+		}
+	}
+	if queryStart := strings.IndexAny(path, "?#"); queryStart != -1 {
+		path = path[:queryStart]
+	}
+
+	return "/" + strings.Join(getPathSegments(path), "/")
+}
+
+func getPathSegments(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// getSpecBasePaths returns the paths of the server urls, the root is always included since the servers are often
+// omitted or point at a gateway in front of the captured service
+func getSpecBasePaths(doc *openapi3.T) [][]string {
+	basePaths := [][]string{{}}
+	for _, server := range doc.Servers {
+		if segments := getPathSegments(NormalizeCoveragePath(server.URL)); len(segments) > 0 {
+			basePaths = append(basePaths, segments)
+		}
+	}
+	return basePaths
+}
+
+func matchPathTemplate(templates []*apiCoverageTemplate, basePaths [][]string, path string) *apiCoverageTemplate {
+	pathSegments := getPathSegments(path)
+
+	var bestTemplate *apiCoverageTemplate
+	bestLiteralSegments := -1
+	for _, basePath := range basePaths {
+		if !hasSegmentsPrefix(pathSegments, basePath) {
+			continue
+		}
+		relativeSegments := pathSegments[len(basePath):]
+		for _, template := range templates {
+			if literalSegments, ok := matchTemplateSegments(template.segments, relativeSegments); ok && literalSegments > bestLiteralSegments {
+				bestTemplate, bestLiteralSegments = template, literalSegments
+			}
+		}
+	}
+	return bestTemplate
+}
+
+func hasSegmentsPrefix(segments []string, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i := range prefix {
+		if segments[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTemplateSegments returns the number of literal segments of a template the path matches, a templated segment
+// like {id} matches any segment
+func matchTemplateSegments(templateSegments []string, pathSegments []string) (int, bool) {
+	if len(templateSegments) != len(pathSegments) {
+		return 0, false
+	}
+	literalSegments := 0
+	for i, templateSegment := range templateSegments {
+		if strings.HasPrefix(templateSegment, "{") && strings.HasSuffix(templateSegment, "}") {
+			continue
+		}
+		if templateSegment != pathSegments[i] {
+			return 0, false
+		}
+		literalSegments++
+	}
+	return literalSegments, true
+}
@@ -0,0 +1,110 @@
+package providers_test
+
+import (
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/providers"
+	"reflect"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const apiCoverageTestSpec = `
+openapi: 3.0.0
+info:
+  title: orders
+  version: "1.0"
+servers:
+  - url: https://orders.example.com/api/v1
+paths:
+  /orders:
+    get:
+      responses:
+        "200":
+          description: ok
+    post:
+      responses:
+        "201":
+          description: created
+  /orders/{orderId}:
+    get:
+      responses:
+        "200":
+          description: ok
+  /orders/latest:
+    get:
+      responses:
+        "200":
+          description: ok
+  /health:
+    get:
+      responses:
+        "200":
+          description: ok
+`
+
+func TestBuildApiCoverage(t *testing.T) {
+	doc, err := (&openapi3.Loader{}).LoadFromData([]byte(apiCoverageTestSpec))
+	if err != nil {
+		t.Fatalf("failed to load spec: %v", err)
+	}
+
+	entries := []tapApi.MizuEntry{
+		{Method: "GET", Path: "/api/v1/orders?limit=10", Status: 200},
+		{Method: "get", Path: "/orders/", Status: 500},
+		{Method: "GET", Path: "//api/v1/orders/42", Status: 200},
+		{Method: "GET", Path: "/api/v1/orders/17", Status: 404},
+		{Method: "GET", Path: "http://orders:8080/api/v1/orders/latest", Status: 200},
+		// not documented
+		{Method: "DELETE", Path: "/api/v1/orders/42", Status: 204},
+		{Method: "GET", Path: "/api/v1/orders/42/items", Status: 200},
+		{Method: "GET", Path: "/api/v2/health", Status: 200},
+	}
+
+	expected := &models.ApiCoverage{
+		OperationsCount: 5,
+		CoveredCount:    3,
+		CoveragePercent: 60,
+		Operations: []*models.ApiCoverageOperation{
+			{Path: "/health", Method: "GET", Observed: false, CallCount: 0, StatusCodes: []int{}},
+			{Path: "/orders", Method: "GET", Observed: true, CallCount: 2, StatusCodes: []int{200, 500}},
+			{Path: "/orders", Method: "POST", Observed: false, CallCount: 0, StatusCodes: []int{}},
+			{Path: "/orders/latest", Method: "GET", Observed: true, CallCount: 1, StatusCodes: []int{200}},
+			{Path: "/orders/{orderId}", Method: "GET", Observed: true, CallCount: 2, StatusCodes: []int{200, 404}},
+		},
+	}
+
+	coverage := providers.BuildApiCoverage(doc, entries)
+	if coverage.OperationsCount != expected.OperationsCount || coverage.CoveredCount != expected.CoveredCount || coverage.CoveragePercent != expected.CoveragePercent {
+		t.Errorf("unexpected result - expected: %v/%v %v%%, actual: %v/%v %v%%", expected.CoveredCount, expected.OperationsCount, expected.CoveragePercent, coverage.CoveredCount, coverage.OperationsCount, coverage.CoveragePercent)
+	}
+	if len(coverage.Operations) != len(expected.Operations) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected.Operations), len(coverage.Operations))
+	}
+	for i := range expected.Operations {
+		if !reflect.DeepEqual(coverage.Operations[i], expected.Operations[i]) {
+			t.Errorf("unexpected result - expected: %+v, actual: %+v", expected.Operations[i], coverage.Operations[i])
+		}
+	}
+}
+
+func TestNormalizeCoveragePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "", expected: "/"},
+		{path: "/", expected: "/"},
+		{path: "/orders/", expected: "/orders"},
+		{path: "/orders//42?expand=items#top", expected: "/orders/42"},
+		{path: "https://orders.example.com", expected: "/"},
+		{path: "https://orders.example.com/api/v1/", expected: "/api/v1"},
+	}
+
+	for _, test := range tests {
+		if actual := providers.NormalizeCoveragePath(test.path); actual != test.expected {
+			t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, actual)
+		}
+	}
+}
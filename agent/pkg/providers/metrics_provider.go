@@ -0,0 +1,116 @@
+package providers
+
+import (
+	"mizuserver/pkg/holder"
+	"mizuserver/pkg/up9"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsRegistry holds the metrics pushed to the pushgateway and served on /metrics, it's dedicated so nothing
+// registered to the default registry by a dependency is exposed
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	tappedEntriesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_tapped_entries_total",
+		Help: "Number of tapped entries reaching the filtering.",
+	})
+	filteredOutEntriesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_filtered_out_entries_total",
+		Help: "Number of tapped entries dropped by the filtering.",
+	})
+	rateLimitedEntriesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_rate_limited_entries_total",
+		Help: "Number of tapped entries dropped by the rate limiting, included in the filtered out entries.",
+	})
+	socketSendFailuresCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_socket_send_failures_total",
+		Help: "Number of entries the tapper failed sending to the api server.",
+	})
+	socketReconnectionsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_socket_reconnections_total",
+		Help: "Number of attempts of the tapper to reconnect to the api server.",
+	})
+	tappedPodsChangesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mizu_tapped_pods_changes_total",
+		Help: "Number of changes of the tapped pods seen by the tapper syncer.",
+	})
+
+	entriesDesc             = prometheus.NewDesc("mizu_entries_total", "Number of captured entries.", nil, nil)
+	firstEntryTimestampDesc = prometheus.NewDesc("mizu_first_entry_timestamp_seconds", "Unix time of the first captured entry.", nil, nil)
+	lastEntryTimestampDesc  = prometheus.NewDesc("mizu_last_entry_timestamp_seconds", "Unix time of the last captured entry.", nil, nil)
+	tappersDesc             = prometheus.NewDesc("mizu_tappers", "Number of connected tappers.", nil, nil)
+	tappedPodsDesc          = prometheus.NewDesc("mizu_tapped_pods", "Number of currently tapped pods.", nil, nil)
+	resolverCacheHitsDesc   = prometheus.NewDesc("mizu_resolver_cache_hits_total", "Number of addresses resolved to a k8s resource.", nil, nil)
+	resolverCacheMissesDesc = prometheus.NewDesc("mizu_resolver_cache_misses_total", "Number of addresses not resolved, the expired names included.", nil, nil)
+	syncBreakerStateDesc    = prometheus.NewDesc("mizu_sync_entries_breaker_state", "State of the circuit breaker of the sync of the entries to up9, 0 closed, 1 open and 2 half-open.", nil, nil)
+)
+
+func init() {
+	MetricsRegistry.MustRegister(tappedEntriesCounter, filteredOutEntriesCounter, rateLimitedEntriesCounter, tappedPodsChangesCounter, statsCollector{})
+}
+
+// RegisterTapperMetrics adds the socket metrics to the registry, they're counted by the tapper so only its registry
+// has them. Registering them again is a no-op.
+func RegisterTapperMetrics(registerer prometheus.Registerer) {
+	for _, collector := range []prometheus.Collector{socketSendFailuresCounter, socketReconnectionsCounter} {
+		if err := registerer.Register(collector); err != nil {
+			if _, isAlreadyRegistered := err.(prometheus.AlreadyRegisteredError); !isAlreadyRegistered {
+				panic(err)
+			}
+		}
+	}
+}
+
+func EntryTapped() {
+	tappedEntriesCounter.Inc()
+}
+
+func EntryFilteredOut() {
+	filteredOutEntriesCounter.Inc()
+}
+
+func EntryRateLimited() {
+	rateLimitedEntriesCounter.Inc()
+}
+
+func SocketSendFailed() {
+	socketSendFailuresCounter.Inc()
+}
+
+func SocketReconnectionAttempted() {
+	socketReconnectionsCounter.Inc()
+}
+
+func TappedPodsChanged() {
+	tappedPodsChangesCounter.Inc()
+}
+
+// statsCollector reads the metrics kept by the other providers when they're gathered. It's unchecked since the
+// resolver and the sync metrics are only collected once they're started.
+type statsCollector struct{}
+
+func (collector statsCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (collector statsCollector) Collect(metrics chan<- prometheus.Metric) {
+	stats := GetGeneralStats()
+
+	tappersCountLock.Lock()
+	tappersCount := TappersCount
+	tappersCountLock.Unlock()
+
+	metrics <- prometheus.MustNewConstMetric(entriesDesc, prometheus.CounterValue, float64(stats.EntriesCount))
+	metrics <- prometheus.MustNewConstMetric(firstEntryTimestampDesc, prometheus.GaugeValue, float64(stats.FirstEntryTimestamp))
+	metrics <- prometheus.MustNewConstMetric(lastEntryTimestampDesc, prometheus.GaugeValue, float64(stats.LastEntryTimestamp))
+	metrics <- prometheus.MustNewConstMetric(tappersDesc, prometheus.GaugeValue, float64(tappersCount))
+	metrics <- prometheus.MustNewConstMetric(tappedPodsDesc, prometheus.GaugeValue, float64(len(GetTapStatus().Pods)))
+	if k8sResolver := holder.GetResolver(); k8sResolver != nil {
+		hits, misses := k8sResolver.GetCacheStats()
+		metrics <- prometheus.MustNewConstMetric(resolverCacheHitsDesc, prometheus.CounterValue, float64(hits))
+		metrics <- prometheus.MustNewConstMetric(resolverCacheMissesDesc, prometheus.CounterValue, float64(misses))
+	}
+	if breakerState, isSyncing := up9.GetSyncBreakerState(); isSyncing {
+		metrics <- prometheus.MustNewConstMetric(syncBreakerStateDesc, prometheus.GaugeValue, float64(breakerState))
+	}
+}
@@ -0,0 +1,34 @@
+package providers_test
+
+import (
+	"mizuserver/pkg/providers"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func getMetricNames(t *testing.T, gatherer prometheus.Gatherer) map[string]bool {
+	metricFamilies, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed gathering metrics: %v", err)
+	}
+	names := make(map[string]bool, len(metricFamilies))
+	for _, metricFamily := range metricFamilies {
+		names[metricFamily.GetName()] = true
+	}
+	return names
+}
+
+func TestRegisterTapperMetrics(t *testing.T) {
+	if names := getMetricNames(t, providers.MetricsRegistry); names["mizu_socket_send_failures_total"] || !names["mizu_tapped_entries_total"] || !names["mizu_tapped_pods"] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no socket metrics", names)
+	}
+
+	registry := prometheus.NewRegistry()
+	providers.RegisterTapperMetrics(registry)
+	providers.RegisterTapperMetrics(registry)
+	providers.SocketSendFailed()
+	if names := getMetricNames(t, registry); !names["mizu_socket_send_failures_total"] || !names["mizu_socket_reconnections_total"] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "socket metrics", names)
+	}
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"mizuserver/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DatabaseSubsystem   = "database"
+	SocketPipeSubsystem = "socketPipe"
+)
+
+var (
+	subsystems     = map[string]*models.SubsystemStatus{}
+	subsystemsLock = sync.Mutex{}
+)
+
+// SetSubsystemReady registers the subsystem with its readiness, the process is ready once all the registered
+// subsystems are. A subsystem is registered as not ready before it starts so the process isn't ready meanwhile.
+func SetSubsystemReady(name string, ready bool) {
+	subsystemsLock.Lock()
+	defer subsystemsLock.Unlock()
+
+	if status, ok := subsystems[name]; ok && status.Ready == ready {
+		return
+	}
+	subsystems[name] = &models.SubsystemStatus{Name: name, Ready: ready, Since: time.Now().UnixNano() / int64(time.Millisecond)}
+}
+
+// GetReadiness returns whether all the registered subsystems are ready and their statuses ordered by name
+func GetReadiness() *models.Readiness {
+	subsystemsLock.Lock()
+	defer subsystemsLock.Unlock()
+
+	readiness := &models.Readiness{Ready: true, Subsystems: make([]models.SubsystemStatus, 0, len(subsystems))}
+	for _, status := range subsystems {
+		readiness.Ready = readiness.Ready && status.Ready
+		readiness.Subsystems = append(readiness.Subsystems, *status)
+	}
+	sort.Slice(readiness.Subsystems, func(i, j int) bool { return readiness.Subsystems[i].Name < readiness.Subsystems[j].Name })
+	return readiness
+}
+
+// ResetSubsystems forgets all the registered subsystems
+func ResetSubsystems() {
+	subsystemsLock.Lock()
+	defer subsystemsLock.Unlock()
+	subsystems = map[string]*models.SubsystemStatus{}
+}
@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	SequenceDiagramMermaid  = "mermaid"
+	SequenceDiagramPlantUML = "plantuml"
+)
+
+type sequenceDiagramMessage struct {
+	from     string
+	to       string
+	text     string
+	isReturn bool
+}
+
+// BuildSequenceDiagram writes the interactions of the entries in the order they're given as a sequence diagram of the
+// format, participants are the workloads named like in the service map and every entry is a call with its method and
+// path followed by a return with its status. Entries without a status, like one way messages, have no return.
+func BuildSequenceDiagram(entries []tapApi.MizuEntry, format string) (string, error) {
+	var participants []string
+	participantIds := map[string]string{}
+	getParticipantId := func(resolvedName string, ip string) string {
+		name := resolvedName
+		if name == "" {
+			name = ip
+		}
+		if name == "" {
+			name = "unknown"
+		}
+		id, ok := participantIds[name]
+		if !ok {
+			id = fmt.Sprintf("P%d", len(participants)+1)
+			participantIds[name] = id
+			participants = append(participants, name)
+		}
+		return id
+	}
+
+	messages := make([]sequenceDiagramMessage, 0, 2*len(entries))
+	for _, entry := range entries {
+		source := getParticipantId(entry.ResolvedSource, entry.SourceIp)
+		destination := getParticipantId(entry.ResolvedDestination, entry.DestinationIp)
+		messages = append(messages, sequenceDiagramMessage{from: source, to: destination, text: strings.TrimSpace(fmt.Sprintf("%s %s", entry.Method, entry.Path))})
+		if entry.Status != 0 {
+			messages = append(messages, sequenceDiagramMessage{from: destination, to: source, text: fmt.Sprint(entry.Status), isReturn: true})
+		}
+	}
+
+	var diagram strings.Builder
+	switch format {
+	case SequenceDiagramMermaid:
+		diagram.WriteString("sequenceDiagram\n")
+		for i, name := range participants {
+			fmt.Fprintf(&diagram, "    participant P%d as %s\n", i+1, escapeMermaidText(name))
+		}
+		for _, message := range messages {
+			arrow := "->>"
+			if message.isReturn {
+				arrow = "-->>"
+			}
+			fmt.Fprintf(&diagram, "    %s%s%s: %s\n", message.from, arrow, message.to, escapeMermaidText(message.text))
+		}
+	case SequenceDiagramPlantUML:
+		diagram.WriteString("@startuml\n")
+		for i, name := range participants {
+			fmt.Fprintf(&diagram, "participant \"%s\" as P%d\n", escapePlantUMLText(name), i+1)
+		}
+		for _, message := range messages {
+			arrow := "->"
+			if message.isReturn {
+				arrow = "-->"
+			}
+			fmt.Fprintf(&diagram, "%s %s %s : %s\n", message.from, arrow, message.to, escapePlantUMLText(message.text))
+		}
+		diagram.WriteString("@enduml\n")
+	default:
+		return "", fmt.Errorf("unknown sequence diagram format %s, expected %s or %s", format, SequenceDiagramMermaid, SequenceDiagramPlantUML)
+	}
+	return diagram.String(), nil
+}
+
+// escapeMermaidText keeps a value on its line, mermaid ends a statement at a semicolon and reads entity codes after a #
+func escapeMermaidText(text string) string {
+	return strings.NewReplacer("#", "#35;", ";", "#59;", "\n", " ", "\r", " ").Replace(text)
+}
+
+func escapePlantUMLText(text string) string {
+	return strings.NewReplacer("\"", "'", "\n", " ", "\r", " ").Replace(text)
+}
@@ -0,0 +1,58 @@
+package providers_test
+
+import (
+	"mizuserver/pkg/providers"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+var sequenceDiagramTestEntries = []tapApi.MizuEntry{
+	{ResolvedSource: "frontend.default", ResolvedDestination: "orders.default", Method: "POST", Path: "/orders", Status: 201},
+	{ResolvedSource: "orders.default", DestinationIp: "10.0.0.9", Method: "GET", Path: "/stock;v=2", Status: 503},
+	{ResolvedSource: "orders.default", ResolvedDestination: "events.default", Method: "publish", Path: "orders"},
+}
+
+func TestBuildSequenceDiagramMermaid(t *testing.T) {
+	diagram, err := providers.BuildSequenceDiagram(sequenceDiagramTestEntries, providers.SequenceDiagramMermaid)
+	if err != nil {
+		t.Fatalf("failed building diagram: %v", err)
+	}
+
+	expected := `sequenceDiagram
+    participant P1 as frontend.default
+    participant P2 as orders.default
+    participant P3 as 10.0.0.9
+    participant P4 as events.default
+    P1->>P2: POST /orders
+    P2-->>P1: 201
+    P2->>P3: GET /stock#59;v=2
+    P3-->>P2: 503
+    P2->>P4: publish orders
+`
+	if diagram != expected {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, diagram)
+	}
+}
+
+func TestBuildSequenceDiagramPlantUML(t *testing.T) {
+	diagram, err := providers.BuildSequenceDiagram(sequenceDiagramTestEntries[:1], providers.SequenceDiagramPlantUML)
+	if err != nil {
+		t.Fatalf("failed building diagram: %v", err)
+	}
+
+	expected := `@startuml
+participant "frontend.default" as P1
+participant "orders.default" as P2
+P1 -> P2 : POST /orders
+P2 --> P1 : 201
+@enduml
+`
+	if diagram != expected {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, diagram)
+	}
+
+	if _, err := providers.BuildSequenceDiagram(sequenceDiagramTestEntries, "graphviz"); err == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "error", err)
+	}
+}
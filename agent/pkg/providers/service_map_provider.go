@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"mizuserver/pkg/models"
+	"sort"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type serviceMapEdgeKey struct {
+	source      string
+	destination string
+}
+
+// BuildServiceMap aggregates entries into a directed graph of workloads, unresolved workloads are named by their ip
+func BuildServiceMap(entries []tapApi.MizuEntry, excludeUnresolved bool) *models.ServiceMap {
+	nodes := map[string]*models.ServiceMapNode{}
+	edges := map[serviceMapEdgeKey]*models.ServiceMapEdge{}
+	totalLatencies := map[serviceMapEdgeKey]int64{}
+
+	for _, entry := range entries {
+		source := getServiceMapNode(nodes, entry.ResolvedSource, entry.SourceIp)
+		destination := getServiceMapNode(nodes, entry.ResolvedDestination, entry.DestinationIp)
+		if source == nil || destination == nil {
+			continue
+		}
+		if excludeUnresolved && (!source.Resolved || !destination.Resolved) {
+			continue
+		}
+
+		key := serviceMapEdgeKey{source: source.Name, destination: destination.Name}
+		edge, ok := edges[key]
+		if !ok {
+			edge = &models.ServiceMapEdge{Source: source.Name, Destination: destination.Name}
+			edges[key] = edge
+		}
+
+		edge.CallCount++
+		if entry.Status >= 400 {
+			edge.ErrorCount++
+		}
+		if entry.ElapsedTime > edge.MaxLatencyMs {
+			edge.MaxLatencyMs = entry.ElapsedTime
+		}
+		totalLatencies[key] += entry.ElapsedTime
+	}
+
+	serviceMap := &models.ServiceMap{Nodes: make([]*models.ServiceMapNode, 0), Edges: make([]*models.ServiceMapEdge, 0)}
+	usedNodes := map[string]bool{}
+	for key, edge := range edges {
+		edge.ErrorRate = float64(edge.ErrorCount) / float64(edge.CallCount)
+		edge.AvgLatencyMs = float64(totalLatencies[key]) / float64(edge.CallCount)
+		serviceMap.Edges = append(serviceMap.Edges, edge)
+		usedNodes[edge.Source] = true
+		usedNodes[edge.Destination] = true
+	}
+	for name, node := range nodes {
+		if usedNodes[name] {
+			serviceMap.Nodes = append(serviceMap.Nodes, node)
+		}
+	}
+
+	sort.Slice(serviceMap.Nodes, func(i, j int) bool { return serviceMap.Nodes[i].Name < serviceMap.Nodes[j].Name })
+	sort.Slice(serviceMap.Edges, func(i, j int) bool {
+		if serviceMap.Edges[i].Source != serviceMap.Edges[j].Source {
+			return serviceMap.Edges[i].Source < serviceMap.Edges[j].Source
+		}
+		return serviceMap.Edges[i].Destination < serviceMap.Edges[j].Destination
+	})
+
+	return serviceMap
+}
+
+func getServiceMapNode(nodes map[string]*models.ServiceMapNode, resolvedName string, ip string) *models.ServiceMapNode {
+	name, resolved := resolvedName, true
+	if name == "" {
+		name, resolved = ip, false
+	}
+	if name == "" {
+		return nil
+	}
+
+	node, ok := nodes[name]
+	if !ok {
+		node = &models.ServiceMapNode{Name: name, Resolved: resolved}
+		nodes[name] = node
+	}
+	return node
+}
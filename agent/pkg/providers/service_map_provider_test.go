@@ -0,0 +1,69 @@
+package providers_test
+
+import (
+	"mizuserver/pkg/models"
+	"mizuserver/pkg/providers"
+	"reflect"
+	"testing"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+var serviceMapTestEntries = []tapApi.MizuEntry{
+	{ResolvedSource: "frontend", ResolvedDestination: "orders", Status: 200, ElapsedTime: 10},
+	{ResolvedSource: "frontend", ResolvedDestination: "orders", Status: 500, ElapsedTime: 30},
+	{ResolvedSource: "frontend", ResolvedDestination: "orders", Status: 201, ElapsedTime: 20},
+	{ResolvedSource: "orders", ResolvedDestination: "payments", Status: 404, ElapsedTime: 5},
+	{SourceIp: "10.0.0.7", ResolvedDestination: "frontend", Status: 200, ElapsedTime: 50},
+}
+
+func TestBuildServiceMap(t *testing.T) {
+	tests := []struct {
+		name              string
+		excludeUnresolved bool
+		expectedNodes     []*models.ServiceMapNode
+		expectedEdges     []*models.ServiceMapEdge
+	}{
+		{
+			name:              "all nodes",
+			excludeUnresolved: false,
+			expectedNodes: []*models.ServiceMapNode{
+				{Name: "10.0.0.7", Resolved: false},
+				{Name: "frontend", Resolved: true},
+				{Name: "orders", Resolved: true},
+				{Name: "payments", Resolved: true},
+			},
+			expectedEdges: []*models.ServiceMapEdge{
+				{Source: "10.0.0.7", Destination: "frontend", CallCount: 1, ErrorCount: 0, ErrorRate: 0, AvgLatencyMs: 50, MaxLatencyMs: 50},
+				{Source: "frontend", Destination: "orders", CallCount: 3, ErrorCount: 1, ErrorRate: 1.0 / 3, AvgLatencyMs: 20, MaxLatencyMs: 30},
+				{Source: "orders", Destination: "payments", CallCount: 1, ErrorCount: 1, ErrorRate: 1, AvgLatencyMs: 5, MaxLatencyMs: 5},
+			},
+		},
+		{
+			name:              "exclude unresolved",
+			excludeUnresolved: true,
+			expectedNodes: []*models.ServiceMapNode{
+				{Name: "frontend", Resolved: true},
+				{Name: "orders", Resolved: true},
+				{Name: "payments", Resolved: true},
+			},
+			expectedEdges: []*models.ServiceMapEdge{
+				{Source: "frontend", Destination: "orders", CallCount: 3, ErrorCount: 1, ErrorRate: 1.0 / 3, AvgLatencyMs: 20, MaxLatencyMs: 30},
+				{Source: "orders", Destination: "payments", CallCount: 1, ErrorCount: 1, ErrorRate: 1, AvgLatencyMs: 5, MaxLatencyMs: 5},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serviceMap := providers.BuildServiceMap(serviceMapTestEntries, test.excludeUnresolved)
+
+			if !reflect.DeepEqual(serviceMap.Nodes, test.expectedNodes) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedNodes, serviceMap.Nodes)
+			}
+			if !reflect.DeepEqual(serviceMap.Edges, test.expectedEdges) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedEdges, serviceMap.Edges)
+			}
+		})
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/patrickmn/go-cache"
 	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
 	"github.com/up9inc/mizu/tap"
+	"mizuserver/pkg/config"
+	"mizuserver/pkg/database"
 	"mizuserver/pkg/models"
 	"os"
 	"sync"
@@ -13,14 +16,18 @@ import (
 )
 
 const tlsLinkRetainmentTime = time.Minute * 15
+const defaultTapStatusStaleAfter = 5 * time.Minute
 
 var (
 	TappersCount   int
-	TapStatus      shared.TapStatus
 	authStatus     *models.AuthStatus
 	RecentTLSLinks = cache.New(tlsLinkRetainmentTime, tlsLinkRetainmentTime)
 
 	tappersCountLock = sync.Mutex{}
+
+	tapStatus           shared.TapStatus
+	isTapStatusRestored bool // the status is the one persisted before the restart, no update was received since
+	tapStatusLock       = sync.Mutex{}
 )
 
 func GetAuthStatus() (*models.AuthStatus, error) {
@@ -80,3 +87,50 @@ func TapperRemoved() {
 	TappersCount--
 	tappersCountLock.Unlock()
 }
+
+// GetTapStatus returns the tap status, it's stale when it was restored after a restart and is older than
+// tapStatusStaleAfterMs
+func GetTapStatus() shared.TapStatus {
+	tapStatusLock.Lock()
+	defer tapStatusLock.Unlock()
+	status := tapStatus
+	updatedAt := time.Unix(0, status.UpdatedAt*int64(time.Millisecond))
+	status.IsStale = isTapStatusRestored && time.Since(updatedAt) > getTapStatusStaleAfter()
+	return status
+}
+
+// SetTappedPods updates the tapped pods of the tap status and persists it, so the status is restored after a restart
+func SetTappedPods(pods []shared.PodInfo) {
+	tapStatusLock.Lock()
+	defer tapStatusLock.Unlock()
+	tapStatus.Pods = pods
+	tapStatus.UpdatedAt = time.Now().UnixNano() / int64(time.Millisecond)
+	isTapStatusRestored = false
+	if err := database.SaveTapStatus(&tapStatus); err != nil {
+		logger.Log.Errorf("Failed persisting the tap status: %v", err)
+	}
+}
+
+// RestoreTapStatus loads the tap status persisted before the restart, it's kept until the next update
+func RestoreTapStatus() {
+	restoredStatus, err := database.LoadTapStatus()
+	if err != nil {
+		logger.Log.Errorf("Failed restoring the tap status: %v", err)
+		return
+	} else if restoredStatus == nil {
+		return
+	}
+
+	tapStatusLock.Lock()
+	defer tapStatusLock.Unlock()
+	restoredStatus.IsStale = false
+	tapStatus, isTapStatusRestored = *restoredStatus, true
+	logger.Log.Infof("Restored the tap status of %d pods", len(tapStatus.Pods))
+}
+
+func getTapStatusStaleAfter() time.Duration {
+	if config.Config == nil || config.Config.TapStatusStaleAfterMs <= 0 {
+		return defaultTapStatusStaleAfter
+	}
+	return time.Duration(config.Config.TapStatusStaleAfterMs) * time.Millisecond
+}
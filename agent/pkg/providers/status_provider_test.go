@@ -0,0 +1,48 @@
+package providers_test
+
+import (
+	"mizuserver/pkg/database"
+	"mizuserver/pkg/providers"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+func TestTapStatusPersisted(t *testing.T) {
+	pods := []shared.PodInfo{{Namespace: "shop", Name: "carts-0"}}
+	providers.SetTappedPods(pods)
+
+	tapStatus := providers.GetTapStatus()
+	if !reflect.DeepEqual(tapStatus.Pods, pods) || tapStatus.IsStale || time.Since(time.Unix(0, tapStatus.UpdatedAt*int64(time.Millisecond))) > time.Minute {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the fresh pods", tapStatus)
+	}
+	if persistedStatus, err := database.LoadTapStatus(); err != nil || persistedStatus == nil || !reflect.DeepEqual(persistedStatus.Pods, pods) {
+		t.Errorf("unexpected result - expected: %v, actual: %+v %v", pods, persistedStatus, err)
+	}
+
+	providers.RestoreTapStatus()
+	if restoredStatus := providers.GetTapStatus(); !reflect.DeepEqual(restoredStatus, tapStatus) {
+		t.Errorf("unexpected result - expected: %+v, actual: %+v", tapStatus, restoredStatus)
+	}
+}
+
+func TestRestoredTapStatusStale(t *testing.T) {
+	pods := []shared.PodInfo{{Namespace: "payments", Name: "ledger-0"}}
+	staleUpdatedAt := time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond)
+	if err := database.SaveTapStatus(&shared.TapStatus{Pods: pods, UpdatedAt: staleUpdatedAt}); err != nil {
+		t.Fatalf("failed saving the tap status: %v", err)
+	}
+
+	providers.RestoreTapStatus()
+	if tapStatus := providers.GetTapStatus(); !reflect.DeepEqual(tapStatus.Pods, pods) || !tapStatus.IsStale || tapStatus.UpdatedAt != staleUpdatedAt {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the stale pods of payments", tapStatus)
+	}
+
+	// an update replaces the restored status
+	providers.SetTappedPods(pods)
+	if tapStatus := providers.GetTapStatus(); tapStatus.IsStale || tapStatus.UpdatedAt == staleUpdatedAt {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "the fresh pods of payments", tapStatus)
+	}
+}
@@ -0,0 +1,133 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+const (
+	defaultDnsTimeout       = time.Second
+	defaultDnsCacheSize     = 10000
+	defaultDnsCacheTtl      = 5 * time.Minute
+	maxConcurrentDnsLookups = 16
+)
+
+// LookupAddrFunc returns the names of an ip like net.Resolver.LookupAddr
+type LookupAddrFunc func(ctx context.Context, ip string) ([]string, error)
+
+// DnsResolver resolves ips to their reverse dns names. Resolve never waits on dns, it starts the lookup of an ip
+// missing from the cache and the ip is resolved by the calls after the lookup is done.
+type DnsResolver struct {
+	lookupAddr LookupAddrFunc
+	timeout    time.Duration
+	cacheSize  int
+	cacheTtl   time.Duration
+	lookups    chan struct{} // bounds the lookups running at once
+	mutex      sync.Mutex
+	names      map[string]*list.Element // of dnsName by ip
+	namesOrder *list.List               // the least recently cached name first, evicted first once the cache is full
+	pending    map[string]bool          // the ips being looked up
+}
+
+type dnsName struct {
+	ip         string
+	name       string // empty when the lookup failed
+	resolvedAt time.Time
+}
+
+// NewDnsResolver returns nil when reverse dns isn't configured, a nil lookupAddr looks up the ips with the default
+// net.Resolver
+func NewDnsResolver(reverseDnsConfig *shared.ReverseDnsConfig, lookupAddr LookupAddrFunc) *DnsResolver {
+	if reverseDnsConfig == nil {
+		return nil
+	}
+	if lookupAddr == nil {
+		lookupAddr = net.DefaultResolver.LookupAddr
+	}
+
+	resolver := &DnsResolver{
+		lookupAddr: lookupAddr,
+		timeout:    defaultDnsTimeout,
+		cacheSize:  defaultDnsCacheSize,
+		cacheTtl:   defaultDnsCacheTtl,
+		lookups:    make(chan struct{}, maxConcurrentDnsLookups),
+		names:      map[string]*list.Element{},
+		namesOrder: list.New(),
+		pending:    map[string]bool{},
+	}
+	if reverseDnsConfig.TimeoutMs > 0 {
+		resolver.timeout = time.Duration(reverseDnsConfig.TimeoutMs) * time.Millisecond
+	}
+	if reverseDnsConfig.CacheSize > 0 {
+		resolver.cacheSize = reverseDnsConfig.CacheSize
+	}
+	if reverseDnsConfig.CacheTtlMs > 0 {
+		resolver.cacheTtl = time.Duration(reverseDnsConfig.CacheTtlMs) * time.Millisecond
+	}
+	return resolver
+}
+
+// Resolve returns the cached name of the ip, an empty string when the ip has no name or isn't looked up yet
+func (resolver *DnsResolver) Resolve(ip string) string {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	if element, isFound := resolver.names[ip]; isFound {
+		if resolved := element.Value.(*dnsName); time.Since(resolved.resolvedAt) <= resolver.cacheTtl {
+			return resolved.name
+		}
+	}
+	if !resolver.pending[ip] {
+		select {
+		case resolver.lookups <- struct{}{}:
+			resolver.pending[ip] = true
+			go resolver.lookup(ip)
+		default:
+			// every lookup is taken, the ip is looked up by a later call
+		}
+	}
+	return ""
+}
+
+func (resolver *DnsResolver) lookup(ip string) {
+	defer func() { <-resolver.lookups }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolver.timeout)
+	defer cancel()
+	name := ""
+	if names, err := resolver.lookupAddr(ctx, ip); err != nil {
+		logger.Log.Debugf("Cannot reverse resolve %s: %v", ip, err)
+	} else if len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	delete(resolver.pending, ip)
+	resolver.cacheName(&dnsName{ip: ip, name: name, resolvedAt: time.Now()})
+}
+
+func (resolver *DnsResolver) cacheName(resolved *dnsName) {
+	if element, isFound := resolver.names[resolved.ip]; isFound {
+		resolver.namesOrder.Remove(element)
+	} else if resolver.namesOrder.Len() >= resolver.cacheSize {
+		oldest := resolver.namesOrder.Front()
+		resolver.namesOrder.Remove(oldest)
+		delete(resolver.names, oldest.Value.(*dnsName).ip)
+	}
+	resolver.names[resolved.ip] = resolver.namesOrder.PushBack(resolved)
+}
+
+// CacheSize returns the number of ips cached, the ips without a name included
+func (resolver *DnsResolver) CacheSize() int {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	return resolver.namesOrder.Len()
+}
@@ -0,0 +1,122 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mizuserver/pkg/resolver"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+var testDnsNames = map[string]string{"52.1.2.3": "db.example.com.", "52.1.2.4": "api.example.com."}
+
+func lookupTestDnsName(ctx context.Context, ip string) ([]string, error) {
+	if name, ok := testDnsNames[ip]; ok {
+		return []string{name}, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+// waitForDnsName resolves the ip until it's looked up, the first calls only start the lookup
+func waitForDnsName(t *testing.T, dnsResolver *resolver.DnsResolver, ip string, expectedName string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resolved := dnsResolver.Resolve(ip)
+		if resolved == expectedName {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", expectedName, resolved)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDnsResolverResolvesInBackground(t *testing.T) {
+	dnsResolver := resolver.NewDnsResolver(&shared.ReverseDnsConfig{}, lookupTestDnsName)
+
+	if resolved := dnsResolver.Resolve("52.1.2.3"); resolved != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", resolved)
+	}
+	waitForDnsName(t, dnsResolver, "52.1.2.3", "db.example.com")
+}
+
+func TestDnsResolverFailuresDegradeToUnresolved(t *testing.T) {
+	lookups := make(chan string, 10)
+	dnsResolver := resolver.NewDnsResolver(&shared.ReverseDnsConfig{}, func(ctx context.Context, ip string) ([]string, error) {
+		lookups <- ip
+		return lookupTestDnsName(ctx, ip)
+	})
+
+	dnsResolver.Resolve("10.0.0.1")
+	<-lookups
+	for dnsResolver.CacheSize() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// the failed lookup is cached, the ip isn't looked up again
+	dnsResolver.Resolve("10.0.0.1")
+	select {
+	case ip := <-lookups:
+		t.Errorf("unexpected result - expected: %v, actual: %v", "no lookup", ip)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDnsResolverTimeout(t *testing.T) {
+	dnsResolver := resolver.NewDnsResolver(&shared.ReverseDnsConfig{TimeoutMs: 20}, func(ctx context.Context, ip string) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	startTime := time.Now()
+	if resolved := dnsResolver.Resolve("52.1.2.3"); resolved != "" || time.Since(startTime) > 10*time.Millisecond {
+		t.Errorf("unexpected result - expected: %v, actual: %v after %v", "an immediate miss", resolved, time.Since(startTime))
+	}
+	for dnsResolver.CacheSize() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if resolved := dnsResolver.Resolve("52.1.2.3"); resolved != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", resolved)
+	}
+}
+
+func TestDnsResolverCacheBounded(t *testing.T) {
+	dnsResolver := resolver.NewDnsResolver(&shared.ReverseDnsConfig{CacheSize: 2}, func(ctx context.Context, ip string) ([]string, error) {
+		return []string{fmt.Sprintf("host-%s.example.com.", ip)}, nil
+	})
+
+	for _, ip := range []string{"52.0.0.1", "52.0.0.2", "52.0.0.3"} {
+		waitForDnsName(t, dnsResolver, ip, fmt.Sprintf("host-%s.example.com", ip))
+	}
+	if size := dnsResolver.CacheSize(); size != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, size)
+	}
+	// the oldest ip was evicted, it's looked up again
+	if resolved := dnsResolver.Resolve("52.0.0.1"); resolved != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", resolved)
+	}
+	if resolved := dnsResolver.Resolve("52.0.0.3"); resolved != "host-52.0.0.3.example.com" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "host-52.0.0.3.example.com", resolved)
+	}
+}
+
+func TestDnsResolverCacheTtl(t *testing.T) {
+	dnsResolver := resolver.NewDnsResolver(&shared.ReverseDnsConfig{CacheTtlMs: 50}, lookupTestDnsName)
+
+	waitForDnsName(t, dnsResolver, "52.1.2.4", "api.example.com")
+	time.Sleep(100 * time.Millisecond)
+	if resolved := dnsResolver.Resolve("52.1.2.4"); resolved != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", resolved)
+	}
+	waitForDnsName(t, dnsResolver, "52.1.2.4", "api.example.com")
+}
+
+func TestNewDnsResolverNotConfigured(t *testing.T) {
+	if dnsResolver := resolver.NewDnsResolver(nil, lookupTestDnsName); dnsResolver != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, dnsResolver)
+	}
+}
@@ -10,7 +10,7 @@ import (
 	restclient "k8s.io/client-go/rest"
 )
 
-func NewFromInCluster(errOut chan error, namesapce string) (*Resolver, error) {
+func NewFromInCluster(errOut chan error, namespaces []string) (*Resolver, error) {
 	config, err := restclient.InClusterConfig()
 	if err != nil {
 		return nil, err
@@ -19,5 +19,23 @@ func NewFromInCluster(errOut chan error, namesapce string) (*Resolver, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Resolver{clientConfig: config, clientSet: clientset, nameMap: cmap.New(), serviceMap: cmap.New(), errOut: errOut, namespace: namesapce}, nil
+	return &Resolver{clientConfig: config, clientSet: clientset, nameMap: cmap.New(), serviceMap: cmap.New(), podLabelsMap: cmap.New(), errOut: errOut, namespaces: normalizeNamespaces(namespaces)}, nil
+}
+
+func NewFromClientSet(clientSet kubernetes.Interface, errOut chan error, namespaces ...string) *Resolver {
+	return &Resolver{clientSet: clientSet, nameMap: cmap.New(), serviceMap: cmap.New(), podLabelsMap: cmap.New(), errOut: errOut, namespaces: normalizeNamespaces(namespaces)}
+}
+
+// normalizeNamespaces drops the empty and the repeated namespaces, no namespace left means every namespace
+func normalizeNamespaces(namespaces []string) []string {
+	normalized := make([]string, 0, len(namespaces))
+	seen := map[string]bool{}
+	for _, namespace := range namespaces {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		normalized = append(normalized, namespace)
+	}
+	return normalized
 }
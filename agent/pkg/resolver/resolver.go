@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/up9inc/mizu/shared/logger"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -18,38 +21,141 @@ import (
 
 const (
 	kubClientNullString = "None"
+	MaxPodLabels        = 10
 )
 
 type Resolver struct {
 	clientConfig *restclient.Config
-	clientSet    *kubernetes.Clientset
-	nameMap      cmap.ConcurrentMap
+	clientSet    kubernetes.Interface
+	nameMap      cmap.ConcurrentMap // resolvedName by address
 	serviceMap   cmap.ConcurrentMap
+	podLabelKeys []string
+	podLabelsMap cmap.ConcurrentMap
 	isStarted    bool
 	errOut       chan error
-	namespace    string
+	namespaces   []string // the watched namespaces, every namespace when empty
+	cacheTtl     time.Duration
+	cacheHits    uint64
+	cacheMisses  uint64
+	isRefresh    bool // a refresh logs the number of its names instead of every name
+}
+
+type resolvedName struct {
+	name       string
+	resolvedAt time.Time
+}
+
+// CacheEntry is a resolved name of the cache, an expired entry isn't resolved until it's refreshed
+type CacheEntry struct {
+	Address    string    `json:"address"`
+	Name       string    `json:"name"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+	Expired    bool      `json:"expired"`
+}
+
+type CacheInfo struct {
+	Namespaces []string     `json:"namespaces"` // empty when every namespace is resolved
+	TtlMs      int64        `json:"ttlMs"`      // 0 when the entries don't expire
+	Hits       uint64       `json:"hits"`
+	Misses     uint64       `json:"misses"`
+	Entries    []CacheEntry `json:"entries"`
 }
 
 func (resolver *Resolver) Start(ctx context.Context) {
 	if !resolver.isStarted {
 		resolver.isStarted = true
 
-		go resolver.infiniteErrorHandleRetryFunc(ctx, resolver.watchServices)
-		go resolver.infiniteErrorHandleRetryFunc(ctx, resolver.watchEndpoints)
-		go resolver.infiniteErrorHandleRetryFunc(ctx, resolver.watchPods)
+		for _, namespace := range resolver.watchedNamespaces() {
+			namespace := namespace
+			go resolver.infiniteErrorHandleRetryFunc(ctx, func(ctx context.Context) error { return resolver.watchServices(ctx, namespace) })
+			go resolver.infiniteErrorHandleRetryFunc(ctx, func(ctx context.Context) error { return resolver.watchEndpoints(ctx, namespace) })
+			go resolver.infiniteErrorHandleRetryFunc(ctx, func(ctx context.Context) error { return resolver.watchPods(ctx, namespace) })
+		}
+		if resolver.cacheTtl > 0 {
+			go resolver.refreshPeriodically(ctx)
+		}
 	}
 }
 
+// SetCacheTtl sets how long a resolved name is trusted, the names are refreshed twice per ttl so the names of live
+// objects don't expire. A ttl of 0 keeps the names until a watch reports their removal. It has to be called before
+// Start.
+func (resolver *Resolver) SetCacheTtl(ttl time.Duration) {
+	resolver.cacheTtl = ttl
+}
+
 func (resolver *Resolver) Resolve(name string) string {
-	resolvedName, isFound := resolver.nameMap.Get(name)
-	if !isFound {
+	value, isFound := resolver.nameMap.Get(name)
+	if !isFound || resolver.isExpired(value.(resolvedName)) {
+		atomic.AddUint64(&resolver.cacheMisses, 1)
 		return ""
 	}
-	return resolvedName.(string)
+	atomic.AddUint64(&resolver.cacheHits, 1)
+	return value.(resolvedName).name
 }
 
-func (resolver *Resolver) GetMap() cmap.ConcurrentMap {
-	return resolver.nameMap
+func (resolver *Resolver) isExpired(resolved resolvedName) bool {
+	return resolver.cacheTtl > 0 && time.Since(resolved.resolvedAt) > resolver.cacheTtl
+}
+
+// GetCacheStats returns the number of lookups that resolved a name and of those that didn't
+func (resolver *Resolver) GetCacheStats() (hits uint64, misses uint64) {
+	return atomic.LoadUint64(&resolver.cacheHits), atomic.LoadUint64(&resolver.cacheMisses)
+}
+
+// GetCacheInfo returns the resolved names by address
+func (resolver *Resolver) GetCacheInfo() *CacheInfo {
+	hits, misses := resolver.GetCacheStats()
+	info := &CacheInfo{Namespaces: resolver.namespaces, TtlMs: resolver.cacheTtl.Milliseconds(), Hits: hits, Misses: misses, Entries: []CacheEntry{}}
+	for address, value := range resolver.nameMap.Items() {
+		resolved := value.(resolvedName)
+		info.Entries = append(info.Entries, CacheEntry{Address: address, Name: resolved.name, ResolvedAt: resolved.resolvedAt, Expired: resolver.isExpired(resolved)})
+	}
+	sort.Slice(info.Entries, func(i, j int) bool { return info.Entries[i].Address < info.Entries[j].Address })
+	return info
+}
+
+func (resolver *Resolver) refreshPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(resolver.cacheTtl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := resolver.Refresh(ctx); err != nil {
+				resolver.errOut <- fmt.Errorf("failed refreshing the resolved names: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SetPodLabelKeys sets the keys of the pod labels to keep by pod ip, only the first MaxPodLabels keys are kept so
+// entries don't carry every label of a pod. It has to be called before Start.
+func (resolver *Resolver) SetPodLabelKeys(keys []string) {
+	if len(keys) > MaxPodLabels {
+		logger.Log.Warningf("Only the first %d of the %d configured pod labels are attached to entries", MaxPodLabels, len(keys))
+		keys = keys[:MaxPodLabels]
+	}
+	resolver.podLabelKeys = keys
+}
+
+// ResolveLabels returns the configured labels of the pod with the ip, nil when it has none of them
+func (resolver *Resolver) ResolveLabels(ip string) map[string]string {
+	labels, isFound := resolver.podLabelsMap.Get(ip)
+	if !isFound {
+		return nil
+	}
+	return labels.(map[string]string)
+}
+
+// GetMap returns the resolved names by address, the expired names included
+func (resolver *Resolver) GetMap() map[string]string {
+	names := map[string]string{}
+	for address, value := range resolver.nameMap.Items() {
+		names[address] = value.(resolvedName).name
+	}
+	return names
 }
 
 func (resolver *Resolver) CheckIsServiceIP(address string) bool {
@@ -57,9 +163,9 @@ func (resolver *Resolver) CheckIsServiceIP(address string) bool {
 	return isFound
 }
 
-func (resolver *Resolver) watchPods(ctx context.Context) error {
+func (resolver *Resolver) watchPods(ctx context.Context, namespace string) error {
 	// empty namespace makes the client watch all namespaces
-	watcher, err := resolver.clientSet.CoreV1().Pods(resolver.namespace).Watch(ctx, metav1.ListOptions{Watch: true})
+	watcher, err := resolver.clientSet.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{Watch: true})
 	if err != nil {
 		return err
 	}
@@ -69,10 +175,11 @@ func (resolver *Resolver) watchPods(ctx context.Context) error {
 			if event.Object == nil {
 				return errors.New("error in kubectl pod watch")
 			}
+			pod := event.Object.(*corev1.Pod)
 			if event.Type == watch.Deleted {
-				pod := event.Object.(*corev1.Pod)
 				resolver.saveResolvedName(pod.Status.PodIP, "", event.Type)
 			}
+			resolver.savePodLabels(pod, event.Type)
 		case <-ctx.Done():
 			watcher.Stop()
 			return nil
@@ -80,9 +187,9 @@ func (resolver *Resolver) watchPods(ctx context.Context) error {
 	}
 }
 
-func (resolver *Resolver) watchEndpoints(ctx context.Context) error {
+func (resolver *Resolver) watchEndpoints(ctx context.Context, namespace string) error {
 	// empty namespace makes the client watch all namespaces
-	watcher, err := resolver.clientSet.CoreV1().Endpoints(resolver.namespace).Watch(ctx, metav1.ListOptions{Watch: true})
+	watcher, err := resolver.clientSet.CoreV1().Endpoints(namespace).Watch(ctx, metav1.ListOptions{Watch: true})
 	if err != nil {
 		return err
 	}
@@ -92,30 +199,7 @@ func (resolver *Resolver) watchEndpoints(ctx context.Context) error {
 			if event.Object == nil {
 				return errors.New("error in kubectl endpoint watch")
 			}
-			endpoint := event.Object.(*corev1.Endpoints)
-			serviceHostname := fmt.Sprintf("%s.%s", endpoint.Name, endpoint.Namespace)
-			if endpoint.Subsets != nil {
-				for _, subset := range endpoint.Subsets {
-					var ports []int32
-					if subset.Ports != nil {
-						for _, portMapping := range subset.Ports {
-							if portMapping.Port > 0 {
-								ports = append(ports, portMapping.Port)
-							}
-						}
-					}
-					if subset.Addresses != nil {
-						for _, address := range subset.Addresses {
-							resolver.saveResolvedName(address.IP, serviceHostname, event.Type)
-							for _, port := range ports {
-								ipWithPort := fmt.Sprintf("%s:%d", address.IP, port)
-								resolver.saveResolvedName(ipWithPort, serviceHostname, event.Type)
-							}
-						}
-					}
-
-				}
-			}
+			resolver.saveEndpoint(event.Object.(*corev1.Endpoints), event.Type)
 		case <-ctx.Done():
 			watcher.Stop()
 			return nil
@@ -123,9 +207,9 @@ func (resolver *Resolver) watchEndpoints(ctx context.Context) error {
 	}
 }
 
-func (resolver *Resolver) watchServices(ctx context.Context) error {
+func (resolver *Resolver) watchServices(ctx context.Context, namespace string) error {
 	// empty namespace makes the client watch all namespaces
-	watcher, err := resolver.clientSet.CoreV1().Services(resolver.namespace).Watch(ctx, metav1.ListOptions{Watch: true})
+	watcher, err := resolver.clientSet.CoreV1().Services(namespace).Watch(ctx, metav1.ListOptions{Watch: true})
 	if err != nil {
 		return err
 	}
@@ -135,28 +219,113 @@ func (resolver *Resolver) watchServices(ctx context.Context) error {
 			if event.Object == nil {
 				return errors.New("error in kubectl service watch")
 			}
+			resolver.saveService(event.Object.(*corev1.Service), event.Type)
+		case <-ctx.Done():
+			watcher.Stop()
+			return nil
+		}
+	}
+}
+
+// Refresh rebuilds the resolved names from a fresh listing of the services and endpoints, entries of objects removed
+// while a watch was down are dropped. It returns the number of resolved names.
+func (resolver *Resolver) Refresh(ctx context.Context) (int, error) {
+	rebuilt := &Resolver{nameMap: cmap.New(), serviceMap: cmap.New(), podLabelKeys: resolver.podLabelKeys, podLabelsMap: cmap.New(), isRefresh: true}
+	for _, namespace := range resolver.watchedNamespaces() {
+		services, err := resolver.clientSet.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return 0, err
+		}
+		endpoints, err := resolver.clientSet.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return 0, err
+		}
+
+		for i := range services.Items {
+			rebuilt.saveService(&services.Items[i], watch.Added)
+		}
+		for i := range endpoints.Items {
+			rebuilt.saveEndpoint(&endpoints.Items[i], watch.Added)
+		}
+		if len(resolver.podLabelKeys) > 0 {
+			pods, err := resolver.clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return 0, err
+			}
+			for i := range pods.Items {
+				rebuilt.savePodLabels(&pods.Items[i], watch.Added)
+			}
+		}
+	}
+
+	replaceMap(resolver.nameMap, rebuilt.nameMap)
+	replaceMap(resolver.serviceMap, rebuilt.serviceMap)
+	replaceMap(resolver.podLabelsMap, rebuilt.podLabelsMap)
+	logger.Log.Infof("Resolver refreshed, %d names resolved", resolver.nameMap.Count())
+	return resolver.nameMap.Count(), nil
+}
+
+// watchedNamespaces returns the namespaces to watch, the empty namespace making the client watch every namespace when
+// no namespace was given
+func (resolver *Resolver) watchedNamespaces() []string {
+	if len(resolver.namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return resolver.namespaces
+}
+
+// replaceMap updates the map in place so concurrent lookups never see it empty
+func replaceMap(target cmap.ConcurrentMap, source cmap.ConcurrentMap) {
+	for _, key := range target.Keys() {
+		if !source.Has(key) {
+			target.Remove(key)
+		}
+	}
+	target.MSet(source.Items())
+}
 
-			service := event.Object.(*corev1.Service)
-			serviceHostname := fmt.Sprintf("%s.%s", service.Name, service.Namespace)
-			if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != kubClientNullString {
-				resolver.saveResolvedName(service.Spec.ClusterIP, serviceHostname, event.Type)
-				if service.Spec.Ports != nil {
-					for _, port := range service.Spec.Ports {
-						if port.Port > 0 {
-							resolver.saveResolvedName(fmt.Sprintf("%s:%d", service.Spec.ClusterIP, port.Port), serviceHostname, event.Type)
-						}
+func (resolver *Resolver) saveEndpoint(endpoint *corev1.Endpoints, eventType watch.EventType) {
+	serviceHostname := fmt.Sprintf("%s.%s", endpoint.Name, endpoint.Namespace)
+	if endpoint.Subsets != nil {
+		for _, subset := range endpoint.Subsets {
+			var ports []int32
+			if subset.Ports != nil {
+				for _, portMapping := range subset.Ports {
+					if portMapping.Port > 0 {
+						ports = append(ports, portMapping.Port)
 					}
 				}
-				resolver.saveServiceIP(service.Spec.ClusterIP, serviceHostname, event.Type)
 			}
-			if service.Status.LoadBalancer.Ingress != nil {
-				for _, ingress := range service.Status.LoadBalancer.Ingress {
-					resolver.saveResolvedName(ingress.IP, serviceHostname, event.Type)
+			if subset.Addresses != nil {
+				for _, address := range subset.Addresses {
+					resolver.saveResolvedName(address.IP, serviceHostname, eventType)
+					for _, port := range ports {
+						ipWithPort := fmt.Sprintf("%s:%d", address.IP, port)
+						resolver.saveResolvedName(ipWithPort, serviceHostname, eventType)
+					}
+				}
+			}
+
+		}
+	}
+}
+
+func (resolver *Resolver) saveService(service *corev1.Service, eventType watch.EventType) {
+	serviceHostname := fmt.Sprintf("%s.%s", service.Name, service.Namespace)
+	if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != kubClientNullString {
+		resolver.saveResolvedName(service.Spec.ClusterIP, serviceHostname, eventType)
+		if service.Spec.Ports != nil {
+			for _, port := range service.Spec.Ports {
+				if port.Port > 0 {
+					resolver.saveResolvedName(fmt.Sprintf("%s:%d", service.Spec.ClusterIP, port.Port), serviceHostname, eventType)
 				}
 			}
-		case <-ctx.Done():
-			watcher.Stop()
-			return nil
+		}
+		resolver.saveServiceIP(service.Spec.ClusterIP, serviceHostname, eventType)
+	}
+	if service.Status.LoadBalancer.Ingress != nil {
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			resolver.saveResolvedName(ingress.IP, serviceHostname, eventType)
 		}
 	}
 }
@@ -166,8 +335,10 @@ func (resolver *Resolver) saveResolvedName(key string, resolved string, eventTyp
 		resolver.nameMap.Remove(key)
 		logger.Log.Infof("setting %s=nil\n", key)
 	} else {
-		resolver.nameMap.Set(key, resolved)
-		logger.Log.Infof("setting %s=%s\n", key, resolved)
+		resolver.nameMap.Set(key, resolvedName{name: resolved, resolvedAt: time.Now()})
+		if !resolver.isRefresh {
+			logger.Log.Infof("setting %s=%s\n", key, resolved)
+		}
 	}
 }
 
@@ -179,6 +350,24 @@ func (resolver *Resolver) saveServiceIP(key string, resolved string, eventType w
 	}
 }
 
+func (resolver *Resolver) savePodLabels(pod *corev1.Pod, eventType watch.EventType) {
+	if len(resolver.podLabelKeys) == 0 || pod.Status.PodIP == "" {
+		return
+	}
+
+	labels := map[string]string{}
+	for _, key := range resolver.podLabelKeys {
+		if value, ok := pod.Labels[key]; ok {
+			labels[key] = value
+		}
+	}
+	if eventType == watch.Deleted || len(labels) == 0 {
+		resolver.podLabelsMap.Remove(pod.Status.PodIP)
+	} else {
+		resolver.podLabelsMap.Set(pod.Status.PodIP, labels)
+	}
+}
+
 func (resolver *Resolver) infiniteErrorHandleRetryFunc(ctx context.Context, fun func(ctx context.Context) error) {
 	for {
 		err := fun(ctx)
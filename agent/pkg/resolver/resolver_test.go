@@ -0,0 +1,272 @@
+package resolver_test
+
+import (
+	"context"
+	"fmt"
+	"mizuserver/pkg/resolver"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newEndpoints(name string, namespace string, podIPs ...string) *corev1.Endpoints {
+	addresses := make([]corev1.EndpointAddress, 0, len(podIPs))
+	for _, podIP := range podIPs {
+		addresses = append(addresses, corev1.EndpointAddress{IP: podIP})
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Subsets:    []corev1.EndpointSubset{{Addresses: addresses, Ports: []corev1.EndpointPort{{Port: 8080}}}},
+	}
+}
+
+func TestRefreshPicksUpNewPod(t *testing.T) {
+	ctx := context.Background()
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "carts", Namespace: "shop"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []corev1.ServicePort{{Port: 80}}},
+	}
+	clientSet := fake.NewSimpleClientset(service, newEndpoints("carts", "shop", "10.244.0.5"))
+	k8sResolver := resolver.NewFromClientSet(clientSet, make(chan error), "")
+
+	count, err := k8sResolver.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+	if count != 4 || k8sResolver.Resolve("10.244.0.6") != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", 4, count, k8sResolver.Resolve("10.244.0.6"))
+	}
+
+	// a new pod joined the service while no watch reported it
+	if _, err := clientSet.CoreV1().Endpoints("shop").Update(ctx, newEndpoints("carts", "shop", "10.244.0.5", "10.244.0.6"), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed updating endpoints: %v", err)
+	}
+	count, err = k8sResolver.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	expected := map[string]string{
+		"10.244.0.6":      "carts.shop",
+		"10.244.0.6:8080": "carts.shop",
+		"10.96.0.10:80":   "carts.shop",
+	}
+	if count != 6 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 6, count)
+	}
+	for address, expectedName := range expected {
+		if actual := k8sResolver.Resolve(address); actual != expectedName {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expectedName, actual)
+		}
+	}
+	if !k8sResolver.CheckIsServiceIP("10.96.0.10") {
+		t.Errorf("expected 10.96.0.10 to be a service ip")
+	}
+}
+
+func TestRefreshDropsRemovedObjects(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewSimpleClientset(newEndpoints("carts", "shop", "10.244.0.5"))
+	k8sResolver := resolver.NewFromClientSet(clientSet, make(chan error), "")
+	if _, err := k8sResolver.Refresh(ctx); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	if err := clientSet.CoreV1().Endpoints("shop").Delete(ctx, "carts", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed deleting endpoints: %v", err)
+	}
+	count, err := k8sResolver.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+	if count != 0 || k8sResolver.Resolve("10.244.0.5") != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 0, count)
+	}
+}
+
+func TestRefreshPodLabels(t *testing.T) {
+	ctx := context.Background()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "carts-1", Namespace: "shop", Labels: map[string]string{"team": "payments", "env": "prod", "pod-template-hash": "5d8f"}},
+		Status:     corev1.PodStatus{PodIP: "10.244.0.5"},
+	}
+	unlabeledPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-1", Namespace: "shop", Labels: map[string]string{"app": "orders"}},
+		Status:     corev1.PodStatus{PodIP: "10.244.0.7"},
+	}
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(pod, unlabeledPod), make(chan error), "")
+	k8sResolver.SetPodLabelKeys([]string{"team", "env", "tier"})
+	if _, err := k8sResolver.Refresh(ctx); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	expected := map[string]string{"team": "payments", "env": "prod"}
+	if actual := k8sResolver.ResolveLabels("10.244.0.5"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, actual)
+	}
+	if actual := k8sResolver.ResolveLabels("10.244.0.7"); actual != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", nil, actual)
+	}
+}
+
+func TestSetPodLabelKeysBounded(t *testing.T) {
+	labels := map[string]string{}
+	keys := make([]string, 0)
+	for i := 0; i < resolver.MaxPodLabels+5; i++ {
+		key := fmt.Sprintf("label-%d", i)
+		labels[key] = "value"
+		keys = append(keys, key)
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "carts-1", Namespace: "shop", Labels: labels}, Status: corev1.PodStatus{PodIP: "10.244.0.5"}}
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(pod), make(chan error), "")
+	k8sResolver.SetPodLabelKeys(keys)
+	if _, err := k8sResolver.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	if actual := len(k8sResolver.ResolveLabels("10.244.0.5")); actual != resolver.MaxPodLabels {
+		t.Errorf("unexpected result - expected: %v, actual: %v", resolver.MaxPodLabels, actual)
+	}
+}
+
+func TestCacheTtl(t *testing.T) {
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(newEndpoints("carts", "shop", "10.244.0.5")), make(chan error), "shop")
+	k8sResolver.SetCacheTtl(50 * time.Millisecond)
+	if _, err := k8sResolver.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	if resolved := k8sResolver.Resolve("10.244.0.5"); resolved != "carts.shop" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "carts.shop", resolved)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if resolved := k8sResolver.Resolve("10.244.0.5"); resolved != "" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "", resolved)
+	}
+	k8sResolver.Resolve("10.244.0.6")
+
+	if hits, misses := k8sResolver.GetCacheStats(); hits != 1 || misses != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "1 hit 2 misses", fmt.Sprintf("%d hit %d misses", hits, misses))
+	}
+	info := k8sResolver.GetCacheInfo()
+	if !reflect.DeepEqual(info.Namespaces, []string{"shop"}) || info.TtlMs != 50 || len(info.Entries) != 2 {
+		t.Fatalf("unexpected result - expected: %v, actual: %+v", "2 entries of shop", info)
+	}
+	if entry := info.Entries[0]; entry.Address != "10.244.0.5" || entry.Name != "carts.shop" || !entry.Expired {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "expired 10.244.0.5", entry)
+	}
+}
+
+func TestCacheRefreshedBeforeExpiring(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(newEndpoints("carts", "shop", "10.244.0.5")), make(chan error, 10), "")
+	k8sResolver.SetCacheTtl(100 * time.Millisecond)
+	if _, err := k8sResolver.Refresh(ctx); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+	k8sResolver.Start(ctx)
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if resolved := k8sResolver.Resolve("10.244.0.5"); resolved != "carts.shop" {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", "carts.shop", resolved)
+		}
+	}
+}
+
+func TestCacheWithoutTtl(t *testing.T) {
+	k8sResolver := resolver.NewFromClientSet(fake.NewSimpleClientset(newEndpoints("carts", "shop", "10.244.0.5")), make(chan error), "")
+	if _, err := k8sResolver.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed refreshing: %v", err)
+	}
+
+	if entries := k8sResolver.GetCacheInfo().Entries; len(entries) != 2 || entries[0].Expired {
+		t.Errorf("unexpected result - expected: %v, actual: %+v", "2 unexpired entries", entries)
+	}
+}
+
+func newService(name string, namespace string, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP, Ports: []corev1.ServicePort{{Port: 80}}},
+	}
+}
+
+func newNamespacedClientSet() *fake.Clientset {
+	return fake.NewSimpleClientset(
+		newService("carts", "shop", "10.96.0.10"), newEndpoints("carts", "shop", "10.244.0.5"),
+		newService("ledger", "payments", "10.96.0.20"), newEndpoints("ledger", "payments", "10.244.1.5"),
+		newService("invoices", "billing", "10.96.0.30"), newEndpoints("invoices", "billing", "10.244.2.5"),
+	)
+}
+
+func TestRefreshNamespaces(t *testing.T) {
+	tests := []struct {
+		name               string
+		namespaces         []string
+		expectedResolved   []string
+		expectedUnresolved []string
+	}{
+		{name: "single namespace", namespaces: []string{"shop"}, expectedResolved: []string{"10.244.0.5"}, expectedUnresolved: []string{"10.244.1.5", "10.244.2.5"}},
+		{name: "multiple namespaces", namespaces: []string{"shop", "payments", "shop"}, expectedResolved: []string{"10.244.0.5", "10.244.1.5"}, expectedUnresolved: []string{"10.244.2.5"}},
+		{name: "no namespace", expectedResolved: []string{"10.244.0.5", "10.244.1.5", "10.244.2.5"}},
+		{name: "empty namespace", namespaces: []string{""}, expectedResolved: []string{"10.244.0.5", "10.244.1.5", "10.244.2.5"}},
+	}
+	serviceIPs := map[string]string{"10.244.0.5": "10.96.0.10", "10.244.1.5": "10.96.0.20", "10.244.2.5": "10.96.0.30"}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k8sResolver := resolver.NewFromClientSet(newNamespacedClientSet(), make(chan error), test.namespaces...)
+			count, err := k8sResolver.Refresh(context.Background())
+			if err != nil {
+				t.Fatalf("failed refreshing: %v", err)
+			}
+			// the pod ip, the pod ip with port, the service ip and the service ip with port of each service
+			if count != 4*len(test.expectedResolved) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", 4*len(test.expectedResolved), count)
+			}
+			for _, ip := range test.expectedResolved {
+				if k8sResolver.Resolve(ip) == "" || !k8sResolver.CheckIsServiceIP(serviceIPs[ip]) {
+					t.Errorf("unexpected result - expected: %v resolved, actual: %v %v", ip, k8sResolver.Resolve(ip), k8sResolver.CheckIsServiceIP(serviceIPs[ip]))
+				}
+			}
+			for _, ip := range test.expectedUnresolved {
+				if k8sResolver.Resolve(ip) != "" || k8sResolver.CheckIsServiceIP(serviceIPs[ip]) {
+					t.Errorf("unexpected result - expected: %v unresolved, actual: %v %v", ip, k8sResolver.Resolve(ip), k8sResolver.CheckIsServiceIP(serviceIPs[ip]))
+				}
+			}
+		})
+	}
+}
+
+func TestWatchNamespaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clientSet := fake.NewSimpleClientset()
+	k8sResolver := resolver.NewFromClientSet(clientSet, make(chan error, 10), "shop", "payments")
+	k8sResolver.Start(ctx)
+	if info := k8sResolver.GetCacheInfo(); !reflect.DeepEqual(info.Namespaces, []string{"shop", "payments"}) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", []string{"shop", "payments"}, info.Namespaces)
+	}
+
+	// the watches may start after the services are created, they're created until they're seen
+	deadline := time.Now().Add(5 * time.Second)
+	for !k8sResolver.CheckIsServiceIP("10.96.0.10") || !k8sResolver.CheckIsServiceIP("10.96.0.20") {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected result - expected: %v, actual: %v", "the services of shop and payments watched", k8sResolver.GetMap())
+		}
+		for _, service := range []*corev1.Service{newService("carts", "shop", "10.96.0.10"), newService("ledger", "payments", "10.96.0.20"), newService("invoices", "billing", "10.96.0.30")} {
+			clientSet.CoreV1().Services(service.Namespace).Delete(ctx, service.Name, metav1.DeleteOptions{})
+			clientSet.CoreV1().Services(service.Namespace).Create(ctx, service, metav1.CreateOptions{})
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if k8sResolver.CheckIsServiceIP("10.96.0.30") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "billing not watched", k8sResolver.GetMap())
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+	"mizuserver/pkg/middlewares"
+)
+
+// AdminRoutes defines the group of admin routes, all of them require the admin token.
+func AdminRoutes(ginApp *gin.Engine) {
+	routeGroup := ginApp.Group("/admin")
+	routeGroup.Use(middlewares.RequireAdminToken())
+
+	routeGroup.GET("/loglevel", controllers.GetLogLevel)
+	routeGroup.POST("/loglevel", controllers.SetLogLevel)
+
+	routeGroup.POST("/firstSeen/reset", controllers.ResetFirstSeenEndpoints)
+
+	routeGroup.POST("/resolver/refresh", controllers.RefreshResolver)
+	routeGroup.GET("/resolver/cache", controllers.GetResolverCache)
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+	"mizuserver/pkg/middlewares"
+)
+
+// CaptureRoutes defines the group of routes controlling the capture at runtime, changing it requires the admin token.
+func CaptureRoutes(ginApp *gin.Engine) {
+	routeGroup := ginApp.Group("/capture")
+
+	routeGroup.GET("/sample-rate", controllers.GetSampleRate)
+	routeGroup.POST("/sample-rate", middlewares.RequireAdminToken(), controllers.SetSampleRate)
+}
@@ -9,6 +9,8 @@ import (
 func EntriesRoutes(ginApp *gin.Engine) {
 	routeGroup := ginApp.Group("/entries")
 
-	routeGroup.GET("/", controllers.GetEntries)        // get entries (base/thin entries)
-	routeGroup.GET("/:entryId", controllers.GetEntry) // get single (full) entry
+	routeGroup.GET("/", controllers.GetEntries)                      // get entries (base/thin entries)
+	routeGroup.GET("/export", controllers.ExportEntries)             // stream every entry as ndjson, optionally since a timestamp
+	routeGroup.GET("/:entryId", controllers.GetEntry)                // get single (full) entry
+	routeGroup.GET("/:entryId/body/:part", controllers.GetEntryBody) // get the full request or response body of an entry
 }
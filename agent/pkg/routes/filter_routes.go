@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+)
+
+// FilterRoutes defines the group of filter expression routes.
+func FilterRoutes(ginApp *gin.Engine) {
+	routeGroup := ginApp.Group("/filter")
+
+	routeGroup.POST("/validate", controllers.ValidateFilter) // check the syntax of a filter expression without running it
+}
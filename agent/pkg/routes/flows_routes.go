@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+)
+
+// FlowsRoutes defines the group of raw flow routes.
+func FlowsRoutes(ginApp *gin.Engine) {
+	routeGroup := ginApp.Group("/flows")
+
+	routeGroup.GET("/:flow/export.pcap", controllers.ExportFlowPcap) // get the retained packets of a single flow as a pcap file, standalone and pcap-read modes only
+	routeGroup.GET("/:flow/timeline", controllers.GetFlowTimeline)   // get the entries of a single flow ordered by time
+}
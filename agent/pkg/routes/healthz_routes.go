@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+)
+
+// HealthzRoutes defines the route of the Kubernetes probes, /echo is kept for the existing clients.
+func HealthzRoutes(app *gin.Engine) {
+	app.GET("/healthz", controllers.GetHealthz) // get whether the subsystems of the process are ready
+}
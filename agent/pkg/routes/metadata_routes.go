@@ -7,6 +7,9 @@ import (
 
 // MetadataRoutes defines the group of metadata routes.
 func MetadataRoutes(app *gin.Engine) {
+	app.GET("/version", controllers.GetAgentVersion)
+	app.GET("/extensions", controllers.GetExtensions) // get the loaded extensions, their versions and .so paths, and the resolution of their conflicting ports
+
 	routeGroup := app.Group("/metadata")
 
 	routeGroup.GET("/version", controllers.GetVersion)
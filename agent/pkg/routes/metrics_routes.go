@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mizuserver/pkg/controllers"
+)
+
+// MetricsRoutes defines the metrics route scraped by Prometheus.
+func MetricsRoutes(app *gin.Engine) {
+	app.GET("/metrics", controllers.GetMetrics) // get the aggregated metrics in the Prometheus text format
+}
@@ -20,7 +20,27 @@ func StatusRoutes(ginApp *gin.Engine) {
 
 	routeGroup.GET("/general", controllers.GetGeneralStats) // get general stats about entries in DB
 
+	routeGroup.GET("/serviceMap", controllers.GetServiceMap) // get a call graph of the workloads seen in the captured entries
+
+	routeGroup.GET("/sequenceDiagram", controllers.GetSequenceDiagram) // get the interactions of a flow, a redirect chain or filtered entries as a mermaid or plantuml sequence diagram
+
+	routeGroup.POST("/apiCoverage", controllers.PostApiCoverage) // get which operations of an OpenAPI spec were observed in the captured entries
+
+	routeGroup.GET("/config", controllers.GetEffectiveConfig) // get the config after the env var and flag overrides, secrets redacted
+
+	routeGroup.GET("/memory", controllers.GetMemoryStatus) // get the memory guard load shedding state
+
+	routeGroup.GET("/captureSchedule", controllers.GetCaptureScheduleStatus) // get whether the capture is inside its schedule
+
+	routeGroup.GET("/namespaceSampling", controllers.GetNamespaceSamplingStats) // get the configured and observed sample rate per namespace
+
+	routeGroup.GET("/scheduledExports", controllers.GetScheduledExportsStatus) // get the last and next run of every scheduled export
+
+	routeGroup.GET("/harImport", controllers.GetHarImportProgress) // get the progress of reading the HAR files directory
+
 	routeGroup.GET("/recentTLSLinks", controllers.GetRecentTLSLinks)
 
+	routeGroup.GET("/recentTLSCertificates", controllers.GetRecentTLSCertificates) // get the certificate chain of recently seen TLS servers
+
 	routeGroup.GET("/resolving", controllers.GetCurrentResolvingInformation)
 }
@@ -0,0 +1,158 @@
+package sensitiveDataFiltering
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const basicAuthDetector = "basicAuth"
+
+// the key patterns detected by default besides basic auth, values the tapper redacted can't match them
+var defaultKeyPatterns = []shared.CredentialPatternConfig{
+	{Name: "awsAccessKey", Pattern: `\b(AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "privateKey", Pattern: `-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`},
+	{Name: "githubToken", Pattern: `\bgh[pousr]_[A-Za-z0-9]{36}\b`},
+	{Name: "slackToken", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+	{Name: "apiKey", Pattern: `(?i)["']?\b(api[_-]?key|api[_-]?secret|secret[_-]?key|access[_-]?token)["']?\s*[:=]\s*["']?[A-Za-z0-9_\-+/]{16,}`},
+}
+
+type keyPattern struct {
+	name   string
+	regexp *regexp.Regexp
+}
+
+// CredentialDetector flags entries carrying plaintext credentials, only the name of the detector that matched is kept
+type CredentialDetector struct {
+	basicAuth bool
+	patterns  []keyPattern
+}
+
+// NewCredentialDetector returns nil when credential detection isn't configured
+func NewCredentialDetector(detectionConfig *shared.CredentialDetectionConfig) (*CredentialDetector, error) {
+	if detectionConfig == nil {
+		return nil, nil
+	}
+
+	detector := &CredentialDetector{}
+	enabled := map[string]bool{}
+	for _, name := range detectionConfig.Detectors {
+		enabled[name] = true
+	}
+	isEnabled := func(name string) bool {
+		return len(detectionConfig.Detectors) == 0 || enabled[name]
+	}
+
+	if isEnabled(basicAuthDetector) {
+		detector.basicAuth = true
+		delete(enabled, basicAuthDetector)
+	}
+	for _, pattern := range defaultKeyPatterns {
+		if isEnabled(pattern.Name) {
+			detector.patterns = append(detector.patterns, keyPattern{name: pattern.Name, regexp: regexp.MustCompile(pattern.Pattern)})
+			delete(enabled, pattern.Name)
+		}
+	}
+	for name := range enabled {
+		return nil, fmt.Errorf("unknown credential detector %s", name)
+	}
+
+	for _, pattern := range detectionConfig.Patterns {
+		compiled, err := regexp.Compile(pattern.Pattern)
+		if err != nil || pattern.Name == "" {
+			return nil, fmt.Errorf("invalid credential pattern %q: %v", pattern.Name, err)
+		}
+		detector.patterns = append(detector.patterns, keyPattern{name: pattern.Name, regexp: compiled})
+	}
+	return detector, nil
+}
+
+// FlagEntry sets the credential leak of the entry, http entries are inspected through their har entry, the entries
+// of other protocols by their stored form
+func (detector *CredentialDetector) FlagEntry(mizuEntry *tapApi.MizuEntry, harEntry *har.Entry) {
+	var name string
+	if harEntry != nil {
+		name = detector.detectHarEntry(harEntry)
+	} else {
+		name = detector.detectValue(mizuEntry.Entry)
+	}
+	mizuEntry.CredentialLeak = name != ""
+	mizuEntry.CredentialDetector = name
+}
+
+func (detector *CredentialDetector) detectHarEntry(harEntry *har.Entry) string {
+	if detector.basicAuth {
+		for _, header := range harEntry.Request.Headers {
+			if strings.EqualFold(header.Name, "Authorization") && isBasicAuthCredentials(header.Value) {
+				return basicAuthDetector
+			}
+		}
+		if requestUrl, err := url.Parse(harEntry.Request.URL); err == nil && requestUrl.User != nil {
+			if _, hasPassword := requestUrl.User.Password(); hasPassword {
+				return basicAuthDetector
+			}
+		}
+	}
+
+	for _, value := range getHarEntryValues(harEntry) {
+		if name := detector.detectValue(value); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func (detector *CredentialDetector) detectValue(value string) string {
+	for _, pattern := range detector.patterns {
+		if pattern.regexp.MatchString(value) {
+			return pattern.name
+		}
+	}
+	return ""
+}
+
+// isBasicAuthCredentials checks the header holds a user and a password, not only the scheme
+func isBasicAuthCredentials(authorization string) bool {
+	fields := strings.Fields(authorization)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Basic") {
+		return false
+	}
+	credentials, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return false
+	}
+	separator := strings.IndexByte(string(credentials), ':')
+	return separator > 0 && separator < len(credentials)-1
+}
+
+// getHarEntryValues returns the url, the headers and the bodies of a har entry, the parts values are detected in
+func getHarEntryValues(harEntry *har.Entry) []string {
+	values := []string{harEntry.Request.URL}
+	for _, headers := range [][]har.Header{harEntry.Request.Headers, harEntry.Response.Headers} {
+		for _, header := range headers {
+			values = append(values, fmt.Sprintf("%s: %s", header.Name, header.Value))
+		}
+	}
+	if harEntry.Request.PostData != nil {
+		values = append(values, harEntry.Request.PostData.Text)
+	}
+	if content := harEntry.Response.Content; content != nil {
+		values = append(values, decodeContent(content))
+	}
+	return values
+}
+
+func decodeContent(content *har.Content) string {
+	if content.Encoding == "base64" {
+		if decoded, err := base64.StdEncoding.DecodeString(string(content.Text)); err == nil {
+			return string(decoded)
+		}
+	}
+	return string(content.Text)
+}
@@ -0,0 +1,120 @@
+package sensitiveDataFiltering
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	emailPiiType      = "email"
+	creditCardPiiType = "creditCard"
+	ssnPiiType        = "ssn"
+)
+
+type piiMatcher struct {
+	piiType string
+	regexp  *regexp.Regexp
+	isValid func(match string) bool // rejects the matches that only look like the type, nil accepts them all
+}
+
+var piiMatchers = []piiMatcher{
+	{piiType: emailPiiType, regexp: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{piiType: creditCardPiiType, regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), isValid: isCardNumber},
+	{piiType: ssnPiiType, regexp: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), isValid: isSsn},
+}
+
+// PiiDetector tags entries with the types of the PII they carry, the detected values aren't kept
+type PiiDetector struct {
+	matchers []piiMatcher
+}
+
+// NewPiiDetector returns nil when PII detection isn't configured
+func NewPiiDetector(detectionConfig *shared.PiiDetectionConfig) (*PiiDetector, error) {
+	if detectionConfig == nil {
+		return nil, nil
+	}
+
+	enabled := map[string]bool{}
+	for _, name := range detectionConfig.Detectors {
+		enabled[name] = true
+	}
+
+	detector := &PiiDetector{}
+	for _, matcher := range piiMatchers {
+		if len(detectionConfig.Detectors) == 0 || enabled[matcher.piiType] {
+			detector.matchers = append(detector.matchers, matcher)
+			delete(enabled, matcher.piiType)
+		}
+	}
+	for name := range enabled {
+		return nil, fmt.Errorf("unknown PII detector %s", name)
+	}
+	return detector, nil
+}
+
+// TagEntry sets the PII types of the entry, http entries are inspected through their har entry, the entries of other
+// protocols by their stored form
+func (detector *PiiDetector) TagEntry(mizuEntry *tapApi.MizuEntry, harEntry *har.Entry) {
+	values := []string{mizuEntry.Entry}
+	if harEntry != nil {
+		values = getHarEntryValues(harEntry)
+	}
+
+	var piiTypes []string
+	for _, matcher := range detector.matchers {
+		for _, value := range values {
+			if matcher.matches(value) {
+				piiTypes = append(piiTypes, matcher.piiType)
+				break
+			}
+		}
+	}
+	sort.Strings(piiTypes)
+	mizuEntry.PiiTypes = strings.Join(piiTypes, ",")
+}
+
+func (matcher *piiMatcher) matches(value string) bool {
+	if matcher.isValid == nil {
+		return matcher.regexp.MatchString(value)
+	}
+	for _, match := range matcher.regexp.FindAllString(value, -1) {
+		if matcher.isValid(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCardNumber checks the Luhn checksum of the digits, the separators between them are ignored
+func isCardNumber(match string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		digit := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// isSsn rejects the area, group and serial numbers that are never assigned
+func isSsn(match string) bool {
+	parts := strings.Split(match, "-")
+	area, group, serial := parts[0], parts[1], parts[2]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
@@ -0,0 +1,86 @@
+package sensitiveDataFiltering_test
+
+import (
+	"mizuserver/pkg/sensitiveDataFiltering"
+	"strings"
+	"testing"
+
+	"github.com/google/martian/har"
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func TestPiiDetectorTagEntry(t *testing.T) {
+	tests := []struct {
+		name             string
+		harEntry         *har.Entry
+		entry            string
+		expectedPiiTypes string
+	}{
+		{
+			name:             "EmailInRequestBody",
+			harEntry:         newHarEntry(nil, `{"email": "jane.doe@example.com"}`, ""),
+			expectedPiiTypes: "email",
+		},
+		{
+			name:             "ValidCardNumberInResponseBody",
+			harEntry:         newHarEntry(nil, "", `{"card": "4111 1111 1111 1111"}`),
+			expectedPiiTypes: "creditCard",
+		},
+		{
+			name:     "InvalidCardNumber",
+			harEntry: newHarEntry(nil, "", `{"card": "4111 1111 1111 1112"}`),
+		},
+		{
+			name:             "SeveralTypes",
+			harEntry:         newHarEntry([]har.Header{{Name: "X-User", Value: "jane@example.org"}}, `{"ssn": "123-45-6789", "card": "5500-0000-0000-0004"}`, ""),
+			expectedPiiTypes: "creditCard,email,ssn",
+		},
+		{
+			name:     "UnassignedSsn",
+			harEntry: newHarEntry(nil, `{"ssn": "000-45-6789"}`, ""),
+		},
+		{
+			name:             "NonHttpEntry",
+			entry:            `{"request": {"payload": {"details": {"value": "jane@example.com"}}}}`,
+			expectedPiiTypes: "email",
+		},
+		{
+			name:     "TimestampLikeNumber",
+			harEntry: newHarEntry(nil, `{"timestamp": 1600000000000}`, ""),
+		},
+	}
+
+	detector, err := sensitiveDataFiltering.NewPiiDetector(&shared.PiiDetectionConfig{})
+	if err != nil {
+		t.Fatalf("failed creating detector: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mizuEntry := &tapApi.MizuEntry{Entry: test.entry}
+			detector.TagEntry(mizuEntry, test.harEntry)
+			if mizuEntry.PiiTypes != test.expectedPiiTypes {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedPiiTypes, mizuEntry.PiiTypes)
+			}
+			if strings.Contains(mizuEntry.PiiTypes, "@") || strings.Contains(mizuEntry.PiiTypes, "4111") {
+				t.Errorf("the values must not be kept: %v", mizuEntry.PiiTypes)
+			}
+		})
+	}
+}
+
+func TestPiiDetectorConfiguredDetectors(t *testing.T) {
+	detector, err := sensitiveDataFiltering.NewPiiDetector(&shared.PiiDetectionConfig{Detectors: []string{"creditCard"}})
+	if err != nil {
+		t.Fatalf("failed creating detector: %v", err)
+	}
+	mizuEntry := &tapApi.MizuEntry{}
+	detector.TagEntry(mizuEntry, newHarEntry(nil, `{"email": "jane@example.com", "card": "4111111111111111"}`, ""))
+	if mizuEntry.PiiTypes != "creditCard" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "creditCard", mizuEntry.PiiTypes)
+	}
+
+	if _, err := sensitiveDataFiltering.NewPiiDetector(&shared.PiiDetectionConfig{Detectors: []string{"unknown"}}); err == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "error", err)
+	}
+}
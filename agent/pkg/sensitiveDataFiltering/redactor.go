@@ -0,0 +1,246 @@
+package sensitiveDataFiltering
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const anyBodyField = "*"
+
+// Redactor masks the values of the configured headers and json body fields of the http items. The tappers redact the
+// items as dissected and the api server redacts them once their payloads were decoded from json, both are handled.
+type Redactor struct {
+	headers    map[string]bool // lower case
+	bodyFields [][]string
+}
+
+// NewRedactor returns nil when no header and no body field is configured
+func NewRedactor(redactionConfig *shared.RedactionConfig) (*Redactor, error) {
+	if redactionConfig == nil || (len(redactionConfig.Headers) == 0 && len(redactionConfig.BodyFields) == 0) {
+		return nil, nil
+	}
+
+	redactor := &Redactor{headers: map[string]bool{}}
+	for _, header := range redactionConfig.Headers {
+		if strings.TrimSpace(header) == "" {
+			return nil, fmt.Errorf("invalid redacted header %q", header)
+		}
+		redactor.headers[strings.ToLower(strings.TrimSpace(header))] = true
+	}
+	for _, bodyField := range redactionConfig.BodyFields {
+		path := strings.Split(bodyField, ".")
+		for _, fieldName := range path {
+			if fieldName == "" {
+				return nil, fmt.Errorf("invalid redacted body field %q", bodyField)
+			}
+		}
+		redactor.bodyFields = append(redactor.bodyFields, path)
+	}
+	return redactor, nil
+}
+
+// Redact masks the item in place, the items of the protocols other than http are left untouched
+func (redactor *Redactor) Redact(item *tapApi.OutputChannelItem) {
+	if item.Pair == nil || item.Protocol.Name != "http" {
+		return
+	}
+	for _, message := range []*tapApi.GenericMessage{&item.Pair.Request, &item.Pair.Response} {
+		switch payload := message.Payload.(type) {
+		case tapApi.HTTPPayload:
+			switch data := payload.Data.(type) {
+			case *http.Request:
+				redactor.redactRequest(data)
+			case *http.Response:
+				redactor.redactHeader(data.Header)
+				data.Body, data.ContentLength = redactor.redactBodyReader(data.Body, data.ContentLength)
+				if data.Request != nil {
+					redactor.redactRequest(data.Request)
+				}
+			}
+		case map[string]interface{}:
+			redactor.redactDecodedPayload(payload)
+		}
+	}
+}
+
+func (redactor *Redactor) redactRequest(request *http.Request) {
+	redactor.redactHeader(request.Header)
+	request.Body, request.ContentLength = redactor.redactBodyReader(request.Body, request.ContentLength)
+}
+
+func (redactor *Redactor) redactHeader(header http.Header) {
+	for name, values := range header {
+		if redactor.headers[strings.ToLower(name)] {
+			for i := range values {
+				values[i] = maskedFieldPlaceholderValue
+			}
+		}
+	}
+}
+
+func (redactor *Redactor) redactBodyReader(body io.ReadCloser, contentLength int64) (io.ReadCloser, int64) {
+	if body == nil || len(redactor.bodyFields) == 0 {
+		return body, contentLength
+	}
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return ioutil.NopCloser(bytes.NewBuffer(content)), contentLength
+	}
+	if redacted, ok := redactor.redactBody(content); ok {
+		return ioutil.NopCloser(bytes.NewBuffer(redacted)), int64(len(redacted))
+	}
+	return ioutil.NopCloser(bytes.NewBuffer(content)), contentLength
+}
+
+// redactDecodedPayload masks the har details of the payload and its raw request or response
+func (redactor *Redactor) redactDecodedPayload(payload map[string]interface{}) {
+	if details, ok := payload["details"].(map[string]interface{}); ok {
+		redactor.redactHarHeaders(details["headers"])
+		// the har cookies are parsed from the cookie header of requests, and from the set-cookie headers of responses
+		_, isRequest := details["method"]
+		if (isRequest && redactor.headers["cookie"]) || (!isRequest && redactor.headers["set-cookie"]) {
+			redactHarCookies(details["cookies"])
+		}
+		if postData, ok := details["postData"].(map[string]interface{}); ok {
+			redactor.redactHarText(postData)
+		}
+		if content, ok := details["content"].(map[string]interface{}); ok {
+			redactor.redactHarText(content)
+		}
+	}
+	for _, key := range []string{"rawRequest", "rawResponse"} {
+		if raw, ok := payload[key].(map[string]interface{}); ok {
+			redactor.redactRawMessage(raw)
+			if rawRequest, ok := raw["Request"].(map[string]interface{}); ok {
+				redactor.redactRawMessage(rawRequest)
+			}
+		}
+	}
+}
+
+func (redactor *Redactor) redactHarHeaders(headers interface{}) {
+	headersList, _ := headers.([]interface{})
+	for _, header := range headersList {
+		if header, ok := header.(map[string]interface{}); ok {
+			if name, ok := header["name"].(string); ok && redactor.headers[strings.ToLower(name)] {
+				header["value"] = maskedFieldPlaceholderValue
+			}
+		}
+	}
+}
+
+func redactHarCookies(cookies interface{}) {
+	cookiesList, _ := cookies.([]interface{})
+	for _, cookie := range cookiesList {
+		if cookie, ok := cookie.(map[string]interface{}); ok {
+			cookie["value"] = maskedFieldPlaceholderValue
+		}
+	}
+}
+
+// redactHarText masks the text of a har post data or content, the text of a content may be base64 encoded
+func (redactor *Redactor) redactHarText(harBody map[string]interface{}) {
+	text, ok := harBody["text"].(string)
+	if !ok || len(redactor.bodyFields) == 0 {
+		return
+	}
+	isBase64 := harBody["encoding"] == "base64"
+	content := []byte(text)
+	if isBase64 {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return
+		}
+	}
+	redacted, ok := redactor.redactBody(content)
+	if !ok {
+		return
+	}
+	if isBase64 {
+		harBody["text"] = base64.StdEncoding.EncodeToString(redacted)
+	} else {
+		harBody["text"] = string(redacted)
+	}
+	if _, ok := harBody["size"]; ok {
+		harBody["size"] = len(redacted)
+	}
+}
+
+func (redactor *Redactor) redactRawMessage(raw map[string]interface{}) {
+	if header, ok := raw["Header"].(map[string]interface{}); ok {
+		for name, values := range header {
+			if valuesList, ok := values.([]interface{}); ok && redactor.headers[strings.ToLower(name)] {
+				for i := range valuesList {
+					valuesList[i] = maskedFieldPlaceholderValue
+				}
+			}
+		}
+	}
+	if body, ok := raw["Body"].(string); ok {
+		if redacted, ok := redactor.redactBody([]byte(body)); ok {
+			raw["Body"] = string(redacted)
+		}
+	}
+}
+
+// redactBody returns the body with the body fields masked, it returns false when the body isn't json or has none of them
+func (redactor *Redactor) redactBody(body []byte) ([]byte, bool) {
+	if len(redactor.bodyFields) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // so large numbers aren't rounded when the body is encoded again
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return nil, false
+	}
+
+	redacted := false
+	for _, path := range redactor.bodyFields {
+		redacted = redactJsonPath(value, path) || redacted
+	}
+	if !redacted {
+		return nil, false
+	}
+	redactedBody, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	return redactedBody, true
+}
+
+// redactJsonPath masks the fields at the path of value, the path continues into each element of the arrays on it
+func redactJsonPath(value interface{}, path []string) bool {
+	switch value := value.(type) {
+	case []interface{}:
+		redacted := false
+		for _, element := range value {
+			redacted = redactJsonPath(element, path) || redacted
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := false
+		for name, fieldValue := range value {
+			if path[0] != anyBodyField && name != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				value[name] = maskedFieldPlaceholderValue
+				redacted = true
+			} else {
+				redacted = redactJsonPath(fieldValue, path[1:]) || redacted
+			}
+		}
+		return redacted
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package sensitiveDataFiltering_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"mizuserver/pkg/sensitiveDataFiltering"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+func newTestRedactor(t *testing.T) *sensitiveDataFiltering.Redactor {
+	redactor, err := sensitiveDataFiltering.NewRedactor(&shared.RedactionConfig{
+		Headers:    []string{"Authorization", "cookie", "X-API-KEY"},
+		BodyFields: []string{"password", "user.address.street", "cards.number", "tokens.*"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+	return redactor
+}
+
+func newHttpItem(request *http.Request, response *http.Response) *tapApi.OutputChannelItem {
+	return &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair: &tapApi.RequestResponsePair{
+			Request:  tapApi.GenericMessage{IsRequest: true, Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpRequest, Data: request}},
+			Response: tapApi.GenericMessage{Payload: tapApi.HTTPPayload{Type: tapApi.TypeHttpResponse, Data: response}},
+		},
+	}
+}
+
+const nestedJsonBody = `{"password": "hunter2", "id": 12345678901234567890, "user": {"name": "jane", "address": {"street": "1 Main St", "city": "Springfield"}}, "cards": [{"number": "4111111111111111", "expiry": "12/30"}, {"number": "5500000000000004"}], "tokens": {"access": "a", "refresh": "r"}}`
+
+func assertRedactedJsonBody(t *testing.T, body string) {
+	var redacted struct {
+		Password string          `json:"password"`
+		Id       json.RawMessage `json:"id"`
+		User     struct {
+			Name    string            `json:"name"`
+			Address map[string]string `json:"address"`
+		} `json:"user"`
+		Cards  []map[string]string `json:"cards"`
+		Tokens map[string]string   `json:"tokens"`
+	}
+	if err := json.Unmarshal([]byte(body), &redacted); err != nil {
+		t.Fatalf("invalid redacted body %s: %v", body, err)
+	}
+
+	if redacted.Password != "[REDACTED]" || redacted.User.Address["street"] != "[REDACTED]" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the password and the street redacted", body)
+	}
+	if redacted.User.Name != "jane" || redacted.User.Address["city"] != "Springfield" || string(redacted.Id) != "12345678901234567890" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the other fields kept", body)
+	}
+	if len(redacted.Cards) != 2 || redacted.Cards[0]["number"] != "[REDACTED]" || redacted.Cards[1]["number"] != "[REDACTED]" || redacted.Cards[0]["expiry"] != "12/30" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the numbers of all the cards redacted", redacted.Cards)
+	}
+	if redacted.Tokens["access"] != "[REDACTED]" || redacted.Tokens["refresh"] != "[REDACTED]" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "all the tokens redacted", redacted.Tokens)
+	}
+}
+
+func TestRedactorRedactsDissectedItems(t *testing.T) {
+	redactor := newTestRedactor(t)
+	request := httptest.NewRequest(http.MethodPost, "http://orders/orders", strings.NewReader(nestedJsonBody))
+	request.Header.Set("authorization", "Bearer secret")
+	request.Header["X-Api-Key"] = []string{"key-1", "key-2"}
+	request.Header.Set("Content-Type", "application/json")
+	response := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Set-Cookie": []string{"session=1"}},
+		Body:          ioutil.NopCloser(strings.NewReader("not json")),
+		ContentLength: 8,
+	}
+	item := newHttpItem(request, response)
+
+	redactor.Redact(item)
+
+	if request.Header.Get("Authorization") != "[REDACTED]" || strings.Join(request.Header["X-Api-Key"], ",") != "[REDACTED],[REDACTED]" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the headers redacted in any case", request.Header)
+	}
+	if request.Header.Get("Content-Type") != "application/json" || response.Header.Get("Set-Cookie") != "session=1" {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "the other headers kept", request.Header, response.Header)
+	}
+	body, _ := ioutil.ReadAll(request.Body)
+	assertRedactedJsonBody(t, string(body))
+	if request.ContentLength != int64(len(body)) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", len(body), request.ContentLength)
+	}
+	if body, _ := ioutil.ReadAll(response.Body); string(body) != "not json" || response.ContentLength != 8 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "not json", string(body))
+	}
+
+	// the serialized item sent to the api server carries the redacted values only
+	serialized, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	for _, secret := range []string{"Bearer secret", "key-1", "hunter2", "4111111111111111", "1 Main St"} {
+		if strings.Contains(string(serialized), secret) {
+			t.Errorf("unexpected result - expected: %s redacted, actual: %s", secret, serialized)
+		}
+	}
+}
+
+func TestRedactorRedactsDecodedItems(t *testing.T) {
+	redactor := newTestRedactor(t)
+	requestPayload := map[string]interface{}{
+		"details": map[string]interface{}{
+			"method":   "POST",
+			"headers":  []interface{}{map[string]interface{}{"name": "AUTHORIZATION", "value": "Bearer secret"}, map[string]interface{}{"name": "Host", "value": "orders"}},
+			"cookies":  []interface{}{map[string]interface{}{"name": "session", "value": "cookie-secret"}},
+			"postData": map[string]interface{}{"mimeType": "application/json", "text": nestedJsonBody},
+		},
+		"rawRequest": map[string]interface{}{
+			"Header": map[string]interface{}{"Authorization": []interface{}{"Bearer secret"}},
+			"Body":   nestedJsonBody,
+		},
+	}
+	responseContent := map[string]interface{}{"mimeType": "application/json", "encoding": "base64", "size": 0, "text": base64.StdEncoding.EncodeToString([]byte(nestedJsonBody))}
+	responsePayload := map[string]interface{}{
+		"details": map[string]interface{}{
+			"status":  200,
+			"headers": []interface{}{},
+			"cookies": []interface{}{map[string]interface{}{"name": "theme", "value": "dark"}},
+			"content": responseContent,
+		},
+	}
+	item := &tapApi.OutputChannelItem{
+		Protocol: tapApi.Protocol{Name: "http"},
+		Pair:     &tapApi.RequestResponsePair{Request: tapApi.GenericMessage{Payload: requestPayload}, Response: tapApi.GenericMessage{Payload: responsePayload}},
+	}
+
+	redactor.Redact(item)
+
+	requestDetails := requestPayload["details"].(map[string]interface{})
+	headers := requestDetails["headers"].([]interface{})
+	if headers[0].(map[string]interface{})["value"] != "[REDACTED]" || headers[1].(map[string]interface{})["value"] != "orders" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the authorization header redacted", headers)
+	}
+	if cookie := requestDetails["cookies"].([]interface{})[0].(map[string]interface{}); cookie["value"] != "[REDACTED]" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "[REDACTED]", cookie["value"])
+	}
+	if cookie := responsePayload["details"].(map[string]interface{})["cookies"].([]interface{})[0].(map[string]interface{}); cookie["value"] != "dark" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "dark", cookie["value"])
+	}
+	assertRedactedJsonBody(t, requestDetails["postData"].(map[string]interface{})["text"].(string))
+
+	rawRequest := requestPayload["rawRequest"].(map[string]interface{})
+	if value := rawRequest["Header"].(map[string]interface{})["Authorization"].([]interface{})[0]; value != "[REDACTED]" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "[REDACTED]", value)
+	}
+	assertRedactedJsonBody(t, rawRequest["Body"].(string))
+
+	responseBody, err := base64.StdEncoding.DecodeString(responseContent["text"].(string))
+	if err != nil {
+		t.Fatalf("invalid base64 content: %v", err)
+	}
+	assertRedactedJsonBody(t, string(responseBody))
+	if responseContent["size"] != len(responseBody) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", len(responseBody), responseContent["size"])
+	}
+}
+
+func TestRedactorSkipsOtherProtocols(t *testing.T) {
+	redactor := newTestRedactor(t)
+	payload := map[string]interface{}{"details": map[string]interface{}{"headers": []interface{}{map[string]interface{}{"name": "Authorization", "value": "kept"}}}}
+	item := &tapApi.OutputChannelItem{Protocol: tapApi.Protocol{Name: "amqp"}, Pair: &tapApi.RequestResponsePair{Request: tapApi.GenericMessage{Payload: payload}}}
+
+	redactor.Redact(item)
+
+	if value := payload["details"].(map[string]interface{})["headers"].([]interface{})[0].(map[string]interface{})["value"]; value != "kept" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "kept", value)
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *shared.RedactionConfig
+		expectedNil   bool
+		expectedError bool
+	}{
+		{name: "nil config", expectedNil: true},
+		{name: "empty config", config: &shared.RedactionConfig{}, expectedNil: true},
+		{name: "headers only", config: &shared.RedactionConfig{Headers: []string{"Authorization"}}},
+		{name: "body fields only", config: &shared.RedactionConfig{BodyFields: []string{"user.password"}}},
+		{name: "empty header", config: &shared.RedactionConfig{Headers: []string{" "}}, expectedNil: true, expectedError: true},
+		{name: "empty path segment", config: &shared.RedactionConfig{BodyFields: []string{"user..password"}}, expectedNil: true, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redactor, err := sensitiveDataFiltering.NewRedactor(test.config)
+			if (err != nil) != test.expectedError || (redactor == nil) != test.expectedNil {
+				t.Errorf("unexpected result - redactor: %v, err: %v", redactor, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"mizuserver/pkg/filterExpression"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const exportTimeFormat = "20060102T150405.000Z"
+
+var ActiveExportScheduler *ExportScheduler
+
+// ExportQuery returns the entries matching the filter expression captured in [from, to)
+type ExportQuery func(filter string, from time.Time, to time.Time) ([]tapApi.MizuEntry, error)
+
+type ScheduledExportStatus struct {
+	Name           string     `json:"name"`
+	Filter         string     `json:"filter"`
+	IsRunning      bool       `json:"isRunning"`
+	LastRunAt      *time.Time `json:"lastRunAt"`
+	LastRunEntries int        `json:"lastRunEntries"`
+	LastRunError   string     `json:"lastRunError,omitempty"`
+	NextRunAt      time.Time  `json:"nextRunAt"`
+	SkippedRuns    int        `json:"skippedRuns"`
+}
+
+type exportJob struct {
+	name       string
+	filter     string
+	interval   time.Duration
+	sink       ExportSink
+	exportedTo time.Time // the end of the range of the last successful run
+	status     ScheduledExportStatus
+	lock       sync.Mutex
+}
+
+// ExportScheduler runs the configured exports on their intervals, a run is skipped while the previous run of the same
+// export is still going.
+type ExportScheduler struct {
+	jobs     []*exportJob
+	query    ExportQuery
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewExportScheduler returns nil when no exports are configured
+func NewExportScheduler(configs []shared.ScheduledExportConfig, query ExportQuery) (*ExportScheduler, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	scheduler := &ExportScheduler{query: query, stop: make(chan struct{})}
+	names := map[string]bool{}
+	for i := range configs {
+		config := &configs[i]
+		if config.Name == "" || names[config.Name] {
+			return nil, fmt.Errorf("export names must be set and unique, found %q", config.Name)
+		}
+		names[config.Name] = true
+		if config.IntervalMs <= 0 {
+			return nil, fmt.Errorf("export %s must have a positive interval", config.Name)
+		}
+		if config.Filter != "" {
+			if _, err := filterExpression.Parse(config.Filter); err != nil {
+				return nil, fmt.Errorf("export %s has an invalid filter: %v", config.Name, err)
+			}
+		}
+		sink, err := NewExportSink(config)
+		if err != nil {
+			return nil, err
+		}
+
+		scheduler.jobs = append(scheduler.jobs, &exportJob{
+			name:     config.Name,
+			filter:   config.Filter,
+			interval: time.Duration(config.IntervalMs) * time.Millisecond,
+			sink:     sink,
+			status:   ScheduledExportStatus{Name: config.Name, Filter: config.Filter},
+		})
+	}
+	return scheduler, nil
+}
+
+// Start schedules the first run of every export one interval from now, it covers the interval before it
+func (scheduler *ExportScheduler) Start() {
+	now := time.Now()
+	for _, job := range scheduler.jobs {
+		job.lock.Lock()
+		job.exportedTo = now.Add(-job.interval)
+		job.status.NextRunAt = now.Add(job.interval)
+		job.lock.Unlock()
+
+		scheduler.wg.Add(1)
+		go scheduler.schedule(job)
+	}
+}
+
+// Stop ends the scheduling and waits for the running exports
+func (scheduler *ExportScheduler) Stop() {
+	scheduler.stopOnce.Do(func() { close(scheduler.stop) })
+	scheduler.wg.Wait()
+}
+
+func (scheduler *ExportScheduler) GetStatus() []ScheduledExportStatus {
+	statuses := make([]ScheduledExportStatus, 0, len(scheduler.jobs))
+	for _, job := range scheduler.jobs {
+		job.lock.Lock()
+		statuses = append(statuses, job.status)
+		job.lock.Unlock()
+	}
+	return statuses
+}
+
+func (scheduler *ExportScheduler) schedule(job *exportJob) {
+	defer scheduler.wg.Done()
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			job.lock.Lock()
+			job.status.NextRunAt = now.Add(job.interval)
+			if job.status.IsRunning {
+				job.status.SkippedRuns++
+				job.lock.Unlock()
+				logger.Log.Warningf("Skipped export %s, its previous run is still running", job.name)
+				continue
+			}
+			job.status.IsRunning = true
+			job.lock.Unlock()
+
+			scheduler.wg.Add(1)
+			go func() {
+				defer scheduler.wg.Done()
+				scheduler.run(job, now)
+			}()
+		case <-scheduler.stop:
+			return
+		}
+	}
+}
+
+func (scheduler *ExportScheduler) run(job *exportJob, now time.Time) {
+	job.lock.Lock()
+	from := job.exportedTo
+	job.lock.Unlock()
+
+	entriesCount, err := scheduler.export(job, from, now)
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.status.IsRunning = false
+	job.status.LastRunAt = &now
+	job.status.LastRunEntries = entriesCount
+	job.status.LastRunError = ""
+	if err != nil {
+		// the next run exports the entries of this one as well
+		job.status.LastRunError = err.Error()
+		logger.Log.Errorf("Failed running export %s: %v", job.name, err)
+		return
+	}
+	job.exportedTo = now
+	logger.Log.Infof("Exported %d entries of %s", entriesCount, job.name)
+}
+
+// export writes the entries as newline delimited json, one export per run even when there are no entries
+func (scheduler *ExportScheduler) export(job *exportJob, from time.Time, to time.Time) (int, error) {
+	entries, err := scheduler.query(job.filter, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	for i := range entries {
+		entryBytes, err := json.Marshal(&entries[i])
+		if err != nil {
+			return 0, err
+		}
+		data = append(data, entryBytes...)
+		data = append(data, '\n')
+	}
+
+	name := fmt.Sprintf("%s-%s.jsonl", job.name, to.UTC().Format(exportTimeFormat))
+	if err := job.sink.Write(name, data); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
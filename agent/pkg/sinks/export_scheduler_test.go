@@ -0,0 +1,154 @@
+package sinks_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/sinks"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type exportQueryCall struct {
+	filter string
+	from   time.Time
+	to     time.Time
+}
+
+type fakeExportQuery struct {
+	calls   []exportQueryCall
+	release chan struct{}
+	lock    sync.Mutex
+}
+
+func (query *fakeExportQuery) query(filter string, from time.Time, to time.Time) ([]tapApi.MizuEntry, error) {
+	query.lock.Lock()
+	query.calls = append(query.calls, exportQueryCall{filter: filter, from: from, to: to})
+	query.lock.Unlock()
+	if query.release != nil {
+		<-query.release
+	}
+	return []tapApi.MizuEntry{{EntryId: "1", Method: "GET", Status: 500}, {EntryId: "2", Method: "POST", Status: 503}}, nil
+}
+
+func (query *fakeExportQuery) getCalls() []exportQueryCall {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+	return append([]exportQueryCall{}, query.calls...)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExportSchedulerRunsOnSchedule(t *testing.T) {
+	dir := t.TempDir()
+	query := &fakeExportQuery{}
+	scheduler, err := sinks.NewExportScheduler([]shared.ScheduledExportConfig{
+		{Name: "errors", Filter: "status >= 500", IntervalMs: 20, File: &shared.FileExportConfig{Directory: dir}},
+	}, query.query)
+	if err != nil {
+		t.Fatalf("failed creating scheduler: %v", err)
+	}
+	scheduler.Start()
+	waitFor(t, func() bool { return len(query.getCalls()) >= 2 })
+	scheduler.Stop()
+
+	calls := query.getCalls()
+	for i, call := range calls {
+		if call.filter != "status >= 500" || !call.to.After(call.from) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", "a non empty range", call)
+		}
+		// every run continues from where the previous one ended
+		if i > 0 && !call.from.Equal(calls[i-1].to) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", calls[i-1].to, call.from)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != len(calls) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(calls), len(files))
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	expectedName := "errors-" + calls[0].to.UTC().Format("20060102T150405.000Z") + ".jsonl"
+	if names[0] != expectedName {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedName, names[0])
+	}
+	content, _ := ioutil.ReadFile(path.Join(dir, names[0]))
+	if lines := string(content); len(content) == 0 || lines[len(lines)-1] != '\n' || countLines(lines) != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "2 json lines", lines)
+	}
+
+	status := scheduler.GetStatus()
+	if len(status) != 1 || status[0].LastRunAt == nil || status[0].LastRunEntries != 2 || status[0].LastRunError != "" || status[0].IsRunning {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a successful last run", status)
+	}
+	if !status[0].NextRunAt.After(*status[0].LastRunAt) {
+		t.Errorf("unexpected result - expected next run after: %v, actual: %v", status[0].LastRunAt, status[0].NextRunAt)
+	}
+}
+
+func countLines(text string) int {
+	count := 0
+	for _, char := range text {
+		if char == '\n' {
+			count++
+		}
+	}
+	return count
+}
+
+func TestExportSchedulerSkipsOverlappingRuns(t *testing.T) {
+	query := &fakeExportQuery{release: make(chan struct{})}
+	scheduler, err := sinks.NewExportScheduler([]shared.ScheduledExportConfig{
+		{Name: "slow", IntervalMs: 10, File: &shared.FileExportConfig{Directory: t.TempDir()}},
+	}, query.query)
+	if err != nil {
+		t.Fatalf("failed creating scheduler: %v", err)
+	}
+	scheduler.Start()
+	waitFor(t, func() bool { return scheduler.GetStatus()[0].SkippedRuns >= 2 })
+
+	if calls := query.getCalls(); len(calls) != 1 || !scheduler.GetStatus()[0].IsRunning {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a single running export", len(calls))
+	}
+	close(query.release)
+	scheduler.Stop()
+}
+
+func TestNewExportSchedulerInvalidConfig(t *testing.T) {
+	fileSink := &shared.FileExportConfig{Directory: t.TempDir()}
+	tests := []struct {
+		name    string
+		configs []shared.ScheduledExportConfig
+	}{
+		{name: "MissingName", configs: []shared.ScheduledExportConfig{{IntervalMs: 10, File: fileSink}}},
+		{name: "DuplicateName", configs: []shared.ScheduledExportConfig{{Name: "a", IntervalMs: 10, File: fileSink}, {Name: "a", IntervalMs: 10, File: fileSink}}},
+		{name: "MissingInterval", configs: []shared.ScheduledExportConfig{{Name: "a", File: fileSink}}},
+		{name: "InvalidFilter", configs: []shared.ScheduledExportConfig{{Name: "a", Filter: "status >", IntervalMs: 10, File: fileSink}}},
+		{name: "MissingSink", configs: []shared.ScheduledExportConfig{{Name: "a", IntervalMs: 10}}},
+		{name: "TwoSinks", configs: []shared.ScheduledExportConfig{{Name: "a", IntervalMs: 10, File: fileSink, S3: &shared.S3ExportConfig{Bucket: "b", Region: "r"}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := sinks.NewExportScheduler(test.configs, nil); err == nil {
+				t.Errorf("expected an error for configs %v", test.configs)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package sinks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+const (
+	s3RequestTimeout = 30 * time.Second
+	s3Service        = "s3"
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+)
+
+// ExportSink stores the exports of a scheduled export
+type ExportSink interface {
+	Write(name string, data []byte) error
+}
+
+func NewExportSink(config *shared.ScheduledExportConfig) (ExportSink, error) {
+	if (config.File == nil) == (config.S3 == nil) {
+		return nil, fmt.Errorf("export %s must have exactly one of a file or an s3 sink", config.Name)
+	}
+	if config.File != nil {
+		return NewFileExportSink(config.File)
+	}
+	return NewS3ExportSink(config.S3)
+}
+
+type FileExportSink struct {
+	directory string
+}
+
+func NewFileExportSink(config *shared.FileExportConfig) (*FileExportSink, error) {
+	if config.Directory == "" {
+		return nil, fmt.Errorf("file export directory must be set")
+	}
+	if err := os.MkdirAll(config.Directory, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &FileExportSink{directory: config.Directory}, nil
+}
+
+// Write writes to a temporary file first so a partially written export is never picked up
+func (sink *FileExportSink) Write(name string, data []byte) error {
+	filePath := path.Join(sink.directory, name)
+	temporaryPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(temporaryPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, filePath)
+}
+
+// S3ExportSink uploads exports as objects, requests are signed with AWS signature version 4
+type S3ExportSink struct {
+	bucketUrl    *url.URL
+	region       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func NewS3ExportSink(config *shared.S3ExportConfig) (*S3ExportSink, error) {
+	if config.Bucket == "" || config.Region == "" {
+		return nil, fmt.Errorf("s3 export bucket and region must be set")
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("s3 export requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	bucketUrl, err := url.Parse(fmt.Sprintf("%s/%s", strings.TrimSuffix(endpoint, "/"), url.PathEscape(config.Bucket)))
+	if err != nil || bucketUrl.Scheme == "" || bucketUrl.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %s", endpoint)
+	}
+
+	return &S3ExportSink{
+		bucketUrl:    bucketUrl,
+		region:       config.Region,
+		prefix:       config.Prefix,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       utils.NewOutboundHttpClient(s3RequestTimeout),
+	}, nil
+}
+
+func (sink *S3ExportSink) Write(name string, data []byte) error {
+	objectUrl := *sink.bucketUrl
+	objectUrl.Path = fmt.Sprintf("%s/%s%s", sink.bucketUrl.Path, sink.prefix, name)
+
+	request, err := http.NewRequest(http.MethodPut, objectUrl.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	sink.sign(request, data)
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("s3 responded with status %d: %.200s", response.StatusCode, body)
+	}
+	return nil
+}
+
+func (sink *S3ExportSink) sign(request *http.Request, payload []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format("20060102"), sink.region, s3Service)
+	payloadHash := sha256Hex(payload)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sink.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sink.sessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if sink.sessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, header := range signedHeaders {
+		value := request.Header.Get(header)
+		if header == "host" {
+			value = request.URL.Host
+		}
+		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", header, strings.TrimSpace(value)))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSha256([]byte("AWS4"+sink.secretKey), now.Format("20060102"))
+	for _, part := range []string{sink.region, s3Service, "aws4_request"} {
+		signingKey = hmacSha256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3Algorithm, sink.accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,72 @@
+package sinks_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/sinks"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+func setAwsCredentials(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Cleanup(func() {
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	})
+}
+
+func TestS3ExportSinkUploadsObject(t *testing.T) {
+	setAwsCredentials(t)
+
+	var uploaded pushedMetrics
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		uploaded = pushedMetrics{method: request.Method, path: request.URL.EscapedPath(), contentType: request.Header.Get("Content-Type"), body: string(body)}
+		authorization = request.Header.Get("Authorization")
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink, err := sinks.NewS3ExportSink(&shared.S3ExportConfig{Bucket: "exports", Region: "eu-west-1", Prefix: "mizu/", Endpoint: server.URL})
+	if err != nil {
+		t.Fatalf("failed creating sink: %v", err)
+	}
+	if err := sink.Write("errors.jsonl", []byte("{}\n")); err != nil {
+		t.Fatalf("failed writing: %v", err)
+	}
+
+	expected := pushedMetrics{method: http.MethodPut, path: "/exports/mizu/errors.jsonl", contentType: "application/x-ndjson", body: "{}\n"}
+	if uploaded != expected {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, uploaded)
+	}
+	expectedPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"
+	if !strings.HasPrefix(authorization, expectedPrefix) || !strings.Contains(authorization, "/eu-west-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedPrefix, authorization)
+	}
+}
+
+func TestS3ExportSinkRejectedUpload(t *testing.T) {
+	setAwsCredentials(t)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink, _ := sinks.NewS3ExportSink(&shared.S3ExportConfig{Bucket: "exports", Region: "eu-west-1", Endpoint: server.URL})
+	if err := sink.Write("errors.jsonl", nil); err == nil {
+		t.Errorf("expected an error for a rejected upload")
+	}
+}
+
+func TestS3ExportSinkMissingCredentials(t *testing.T) {
+	if _, err := sinks.NewS3ExportSink(&shared.S3ExportConfig{Bucket: "exports", Region: "eu-west-1"}); err == nil {
+		t.Errorf("expected an error without credentials")
+	}
+}
@@ -0,0 +1,129 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+const (
+	pushgatewayRequestTimeout = 10 * time.Second
+	MetricsContentType        = string(expfmt.FmtText)
+)
+
+// PushgatewayPusher pushes the aggregated metrics to a Prometheus Pushgateway when stopped and, optionally, periodically.
+// Every push replaces the metrics previously pushed for the job and instance, so the gateway always holds the latest values.
+// The instance is named after the pushing process, the tappers and the api server would otherwise replace each other's metrics.
+type PushgatewayPusher struct {
+	pushUrl  string
+	interval time.Duration
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewPushgatewayPusher returns nil when no pushgateway is configured, processName is the pod or node name of the process
+func NewPushgatewayPusher(config *shared.PushgatewayConfig, gatherer prometheus.Gatherer, processName string) (*PushgatewayPusher, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Job == "" {
+		return nil, fmt.Errorf("pushgateway job must be set")
+	}
+	if processName == "" {
+		return nil, fmt.Errorf("pushgateway instance of the process must be set")
+	}
+	gatewayUrl, err := url.Parse(config.Url)
+	if err != nil || gatewayUrl.Scheme == "" || gatewayUrl.Host == "" {
+		return nil, fmt.Errorf("invalid pushgateway url %s", config.Url)
+	}
+
+	instance := processName
+	if config.Instance != "" {
+		instance = fmt.Sprintf("%s-%s", config.Instance, processName)
+	}
+	pushUrl := fmt.Sprintf("%s/metrics/job/%s/instance/%s", strings.TrimSuffix(config.Url, "/"), url.PathEscape(config.Job), url.PathEscape(instance))
+
+	return &PushgatewayPusher{
+		pushUrl:  pushUrl,
+		interval: time.Duration(config.IntervalMs) * time.Millisecond,
+		gatherer: gatherer,
+		client:   utils.NewOutboundHttpClient(pushgatewayRequestTimeout),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start pushes periodically when an interval is configured
+func (pusher *PushgatewayPusher) Start() {
+	if pusher.interval <= 0 {
+		return
+	}
+
+	pusher.wg.Add(1)
+	go func() {
+		defer pusher.wg.Done()
+		ticker := time.NewTicker(pusher.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					logger.Log.Warningf("Failed pushing metrics to pushgateway: %v", err)
+				}
+			case <-pusher.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic pushes and pushes the final metrics
+func (pusher *PushgatewayPusher) Stop() error {
+	pusher.stopOnce.Do(func() { close(pusher.stop) })
+	pusher.wg.Wait()
+	return pusher.Push()
+}
+
+func (pusher *PushgatewayPusher) Push() error {
+	metricFamilies, err := pusher.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	encoder := expfmt.NewEncoder(&body, expfmt.FmtText)
+	for _, metricFamily := range metricFamilies {
+		if err := encoder.Encode(metricFamily); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPut, pusher.pushUrl, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", MetricsContentType)
+
+	response, err := pusher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package sinks_test
+
+import (
+	"io/ioutil"
+	"mizuserver/pkg/sinks"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/up9inc/mizu/shared"
+)
+
+type pushedMetrics struct {
+	method      string
+	path        string
+	contentType string
+	body        string
+}
+
+type fakePushgateway struct {
+	server *httptest.Server
+	pushes []pushedMetrics
+	lock   sync.Mutex
+}
+
+func newFakePushgateway(t *testing.T) *fakePushgateway {
+	gateway := &fakePushgateway{}
+	gateway.server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			t.Errorf("failed reading push: %v", err)
+		}
+		gateway.lock.Lock()
+		gateway.pushes = append(gateway.pushes, pushedMetrics{method: request.Method, path: request.URL.EscapedPath(), contentType: request.Header.Get("Content-Type"), body: string(body)})
+		gateway.lock.Unlock()
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(gateway.server.Close)
+	return gateway
+}
+
+func (gateway *fakePushgateway) getPushes() []pushedMetrics {
+	gateway.lock.Lock()
+	defer gateway.lock.Unlock()
+	return append([]pushedMetrics{}, gateway.pushes...)
+}
+
+func TestPushgatewayPusherPushesOnStop(t *testing.T) {
+	gateway := newFakePushgateway(t)
+	registry := prometheus.NewRegistry()
+	entriesCounter := prometheus.NewCounter(prometheus.CounterOpts{Name: "mizu_entries_total", Help: "Number of captured entries."})
+	tappersGauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "mizu_tappers", Help: "Number of connected tappers."})
+	registry.MustRegister(entriesCounter, tappersGauge)
+	tappersGauge.Set(2)
+
+	pusher, err := sinks.NewPushgatewayPusher(&shared.PushgatewayConfig{Url: gateway.server.URL + "/", Job: "capture job", Instance: "capture"}, registry, "node-1")
+	if err != nil {
+		t.Fatalf("failed creating pusher: %v", err)
+	}
+	pusher.Start()
+	entriesCounter.Add(42)
+
+	if err := pusher.Stop(); err != nil {
+		t.Fatalf("failed pushing: %v", err)
+	}
+
+	expected := []pushedMetrics{{
+		method:      http.MethodPut,
+		path:        "/metrics/job/capture%20job/instance/capture-node-1",
+		contentType: sinks.MetricsContentType,
+		body: "# HELP mizu_entries_total Number of captured entries.\n" +
+			"# TYPE mizu_entries_total counter\n" +
+			"mizu_entries_total 42\n" +
+			"# HELP mizu_tappers Number of connected tappers.\n" +
+			"# TYPE mizu_tappers gauge\n" +
+			"mizu_tappers 2\n",
+	}}
+	if pushes := gateway.getPushes(); len(pushes) != 1 || pushes[0] != expected[0] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, pushes)
+	}
+}
+
+func TestPushgatewayPusherPushesPeriodically(t *testing.T) {
+	gateway := newFakePushgateway(t)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "mizu_entries_total", Help: "Number of captured entries."}))
+
+	pusher, err := sinks.NewPushgatewayPusher(&shared.PushgatewayConfig{Url: gateway.server.URL, Job: "mizu", IntervalMs: 10}, registry, "mizu-api-server")
+	if err != nil {
+		t.Fatalf("failed creating pusher: %v", err)
+	}
+	pusher.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(gateway.getPushes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := pusher.Stop(); err != nil {
+		t.Fatalf("failed pushing: %v", err)
+	}
+
+	pushes := gateway.getPushes()
+	if len(pushes) < 3 {
+		t.Fatalf("expected periodic pushes and a final push, actual: %v", len(pushes))
+	}
+	for _, push := range pushes {
+		if push.path != "/metrics/job/mizu/instance/mizu-api-server" {
+			t.Errorf("unexpected result - expected: %v, actual: %v", "/metrics/job/mizu/instance/mizu-api-server", push.path)
+		}
+	}
+}
+
+func TestPushgatewayPusherFailedPush(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pusher, _ := sinks.NewPushgatewayPusher(&shared.PushgatewayConfig{Url: server.URL, Job: "mizu"}, prometheus.NewRegistry(), "node-1")
+	if err := pusher.Stop(); err == nil {
+		t.Errorf("expected an error for a rejected push")
+	}
+}
+
+func TestNewPushgatewayPusherInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *shared.PushgatewayConfig
+		processName string
+	}{
+		{name: "MissingJob", config: &shared.PushgatewayConfig{Url: "http://pushgateway:9091"}, processName: "node-1"},
+		{name: "InvalidUrl", config: &shared.PushgatewayConfig{Url: "pushgateway", Job: "mizu"}, processName: "node-1"},
+		{name: "MissingProcessName", config: &shared.PushgatewayConfig{Url: "http://pushgateway:9091", Job: "mizu"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := sinks.NewPushgatewayPusher(test.config, nil, test.processName); err == nil {
+				t.Errorf("expected an error for config %v", test.config)
+			}
+		})
+	}
+}
+
+func TestPushgatewayPusherPushesLabels(t *testing.T) {
+	gateway := newFakePushgateway(t)
+	registry := prometheus.NewRegistry()
+	entriesCounter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mizu_entries_total", Help: "Entries."}, []string{"protocol", "a"})
+	registry.MustRegister(entriesCounter)
+	entriesCounter.WithLabelValues("http", `quo"te`).Add(1.5)
+	entriesCounter.WithLabelValues("redis", "").Add(3)
+
+	pusher, _ := sinks.NewPushgatewayPusher(&shared.PushgatewayConfig{Url: gateway.server.URL, Job: "mizu"}, registry, "node-1")
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("failed pushing: %v", err)
+	}
+
+	expected := "# HELP mizu_entries_total Entries.\n" +
+		"# TYPE mizu_entries_total counter\n" +
+		"mizu_entries_total{a=\"\",protocol=\"redis\"} 3\n" +
+		"mizu_entries_total{a=\"quo\\\"te\",protocol=\"http\"} 1.5\n"
+	if pushes := gateway.getPushes(); len(pushes) != 1 || pushes[0].body != expected {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, pushes)
+	}
+}
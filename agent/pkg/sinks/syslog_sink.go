@@ -0,0 +1,226 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/logger"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+const (
+	syslogAppName          = "mizu"
+	syslogMessageId        = "entry"
+	syslogStructuredDataId = "entry@32473"
+	syslogQueueSize        = 1000
+	syslogMaxFacility      = 23
+	syslogMaxSeverity      = 7
+	syslogDialTimeout      = 5 * time.Second
+	syslogWriteTimeout     = 5 * time.Second
+	syslogDropLogRate      = 1000 // a warning is logged for the first dropped entry and for every syslogDropLogRate after it
+)
+
+const (
+	syslogMinReconnectDelay = time.Second
+	syslogMaxReconnectDelay = 30 * time.Second
+)
+
+var syslogFieldGetters = map[string]func(entry *tapApi.MizuEntry) string{
+	"protocol": func(entry *tapApi.MizuEntry) string { return entry.ProtocolName },
+	"method":   func(entry *tapApi.MizuEntry) string { return entry.Method },
+	"path":     func(entry *tapApi.MizuEntry) string { return entry.Path },
+	"url":      func(entry *tapApi.MizuEntry) string { return entry.Url },
+	"status":   func(entry *tapApi.MizuEntry) string { return strconv.Itoa(entry.Status) },
+	"source":   func(entry *tapApi.MizuEntry) string { return firstNonEmpty(entry.ResolvedSource, entry.SourceIp) },
+	"destination": func(entry *tapApi.MizuEntry) string {
+		return firstNonEmpty(entry.ResolvedDestination, entry.DestinationIp)
+	},
+	"service":     func(entry *tapApi.MizuEntry) string { return entry.Service },
+	"elapsedTime": func(entry *tapApi.MizuEntry) string { return strconv.FormatInt(entry.ElapsedTime, 10) },
+	"entryId":     func(entry *tapApi.MizuEntry) string { return entry.EntryId },
+}
+
+var defaultSyslogFields = []string{"protocol", "method", "path", "url", "status", "source", "destination", "service", "elapsedTime", "entryId"}
+
+// SyslogSink forwards entries to a syslog server, entries are queued and dropped when the server can't keep up
+type SyslogSink struct {
+	config     *shared.SyslogSinkConfig
+	fields     []string
+	hostname   string
+	connection net.Conn // nil while disconnected
+	entries    chan *tapApi.MizuEntry
+	dropped    uint64
+	// the entries are dropped without connecting until nextConnectAt once connecting failed, the delay doubles with
+	// every failed attempt
+	reconnectDelay time.Duration
+	nextConnectAt  time.Time
+}
+
+// NewSyslogSink connects to the configured syslog server, it returns nil when no syslog sink is configured. A server
+// that can't be reached yet is connected to once the next entries are sent.
+func NewSyslogSink(config *shared.SyslogSinkConfig) (*SyslogSink, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Facility < 0 || config.Facility > syslogMaxFacility {
+		return nil, fmt.Errorf("invalid syslog facility %d", config.Facility)
+	}
+	if config.Severity < 0 || config.Severity > syslogMaxSeverity {
+		return nil, fmt.Errorf("invalid syslog severity %d", config.Severity)
+	}
+	switch config.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %s", config.Network)
+	}
+
+	fields := defaultSyslogFields
+	if len(config.Fields) > 0 {
+		for _, field := range config.Fields {
+			if _, ok := syslogFieldGetters[field]; !ok {
+				return nil, fmt.Errorf("unknown syslog field %s", field)
+			}
+		}
+		fields = config.Fields
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	sink := &SyslogSink{config: config, fields: fields, hostname: hostname, entries: make(chan *tapApi.MizuEntry, syslogQueueSize)}
+	sink.reconnect()
+
+	go sink.run()
+	return sink, nil
+}
+
+// HandleEntry queues the entry for sending without blocking the caller
+func (sink *SyslogSink) HandleEntry(entry *tapApi.MizuEntry) {
+	if sink.config.ErrorsOnly && entry.Status < 400 {
+		return
+	}
+
+	// the queued entry is a copy since the caller keeps changing it, e.g. the deduplicator merges the duplicates into it
+	queuedEntry := *entry
+	select {
+	case sink.entries <- &queuedEntry:
+	default:
+		if dropped := atomic.AddUint64(&sink.dropped, 1); dropped%syslogDropLogRate == 1 {
+			logger.Log.Warningf("Dropped %d entries, the syslog queue is full", dropped)
+		}
+	}
+}
+
+// FormatMessage formats the entry as an RFC 5424 message carrying the selected fields as structured data
+func (sink *SyslogSink) FormatMessage(entry *tapApi.MizuEntry, timestamp time.Time) string {
+	priority := sink.config.Facility*8 + sink.config.Severity
+
+	var structuredData strings.Builder
+	structuredData.WriteString("[" + syslogStructuredDataId)
+	for _, field := range sink.fields {
+		structuredData.WriteString(fmt.Sprintf(" %s=\"%s\"", field, escapeStructuredDataValue(syslogFieldGetters[field](entry))))
+	}
+	structuredData.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s", priority, timestamp.UTC().Format(time.RFC3339Nano), sink.hostname, syslogAppName, os.Getpid(), syslogMessageId, structuredData.String())
+}
+
+func (sink *SyslogSink) run() {
+	for entry := range sink.entries {
+		message := sink.FormatMessage(entry, time.Now())
+		if sink.connection == nil && !sink.reconnect() {
+			continue
+		}
+		if err := sink.send(message); err != nil {
+			logger.Log.Warningf("Failed sending entry to syslog, reconnecting: %v", err)
+			if !sink.reconnect() {
+				continue
+			}
+			if err := sink.send(message); err != nil {
+				logger.Log.Errorf("Failed sending entry to syslog: %v", err)
+			}
+		}
+	}
+}
+
+// reconnect returns whether the sink is connected, it doesn't attempt connecting before nextConnectAt
+func (sink *SyslogSink) reconnect() bool {
+	if time.Now().Before(sink.nextConnectAt) {
+		return false
+	}
+	if err := sink.connect(); err != nil {
+		sink.reconnectDelay *= 2
+		if sink.reconnectDelay < syslogMinReconnectDelay {
+			sink.reconnectDelay = syslogMinReconnectDelay
+		} else if sink.reconnectDelay > syslogMaxReconnectDelay {
+			sink.reconnectDelay = syslogMaxReconnectDelay
+		}
+		sink.nextConnectAt = time.Now().Add(sink.reconnectDelay)
+		logger.Log.Errorf("Failed connecting to syslog, dropping the entries for %v: %v", sink.reconnectDelay, err)
+		return false
+	}
+	sink.reconnectDelay = 0
+	return true
+}
+
+func (sink *SyslogSink) connect() error {
+	if sink.connection != nil {
+		_ = sink.connection.Close()
+		sink.connection = nil
+	}
+
+	var connection net.Conn
+	var err error
+	switch sink.config.Network {
+	case "udp", "tcp":
+		connection, err = net.DialTimeout(sink.config.Network, sink.config.Address, syslogDialTimeout)
+	case "tls":
+		dialer := &net.Dialer{Timeout: syslogDialTimeout}
+		connection, err = tls.DialWithDialer(dialer, "tcp", sink.config.Address, &tls.Config{InsecureSkipVerify: sink.config.InsecureSkipVerify})
+	default:
+		return fmt.Errorf("unsupported syslog network %s", sink.config.Network)
+	}
+	if err != nil {
+		return err
+	}
+
+	sink.connection = connection
+	return nil
+}
+
+// send fails once the write deadline expires, so a stalled server makes the sink reconnect rather than block
+func (sink *SyslogSink) send(message string) error {
+	if err := sink.connection.SetWriteDeadline(time.Now().Add(syslogWriteTimeout)); err != nil {
+		return err
+	}
+	if sink.config.Network == "udp" {
+		_, err := sink.connection.Write([]byte(message))
+		return err
+	}
+
+	// stream transports use octet counting framing (RFC 6587)
+	_, err := fmt.Fprintf(sink.connection, "%d %s", len(message), message)
+	return err
+}
+
+func escapeStructuredDataValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,223 @@
+package sinks_test
+
+import (
+	"bufio"
+	"fmt"
+	"mizuserver/pkg/sinks"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+var syslogTestEntry = &tapApi.MizuEntry{
+	ProtocolName:        "http",
+	Method:              "GET",
+	Path:                `/search?q="a]b"`,
+	Status:              503,
+	ResolvedSource:      "frontend",
+	ResolvedDestination: "search",
+	ElapsedTime:         42,
+	EntryId:             "abc",
+}
+
+var rfc5424Regex = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) mizu (\d+) entry (\[.*\])$`)
+
+func startFakeUdpSyslogServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		buffer := make([]byte, 65536)
+		for {
+			n, _, err := listener.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			messages <- string(buffer[:n])
+		}
+	}()
+	return listener.LocalAddr().String(), messages
+}
+
+func startFakeTcpSyslogServer(t *testing.T) (string, <-chan string) {
+	return startFakeTcpSyslogServerAt(t, "127.0.0.1:0")
+}
+
+func startFakeTcpSyslogServerAt(t *testing.T, address string) (string, <-chan string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		reader := bufio.NewReader(connection)
+		for {
+			lengthString, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(strings.TrimSpace(lengthString))
+			message := make([]byte, length)
+			if _, err := reader.Read(message); err != nil {
+				return
+			}
+			messages <- string(message)
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func receiveSyslogMessage(t *testing.T, messages <-chan string) string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for syslog message")
+		return ""
+	}
+}
+
+func TestSyslogSinkFormatting(t *testing.T) {
+	tests := []struct {
+		network     string
+		startServer func(t *testing.T) (string, <-chan string)
+	}{
+		{network: "udp", startServer: startFakeUdpSyslogServer},
+		{network: "tcp", startServer: startFakeTcpSyslogServer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.network, func(t *testing.T) {
+			address, messages := test.startServer(t)
+			sink, err := sinks.NewSyslogSink(&shared.SyslogSinkConfig{
+				Address:  address,
+				Network:  test.network,
+				Facility: 16,
+				Severity: 4,
+				Fields:   []string{"method", "path", "status", "source"},
+			})
+			if err != nil {
+				t.Fatalf("failed to create syslog sink: %v", err)
+			}
+
+			sink.HandleEntry(syslogTestEntry)
+			message := receiveSyslogMessage(t, messages)
+
+			match := rfc5424Regex.FindStringSubmatch(message)
+			if match == nil {
+				t.Fatalf("message is not in RFC 5424 format: %s", message)
+			}
+			if expectedPriority := "132"; match[1] != expectedPriority {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedPriority, match[1])
+			}
+			if _, err := time.Parse(time.RFC3339Nano, match[2]); err != nil {
+				t.Errorf("invalid timestamp %s: %v", match[2], err)
+			}
+			if match[4] != fmt.Sprintf("%d", os.Getpid()) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", os.Getpid(), match[4])
+			}
+			expectedStructuredData := `[entry@32473 method="GET" path="/search?q=\"a\]b\"" status="503" source="frontend"]`
+			if match[5] != expectedStructuredData {
+				t.Errorf("unexpected result - expected: %v, actual: %v", expectedStructuredData, match[5])
+			}
+		})
+	}
+}
+
+func TestSyslogSinkErrorsOnly(t *testing.T) {
+	address, messages := startFakeUdpSyslogServer(t)
+	sink, err := sinks.NewSyslogSink(&shared.SyslogSinkConfig{Address: address, Network: "udp", ErrorsOnly: true, Fields: []string{"status"}})
+	if err != nil {
+		t.Fatalf("failed to create syslog sink: %v", err)
+	}
+
+	sink.HandleEntry(&tapApi.MizuEntry{Status: 200})
+	sink.HandleEntry(&tapApi.MizuEntry{Status: 500})
+
+	if message := receiveSyslogMessage(t, messages); !strings.HasSuffix(message, `[entry@32473 status="500"]`) {
+		t.Errorf("unexpected message %s", message)
+	}
+}
+
+func TestSyslogSinkDefaultFields(t *testing.T) {
+	address, messages := startFakeUdpSyslogServer(t)
+	sink, err := sinks.NewSyslogSink(&shared.SyslogSinkConfig{Address: address, Network: "udp"})
+	if err != nil {
+		t.Fatalf("failed to create syslog sink: %v", err)
+	}
+
+	sink.HandleEntry(&tapApi.MizuEntry{ProtocolName: "http", Url: "http://search/q", Service: "search", EntryId: "abc"})
+
+	expectedStructuredData := `[entry@32473 protocol="http" method="" path="" url="http://search/q" status="0" source="" destination="" service="search" elapsedTime="0" entryId="abc"]`
+	if message := receiveSyslogMessage(t, messages); !strings.HasSuffix(message, expectedStructuredData) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedStructuredData, message)
+	}
+}
+
+func TestNewSyslogSinkInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *shared.SyslogSinkConfig
+	}{
+		{name: "facility", config: &shared.SyslogSinkConfig{Network: "udp", Facility: 24}},
+		{name: "severity", config: &shared.SyslogSinkConfig{Network: "udp", Severity: 8}},
+		{name: "field", config: &shared.SyslogSinkConfig{Network: "udp", Fields: []string{"body"}}},
+		{name: "network", config: &shared.SyslogSinkConfig{Network: "unix"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := sinks.NewSyslogSink(test.config); err == nil {
+				t.Errorf("expected an error for invalid %s", test.name)
+			}
+		})
+	}
+}
+
+func TestSyslogSinkConnectsOnceServerReachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	sink, err := sinks.NewSyslogSink(&shared.SyslogSinkConfig{Network: "tcp", Address: address})
+	if err != nil || sink == nil {
+		t.Fatalf("unexpected result - expected: %v, actual: %v %v", "a disconnected sink", sink, err)
+	}
+
+	_, messages := startFakeTcpSyslogServerAt(t, address)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.HandleEntry(syslogTestEntry)
+		select {
+		case message := <-messages:
+			if !strings.Contains(message, `entryId="abc"`) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", `entryId="abc"`, message)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for syslog message")
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package up9
+
+import (
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // attempts are allowed
+	BreakerOpen                         // attempts are rejected until the cooldown passed
+	BreakerHalfOpen                     // a trial attempt is allowed, its result closes or reopens the breaker
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops the attempts after maxFailures consecutive failures and allows a trial attempt once the
+// cooldown passed
+type CircuitBreaker struct {
+	name                string
+	maxFailures         int
+	cooldown            time.Duration
+	mutex               sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+}
+
+func NewCircuitBreaker(name string, maxFailures int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, maxFailures: maxFailures, cooldown: cooldown}
+}
+
+// Allow returns whether to attempt, an open breaker turns half-open once the cooldown passed
+func (breaker *CircuitBreaker) Allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.state == BreakerOpen {
+		if time.Since(breaker.openedAt) < breaker.cooldown {
+			return false
+		}
+		breaker.setState(BreakerHalfOpen)
+	}
+	return true
+}
+
+func (breaker *CircuitBreaker) RecordSuccess() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.consecutiveFailures = 0
+	breaker.setState(BreakerClosed)
+}
+
+func (breaker *CircuitBreaker) RecordFailure() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.consecutiveFailures++
+	if breaker.state == BreakerHalfOpen || breaker.consecutiveFailures >= breaker.maxFailures {
+		breaker.openedAt = time.Now()
+		breaker.setState(BreakerOpen)
+	}
+}
+
+func (breaker *CircuitBreaker) State() BreakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.state
+}
+
+// RemainingCooldown returns how long an open breaker keeps rejecting the attempts, 0 unless it's open
+func (breaker *CircuitBreaker) RemainingCooldown() time.Duration {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.state != BreakerOpen {
+		return 0
+	}
+	if remaining := breaker.cooldown - time.Since(breaker.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (breaker *CircuitBreaker) setState(state BreakerState) {
+	if breaker.state == state {
+		return
+	}
+	logger.Log.Infof("%s circuit breaker %s -> %s after %d consecutive failures", breaker.name, breaker.state, state, breaker.consecutiveFailures)
+	breaker.state = state
+}
@@ -0,0 +1,94 @@
+package up9_test
+
+import (
+	"mizuserver/pkg/up9"
+	"testing"
+	"time"
+)
+
+func assertBreakerState(t *testing.T, breaker *up9.CircuitBreaker, expected up9.BreakerState) {
+	t.Helper()
+	if state := breaker.State(); state != expected {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, state)
+	}
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	breaker := up9.NewCircuitBreaker("test", 3, time.Minute)
+
+	breaker.RecordFailure()
+	breaker.RecordFailure()
+	breaker.RecordSuccess()
+	breaker.RecordFailure()
+	breaker.RecordFailure()
+	// the success reset the failures, 2 are consecutive
+	assertBreakerState(t, breaker, up9.BreakerClosed)
+	if !breaker.Allow() {
+		t.Errorf("unexpected result - expected: %v, actual: %v", true, false)
+	}
+
+	breaker.RecordFailure()
+	assertBreakerState(t, breaker, up9.BreakerOpen)
+	if breaker.Allow() {
+		t.Errorf("unexpected result - expected: %v, actual: %v", false, true)
+	}
+	if remaining := breaker.RemainingCooldown(); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "up to a minute", remaining)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAfterCooldown(t *testing.T) {
+	tests := []struct {
+		name          string
+		trialSucceeds bool
+		expectedState up9.BreakerState
+	}{
+		{name: "successful trial closes", trialSucceeds: true, expectedState: up9.BreakerClosed},
+		{name: "failed trial reopens", trialSucceeds: false, expectedState: up9.BreakerOpen},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := up9.NewCircuitBreaker("test", 1, 20*time.Millisecond)
+			breaker.RecordFailure()
+			assertBreakerState(t, breaker, up9.BreakerOpen)
+
+			time.Sleep(40 * time.Millisecond)
+			if !breaker.Allow() {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", true, false)
+			}
+			assertBreakerState(t, breaker, up9.BreakerHalfOpen)
+
+			if test.trialSucceeds {
+				breaker.RecordSuccess()
+			} else {
+				breaker.RecordFailure()
+			}
+			assertBreakerState(t, breaker, test.expectedState)
+			if allowed := breaker.Allow(); allowed != test.trialSucceeds {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.trialSucceeds, allowed)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenReopensOnFirstFailure(t *testing.T) {
+	breaker := up9.NewCircuitBreaker("test", 5, 20*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		breaker.RecordFailure()
+	}
+	time.Sleep(40 * time.Millisecond)
+	breaker.Allow()
+
+	// a single failure of the trial reopens, the failures threshold applies to a closed breaker only
+	breaker.RecordFailure()
+	assertBreakerState(t, breaker, up9.BreakerOpen)
+}
+
+func TestBreakerStateString(t *testing.T) {
+	for state, expected := range map[up9.BreakerState]string{up9.BreakerClosed: "closed", up9.BreakerOpen: "open", up9.BreakerHalfOpen: "half-open"} {
+		if actual := state.String(); actual != expected {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected, actual)
+		}
+	}
+}
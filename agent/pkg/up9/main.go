@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/martian/har"
@@ -22,7 +23,16 @@ import (
 )
 
 const (
-	AnalyzeCheckSleepTime = 5 * time.Second
+	AnalyzeCheckSleepTime  = 5 * time.Second
+	defaultSyncMaxFailures = 5
+	defaultSyncCooldown    = time.Minute
+	syncRetryBaseDelay     = time.Second
+	syncRetryMaxDelay      = 30 * time.Second
+)
+
+var (
+	syncBreaker     *CircuitBreaker // nil unless the entries are synced
+	syncBreakerLock sync.Mutex
 )
 
 type GuestToken struct {
@@ -54,7 +64,7 @@ func CheckIfModelReady(analyzeDestination string, analyzeModel string, analyzeTo
 			authHeader:     {analyzeToken},
 		},
 	}
-	statusResp, err := http.DefaultClient.Do(req)
+	statusResp, err := utils.NewOutboundHttpClient(0).Do(req)
 	if err != nil {
 		return false
 	}
@@ -109,6 +119,61 @@ func GetAnalyzeInfo() *shared.AnalyzeStatus {
 	}
 }
 
+// StartSyncingEntries syncs the entries in the background. The failures are retried with backoff, and the circuit
+// breaker stops the attempts for a cooldown once up9 keeps failing, the sync never stops the api server.
+func StartSyncingEntries(syncEntriesConfig *shared.SyncEntriesConfig) {
+	breaker := getSyncBreaker(syncEntriesConfig)
+	go func() {
+		delay := syncRetryBaseDelay
+		for {
+			if !breaker.Allow() {
+				time.Sleep(breaker.RemainingCooldown())
+				continue
+			}
+			err := SyncEntries(syncEntriesConfig)
+			if err == nil {
+				breaker.RecordSuccess()
+				return
+			}
+			breaker.RecordFailure()
+			logger.Log.Errorf("Failed syncing entries, retrying in %v: %v", delay, err)
+			time.Sleep(delay)
+			if delay *= 2; delay > syncRetryMaxDelay {
+				delay = syncRetryMaxDelay
+			}
+		}
+	}()
+}
+
+// getSyncBreaker returns the circuit breaker of the sync, it's created by the first call
+func getSyncBreaker(syncEntriesConfig *shared.SyncEntriesConfig) *CircuitBreaker {
+	syncBreakerLock.Lock()
+	defer syncBreakerLock.Unlock()
+	if syncBreaker == nil {
+		maxFailures := defaultSyncMaxFailures
+		if syncEntriesConfig.MaxFailures > 0 {
+			maxFailures = syncEntriesConfig.MaxFailures
+		}
+		cooldown := defaultSyncCooldown
+		if syncEntriesConfig.CooldownSec > 0 {
+			cooldown = time.Duration(syncEntriesConfig.CooldownSec) * time.Second
+		}
+		syncBreaker = NewCircuitBreaker("Sync entries", maxFailures, cooldown)
+	}
+	return syncBreaker
+}
+
+// GetSyncBreakerState returns the state of the circuit breaker of the sync, false when the entries aren't synced
+func GetSyncBreakerState() (BreakerState, bool) {
+	syncBreakerLock.Lock()
+	breaker := syncBreaker
+	syncBreakerLock.Unlock()
+	if breaker == nil {
+		return BreakerClosed, false
+	}
+	return breaker.State(), true
+}
+
 func SyncEntries(syncEntriesConfig *shared.SyncEntriesConfig) error {
 	logger.Log.Infof("Sync entries - started\n")
 
@@ -143,7 +208,7 @@ func SyncEntries(syncEntriesConfig *shared.SyncEntriesConfig) error {
 	}
 
 	logger.Log.Infof("Sync entries - syncing. token: %s, model: %s, guest mode: %v\n", token, model, guestMode)
-	go syncEntriesImpl(token, model, syncEntriesConfig.Env, syncEntriesConfig.UploadIntervalSec, guestMode)
+	go syncEntriesImpl(token, model, syncEntriesConfig.Env, syncEntriesConfig.UploadIntervalSec, guestMode, getSyncBreaker(syncEntriesConfig))
 
 	return nil
 }
@@ -160,7 +225,7 @@ func upsertModel(token string, model string, envPrefix string) error {
 		},
 	}
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := utils.NewOutboundHttpClient(0).Do(req)
 	if err != nil {
 		return fmt.Errorf("failed request to upsert model, err: %v", err)
 	}
@@ -187,7 +252,7 @@ func createAnonymousToken(envPrefix string) (*GuestToken, error) {
 }
 
 func getGuestToken(url string, target *GuestToken) error {
-	resp, err := http.Get(url)
+	resp, err := utils.NewOutboundHttpClient(0).Get(url)
 	if err != nil {
 		return err
 	}
@@ -196,7 +261,7 @@ func getGuestToken(url string, target *GuestToken) error {
 	return json.NewDecoder(resp.Body).Decode(target)
 }
 
-func syncEntriesImpl(token string, model string, envPrefix string, uploadIntervalSec int, guestMode bool) {
+func syncEntriesImpl(token string, model string, envPrefix string, uploadIntervalSec int, guestMode bool, breaker *CircuitBreaker) {
 	analyzeInformation.IsAnalyzing = true
 	analyzeInformation.GuestMode = guestMode
 	analyzeInformation.AnalyzedModel = model
@@ -207,84 +272,98 @@ func syncEntriesImpl(token string, model string, envPrefix string, uploadInterva
 	sleepTime := time.Second * time.Duration(uploadIntervalSec)
 
 	var timeFrom time.Time
-	protocolFilter := "http"
 
 	for {
 		timeTo := time.Now()
-		logger.Log.Infof("Getting entries from %v, to %v\n", timeFrom.Format(time.RFC3339Nano), timeTo.Format(time.RFC3339Nano))
-		entriesArray := database.GetEntriesFromDb(timeFrom, timeTo, &protocolFilter)
-
-		if len(entriesArray) > 0 {
-			result := make([]har.Entry, 0)
-			for _, data := range entriesArray {
-				var pair tapApi.RequestResponsePair
-				if err := json.Unmarshal([]byte(data.Entry), &pair); err != nil {
-					continue
-				}
-				harEntry, err := utils.NewEntry(&pair)
-				if err != nil {
-					continue
-				}
-				if data.ResolvedSource != "" {
-					harEntry.Request.Headers = append(harEntry.Request.Headers, har.Header{Name: "x-mizu-source", Value: data.ResolvedSource})
-				}
-				if data.ResolvedDestination != "" {
-					harEntry.Request.Headers = append(harEntry.Request.Headers, har.Header{Name: "x-mizu-destination", Value: data.ResolvedDestination})
-					harEntry.Request.URL = utils.SetHostname(harEntry.Request.URL, data.ResolvedDestination)
-				}
-
-				// go's default marshal behavior is to encode []byte fields to base64, python's default unmarshal behavior is to not decode []byte fields from base64
-				if harEntry.Response.Content.Text, err = base64.StdEncoding.DecodeString(string(harEntry.Response.Content.Text)); err != nil {
-					continue
-				}
-
-				result = append(result, *harEntry)
-			}
-
-			logger.Log.Infof("About to upload %v entries\n", len(result))
+		// the entries since the last successful upload are uploaded once up9 is available again
+		if !breaker.Allow() {
+			logger.Log.Infof("Sync entries - up9 is unavailable, retrying in %v", breaker.RemainingCooldown())
+		} else if uploadedCount, err := uploadEntries(token, model, envPrefix, guestMode, timeFrom, timeTo); err != nil {
+			breaker.RecordFailure()
+			logger.Log.Errorf("Failed uploading entries: %v", err)
+		} else {
+			breaker.RecordSuccess()
+			analyzeInformation.SentCount += uploadedCount
+			logger.Log.Infof("Uploaded %v entries until now", analyzeInformation.SentCount)
+			timeFrom = timeTo
+		}
 
-			body, jMarshalErr := json.Marshal(result)
-			if jMarshalErr != nil {
-				analyzeInformation.Reset()
-				logger.Log.Infof("Stopping sync entries")
-				logger.Log.Fatal(jMarshalErr)
-			}
+		logger.Log.Infof("Sleeping for %v...\n", sleepTime)
+		time.Sleep(sleepTime)
+	}
+}
 
-			var in bytes.Buffer
-			w := zlib.NewWriter(&in)
-			_, _ = w.Write(body)
-			_ = w.Close()
-			reqBody := ioutil.NopCloser(bytes.NewReader(in.Bytes()))
-
-			authHeader := getAuthHeader(guestMode)
-			req := &http.Request{
-				Method: http.MethodPost,
-				URL:    GetTrafficDumpUrl(envPrefix, model),
-				Header: map[string][]string{
-					"Content-Encoding": {"deflate"},
-					"Content-Type":     {"application/octet-stream"},
-					authHeader:         {token},
-				},
-				Body: reqBody,
-			}
+// uploadEntries uploads the http entries from timeFrom to timeTo and returns how many entries were uploaded
+func uploadEntries(token string, model string, envPrefix string, guestMode bool, timeFrom time.Time, timeTo time.Time) (int, error) {
+	protocolFilter := "http"
+	logger.Log.Infof("Getting entries from %v, to %v\n", timeFrom.Format(time.RFC3339Nano), timeTo.Format(time.RFC3339Nano))
+	entriesArray := database.GetEntriesFromDb(timeFrom, timeTo, &protocolFilter)
+	if len(entriesArray) == 0 {
+		logger.Log.Infof("Nothing to upload")
+		return 0, nil
+	}
 
-			if _, postErr := http.DefaultClient.Do(req); postErr != nil {
-				analyzeInformation.Reset()
-				logger.Log.Info("Stopping sync entries")
-				logger.Log.Fatal(postErr)
-			}
-			analyzeInformation.SentCount += len(entriesArray)
-			logger.Log.Infof("Finish uploading %v entries to %s\n", len(entriesArray), GetTrafficDumpUrl(envPrefix, model))
+	result := make([]har.Entry, 0)
+	for _, data := range entriesArray {
+		var pair tapApi.RequestResponsePair
+		if err := json.Unmarshal([]byte(data.Entry), &pair); err != nil {
+			continue
+		}
+		harEntry, err := utils.NewEntry(&pair)
+		if err != nil {
+			continue
+		}
+		if data.ResolvedSource != "" {
+			harEntry.Request.Headers = append(harEntry.Request.Headers, har.Header{Name: "x-mizu-source", Value: data.ResolvedSource})
+		}
+		if data.ResolvedDestination != "" {
+			harEntry.Request.Headers = append(harEntry.Request.Headers, har.Header{Name: "x-mizu-destination", Value: data.ResolvedDestination})
+			harEntry.Request.URL = utils.SetHostname(harEntry.Request.URL, data.ResolvedDestination)
+		}
 
-			logger.Log.Infof("Uploaded %v entries until now", analyzeInformation.SentCount)
-		} else {
-			logger.Log.Infof("Nothing to upload")
+		// go's default marshal behavior is to encode []byte fields to base64, python's default unmarshal behavior is to not decode []byte fields from base64
+		if harEntry.Response.Content.Text, err = base64.StdEncoding.DecodeString(string(harEntry.Response.Content.Text)); err != nil {
+			continue
 		}
 
-		logger.Log.Infof("Sleeping for %v...\n", sleepTime)
-		time.Sleep(sleepTime)
-		timeFrom = timeTo
+		result = append(result, *harEntry)
+	}
+
+	logger.Log.Infof("About to upload %v entries\n", len(result))
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return 0, fmt.Errorf("failed marshaling the entries, err: %v", err)
+	}
+
+	var in bytes.Buffer
+	w := zlib.NewWriter(&in)
+	_, _ = w.Write(body)
+	_ = w.Close()
+	reqBody := ioutil.NopCloser(bytes.NewReader(in.Bytes()))
+
+	authHeader := getAuthHeader(guestMode)
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    GetTrafficDumpUrl(envPrefix, model),
+		Header: map[string][]string{
+			"Content-Encoding": {"deflate"},
+			"Content-Type":     {"application/octet-stream"},
+			authHeader:         {token},
+		},
+		Body: reqBody,
+	}
+
+	response, err := utils.NewOutboundHttpClient(0).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed request to upload entries, err: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return 0, fmt.Errorf("failed request to upload entries, status code: %v", response.StatusCode)
 	}
+	logger.Log.Infof("Finish uploading %v entries to %s\n", len(entriesArray), GetTrafficDumpUrl(envPrefix, model))
+	return len(entriesArray), nil
 }
 
 func UpdateAnalyzeStatus(callback func(data []byte)) {
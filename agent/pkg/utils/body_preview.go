@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	tapApi "github.com/up9inc/mizu/tap/api"
+)
+
+type httpBodiesPair struct {
+	Request struct {
+		Payload struct {
+			Details struct {
+				PostData struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		Payload struct {
+			Details struct {
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Encoding string `json:"encoding"`
+					Text     string `json:"text"`
+				} `json:"content"`
+			} `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+type EntryBody struct {
+	MimeType string
+	Data     []byte
+}
+
+// GetHttpBodies returns the decoded request and response bodies of an http entry
+func GetHttpBodies(entry *tapApi.MizuEntry) (*EntryBody, *EntryBody, error) {
+	var pair httpBodiesPair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return nil, nil, err
+	}
+
+	postData := pair.Request.Payload.Details.PostData
+	request := &EntryBody{MimeType: postData.MimeType, Data: []byte(postData.Text)}
+
+	content := pair.Response.Payload.Details.Content
+	response := &EntryBody{MimeType: content.MimeType, Data: []byte(content.Text)}
+	if content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(content.Text)
+		if err != nil {
+			return nil, nil, err
+		}
+		response.Data = decoded
+	}
+
+	return request, response, nil
+}
+
+// TruncateUTF8 returns at most maxBytes bytes of data as valid UTF-8, the cut never splits a character and invalid bytes are replaced
+func TruncateUTF8(data []byte, maxBytes int) (string, bool) {
+	truncated := len(data) > maxBytes
+	if truncated {
+		cut := maxBytes
+		for cut > 0 && cut > maxBytes-utf8.UTFMax && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		if !utf8.RuneStart(data[cut]) {
+			cut = maxBytes // not a UTF-8 sequence, nothing to keep whole
+		}
+		data = data[:cut]
+	}
+	return strings.ToValidUTF8(string(data), string(utf8.RuneError)), truncated
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewClientTlsConfig returns the tls config verifying the server with the CA bundle of caFile, or with the system
+// CAs when it's empty, and presenting the client certificate of certFile and keyFile for mutual tls when they're set.
+// It returns nil when nothing is configured, which is the default verification of the system CAs.
+func NewClientTlsConfig(caFile string, certFile string, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("a client certificate and its key must be set together")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		caBundle, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA bundle: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle %s", caFile)
+		}
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,129 @@
+package utils_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a certificate signed by parent, or self signed when parent is nil, and its key as pem files
+func writeCertificate(t *testing.T, name string, isCa bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCa,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile, keyFile := path.Join(t.TempDir(), name+".crt"), path.Join(t.TempDir(), name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certificate, key, certFile, keyFile
+}
+
+func TestNewClientTlsConfigMutualTls(t *testing.T) {
+	ca, caKey, _, _ := writeCertificate(t, "client-ca", true, nil, nil)
+	_, _, certFile, keyFile := writeCertificate(t, "tapper", false, ca, caKey)
+
+	clientCas := x509.NewCertPool()
+	clientCas.AddCert(ca)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCas}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	serverCaFile := path.Join(t.TempDir(), "server-ca.crt")
+	ioutil.WriteFile(serverCaFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	tests := []struct {
+		name          string
+		certFile      string
+		keyFile       string
+		expectedError bool
+	}{
+		{name: "with client certificate", certFile: certFile, keyFile: keyFile, expectedError: false},
+		{name: "without client certificate", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := utils.NewClientTlsConfig(serverCaFile, test.certFile, test.keyFile, false)
+			if err != nil {
+				t.Fatalf("failed creating tls config: %v", err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+			response, err := client.Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err != nil) != test.expectedError {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestNewClientTlsConfig(t *testing.T) {
+	_, _, certFile, keyFile := writeCertificate(t, "tapper", true, nil, nil)
+	emptyFile := path.Join(t.TempDir(), "empty.crt")
+	ioutil.WriteFile(emptyFile, []byte("not a certificate"), 0600)
+
+	tests := []struct {
+		name               string
+		caFile             string
+		certFile           string
+		keyFile            string
+		insecureSkipVerify bool
+		expectedNil        bool
+		expectedError      bool
+	}{
+		{name: "nothing configured", expectedNil: true},
+		{name: "insecure skip verify", insecureSkipVerify: true},
+		{name: "ca bundle", caFile: certFile},
+		{name: "client certificate", certFile: certFile, keyFile: keyFile},
+		{name: "certificate without key", certFile: certFile, expectedNil: true, expectedError: true},
+		{name: "missing ca bundle", caFile: path.Join(t.TempDir(), "missing.crt"), expectedNil: true, expectedError: true},
+		{name: "empty ca bundle", caFile: emptyFile, expectedNil: true, expectedError: true},
+		{name: "invalid key", certFile: certFile, keyFile: emptyFile, expectedNil: true, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := utils.NewClientTlsConfig(test.caFile, test.certFile, test.keyFile, test.insecureSkipVerify)
+			if (err != nil) != test.expectedError || (tlsConfig == nil) != test.expectedNil {
+				t.Errorf("unexpected result - tls config: %v, err: %v", tlsConfig, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const pathParamPlaceholder = "{param}"
+
+var (
+	numericSegmentRegex = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegmentRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegmentRegex     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// NormalizePath strips the query string and replaces path segments that look like identifiers
+// (numbers, uuids, long hex strings) with a placeholder, so all calls to the same endpoint share a path
+func NormalizePath(path string) string {
+	if queryIndex := strings.IndexAny(path, "?#"); queryIndex != -1 {
+		path = path[:queryIndex]
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if numericSegmentRegex.MatchString(segment) || uuidSegmentRegex.MatchString(segment) || hexSegmentRegex.MatchString(segment) {
+			segments[i] = pathParamPlaceholder
+		}
+	}
+
+	normalizedPath := strings.Join(segments, "/")
+	if len(normalizedPath) > 1 {
+		normalizedPath = strings.TrimSuffix(normalizedPath, "/")
+	}
+	return normalizedPath
+}
+
+// GetEndpointKey identifies an endpoint by its method and normalized path
+func GetEndpointKey(method string, path string) string {
+	return fmt.Sprintf("%s %s", strings.ToUpper(method), NormalizePath(path))
+}
@@ -222,7 +222,26 @@ func NewResponse(response *api.GenericMessage) (harResponse *har.Response, err e
 	return
 }
 
+// hasHarDetails returns whether the message has the details of an http message, the entries of the other protocols
+// don't
+func hasHarDetails(message *api.GenericMessage) bool {
+	payload, ok := message.Payload.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	details, ok := payload["details"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = details["headers"].([]interface{})
+	return ok
+}
+
 func NewEntry(pair *api.RequestResponsePair) (*har.Entry, error) {
+	if !hasHarDetails(&pair.Request) || !hasHarDetails(&pair.Response) {
+		return nil, errors.New("the pair has no HTTP details to convert to HAR")
+	}
+
 	harRequest, err := NewRequest(&pair.Request)
 	if err != nil {
 		logger.Log.Errorf("Failed converting request to HAR %s (%v,%+v)", err, err, err)
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+	"golang.org/x/net/http/httpproxy"
+)
+
+var outboundTransport http.RoundTripper = http.DefaultTransport // global
+
+// InitOutboundProxy routes the requests of the outbound http clients through the configured proxy, the clients use the
+// proxy of the env vars when there's no config
+func InitOutboundProxy(proxyConfig *shared.OutboundProxyConfig) error {
+	if proxyConfig == nil {
+		outboundTransport = http.DefaultTransport
+		return nil
+	}
+	for _, proxyUrl := range []string{proxyConfig.HttpProxy, proxyConfig.HttpsProxy} {
+		if proxyUrl == "" {
+			continue
+		}
+		if parsedUrl, err := url.Parse(proxyUrl); err != nil || parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+			return fmt.Errorf("invalid outbound proxy url %s", proxyUrl)
+		}
+	}
+
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxyConfig.HttpProxy,
+		HTTPSProxy: proxyConfig.HttpsProxy,
+		NoProxy:    proxyConfig.NoProxy,
+	}).ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		return proxyFunc(request.URL)
+	}
+	outboundTransport = transport
+	return nil
+}
+
+// NewOutboundHttpClient returns a client for the requests the agent sends out of the cluster, a zero timeout means no
+// timeout
+func NewOutboundHttpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: outboundTransport, Timeout: timeout}
+}
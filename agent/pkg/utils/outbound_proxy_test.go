@@ -0,0 +1,76 @@
+package utils_test
+
+import (
+	"mizuserver/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/shared"
+)
+
+// startTestProxy answers the requests it proxies itself and records their urls
+func startTestProxy(t *testing.T) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var proxiedUrls []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lock.Lock()
+		proxiedUrls = append(proxiedUrls, request.URL.String())
+		lock.Unlock()
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), proxiedUrls...)
+	}
+}
+
+func TestOutboundProxy(t *testing.T) {
+	proxy, getProxiedUrls := startTestProxy(t)
+	if err := utils.InitOutboundProxy(&shared.OutboundProxyConfig{HttpProxy: proxy.URL, NoProxy: "direct.invalid"}); err != nil {
+		t.Fatalf("failed to init proxy: %v", err)
+	}
+	t.Cleanup(func() { utils.InitOutboundProxy(nil) })
+
+	client := utils.NewOutboundHttpClient(time.Second)
+	response, err := client.Get("http://trcc.up9.invalid/models/status")
+	if err != nil {
+		t.Fatalf("failed request: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected result - expected: %v, actual: %v", http.StatusNoContent, response.StatusCode)
+	}
+
+	// the hosts of NoProxy aren't proxied, the request fails since the host doesn't resolve
+	if _, err := client.Get("http://direct.invalid/"); err == nil {
+		t.Errorf("unexpected result - expected an error, actual: %v", err)
+	}
+	// https requests have no proxy configured
+	if _, err := client.Get("https://s3.invalid/"); err == nil {
+		t.Errorf("unexpected result - expected an error, actual: %v", err)
+	}
+
+	expectedUrls := []string{"http://trcc.up9.invalid/models/status"}
+	if proxiedUrls := getProxiedUrls(); len(proxiedUrls) != 1 || proxiedUrls[0] != expectedUrls[0] {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedUrls, proxiedUrls)
+	}
+}
+
+func TestInitOutboundProxyInvalid(t *testing.T) {
+	tests := []*shared.OutboundProxyConfig{
+		{HttpProxy: "proxy:3128"},
+		{HttpsProxy: "http://"},
+		{HttpProxy: "http://proxy:3128", HttpsProxy: "://proxy"},
+	}
+
+	for _, proxyConfig := range tests {
+		if err := utils.InitOutboundProxy(proxyConfig); err == nil {
+			t.Errorf("unexpected result - expected an error, actual: %v", proxyConfig)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+// StartupGrace quiets the errors expected while mizu starts, like tappers failing to reach an api server that isn't up yet.
+// Within the window such errors are logged at debug level, after it they are logged as warnings.
+type StartupGrace struct {
+	endsAt time.Time
+}
+
+func NewStartupGrace(window time.Duration) *StartupGrace {
+	return &StartupGrace{endsAt: time.Now().Add(window)}
+}
+
+func (grace *StartupGrace) IsActive() bool {
+	return time.Now().Before(grace.endsAt)
+}
+
+func (grace *StartupGrace) Warningf(format string, args ...interface{}) {
+	if grace.IsActive() {
+		logger.Log.Debugf(format, args...)
+		return
+	}
+	logger.Log.Warningf(format, args...)
+}
@@ -0,0 +1,53 @@
+package utils_test
+
+import (
+	"bytes"
+	"mizuserver/pkg/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var logOutput bytes.Buffer
+	logging.SetBackend(logging.NewBackendFormatter(logging.NewLogBackend(&logOutput, "", 0), logging.MustStringFormatter("%{level} %{message}")))
+	logging.SetLevel(logging.DEBUG, "")
+	t.Cleanup(func() { logger.InitLoggerStderrOnly(logging.INFO) })
+	return &logOutput
+}
+
+func TestStartupGraceLogLevels(t *testing.T) {
+	logOutput := captureLogs(t)
+
+	grace := utils.NewStartupGrace(50 * time.Millisecond)
+	if !grace.IsActive() {
+		t.Fatalf("expected the grace window to be active")
+	}
+	grace.Warningf("connection failed %d", 1)
+
+	time.Sleep(60 * time.Millisecond)
+	if grace.IsActive() {
+		t.Fatalf("expected the grace window to be over")
+	}
+	grace.Warningf("connection failed %d", 2)
+
+	expected := []string{
+		"DEBUG connection failed 1",
+		"WARNING connection failed 2",
+	}
+	if actual := strings.Split(strings.TrimSpace(logOutput.String()), "\n"); strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestStartupGraceWithoutWindow(t *testing.T) {
+	logOutput := captureLogs(t)
+
+	utils.NewStartupGrace(0).Warningf("connection failed")
+	if actual := strings.TrimSpace(logOutput.String()); actual != "WARNING connection failed" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "WARNING connection failed", actual)
+	}
+}
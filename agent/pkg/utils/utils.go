@@ -2,12 +2,13 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
 	"reflect"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -16,32 +17,61 @@ import (
 	"github.com/up9inc/mizu/shared/logger"
 )
 
-// StartServer starts the server with a graceful shutdown
-func StartServer(app *gin.Engine) {
-	signals := make(chan os.Signal, 2)
-	signal.Notify(signals,
-		os.Interrupt,    // this catch ctrl + c
-		syscall.SIGTSTP, // this catch ctrl + z
-	)
+const serverShutdownTimeout = 5 * time.Second
 
+// StartServer serves the app on host and port until ctx is done, it returns once the server was shut down gracefully.
+// The server listens on all the interfaces when host is empty and on the default api server port when port is 0.
+func StartServer(ctx context.Context, app *gin.Engine, host string, port int) error {
+	if err := ValidateServerPort(port); err != nil {
+		return err
+	}
+	if port == 0 {
+		port = shared.DefaultApiServerPort
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", address)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return fmt.Errorf("the address %s is already in use, another agent may be running on the port, configure another one with --port", address)
+	} else if err != nil {
+		return fmt.Errorf("failed listening on %s: %v", address, err)
+	}
+	return ServeListener(ctx, app, listener)
+}
+
+// ServeListener serves the app on the listener until ctx is done, it returns once the server was shut down gracefully
+func ServeListener(ctx context.Context, app *gin.Engine, listener net.Listener) error {
 	srv := &http.Server{
-		Addr:    ":8080",
 		Handler: app,
 	}
 
+	serverShutDown := make(chan struct{})
 	go func() {
-		_ = <-signals
+		defer close(serverShutDown)
+		<-ctx.Done()
 		logger.Log.Infof("Shutting down...")
-		ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-		_ = srv.Shutdown(ctx)
-		os.Exit(0)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Errorf("Failed shutting down the server gracefully: %v", err)
+		}
 	}()
 
 	// Run server.
-	logger.Log.Infof("Starting the server...")
-	if err := app.Run(fmt.Sprintf(":%d", shared.DefaultApiServerPort)); err != nil {
-		logger.Log.Errorf("Server is not running! Reason: %v", err)
+	logger.Log.Infof("Starting the server on %s...", listener.Addr())
+	if err := srv.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("server is not running: %v", err)
+	}
+	<-serverShutDown
+	return nil
+}
+
+// ValidateServerPort accepts the tcp ports and 0, which stands for the default api server port
+func ValidateServerPort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("invalid server port %d, expected a port between 1 and 65535", port)
 	}
+	return nil
 }
 
 func ReverseSlice(data interface{}) {
@@ -0,0 +1,92 @@
+package utils_test
+
+import (
+	"context"
+	"io/ioutil"
+	"mizuserver/pkg/utils"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newEchoApp() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	app.GET("/echo", func(c *gin.Context) {
+		c.String(http.StatusOK, "Here is Mizu agent")
+	})
+	return app
+}
+
+func TestServeListenerEphemeralPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	serverStopped := make(chan error, 1)
+	go func() { serverStopped <- utils.ServeListener(ctx, newEchoApp(), listener) }()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	response, err := client.Get("http://" + listener.Addr().String() + "/echo")
+	if err != nil {
+		t.Fatalf("failed to get /echo: %v", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(body) != "Here is Mizu agent" {
+		t.Errorf("unexpected result - expected: %v, actual: %v %s", http.StatusOK, response.StatusCode, body)
+	}
+
+	cancel()
+	select {
+	case err := <-serverStopped:
+		if err != nil {
+			t.Errorf("unexpected result - expected: %v, actual: %v", nil, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the server wasn't shut down")
+	}
+}
+
+func TestStartServerAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	err = utils.StartServer(context.Background(), newEchoApp(), "127.0.0.1", port)
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "address already in use", err)
+	}
+}
+
+func TestValidateServerPort(t *testing.T) {
+	tests := []struct {
+		port          int
+		expectedError bool
+	}{
+		{port: 0},
+		{port: 1},
+		{port: 8899},
+		{port: 65535},
+		{port: -1, expectedError: true},
+		{port: 65536, expectedError: true},
+	}
+
+	for _, test := range tests {
+		if err := utils.ValidateServerPort(test.port); (err != nil) != test.expectedError {
+			t.Errorf("unexpected result for %d - expected error: %v, actual: %v", test.port, test.expectedError, err)
+		}
+	}
+
+	if err := utils.StartServer(context.Background(), newEchoApp(), "", 70000); err == nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "an invalid port error", err)
+	}
+}
@@ -6,3 +6,9 @@ var (
 	GitCommitHash  = "" // this var is overridden using ldflags in makefile when building
 	BuildTimestamp = "" // this var is overridden using ldflags in makefile when building
 )
+
+// the range of the web socket message protocol versions the agent can talk, bumped on breaking message changes
+const (
+	MinWebSocketProtocolVersion = 1
+	MaxWebSocketProtocolVersion = 1
+)
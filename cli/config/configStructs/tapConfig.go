@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/kubernetes"
 	"regexp"
 
 	"github.com/up9inc/mizu/shared/units"
@@ -22,28 +23,31 @@ const (
 	EnforcePolicyFile             = "traffic-validation-file"
 	ContractFile                  = "contract"
 	DaemonModeTapName             = "daemon"
+	PodLabelSelectorTapName       = "selector"
 )
 
 type TapConfig struct {
-	UploadIntervalSec      int              `yaml:"upload-interval" default:"10"`
-	PodRegexStr            string           `yaml:"regex" default:".*"`
-	GuiPort                uint16           `yaml:"gui-port" default:"8899"`
-	ProxyHost              string           `yaml:"proxy-host" default:"127.0.0.1"`
-	Namespaces             []string         `yaml:"namespaces"`
-	Analysis               bool             `yaml:"analysis" default:"false"`
-	AllNamespaces          bool             `yaml:"all-namespaces" default:"false"`
-	PlainTextFilterRegexes []string         `yaml:"regex-masking"`
-	IgnoredUserAgents      []string         `yaml:"ignored-user-agents"`
-	DisableRedaction       bool             `yaml:"no-redact" default:"false"`
-	HumanMaxEntriesDBSize  string           `yaml:"max-entries-db-size" default:"200MB"`
-	DryRun                 bool             `yaml:"dry-run" default:"false"`
-	Workspace              string           `yaml:"workspace"`
-	EnforcePolicyFile      string           `yaml:"traffic-validation-file"`
-	ContractFile           string           `yaml:"contract"`
-	AskUploadConfirmation  bool             `yaml:"ask-upload-confirmation" default:"true"`
-	ApiServerResources     shared.Resources `yaml:"api-server-resources"`
-	TapperResources        shared.Resources `yaml:"tapper-resources"`
-	DaemonMode             bool             `yaml:"daemon" default:"false"`
+	UploadIntervalSec      int               `yaml:"upload-interval" default:"10"`
+	PodRegexStr            string            `yaml:"regex" default:".*"`
+	GuiPort                uint16            `yaml:"gui-port" default:"8899"`
+	ProxyHost              string            `yaml:"proxy-host" default:"127.0.0.1"`
+	Namespaces             []string          `yaml:"namespaces"`
+	Analysis               bool              `yaml:"analysis" default:"false"`
+	AllNamespaces          bool              `yaml:"all-namespaces" default:"false"`
+	PlainTextFilterRegexes []string          `yaml:"regex-masking"`
+	IgnoredUserAgents      []string          `yaml:"ignored-user-agents"`
+	DisableRedaction       bool              `yaml:"no-redact" default:"false"`
+	HumanMaxEntriesDBSize  string            `yaml:"max-entries-db-size" default:"200MB"`
+	DryRun                 bool              `yaml:"dry-run" default:"false"`
+	Workspace              string            `yaml:"workspace"`
+	EnforcePolicyFile      string            `yaml:"traffic-validation-file"`
+	ContractFile           string            `yaml:"contract"`
+	AskUploadConfirmation  bool              `yaml:"ask-upload-confirmation" default:"true"`
+	ApiServerResources     shared.Resources  `yaml:"api-server-resources"`
+	TapperResources        shared.Resources  `yaml:"tapper-resources"`
+	DaemonMode             bool              `yaml:"daemon" default:"false"`
+	ExtensionPortOwners    map[string]string `yaml:"extension-port-owners"`
+	PodLabelSelector       string            `yaml:"selector"`
 }
 
 func (config *TapConfig) PodRegex() *regexp.Regexp {
@@ -62,6 +66,10 @@ func (config *TapConfig) Validate() error {
 		return errors.New(fmt.Sprintf("%s is not a valid regex %s", config.PodRegexStr, compileErr))
 	}
 
+	if _, err := kubernetes.ParsePodLabelSelector(config.PodLabelSelector); err != nil {
+		return err
+	}
+
 	_, parseHumanDataSizeErr := units.HumanReadableToBytes(config.HumanMaxEntriesDBSize)
 	if parseHumanDataSizeErr != nil {
 		return errors.New(fmt.Sprintf("Could not parse --%s value %s", HumanMaxEntriesDBSizeTapName, config.HumanMaxEntriesDBSize))
@@ -1,4 +1,5 @@
 #!/bin/bash
+set -e # a failing extension fails the build, not only the last one
 
 for f in tap/extensions/*; do
     if [ -d "$f" ]; then
@@ -14,4 +14,8 @@ const (
 	GoGCEnvVar                       = "GOGC"
 	DefaultApiServerPort             = 8899
 	DebugModeEnvVar                  = "MIZU_DEBUG"
+	StartupGraceWindowMsEnvVar       = "STARTUP_GRACE_WINDOW_MS"
+	WebSocketEncodingEnvVar          = "WEBSOCKET_ENCODING"
+	SocketMaxRetryDelayMsEnvVar      = "SOCKET_MAX_RETRY_DELAY_MS"
+	WebSocketCompressionEnvVar       = "WEBSOCKET_COMPRESSION"
 )
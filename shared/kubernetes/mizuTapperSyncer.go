@@ -8,6 +8,7 @@ import (
 	"github.com/up9inc/mizu/shared/logger"
 	"github.com/up9inc/mizu/tap/api"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"regexp"
 	"time"
 )
@@ -24,6 +25,8 @@ type MizuTapperSyncer struct {
 	context             context.Context
 	CurrentlyTappedPods []core.Pod
 	config              TapperSyncerConfig
+	tapTargetRuleSet    *TapTargetRuleSet
+	podLabelSelector    labels.Selector
 	kubernetesProvider  *Provider
 	TapPodChangesOut    chan TappedPodChangeEvent
 	ErrorOut            chan K8sTapManagerError
@@ -32,6 +35,7 @@ type MizuTapperSyncer struct {
 type TapperSyncerConfig struct {
 	TargetNamespaces         []string
 	PodFilterRegex           regexp.Regexp
+	PodLabelSelector         string // labels of the pods to tap, e.g. app=orders, the pods have to match the regex too
 	MizuResourcesNamespace   string
 	AgentImage               string
 	TapperResources          shared.Resources
@@ -40,6 +44,7 @@ type TapperSyncerConfig struct {
 	IgnoredUserAgents        []string
 	MizuApiFilteringOptions  api.TrafficFilteringOptions
 	MizuServiceAccountExists bool
+	TapTargetRules           *shared.TapTargetRules
 }
 
 func CreateAndStartMizuTapperSyncer(ctx context.Context, kubernetesProvider *Provider, config TapperSyncerConfig) (*MizuTapperSyncer, error) {
@@ -52,6 +57,20 @@ func CreateAndStartMizuTapperSyncer(ctx context.Context, kubernetesProvider *Pro
 		ErrorOut:            make(chan K8sTapManagerError, 100),
 	}
 
+	podLabelSelector, err := ParsePodLabelSelector(config.PodLabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	syncer.podLabelSelector = podLabelSelector
+
+	if config.TapTargetRules != nil {
+		ruleSet, err := NewTapTargetRuleSet(config.TapTargetRules)
+		if err != nil {
+			return nil, err
+		}
+		syncer.tapTargetRuleSet = ruleSet
+	}
+
 	if err, _ := syncer.updateCurrentlyTappedPods(); err != nil {
 		return nil, err
 	}
@@ -65,7 +84,7 @@ func CreateAndStartMizuTapperSyncer(ctx context.Context, kubernetesProvider *Pro
 }
 
 func (tapperSyncer *MizuTapperSyncer) watchPodsForTapping() {
-	added, modified, removed, errorChan := FilteredWatch(tapperSyncer.context, tapperSyncer.kubernetesProvider, tapperSyncer.config.TargetNamespaces, &tapperSyncer.config.PodFilterRegex)
+	added, modified, removed, errorChan := FilteredWatch(tapperSyncer.context, tapperSyncer.kubernetesProvider, tapperSyncer.config.TargetNamespaces, &tapperSyncer.config.PodFilterRegex, tapperSyncer.podLabelSelector)
 
 	restartTappers := func() {
 		err, changeFound := tapperSyncer.updateCurrentlyTappedPods()
@@ -146,10 +165,19 @@ func (tapperSyncer *MizuTapperSyncer) watchPodsForTapping() {
 }
 
 func (tapperSyncer *MizuTapperSyncer) updateCurrentlyTappedPods() (err error, changesFound bool) {
-	if matchingPods, err := tapperSyncer.kubernetesProvider.ListAllRunningPodsMatchingRegex(tapperSyncer.context, &tapperSyncer.config.PodFilterRegex, tapperSyncer.config.TargetNamespaces); err != nil {
+	if matchingPods, err := tapperSyncer.kubernetesProvider.ListAllRunningPodsMatching(tapperSyncer.context, &tapperSyncer.config.PodFilterRegex, tapperSyncer.podLabelSelector, tapperSyncer.config.TargetNamespaces); err != nil {
 		return err, false
 	} else {
 		podsToTap := excludeMizuPods(matchingPods)
+		if tapperSyncer.tapTargetRuleSet != nil {
+			var services []core.Service
+			if tapperSyncer.tapTargetRuleSet.UsesServices() {
+				if services, err = tapperSyncer.kubernetesProvider.ListAllServices(tapperSyncer.context, tapperSyncer.config.TargetNamespaces); err != nil {
+					return err, false
+				}
+			}
+			podsToTap = tapperSyncer.tapTargetRuleSet.Filter(podsToTap, services)
+		}
 		addedPods, removedPods := getPodArrayDiff(tapperSyncer.CurrentlyTappedPods, podsToTap)
 		for _, addedPod := range addedPods {
 			logger.Log.Debugf("tapping new pod %s", addedPod.Name)
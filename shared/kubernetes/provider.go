@@ -17,6 +17,7 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/version"
@@ -150,8 +151,8 @@ func (provider *Provider) WaitUtilNamespaceDeleted(ctx context.Context, name str
 	return err
 }
 
-func (provider *Provider) GetPodWatcher(ctx context.Context, namespace string) watch.Interface {
-	watcher, err := provider.clientSet.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{Watch: true})
+func (provider *Provider) GetPodWatcher(ctx context.Context, namespace string, labelSelector labels.Selector) watch.Interface {
+	watcher, err := provider.clientSet.CoreV1().Pods(namespace).Watch(ctx, getPodListOptions(labelSelector, true))
 	if err != nil {
 		panic(err.Error())
 	}
@@ -764,9 +765,15 @@ func (provider *Provider) ApplyMizuTapperDaemonSet(ctx context.Context, namespac
 }
 
 func (provider *Provider) ListAllPodsMatchingRegex(ctx context.Context, regex *regexp.Regexp, namespaces []string) ([]core.Pod, error) {
+	return provider.ListAllPodsMatching(ctx, regex, nil, namespaces)
+}
+
+// ListAllPodsMatching returns the pods of all the namespaces whose name matches the regex and whose labels match the
+// selector, the selector is sent with the list requests so only the matching pods are listed
+func (provider *Provider) ListAllPodsMatching(ctx context.Context, regex *regexp.Regexp, labelSelector labels.Selector, namespaces []string) ([]core.Pod, error) {
 	var pods []core.Pod
 	for _, namespace := range namespaces {
-		namespacePods, err := provider.clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		namespacePods, err := provider.clientSet.CoreV1().Pods(namespace).List(ctx, getPodListOptions(labelSelector, false))
 		if err != nil {
 			return nil, fmt.Errorf("failed to get pods in ns: [%s], %w", namespace, err)
 		}
@@ -776,15 +783,36 @@ func (provider *Provider) ListAllPodsMatchingRegex(ctx context.Context, regex *r
 
 	matchingPods := make([]core.Pod, 0)
 	for _, pod := range pods {
-		if regex.MatchString(pod.Name) {
+		if IsPodMatching(&pod, regex, labelSelector) {
 			matchingPods = append(matchingPods, pod)
 		}
 	}
 	return matchingPods, nil
 }
 
-func (provider *Provider) ListAllRunningPodsMatchingRegex(ctx context.Context, regex *regexp.Regexp, namespaces []string) ([]core.Pod, error) {
-	pods, err := provider.ListAllPodsMatchingRegex(ctx, regex, namespaces)
+func getPodListOptions(labelSelector labels.Selector, isWatch bool) metav1.ListOptions {
+	listOptions := metav1.ListOptions{Watch: isWatch}
+	if labelSelector != nil {
+		listOptions.LabelSelector = labelSelector.String()
+	}
+	return listOptions
+}
+
+func (provider *Provider) ListAllServices(ctx context.Context, namespaces []string) ([]core.Service, error) {
+	var services []core.Service
+	for _, namespace := range namespaces {
+		namespaceServices, err := provider.clientSet.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get services in ns: [%s], %w", namespace, err)
+		}
+
+		services = append(services, namespaceServices.Items...)
+	}
+	return services, nil
+}
+
+func (provider *Provider) ListAllRunningPodsMatching(ctx context.Context, regex *regexp.Regexp, labelSelector labels.Selector, namespaces []string) ([]core.Pod, error) {
+	pods, err := provider.ListAllPodsMatching(ctx, regex, labelSelector, namespaces)
 	if err != nil {
 		return nil, err
 	}
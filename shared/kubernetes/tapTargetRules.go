@@ -0,0 +1,136 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/up9inc/mizu/shared"
+	core "k8s.io/api/core/v1"
+)
+
+type compiledTapTargetPredicate struct {
+	predicate shared.TapTargetPredicate
+	nameRegex *regexp.Regexp
+}
+
+// TapTargetRuleSet evaluates shared.TapTargetRules against pods
+type TapTargetRuleSet struct {
+	include []compiledTapTargetPredicate
+	exclude []compiledTapTargetPredicate
+}
+
+func NewTapTargetRuleSet(rules *shared.TapTargetRules) (*TapTargetRuleSet, error) {
+	include, err := compileTapTargetPredicates(rules.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileTapTargetPredicates(rules.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &TapTargetRuleSet{include: include, exclude: exclude}, nil
+}
+
+func compileTapTargetPredicates(predicates []shared.TapTargetPredicate) ([]compiledTapTargetPredicate, error) {
+	compiled := make([]compiledTapTargetPredicate, 0)
+	for _, predicate := range predicates {
+		compiledPredicate := compiledTapTargetPredicate{predicate: predicate}
+		if predicate.NameRegex != "" {
+			nameRegex, err := regexp.Compile(predicate.NameRegex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tap target name regex %s: %w", predicate.NameRegex, err)
+			}
+			compiledPredicate.nameRegex = nameRegex
+		}
+		compiled = append(compiled, compiledPredicate)
+	}
+	return compiled, nil
+}
+
+// UsesServices is true when evaluating the rules requires the services of the target namespaces
+func (ruleSet *TapTargetRuleSet) UsesServices() bool {
+	for _, predicate := range append(ruleSet.include, ruleSet.exclude...) {
+		if len(predicate.predicate.Services) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the pods that match any include predicate and no exclude predicate
+func (ruleSet *TapTargetRuleSet) Filter(pods []core.Pod, services []core.Service) []core.Pod {
+	matchingPods := make([]core.Pod, 0)
+	for _, pod := range pods {
+		if ruleSet.isIncluded(&pod, services) && !matchesAnyPredicate(ruleSet.exclude, &pod, services) {
+			matchingPods = append(matchingPods, pod)
+		}
+	}
+	return matchingPods
+}
+
+// GetTapTargetIps returns the ips of the pods selected by the rules
+func (ruleSet *TapTargetRuleSet) GetTapTargetIps(pods []core.Pod, services []core.Service) []string {
+	ips := make([]string, 0)
+	for _, pod := range ruleSet.Filter(pods, services) {
+		if pod.Status.PodIP != "" {
+			ips = append(ips, pod.Status.PodIP)
+		}
+	}
+	return ips
+}
+
+func (ruleSet *TapTargetRuleSet) isIncluded(pod *core.Pod, services []core.Service) bool {
+	return len(ruleSet.include) == 0 || matchesAnyPredicate(ruleSet.include, pod, services)
+}
+
+func matchesAnyPredicate(predicates []compiledTapTargetPredicate, pod *core.Pod, services []core.Service) bool {
+	for _, predicate := range predicates {
+		if predicate.matches(pod, services) {
+			return true
+		}
+	}
+	return false
+}
+
+func (predicate *compiledTapTargetPredicate) matches(pod *core.Pod, services []core.Service) bool {
+	if len(predicate.predicate.Namespaces) > 0 && !shared.Contains(predicate.predicate.Namespaces, pod.Namespace) {
+		return false
+	}
+	if predicate.nameRegex != nil && !predicate.nameRegex.MatchString(pod.Name) {
+		return false
+	}
+	if !isSubset(predicate.predicate.Labels, pod.Labels) {
+		return false
+	}
+	if !isSubset(predicate.predicate.Annotations, pod.Annotations) {
+		return false
+	}
+	if len(predicate.predicate.Services) > 0 && !isSelectedByAnyService(predicate.predicate.Services, pod, services) {
+		return false
+	}
+	return true
+}
+
+func isSelectedByAnyService(serviceNames []string, pod *core.Pod, services []core.Service) bool {
+	for _, service := range services {
+		if service.Namespace != pod.Namespace || len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if !shared.Contains(serviceNames, service.Name) && !shared.Contains(serviceNames, fmt.Sprintf("%s/%s", service.Namespace, service.Name)) {
+			continue
+		}
+		if isSubset(service.Spec.Selector, pod.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubset(required map[string]string, actual map[string]string) bool {
+	for key, value := range required {
+		if actualValue, ok := actual[key]; !ok || actualValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package kubernetes_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/up9inc/mizu/shared"
+	"github.com/up9inc/mizu/shared/kubernetes"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPod(namespace string, name string, ip string, labels map[string]string, annotations map[string]string) core.Pod {
+	return core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels, Annotations: annotations},
+		Status:     core.PodStatus{PodIP: ip},
+	}
+}
+
+var tapTargetTestPods = []core.Pod{
+	newTestPod("a", "frontend-1", "10.0.0.1", map[string]string{"app": "frontend"}, nil),
+	newTestPod("a", "frontend-canary", "10.0.0.2", map[string]string{"app": "frontend", "no-tap": "true"}, nil),
+	newTestPod("a", "batch-job", "10.0.0.3", map[string]string{"app": "batch"}, map[string]string{"mizu/ignore": "true"}),
+	newTestPod("b", "orders-1", "10.0.1.1", map[string]string{"app": "orders"}, nil),
+	newTestPod("b", "orders-2", "10.0.1.2", map[string]string{"app": "orders", "no-tap": "true"}, nil),
+	newTestPod("b", "payments-1", "10.0.1.3", map[string]string{"app": "payments"}, nil),
+	newTestPod("c", "orders-1", "10.0.2.1", map[string]string{"app": "orders"}, nil),
+}
+
+var tapTargetTestServices = []core.Service{
+	{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "orders"}, Spec: core.ServiceSpec{Selector: map[string]string{"app": "orders"}}},
+	{ObjectMeta: metav1.ObjectMeta{Namespace: "c", Name: "orders"}, Spec: core.ServiceSpec{Selector: map[string]string{"app": "orders"}}},
+}
+
+func TestTapTargetRuleSetGetTapTargetIps(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       shared.TapTargetRules
+		expectedIps []string
+	}{
+		{
+			name:        "no rules",
+			rules:       shared.TapTargetRules{},
+			expectedIps: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.2.1"},
+		},
+		{
+			name: "namespace except label plus service",
+			rules: shared.TapTargetRules{
+				Include: []shared.TapTargetPredicate{{Namespaces: []string{"a"}}, {Services: []string{"b/orders"}}},
+				Exclude: []shared.TapTargetPredicate{{Labels: map[string]string{"no-tap": "true"}}},
+			},
+			expectedIps: []string{"10.0.0.1", "10.0.0.3", "10.0.1.1"},
+		},
+		{
+			name: "exclude wins over overlapping include",
+			rules: shared.TapTargetRules{
+				Include: []shared.TapTargetPredicate{{NameRegex: "^frontend"}, {Labels: map[string]string{"app": "frontend"}}},
+				Exclude: []shared.TapTargetPredicate{{Namespaces: []string{"a"}, NameRegex: "canary"}},
+			},
+			expectedIps: []string{"10.0.0.1"},
+		},
+		{
+			name: "unqualified service name matches all namespaces",
+			rules: shared.TapTargetRules{
+				Include: []shared.TapTargetPredicate{{Services: []string{"orders"}}},
+			},
+			expectedIps: []string{"10.0.1.1", "10.0.1.2", "10.0.2.1"},
+		},
+		{
+			name: "exclude only",
+			rules: shared.TapTargetRules{
+				Exclude: []shared.TapTargetPredicate{{Annotations: map[string]string{"mizu/ignore": "true"}}, {Namespaces: []string{"b", "c"}}},
+			},
+			expectedIps: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name: "all conditions of a predicate must match",
+			rules: shared.TapTargetRules{
+				Include: []shared.TapTargetPredicate{{Namespaces: []string{"b"}, Labels: map[string]string{"app": "payments"}}},
+			},
+			expectedIps: []string{"10.0.1.3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ruleSet, err := kubernetes.NewTapTargetRuleSet(&test.rules)
+			if err != nil {
+				t.Fatalf("failed to create rule set: %v", err)
+			}
+
+			ips := ruleSet.GetTapTargetIps(tapTargetTestPods, tapTargetTestServices)
+			sort.Strings(ips)
+			if !reflect.DeepEqual(ips, test.expectedIps) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedIps, ips)
+			}
+		})
+	}
+}
+
+func TestNewTapTargetRuleSetInvalidRegex(t *testing.T) {
+	_, err := kubernetes.NewTapTargetRuleSet(&shared.TapTargetRules{Exclude: []shared.TapTargetPredicate{{NameRegex: "("}}})
+	if err == nil {
+		t.Errorf("expected an error for an invalid name regex")
+	}
+}
@@ -1,8 +1,10 @@
 package kubernetes
 
 import (
+	"fmt"
 	"github.com/up9inc/mizu/shared"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"regexp"
 )
 
@@ -19,6 +21,25 @@ func GetNodeHostToTappedPodIpsMap(tappedPods []core.Pod) map[string][]string {
 	return nodeToTappedPodIPMap
 }
 
+// ParsePodLabelSelector parses a selector of the kubectl syntax, e.g. app=orders,tier!=cache, an empty selector matches
+// every pod
+func ParsePodLabelSelector(selector string) (labels.Selector, error) {
+	parsedSelector, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid label selector: %w", selector, err)
+	}
+	return parsedSelector, nil
+}
+
+// IsPodMatching returns whether the name of the pod matches the regex and its labels match the selector, a nil
+// selector matches every pod
+func IsPodMatching(pod *core.Pod, regex *regexp.Regexp, selector labels.Selector) bool {
+	if !regex.MatchString(pod.Name) {
+		return false
+	}
+	return selector == nil || selector.Matches(labels.Set(pod.Labels))
+}
+
 func excludeMizuPods(pods []core.Pod) []core.Pod {
 	mizuPrefixRegex := regexp.MustCompile("^" + MizuResourcesPrefix)
 
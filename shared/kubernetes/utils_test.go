@@ -0,0 +1,82 @@
+package kubernetes_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/up9inc/mizu/shared/kubernetes"
+)
+
+func TestParsePodLabelSelector(t *testing.T) {
+	tests := []struct {
+		selector      string
+		expected      string
+		expectedError bool
+	}{
+		{selector: "", expected: ""},
+		{selector: "app=orders", expected: "app=orders"},
+		{selector: "app in (orders, payments),no-tap!=true", expected: "app in (orders,payments),no-tap!=true"},
+		{selector: "!no-tap", expected: "!no-tap"},
+		{selector: "app=orders=1", expectedError: true},
+		{selector: "app in orders", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			selector, err := kubernetes.ParsePodLabelSelector(test.selector)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("unexpected result - expected: an error, actual: %v", selector)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", test.selector, err)
+			}
+			if selector.String() != test.expected {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, selector.String())
+			}
+		})
+	}
+}
+
+func TestIsPodMatching(t *testing.T) {
+	tests := []struct {
+		name          string
+		regex         string
+		labelSelector string
+		expectedPods  []string
+	}{
+		{name: "regex", regex: "^orders", expectedPods: []string{"b/orders-1", "b/orders-2", "c/orders-1"}},
+		{name: "selector", regex: ".*", labelSelector: "app in (frontend, payments)", expectedPods: []string{"a/frontend-1", "a/frontend-canary", "b/payments-1"}},
+		{name: "regex and selector", regex: "^orders", labelSelector: "no-tap!=true", expectedPods: []string{"b/orders-1", "c/orders-1"}},
+		{name: "no pod matches both", regex: "^frontend", labelSelector: "app=orders", expectedPods: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selector, err := kubernetes.ParsePodLabelSelector(test.labelSelector)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", test.labelSelector, err)
+			}
+
+			var actualPods []string
+			for _, pod := range tapTargetTestPods {
+				if kubernetes.IsPodMatching(&pod, regexp.MustCompile(test.regex), selector) {
+					actualPods = append(actualPods, pod.Namespace+"/"+pod.Name)
+				}
+			}
+			if !reflect.DeepEqual(actualPods, test.expectedPods) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedPods, actualPods)
+			}
+		})
+	}
+}
+
+func TestIsPodMatchingWithoutSelector(t *testing.T) {
+	pod := tapTargetTestPods[0]
+	if !kubernetes.IsPodMatching(&pod, regexp.MustCompile(".*"), nil) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", true, false)
+	}
+}
@@ -12,11 +12,16 @@ import (
 type WebSocketMessageType string
 
 const (
-	WebSocketMessageTypeEntry         WebSocketMessageType = "entry"
-	WebSocketMessageTypeTappedEntry   WebSocketMessageType = "tappedEntry"
-	WebSocketMessageTypeUpdateStatus  WebSocketMessageType = "status"
-	WebSocketMessageTypeAnalyzeStatus WebSocketMessageType = "analyzeStatus"
-	WebsocketMessageTypeOutboundLink  WebSocketMessageType = "outboundLink"
+	WebSocketMessageTypeEntry              WebSocketMessageType = "entry"
+	WebSocketMessageTypeTappedEntry        WebSocketMessageType = "tappedEntry"
+	WebSocketMessageTypeUpdateStatus       WebSocketMessageType = "status"
+	WebSocketMessageTypeAnalyzeStatus      WebSocketMessageType = "analyzeStatus"
+	WebsocketMessageTypeOutboundLink       WebSocketMessageType = "outboundLink"
+	WebSocketMessageTypeStreamInterruption WebSocketMessageType = "streamInterruption"
+	WebSocketMessageTypeEntryBatch         WebSocketMessageType = "entryBatch"
+	WebSocketMessageTypeEntryReference     WebSocketMessageType = "entryReference"
+	WebSocketMessageTypeTappedEntryAck     WebSocketMessageType = "tappedEntryAck"
+	WebSocketMessageTypeSchemaHandshake    WebSocketMessageType = "schemaHandshake"
 )
 
 type Resources struct {
@@ -27,22 +32,330 @@ type Resources struct {
 }
 
 type MizuAgentConfig struct {
-	TapTargetRegex          api.SerializableRegexp      `json:"tapTargetRegex"`
-	MaxDBSizeBytes          int64                       `json:"maxDBSizeBytes"`
-	DaemonMode              bool                        `json:"daemonMode"`
-	TargetNamespaces        []string                    `json:"targetNamespaces"`
-	AgentImage              string                      `json:"agentImage"`
-	PullPolicy              string                      `json:"pullPolicy"`
-	DumpLogs                bool                        `json:"dumpLogs"`
-	IgnoredUserAgents       []string                    `json:"ignoredUserAgents"`
-	TapperResources         Resources                   `json:"tapperResources"`
-	MizuResourcesNamespace  string                      `json:"mizuResourceNamespace"`
-	MizuApiFilteringOptions api.TrafficFilteringOptions `json:"mizuApiFilteringOptions"`
-	AgentDatabasePath       string                      `json:"agentDatabasePath"`
+	TapTargetRegex             api.SerializableRegexp      `json:"tapTargetRegex"`
+	MaxDBSizeBytes             int64                       `json:"maxDBSizeBytes"`
+	DaemonMode                 bool                        `json:"daemonMode"`
+	TargetNamespaces           []string                    `json:"targetNamespaces"`
+	AgentImage                 string                      `json:"agentImage"`
+	PullPolicy                 string                      `json:"pullPolicy"`
+	DumpLogs                   bool                        `json:"dumpLogs"`
+	IgnoredUserAgents          []string                    `json:"ignoredUserAgents"`
+	TapperResources            Resources                   `json:"tapperResources"`
+	MizuResourcesNamespace     string                      `json:"mizuResourceNamespace"`
+	MizuApiFilteringOptions    api.TrafficFilteringOptions `json:"mizuApiFilteringOptions"`
+	AgentDatabasePath          string                      `json:"agentDatabasePath"`
+	AdminToken                 string                      `json:"adminToken"`
+	WebSocketToken             string                      `json:"webSocketToken"` // the bearer token of the websocket clients, the tappers included, open access when empty. The UI passes on the ?token= it was opened with
+	FirstSeenOnly              bool                        `json:"firstSeenOnly"`
+	ResponseBodiesOnError      bool                        `json:"responseBodiesOnError"`
+	EndpointSampling           *EndpointSamplingConfig     `json:"endpointSampling,omitempty"`
+	ResponseSampling           *ResponseSamplingConfig     `json:"responseSampling,omitempty"`
+	SyslogSink                 *SyslogSinkConfig           `json:"syslogSink,omitempty"`
+	MemoryLimitBytes           int64                       `json:"memoryLimitBytes"`
+	EntryBroadcastBatching     *EntryBroadcastBatchConfig  `json:"entryBroadcastBatching,omitempty"`
+	EntriesQueryTimeoutMs      int                         `json:"entriesQueryTimeoutMs"`
+	TapTargetRules             *TapTargetRules             `json:"tapTargetRules,omitempty"`
+	NamespaceSampling          *NamespaceSamplingConfig    `json:"namespaceSampling,omitempty"`
+	EntryDeduplicationWindowMs int                         `json:"entryDeduplicationWindowMs"`
+	Pushgateway                *PushgatewayConfig          `json:"pushgateway,omitempty"`
+	EntryPreviewBytes          int                         `json:"entryPreviewBytes"`
+	ProtocolDirections         map[string]CaptureDirection `json:"protocolDirections"`
+	HarImport                  *HarImportConfig            `json:"harImport,omitempty"`
+	ScheduledExports           []ScheduledExportConfig     `json:"scheduledExports"`
+	PortLabels                 map[string]string           `json:"portLabels"` // labels of unresolved destinations by port, e.g. "5432": "postgres"
+	FilterWorkers              *FilterWorkersConfig        `json:"filterWorkers,omitempty"`
+	CredentialDetection        *CredentialDetectionConfig  `json:"credentialDetection,omitempty"`
+	PodLabels                  []string                    `json:"podLabels"`              // keys of the pod labels attached to entries, e.g. "team", at most 10
+	MaxBroadcastEntryBytes     int                         `json:"maxBroadcastEntryBytes"` // larger entries are broadcast as references, 0 means no limit
+	DatabaseSnapshots          *DatabaseSnapshotConfig     `json:"databaseSnapshots,omitempty"`
+	QueryParams                *QueryParamsConfig          `json:"queryParams,omitempty"`
+	CaptureSchedule            *CaptureScheduleConfig      `json:"captureSchedule,omitempty"`
+	PromotedHeaders            map[string]string           `json:"promotedHeaders"`   // entry field names by http header, e.g. "X-Tenant-ID": "tenantId"
+	MaxUnackedEntries          int                         `json:"maxUnackedEntries"` // entries a tapper keeps until the api server acknowledges them, 10000 when 0
+	MaxExtensions              int                         `json:"maxExtensions"`     // extensions loaded at most, 0 means no limit
+	ExtensionsOrder            []string                    `json:"extensionsOrder"`   // extension files loaded first, the rest are loaded by name. The built-in tls extension is named tls.
+	EnabledProtocols           []string                    `json:"enabledProtocols"`  // protocols of the extensions kept once loaded, every protocol when empty
+	DisabledProtocols          []string                    `json:"disabledProtocols"` // protocols of the extensions skipped once loaded, even when enabled
+	FlowEntryCap               *FlowEntryCapConfig         `json:"flowEntryCap,omitempty"`
+	OutboundProxy              *OutboundProxyConfig        `json:"outboundProxy,omitempty"`
+	MaxEntries                 int64                       `json:"maxEntries"` // entries kept in the database at most, 0 means no limit
+	PiiDetection               *PiiDetectionConfig         `json:"piiDetection,omitempty"`
+	ShutdownTimeoutMs          int                         `json:"shutdownTimeoutMs"`      // time to drain the channels on shutdown before exiting anyway, 10000 when 0
+	ResolverCacheTtlMs         int                         `json:"resolverCacheTtlMs"`     // resolved names older than it are refreshed, 0 keeps them until their objects are removed
+	AllowedOrigins             []string                    `json:"allowedOrigins"`         // origins of the cross origin requests, e.g. https://*.example.com, any origin when empty
+	TapTargetLabelSelector     string                      `json:"tapTargetLabelSelector"` // labels of the pods to tap in daemon mode, e.g. app=orders, any labels when empty
+	SocketKeepalive            *SocketKeepaliveConfig      `json:"socketKeepalive,omitempty"`
+	Redaction                  *RedactionConfig            `json:"redaction,omitempty"`
+	ServerBindHost             string                      `json:"serverBindHost"` // host the api server listens on, all the interfaces when empty
+	ServerPort                 int                         `json:"serverPort"`     // port the api server listens on, 8899 when 0
+	ReverseDns                 *ReverseDnsConfig           `json:"reverseDns,omitempty"`
+	TapStatusStaleAfterMs      int                         `json:"tapStatusStaleAfterMs"` // a tap status restored after a restart is stale once older than it, 300000 when 0
+	DatabaseWriteBatch         *DatabaseWriteBatchConfig   `json:"databaseWriteBatch,omitempty"`
+	InMemoryEntries            *InMemoryEntriesConfig      `json:"inMemoryEntries,omitempty"`
 }
 
+// InMemoryEntriesConfig keeps the newest Capacity entries, 10000 when 0, in a ring buffer in memory and skips the
+// database at AgentDatabasePath entirely. The oldest entries are evicted once the capacity is reached, MaxEntries and
+// MaxDBSizeBytes don't apply and every entry, and the tap status, is lost on restart.
+type InMemoryEntriesConfig struct {
+	Capacity int `json:"capacity"`
+}
+
+// DatabaseWriteBatchConfig writes the entries to the database in batches of at most Size entries, each batch in a
+// single transaction. A partial batch is written every FlushIntervalMs, 1000 when 0, and on shutdown. The entries are
+// written one by one when Size is below 2.
+type DatabaseWriteBatchConfig struct {
+	Size            int `json:"size"`
+	FlushIntervalMs int `json:"flushIntervalMs"`
+}
+
+// ReverseDnsConfig enables resolving the addresses no k8s object resolves, like databases and third party apis, to
+// their reverse dns names. The lookups run in the background, an address is unresolved until its lookup is done and
+// stays unresolved when it fails or takes longer than TimeoutMs, 1000 when 0. The names of at most CacheSize addresses,
+// 10000 when 0, are kept for CacheTtlMs, 300000 when 0.
+type ReverseDnsConfig struct {
+	TimeoutMs  int `json:"timeoutMs"`
+	CacheSize  int `json:"cacheSize"`
+	CacheTtlMs int `json:"cacheTtlMs"`
+}
+
+// RedactionConfig replaces the values of the Headers (any case) and of the BodyFields of the http entries with
+// [REDACTED], by the tappers before the entries are sent and by the api server before they're stored. A body field is
+// a dot separated path in a json body, e.g. "user.password", a * matches any field and the path continues into each
+// element of the arrays on it, e.g. "items.card.number" redacts the number of the card of every item.
+type RedactionConfig struct {
+	Headers    []string `json:"headers"`
+	BodyFields []string `json:"bodyFields"`
+}
+
+// PiiDetectionConfig enables tagging entries with the types of the PII they carry. Detectors names the detectors to
+// run, email, creditCard and ssn, all of them when empty. Only the types are kept, never the values.
+type PiiDetectionConfig struct {
+	Detectors []string `json:"detectors"`
+}
+
+// CaptureScheduleConfig limits the capture to windows, entries captured outside all of them are dropped. Days of a
+// window is a cron style list of days of the week and ranges, like "mon-fri", "sat,sun", "1-5" or "*" for every day.
+// Start and End are HH:MM in Timezone (an IANA name, UTC when empty), a window ending before it starts ends the next day.
+type CaptureScheduleConfig struct {
+	Timezone string          `json:"timezone"`
+	Windows  []CaptureWindow `json:"windows"`
+}
+
+type CaptureWindow struct {
+	Days  string `json:"days"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// QueryParamsConfig stores the query params of http entries as fields the entries can be filtered by. Names are
+// lowercased when LowercaseNames is set, the values of the RedactedParams (any case) are replaced in the fields, the
+// url and the path of the entries.
+type QueryParamsConfig struct {
+	LowercaseNames bool     `json:"lowercaseNames"`
+	RedactedParams []string `json:"redactedParams"`
+}
+
+// DatabaseSnapshotConfig writes a consistent copy of the entries database to Directory every IntervalMs, only the
+// newest MaxSnapshots are kept, all of them when it's 0
+type DatabaseSnapshotConfig struct {
+	Directory    string `json:"directory"`
+	IntervalMs   int    `json:"intervalMs"`
+	MaxSnapshots int    `json:"maxSnapshots"`
+}
+
+// CredentialDetectionConfig enables flagging entries carrying plaintext credentials. Detectors names the built in
+// detectors to run, basicAuth, awsAccessKey, privateKey, githubToken, slackToken and apiKey, all of them when empty.
+// Patterns adds named regular expressions. Values redacted by the tappers can't be detected.
+type CredentialDetectionConfig struct {
+	Detectors []string                  `json:"detectors"`
+	Patterns  []CredentialPatternConfig `json:"patterns"`
+}
+
+type CredentialPatternConfig struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// FilterWorkersConfig sets the number of workers filtering the captured items, a single worker by default.
+// Several workers may pass items on out of order unless PreserveOrder is set. PartitionBy, "connection" or "stream",
+// hands all the items of a connection, or of an HTTP/2 stream, to the same worker instead, keeping their order
+// while the streams of a connection are filtered in parallel.
+type FilterWorkersConfig struct {
+	Count         int    `json:"count"`
+	PreserveOrder bool   `json:"preserveOrder"`
+	PartitionBy   string `json:"partitionBy"`
+}
+
+// ScheduledExportConfig exports the entries matching Filter, a filter expression, every IntervalMs. Every run exports
+// the entries captured since the previous successful run to the one configured sink, File or S3.
+type ScheduledExportConfig struct {
+	Name       string            `json:"name"`
+	Filter     string            `json:"filter"`
+	IntervalMs int               `json:"intervalMs"`
+	File       *FileExportConfig `json:"file,omitempty"`
+	S3         *S3ExportConfig   `json:"s3,omitempty"`
+}
+
+type FileExportConfig struct {
+	Directory string `json:"directory"`
+}
+
+// S3ExportConfig holds the bucket exports are uploaded to, the credentials are read from the standard AWS environment
+// variables. Endpoint is optional and allows S3 compatible storage.
+type S3ExportConfig struct {
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region"`
+	Prefix   string `json:"prefix,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// HarImportConfig bounds the memory used when reading HAR files, at most MaxConcurrentFiles files are read at once
+// and at most PrefetchEntries decoded entries wait to be processed. Zero values fall back to the defaults.
+type HarImportConfig struct {
+	MaxConcurrentFiles int `json:"maxConcurrentFiles"`
+	PrefetchEntries    int `json:"prefetchEntries"`
+}
+
+// CaptureDirection is the direction of the traffic captured for a protocol, protocols without a direction are captured both ways
+type CaptureDirection string
+
+const (
+	CaptureDirectionIncoming CaptureDirection = "incoming"
+	CaptureDirectionOutgoing CaptureDirection = "outgoing"
+	CaptureDirectionBoth     CaptureDirection = "both"
+)
+
+// PushgatewayConfig enables pushing the aggregated metrics to a Prometheus Pushgateway on shutdown,
+// and every IntervalMs when it's set. Every process pushes to an instance named after its pod or node,
+// Instance is an optional prefix of that name.
+type PushgatewayConfig struct {
+	Url        string `json:"url"`
+	Job        string `json:"job"`
+	Instance   string `json:"instance,omitempty"`
+	IntervalMs int    `json:"intervalMs"`
+}
+
+// NamespaceSamplingConfig holds the fraction (0 to 1) of flows kept per namespace, DefaultRate applies to namespaces
+// without a rate of their own and is 1 when omitted. Decisions are reproducible for a given Seed.
+type NamespaceSamplingConfig struct {
+	Seed        string             `json:"seed"`
+	DefaultRate *float64           `json:"defaultRate,omitempty"`
+	Rates       map[string]float64 `json:"rates"`
+}
+
+// TapTargetRules refine the pods matched by the target namespaces and pod regex, a pod is tapped when it matches any
+// include predicate (or there are none) and no exclude predicate, so an explicit exclude always wins
+type TapTargetRules struct {
+	Include []TapTargetPredicate `json:"include"`
+	Exclude []TapTargetPredicate `json:"exclude"`
+}
+
+// TapTargetPredicate matches a pod only when all of its set conditions match
+type TapTargetPredicate struct {
+	Namespaces  []string          `json:"namespaces,omitempty"`
+	NameRegex   string            `json:"nameRegex,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Services    []string          `json:"services,omitempty"` // "<namespace>/<name>" or "<name>", matches the pods the service selects
+}
+
+// EntryBroadcastBatchConfig makes entries reach browser clients in batches, a batch is sent once it has MaxSize entries
+// or when IntervalMs passed, whichever comes first
+type EntryBroadcastBatchConfig struct {
+	IntervalMs int `json:"intervalMs"` // 1000 when not positive
+	MaxSize    int `json:"maxSize"`    // 100 when not positive
+}
+
+// SyslogSinkConfig configures forwarding of captured entries to a syslog server as RFC 5424 messages
+type SyslogSinkConfig struct {
+	Address            string   `json:"address"`
+	Network            string   `json:"network"` // udp, tcp or tls
+	Facility           int      `json:"facility"`
+	Severity           int      `json:"severity"`
+	ErrorsOnly         bool     `json:"errorsOnly"`
+	Fields             []string `json:"fields"` // entry fields included in the message, all the known fields when empty
+	InsecureSkipVerify bool     `json:"insecureSkipVerify"`
+}
+
+// EndpointSamplingConfig holds the fraction (0 to 1) of entries kept per normalized path, DefaultRate applies to
+// paths without a rate of their own and is 1 when omitted
+type EndpointSamplingConfig struct {
+	DefaultRate *float64           `json:"defaultRate,omitempty"`
+	Rates       map[string]float64 `json:"rates"`
+}
+
+// ResponseSamplingConfig samples entries by their response, the first rule matching an entry decides the fraction (0 to
+// 1) of its matching entries that is kept and entries matching no rule are kept at DefaultRate
+type ResponseSamplingConfig struct {
+	Rules       []ResponseSamplingRule `json:"rules"`
+	DefaultRate float64                `json:"defaultRate"`
+}
+
+// ResponseSamplingRule matches an entry when all of its set conditions match, Rate is 1 when omitted
+type ResponseSamplingRule struct {
+	Errors       bool     `json:"errors,omitempty"`
+	MinElapsedMs int64    `json:"minElapsedMs,omitempty"`
+	Rate         *float64 `json:"rate,omitempty"`
+}
+
+// FlowEntryCapConfig keeps at most MaxEntriesPerFlow entries of a connection and drops the entries beyond it. The
+// entries of the MaxFlows most recently active connections are counted, 10000 when 0, a connection that wasn't active
+// since is counted again from its next entry.
+type FlowEntryCapConfig struct {
+	MaxEntriesPerFlow int `json:"maxEntriesPerFlow"`
+	MaxFlows          int `json:"maxFlows"`
+}
+
+// SocketKeepaliveConfig bounds how long a tapper waits on the connection to the api server before reconnecting. A write
+// taking over WriteTimeoutMs fails, 10000 when 0, and the api server is pinged every PingIntervalMs, 30000 when 0, the
+// connection is considered dead when no pong arrives within PongTimeoutMs of the ping, 10000 when 0.
+type SocketKeepaliveConfig struct {
+	WriteTimeoutMs int `json:"writeTimeoutMs"`
+	PingIntervalMs int `json:"pingIntervalMs"`
+	PongTimeoutMs  int `json:"pongTimeoutMs"`
+}
+
+// OutboundProxyConfig routes the http requests the agent sends out, to up9, the S3 export and the pushgateway, through a
+// proxy. The proxy of a request is picked by its scheme, NoProxy is a comma separated list of the hosts, domains and
+// CIDRs reached directly like the NO_PROXY env var. The websocket dialer keeps using the proxy of the env vars.
+type OutboundProxyConfig struct {
+	HttpProxy  string `json:"httpProxy"`
+	HttpsProxy string `json:"httpsProxy"`
+	NoProxy    string `json:"noProxy"`
+}
+
+// WebSocketSchemaVersion is the version of the socket messages, it's incremented whenever a change of the messages breaks
+// the peers reading them. The messages of the peers that predate the versioning have no version.
+const WebSocketSchemaVersion = 1
+
+// MinWebSocketSchemaVersion is the oldest version of the messages that is still read
+const MinWebSocketSchemaVersion = 1
+
 type WebSocketMessageMetadata struct {
-	MessageType WebSocketMessageType `json:"messageType,omitempty"`
+	MessageType   WebSocketMessageType `json:"messageType,omitempty"`
+	SchemaVersion int                  `json:"schemaVersion,omitempty"`
+}
+
+// IsCompatibleSchemaVersion returns whether the messages of the version are read
+func IsCompatibleSchemaVersion(version int) bool {
+	return version >= MinWebSocketSchemaVersion && version <= WebSocketSchemaVersion
+}
+
+// GetSupportedSchemaVersions returns the versions of the messages that are read, the newest first
+func GetSupportedSchemaVersions() []int {
+	versions := make([]int, 0, WebSocketSchemaVersion-MinWebSocketSchemaVersion+1)
+	for version := WebSocketSchemaVersion; version >= MinWebSocketSchemaVersion; version-- {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// WebSocketSchemaHandshakeMessage is sent by both peers once a socket is connected, a peer warns when none of the
+// versions of the other is supported
+type WebSocketSchemaHandshakeMessage struct {
+	*WebSocketMessageMetadata
+	SupportedVersions []int `json:"supportedVersions"`
 }
 
 type WebSocketAnalyzeStatusMessage struct {
@@ -63,8 +376,10 @@ type WebSocketStatusMessage struct {
 }
 
 type TapStatus struct {
-	Pods     []PodInfo     `json:"pods"`
-	TLSLinks []TLSLinkInfo `json:"tlsLinks"`
+	Pods      []PodInfo     `json:"pods"`
+	TLSLinks  []TLSLinkInfo `json:"tlsLinks"`
+	UpdatedAt int64         `json:"updatedAt,omitempty"` // unix ms of the last update of the pods, set by the api server
+	IsStale   bool          `json:"isStale,omitempty"`   // the status was restored after a restart of the api server and is older than tapStatusStaleAfterMs
 }
 
 type PodInfo struct {
@@ -79,26 +394,52 @@ type TLSLinkInfo struct {
 	ResolvedSourceName      string `json:"resolvedSourceName"`
 }
 
+// SyncEntriesConfig syncs the entries to up9. The sync stops being attempted after MaxFailures consecutive failures,
+// 5 when 0, and is attempted again after CooldownSec, 60 when 0.
 type SyncEntriesConfig struct {
 	Token             string `json:"token"`
 	Env               string `json:"env"`
 	Workspace         string `json:"workspace"`
 	UploadIntervalSec int    `json:"interval"`
+	MaxFailures       int    `json:"maxFailures,omitempty"`
+	CooldownSec       int    `json:"cooldownSec,omitempty"`
 }
 
 func CreateWebSocketStatusMessage(tappingStatus TapStatus) WebSocketStatusMessage {
 	return WebSocketStatusMessage{
 		WebSocketMessageMetadata: &WebSocketMessageMetadata{
-			MessageType: WebSocketMessageTypeUpdateStatus,
+			MessageType:   WebSocketMessageTypeUpdateStatus,
+			SchemaVersion: WebSocketSchemaVersion,
 		},
 		TappingStatus: tappingStatus,
 	}
 }
 
+func CreateWebSocketSchemaHandshakeMessage() WebSocketSchemaHandshakeMessage {
+	return WebSocketSchemaHandshakeMessage{
+		WebSocketMessageMetadata: &WebSocketMessageMetadata{
+			MessageType:   WebSocketMessageTypeSchemaHandshake,
+			SchemaVersion: WebSocketSchemaVersion,
+		},
+		SupportedVersions: GetSupportedSchemaVersions(),
+	}
+}
+
+// HasCompatibleSchemaVersion returns whether any of the versions of the peer is supported
+func (message *WebSocketSchemaHandshakeMessage) HasCompatibleSchemaVersion() bool {
+	for _, version := range message.SupportedVersions {
+		if IsCompatibleSchemaVersion(version) {
+			return true
+		}
+	}
+	return false
+}
+
 func CreateWebSocketMessageTypeAnalyzeStatus(analyzeStatus AnalyzeStatus) WebSocketAnalyzeStatusMessage {
 	return WebSocketAnalyzeStatusMessage{
 		WebSocketMessageMetadata: &WebSocketMessageMetadata{
-			MessageType: WebSocketMessageTypeAnalyzeStatus,
+			MessageType:   WebSocketMessageTypeAnalyzeStatus,
+			SchemaVersion: WebSocketSchemaVersion,
 		},
 		AnalyzeStatus: analyzeStatus,
 	}
@@ -113,6 +454,26 @@ type VersionResponse struct {
 	SemVer string `json:"semver"`
 }
 
+type AgentVersionResponse struct {
+	SemVer            string                   `json:"semver"`
+	Branch            string                   `json:"branch"`
+	GitCommitHash     string                   `json:"gitCommitHash"`
+	BuildTimestamp    string                   `json:"buildTimestamp"`
+	WebSocketProtocol WebSocketProtocolVersion `json:"webSocketProtocol"`
+	Extensions        []ExtensionVersion       `json:"extensions"`
+}
+
+type WebSocketProtocolVersion struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+type ExtensionVersion struct {
+	Name     string `json:"name"`
+	LongName string `json:"longName"`
+	Version  string `json:"version"`
+}
+
 type RulesPolicy struct {
 	Rules []RulePolicy `yaml:"rules"`
 }
@@ -0,0 +1,45 @@
+package shared_test
+
+import (
+	"github.com/up9inc/mizu/shared"
+	"reflect"
+	"testing"
+)
+
+func TestIsCompatibleSchemaVersion(t *testing.T) {
+	tests := []struct {
+		Version  int
+		Expected bool
+	}{
+		{Version: shared.WebSocketSchemaVersion, Expected: true},
+		{Version: shared.MinWebSocketSchemaVersion, Expected: true},
+		{Version: 0, Expected: false},
+		{Version: shared.WebSocketSchemaVersion + 1, Expected: false},
+	}
+
+	for _, test := range tests {
+		actual := shared.IsCompatibleSchemaVersion(test.Version)
+		if actual != test.Expected {
+			t.Errorf("unexpected result - Expected: %v, actual: %v, version: %v", test.Expected, actual, test.Version)
+		}
+	}
+}
+
+func TestGetSupportedSchemaVersions(t *testing.T) {
+	actual := shared.GetSupportedSchemaVersions()
+	if len(actual) == 0 || actual[0] != shared.WebSocketSchemaVersion || actual[len(actual)-1] != shared.MinWebSocketSchemaVersion {
+		t.Errorf("unexpected result - Expected: %v to %v, actual: %v", shared.WebSocketSchemaVersion, shared.MinWebSocketSchemaVersion, actual)
+	}
+}
+
+func TestSchemaHandshakeMessage(t *testing.T) {
+	message := shared.CreateWebSocketSchemaHandshakeMessage()
+	if !reflect.DeepEqual(message.SupportedVersions, shared.GetSupportedSchemaVersions()) || !message.HasCompatibleSchemaVersion() {
+		t.Errorf("unexpected result - Expected: %v, actual: %v", shared.GetSupportedSchemaVersions(), message.SupportedVersions)
+	}
+
+	message.SupportedVersions = []int{shared.WebSocketSchemaVersion + 1}
+	if message.HasCompatibleSchemaVersion() {
+		t.Errorf("unexpected result - Expected: %v, actual: %v", false, true)
+	}
+}
@@ -29,11 +29,12 @@ type Protocol struct {
 }
 
 type Extension struct {
-	Protocol   *Protocol
-	Path       string
-	Plug       *plugin.Plugin
-	Dissector  Dissector
-	MatcherMap *sync.Map
+	Protocol       *Protocol
+	ExtraProtocols []*Protocol // the protocols of other entries the dissector emits, e.g. websocket closes of http
+	Path           string
+	Plug           *plugin.Plugin
+	Dissector      Dissector
+	MatcherMap     *sync.Map
 }
 
 type ConnectionInfo struct {
@@ -74,6 +75,8 @@ type OutputChannelItem struct {
 	Timestamp      int64
 	ConnectionInfo *ConnectionInfo
 	Pair           *RequestResponsePair
+	Stream         uint32      // the HTTP/2 stream of the pair within its connection, 0 for the protocols without streams
+	SourceLabels   EntryLabels // added to the source labels of the entry, e.g. the HAR file an imported item was read from
 }
 
 type SuperTimer struct {
@@ -112,36 +115,48 @@ type MizuEntry struct {
 	ID                      uint `gorm:"primarykey"`
 	CreatedAt               time.Time
 	UpdatedAt               time.Time
-	ProtocolName            string         `json:"protocolName" gorm:"column:protocolName"`
-	ProtocolLongName        string         `json:"protocolLongName" gorm:"column:protocolLongName"`
-	ProtocolAbbreviation    string         `json:"protocolAbbreviation" gorm:"column:protocolAbbreviation"`
-	ProtocolVersion         string         `json:"protocolVersion" gorm:"column:protocolVersion"`
-	ProtocolBackgroundColor string         `json:"protocolBackgroundColor" gorm:"column:protocolBackgroundColor"`
-	ProtocolForegroundColor string         `json:"protocolForegroundColor" gorm:"column:protocolForegroundColor"`
-	ProtocolFontSize        int8           `json:"protocolFontSize" gorm:"column:protocolFontSize"`
-	ProtocolReferenceLink   string         `json:"protocolReferenceLink" gorm:"column:protocolReferenceLink"`
-	Entry                   string         `json:"entry,omitempty" gorm:"column:entry"`
-	EntryId                 string         `json:"entryId" gorm:"column:entryId"`
-	Url                     string         `json:"url" gorm:"column:url"`
-	Method                  string         `json:"method" gorm:"column:method"`
-	Status                  int            `json:"status" gorm:"column:status"`
-	RequestSenderIp         string         `json:"requestSenderIp" gorm:"column:requestSenderIp"`
-	Service                 string         `json:"service" gorm:"column:service"`
-	Timestamp               int64          `json:"timestamp" gorm:"column:timestamp"`
-	ElapsedTime             int64          `json:"elapsedTime" gorm:"column:elapsedTime"`
-	Path                    string         `json:"path" gorm:"column:path"`
-	ResolvedSource          string         `json:"resolvedSource,omitempty" gorm:"column:resolvedSource"`
-	ResolvedDestination     string         `json:"resolvedDestination,omitempty" gorm:"column:resolvedDestination"`
-	SourceIp                string         `json:"sourceIp,omitempty" gorm:"column:sourceIp"`
-	DestinationIp           string         `json:"destinationIp,omitempty" gorm:"column:destinationIp"`
-	SourcePort              string         `json:"sourcePort,omitempty" gorm:"column:sourcePort"`
-	DestinationPort         string         `json:"destinationPort,omitempty" gorm:"column:destinationPort"`
-	IsOutgoing              bool           `json:"isOutgoing,omitempty" gorm:"column:isOutgoing"`
-	ContractStatus          ContractStatus `json:"contractStatus,omitempty" gorm:"column:contractStatus"`
-	ContractRequestReason   string         `json:"contractRequestReason,omitempty" gorm:"column:contractRequestReason"`
-	ContractResponseReason  string         `json:"contractResponseReason,omitempty" gorm:"column:contractResponseReason"`
-	ContractContent         string         `json:"contractContent,omitempty" gorm:"column:contractContent"`
-	EstimatedSizeBytes      int            `json:"-" gorm:"column:estimatedSizeBytes"`
+	ProtocolName            string           `json:"protocolName" gorm:"column:protocolName"`
+	ProtocolLongName        string           `json:"protocolLongName" gorm:"column:protocolLongName"`
+	ProtocolAbbreviation    string           `json:"protocolAbbreviation" gorm:"column:protocolAbbreviation"`
+	ProtocolVersion         string           `json:"protocolVersion" gorm:"column:protocolVersion"`
+	ProtocolBackgroundColor string           `json:"protocolBackgroundColor" gorm:"column:protocolBackgroundColor"`
+	ProtocolForegroundColor string           `json:"protocolForegroundColor" gorm:"column:protocolForegroundColor"`
+	ProtocolFontSize        int8             `json:"protocolFontSize" gorm:"column:protocolFontSize"`
+	ProtocolReferenceLink   string           `json:"protocolReferenceLink" gorm:"column:protocolReferenceLink"`
+	Entry                   string           `json:"entry,omitempty" gorm:"column:entry"`
+	EntryId                 string           `json:"entryId" gorm:"column:entryId"`
+	Url                     string           `json:"url" gorm:"column:url"`
+	Method                  string           `json:"method" gorm:"column:method"`
+	Status                  int              `json:"status" gorm:"column:status"`
+	RequestSenderIp         string           `json:"requestSenderIp" gorm:"column:requestSenderIp"`
+	Service                 string           `json:"service" gorm:"column:service"`
+	Timestamp               int64            `json:"timestamp" gorm:"column:timestamp"`
+	ElapsedTime             int64            `json:"elapsedTime" gorm:"column:elapsedTime"`
+	Path                    string           `json:"path" gorm:"column:path"`
+	ResolvedSource          string           `json:"resolvedSource,omitempty" gorm:"column:resolvedSource"`
+	ResolvedDestination     string           `json:"resolvedDestination,omitempty" gorm:"column:resolvedDestination"`
+	SourceIp                string           `json:"sourceIp,omitempty" gorm:"column:sourceIp"`
+	DestinationIp           string           `json:"destinationIp,omitempty" gorm:"column:destinationIp"`
+	SourcePort              string           `json:"sourcePort,omitempty" gorm:"column:sourcePort"`
+	DestinationPort         string           `json:"destinationPort,omitempty" gorm:"column:destinationPort"`
+	IsOutgoing              bool             `json:"isOutgoing,omitempty" gorm:"column:isOutgoing"`
+	ContractStatus          ContractStatus   `json:"contractStatus,omitempty" gorm:"column:contractStatus"`
+	ContractRequestReason   string           `json:"contractRequestReason,omitempty" gorm:"column:contractRequestReason"`
+	ContractResponseReason  string           `json:"contractResponseReason,omitempty" gorm:"column:contractResponseReason"`
+	ContractContent         string           `json:"contractContent,omitempty" gorm:"column:contractContent"`
+	EstimatedSizeBytes      int              `json:"-" gorm:"column:estimatedSizeBytes"`
+	RequestSize             int64            `json:"requestSize" gorm:"column:requestSize"`
+	ResponseSize            int64            `json:"responseSize" gorm:"column:responseSize"`
+	RedirectChain           string           `json:"redirectChain,omitempty" gorm:"column:redirectChain"`
+	RedirectHop             int              `json:"redirectHop,omitempty" gorm:"column:redirectHop"`
+	DestinationLabel        string           `json:"destinationLabel,omitempty" gorm:"column:destinationLabel"`
+	CredentialLeak          bool             `json:"credentialLeak,omitempty" gorm:"column:credentialLeak"`
+	CredentialDetector      string           `json:"credentialDetector,omitempty" gorm:"column:credentialDetector"`
+	SourceLabels            EntryLabels      `json:"sourceLabels,omitempty" gorm:"column:sourceLabels"`
+	DestinationLabels       EntryLabels      `json:"destinationLabels,omitempty" gorm:"column:destinationLabels"`
+	Fields                  EntryLabels      `json:"fields,omitempty" gorm:"column:fields"` // promoted headers by field name
+	QueryParams             EntryQueryParams `json:"queryParams,omitempty" gorm:"column:queryParams"`
+	PiiTypes                string           `json:"piiTypes,omitempty" gorm:"column:piiTypes"` // comma separated, e.g. "creditCard,email"
 }
 
 type MizuEntryWrapper struct {
@@ -154,24 +169,42 @@ type MizuEntryWrapper struct {
 }
 
 type BaseEntryDetails struct {
-	Id              string          `json:"id,omitempty"`
-	Protocol        Protocol        `json:"protocol,omitempty"`
-	Url             string          `json:"url,omitempty"`
-	RequestSenderIp string          `json:"requestSenderIp,omitempty"`
-	Service         string          `json:"service,omitempty"`
-	Path            string          `json:"path,omitempty"`
-	Summary         string          `json:"summary,omitempty"`
-	StatusCode      int             `json:"statusCode"`
-	Method          string          `json:"method,omitempty"`
-	Timestamp       int64           `json:"timestamp,omitempty"`
-	SourceIp        string          `json:"sourceIp,omitempty"`
-	DestinationIp   string          `json:"destinationIp,omitempty"`
-	SourcePort      string          `json:"sourcePort,omitempty"`
-	DestinationPort string          `json:"destinationPort,omitempty"`
-	IsOutgoing      bool            `json:"isOutgoing,omitempty"`
-	Latency         int64           `json:"latency"`
-	Rules           ApplicableRules `json:"rules,omitempty"`
-	ContractStatus  ContractStatus  `json:"contractStatus"`
+	Id                 string          `json:"id,omitempty"`
+	Protocol           Protocol        `json:"protocol,omitempty"`
+	Url                string          `json:"url,omitempty"`
+	RequestSenderIp    string          `json:"requestSenderIp,omitempty"`
+	Service            string          `json:"service,omitempty"`
+	Path               string          `json:"path,omitempty"`
+	Summary            string          `json:"summary,omitempty"`
+	StatusCode         int             `json:"statusCode"`
+	Method             string          `json:"method,omitempty"`
+	Timestamp          int64           `json:"timestamp,omitempty"`
+	SourceIp           string          `json:"sourceIp,omitempty"`
+	DestinationIp      string          `json:"destinationIp,omitempty"`
+	SourcePort         string          `json:"sourcePort,omitempty"`
+	DestinationPort    string          `json:"destinationPort,omitempty"`
+	IsOutgoing         bool            `json:"isOutgoing,omitempty"`
+	Latency            int64           `json:"latency"`
+	Rules              ApplicableRules `json:"rules,omitempty"`
+	ContractStatus     ContractStatus  `json:"contractStatus"`
+	RedirectChain      string          `json:"redirectChain,omitempty"`
+	RedirectHop        int             `json:"redirectHop,omitempty"`
+	DestinationLabel   string          `json:"destinationLabel,omitempty"`
+	CredentialLeak     bool            `json:"credentialLeak,omitempty"`
+	CredentialDetector string          `json:"credentialDetector,omitempty"`
+	SourceLabels       EntryLabels     `json:"sourceLabels,omitempty"`
+	DestinationLabels  EntryLabels     `json:"destinationLabels,omitempty"`
+	Fields             EntryLabels     `json:"fields,omitempty"`
+	PiiTypes           string          `json:"piiTypes,omitempty"`
+	Preview            *EntryPreview   `json:"preview,omitempty"`
+}
+
+// EntryPreview holds the beginning of the request and response bodies, the full bodies are fetched separately
+type EntryPreview struct {
+	Request           string `json:"request"`
+	RequestTruncated  bool   `json:"requestTruncated"`
+	Response          string `json:"response"`
+	ResponseTruncated bool   `json:"responseTruncated"`
 }
 
 type ApplicableRules struct {
@@ -220,6 +253,13 @@ func (bed *BaseEntryDetails) UnmarshalData(entry *MizuEntry) error {
 	bed.IsOutgoing = entry.IsOutgoing
 	bed.Latency = entry.ElapsedTime
 	bed.ContractStatus = entry.ContractStatus
+	bed.DestinationLabel = entry.DestinationLabel
+	bed.CredentialLeak = entry.CredentialLeak
+	bed.CredentialDetector = entry.CredentialDetector
+	bed.SourceLabels = entry.SourceLabels
+	bed.DestinationLabels = entry.DestinationLabels
+	bed.Fields = entry.Fields
+	bed.PiiTypes = entry.PiiTypes
 	return nil
 }
 
@@ -234,8 +274,9 @@ const (
 )
 
 type HTTPPayload struct {
-	Type uint8
-	Data interface{}
+	Type             uint8
+	Data             interface{}
+	OriginalBodySize int64 // the size of the body before it was truncated to the MaxBodySize of the filtering options, 0 when it wasn't
 }
 
 type HTTPPayloader interface {
@@ -243,11 +284,13 @@ type HTTPPayloader interface {
 }
 
 type HTTPWrapper struct {
-	Method      string               `json:"method"`
-	Url         string               `json:"url"`
-	Details     interface{}          `json:"details"`
-	RawRequest  *HTTPRequestWrapper  `json:"rawRequest"`
-	RawResponse *HTTPResponseWrapper `json:"rawResponse"`
+	Method           string               `json:"method"`
+	Url              string               `json:"url"`
+	Details          interface{}          `json:"details"`
+	RawRequest       *HTTPRequestWrapper  `json:"rawRequest"`
+	RawResponse      *HTTPResponseWrapper `json:"rawResponse"`
+	BodyTruncated    bool                 `json:"bodyTruncated,omitempty"`
+	OriginalBodySize int64                `json:"originalBodySize,omitempty"`
 }
 
 func (h HTTPPayload) MarshalJSON() ([]byte, error) {
@@ -258,10 +301,12 @@ func (h HTTPPayload) MarshalJSON() ([]byte, error) {
 			return nil, errors.New("Failed converting request to HAR")
 		}
 		return json.Marshal(&HTTPWrapper{
-			Method:     harRequest.Method,
-			Url:        "",
-			Details:    harRequest,
-			RawRequest: &HTTPRequestWrapper{Request: h.Data.(*http.Request)},
+			Method:           harRequest.Method,
+			Url:              "",
+			Details:          harRequest,
+			RawRequest:       &HTTPRequestWrapper{Request: h.Data.(*http.Request)},
+			BodyTruncated:    h.OriginalBodySize > 0,
+			OriginalBodySize: h.OriginalBodySize,
 		})
 	case TypeHttpResponse:
 		harResponse, err := har.NewResponse(h.Data.(*http.Response), true)
@@ -269,13 +314,15 @@ func (h HTTPPayload) MarshalJSON() ([]byte, error) {
 			return nil, errors.New("Failed converting response to HAR")
 		}
 		return json.Marshal(&HTTPWrapper{
-			Method:      "",
-			Url:         "",
-			Details:     harResponse,
-			RawResponse: &HTTPResponseWrapper{Response: h.Data.(*http.Response)},
+			Method:           "",
+			Url:              "",
+			Details:          harResponse,
+			RawResponse:      &HTTPResponseWrapper{Response: h.Data.(*http.Response)},
+			BodyTruncated:    h.OriginalBodySize > 0,
+			OriginalBodySize: h.OriginalBodySize,
 		})
 	default:
-		panic(fmt.Sprintf("HTTP payload cannot be marshaled: %s\n", h.Type))
+		panic(fmt.Sprintf("HTTP payload cannot be marshaled: %d\n", h.Type))
 	}
 }
 
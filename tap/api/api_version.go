@@ -0,0 +1,23 @@
+package api
+
+import (
+	"fmt"
+)
+
+// ApiVersion is the version of the api the extensions are built against, it's bumped by every change of the api that
+// breaks the extensions built before it. An extension declares the version it's built against by exporting
+// var ApiVersion = api.ApiVersion
+const ApiVersion = "1"
+
+// CheckApiVersion returns an error unless the ApiVersion symbol of an extension is the ApiVersion of this api. A plugin
+// built against another version of the api may still cast to a Dissector and then misbehave.
+func CheckApiVersion(symApiVersion interface{}) error {
+	apiVersion, ok := symApiVersion.(*string)
+	if !ok {
+		return fmt.Errorf("the ApiVersion of the extension is a %T instead of a string", symApiVersion)
+	}
+	if *apiVersion != ApiVersion {
+		return fmt.Errorf("the extension is built against version %q of the extensions api while the agent is built against version %q, rebuild the extension", *apiVersion, ApiVersion)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+func TestCheckApiVersion(t *testing.T) {
+	matchingVersion, otherVersion := api.ApiVersion, "0"
+	tests := []struct {
+		name          string
+		symApiVersion interface{}
+		expectedError bool
+	}{
+		{name: "matching version", symApiVersion: &matchingVersion},
+		{name: "other version", symApiVersion: &otherVersion, expectedError: true},
+		{name: "not a string", symApiVersion: 1, expectedError: true},
+		{name: "string value", symApiVersion: api.ApiVersion, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := api.CheckApiVersion(test.symApiVersion); (err != nil) != test.expectedError {
+				t.Errorf("unexpected result - expected error: %v, actual: %v", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package apitest has the helpers of the tests of the extensions, it dissects captured sessions the way the tapper does
+package apitest
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+// CollectingEmitter keeps the emitted items in their order
+type CollectingEmitter struct {
+	Items []*api.OutputChannelItem
+}
+
+func (emitter *CollectingEmitter) Emit(item *api.OutputChannelItem) {
+	emitter.Items = append(emitter.Items, item)
+}
+
+// Session is a captured tcp session between a client at 10.0.0.1:41000 and a server at 10.0.0.2:ServerPort
+type Session struct {
+	ClientStream string
+	ServerStream string
+	ServerPort   string
+	// the server stream is fed first unless it's set, so every request completes a pair
+	IsClientFirst bool
+	// the options are the zero value when nil
+	Options *api.TrafficFilteringOptions
+	// the entries are analyzed with this resolved destination
+	ResolvedDestination string
+}
+
+// DissectSession feeds the streams of the session to the dissector and analyzes the emitted items once they were
+// marshalled to json, since the entries reach the api server as json
+func DissectSession(t *testing.T, dissector api.Dissector, session *Session) (entries []*api.MizuEntry, clientErr error, serverErr error) {
+	options := session.Options
+	if options == nil {
+		options = &api.TrafficFilteringOptions{}
+	}
+	emitter := &CollectingEmitter{}
+	counterPair := &api.CounterPair{}
+	clientTcpID := &api.TcpID{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: "41000", DstPort: session.ServerPort}
+	serverTcpID := &api.TcpID{SrcIP: "10.0.0.2", DstIP: "10.0.0.1", SrcPort: session.ServerPort, DstPort: "41000"}
+	superTimer := &api.SuperTimer{CaptureTime: time.Now()}
+
+	dissectClient := func() {
+		clientErr = dissector.Dissect(bufio.NewReader(strings.NewReader(session.ClientStream)), true, clientTcpID, counterPair, superTimer, &api.SuperIdentifier{}, emitter, options)
+	}
+	dissectServer := func() {
+		serverErr = dissector.Dissect(bufio.NewReader(strings.NewReader(session.ServerStream)), false, serverTcpID, counterPair, superTimer, &api.SuperIdentifier{}, emitter, options)
+	}
+	if session.IsClientFirst {
+		dissectClient()
+		dissectServer()
+	} else {
+		dissectServer()
+		dissectClient()
+	}
+
+	entries = make([]*api.MizuEntry, 0, len(emitter.Items))
+	for _, item := range emitter.Items {
+		itemBytes, _ := json.Marshal(item)
+		var receivedItem api.OutputChannelItem
+		if err := json.Unmarshal(itemBytes, &receivedItem); err != nil {
+			t.Fatalf("failed to unmarshal item: %v", err)
+		}
+		entries = append(entries, dissector.Analyze(&receivedItem, "id", "", session.ResolvedDestination))
+	}
+	return entries, clientErr, serverErr
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const entryLabelsSeparator = "\n"
+
+// EntryLabels are the labels of the pod on one side of an entry, or the headers promoted to fields of an entry. They
+// are stored as key=value lines wrapped by line breaks, e.g. "\nenv=prod\nteam=payments\n", kubernetes label keys and
+// values can't hold either of the separators and neither can header values hold line breaks.
+type EntryLabels map[string]string
+
+func (EntryLabels) GormDataType() string {
+	return "text"
+}
+
+func (labels EntryLabels) Value() (driver.Value, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	lines := make([]string, 0, len(labels))
+	for key, value := range labels {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(lines)
+	return entryLabelsSeparator + strings.Join(lines, entryLabelsSeparator) + entryLabelsSeparator, nil
+}
+
+func (labels *EntryLabels) Scan(value interface{}) error {
+	var text string
+	switch typedValue := value.(type) {
+	case nil:
+	case string:
+		text = typedValue
+	case []byte:
+		text = string(typedValue)
+	default:
+		return fmt.Errorf("unsupported labels value %T", value)
+	}
+
+	*labels = nil
+	for _, line := range strings.Split(text, entryLabelsSeparator) {
+		separatorIndex := strings.Index(line, "=")
+		if separatorIndex < 0 {
+			continue
+		}
+		if *labels == nil {
+			*labels = EntryLabels{}
+		}
+		(*labels)[line[:separatorIndex]] = line[separatorIndex+1:]
+	}
+	return nil
+}
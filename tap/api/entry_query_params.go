@@ -0,0 +1,67 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const entryQueryParamsSeparator = "\n"
+
+// EntryQueryParams are the query params of a request in the order they were sent, repeated params included. They are
+// stored as name=value lines wrapped by line breaks with both sides query escaped, e.g. "\nq=a+b\ntag=x\ntag=y\n".
+type EntryQueryParams []EntryQueryParam
+
+type EntryQueryParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// QueryParamLine returns the stored line of a param, the line of a param without a value ends with the =
+func QueryParamLine(name string, value string) string {
+	return fmt.Sprintf("%s=%s", url.QueryEscape(name), url.QueryEscape(value))
+}
+
+func (EntryQueryParams) GormDataType() string {
+	return "text"
+}
+
+func (params EntryQueryParams) Value() (driver.Value, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	lines := make([]string, 0, len(params))
+	for _, param := range params {
+		lines = append(lines, QueryParamLine(param.Name, param.Value))
+	}
+	return entryQueryParamsSeparator + strings.Join(lines, entryQueryParamsSeparator) + entryQueryParamsSeparator, nil
+}
+
+func (params *EntryQueryParams) Scan(value interface{}) error {
+	var text string
+	switch typedValue := value.(type) {
+	case nil:
+	case string:
+		text = typedValue
+	case []byte:
+		text = string(typedValue)
+	default:
+		return fmt.Errorf("unsupported query params value %T", value)
+	}
+
+	*params = nil
+	for _, line := range strings.Split(text, entryQueryParamsSeparator) {
+		separatorIndex := strings.Index(line, "=")
+		if separatorIndex < 0 {
+			continue
+		}
+		name, nameErr := url.QueryUnescape(line[:separatorIndex])
+		paramValue, valueErr := url.QueryUnescape(line[separatorIndex+1:])
+		if nameErr != nil || valueErr != nil {
+			return fmt.Errorf("invalid query param line %q", line)
+		}
+		*params = append(*params, EntryQueryParam{Name: name, Value: paramValue})
+	}
+	return nil
+}
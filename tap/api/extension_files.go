@@ -0,0 +1,36 @@
+package api
+
+import (
+	"sort"
+)
+
+// SelectExtensionFiles orders the extension files to load, the files listed in order first and in its order, the
+// rest by name, and keeps the first max of them when max is positive. Plugins can't be unloaded and their priorities
+// are only known once loaded, so the files are selected before loading them. It returns the selected files and the
+// skipped ones, both in that order.
+func SelectExtensionFiles(fileNames []string, order []string, max int) ([]string, []string) {
+	ranks := make(map[string]int, len(order))
+	for i, fileName := range order {
+		if _, ok := ranks[fileName]; !ok {
+			ranks[fileName] = i
+		}
+	}
+
+	orderedFileNames := append([]string{}, fileNames...)
+	sort.SliceStable(orderedFileNames, func(i, j int) bool {
+		iRank, iListed := ranks[orderedFileNames[i]]
+		jRank, jListed := ranks[orderedFileNames[j]]
+		if iListed != jListed {
+			return iListed
+		}
+		if iListed {
+			return iRank < jRank
+		}
+		return orderedFileNames[i] < orderedFileNames[j]
+	})
+
+	if max <= 0 || len(orderedFileNames) <= max {
+		return orderedFileNames, []string{}
+	}
+	return orderedFileNames[:max], orderedFileNames[max:]
+}
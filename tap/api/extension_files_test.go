@@ -0,0 +1,41 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+func TestSelectExtensionFiles(t *testing.T) {
+	fileNames := []string{"redis.so", "amqp.so", "http.so", "kafka.so"}
+
+	tests := []struct {
+		name             string
+		order            []string
+		max              int
+		expectedSelected []string
+		expectedSkipped  []string
+	}{
+		{name: "no cap", expectedSelected: []string{"amqp.so", "http.so", "kafka.so", "redis.so"}, expectedSkipped: []string{}},
+		{name: "cap by name", max: 2, expectedSelected: []string{"amqp.so", "http.so"}, expectedSkipped: []string{"kafka.so", "redis.so"}},
+		{name: "cap by order", order: []string{"redis.so", "missing.so", "http.so"}, max: 3, expectedSelected: []string{"redis.so", "http.so", "amqp.so"}, expectedSkipped: []string{"kafka.so"}},
+		{name: "cap above count", max: 10, expectedSelected: []string{"amqp.so", "http.so", "kafka.so", "redis.so"}, expectedSkipped: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, skipped := api.SelectExtensionFiles(fileNames, test.order, test.max)
+			if !reflect.DeepEqual(selected, test.expectedSelected) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedSelected, selected)
+			}
+			if !reflect.DeepEqual(skipped, test.expectedSkipped) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedSkipped, skipped)
+			}
+		})
+	}
+
+	if fileNames[0] != "redis.so" {
+		t.Errorf("the file names must not be reordered in place")
+	}
+}
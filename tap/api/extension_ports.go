@@ -0,0 +1,79 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+)
+
+// PortConflict is a port claimed by several extensions, only the selected one dissects the streams of the port
+type PortConflict struct {
+	Port       string   `json:"port"`
+	Extensions []string `json:"extensions"` // in order of precedence
+	Selected   string   `json:"selected"`
+	Configured bool     `json:"configured"` // selected as the configured owner of the port rather than by priority
+}
+
+// SortExtensions orders the extensions by priority, extensions of the same priority by name, so the order doesn't
+// depend on the order the extensions were loaded in
+func SortExtensions(extensions []*Extension) {
+	sort.SliceStable(extensions, func(i, j int) bool {
+		if extensions[i].Protocol.Priority != extensions[j].Protocol.Priority {
+			return extensions[i].Protocol.Priority < extensions[j].Protocol.Priority
+		}
+		return extensions[i].Protocol.Name < extensions[j].Protocol.Name
+	})
+}
+
+// ResolvePortConflicts finds the ports claimed by several of the sorted extensions, ordered by port. A port goes to
+// its configured owner when the owner claims it, otherwise to the first extension claiming it.
+func ResolvePortConflicts(extensions []*Extension, portOwners map[string]string) []PortConflict {
+	claims := map[string][]string{}
+	for _, extension := range extensions {
+		for _, port := range extension.Protocol.Ports {
+			if !containsString(claims[port], extension.Protocol.Name) {
+				claims[port] = append(claims[port], extension.Protocol.Name)
+			}
+		}
+	}
+
+	conflicts := make([]PortConflict, 0)
+	for port, names := range claims {
+		if len(names) < 2 {
+			continue
+		}
+		conflict := PortConflict{Port: port, Extensions: names, Selected: names[0]}
+		if owner, ok := portOwners[port]; ok && containsString(names, owner) {
+			conflict.Selected, conflict.Configured = owner, true
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		iPort, iErr := strconv.Atoi(conflicts[i].Port)
+		jPort, jErr := strconv.Atoi(conflicts[j].Port)
+		if iErr != nil || jErr != nil {
+			return conflicts[i].Port < conflicts[j].Port
+		}
+		return iPort < jPort
+	})
+	return conflicts
+}
+
+// ShouldDissectPort tells whether the extension dissects the streams of the port, extensions that lost the
+// conflict on a port don't
+func ShouldDissectPort(extension *Extension, port string, conflicts []PortConflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.Port == port {
+			return conflict.Selected == extension.Protocol.Name || !containsString(conflict.Extensions, extension.Protocol.Name)
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
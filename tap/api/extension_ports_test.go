@@ -0,0 +1,71 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+func newConflictingExtensions() []*api.Extension {
+	return []*api.Extension{
+		{Protocol: &api.Protocol{Name: "thrift", Priority: 3, Ports: []string{"9090"}}},
+		{Protocol: &api.Protocol{Name: "custom", Priority: 3, Ports: []string{"9090", "10000"}}},
+		{Protocol: &api.Protocol{Name: "http", Priority: 0, Ports: []string{"80", "10000"}}},
+		{Protocol: &api.Protocol{Name: "redis", Priority: 3, Ports: []string{"6379"}}},
+	}
+}
+
+func TestResolvePortConflictsByPriority(t *testing.T) {
+	// the order the extensions were loaded in must not matter
+	for _, reverse := range []bool{false, true} {
+		extensions := newConflictingExtensions()
+		if reverse {
+			for i, j := 0, len(extensions)-1; i < j; i, j = i+1, j-1 {
+				extensions[i], extensions[j] = extensions[j], extensions[i]
+			}
+		}
+		api.SortExtensions(extensions)
+
+		expected := []api.PortConflict{
+			{Port: "9090", Extensions: []string{"custom", "thrift"}, Selected: "custom"},
+			{Port: "10000", Extensions: []string{"http", "custom"}, Selected: "http"},
+		}
+		if conflicts := api.ResolvePortConflicts(extensions, nil); !reflect.DeepEqual(conflicts, expected) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected, conflicts)
+		}
+	}
+}
+
+func TestResolvePortConflictsConfiguredOwner(t *testing.T) {
+	extensions := newConflictingExtensions()
+	api.SortExtensions(extensions)
+
+	// an owner not claiming the port is ignored
+	conflicts := api.ResolvePortConflicts(extensions, map[string]string{"9090": "thrift", "10000": "redis"})
+	expected := []api.PortConflict{
+		{Port: "9090", Extensions: []string{"custom", "thrift"}, Selected: "thrift", Configured: true},
+		{Port: "10000", Extensions: []string{"http", "custom"}, Selected: "http"},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, conflicts)
+	}
+
+	tests := []struct {
+		extension string
+		port      string
+		expected  bool
+	}{
+		{extension: "thrift", port: "9090", expected: true},
+		{extension: "custom", port: "9090", expected: false},
+		{extension: "http", port: "9090", expected: true},
+		{extension: "custom", port: "10000", expected: false},
+		{extension: "custom", port: "8080", expected: true},
+	}
+	for _, test := range tests {
+		extension := &api.Extension{Protocol: &api.Protocol{Name: test.extension}}
+		if actual := api.ShouldDissectPort(extension, test.port, conflicts); actual != test.expected {
+			t.Errorf("unexpected result - expected: %v, actual: %v for %v on %v", test.expected, actual, test.extension, test.port)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+// IsExtensionEnabled returns whether to keep the loaded extension by the names of its protocol and extra protocols.
+// Only the extensions named in enabledProtocols are kept when it isn't empty, and the ones named in disabledProtocols
+// are never kept, since the dissector emits all of its protocols.
+func IsExtensionEnabled(extension *Extension, enabledProtocols []string, disabledProtocols []string) bool {
+	if len(enabledProtocols) > 0 && !isExtensionNamed(extension, enabledProtocols) {
+		return false
+	}
+	return !isExtensionNamed(extension, disabledProtocols)
+}
+
+// MissingProtocols returns the protocol names that none of the extensions is named by, in their order
+func MissingProtocols(extensions []*Extension, protocolNames []string) []string {
+	missing := make([]string, 0)
+	for _, protocolName := range protocolNames {
+		isFound := false
+		for _, extension := range extensions {
+			if isExtensionNamed(extension, []string{protocolName}) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound && !containsProtocol(missing, protocolName) {
+			missing = append(missing, protocolName)
+		}
+	}
+	return missing
+}
+
+// isExtensionNamed returns whether the protocol or one of the extra protocols of the extension is in protocolNames
+func isExtensionNamed(extension *Extension, protocolNames []string) bool {
+	if containsProtocol(protocolNames, extension.Protocol.Name) {
+		return true
+	}
+	for _, extraProtocol := range extension.ExtraProtocols {
+		if containsProtocol(protocolNames, extraProtocol.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsProtocol(protocolNames []string, protocolName string) bool {
+	for _, name := range protocolNames {
+		if name == protocolName {
+			return true
+		}
+	}
+	return false
+}
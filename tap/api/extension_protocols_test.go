@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+func TestIsExtensionEnabled(t *testing.T) {
+	extensions := []*api.Extension{
+		{Protocol: &api.Protocol{Name: "amqp"}},
+		{Protocol: &api.Protocol{Name: "http"}, ExtraProtocols: []*api.Protocol{{Name: "websocket"}}},
+		{Protocol: &api.Protocol{Name: "kafka"}},
+	}
+
+	tests := []struct {
+		name              string
+		enabledProtocols  []string
+		disabledProtocols []string
+		expectedEnabled   []string
+	}{
+		{name: "no lists", expectedEnabled: []string{"amqp", "http", "kafka"}},
+		{name: "allowlist", enabledProtocols: []string{"kafka", "amqp"}, expectedEnabled: []string{"amqp", "kafka"}},
+		{name: "denylist", disabledProtocols: []string{"http"}, expectedEnabled: []string{"amqp", "kafka"}},
+		{name: "allowlist by extra protocol", enabledProtocols: []string{"websocket"}, expectedEnabled: []string{"http"}},
+		{name: "denylist by extra protocol", disabledProtocols: []string{"websocket"}, expectedEnabled: []string{"amqp", "kafka"}},
+		{name: "denylist over allowlist", enabledProtocols: []string{"amqp", "http"}, disabledProtocols: []string{"http"}, expectedEnabled: []string{"amqp"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enabled := make([]string, 0)
+			for _, extension := range extensions {
+				if api.IsExtensionEnabled(extension, test.enabledProtocols, test.disabledProtocols) {
+					enabled = append(enabled, extension.Protocol.Name)
+				}
+			}
+			if !reflect.DeepEqual(enabled, test.expectedEnabled) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedEnabled, enabled)
+			}
+		})
+	}
+}
+
+func TestMissingProtocols(t *testing.T) {
+	extensions := []*api.Extension{
+		{Protocol: &api.Protocol{Name: "amqp"}},
+		{Protocol: &api.Protocol{Name: "http"}, ExtraProtocols: []*api.Protocol{{Name: "websocket"}}},
+	}
+
+	missing := api.MissingProtocols(extensions, []string{"grpc", "http", "websocket", "smtp", "grpc"})
+	if expected := []string{"grpc", "smtp"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expected, missing)
+	}
+}
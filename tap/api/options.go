@@ -4,4 +4,10 @@ type TrafficFilteringOptions struct {
 	IgnoredUserAgents       []string
 	PlainTextMaskingRegexes []*SerializableRegexp
 	DisableRedaction        bool
+	ExtensionPortOwners     map[string]string // the extension dissecting a port claimed by several extensions, by port
+	ProtocolAllowlist       []string          // the names of the protocols kept by the filtering, all of them when empty
+	IgnoredPathPatterns     []string          // regexes of the request paths of the http entries dropped, e.g. ^/health$
+	MaxEntriesPerSecond     int               // the entries kept per second beyond which the rate limiting engages, unlimited when 0
+	RateLimitSampleEvery    int               // 1 in RateLimitSampleEvery entries over the rate limit is kept, all of them are dropped when 0
+	MaxBodySize             int64             // the bytes of the request and response bodies kept by the dissection, the rest is dropped, unlimited when 0
 }
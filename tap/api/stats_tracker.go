@@ -14,6 +14,7 @@ type AppStats struct {
 	TlsConnectionsCount         uint64    `json:"tlsConnectionsCount"`
 	MatchedPairs                uint64    `json:"matchedPairs"`
 	DroppedTcpStreams           uint64    `json:"droppedTcpStreams"`
+	PausedTcpStreams            uint64    `json:"pausedTcpStreams"`
 }
 
 func (as *AppStats) IncMatchedPairs() {
@@ -24,6 +25,10 @@ func (as *AppStats) IncDroppedTcpStreams() {
 	atomic.AddUint64(&as.DroppedTcpStreams, 1)
 }
 
+func (as *AppStats) IncPausedTcpStreams() {
+	atomic.AddUint64(&as.PausedTcpStreams, 1)
+}
+
 func (as *AppStats) IncPacketsCount() uint64 {
 	atomic.AddUint64(&as.PacketsCount, 1)
 	return as.PacketsCount
@@ -59,6 +64,7 @@ func (as *AppStats) DumpStats() *AppStats {
 	currentAppStats.TlsConnectionsCount = resetUint64(&as.TlsConnectionsCount)
 	currentAppStats.MatchedPairs = resetUint64(&as.MatchedPairs)
 	currentAppStats.DroppedTcpStreams = resetUint64(&as.DroppedTcpStreams)
+	currentAppStats.PausedTcpStreams = resetUint64(&as.PausedTcpStreams)
 
 	return currentAppStats
 }
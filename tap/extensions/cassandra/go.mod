@@ -0,0 +1,11 @@
+module github.com/up9inc/mizu/tap/extensions/cassandra
+
+go 1.16
+
+require (
+	github.com/golang/snappy v0.0.1
+	github.com/pierrec/lz4 v2.6.0+incompatible
+	github.com/up9inc/mizu/tap/api v0.0.0
+)
+
+replace github.com/up9inc/mizu/tap/api v0.0.0 => ../../api
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+type CassandraPayload struct {
+	Data interface{}
+}
+
+type CassandraPayloader interface {
+	MarshalJSON() ([]byte, error)
+}
+
+func (h CassandraPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Data)
+}
+
+type CassandraWrapper struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Details interface{} `json:"details"`
+}
+
+// cassandraPair is the stored form of a request and its response
+type cassandraPair struct {
+	Request struct {
+		Payload struct {
+			Details CassandraMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		Payload struct {
+			Details CassandraMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+func representRequest(message *CassandraMessage) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Opcode", "value": message.Opcode},
+	}
+	if message.Consistency != "" {
+		details = append(details, map[string]string{"name": "Consistency", "value": message.Consistency})
+	}
+	if message.PreparedId != "" {
+		details = append(details, map[string]string{"name": "Prepared Id", "value": message.PreparedId})
+	}
+	if message.Values > 0 {
+		details = append(details, map[string]string{"name": "Values", "value": strconv.Itoa(message.Values)})
+	}
+	if message.BatchType != "" {
+		details = append(details, []map[string]string{
+			{"name": "Batch Type", "value": message.BatchType},
+			{"name": "Statements", "value": strconv.Itoa(message.Statements)},
+		}...)
+	}
+	if len(message.Events) > 0 {
+		details = append(details, map[string]string{"name": "Events", "value": strings.Join(message.Events, ", ")})
+	}
+	details = append(details, representOptions(message.Options)...)
+	details = append(details, representCommon(message)...)
+	representation = append(representation, representTable("Details", details))
+
+	if message.Query != "" {
+		title := "Query"
+		if message.Redacted {
+			title = "Query (redacted)"
+		}
+		representation = append(representation, map[string]string{
+			"type":      api.BODY,
+			"title":     title,
+			"encoding":  "",
+			"mime_type": "text/plain",
+			"data":      message.Query,
+		})
+	}
+	return
+}
+
+func representResponse(message *CassandraMessage) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Opcode", "value": message.Opcode},
+	}
+	if message.ResultKind != "" {
+		details = append(details, map[string]string{"name": "Result Kind", "value": message.ResultKind})
+	}
+	if message.ResultKind == resultKindNames[resultKindRows] {
+		details = append(details, []map[string]string{
+			{"name": "Rows", "value": strconv.Itoa(message.Rows)},
+			{"name": "Columns", "value": strconv.Itoa(message.Columns)},
+		}...)
+	}
+	if message.Keyspace != "" {
+		details = append(details, map[string]string{"name": "Keyspace", "value": message.Keyspace})
+	}
+	if message.SchemaChange != "" {
+		details = append(details, map[string]string{"name": "Schema Change", "value": message.SchemaChange})
+	}
+	if message.PreparedId != "" {
+		details = append(details, map[string]string{"name": "Prepared Id", "value": message.PreparedId})
+	}
+	if message.ErrorCode != "" {
+		details = append(details, []map[string]string{
+			{"name": "Error Code", "value": message.ErrorCode},
+			{"name": "Error", "value": message.Error},
+		}...)
+	}
+	if message.TracingId != "" {
+		details = append(details, map[string]string{"name": "Tracing Id", "value": message.TracingId})
+	}
+	if len(message.Warnings) > 0 {
+		details = append(details, map[string]string{"name": "Warnings", "value": strings.Join(message.Warnings, "\n")})
+	}
+	details = append(details, representOptions(message.Options)...)
+	details = append(details, representCommon(message)...)
+	return append(representation, representTable("Details", details))
+}
+
+func representOptions(options map[string]string) []map[string]string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, map[string]string{"name": name, "value": options[name]})
+	}
+	return rows
+}
+
+func representCommon(message *CassandraMessage) []map[string]string {
+	common := []map[string]string{
+		{"name": "Version", "value": strconv.Itoa(message.Version)},
+		{"name": "Stream", "value": strconv.Itoa(int(message.Stream))},
+	}
+	if message.Compression != "" {
+		common = append(common, map[string]string{"name": "Compression", "value": message.Compression})
+	}
+	return append(common, map[string]string{"name": "Size", "value": strconv.Itoa(message.Size)})
+}
+
+func representTable(title string, rows []map[string]string) map[string]string {
+	data, _ := json.Marshal(rows)
+	return map[string]string{
+		"type":  api.TABLE,
+		"title": title,
+		"data":  string(data),
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var protocol api.Protocol = api.Protocol{
+	Name:            "cassandra",
+	LongName:        "Cassandra Native Protocol",
+	Abbreviation:    "CQL",
+	Version:         "4",
+	BackgroundColor: "#1287b1",
+	ForegroundColor: "#ffffff",
+	FontSize:        11,
+	ReferenceLink:   "https://github.com/apache/cassandra/blob/trunk/doc/native_protocol_v4.spec",
+	Ports:           []string{"9042"},
+	Priority:        3,
+}
+
+func init() {
+	log.Println("Initializing Cassandra extension...")
+}
+
+type dissecting string
+
+func (d dissecting) Register(extension *api.Extension) {
+	extension.Protocol = &protocol
+	extension.MatcherMap = reqResMatcher.openMessagesMap
+}
+
+func (d dissecting) Ping() {
+	log.Printf("pong %s\n", protocol.Name)
+}
+
+func (d dissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, superIdentifier *api.SuperIdentifier, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	serverPort := tcpID.DstPort
+	if !isClient {
+		serverPort = tcpID.SrcPort
+	}
+	if !isCassandraPort(serverPort) {
+		return fmt.Errorf("port %s isn't a Cassandra port", serverPort)
+	}
+
+	for {
+		message, err := ReadMessage(b, isClient, !options.DisableRedaction)
+		if err != nil {
+			return err
+		}
+
+		if isClient {
+			handleClientStream(tcpID, counterPair, superTimer, emitter, message)
+		} else {
+			handleServerStream(tcpID, counterPair, superTimer, emitter, message)
+		}
+	}
+}
+
+func isCassandraPort(port string) bool {
+	for _, cassandraPort := range protocol.Ports {
+		if port == cassandraPort {
+			return true
+		}
+	}
+	return false
+}
+
+func (d dissecting) Analyze(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	entryBytes, _ := json.Marshal(item.Pair)
+	var pair cassandraPair
+	json.Unmarshal(entryBytes, &pair)
+	request := &pair.Request.Payload.Details
+
+	service := "cassandra"
+	if resolvedDestination != "" {
+		service = resolvedDestination
+	} else if resolvedSource != "" {
+		service = resolvedSource
+	}
+
+	elapsedTime := item.Pair.Response.CaptureTime.Sub(item.Pair.Request.CaptureTime).Round(time.Millisecond).Milliseconds()
+	return &api.MizuEntry{
+		ProtocolName:            protocol.Name,
+		ProtocolLongName:        protocol.LongName,
+		ProtocolAbbreviation:    protocol.Abbreviation,
+		ProtocolVersion:         protocol.Version,
+		ProtocolBackgroundColor: protocol.BackgroundColor,
+		ProtocolForegroundColor: protocol.ForegroundColor,
+		ProtocolFontSize:        protocol.FontSize,
+		ProtocolReferenceLink:   protocol.ReferenceLink,
+		EntryId:                 entryId,
+		Entry:                   string(entryBytes),
+		Url:                     fmt.Sprintf("%s/%s", service, request.Consistency),
+		Method:                  request.Opcode,
+		Status:                  0,
+		RequestSenderIp:         item.ConnectionInfo.ClientIP,
+		Service:                 service,
+		Timestamp:               item.Timestamp,
+		ElapsedTime:             elapsedTime,
+		Path:                    request.Query,
+		ResolvedSource:          resolvedSource,
+		ResolvedDestination:     resolvedDestination,
+		SourceIp:                item.ConnectionInfo.ClientIP,
+		DestinationIp:           item.ConnectionInfo.ServerIP,
+		SourcePort:              item.ConnectionInfo.ClientPort,
+		DestinationPort:         item.ConnectionInfo.ServerPort,
+		IsOutgoing:              item.ConnectionInfo.IsOutgoing,
+	}
+}
+
+func (d dissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
+	return &api.BaseEntryDetails{
+		Id:              entry.EntryId,
+		Protocol:        protocol,
+		Url:             entry.Url,
+		RequestSenderIp: entry.RequestSenderIp,
+		Service:         entry.Service,
+		Summary:         entry.Path,
+		StatusCode:      entry.Status,
+		Method:          entry.Method,
+		Timestamp:       entry.Timestamp,
+		SourceIp:        entry.SourceIp,
+		DestinationIp:   entry.DestinationIp,
+		SourcePort:      entry.SourcePort,
+		DestinationPort: entry.DestinationPort,
+		IsOutgoing:      entry.IsOutgoing,
+		Latency:         entry.ElapsedTime,
+		Rules: api.ApplicableRules{
+			Latency: 0,
+			Status:  false,
+		},
+	}
+}
+
+func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []byte, bodySize int64, err error) {
+	p = protocol
+	var pair cassandraPair
+	if err = json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return
+	}
+	bodySize = int64(pair.Response.Payload.Details.Size)
+
+	representation := map[string]interface{}{
+		"request":  representRequest(&pair.Request.Payload.Details),
+		"response": representResponse(&pair.Response.Payload.Details),
+	}
+	object, err = json.Marshal(representation)
+	return
+}
+
+var Dissector dissecting
+
+var ApiVersion = api.ApiVersion
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/pierrec/lz4"
+	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/api/apitest"
+)
+
+func frame(isResponse bool, flags byte, stream int16, opcode byte, body []byte) string {
+	header := make([]byte, frameHeaderSize)
+	header[0] = 4
+	if isResponse {
+		header[0] |= responseDirection
+	}
+	header[1] = flags
+	binary.BigEndian.PutUint16(header[2:4], uint16(stream))
+	header[4] = opcode
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(body)))
+	return string(header) + string(body)
+}
+
+func shortBytes(value uint16) []byte {
+	valueBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(valueBytes, value)
+	return valueBytes
+}
+
+func intBytes(value int32) []byte {
+	valueBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(valueBytes, uint32(value))
+	return valueBytes
+}
+
+func stringBytes(value string) []byte {
+	return append(shortBytes(uint16(len(value))), value...)
+}
+
+func longStringBytes(value string) []byte {
+	return append(intBytes(int32(len(value))), value...)
+}
+
+func body(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// lz4Body compresses a body as the lz4 compressor of cassandra does, an incompressible body is a single literal run
+func lz4Body(uncompressed []byte) []byte {
+	compressed := make([]byte, lz4.CompressBlockBound(len(uncompressed)))
+	n, err := lz4.CompressBlock(uncompressed, compressed, nil)
+	if err != nil {
+		panic("failed to compress the test body")
+	}
+	if n == 0 {
+		compressed = []byte{0xf0}
+		for length := len(uncompressed) - 15; ; length -= 255 {
+			if length < 255 {
+				compressed = append(compressed, byte(length))
+				break
+			}
+			compressed = append(compressed, 255)
+		}
+		compressed = append(compressed, uncompressed...)
+		n = len(compressed)
+	}
+	return append(intBytes(int32(len(uncompressed))), compressed[:n]...)
+}
+
+var preparedId = []byte{0xca, 0xfe}
+
+var (
+	selectQuery     = "SELECT name FROM shop.users WHERE email = 'jane@example.com' AND token = 0xdeadbeef"
+	selectRows      = body(intBytes(resultKindRows), intBytes(0x0001), intBytes(1), stringBytes("shop"), stringBytes("users"), stringBytes("name"), shortBytes(0x000d), intBytes(2), intBytes(4), []byte("jane"), intBytes(4), []byte("john"))
+	insertQuery     = "INSERT INTO shop.orders (id, total) VALUES (?, ?)"
+	compressedQuery = "UPDATE shop.carts SET items = items + ['book', 'pen', 'book', 'pen'] WHERE id = 7"
+)
+
+var capturedClientStream = "" +
+	frame(false, 0, 0, opcodeStartup, body(shortBytes(2), stringBytes("CQL_VERSION"), stringBytes("3.0.0"), stringBytes("COMPRESSION"), stringBytes("lz4"))) +
+	frame(false, 0, 1, opcodeQuery, body(longStringBytes(selectQuery), shortBytes(0x0006), []byte{0x00})) +
+	frame(false, 0, 2, opcodePrepare, body(longStringBytes(insertQuery))) +
+	// two bound values
+	frame(false, 0, 3, opcodeExecute, body(stringBytes(string(preparedId)), shortBytes(0x0004), []byte{0x01}, shortBytes(2), intBytes(1), []byte{7}, intBytes(-1))) +
+	frame(false, flagCompression, 4, opcodeQuery, lz4Body(body(longStringBytes(compressedQuery), shortBytes(0x000a), []byte{0x00}))) +
+	frame(false, flagCompression, 5, opcodeQuery, snappy.Encode(nil, body(longStringBytes("SELECT * FROM missing"), shortBytes(0x0001), []byte{0x00})))
+
+var capturedServerStream = "" +
+	frame(true, 0, 0, opcodeReady, nil) +
+	// a pushed event, it doesn't respond to a request
+	frame(true, 0, eventStream, opcodeEvent, body(stringBytes("STATUS_CHANGE"), stringBytes("UP"))) +
+	// the responses are out of order
+	frame(true, 0, 2, opcodeResult, body(intBytes(resultKindPrepared), stringBytes(string(preparedId)))) +
+	frame(true, 0, 1, opcodeResult, selectRows) +
+	frame(true, 0, 3, opcodeResult, body(intBytes(resultKindVoid))) +
+	frame(true, flagCompression, 4, opcodeResult, lz4Body(body(intBytes(resultKindVoid)))) +
+	frame(true, flagCompression, 5, opcodeError, snappy.Encode(nil, body(intBytes(0x2200), stringBytes("unconfigured table missing"))))
+
+func resetOpenMessages() {
+	reqResMatcher.openMessagesMap.Range(func(key, _ interface{}) bool {
+		reqResMatcher.openMessagesMap.Delete(key)
+		return true
+	})
+}
+
+// dissectSession feeds a captured session, the client stream first so the PREPARE is known by the EXECUTE
+func dissectSession(t *testing.T, clientStream string, serverStream string, options *api.TrafficFilteringOptions) ([]*api.MizuEntry, error, error) {
+	resetOpenMessages()
+	return apitest.DissectSession(t, Dissector, &apitest.Session{ClientStream: clientStream, ServerStream: serverStream, ServerPort: "9042", IsClientFirst: true, Options: options, ResolvedDestination: "cassandra.default"})
+}
+
+func getPair(t *testing.T, entry *api.MizuEntry) *cassandraPair {
+	var pair cassandraPair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	return &pair
+}
+
+func TestDissect(t *testing.T) {
+	entries, clientErr, serverErr := dissectSession(t, capturedClientStream, capturedServerStream, &api.TrafficFilteringOptions{})
+	if clientErr != io.EOF || serverErr != io.EOF {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", io.EOF, clientErr, serverErr)
+	}
+
+	expected := []struct {
+		opcode         string
+		query          string
+		consistency    string
+		compression    string
+		responseOpcode string
+		resultKind     string
+		errorCode      string
+	}{
+		{opcode: "STARTUP", responseOpcode: "READY"},
+		{opcode: "PREPARE", query: insertQuery, responseOpcode: "RESULT", resultKind: "Prepared"},
+		{opcode: "QUERY", query: "SELECT name FROM shop.users WHERE email = ? AND token = ?", consistency: "LOCAL_QUORUM", responseOpcode: "RESULT", resultKind: "Rows"},
+		{opcode: "EXECUTE", query: insertQuery, consistency: "QUORUM", responseOpcode: "RESULT", resultKind: "Void"},
+		{opcode: "QUERY", query: "UPDATE shop.carts SET items = items + [?, ?, ?, ?] WHERE id = 7", consistency: "LOCAL_ONE", compression: "lz4", responseOpcode: "RESULT", resultKind: "Void"},
+		{opcode: "QUERY", query: "SELECT * FROM missing", consistency: "ONE", compression: "snappy", responseOpcode: "ERROR", errorCode: "Invalid"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		pair := getPair(t, entry)
+		request, response := &pair.Request.Payload.Details, &pair.Response.Payload.Details
+		if entry.Method != expected[i].opcode || entry.Path != expected[i].query || request.Consistency != expected[i].consistency || request.Compression != expected[i].compression {
+			t.Errorf("unexpected result - expected: %v %v %v %v, actual: %v %v %v %v", expected[i].opcode, expected[i].query, expected[i].consistency, expected[i].compression, entry.Method, entry.Path, request.Consistency, request.Compression)
+		}
+		if response.Opcode != expected[i].responseOpcode || response.ResultKind != expected[i].resultKind || response.ErrorCode != expected[i].errorCode {
+			t.Errorf("unexpected result - expected: %v %v %v, actual: %v %v %v", expected[i].responseOpcode, expected[i].resultKind, expected[i].errorCode, response.Opcode, response.ResultKind, response.ErrorCode)
+		}
+	}
+
+	startup := getPair(t, entries[0]).Request.Payload.Details
+	if startup.Options["COMPRESSION"] != "lz4" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "lz4", startup.Options)
+	}
+	execute := getPair(t, entries[3]).Request.Payload.Details
+	if execute.PreparedId != "cafe" || execute.Values != 2 {
+		t.Errorf("unexpected result - expected: %v %v, actual: %v %v", "cafe", 2, execute.PreparedId, execute.Values)
+	}
+	rows := getPair(t, entries[2]).Response.Payload.Details
+	if rows.Rows != 2 || rows.Columns != 1 || rows.Keyspace != "shop" {
+		t.Errorf("unexpected result - expected: %v %v %v, actual: %v %v %v", 2, 1, "shop", rows.Rows, rows.Columns, rows.Keyspace)
+	}
+}
+
+func TestDissectWithoutRedaction(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedClientStream, capturedServerStream, &api.TrafficFilteringOptions{DisableRedaction: true})
+	if len(entries) < 3 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 3, len(entries))
+	}
+	if entries[2].Path != selectQuery || getPair(t, entries[2]).Request.Payload.Details.Redacted {
+		t.Errorf("unexpected result - expected: %v, actual: %v", selectQuery, entries[2].Path)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		query            string
+		expectedQuery    string
+		expectedRedacted bool
+	}{
+		{query: "SELECT * FROM users WHERE id = ?", expectedQuery: "SELECT * FROM users WHERE id = ?", expectedRedacted: false},
+		{query: "SELECT * FROM users WHERE name = 'O''Brien'", expectedQuery: "SELECT * FROM users WHERE name = ?", expectedRedacted: true},
+		{query: "INSERT INTO t (a, b) VALUES ($$it's$$, 0xFF)", expectedQuery: "INSERT INTO t (a, b) VALUES (?, ?)", expectedRedacted: true},
+		{query: "SELECT col0x1 FROM t WHERE b = 'unterminated", expectedQuery: "SELECT col0x1 FROM t WHERE b = ?", expectedRedacted: true},
+	}
+
+	for _, test := range tests {
+		query, redacted := redactQuery(test.query)
+		if query != test.expectedQuery || redacted != test.expectedRedacted {
+			t.Errorf("unexpected result - expected: %v %v, actual: %v %v", test.expectedQuery, test.expectedRedacted, query, redacted)
+		}
+	}
+}
+
+func TestDissectNotCassandra(t *testing.T) {
+	_, clientErr, _ := dissectSession(t, "GET / HTTP/1.1\r\n\r\n", "", &api.TrafficFilteringOptions{})
+	if clientErr == nil || clientErr == io.EOF {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "an error", clientErr)
+	}
+}
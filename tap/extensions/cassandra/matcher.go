@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var reqResMatcher = createResponseRequestMatcher() // global
+
+// maxPreparedQueries bounds the queries remembered for the EXECUTEs, the prepared ids of a service are few
+const maxPreparedQueries = 10000
+
+var (
+	preparedQueries      = &sync.Map{}
+	preparedQueriesCount int64
+)
+
+// Key is {client_addr}:{client_port}->{dest_addr}:{dest_port},{stream}
+// the responses are matched by the stream id of their request, the server may respond out of order
+type requestResponseMatcher struct {
+	openMessagesMap *sync.Map
+}
+
+func createResponseRequestMatcher() requestResponseMatcher {
+	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}}
+	return *newMatcher
+}
+
+func (matcher *requestResponseMatcher) registerRequest(ident string, message *CassandraMessage, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	requestCassandraMessage := api.GenericMessage{
+		IsRequest:   true,
+		CaptureTime: captureTime,
+		Payload: CassandraPayload{
+			Data: &CassandraWrapper{
+				Method:  message.Opcode,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	if response, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		responseCassandraMessage := response.(*api.GenericMessage)
+		if responseCassandraMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(&requestCassandraMessage, responseCassandraMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &requestCassandraMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) registerResponse(ident string, message *CassandraMessage, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	responseCassandraMessage := api.GenericMessage{
+		IsRequest:   false,
+		CaptureTime: captureTime,
+		Payload: CassandraPayload{
+			Data: &CassandraWrapper{
+				Method:  message.Opcode,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	if request, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		requestCassandraMessage := request.(*api.GenericMessage)
+		if !requestCassandraMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(requestCassandraMessage, &responseCassandraMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &responseCassandraMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) preparePair(requestCassandraMessage *api.GenericMessage, responseCassandraMessage *api.GenericMessage) *api.OutputChannelItem {
+	request := requestCassandraMessage.Payload.(CassandraPayload).Data.(*CassandraWrapper).Details.(*CassandraMessage)
+	response := responseCassandraMessage.Payload.(CassandraPayload).Data.(*CassandraWrapper).Details.(*CassandraMessage)
+	resolvePreparedQuery(request, response)
+
+	return &api.OutputChannelItem{
+		Protocol:       protocol,
+		Timestamp:      requestCassandraMessage.CaptureTime.UnixNano() / int64(time.Millisecond),
+		ConnectionInfo: nil,
+		Pair: &api.RequestResponsePair{
+			Request:  *requestCassandraMessage,
+			Response: *responseCassandraMessage,
+		},
+	}
+}
+
+// resolvePreparedQuery remembers the query of a PREPARE by the id it was returned, and gives it to the EXECUTEs and
+// the BATCHes of that id
+func resolvePreparedQuery(request *CassandraMessage, response *CassandraMessage) {
+	if request.Opcode == opcodeNames[opcodePrepare] && response.PreparedId != "" {
+		if _, loaded := preparedQueries.LoadOrStore(response.PreparedId, request.Query); !loaded {
+			if atomic.AddInt64(&preparedQueriesCount, 1) > maxPreparedQueries {
+				preparedQueries.Delete(response.PreparedId)
+				atomic.AddInt64(&preparedQueriesCount, -1)
+			}
+		}
+		return
+	}
+	if request.Query == "" && request.PreparedId != "" {
+		if query, ok := preparedQueries.Load(request.PreparedId); ok {
+			request.Query = query.(string)
+		}
+	}
+}
+
+func splitIdent(ident string) []string {
+	ident = strings.Replace(ident, "->", " ", -1)
+	return strings.Split(ident, " ")
+}
+
+func genKey(split []string) string {
+	key := fmt.Sprintf("%s:%s->%s:%s,%s", split[0], split[2], split[1], split[3], split[4])
+	return key
+}
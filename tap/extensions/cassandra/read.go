@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/pierrec/lz4"
+)
+
+const (
+	maxBodySize         = 256 * 1024 * 1024
+	maxParsedBodySize   = 16 * 1024 * 1024
+	maxUncompressedSize = 64 * 1024 * 1024
+)
+
+var errBodyTooShort = errors.New("cassandra frame body too short")
+
+// ReadMessage reads a frame of the native protocol, a 9 bytes header followed by the body. Bodies larger than
+// maxParsedBodySize are skipped, the message only has what the header tells.
+func ReadMessage(b *bufio.Reader, isClient bool, redact bool) (*CassandraMessage, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(b, header); err != nil {
+		return nil, err
+	}
+
+	version := int(header[0] &^ responseDirection)
+	if version < minVersion || version > maxVersion {
+		return nil, fmt.Errorf("unsupported cassandra protocol version 0x%02x", header[0])
+	}
+	isResponse := header[0]&responseDirection != 0
+	if isResponse == isClient {
+		return nil, fmt.Errorf("unexpected cassandra frame direction 0x%02x", header[0])
+	}
+	flags := header[1]
+	opcode := header[4]
+	if _, ok := opcodeNames[opcode]; !ok || requestOpcodes[opcode] != isClient {
+		return nil, fmt.Errorf("unexpected cassandra opcode 0x%02x", opcode)
+	}
+	bodyLength := int(binary.BigEndian.Uint32(header[5:9]))
+	if bodyLength > maxBodySize {
+		return nil, fmt.Errorf("invalid cassandra body length %d", bodyLength)
+	}
+
+	message := &CassandraMessage{
+		Version: version,
+		Stream:  int16(binary.BigEndian.Uint16(header[2:4])),
+		Opcode:  opcodeNames[opcode],
+		Size:    frameHeaderSize + bodyLength,
+	}
+	if bodyLength > maxParsedBodySize {
+		_, err := b.Discard(bodyLength)
+		return message, err
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err := io.ReadFull(b, body); err != nil {
+		return nil, err
+	}
+	if flags&flagCompression != 0 && bodyLength > 0 {
+		var err error
+		if body, message.Compression, err = decompressBody(body); err != nil {
+			// the stream is still in sync, only this body can't be read
+			return message, nil
+		}
+	}
+
+	reader := &bodyReader{data: body}
+	if isResponse && flags&flagTracing != 0 {
+		message.TracingId = hex.EncodeToString(reader.readN(16))
+	}
+	if isResponse && flags&flagWarning != 0 {
+		message.Warnings = reader.readStringList()
+	}
+	if flags&flagCustomPayload != 0 {
+		reader.skipBytesMap()
+	}
+	if isResponse {
+		readResponseBody(message, opcode, reader)
+	} else {
+		readRequestBody(message, opcode, reader)
+		if redact && message.Query != "" {
+			message.Query, message.Redacted = redactQuery(message.Query)
+		}
+	}
+	return message, nil
+}
+
+// decompressBody decompresses a body with the algorithm negotiated in the STARTUP. The algorithm is told by the body
+// itself, since the STARTUP is often not captured: an lz4 body starts with its uncompressed length.
+func decompressBody(body []byte) ([]byte, string, error) {
+	if len(body) > 4 {
+		uncompressedSize := int(binary.BigEndian.Uint32(body[0:4]))
+		if uncompressedSize <= maxUncompressedSize {
+			uncompressed := make([]byte, uncompressedSize)
+			if n, err := lz4.UncompressBlock(body[4:], uncompressed); err == nil && n == uncompressedSize {
+				return uncompressed, "lz4", nil
+			}
+		}
+	}
+	if uncompressedSize, err := snappy.DecodedLen(body); err == nil && uncompressedSize <= maxUncompressedSize {
+		if uncompressed, err := snappy.Decode(nil, body); err == nil {
+			return uncompressed, "snappy", nil
+		}
+	}
+	return nil, "", errors.New("unknown cassandra compression")
+}
+
+func readRequestBody(message *CassandraMessage, opcode byte, reader *bodyReader) {
+	switch opcode {
+	case opcodeStartup:
+		message.Options = reader.readStringMap()
+	case opcodeQuery:
+		message.Query = reader.readLongString()
+		readQueryParameters(message, reader)
+	case opcodePrepare:
+		message.Query = reader.readLongString()
+	case opcodeExecute:
+		message.PreparedId = hex.EncodeToString(reader.readShortBytes())
+		readQueryParameters(message, reader)
+	case opcodeRegister:
+		message.Events = reader.readStringList()
+	case opcodeBatch:
+		readBatch(message, reader)
+	}
+}
+
+// readQueryParameters reads the consistency and the values count of a QUERY or an EXECUTE, the rest of the
+// parameters are skipped
+func readQueryParameters(message *CassandraMessage, reader *bodyReader) {
+	message.Consistency = getConsistencyName(reader.readShort())
+	flags := reader.readByte()
+	if flags&0x01 != 0 {
+		message.Values = int(reader.readShort())
+	}
+}
+
+// readBatch reads the statements of a BATCH, the query of the batch is the one of its first statement
+func readBatch(message *CassandraMessage, reader *bodyReader) {
+	message.BatchType = batchTypeNames[reader.readByte()]
+	message.Statements = int(reader.readShort())
+	for i := 0; i < message.Statements && reader.err == nil; i++ {
+		kind := reader.readByte()
+		if kind == 0 {
+			query := reader.readLongString()
+			if i == 0 {
+				message.Query = query
+			}
+		} else {
+			preparedId := hex.EncodeToString(reader.readShortBytes())
+			if i == 0 {
+				message.PreparedId = preparedId
+			}
+		}
+		values := int(reader.readShort())
+		for j := 0; j < values && reader.err == nil; j++ {
+			reader.skipBytes()
+		}
+	}
+	message.Consistency = getConsistencyName(reader.readShort())
+}
+
+func readResponseBody(message *CassandraMessage, opcode byte, reader *bodyReader) {
+	switch opcode {
+	case opcodeError:
+		code := reader.readInt()
+		message.ErrorCode = getErrorCodeName(code)
+		message.Error = reader.readString()
+	case opcodeResult:
+		kind := reader.readInt()
+		message.ResultKind = getResultKindName(kind)
+		switch kind {
+		case resultKindRows:
+			readRows(message, reader)
+		case resultKindSetKeyspace:
+			message.Keyspace = reader.readString()
+		case resultKindPrepared:
+			message.PreparedId = hex.EncodeToString(reader.readShortBytes())
+		case resultKindSchemaChange:
+			// <change_type><target><options>, the options start with the keyspace
+			changeType := reader.readString()
+			message.SchemaChange = fmt.Sprintf("%s %s", changeType, reader.readString())
+			message.Keyspace = reader.readString()
+		}
+	case opcodeAuthenticate:
+		message.Options = map[string]string{"authenticator": reader.readString()}
+	}
+}
+
+// readRows reads the metadata of a Rows result to get to its rows count
+func readRows(message *CassandraMessage, reader *bodyReader) {
+	flags := reader.readInt()
+	message.Columns = int(reader.readInt())
+	hasGlobalTableSpec := flags&0x0001 != 0
+	hasMorePages := flags&0x0002 != 0
+	noMetadata := flags&0x0004 != 0
+	if hasMorePages {
+		reader.skipBytes()
+	}
+	if !noMetadata {
+		if hasGlobalTableSpec {
+			message.Keyspace = reader.readString()
+			reader.readString()
+		}
+		for i := 0; i < message.Columns && reader.err == nil; i++ {
+			if !hasGlobalTableSpec {
+				keyspace := reader.readString()
+				reader.readString()
+				if i == 0 {
+					message.Keyspace = keyspace
+				}
+			}
+			reader.readString()
+			reader.skipOption()
+		}
+	}
+	message.Rows = int(reader.readInt())
+}
+
+// redactQuery replaces the string, blob and dollar quoted literals of a query by bind markers
+func redactQuery(query string) (string, bool) {
+	var redacted strings.Builder
+	isRedacted := false
+	for i := 0; i < len(query); {
+		switch {
+		case query[i] == '\'':
+			// '' escapes a quote inside a string literal
+			end := i + 1
+			for end < len(query) {
+				if query[end] == '\'' {
+					if end+1 < len(query) && query[end+1] == '\'' {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			redacted.WriteByte('?')
+			isRedacted = true
+			i = end + 1
+		case strings.HasPrefix(query[i:], "$$"):
+			end := strings.Index(query[i+2:], "$$")
+			redacted.WriteByte('?')
+			isRedacted = true
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+		case query[i] == '0' && i+1 < len(query) && (query[i+1] == 'x' || query[i+1] == 'X') && (i == 0 || !isIdentifierByte(query[i-1])):
+			end := i + 2
+			for end < len(query) && isHexByte(query[end]) {
+				end++
+			}
+			redacted.WriteByte('?')
+			isRedacted = true
+			i = end
+		default:
+			redacted.WriteByte(query[i])
+			i++
+		}
+	}
+	return redacted.String(), isRedacted
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHexByte(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func getConsistencyName(consistency uint16) string {
+	if name, ok := consistencyNames[consistency]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", consistency)
+}
+
+func getResultKindName(kind int32) string {
+	if name, ok := resultKindNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", kind)
+}
+
+func getErrorCodeName(code int32) string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", code)
+}
+
+// bodyReader reads the notations of the protocol spec, the first read past the end of the body sets err and the
+// following reads return zero values
+type bodyReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (reader *bodyReader) readN(n int) []byte {
+	if reader.err != nil || n < 0 || reader.pos+n > len(reader.data) {
+		reader.err = errBodyTooShort
+		return nil
+	}
+	value := reader.data[reader.pos : reader.pos+n]
+	reader.pos += n
+	return value
+}
+
+func (reader *bodyReader) readByte() byte {
+	if value := reader.readN(1); value != nil {
+		return value[0]
+	}
+	return 0
+}
+
+func (reader *bodyReader) readShort() uint16 {
+	if value := reader.readN(2); value != nil {
+		return binary.BigEndian.Uint16(value)
+	}
+	return 0
+}
+
+func (reader *bodyReader) readInt() int32 {
+	if value := reader.readN(4); value != nil {
+		return int32(binary.BigEndian.Uint32(value))
+	}
+	return 0
+}
+
+func (reader *bodyReader) readString() string {
+	return string(reader.readN(int(reader.readShort())))
+}
+
+func (reader *bodyReader) readLongString() string {
+	return string(reader.readN(int(reader.readInt())))
+}
+
+func (reader *bodyReader) readShortBytes() []byte {
+	return reader.readN(int(reader.readShort()))
+}
+
+// skipBytes skips a [bytes], a negative length is a null value
+func (reader *bodyReader) skipBytes() {
+	if length := reader.readInt(); length > 0 {
+		reader.readN(int(length))
+	}
+}
+
+func (reader *bodyReader) readStringList() []string {
+	count := int(reader.readShort())
+	list := make([]string, 0, count)
+	for i := 0; i < count && reader.err == nil; i++ {
+		list = append(list, reader.readString())
+	}
+	return list
+}
+
+func (reader *bodyReader) readStringMap() map[string]string {
+	count := int(reader.readShort())
+	stringMap := make(map[string]string, count)
+	for i := 0; i < count && reader.err == nil; i++ {
+		key := reader.readString()
+		stringMap[key] = reader.readString()
+	}
+	return stringMap
+}
+
+func (reader *bodyReader) skipBytesMap() {
+	count := int(reader.readShort())
+	for i := 0; i < count && reader.err == nil; i++ {
+		reader.readString()
+		reader.skipBytes()
+	}
+}
+
+// skipOption skips the type of a column, collections and user defined types nest the types of their elements
+func (reader *bodyReader) skipOption() {
+	switch reader.readShort() {
+	case 0x0000:
+		// custom: the java class name
+		reader.readString()
+	case 0x0020, 0x0022:
+		// list, set
+		reader.skipOption()
+	case 0x0021:
+		// map
+		reader.skipOption()
+		reader.skipOption()
+	case 0x0030:
+		// udt: keyspace, name and the fields
+		reader.readString()
+		reader.readString()
+		fields := int(reader.readShort())
+		for i := 0; i < fields && reader.err == nil; i++ {
+			reader.readString()
+			reader.skipOption()
+		}
+	case 0x0031:
+		// tuple
+		elements := int(reader.readShort())
+		for i := 0; i < elements && reader.err == nil; i++ {
+			reader.skipOption()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+const (
+	frameHeaderSize   = 9
+	responseDirection = 0x80
+	minVersion        = 3
+	maxVersion        = 4
+)
+
+const (
+	flagCompression   = 0x01
+	flagTracing       = 0x02
+	flagCustomPayload = 0x04
+	flagWarning       = 0x08
+)
+
+const (
+	opcodeError         = 0x00
+	opcodeStartup       = 0x01
+	opcodeReady         = 0x02
+	opcodeAuthenticate  = 0x03
+	opcodeOptions       = 0x05
+	opcodeSupported     = 0x06
+	opcodeQuery         = 0x07
+	opcodeResult        = 0x08
+	opcodePrepare       = 0x09
+	opcodeExecute       = 0x0a
+	opcodeRegister      = 0x0b
+	opcodeEvent         = 0x0c
+	opcodeBatch         = 0x0d
+	opcodeAuthChallenge = 0x0e
+	opcodeAuthResponse  = 0x0f
+	opcodeAuthSuccess   = 0x10
+)
+
+var opcodeNames = map[byte]string{
+	opcodeError:         "ERROR",
+	opcodeStartup:       "STARTUP",
+	opcodeReady:         "READY",
+	opcodeAuthenticate:  "AUTHENTICATE",
+	opcodeOptions:       "OPTIONS",
+	opcodeSupported:     "SUPPORTED",
+	opcodeQuery:         "QUERY",
+	opcodeResult:        "RESULT",
+	opcodePrepare:       "PREPARE",
+	opcodeExecute:       "EXECUTE",
+	opcodeRegister:      "REGISTER",
+	opcodeEvent:         "EVENT",
+	opcodeBatch:         "BATCH",
+	opcodeAuthChallenge: "AUTH_CHALLENGE",
+	opcodeAuthResponse:  "AUTH_RESPONSE",
+	opcodeAuthSuccess:   "AUTH_SUCCESS",
+}
+
+// the opcodes sent by the client, the others are sent by the server
+var requestOpcodes = map[byte]bool{
+	opcodeStartup:      true,
+	opcodeOptions:      true,
+	opcodeQuery:        true,
+	opcodePrepare:      true,
+	opcodeExecute:      true,
+	opcodeRegister:     true,
+	opcodeBatch:        true,
+	opcodeAuthResponse: true,
+}
+
+var consistencyNames = map[uint16]string{
+	0x0000: "ANY",
+	0x0001: "ONE",
+	0x0002: "TWO",
+	0x0003: "THREE",
+	0x0004: "QUORUM",
+	0x0005: "ALL",
+	0x0006: "LOCAL_QUORUM",
+	0x0007: "EACH_QUORUM",
+	0x0008: "SERIAL",
+	0x0009: "LOCAL_SERIAL",
+	0x000a: "LOCAL_ONE",
+}
+
+const (
+	resultKindVoid         = 0x0001
+	resultKindRows         = 0x0002
+	resultKindSetKeyspace  = 0x0003
+	resultKindPrepared     = 0x0004
+	resultKindSchemaChange = 0x0005
+)
+
+var resultKindNames = map[int32]string{
+	resultKindVoid:         "Void",
+	resultKindRows:         "Rows",
+	resultKindSetKeyspace:  "Set_keyspace",
+	resultKindPrepared:     "Prepared",
+	resultKindSchemaChange: "Schema_change",
+}
+
+var errorCodeNames = map[int32]string{
+	0x0000: "Server_error",
+	0x000a: "Protocol_error",
+	0x0100: "Bad_credentials",
+	0x1000: "Unavailable",
+	0x1001: "Overloaded",
+	0x1002: "Is_bootstrapping",
+	0x1003: "Truncate_error",
+	0x1100: "Write_timeout",
+	0x1200: "Read_timeout",
+	0x1300: "Read_failure",
+	0x1400: "Function_failure",
+	0x1500: "Write_failure",
+	0x2000: "Syntax_error",
+	0x2100: "Unauthorized",
+	0x2200: "Invalid",
+	0x2300: "Config_error",
+	0x2400: "Already_exists",
+	0x2500: "Unprepared",
+}
+
+var batchTypeNames = map[byte]string{
+	0: "LOGGED",
+	1: "UNLOGGED",
+	2: "COUNTER",
+}
+
+// CassandraMessage is a request or a response frame. The query of an EXECUTE is the one of the PREPARE its prepared
+// id was returned to, when that PREPARE was captured.
+type CassandraMessage struct {
+	Version      int               `json:"version"`
+	Stream       int16             `json:"stream"`
+	Opcode       string            `json:"opcode"`
+	Compression  string            `json:"compression,omitempty"` // the algorithm of a compressed frame
+	TracingId    string            `json:"tracingId,omitempty"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	Query        string            `json:"query,omitempty"`
+	Redacted     bool              `json:"redacted,omitempty"` // the literals of the query were replaced by bind markers
+	PreparedId   string            `json:"preparedId,omitempty"`
+	Consistency  string            `json:"consistency,omitempty"`
+	Values       int               `json:"values,omitempty"`
+	BatchType    string            `json:"batchType,omitempty"`
+	Statements   int               `json:"statements,omitempty"`
+	Options      map[string]string `json:"options,omitempty"` // the options of a STARTUP, like the negotiated COMPRESSION
+	Events       []string          `json:"events,omitempty"`
+	ResultKind   string            `json:"resultKind,omitempty"`
+	Rows         int               `json:"rows,omitempty"`
+	Columns      int               `json:"columns,omitempty"`
+	Keyspace     string            `json:"keyspace,omitempty"`
+	SchemaChange string            `json:"schemaChange,omitempty"`
+	ErrorCode    string            `json:"errorCode,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Size         int               `json:"size"`
+}
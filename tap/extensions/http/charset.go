@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// bodyCharset returns the charset label of a body, from the Content-Type header or from the byte order mark of an
+// html body. It's empty when the charset isn't known.
+func bodyCharset(contentType string, body []byte) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if label := params["charset"]; label != "" {
+		return label
+	}
+	if mediaType == "text/html" {
+		if _, name, certain := charset.DetermineEncoding(body, mediaType); certain {
+			return name
+		}
+	}
+	return ""
+}
+
+// transcodeToUTF8 decodes a body of the charset, a body of an unknown charset or one that's already UTF-8 is
+// returned as is
+func transcodeToUTF8(label string, body []byte) ([]byte, bool) {
+	encoding, name := charset.Lookup(label)
+	if encoding == nil || name == "utf-8" {
+		return body, false
+	}
+	transcoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, false
+	}
+	return transcoded, true
+}
+
+func getHeaderValue(details map[string]interface{}, name string) string {
+	headers, _ := details["headers"].([]interface{})
+	for _, header := range headers {
+		h, _ := header.(map[string]interface{})
+		if headerName, _ := h["name"].(string); strings.EqualFold(headerName, name) {
+			value, _ := h["value"].(string)
+			return value
+		}
+	}
+	return ""
+}
+
+// transcodeBodies stores the text bodies of a pair as UTF-8, the label of the charset they were sent in is kept in
+// the charset field of the post data and the content
+func transcodeBodies(reqDetails map[string]interface{}, resDetails map[string]interface{}) {
+	if postData, ok := reqDetails["postData"].(map[string]interface{}); ok {
+		transcodePostData(postData, getHeaderValue(reqDetails, "Content-Type"))
+	}
+	if content, ok := resDetails["content"].(map[string]interface{}); ok {
+		transcodeContent(content, getHeaderValue(resDetails, "Content-Type"))
+	}
+}
+
+// transcodePostData handles the text of the post data, which is base64 encoded when it isn't valid UTF-8
+func transcodePostData(postData map[string]interface{}, contentType string) {
+	text, ok := postData["text"].(string)
+	if !ok || text == "" {
+		return
+	}
+	body := []byte(text)
+	isBase64 := postData["encoding"] == "base64"
+	if isBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return
+		}
+		body = decoded
+	}
+
+	label := bodyCharset(contentType, body)
+	if label == "" {
+		return
+	}
+	postData["charset"] = label
+	if transcoded, ok := transcodeToUTF8(label, body); ok {
+		postData["text"] = string(transcoded)
+		delete(postData, "encoding")
+	}
+}
+
+// transcodeContent handles the text of the response content, which is always base64 encoded
+func transcodeContent(content map[string]interface{}, contentType string) {
+	text, ok := content["text"].(string)
+	if !ok || text == "" || content["encoding"] != "base64" {
+		return
+	}
+	body, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return
+	}
+
+	label := bodyCharset(contentType, body)
+	if label == "" {
+		return
+	}
+	content["charset"] = label
+	if transcoded, ok := transcodeToUTF8(label, body); ok {
+		content["text"] = base64.StdEncoding.EncodeToString(transcoded)
+	}
+}
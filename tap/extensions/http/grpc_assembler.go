@@ -86,14 +86,15 @@ type GrpcAssembler struct {
 	framer            *http2.Framer
 }
 
-func (ga *GrpcAssembler) readMessage() (uint32, interface{}, error) {
+// readMessage returns the original size of the body of the message when it was truncated to maxBodySize, 0 otherwise
+func (ga *GrpcAssembler) readMessage(maxBodySize int64) (uint32, interface{}, int64, error) {
 	// Exactly one Framer is used for each half connection.
 	// (Instead of creating a new Framer for each ReadFrame operation)
 	// This is needed in order to decompress the headers,
 	// because the compression context is updated with each requests/response.
 	frame, err := ga.framer.ReadFrame()
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, 0, err
 	}
 
 	streamID := frame.Header().StreamID
@@ -101,10 +102,11 @@ func (ga *GrpcAssembler) readMessage() (uint32, interface{}, error) {
 	ga.fragmentsByStream.appendFrame(streamID, frame)
 
 	if !(ga.isStreamEnd(frame)) {
-		return 0, nil, nil
+		return 0, nil, 0, nil
 	}
 
 	headers, data := ga.fragmentsByStream.pop(streamID)
+	data, originalBodySize := truncateBody(data, maxBodySize)
 
 	// Note: header keys are converted by http.Header.Set to canonical names, e.g. content-type -> Content-Type.
 	// By converting the keys we violate the HTTP/2 specification, which state that all headers must be lowercase.
@@ -139,10 +141,10 @@ func (ga *GrpcAssembler) readMessage() (uint32, interface{}, error) {
 			ContentLength: int64(len(dataString)),
 		}
 	} else {
-		return 0, nil, errors.New("failed to assemble stream: neither a request nor a message")
+		return 0, nil, 0, errors.New("failed to assemble stream: neither a request nor a message")
 	}
 
-	return streamID, messageHTTP1, nil
+	return streamID, messageHTTP1, originalBodySize, nil
 }
 
 func (ga *GrpcAssembler) isStreamEnd(frame http2.Frame) bool {
@@ -23,8 +23,34 @@ func filterAndEmit(item *api.OutputChannelItem, emitter api.Emitter, options *ap
 	emitter.Emit(item)
 }
 
+// readBody reads the body up to maxBodySize, the rest of a larger body is discarded as it's read so it's never held.
+// It returns the original size of the body when it was truncated, 0 otherwise. The Content-Length header is kept as is.
+func readBody(body io.Reader, maxBodySize int64) ([]byte, int64, error) {
+	if maxBodySize <= 0 {
+		content, err := ioutil.ReadAll(body)
+		return content, 0, err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return content, 0, err
+	}
+	discarded, err := io.Copy(ioutil.Discard, body)
+	if discarded == 0 {
+		return content, 0, err
+	}
+	return content, maxBodySize + discarded, err
+}
+
+// truncateBody is readBody for the bodies already assembled, like the data of the HTTP/2 streams
+func truncateBody(body []byte, maxBodySize int64) ([]byte, int64) {
+	if maxBodySize <= 0 || int64(len(body)) <= maxBodySize {
+		return body, 0
+	}
+	return body[:maxBodySize], int64(len(body))
+}
+
 func handleHTTP2Stream(grpcAssembler *GrpcAssembler, tcpID *api.TcpID, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
-	streamID, messageHTTP1, err := grpcAssembler.readMessage()
+	streamID, messageHTTP1, originalBodySize, err := grpcAssembler.readMessage(options.MaxBodySize)
 	if err != nil {
 		return err
 	}
@@ -41,7 +67,7 @@ func handleHTTP2Stream(grpcAssembler *GrpcAssembler, tcpID *api.TcpID, superTime
 			tcpID.DstPort,
 			streamID,
 		)
-		item = reqResMatcher.registerRequest(ident, &messageHTTP1, superTimer.CaptureTime)
+		item = reqResMatcher.registerRequest(ident, &messageHTTP1, superTimer.CaptureTime, originalBodySize)
 		if item != nil {
 			item.ConnectionInfo = &api.ConnectionInfo{
 				ClientIP:   tcpID.SrcIP,
@@ -60,7 +86,7 @@ func handleHTTP2Stream(grpcAssembler *GrpcAssembler, tcpID *api.TcpID, superTime
 			tcpID.SrcPort,
 			streamID,
 		)
-		item = reqResMatcher.registerResponse(ident, &messageHTTP1, superTimer.CaptureTime)
+		item = reqResMatcher.registerResponse(ident, &messageHTTP1, superTimer.CaptureTime, originalBodySize)
 		if item != nil {
 			item.ConnectionInfo = &api.ConnectionInfo{
 				ClientIP:   tcpID.DstIP,
@@ -74,31 +100,36 @@ func handleHTTP2Stream(grpcAssembler *GrpcAssembler, tcpID *api.TcpID, superTime
 
 	if item != nil {
 		item.Protocol = http2Protocol
+		item.Stream = streamID
 		filterAndEmit(item, emitter, options)
 	}
 
 	return nil
 }
 
-func handleHTTP1ClientStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+// handleHTTP1ClientStream returns a copy of the request when it's a websocket upgrade, nil otherwise. The request itself
+// is filtered once it's matched, possibly by the server side of the connection, so it's copied before it's registered.
+func handleHTTP1ClientStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) (*http.Request, error) {
 	req, err := http.ReadRequest(b)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	counterPair.Request++
 
-	body, err := ioutil.ReadAll(req.Body)
+	body, originalBodySize, err := readBody(req.Body, options.MaxBodySize)
 	req.Body = io.NopCloser(bytes.NewBuffer(body)) // rewind
 
-	ident := fmt.Sprintf(
-		"%s->%s %s->%s %d",
-		tcpID.SrcIP,
-		tcpID.DstIP,
-		tcpID.SrcPort,
-		tcpID.DstPort,
-		counterPair.Request,
-	)
-	item := reqResMatcher.registerRequest(ident, req, superTimer.CaptureTime)
+	var upgradeRequest *http.Request
+	if isWebSocketUpgrade(req.Header) {
+		upgradeUrl := *req.URL
+		if !options.DisableRedaction {
+			filterUrl(&upgradeUrl)
+		}
+		upgradeRequest = &http.Request{Host: req.Host, URL: &upgradeUrl, Header: req.Header.Clone()}
+	}
+
+	ident := getRequestIdent(tcpID, counterPair.Request)
+	item := reqResMatcher.registerRequest(ident, req, superTimer.CaptureTime, originalBodySize)
 	if item != nil {
 		item.ConnectionInfo = &api.ConnectionInfo{
 			ClientIP:   tcpID.SrcIP,
@@ -109,17 +140,29 @@ func handleHTTP1ClientStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api
 		}
 		filterAndEmit(item, emitter, options)
 	}
-	return nil
+	return upgradeRequest, nil
 }
 
-func handleHTTP1ServerStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+// getRequestIdent returns the ident the client side of the connection registers its nth request by
+func getRequestIdent(tcpID *api.TcpID, requestCounter uint) string {
+	return fmt.Sprintf(
+		"%s->%s %s->%s %d",
+		tcpID.SrcIP,
+		tcpID.DstIP,
+		tcpID.SrcPort,
+		tcpID.DstPort,
+		requestCounter,
+	)
+}
+
+func handleHTTP1ServerStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) (*http.Response, error) {
 	res, err := http.ReadResponse(b, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	counterPair.Response++
 
-	body, err := ioutil.ReadAll(res.Body)
+	body, originalBodySize, err := readBody(res.Body, options.MaxBodySize)
 	res.Body = io.NopCloser(bytes.NewBuffer(body)) // rewind
 
 	ident := fmt.Sprintf(
@@ -130,7 +173,7 @@ func handleHTTP1ServerStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api
 		tcpID.SrcPort,
 		counterPair.Response,
 	)
-	item := reqResMatcher.registerResponse(ident, res, superTimer.CaptureTime)
+	item := reqResMatcher.registerResponse(ident, res, superTimer.CaptureTime, originalBodySize)
 	if item != nil {
 		item.ConnectionInfo = &api.ConnectionInfo{
 			ClientIP:   tcpID.DstIP,
@@ -141,5 +184,5 @@ func handleHTTP1ServerStream(b *bufio.Reader, tcpID *api.TcpID, counterPair *api
 		}
 		filterAndEmit(item, emitter, options)
 	}
-	return nil
+	return res, nil
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -52,6 +53,7 @@ type dissecting string
 
 func (d dissecting) Register(extension *api.Extension) {
 	extension.Protocol = &protocol
+	extension.ExtraProtocols = []*api.Protocol{&websocketProtocol}
 	extension.MatcherMap = reqResMatcher.openMessagesMap
 }
 
@@ -69,6 +71,9 @@ func (d dissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, co
 	}
 
 	dissected := false
+	// once a connection is upgraded to a websocket both of its sides are read as websocket frames
+	isWebSocket := false
+	var upgradeRequest *http.Request
 	for {
 		if superIdentifier.Protocol != nil && superIdentifier.Protocol != &protocol {
 			return errors.New("Identified by another protocol")
@@ -82,22 +87,32 @@ func (d dissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, co
 				continue
 			}
 			dissected = true
+		} else if isWebSocket {
+			err = handleWebSocketStream(b, isClient, tcpID, superTimer, emitter, upgradeRequest)
+			break
 		} else if isClient {
-			err = handleHTTP1ClientStream(b, tcpID, counterPair, superTimer, emitter, options)
+			var clientUpgradeRequest *http.Request
+			clientUpgradeRequest, err = handleHTTP1ClientStream(b, tcpID, counterPair, superTimer, emitter, options)
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			} else if err != nil {
 				continue
 			}
 			dissected = true
+			// the client keeps sending http requests on the connection when the server rejects the upgrade
+			if clientUpgradeRequest != nil && reqResMatcher.awaitWebSocketUpgrade(getRequestIdent(tcpID, counterPair.Request)) {
+				isWebSocket, upgradeRequest = true, clientUpgradeRequest
+			}
 		} else {
-			err = handleHTTP1ServerStream(b, tcpID, counterPair, superTimer, emitter, options)
+			var res *http.Response
+			res, err = handleHTTP1ServerStream(b, tcpID, counterPair, superTimer, emitter, options)
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			} else if err != nil {
 				continue
 			}
 			dissected = true
+			isWebSocket = res.StatusCode == http.StatusSwitchingProtocols && isWebSocketUpgrade(res.Header)
 		}
 	}
 
@@ -118,12 +133,17 @@ func SetHostname(address, newHostname string) string {
 }
 
 func (d dissecting) Analyze(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	if item.Protocol.Name == websocketProtocol.Name {
+		return analyzeWebSocketClose(item, entryId, resolvedSource, resolvedDestination)
+	}
+
 	var host, scheme, authority, path, service string
 
 	request := item.Pair.Request.Payload.(map[string]interface{})
 	response := item.Pair.Response.Payload.(map[string]interface{})
 	reqDetails := request["details"].(map[string]interface{})
 	resDetails := response["details"].(map[string]interface{})
+	transcodeBodies(reqDetails, resDetails)
 
 	for _, header := range reqDetails["headers"].([]interface{}) {
 		h := header.(map[string]interface{})
@@ -187,6 +207,10 @@ func (d dissecting) Analyze(item *api.OutputChannelItem, entryId string, resolve
 }
 
 func (d dissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
+	if entry.ProtocolName == websocketProtocol.Name {
+		return summarizeWebSocketClose(entry)
+	}
+
 	var p api.Protocol
 	if entry.ProtocolVersion == "2.0" {
 		p = http2Protocol
@@ -210,6 +234,8 @@ func (d dissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
 		DestinationPort: entry.DestinationPort,
 		IsOutgoing:      entry.IsOutgoing,
 		Latency:         entry.ElapsedTime,
+		RedirectChain:   entry.RedirectChain,
+		RedirectHop:     entry.RedirectHop,
 		Rules: api.ApplicableRules{
 			Latency: 0,
 			Status:  false,
@@ -363,6 +389,10 @@ func representResponse(response map[string]interface{}) (repResponse []interface
 }
 
 func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []byte, bodySize int64, err error) {
+	if entry.ProtocolName == websocketProtocol.Name {
+		object, err = representWebSocketClosePair(entry)
+		return websocketProtocol, object, 0, err
+	}
 	if entry.ProtocolVersion == "2.0" {
 		p = http2Protocol
 	} else {
@@ -384,3 +414,5 @@ func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []by
 }
 
 var Dissector dissecting
+
+var ApiVersion = api.ApiVersion
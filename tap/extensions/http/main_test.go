@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/api/apitest"
+)
+
+const capturedUpgradeRequest = "" +
+	"GET /chat?room=1 HTTP/1.1\r\n" +
+	"Host: chat.example.com\r\n" +
+	"Upgrade: websocket\r\n" +
+	"Connection: Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+	"Sec-WebSocket-Version: 13\r\n" +
+	"\r\n"
+
+const capturedUpgradeResponse = "" +
+	"HTTP/1.1 101 Switching Protocols\r\n" +
+	"Upgrade: websocket\r\n" +
+	"Connection: Upgrade\r\n" +
+	"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n" +
+	"\r\n"
+
+// webSocketFrame builds a final frame, frames of the client are masked
+func webSocketFrame(opcode byte, payload []byte, isMasked bool) string {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	default:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	if !isMasked {
+		return string(append(frame, payload...))
+	}
+
+	frame[1] |= 0x80
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, payloadByte := range payload {
+		frame = append(frame, payloadByte^mask[i%4])
+	}
+	return string(frame)
+}
+
+func webSocketCloseFrame(code uint16, reason string, isMasked bool) string {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	return webSocketFrame(webSocketOpcodeClose, append(payload, reason...), isMasked)
+}
+
+func resetOpenMessages() {
+	reqResMatcher.openMessagesMap.Range(func(key, _ interface{}) bool {
+		reqResMatcher.openMessagesMap.Delete(key)
+		return true
+	})
+}
+
+// dissectSession feeds a captured session, the server stream first so every request completes a pair
+func dissectSession(t *testing.T, clientStream string, serverStream string) []*api.MizuEntry {
+	return dissectSessionWithOptions(t, clientStream, serverStream, &api.TrafficFilteringOptions{})
+}
+
+func dissectSessionWithOptions(t *testing.T, clientStream string, serverStream string, options *api.TrafficFilteringOptions) []*api.MizuEntry {
+	resetOpenMessages()
+	reqResMatcher.webSocketUpgrades.Range(func(key, _ interface{}) bool {
+		reqResMatcher.webSocketUpgrades.Delete(key)
+		return true
+	})
+	entries, clientErr, serverErr := apitest.DissectSession(t, Dissector, &apitest.Session{ClientStream: clientStream, ServerStream: serverStream, ServerPort: "80", Options: options, ResolvedDestination: "chat.default"})
+	if clientErr != nil || serverErr != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", nil, clientErr, serverErr)
+	}
+	return entries
+}
+
+func getWebSocketClosePair(t *testing.T, entry *api.MizuEntry) *webSocketClosePair {
+	var pair webSocketClosePair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	return &pair
+}
+
+func TestDissectWebSocketClose(t *testing.T) {
+	tests := []struct {
+		name                string
+		clientStream        string
+		serverStream        string
+		expectedStatus      int
+		expectedClientClose WebSocketClose
+		expectedServerClose WebSocketClose
+	}{
+		{
+			name:                "client closes",
+			clientStream:        capturedUpgradeRequest + webSocketFrame(0x1, []byte("hello"), true) + webSocketCloseFrame(1000, "bye", true),
+			serverStream:        capturedUpgradeResponse + webSocketFrame(0x1, []byte(strings.Repeat("a", 300)), false) + webSocketCloseFrame(1000, "", false),
+			expectedStatus:      1000,
+			expectedClientClose: WebSocketClose{CloseFrame: true, Code: 1000, Reason: "bye", Frames: 1, Host: "chat.example.com", Path: "/chat?room=1"},
+			expectedServerClose: WebSocketClose{CloseFrame: true, Code: 1000, Frames: 1},
+		},
+		{
+			name:                "server closes without the client replying",
+			clientStream:        capturedUpgradeRequest + webSocketFrame(0x9, nil, true),
+			serverStream:        capturedUpgradeResponse + webSocketCloseFrame(1001, "restarting", false),
+			expectedStatus:      1001,
+			expectedClientClose: WebSocketClose{CloseFrame: false, Code: webSocketCloseCodeAbnormal, Frames: 1, Host: "chat.example.com", Path: "/chat?room=1"},
+			expectedServerClose: WebSocketClose{CloseFrame: true, Code: 1001, Reason: "restarting"},
+		},
+		{
+			name:                "abrupt close",
+			clientStream:        capturedUpgradeRequest + webSocketFrame(0x2, []byte{1, 2, 3}, true),
+			serverStream:        capturedUpgradeResponse + webSocketFrame(0x2, []byte{4, 5}, false) + webSocketFrame(0x2, []byte{6}, false),
+			expectedStatus:      webSocketCloseCodeAbnormal,
+			expectedClientClose: WebSocketClose{CloseFrame: false, Code: webSocketCloseCodeAbnormal, Frames: 1, Host: "chat.example.com", Path: "/chat?room=1"},
+			expectedServerClose: WebSocketClose{CloseFrame: false, Code: webSocketCloseCodeAbnormal, Frames: 2},
+		},
+		{
+			name:                "close frame without a code",
+			clientStream:        capturedUpgradeRequest + webSocketFrame(webSocketOpcodeClose, nil, true),
+			serverStream:        capturedUpgradeResponse + webSocketFrame(webSocketOpcodeClose, nil, false),
+			expectedStatus:      webSocketCloseCodeNoStatus,
+			expectedClientClose: WebSocketClose{CloseFrame: true, Code: webSocketCloseCodeNoStatus, Host: "chat.example.com", Path: "/chat?room=1"},
+			expectedServerClose: WebSocketClose{CloseFrame: true, Code: webSocketCloseCodeNoStatus},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := dissectSession(t, test.clientStream, test.serverStream)
+			// the upgrade and the close
+			if len(entries) != 2 {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(entries))
+			}
+			if entries[0].ProtocolName != protocol.Name || entries[0].Status != 101 {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", 101, entries[0].ProtocolName, entries[0].Status)
+			}
+
+			entry := entries[1]
+			if entry.ProtocolName != websocketProtocol.Name || entry.Status != test.expectedStatus || entry.Path != "/chat?room=1" {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v %v", test.expectedStatus, entry.ProtocolName, entry.Status, entry.Path)
+			}
+			if entry.SourceIp != "10.0.0.1" || entry.DestinationPort != "80" || entry.Url != "ws://chat.default/chat?room=1" {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v %v", "the client to server connection", entry.SourceIp, entry.DestinationPort, entry.Url)
+			}
+			pair := getWebSocketClosePair(t, entry)
+			if pair.Request.Payload.Details != test.expectedClientClose {
+				t.Errorf("unexpected result - expected: %+v, actual: %+v", test.expectedClientClose, pair.Request.Payload.Details)
+			}
+			if pair.Response.Payload.Details != test.expectedServerClose {
+				t.Errorf("unexpected result - expected: %+v, actual: %+v", test.expectedServerClose, pair.Response.Payload.Details)
+			}
+		})
+	}
+}
+
+func TestRepresentWebSocketClose(t *testing.T) {
+	entries := dissectSession(t, capturedUpgradeRequest+webSocketCloseFrame(1008, "policy", true), capturedUpgradeResponse+webSocketCloseFrame(1008, "", false))
+	summary := Dissector.Summarize(entries[1])
+	if summary.Summary != "1008 Policy Violation" || summary.Protocol.Name != websocketProtocol.Name {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", "1008 Policy Violation", summary.Summary, summary.Protocol.Name)
+	}
+
+	protocol, object, _, err := Dissector.Represent(entries[1])
+	if err != nil || protocol.Name != websocketProtocol.Name {
+		t.Fatalf("failed to represent entry: %v", err)
+	}
+	if !strings.Contains(string(object), `\"value\":\"policy\"`) {
+		t.Errorf("unexpected result - expected: %v, actual: %s", "the close reason", object)
+	}
+}
+
+func TestDissectWebSocketNotUpgraded(t *testing.T) {
+	rejectedResponse := "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"
+	entries := dissectSession(t, capturedUpgradeRequest, rejectedResponse)
+	if len(entries) != 1 || entries[0].ProtocolName != protocol.Name {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a single http entry", len(entries))
+	}
+}
+
+func TestDissectWebSocketRejectedKeepsHttp(t *testing.T) {
+	rejectedResponse := "HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n"
+	retriedRequest := "GET /chat?room=1&token=1 HTTP/1.1\r\nHost: chat.example.com\r\n\r\n"
+	okResponse := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+
+	entries := dissectSession(t, capturedUpgradeRequest+retriedRequest, rejectedResponse+okResponse)
+	if len(entries) != 2 || entries[0].Status != 401 || entries[1].Status != 200 || entries[1].ProtocolName != protocol.Name {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the rejected upgrade and the retried request", entries)
+	}
+}
+
+func TestDissectWebSocketClientAwaitsUpgrade(t *testing.T) {
+	resetOpenMessages()
+	emitter := &apitest.CollectingEmitter{}
+	counterPair := &api.CounterPair{}
+	clientTcpID := &api.TcpID{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: "41001", DstPort: "80"}
+	serverTcpID := &api.TcpID{SrcIP: "10.0.0.2", DstIP: "10.0.0.1", SrcPort: "80", DstPort: "41001"}
+	superTimer := &api.SuperTimer{CaptureTime: time.Now()}
+	options := &api.TrafficFilteringOptions{}
+
+	// the client side reads its upgrade request before the server side read the response
+	clientDone := make(chan error)
+	go func() {
+		clientStream := capturedUpgradeRequest + webSocketCloseFrame(1000, "", true)
+		clientDone <- Dissector.Dissect(bufio.NewReader(strings.NewReader(clientStream)), true, clientTcpID, counterPair, superTimer, &api.SuperIdentifier{}, emitter, options)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	serverStream := capturedUpgradeResponse + webSocketCloseFrame(1000, "", false)
+	if err := Dissector.Dissect(bufio.NewReader(strings.NewReader(serverStream)), false, serverTcpID, counterPair, superTimer, &api.SuperIdentifier{}, emitter, options); err != nil {
+		t.Fatalf("failed to dissect the server side: %v", err)
+	}
+	if err := <-clientDone; err != nil {
+		t.Fatalf("failed to dissect the client side: %v", err)
+	}
+
+	// the upgrade and the close of both sides
+	if len(emitter.Items) != 2 || emitter.Items[1].Protocol.Name != websocketProtocol.Name {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the upgrade and the close", len(emitter.Items))
+	}
+}
+
+func TestAnalyzeTranscodesLatin1Bodies(t *testing.T) {
+	// "café" in ISO-8859-1
+	latin1Body := "caf\xe9"
+	clientStream := "POST /menu HTTP/1.1\r\n" +
+		"Host: shop.example.com\r\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+		"Content-Length: 4\r\n" +
+		"\r\n" + latin1Body
+	serverStream := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/html; charset=iso-8859-1\r\n" +
+		"Content-Length: 4\r\n" +
+		"\r\n" + latin1Body
+
+	entries := dissectSession(t, clientStream, serverStream)
+	if len(entries) != 1 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 1, len(entries))
+	}
+
+	var pair struct {
+		Request struct {
+			Payload struct {
+				Details struct {
+					PostData struct {
+						Text     string `json:"text"`
+						Encoding string `json:"encoding"`
+						Charset  string `json:"charset"`
+					} `json:"postData"`
+				} `json:"details"`
+			} `json:"payload"`
+		} `json:"request"`
+		Response struct {
+			Payload struct {
+				Details struct {
+					Content struct {
+						Text    []byte `json:"text"`
+						Charset string `json:"charset"`
+					} `json:"content"`
+				} `json:"details"`
+			} `json:"payload"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(entries[0].Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	postData := pair.Request.Payload.Details.PostData
+	if postData.Text != "café" || postData.Encoding != "" || postData.Charset != "ISO-8859-1" {
+		t.Errorf("unexpected result - expected: %v %v, actual: %v %v %v", "café", "ISO-8859-1", postData.Text, postData.Encoding, postData.Charset)
+	}
+	content := pair.Response.Payload.Details.Content
+	if string(content.Text) != "café" || content.Charset != "iso-8859-1" {
+		t.Errorf("unexpected result - expected: %v %v, actual: %s %v", "café", "iso-8859-1", content.Text, content.Charset)
+	}
+}
+
+func TestAnalyzeKeepsUTF8Bodies(t *testing.T) {
+	clientStream := "GET / HTTP/1.1\r\nHost: shop.example.com\r\n\r\n"
+	serverStream := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 5\r\n\r\ncafé"
+
+	entries := dissectSession(t, clientStream, serverStream)
+	if len(entries) != 1 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 1, len(entries))
+	}
+	if !strings.Contains(entries[0].Entry, `"charset":"utf-8"`) || !strings.Contains(entries[0].Entry, `"text":"Y2Fmw6k="`) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the utf-8 body as is", entries[0].Entry)
+	}
+}
+
+func TestDissectTruncatesLargeBodies(t *testing.T) {
+	tests := []struct {
+		name                     string
+		body                     string
+		expectedBody             string
+		expectedOriginalBodySize int64
+	}{
+		{name: "under the limit", body: "ping", expectedBody: "ping"},
+		{name: "at the limit", body: "hello", expectedBody: "hello"},
+		{name: "over the limit", body: "hello world", expectedBody: "hello", expectedOriginalBodySize: 11},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contentLength := fmt.Sprintf("Content-Length: %d\r\n", len(test.body))
+			// the second request and response are still dissected once the rest of the large bodies is discarded
+			clientStream := "POST /echo HTTP/1.1\r\nHost: echo\r\nContent-Type: text/plain\r\n" + contentLength + "\r\n" + test.body +
+				"GET /health HTTP/1.1\r\nHost: echo\r\n\r\n"
+			serverStream := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n" + contentLength + "\r\n" + test.body +
+				"HTTP/1.1 204 No Content\r\n\r\n"
+
+			entries := dissectSessionWithOptions(t, clientStream, serverStream, &api.TrafficFilteringOptions{MaxBodySize: 5})
+			if len(entries) != 2 {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", 2, len(entries))
+			}
+
+			var pair struct {
+				Request struct {
+					Payload struct {
+						Details struct {
+							Headers []struct {
+								Name  string `json:"name"`
+								Value string `json:"value"`
+							} `json:"headers"`
+							PostData struct {
+								Text string `json:"text"`
+							} `json:"postData"`
+						} `json:"details"`
+						BodyTruncated    bool  `json:"bodyTruncated"`
+						OriginalBodySize int64 `json:"originalBodySize"`
+					} `json:"payload"`
+				} `json:"request"`
+				Response struct {
+					Payload struct {
+						Details struct {
+							Content struct {
+								Text []byte `json:"text"`
+							} `json:"content"`
+						} `json:"details"`
+						BodyTruncated    bool  `json:"bodyTruncated"`
+						OriginalBodySize int64 `json:"originalBodySize"`
+					} `json:"payload"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal([]byte(entries[0].Entry), &pair); err != nil {
+				t.Fatalf("failed to unmarshal entry: %v", err)
+			}
+
+			request, response := pair.Request.Payload, pair.Response.Payload
+			expectedTruncated := test.expectedOriginalBodySize > 0
+			if request.Details.PostData.Text != test.expectedBody || string(response.Details.Content.Text) != test.expectedBody {
+				t.Errorf("unexpected result - expected: %v, actual: %v %s", test.expectedBody, request.Details.PostData.Text, response.Details.Content.Text)
+			}
+			if request.BodyTruncated != expectedTruncated || request.OriginalBodySize != test.expectedOriginalBodySize {
+				t.Errorf("unexpected result - expected: %v %v, actual: %v %v", expectedTruncated, test.expectedOriginalBodySize, request.BodyTruncated, request.OriginalBodySize)
+			}
+			if response.BodyTruncated != expectedTruncated || response.OriginalBodySize != test.expectedOriginalBodySize {
+				t.Errorf("unexpected result - expected: %v %v, actual: %v %v", expectedTruncated, test.expectedOriginalBodySize, response.BodyTruncated, response.OriginalBodySize)
+			}
+			for _, header := range request.Details.Headers {
+				if header.Name == "Content-Length" && header.Value != fmt.Sprint(len(test.body)) {
+					t.Errorf("unexpected result - expected: %v, actual: %v", len(test.body), header.Value)
+				}
+			}
+			if entries[1].Path != "/health" || entries[1].Status != 204 {
+				t.Errorf("unexpected result - expected: %v %v, actual: %v %v", "/health", 204, entries[1].Path, entries[1].Status)
+			}
+		})
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		body                     string
+		maxBodySize              int64
+		expectedBody             string
+		expectedOriginalBodySize int64
+	}{
+		{body: "ping", maxBodySize: 5, expectedBody: "ping"},
+		{body: "hello", maxBodySize: 5, expectedBody: "hello"},
+		{body: "hello world", maxBodySize: 5, expectedBody: "hello", expectedOriginalBodySize: 11},
+		{body: "hello world", maxBodySize: 0, expectedBody: "hello world"},
+	}
+
+	for _, test := range tests {
+		body, originalBodySize := truncateBody([]byte(test.body), test.maxBodySize)
+		if string(body) != test.expectedBody || originalBodySize != test.expectedOriginalBodySize {
+			t.Errorf("unexpected result - expected: %v %v, actual: %s %v", test.expectedBody, test.expectedOriginalBodySize, body, originalBodySize)
+		}
+		body, originalBodySize, err := readBody(strings.NewReader(test.body), test.maxBodySize)
+		if err != nil || string(body) != test.expectedBody || originalBodySize != test.expectedOriginalBodySize {
+			t.Errorf("unexpected result - expected: %v %v, actual: %s %v %v", test.expectedBody, test.expectedOriginalBodySize, body, originalBodySize, err)
+		}
+	}
+}
@@ -12,17 +12,24 @@ import (
 
 var reqResMatcher = createResponseRequestMatcher() // global
 
+// webSocketUpgradeTimeout is how long the client side of a connection waits for the response to its upgrade request
+// before it reads the connection as http again
+const webSocketUpgradeTimeout = 10 * time.Second
+
 // Key is {client_addr}:{client_port}->{dest_addr}:{dest_port}_{incremental_counter}
 type requestResponseMatcher struct {
 	openMessagesMap *sync.Map
+	// the outcomes of the websocket upgrade requests by the key of their pair, the client side only switches to
+	// websocket frames once the server accepted the upgrade
+	webSocketUpgrades *sync.Map
 }
 
 func createResponseRequestMatcher() requestResponseMatcher {
-	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}}
+	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}, webSocketUpgrades: &sync.Map{}}
 	return *newMatcher
 }
 
-func (matcher *requestResponseMatcher) registerRequest(ident string, request *http.Request, captureTime time.Time) *api.OutputChannelItem {
+func (matcher *requestResponseMatcher) registerRequest(ident string, request *http.Request, captureTime time.Time, originalBodySize int64) *api.OutputChannelItem {
 	split := splitIdent(ident)
 	key := genKey(split)
 
@@ -30,8 +37,9 @@ func (matcher *requestResponseMatcher) registerRequest(ident string, request *ht
 		IsRequest:   true,
 		CaptureTime: captureTime,
 		Payload: api.HTTPPayload{
-			Type: TypeHttpRequest,
-			Data: request,
+			Type:             TypeHttpRequest,
+			Data:             request,
+			OriginalBodySize: originalBodySize,
 		},
 	}
 
@@ -41,14 +49,14 @@ func (matcher *requestResponseMatcher) registerRequest(ident string, request *ht
 		if responseHTTPMessage.IsRequest {
 			return nil
 		}
-		return matcher.preparePair(&requestHTTPMessage, responseHTTPMessage)
+		return matcher.preparePair(key, &requestHTTPMessage, responseHTTPMessage)
 	}
 
 	matcher.openMessagesMap.Store(key, &requestHTTPMessage)
 	return nil
 }
 
-func (matcher *requestResponseMatcher) registerResponse(ident string, response *http.Response, captureTime time.Time) *api.OutputChannelItem {
+func (matcher *requestResponseMatcher) registerResponse(ident string, response *http.Response, captureTime time.Time, originalBodySize int64) *api.OutputChannelItem {
 	split := splitIdent(ident)
 	key := genKey(split)
 
@@ -56,8 +64,9 @@ func (matcher *requestResponseMatcher) registerResponse(ident string, response *
 		IsRequest:   false,
 		CaptureTime: captureTime,
 		Payload: api.HTTPPayload{
-			Type: TypeHttpResponse,
-			Data: response,
+			Type:             TypeHttpResponse,
+			Data:             response,
+			OriginalBodySize: originalBodySize,
 		},
 	}
 
@@ -67,14 +76,20 @@ func (matcher *requestResponseMatcher) registerResponse(ident string, response *
 		if !requestHTTPMessage.IsRequest {
 			return nil
 		}
-		return matcher.preparePair(requestHTTPMessage, &responseHTTPMessage)
+		return matcher.preparePair(key, requestHTTPMessage, &responseHTTPMessage)
 	}
 
 	matcher.openMessagesMap.Store(key, &responseHTTPMessage)
 	return nil
 }
 
-func (matcher *requestResponseMatcher) preparePair(requestHTTPMessage *api.GenericMessage, responseHTTPMessage *api.GenericMessage) *api.OutputChannelItem {
+func (matcher *requestResponseMatcher) preparePair(key string, requestHTTPMessage *api.GenericMessage, responseHTTPMessage *api.GenericMessage) *api.OutputChannelItem {
+	request, _ := requestHTTPMessage.Payload.(api.HTTPPayload).Data.(*http.Request)
+	response, _ := responseHTTPMessage.Payload.(api.HTTPPayload).Data.(*http.Response)
+	if request != nil && response != nil && isWebSocketUpgrade(request.Header) {
+		matcher.getWebSocketUpgrade(key) <- response.StatusCode == http.StatusSwitchingProtocols && isWebSocketUpgrade(response.Header)
+	}
+
 	return &api.OutputChannelItem{
 		Protocol:       protocol,
 		Timestamp:      requestHTTPMessage.CaptureTime.UnixNano() / int64(time.Millisecond),
@@ -86,6 +101,27 @@ func (matcher *requestResponseMatcher) preparePair(requestHTTPMessage *api.Gener
 	}
 }
 
+// awaitWebSocketUpgrade returns whether the server accepted the upgrade request of ident, once its response was
+// matched. It returns false when no response was matched within webSocketUpgradeTimeout.
+func (matcher *requestResponseMatcher) awaitWebSocketUpgrade(ident string) bool {
+	key := genKey(splitIdent(ident))
+	defer matcher.webSocketUpgrades.Delete(key)
+
+	select {
+	case isUpgraded := <-matcher.getWebSocketUpgrade(key):
+		return isUpgraded
+	case <-time.After(webSocketUpgradeTimeout):
+		return false
+	}
+}
+
+// getWebSocketUpgrade returns the channel of the outcome of the upgrade request of key, whichever side of the
+// connection gets to it first creates it
+func (matcher *requestResponseMatcher) getWebSocketUpgrade(key string) chan bool {
+	upgrade, _ := matcher.webSocketUpgrades.LoadOrStore(key, make(chan bool, 1))
+	return upgrade.(chan bool)
+}
+
 func splitIdent(ident string) []string {
 	ident = strings.Replace(ident, "->", " ", -1)
 	return strings.Split(ident, " ")
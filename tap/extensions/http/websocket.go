@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var websocketProtocol api.Protocol = api.Protocol{
+	Name:            "websocket",
+	LongName:        "The WebSocket Protocol",
+	Abbreviation:    "WS",
+	Version:         "13",
+	BackgroundColor: "#5c3ca3",
+	ForegroundColor: "#ffffff",
+	FontSize:        12,
+	ReferenceLink:   "https://datatracker.ietf.org/doc/html/rfc6455",
+	Ports:           []string{},
+	Priority:        0,
+}
+
+const (
+	webSocketOpcodeClose         = 0x8
+	webSocketMaxControlFrameSize = 125
+	// the close codes reported for a close frame without a code and for a side that ended the connection without a
+	// close frame, as defined by RFC 6455
+	webSocketCloseCodeNoStatus = 1005
+	webSocketCloseCodeAbnormal = 1006
+)
+
+var webSocketCloseCodeNames = map[int]string{
+	1000: "Normal Closure",
+	1001: "Going Away",
+	1002: "Protocol Error",
+	1003: "Unsupported Data",
+	1005: "No Status Received",
+	1006: "Abnormal Closure",
+	1007: "Invalid Frame Payload Data",
+	1008: "Policy Violation",
+	1009: "Message Too Big",
+	1010: "Mandatory Extension",
+	1011: "Internal Error",
+	1012: "Service Restart",
+	1013: "Try Again Later",
+	1014: "Bad Gateway",
+	1015: "TLS Handshake",
+}
+
+// WebSocketClose is how one side of a WebSocket connection ended it, the client side also holds the upgrade request
+type WebSocketClose struct {
+	CloseFrame bool   `json:"closeFrame"` // false when the side ended the connection without sending a close frame
+	Code       int    `json:"code"`
+	Reason     string `json:"reason,omitempty"`
+	Frames     int    `json:"frames"` // the data and the ping frames sent before closing
+	Host       string `json:"host,omitempty"`
+	Path       string `json:"path,omitempty"`
+}
+
+type WebSocketPayload struct {
+	Data interface{}
+}
+
+func (h WebSocketPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Data)
+}
+
+type WebSocketWrapper struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Details interface{} `json:"details"`
+}
+
+// webSocketClosePair is the stored form of a WebSocket close, the request is the client side
+type webSocketClosePair struct {
+	Request struct {
+		CaptureTime time.Time `json:"captureTime"`
+		Payload     struct {
+			Details WebSocketClose `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		CaptureTime time.Time `json:"captureTime"`
+		Payload     struct {
+			Details WebSocketClose `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+func isWebSocketUpgrade(header http.Header) bool {
+	return strings.EqualFold(header.Get("Upgrade"), "websocket")
+}
+
+// handleWebSocketStream reads the frames of one side of an upgraded connection until the side closes it, the close
+// of the connection is emitted once both of its sides closed it
+func handleWebSocketStream(b *bufio.Reader, isClient bool, tcpID *api.TcpID, superTimer *api.SuperTimer, emitter api.Emitter, upgradeRequest *http.Request) error {
+	webSocketClose := &WebSocketClose{Code: webSocketCloseCodeAbnormal}
+	if upgradeRequest != nil {
+		webSocketClose.Host, webSocketClose.Path = upgradeRequest.Host, upgradeRequest.URL.RequestURI()
+	}
+
+	var err error
+	for {
+		var opcode byte
+		var payload []byte
+		if opcode, payload, err = readWebSocketFrame(b); err != nil {
+			break
+		}
+		if opcode != webSocketOpcodeClose {
+			webSocketClose.Frames++
+			continue
+		}
+
+		webSocketClose.CloseFrame = true
+		webSocketClose.Code, webSocketClose.Reason = parseWebSocketClosePayload(payload)
+		// nothing is sent after a close frame
+		io.Copy(ioutil.Discard, b)
+		err = io.EOF
+		break
+	}
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	if item := reqResMatcher.registerWebSocketClose(tcpID, isClient, webSocketClose, superTimer.CaptureTime); item != nil {
+		emitter.Emit(item)
+	}
+	return err
+}
+
+// readWebSocketFrame returns the opcode of the next frame and the unmasked payload of a close frame, the payloads of
+// the other frames are skipped
+func readWebSocketFrame(b *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(b, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	isMasked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extendedLength := make([]byte, 2)
+		if _, err := io.ReadFull(b, extendedLength); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extendedLength))
+	case 127:
+		extendedLength := make([]byte, 8)
+		if _, err := io.ReadFull(b, extendedLength); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extendedLength)
+	}
+	if opcode >= webSocketOpcodeClose && length > webSocketMaxControlFrameSize {
+		return 0, nil, fmt.Errorf("websocket control frame of %d bytes", length)
+	}
+	if length > math.MaxInt32 {
+		return 0, nil, fmt.Errorf("websocket frame of %d bytes", length)
+	}
+
+	mask := make([]byte, 4)
+	if isMasked {
+		if _, err := io.ReadFull(b, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	if opcode != webSocketOpcodeClose {
+		_, err := b.Discard(int(length))
+		return opcode, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(b, payload); err != nil {
+		return 0, nil, err
+	}
+	if isMasked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+func parseWebSocketClosePayload(payload []byte) (int, string) {
+	if len(payload) < 2 {
+		return webSocketCloseCodeNoStatus, ""
+	}
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
+
+// registerWebSocketClose pairs the closes of both sides of a connection, the client side is the request
+func (matcher *requestResponseMatcher) registerWebSocketClose(tcpID *api.TcpID, isClient bool, webSocketClose *WebSocketClose, captureTime time.Time) *api.OutputChannelItem {
+	connectionInfo := &api.ConnectionInfo{ClientIP: tcpID.SrcIP, ClientPort: tcpID.SrcPort, ServerIP: tcpID.DstIP, ServerPort: tcpID.DstPort, IsOutgoing: true}
+	if !isClient {
+		connectionInfo = &api.ConnectionInfo{ClientIP: tcpID.DstIP, ClientPort: tcpID.DstPort, ServerIP: tcpID.SrcIP, ServerPort: tcpID.SrcPort, IsOutgoing: false}
+	}
+	key := fmt.Sprintf("%s:%s->%s:%s,websocket", connectionInfo.ClientIP, connectionInfo.ClientPort, connectionInfo.ServerIP, connectionInfo.ServerPort)
+
+	closeMessage := &api.GenericMessage{
+		IsRequest:   isClient,
+		CaptureTime: captureTime,
+		Payload: WebSocketPayload{
+			Data: &WebSocketWrapper{Method: "close", Url: "", Details: webSocketClose},
+		},
+	}
+
+	otherCloseMessage, found := matcher.openMessagesMap.LoadAndDelete(key)
+	if !found {
+		matcher.openMessagesMap.Store(key, closeMessage)
+		return nil
+	}
+	// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+	requestMessage, responseMessage := otherCloseMessage.(*api.GenericMessage), closeMessage
+	if isClient {
+		requestMessage, responseMessage = closeMessage, requestMessage
+	}
+	if !requestMessage.IsRequest || responseMessage.IsRequest {
+		return nil
+	}
+
+	timestamp := requestMessage.CaptureTime
+	if responseMessage.CaptureTime.Before(timestamp) {
+		timestamp = responseMessage.CaptureTime
+	}
+	return &api.OutputChannelItem{
+		Protocol:       websocketProtocol,
+		Timestamp:      timestamp.UnixNano() / int64(time.Millisecond),
+		ConnectionInfo: connectionInfo,
+		Pair: &api.RequestResponsePair{
+			Request:  *requestMessage,
+			Response: *responseMessage,
+		},
+	}
+}
+
+// getWebSocketInitiator returns the close of the side that closed the connection first, a side that sent a close
+// frame closed it before a side that didn't
+func getWebSocketInitiator(pair *webSocketClosePair) *WebSocketClose {
+	clientClose, serverClose := &pair.Request.Payload.Details, &pair.Response.Payload.Details
+	if clientClose.CloseFrame != serverClose.CloseFrame {
+		if clientClose.CloseFrame {
+			return clientClose
+		}
+		return serverClose
+	}
+	if pair.Response.CaptureTime.Before(pair.Request.CaptureTime) {
+		return serverClose
+	}
+	return clientClose
+}
+
+func analyzeWebSocketClose(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	entryBytes, _ := json.Marshal(item.Pair)
+	var pair webSocketClosePair
+	json.Unmarshal(entryBytes, &pair)
+	clientClose := &pair.Request.Payload.Details
+
+	service := fmt.Sprintf("ws://%s", clientClose.Host)
+	if resolvedDestination != "" {
+		service = SetHostname(service, resolvedDestination)
+	} else if resolvedSource != "" {
+		service = SetHostname(service, resolvedSource)
+	}
+
+	elapsedTime := pair.Response.CaptureTime.Sub(pair.Request.CaptureTime).Round(time.Millisecond).Milliseconds()
+	if elapsedTime < 0 {
+		elapsedTime = -elapsedTime
+	}
+	return &api.MizuEntry{
+		ProtocolName:            websocketProtocol.Name,
+		ProtocolLongName:        websocketProtocol.LongName,
+		ProtocolAbbreviation:    websocketProtocol.Abbreviation,
+		ProtocolVersion:         websocketProtocol.Version,
+		ProtocolBackgroundColor: websocketProtocol.BackgroundColor,
+		ProtocolForegroundColor: websocketProtocol.ForegroundColor,
+		ProtocolFontSize:        websocketProtocol.FontSize,
+		ProtocolReferenceLink:   websocketProtocol.ReferenceLink,
+		EntryId:                 entryId,
+		Entry:                   string(entryBytes),
+		Url:                     fmt.Sprintf("%s%s", service, clientClose.Path),
+		Method:                  "CLOSE",
+		Status:                  getWebSocketInitiator(&pair).Code,
+		RequestSenderIp:         item.ConnectionInfo.ClientIP,
+		Service:                 service,
+		Timestamp:               item.Timestamp,
+		ElapsedTime:             elapsedTime,
+		Path:                    clientClose.Path,
+		ResolvedSource:          resolvedSource,
+		ResolvedDestination:     resolvedDestination,
+		SourceIp:                item.ConnectionInfo.ClientIP,
+		DestinationIp:           item.ConnectionInfo.ServerIP,
+		SourcePort:              item.ConnectionInfo.ClientPort,
+		DestinationPort:         item.ConnectionInfo.ServerPort,
+		IsOutgoing:              item.ConnectionInfo.IsOutgoing,
+	}
+}
+
+func summarizeWebSocketClose(entry *api.MizuEntry) *api.BaseEntryDetails {
+	return &api.BaseEntryDetails{
+		Id:              entry.EntryId,
+		Protocol:        websocketProtocol,
+		Url:             entry.Url,
+		RequestSenderIp: entry.RequestSenderIp,
+		Service:         entry.Service,
+		Path:            entry.Path,
+		Summary:         fmt.Sprintf("%d %s", entry.Status, webSocketCloseCodeNames[entry.Status]),
+		StatusCode:      entry.Status,
+		Method:          entry.Method,
+		Timestamp:       entry.Timestamp,
+		SourceIp:        entry.SourceIp,
+		DestinationIp:   entry.DestinationIp,
+		SourcePort:      entry.SourcePort,
+		DestinationPort: entry.DestinationPort,
+		IsOutgoing:      entry.IsOutgoing,
+		Latency:         entry.ElapsedTime,
+		Rules: api.ApplicableRules{
+			Latency: 0,
+			Status:  false,
+		},
+	}
+}
+
+func representWebSocketClose(webSocketClose *WebSocketClose) []interface{} {
+	details := []map[string]string{
+		{"name": "Close Frame", "value": strconv.FormatBool(webSocketClose.CloseFrame)},
+		{"name": "Code", "value": fmt.Sprintf("%d %s", webSocketClose.Code, webSocketCloseCodeNames[webSocketClose.Code])},
+	}
+	if webSocketClose.Reason != "" {
+		details = append(details, map[string]string{"name": "Reason", "value": webSocketClose.Reason})
+	}
+	details = append(details, map[string]string{"name": "Frames", "value": strconv.Itoa(webSocketClose.Frames)})
+	if webSocketClose.Path != "" {
+		details = append(details, map[string]string{"name": "Path", "value": webSocketClose.Path})
+	}
+
+	data, _ := json.Marshal(details)
+	return []interface{}{map[string]string{
+		"type":  api.TABLE,
+		"title": "Close",
+		"data":  string(data),
+	}}
+}
+
+func representWebSocketClosePair(entry *api.MizuEntry) ([]byte, error) {
+	var pair webSocketClosePair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return nil, errors.New("failed to unmarshal the websocket close")
+	}
+	return json.Marshal(map[string]interface{}{
+		"request":  representWebSocketClose(&pair.Request.Payload.Details),
+		"response": representWebSocketClose(&pair.Response.Payload.Details),
+	})
+}
@@ -255,3 +255,5 @@ func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []by
 }
 
 var Dissector dissecting
+
+var ApiVersion = api.ApiVersion
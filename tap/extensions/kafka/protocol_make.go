@@ -6,13 +6,14 @@ import (
 	"strconv"
 )
 
-type ApiVersion struct {
+// ApiVersionRange is the range of the versions of an api key, the ApiVersion symbol is the version of the extensions api
+type ApiVersionRange struct {
 	ApiKey     int16
 	MinVersion int16
 	MaxVersion int16
 }
 
-func (v ApiVersion) Format(w fmt.State, r rune) {
+func (v ApiVersionRange) Format(w fmt.State, r rune) {
 	switch r {
 	case 's':
 		fmt.Fprint(w, apiKey(v.ApiKey))
@@ -32,7 +33,7 @@ func (v ApiVersion) Format(w fmt.State, r rune) {
 		case w.Flag('+'):
 			fmt.Fprintf(w, "v%d", v.MaxVersion)
 		case w.Flag('#'):
-			fmt.Fprintf(w, "kafka.ApiVersion{ApiKey:%d MinVersion:%d MaxVersion:%d}", v.ApiKey, v.MinVersion, v.MaxVersion)
+			fmt.Fprintf(w, "kafka.ApiVersionRange{ApiKey:%d MinVersion:%d MaxVersion:%d}", v.ApiKey, v.MinVersion, v.MaxVersion)
 		default:
 			fmt.Fprintf(w, "%s[v%d:v%d]", apiKey(v.ApiKey), v.MinVersion, v.MaxVersion)
 		}
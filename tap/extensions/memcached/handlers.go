@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+func handleClientStream(tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, message *MemcachedMessage) {
+	// commands without a reply don't take a place in the order of the replies
+	if !message.NoReply {
+		counterPair.Request++
+	}
+	ident := fmt.Sprintf(
+		"%s->%s %s->%s %s",
+		tcpID.SrcIP,
+		tcpID.DstIP,
+		tcpID.SrcPort,
+		tcpID.DstPort,
+		getSequence(message, counterPair.Request),
+	)
+	item := reqResMatcher.registerRequest(ident, message, superTimer.CaptureTime)
+	if item != nil {
+		item.ConnectionInfo = &api.ConnectionInfo{
+			ClientIP:   tcpID.SrcIP,
+			ClientPort: tcpID.SrcPort,
+			ServerIP:   tcpID.DstIP,
+			ServerPort: tcpID.DstPort,
+			IsOutgoing: true,
+		}
+		emitter.Emit(item)
+	}
+}
+
+func handleServerStream(tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, message *MemcachedMessage) {
+	counterPair.Response++
+	ident := fmt.Sprintf(
+		"%s->%s %s->%s %s",
+		tcpID.DstIP,
+		tcpID.SrcIP,
+		tcpID.DstPort,
+		tcpID.SrcPort,
+		getSequence(message, counterPair.Response),
+	)
+	item := reqResMatcher.registerResponse(ident, message, superTimer.CaptureTime)
+	if item != nil {
+		item.ConnectionInfo = &api.ConnectionInfo{
+			ClientIP:   tcpID.DstIP,
+			ClientPort: tcpID.DstPort,
+			ServerIP:   tcpID.SrcIP,
+			ServerPort: tcpID.SrcPort,
+			IsOutgoing: false,
+		}
+		emitter.Emit(item)
+	}
+}
+
+// getSequence returns what matches a reply to its command, the opaque of binary messages or the position of text ones
+func getSequence(message *MemcachedMessage, counter uint) string {
+	if message.Protocol == protocolBinary {
+		return fmt.Sprintf("b%d", message.Opaque)
+	}
+	return fmt.Sprintf("t%d", counter)
+}
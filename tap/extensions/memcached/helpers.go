@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+type MemcachedPayload struct {
+	Data interface{}
+}
+
+type MemcachedPayloader interface {
+	MarshalJSON() ([]byte, error)
+}
+
+func (h MemcachedPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Data)
+}
+
+type MemcachedWrapper struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Details interface{} `json:"details"`
+}
+
+// memcachedPair is the stored form of a command and its reply
+type memcachedPair struct {
+	Request struct {
+		Payload struct {
+			Details MemcachedMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		Payload struct {
+			Details MemcachedMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+func representRequest(message *MemcachedMessage) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Command", "value": message.Command},
+		{"name": "Key", "value": message.Key},
+	}
+	if len(message.Keys) > 0 {
+		details = append(details, map[string]string{"name": "Keys", "value": strings.Join(message.Keys, ", ")})
+	}
+	details = append(details, []map[string]string{
+		{"name": "Value Size", "value": strconv.Itoa(message.ValueSize)},
+		{"name": "Flags", "value": strconv.FormatUint(uint64(message.Flags), 10)},
+		{"name": "Expiration", "value": strconv.FormatInt(message.Expiration, 10)},
+	}...)
+	if message.Value != "" {
+		details = append(details, map[string]string{"name": "Value", "value": message.Value})
+	}
+	details = append(details, representCommon(message)...)
+	if message.NoReply {
+		details = append(details, map[string]string{"name": "No Reply", "value": "true"})
+	}
+	return append(representation, representTable("Details", details))
+}
+
+func representResponse(message *MemcachedMessage) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Status", "value": message.Status},
+	}
+	if message.Value != "" {
+		details = append(details, map[string]string{"name": "Value", "value": message.Value})
+	}
+	if message.Hits > 0 {
+		details = append(details, []map[string]string{
+			{"name": "Hits", "value": strconv.Itoa(message.Hits)},
+			{"name": "Value Size", "value": strconv.Itoa(message.ValueSize)},
+		}...)
+	}
+	if message.Status != noReplyStatus {
+		details = append(details, representCommon(message)...)
+	}
+	return append(representation, representTable("Details", details))
+}
+
+func representCommon(message *MemcachedMessage) []map[string]string {
+	common := []map[string]string{
+		{"name": "Protocol", "value": message.Protocol},
+	}
+	if message.Protocol == protocolBinary {
+		common = append(common, []map[string]string{
+			{"name": "Opaque", "value": strconv.FormatUint(uint64(message.Opaque), 10)},
+			{"name": "CAS", "value": strconv.FormatUint(message.Cas, 10)},
+		}...)
+	} else if message.Cas != 0 {
+		common = append(common, map[string]string{"name": "CAS", "value": strconv.FormatUint(message.Cas, 10)})
+	}
+	return append(common, map[string]string{"name": "Size", "value": strconv.Itoa(message.Size)})
+}
+
+func representTable(title string, rows []map[string]string) map[string]string {
+	data, _ := json.Marshal(rows)
+	return map[string]string{
+		"type":  api.TABLE,
+		"title": title,
+		"data":  string(data),
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/api/apitest"
+)
+
+const capturedTextClientStream = "" +
+	"set user:1 0 3600 5\r\nhello\r\n" +
+	"get user:1 user:2\r\n" +
+	"delete user:2 noreply\r\n" +
+	"incr visits 3\r\n" +
+	"delete user:3\r\n"
+
+const capturedTextServerStream = "" +
+	"STORED\r\n" +
+	"VALUE user:1 0 5\r\nhello\r\nEND\r\n" +
+	"8\r\n" +
+	"NOT_FOUND\r\n"
+
+func binaryPacket(magic byte, opcode byte, status uint16, opaque uint32, cas uint64, extras []byte, key string, value []byte) string {
+	header := make([]byte, binaryHeaderSize)
+	header[0], header[1] = magic, opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(key)))
+	header[4] = byte(len(extras))
+	binary.BigEndian.PutUint16(header[6:8], status)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(header[12:16], opaque)
+	binary.BigEndian.PutUint64(header[16:24], cas)
+	return string(bytes.Join([][]byte{header, extras, []byte(key), value}, nil))
+}
+
+func uint64Bytes(value uint64) []byte {
+	valueBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(valueBytes, value)
+	return valueBytes
+}
+
+var capturedBinaryClientStream = "" +
+	// set a = "xyz" with flags 7 and no expiration
+	binaryPacket(binaryRequestMagic, 0x01, 0, 1, 0, []byte{0, 0, 0, 7, 0, 0, 0, 0}, "a", []byte("xyz")) +
+	// a quiet get of a missing key, the server doesn't reply
+	binaryPacket(binaryRequestMagic, 0x09, 0, 2, 0, nil, "missing", nil) +
+	binaryPacket(binaryRequestMagic, 0x00, 0, 3, 0, nil, "a", nil) +
+	// increment n by 1 from 0
+	binaryPacket(binaryRequestMagic, 0x05, 0, 4, 0, append(append(uint64Bytes(1), uint64Bytes(0)...), 0, 0, 0, 0), "n", nil) +
+	binaryPacket(binaryRequestMagic, 0x04, 0, 5, 0, nil, "b", nil)
+
+var capturedBinaryServerStream = "" +
+	binaryPacket(binaryResponseMagic, 0x01, 0, 1, 11, nil, "", nil) +
+	binaryPacket(binaryResponseMagic, 0x00, 0, 3, 11, []byte{0, 0, 0, 7}, "", []byte("xyz")) +
+	binaryPacket(binaryResponseMagic, 0x05, 0, 4, 12, nil, "", uint64Bytes(42)) +
+	binaryPacket(binaryResponseMagic, 0x04, 0x01, 5, 0, nil, "", []byte("Not found"))
+
+func resetOpenMessages() {
+	reqResMatcher.openMessagesMap.Range(func(key, _ interface{}) bool {
+		reqResMatcher.openMessagesMap.Delete(key)
+		return true
+	})
+}
+
+// dissectSession feeds a captured session, the server stream first so every command completes a pair
+func dissectSession(t *testing.T, clientStream string, serverStream string, serverPort string) ([]*api.MizuEntry, error, error) {
+	resetOpenMessages()
+	return apitest.DissectSession(t, Dissector, &apitest.Session{ClientStream: clientStream, ServerStream: serverStream, ServerPort: serverPort, ResolvedDestination: "cache.default"})
+}
+
+func getPair(t *testing.T, entry *api.MizuEntry) *memcachedPair {
+	var pair memcachedPair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	return &pair
+}
+
+func TestDissectText(t *testing.T) {
+	entries, clientErr, serverErr := dissectSession(t, capturedTextClientStream, capturedTextServerStream, "11211")
+	if clientErr != io.EOF || serverErr != io.EOF {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", io.EOF, clientErr, serverErr)
+	}
+
+	expected := []struct {
+		command           string
+		key               string
+		requestValueSize  int
+		status            string
+		responseValueSize int
+		value             string
+	}{
+		{command: "set", key: "user:1", requestValueSize: 5, status: "STORED"},
+		{command: "get", key: "user:1", status: "END", responseValueSize: 5},
+		{command: "delete", key: "user:2", status: noReplyStatus},
+		{command: "incr", key: "visits", status: numberStatus, value: "8"},
+		{command: "delete", key: "user:3", status: "NOT_FOUND"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		pair := getPair(t, entry)
+		request, response := pair.Request.Payload.Details, pair.Response.Payload.Details
+		if entry.Method != expected[i].command || entry.Path != expected[i].key || entry.Url != "cache.default/"+expected[i].key {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v %v", expected[i], entry.Method, entry.Path, entry.Url)
+		}
+		if request.Protocol != protocolText || request.ValueSize != expected[i].requestValueSize {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[i], request)
+		}
+		if response.Status != expected[i].status || response.ValueSize != expected[i].responseValueSize || response.Value != expected[i].value {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[i], response)
+		}
+	}
+
+	getRequest := getPair(t, entries[1]).Request.Payload.Details
+	if strings.Join(getRequest.Keys, ",") != "user:1,user:2" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "user:1,user:2", getRequest.Keys)
+	}
+	if getResponse := getPair(t, entries[1]).Response.Payload.Details; getResponse.Hits != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, getResponse.Hits)
+	}
+	if setRequest := getPair(t, entries[0]).Request.Payload.Details; setRequest.Expiration != 3600 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 3600, setRequest.Expiration)
+	}
+}
+
+func TestDissectBinary(t *testing.T) {
+	entries, clientErr, serverErr := dissectSession(t, capturedBinaryClientStream, capturedBinaryServerStream, "11211")
+	if clientErr != io.EOF || serverErr != io.EOF {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", io.EOF, clientErr, serverErr)
+	}
+
+	expected := []struct {
+		command           string
+		key               string
+		opaque            uint32
+		requestValueSize  int
+		status            string
+		responseValueSize int
+		value             string
+	}{
+		{command: "set", key: "a", opaque: 1, requestValueSize: 3, status: "success"},
+		{command: "get", key: "a", opaque: 3, status: "success", responseValueSize: 3},
+		{command: "increment", key: "n", opaque: 4, status: "success", responseValueSize: 8, value: "42"},
+		{command: "delete", key: "b", opaque: 5, status: "key_not_found", responseValueSize: 9, value: "Not found"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		pair := getPair(t, entry)
+		request, response := pair.Request.Payload.Details, pair.Response.Payload.Details
+		if entry.Method != expected[i].command || entry.Path != expected[i].key {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", expected[i], entry.Method, entry.Path)
+		}
+		if request.Protocol != protocolBinary || request.Opaque != expected[i].opaque || response.Opaque != expected[i].opaque || request.ValueSize != expected[i].requestValueSize {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", expected[i], request, response)
+		}
+		if response.Status != expected[i].status || response.ValueSize != expected[i].responseValueSize || response.Value != expected[i].value {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[i], response)
+		}
+	}
+
+	if setRequest := getPair(t, entries[0]).Request.Payload.Details; setRequest.Flags != 7 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 7, setRequest.Flags)
+	}
+	if incrementRequest := getPair(t, entries[2]).Request.Payload.Details; incrementRequest.Value != "1" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "1", incrementRequest.Value)
+	}
+}
+
+func TestRepresent(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedTextClientStream, capturedTextServerStream, "11211")
+	_, object, bodySize, err := Dissector.Represent(entries[0])
+	if err != nil {
+		t.Fatalf("failed to represent entry: %v", err)
+	}
+	if bodySize != 5 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 5, bodySize)
+	}
+
+	var representation map[string][]map[string]string
+	if err := json.Unmarshal(object, &representation); err != nil {
+		t.Fatalf("failed to unmarshal representation: %v", err)
+	}
+	if !strings.Contains(representation["request"][0]["data"], `"value":"user:1"`) || !strings.Contains(representation["response"][0]["data"], `"value":"STORED"`) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the key and the status", representation)
+	}
+}
+
+func TestDissectNotMemcached(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientStream string
+		serverPort   string
+	}{
+		{name: "http", clientStream: "GET / HTTP/1.1\r\nHost: cache\r\n\r\n", serverPort: "11211"},
+		{name: "response magic from the client", clientStream: capturedBinaryServerStream, serverPort: "11211"},
+		{name: "another port", clientStream: capturedTextClientStream, serverPort: "8080"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, clientErr, _ := dissectSession(t, test.clientStream, "", test.serverPort)
+			if clientErr == nil || clientErr == io.EOF || len(entries) != 0 {
+				t.Errorf("unexpected result - expected an error, actual: %v %v", clientErr, len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var reqResMatcher = createResponseRequestMatcher() // global
+
+// Key is {client_addr}:{client_port}->{dest_addr}:{dest_port},{sequence}
+// binary messages are matched by their opaque, the text replies come in the order of the commands
+type requestResponseMatcher struct {
+	openMessagesMap *sync.Map
+}
+
+func createResponseRequestMatcher() requestResponseMatcher {
+	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}}
+	return *newMatcher
+}
+
+func (matcher *requestResponseMatcher) registerRequest(ident string, message *MemcachedMessage, captureTime time.Time) *api.OutputChannelItem {
+	requestMemcachedMessage := api.GenericMessage{
+		IsRequest:   true,
+		CaptureTime: captureTime,
+		Payload: MemcachedPayload{
+			Data: &MemcachedWrapper{
+				Method:  message.Command,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	// noreply commands are paired with an empty response right away
+	if message.NoReply {
+		responseMemcachedMessage := api.GenericMessage{
+			IsRequest:   false,
+			CaptureTime: captureTime,
+			Payload: MemcachedPayload{
+				Data: &MemcachedWrapper{
+					Method:  message.Command,
+					Url:     "",
+					Details: &MemcachedMessage{Protocol: message.Protocol, Command: message.Command, Opaque: message.Opaque, Status: noReplyStatus},
+				},
+			},
+		}
+		return matcher.preparePair(&requestMemcachedMessage, &responseMemcachedMessage)
+	}
+
+	key := genKey(splitIdent(ident))
+	if response, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		responseMemcachedMessage := response.(*api.GenericMessage)
+		if responseMemcachedMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(&requestMemcachedMessage, responseMemcachedMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &requestMemcachedMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) registerResponse(ident string, message *MemcachedMessage, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	responseMemcachedMessage := api.GenericMessage{
+		IsRequest:   false,
+		CaptureTime: captureTime,
+		Payload: MemcachedPayload{
+			Data: &MemcachedWrapper{
+				Method:  message.Command,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	if request, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		requestMemcachedMessage := request.(*api.GenericMessage)
+		if !requestMemcachedMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(requestMemcachedMessage, &responseMemcachedMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &responseMemcachedMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) preparePair(requestMemcachedMessage *api.GenericMessage, responseMemcachedMessage *api.GenericMessage) *api.OutputChannelItem {
+	return &api.OutputChannelItem{
+		Protocol:       protocol,
+		Timestamp:      requestMemcachedMessage.CaptureTime.UnixNano() / int64(time.Millisecond),
+		ConnectionInfo: nil,
+		Pair: &api.RequestResponsePair{
+			Request:  *requestMemcachedMessage,
+			Response: *responseMemcachedMessage,
+		},
+	}
+}
+
+func splitIdent(ident string) []string {
+	ident = strings.Replace(ident, "->", " ", -1)
+	return strings.Split(ident, " ")
+}
+
+func genKey(split []string) string {
+	key := fmt.Sprintf("%s:%s->%s:%s,%s", split[0], split[2], split[1], split[3], split[4])
+	return key
+}
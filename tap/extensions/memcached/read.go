@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxTextLineLength  = 8192
+	maxValueSize       = 16 * 1024 * 1024
+	maxReadValueLength = 1024
+)
+
+var errLineTooLong = errors.New("memcached line too long")
+
+// ReadMessage reads a command from the client stream or a reply from the server stream, binary messages start with
+// their magic byte and text messages with a command or a reply keyword
+func ReadMessage(b *bufio.Reader, isClient bool) (*MemcachedMessage, error) {
+	first, err := b.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == binaryRequestMagic || first[0] == binaryResponseMagic {
+		return readBinaryMessage(b, isClient)
+	}
+	if isClient {
+		return readTextRequest(b)
+	}
+	return readTextResponse(b)
+}
+
+func readLine(b *bufio.Reader) (string, int, error) {
+	var line []byte
+	for {
+		fragment, err := b.ReadSlice('\n')
+		if len(line)+len(fragment) > maxTextLineLength {
+			return "", 0, errLineTooLong
+		}
+		line = append(line, fragment...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		break
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", 0, errors.New("memcached line must end with \\r\\n")
+	}
+	return string(line[:len(line)-2]), len(line), nil
+}
+
+// readDataBlock skips a data block of size bytes and its terminating \r\n
+func readDataBlock(b *bufio.Reader, size int) error {
+	if size < 0 || size > maxValueSize {
+		return fmt.Errorf("invalid memcached data block size %d", size)
+	}
+	if _, err := b.Discard(size); err != nil {
+		return err
+	}
+	terminator := make([]byte, 2)
+	if _, err := io.ReadFull(b, terminator); err != nil {
+		return err
+	}
+	if string(terminator) != "\r\n" {
+		return errors.New("memcached data block must end with \\r\\n")
+	}
+	return nil
+}
+
+func readTextRequest(b *bufio.Reader) (*MemcachedMessage, error) {
+	line, size, err := readLine(b)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.Fields(line)
+	if len(tokens) == 0 {
+		return nil, errors.New("empty memcached command")
+	}
+
+	message := &MemcachedMessage{Protocol: protocolText, Command: tokens[0], Size: size}
+	arguments := tokens[1:]
+	if len(arguments) > 0 && arguments[len(arguments)-1] == "noreply" {
+		message.NoReply = true
+		arguments = arguments[:len(arguments)-1]
+	}
+
+	switch {
+	case textStorageCommands[message.Command]:
+		// <command> <key> <flags> <exptime> <bytes> [<cas unique>]
+		expectedArguments := 4
+		if message.Command == "cas" {
+			expectedArguments = 5
+		}
+		if len(arguments) != expectedArguments {
+			return nil, fmt.Errorf("invalid memcached %s command", message.Command)
+		}
+		message.Key = arguments[0]
+		flags, flagsErr := strconv.ParseUint(arguments[1], 10, 32)
+		expiration, expirationErr := strconv.ParseInt(arguments[2], 10, 64)
+		valueSize, valueSizeErr := strconv.Atoi(arguments[3])
+		if flagsErr != nil || expirationErr != nil || valueSizeErr != nil {
+			return nil, fmt.Errorf("invalid memcached %s command", message.Command)
+		}
+		message.Flags, message.Expiration, message.ValueSize = uint32(flags), expiration, valueSize
+		if message.Command == "cas" {
+			if message.Cas, err = strconv.ParseUint(arguments[4], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid memcached cas command")
+			}
+		}
+		if err := readDataBlock(b, valueSize); err != nil {
+			return nil, err
+		}
+		message.Size += valueSize + 2
+	case textRetrievalCommands[message.Command]:
+		// get <key>*, gat <exptime> <key>*
+		if strings.HasPrefix(message.Command, "gat") {
+			if len(arguments) == 0 {
+				return nil, fmt.Errorf("invalid memcached %s command", message.Command)
+			}
+			if message.Expiration, err = strconv.ParseInt(arguments[0], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid memcached %s command", message.Command)
+			}
+			arguments = arguments[1:]
+		}
+		if len(arguments) == 0 {
+			return nil, fmt.Errorf("memcached %s command without a key", message.Command)
+		}
+		message.Key = arguments[0]
+		if len(arguments) > 1 {
+			message.Keys = arguments
+		}
+	case textKeyCommands[message.Command]:
+		// delete <key>, incr <key> <value>, touch <key> <exptime>
+		if len(arguments) == 0 {
+			return nil, fmt.Errorf("memcached %s command without a key", message.Command)
+		}
+		message.Key = arguments[0]
+		if message.Command == "touch" && len(arguments) > 1 {
+			message.Expiration, _ = strconv.ParseInt(arguments[1], 10, 64)
+		}
+		if (message.Command == "incr" || message.Command == "decr") && len(arguments) > 1 {
+			message.Value = arguments[1]
+		}
+	case textOtherCommands[message.Command]:
+		// the server closes the connection instead of replying to quit
+		if message.Command == "quit" {
+			message.NoReply = true
+		}
+	default:
+		return nil, fmt.Errorf("unknown memcached command %.32q", message.Command)
+	}
+	return message, nil
+}
+
+func readTextResponse(b *bufio.Reader) (*MemcachedMessage, error) {
+	message := &MemcachedMessage{Protocol: protocolText}
+	isMultiLine := false
+	for {
+		line, size, err := readLine(b)
+		if err != nil {
+			return nil, err
+		}
+		message.Size += size
+		keyword := line
+		rest := ""
+		if separatorIndex := strings.IndexByte(line, ' '); separatorIndex >= 0 {
+			keyword, rest = line[:separatorIndex], line[separatorIndex+1:]
+		}
+
+		switch {
+		case keyword == "VALUE":
+			// VALUE <key> <flags> <bytes> [<cas unique>]
+			tokens := strings.Fields(rest)
+			if len(tokens) < 3 {
+				return nil, errors.New("invalid memcached VALUE reply")
+			}
+			valueSize, err := strconv.Atoi(tokens[2])
+			if err != nil {
+				return nil, errors.New("invalid memcached VALUE reply")
+			}
+			if err := readDataBlock(b, valueSize); err != nil {
+				return nil, err
+			}
+			message.Size += valueSize + 2
+			message.ValueSize += valueSize
+			message.Hits++
+			isMultiLine = true
+			if message.Hits == 1 {
+				message.Key = tokens[0]
+			}
+			message.Keys = append(message.Keys, tokens[0])
+		case keyword == "STAT":
+			isMultiLine = true
+		case keyword == "END":
+			message.Status = keyword
+			if len(message.Keys) < 2 {
+				message.Keys = nil
+			}
+			return message, nil
+		case isMultiLine:
+			return nil, fmt.Errorf("unexpected memcached reply %.32q before END", keyword)
+		case textReplyKeywords[keyword]:
+			message.Status, message.Value = keyword, rest
+			return message, nil
+		case isNumber(keyword) && rest == "":
+			message.Status, message.Value = numberStatus, keyword
+			return message, nil
+		default:
+			return nil, fmt.Errorf("unknown memcached reply %.32q", keyword)
+		}
+	}
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+// readBinaryMessage reads a message of the binary protocol, a 24 bytes header followed by the extras, the key and
+// the value. Only the values of replies that carry a number, a version or an error message are kept.
+func readBinaryMessage(b *bufio.Reader, isClient bool) (*MemcachedMessage, error) {
+	header := make([]byte, binaryHeaderSize)
+	if _, err := io.ReadFull(b, header); err != nil {
+		return nil, err
+	}
+	isRequest := header[0] == binaryRequestMagic
+	if isRequest != isClient {
+		return nil, fmt.Errorf("unexpected memcached magic 0x%x", header[0])
+	}
+
+	opcode := header[1]
+	keyLength := int(binary.BigEndian.Uint16(header[2:4]))
+	extrasLength := int(header[4])
+	status := binary.BigEndian.Uint16(header[6:8])
+	bodyLength := int(binary.BigEndian.Uint32(header[8:12]))
+	valueSize := bodyLength - keyLength - extrasLength
+	if valueSize < 0 || bodyLength > maxValueSize {
+		return nil, fmt.Errorf("invalid memcached body length %d", bodyLength)
+	}
+
+	message := &MemcachedMessage{
+		Protocol:  protocolBinary,
+		Command:   getBinaryOpcodeName(opcode),
+		ValueSize: valueSize,
+		Opaque:    binary.BigEndian.Uint32(header[12:16]),
+		Cas:       binary.BigEndian.Uint64(header[16:24]),
+		Size:      binaryHeaderSize + bodyLength,
+	}
+	// quitq is the only command never replied to, the other quiet commands are replied to on errors and on hits
+	message.NoReply = isRequest && message.Command == "quitq"
+
+	extras := make([]byte, extrasLength)
+	if _, err := io.ReadFull(b, extras); err != nil {
+		return nil, err
+	}
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(b, key); err != nil {
+		return nil, err
+	}
+	message.Key = string(key)
+	readBinaryExtras(message, extras, isRequest)
+
+	if isRequest {
+		_, err := b.Discard(valueSize)
+		return message, err
+	}
+
+	message.Status = getBinaryStatusName(status)
+	if status == 0 && binaryRetrievalCommands[message.Command] {
+		message.Hits = 1
+	}
+	isNumberReply := message.Command == "increment" || message.Command == "decrement" || message.Command == "incrementq" || message.Command == "decrementq"
+	if status == 0 && !isNumberReply && message.Command != "version" {
+		_, err := b.Discard(valueSize)
+		return message, err
+	}
+	readLength := valueSize
+	if readLength > maxReadValueLength {
+		readLength = maxReadValueLength
+	}
+	value := make([]byte, readLength)
+	if _, err := io.ReadFull(b, value); err != nil {
+		return nil, err
+	}
+	if _, err := b.Discard(valueSize - readLength); err != nil {
+		return nil, err
+	}
+	if status == 0 && isNumberReply && len(value) == 8 {
+		message.Value = strconv.FormatUint(binary.BigEndian.Uint64(value), 10)
+	} else {
+		message.Value = string(value)
+	}
+	return message, nil
+}
+
+func readBinaryExtras(message *MemcachedMessage, extras []byte, isRequest bool) {
+	switch {
+	case isRequest && len(extras) == 8:
+		// set, add and replace: flags and expiration
+		message.Flags = binary.BigEndian.Uint32(extras[0:4])
+		message.Expiration = int64(binary.BigEndian.Uint32(extras[4:8]))
+	case isRequest && len(extras) == 20:
+		// increment and decrement: delta, initial value and expiration
+		message.Value = strconv.FormatUint(binary.BigEndian.Uint64(extras[0:8]), 10)
+		message.Expiration = int64(binary.BigEndian.Uint32(extras[16:20]))
+	case isRequest && len(extras) == 4:
+		// touch, gat and flush: expiration
+		message.Expiration = int64(binary.BigEndian.Uint32(extras))
+	case !isRequest && len(extras) == 4:
+		// the replies to gets: flags
+		message.Flags = binary.BigEndian.Uint32(extras)
+	}
+}
+
+func getBinaryOpcodeName(opcode byte) string {
+	if name, ok := binaryOpcodeNames[opcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", opcode)
+}
+
+func getBinaryStatusName(status uint16) string {
+	if name, ok := binaryStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", status)
+}
@@ -0,0 +1,118 @@
+package main
+
+const (
+	protocolText   = "text"
+	protocolBinary = "binary"
+)
+
+// noReplyStatus is the status of the response paired with a request the server doesn't reply to
+const noReplyStatus = "none"
+
+// numberStatus is the status of the text replies to incr and decr, they are the new value
+const numberStatus = "NUMBER"
+
+const (
+	binaryRequestMagic  = 0x80
+	binaryResponseMagic = 0x81
+	binaryHeaderSize    = 24
+)
+
+var binaryOpcodeNames = map[byte]string{
+	0x00: "get",
+	0x01: "set",
+	0x02: "add",
+	0x03: "replace",
+	0x04: "delete",
+	0x05: "increment",
+	0x06: "decrement",
+	0x07: "quit",
+	0x08: "flush",
+	0x09: "getq",
+	0x0a: "noop",
+	0x0b: "version",
+	0x0c: "getk",
+	0x0d: "getkq",
+	0x0e: "append",
+	0x0f: "prepend",
+	0x10: "stat",
+	0x11: "setq",
+	0x12: "addq",
+	0x13: "replaceq",
+	0x14: "deleteq",
+	0x15: "incrementq",
+	0x16: "decrementq",
+	0x17: "quitq",
+	0x18: "flushq",
+	0x19: "appendq",
+	0x1a: "prependq",
+	0x1b: "verbosity",
+	0x1c: "touch",
+	0x1d: "gat",
+	0x1e: "gatq",
+	0x20: "sasl_list_mechs",
+	0x21: "sasl_auth",
+	0x22: "sasl_step",
+}
+
+var binaryRetrievalCommands = map[string]bool{"get": true, "getq": true, "getk": true, "getkq": true, "gat": true, "gatq": true}
+
+var binaryStatusNames = map[uint16]string{
+	0x00: "success",
+	0x01: "key_not_found",
+	0x02: "key_exists",
+	0x03: "value_too_large",
+	0x04: "invalid_arguments",
+	0x05: "item_not_stored",
+	0x06: "non_numeric_value",
+	0x07: "wrong_vbucket",
+	0x20: "authentication_error",
+	0x21: "authentication_continue",
+	0x81: "unknown_command",
+	0x82: "out_of_memory",
+	0x83: "not_supported",
+	0x84: "internal_error",
+	0x85: "busy",
+	0x86: "temporary_failure",
+}
+
+// the text commands by the position of their arguments, storage commands are followed by a data block
+var (
+	textStorageCommands   = map[string]bool{"set": true, "add": true, "replace": true, "append": true, "prepend": true, "cas": true}
+	textRetrievalCommands = map[string]bool{"get": true, "gets": true, "gat": true, "gats": true}
+	textKeyCommands       = map[string]bool{"delete": true, "incr": true, "decr": true, "touch": true}
+	textOtherCommands     = map[string]bool{"stats": true, "version": true, "flush_all": true, "verbosity": true, "quit": true}
+)
+
+// the single line text replies, retrieval and stats replies end with END
+var textReplyKeywords = map[string]bool{
+	"STORED":       true,
+	"NOT_STORED":   true,
+	"EXISTS":       true,
+	"NOT_FOUND":    true,
+	"DELETED":      true,
+	"TOUCHED":      true,
+	"OK":           true,
+	"ERROR":        true,
+	"CLIENT_ERROR": true,
+	"SERVER_ERROR": true,
+	"VERSION":      true,
+}
+
+// MemcachedMessage is a command or its reply, in either protocol. Text replies don't name their command, the command
+// of an entry is the one of its request.
+type MemcachedMessage struct {
+	Protocol   string   `json:"protocol"`
+	Command    string   `json:"command,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	Keys       []string `json:"keys,omitempty"` // all the keys of a multi key retrieval
+	ValueSize  int      `json:"valueSize"`
+	Flags      uint32   `json:"flags,omitempty"`
+	Expiration int64    `json:"expiration,omitempty"`
+	Cas        uint64   `json:"cas,omitempty"`
+	Opaque     uint32   `json:"opaque,omitempty"`
+	NoReply    bool     `json:"noReply,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Value      string   `json:"value,omitempty"` // the new value of incr and decr, the version or the error message
+	Hits       int      `json:"hits,omitempty"`  // the items returned by a retrieval
+	Size       int      `json:"size"`
+}
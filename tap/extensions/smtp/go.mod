@@ -0,0 +1,7 @@
+module github.com/up9inc/mizu/tap/extensions/smtp
+
+go 1.16
+
+require github.com/up9inc/mizu/tap/api v0.0.0
+
+replace github.com/up9inc/mizu/tap/api v0.0.0 => ../../api
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+type SmtpPayload struct {
+	Data interface{}
+}
+
+type SmtpPayloader interface {
+	MarshalJSON() ([]byte, error)
+}
+
+func (h SmtpPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Data)
+}
+
+type SmtpWrapper struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Details interface{} `json:"details"`
+}
+
+// smtpPair is the stored form of a command and its reply
+type smtpPair struct {
+	Request struct {
+		Payload struct {
+			Details SmtpCommand `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		Payload struct {
+			Details SmtpReply `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+// getSummary describes the command by its most relevant argument: the mailbox, the message subject or the argument itself
+func getSummary(command *SmtpCommand) string {
+	switch {
+	case command.Address != "":
+		return command.Address
+	case command.Message != nil:
+		for _, header := range command.Message.Headers {
+			if strings.EqualFold(header.Name, "Subject") {
+				return header.Value
+			}
+		}
+		return fmt.Sprintf("%s -> %s", command.Message.Envelope.From, strings.Join(command.Message.Envelope.Recipients, ", "))
+	default:
+		return command.Argument
+	}
+}
+
+func representCommand(command *SmtpCommand) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Command", "value": command.Command},
+	}
+	if command.Argument != "" {
+		details = append(details, map[string]string{"name": "Argument", "value": command.Argument})
+	}
+	if command.Address != "" {
+		details = append(details, map[string]string{"name": "Address", "value": command.Address})
+	}
+	representation = append(representation, representTable("Details", details))
+
+	if message := command.Message; message != nil {
+		representation = append(representation, representTable("Envelope", []map[string]string{
+			{"name": "From", "value": message.Envelope.From},
+			{"name": "Recipients", "value": strings.Join(message.Envelope.Recipients, ", ")},
+			{"name": "Body Size", "value": strconv.Itoa(message.BodySize)},
+		}))
+
+		headers := make([]map[string]string, 0, len(message.Headers))
+		for _, header := range message.Headers {
+			headers = append(headers, map[string]string{"name": header.Name, "value": header.Value})
+		}
+		representation = append(representation, representTable("Headers", headers))
+
+		representation = append(representation, map[string]string{
+			"type":      api.BODY,
+			"title":     "Body",
+			"encoding":  "",
+			"mime_type": "text/plain",
+			"data":      message.Body,
+		})
+	}
+
+	return
+}
+
+func representReply(reply *SmtpReply) (representation []interface{}) {
+	representation = append(representation, representTable("Details", []map[string]string{
+		{"name": "Code", "value": strconv.Itoa(reply.Code)},
+		{"name": "Text", "value": strings.Join(reply.Lines, "\n")},
+	}))
+	return
+}
+
+func representTable(title string, rows []map[string]string) map[string]string {
+	data, _ := json.Marshal(rows)
+	return map[string]string{
+		"type":  api.TABLE,
+		"title": title,
+		"data":  string(data),
+	}
+}
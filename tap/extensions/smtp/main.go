@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var protocol api.Protocol = api.Protocol{
+	Name:            "smtp",
+	LongName:        "Simple Mail Transfer Protocol",
+	Abbreviation:    "SMTP",
+	Version:         "RFC 5321",
+	BackgroundColor: "#3b7a57",
+	ForegroundColor: "#ffffff",
+	FontSize:        11,
+	ReferenceLink:   "https://datatracker.ietf.org/doc/html/rfc5321",
+	Ports:           []string{"25", "587"},
+	Priority:        3,
+}
+
+func init() {
+	log.Println("Initializing SMTP extension...")
+}
+
+type dissecting string
+
+func (d dissecting) Register(extension *api.Extension) {
+	extension.Protocol = &protocol
+	extension.MatcherMap = reqResMatcher.openMessagesMap
+}
+
+func (d dissecting) Ping() {
+	log.Printf("pong %s\n", protocol.Name)
+}
+
+func (d dissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, superIdentifier *api.SuperIdentifier, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	serverPort := tcpID.DstPort
+	if !isClient {
+		serverPort = tcpID.SrcPort
+	}
+	if !isSmtpPort(serverPort) {
+		return fmt.Errorf("port %s isn't an SMTP port", serverPort)
+	}
+
+	if isClient {
+		return dissectClient(b, tcpID, counterPair, superTimer, emitter, options)
+	}
+	return dissectServer(b, tcpID, counterPair, superTimer, emitter)
+}
+
+func dissectClient(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	reader := NewClientReader(b, !options.DisableRedaction)
+	for {
+		command, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		handleClientStream(tcpID, counterPair, superTimer, emitter, command)
+
+		if command.Command == startTlsCommand && reader.IsTlsHandshakeNext() {
+			return ErrTlsUpgrade
+		}
+	}
+}
+
+func dissectServer(b *bufio.Reader, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, emitter api.Emitter) error {
+	greeting, err := ReadReply(b)
+	if err != nil {
+		return err
+	}
+	if greeting.Code != greetingCode {
+		return fmt.Errorf("unexpected SMTP greeting code %d", greeting.Code)
+	}
+
+	for {
+		reply, err := ReadReply(b)
+		if err != nil {
+			return err
+		}
+		handleServerStream(tcpID, counterPair, superTimer, emitter, reply)
+
+		// the only 220 reply after the greeting accepts STARTTLS
+		if reply.Code == startTlsCode {
+			return ErrTlsUpgrade
+		}
+	}
+}
+
+func isSmtpPort(port string) bool {
+	for _, smtpPort := range protocol.Ports {
+		if port == smtpPort {
+			return true
+		}
+	}
+	return false
+}
+
+func (d dissecting) Analyze(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	entryBytes, _ := json.Marshal(item.Pair)
+	var pair smtpPair
+	json.Unmarshal(entryBytes, &pair)
+	command := &pair.Request.Payload.Details
+
+	service := "smtp"
+	if resolvedDestination != "" {
+		service = resolvedDestination
+	} else if resolvedSource != "" {
+		service = resolvedSource
+	}
+
+	summary := getSummary(command)
+	elapsedTime := item.Pair.Response.CaptureTime.Sub(item.Pair.Request.CaptureTime).Round(time.Millisecond).Milliseconds()
+	return &api.MizuEntry{
+		ProtocolName:            protocol.Name,
+		ProtocolLongName:        protocol.LongName,
+		ProtocolAbbreviation:    protocol.Abbreviation,
+		ProtocolVersion:         protocol.Version,
+		ProtocolBackgroundColor: protocol.BackgroundColor,
+		ProtocolForegroundColor: protocol.ForegroundColor,
+		ProtocolFontSize:        protocol.FontSize,
+		ProtocolReferenceLink:   protocol.ReferenceLink,
+		EntryId:                 entryId,
+		Entry:                   string(entryBytes),
+		Url:                     fmt.Sprintf("%s%s", service, summary),
+		Method:                  command.Command,
+		Status:                  pair.Response.Payload.Details.Code,
+		RequestSenderIp:         item.ConnectionInfo.ClientIP,
+		Service:                 service,
+		Timestamp:               item.Timestamp,
+		ElapsedTime:             elapsedTime,
+		Path:                    summary,
+		ResolvedSource:          resolvedSource,
+		ResolvedDestination:     resolvedDestination,
+		SourceIp:                item.ConnectionInfo.ClientIP,
+		DestinationIp:           item.ConnectionInfo.ServerIP,
+		SourcePort:              item.ConnectionInfo.ClientPort,
+		DestinationPort:         item.ConnectionInfo.ServerPort,
+		IsOutgoing:              item.ConnectionInfo.IsOutgoing,
+	}
+}
+
+func (d dissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
+	return &api.BaseEntryDetails{
+		Id:              entry.EntryId,
+		Protocol:        protocol,
+		Url:             entry.Url,
+		RequestSenderIp: entry.RequestSenderIp,
+		Service:         entry.Service,
+		Summary:         entry.Path,
+		StatusCode:      entry.Status,
+		Method:          entry.Method,
+		Timestamp:       entry.Timestamp,
+		SourceIp:        entry.SourceIp,
+		DestinationIp:   entry.DestinationIp,
+		SourcePort:      entry.SourcePort,
+		DestinationPort: entry.DestinationPort,
+		IsOutgoing:      entry.IsOutgoing,
+		Latency:         entry.ElapsedTime,
+		Rules: api.ApplicableRules{
+			Latency: 0,
+			Status:  false,
+		},
+	}
+}
+
+func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []byte, bodySize int64, err error) {
+	p = protocol
+	var pair smtpPair
+	if err = json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return
+	}
+	if message := pair.Request.Payload.Details.Message; message != nil {
+		bodySize = int64(message.BodySize)
+	}
+
+	representation := map[string]interface{}{
+		"request":  representCommand(&pair.Request.Payload.Details),
+		"response": representReply(&pair.Response.Payload.Details),
+	}
+	object, err = json.Marshal(representation)
+	return
+}
+
+var Dissector dissecting
+
+var ApiVersion = api.ApiVersion
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/api/apitest"
+)
+
+const capturedClientStream = "" +
+	"EHLO notifications.example.com\r\n" +
+	"AUTH LOGIN\r\n" +
+	"bm90aWZpZXI=\r\n" +
+	"c2VjcmV0\r\n" +
+	"MAIL FROM:<noreply@example.com> SIZE=512\r\n" +
+	"RCPT TO:<alice@example.com>\r\n" +
+	"RCPT TO:<bob@example.com> NOTIFY=SUCCESS\r\n" +
+	"DATA\r\n" +
+	"From: noreply@example.com\r\n" +
+	"To: alice@example.com, bob@example.com\r\n" +
+	"Subject: Your order\r\n" +
+	"  has shipped\r\n" +
+	"\r\n" +
+	"Hello,\r\n" +
+	"..your order is on its way.\r\n" +
+	".\r\n" +
+	"QUIT\r\n"
+
+const capturedServerStream = "" +
+	"220 mail.example.com ESMTP ready\r\n" +
+	"250-mail.example.com\r\n" +
+	"250-PIPELINING\r\n" +
+	"250 AUTH LOGIN PLAIN\r\n" +
+	"334 VXNlcm5hbWU6\r\n" +
+	"334 UGFzc3dvcmQ6\r\n" +
+	"235 2.7.0 Authentication successful\r\n" +
+	"250 2.1.0 Ok\r\n" +
+	"250 2.1.5 Ok\r\n" +
+	"250 2.1.5 Ok\r\n" +
+	"354 End data with <CR><LF>.<CR><LF>\r\n" +
+	"250 2.0.0 Ok: queued as 12345\r\n" +
+	"221 2.0.0 Bye\r\n"
+
+func resetOpenMessages() {
+	reqResMatcher.openMessagesMap.Range(func(key, _ interface{}) bool {
+		reqResMatcher.openMessagesMap.Delete(key)
+		return true
+	})
+}
+
+// dissectSession feeds a captured session, the server stream first so every command completes a pair
+func dissectSession(t *testing.T, clientStream string, serverStream string, options *api.TrafficFilteringOptions) ([]*api.MizuEntry, error, error) {
+	resetOpenMessages()
+	return apitest.DissectSession(t, Dissector, &apitest.Session{ClientStream: clientStream, ServerStream: serverStream, ServerPort: "587", Options: options, ResolvedDestination: "mail.default"})
+}
+
+func getCommand(t *testing.T, entry *api.MizuEntry) *SmtpCommand {
+	var pair smtpPair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	return &pair.Request.Payload.Details
+}
+
+func TestDissectEnvelope(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedClientStream, capturedServerStream, &api.TrafficFilteringOptions{})
+
+	expected := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: "EHLO", path: "notifications.example.com", status: 250},
+		{method: "AUTH", path: "LOGIN", status: 334},
+		{method: authDataCommand, path: redactedValue, status: 334},
+		{method: authDataCommand, path: redactedValue, status: 235},
+		{method: "MAIL", path: "noreply@example.com", status: 250},
+		{method: "RCPT", path: "alice@example.com", status: 250},
+		{method: "RCPT", path: "bob@example.com", status: 250},
+		{method: "DATA", path: "", status: 354},
+		{method: messageCommand, path: "Your order has shipped", status: 250},
+		{method: "QUIT", path: "", status: 221},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Method != expected[i].method || entry.Path != expected[i].path || entry.Status != expected[i].status {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v %v", expected[i], entry.Method, entry.Path, entry.Status)
+		}
+		if entry.Service != "mail.default" || entry.DestinationPort != "587" {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", "mail.default 587", entry.Service, entry.DestinationPort)
+		}
+	}
+
+	message := getCommand(t, entries[8]).Message
+	expectedEnvelope := SmtpEnvelope{From: "noreply@example.com", Recipients: []string{"alice@example.com", "bob@example.com"}}
+	if !reflect.DeepEqual(message.Envelope, expectedEnvelope) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedEnvelope, message.Envelope)
+	}
+	if len(message.Headers) != 3 || message.Headers[2] != (SmtpHeader{Name: "Subject", Value: "Your order has shipped"}) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "3 headers", message.Headers)
+	}
+	if message.Body != redactedValue || !message.BodyRedacted || message.BodySize != len("Hello,\r\n.your order is on its way.\r\n") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "a redacted body", message)
+	}
+}
+
+func TestDissectBodyWithoutRedaction(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedClientStream, capturedServerStream, &api.TrafficFilteringOptions{DisableRedaction: true})
+
+	message := getCommand(t, entries[8]).Message
+	expectedBody := "Hello,\r\n.your order is on its way.\r\n"
+	if message.Body != expectedBody || message.BodyRedacted {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedBody, message.Body)
+	}
+}
+
+func TestDissectStartTls(t *testing.T) {
+	tests := []struct {
+		name            string
+		clientStream    string
+		serverStream    string
+		expectedMethods []string
+		expectedErr     error
+	}{
+		{
+			name:            "Accepted",
+			clientStream:    "EHLO client\r\nSTARTTLS\r\n\x16\x03\x01\x02\x00\x01\x00\x01\xfc",
+			serverStream:    "220 ready\r\n250-server\r\n250 STARTTLS\r\n220 2.0.0 Ready to start TLS\r\n\x16\x03\x03\x00\x5a\x02",
+			expectedMethods: []string{"EHLO", "STARTTLS"},
+			expectedErr:     ErrTlsUpgrade,
+		},
+		{
+			name:            "Refused",
+			clientStream:    "EHLO client\r\nSTARTTLS\r\nMAIL FROM:<a@example.com>\r\n",
+			serverStream:    "220 ready\r\n250 server\r\n454 4.7.0 TLS not available\r\n250 2.1.0 Ok\r\n",
+			expectedMethods: []string{"EHLO", "STARTTLS", "MAIL"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, clientErr, serverErr := dissectSession(t, test.clientStream, test.serverStream, &api.TrafficFilteringOptions{})
+
+			methods := make([]string, 0)
+			for _, entry := range entries {
+				methods = append(methods, entry.Method)
+			}
+			if !reflect.DeepEqual(methods, test.expectedMethods) {
+				t.Errorf("unexpected result - expected: %v, actual: %v", test.expectedMethods, methods)
+			}
+			if test.expectedErr != nil && (clientErr != test.expectedErr || serverErr != test.expectedErr) {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", test.expectedErr, clientErr, serverErr)
+			}
+		})
+	}
+}
+
+func TestDissectNotSmtp(t *testing.T) {
+	tests := []struct {
+		name     string
+		isClient bool
+		stream   string
+		tcpID    *api.TcpID
+	}{
+		{name: "HttpClient", isClient: true, stream: "GET / HTTP/1.1\r\n\r\n", tcpID: &api.TcpID{DstPort: "25"}},
+		{name: "HttpServer", isClient: false, stream: "HTTP/1.1 200 OK\r\n\r\n", tcpID: &api.TcpID{SrcPort: "25"}},
+		{name: "OtherPort", isClient: true, stream: "EHLO client\r\n", tcpID: &api.TcpID{DstPort: "2525"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emitter := &apitest.CollectingEmitter{}
+			err := Dissector.Dissect(bufio.NewReader(strings.NewReader(test.stream)), test.isClient, test.tcpID, &api.CounterPair{}, &api.SuperTimer{}, &api.SuperIdentifier{}, emitter, &api.TrafficFilteringOptions{})
+			if err == nil || len(emitter.Items) != 0 {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", "an error", err, len(emitter.Items))
+			}
+		})
+	}
+}
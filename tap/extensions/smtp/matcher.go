@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var reqResMatcher = createResponseRequestMatcher() // global
+
+// Key is {client_addr}:{client_port}->{dest_addr}:{dest_port},{incremental_counter}
+type requestResponseMatcher struct {
+	openMessagesMap *sync.Map
+}
+
+func createResponseRequestMatcher() requestResponseMatcher {
+	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}}
+	return *newMatcher
+}
+
+func (matcher *requestResponseMatcher) registerRequest(ident string, command *SmtpCommand, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	requestSmtpMessage := api.GenericMessage{
+		IsRequest:   true,
+		CaptureTime: captureTime,
+		Payload: SmtpPayload{
+			Data: &SmtpWrapper{
+				Method:  command.Command,
+				Url:     "",
+				Details: command,
+			},
+		},
+	}
+
+	if response, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		responseSmtpMessage := response.(*api.GenericMessage)
+		if responseSmtpMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(&requestSmtpMessage, responseSmtpMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &requestSmtpMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) registerResponse(ident string, reply *SmtpReply, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	responseSmtpMessage := api.GenericMessage{
+		IsRequest:   false,
+		CaptureTime: captureTime,
+		Payload: SmtpPayload{
+			Data: &SmtpWrapper{
+				Method:  "",
+				Url:     "",
+				Details: reply,
+			},
+		},
+	}
+
+	if request, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		requestSmtpMessage := request.(*api.GenericMessage)
+		if !requestSmtpMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(requestSmtpMessage, &responseSmtpMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &responseSmtpMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) preparePair(requestSmtpMessage *api.GenericMessage, responseSmtpMessage *api.GenericMessage) *api.OutputChannelItem {
+	return &api.OutputChannelItem{
+		Protocol:       protocol,
+		Timestamp:      requestSmtpMessage.CaptureTime.UnixNano() / int64(time.Millisecond),
+		ConnectionInfo: nil,
+		Pair: &api.RequestResponsePair{
+			Request:  *requestSmtpMessage,
+			Response: *responseSmtpMessage,
+		},
+	}
+}
+
+func splitIdent(ident string) []string {
+	ident = strings.Replace(ident, "->", " ", -1)
+	return strings.Split(ident, " ")
+}
+
+func genKey(split []string) string {
+	key := fmt.Sprintf("%s:%s->%s:%s,%s", split[0], split[2], split[1], split[3], split[4])
+	return key
+}
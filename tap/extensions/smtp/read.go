@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLineLength      = 4096 // RFC 5321 limits command lines to 512 bytes and text lines to 1000 bytes
+	maxStoredBodyBytes = 64 * 1024
+)
+
+var ErrTlsUpgrade = errors.New("connection upgraded to TLS by STARTTLS")
+
+func readLine(b *bufio.Reader) (string, error) {
+	line, err := b.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) > maxLineLength {
+		return "", fmt.Errorf("line longer than %d bytes", maxLineLength)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ClientReader reads the commands of the client, it keeps the envelope of the current mail transaction
+type ClientReader struct {
+	b              *bufio.Reader
+	redactBody     bool
+	envelope       SmtpEnvelope
+	isAuthenticate bool
+	isMessageNext  bool
+}
+
+func NewClientReader(b *bufio.Reader, redactBody bool) *ClientReader {
+	return &ClientReader{b: b, redactBody: redactBody, envelope: SmtpEnvelope{Recipients: []string{}}}
+}
+
+// Next returns the next command, the message sent after DATA is returned as a MESSAGE command
+func (reader *ClientReader) Next() (*SmtpCommand, error) {
+	if reader.isMessageNext {
+		reader.isMessageNext = false
+		return reader.readMessage()
+	}
+
+	line, err := readLine(reader.b)
+	if err != nil {
+		return nil, err
+	}
+
+	verb, argument := line, ""
+	if index := strings.IndexByte(line, ' '); index >= 0 {
+		verb, argument = line[:index], line[index+1:]
+	}
+	verb = strings.ToUpper(verb)
+
+	if !commands[verb] {
+		if reader.isAuthenticate {
+			// the client's answers to the server's 334 challenges
+			return &SmtpCommand{Command: authDataCommand, Argument: redactedValue}, nil
+		}
+		return nil, fmt.Errorf("unknown SMTP command %q", verb)
+	}
+	reader.isAuthenticate = false
+
+	command := &SmtpCommand{Command: verb, Argument: argument}
+	switch verb {
+	case "MAIL":
+		command.Address = parseAddress(argument, "FROM:")
+		reader.envelope = SmtpEnvelope{From: command.Address, Recipients: []string{}}
+	case "RCPT":
+		command.Address = parseAddress(argument, "TO:")
+		reader.envelope.Recipients = append(reader.envelope.Recipients, command.Address)
+	case "RSET", "HELO", "EHLO":
+		reader.envelope = SmtpEnvelope{Recipients: []string{}}
+	case "DATA":
+		reader.isMessageNext = true
+	case "AUTH":
+		reader.isAuthenticate = true
+		if mechanism := strings.Fields(argument); len(mechanism) > 1 {
+			command.Argument = fmt.Sprintf("%s %s", mechanism[0], redactedValue)
+		}
+	}
+
+	return command, nil
+}
+
+// IsTlsHandshakeNext tells whether the client started a TLS handshake, which follows an accepted STARTTLS.
+// After a refused STARTTLS the dialogue goes on in plain text.
+func (reader *ClientReader) IsTlsHandshakeNext() bool {
+	next, err := reader.b.Peek(1)
+	return err == nil && next[0] == tlsHandshakeByte
+}
+
+func (reader *ClientReader) readMessage() (*SmtpCommand, error) {
+	message := &SmtpMessage{
+		Envelope: SmtpEnvelope{From: reader.envelope.From, Recipients: append([]string{}, reader.envelope.Recipients...)},
+		Headers:  []SmtpHeader{},
+	}
+
+	var body strings.Builder
+	isHeaders := true
+	for {
+		line, err := reader.b.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			break
+		}
+		// dot stuffing, a leading dot of a text line is doubled by the client
+		line = strings.TrimPrefix(line, ".")
+
+		if isHeaders {
+			if line == "" {
+				isHeaders = false
+				continue
+			}
+			appendHeaderLine(message, line)
+			continue
+		}
+
+		message.BodySize += len(line) + 2
+		if !reader.redactBody && body.Len() < maxStoredBodyBytes {
+			body.WriteString(line)
+			body.WriteString("\r\n")
+		}
+	}
+
+	if reader.redactBody {
+		message.Body, message.BodyRedacted = redactedValue, true
+	} else {
+		message.Body = body.String()
+		if len(message.Body) > maxStoredBodyBytes {
+			message.Body = message.Body[:maxStoredBodyBytes]
+		}
+	}
+	return &SmtpCommand{Command: messageCommand, Message: message}, nil
+}
+
+func appendHeaderLine(message *SmtpMessage, line string) {
+	if (line[0] == ' ' || line[0] == '\t') && len(message.Headers) > 0 {
+		// a folded header continues the previous one
+		last := &message.Headers[len(message.Headers)-1]
+		last.Value = fmt.Sprintf("%s %s", last.Value, strings.TrimSpace(line))
+		return
+	}
+	if index := strings.IndexByte(line, ':'); index > 0 {
+		message.Headers = append(message.Headers, SmtpHeader{Name: line[:index], Value: strings.TrimSpace(line[index+1:])})
+	}
+}
+
+// parseAddress extracts the mailbox from arguments like "FROM:<user@example.com> SIZE=1024"
+func parseAddress(argument string, prefix string) string {
+	if len(argument) >= len(prefix) && strings.EqualFold(argument[:len(prefix)], prefix) {
+		argument = strings.TrimSpace(argument[len(prefix):])
+	}
+	if start := strings.IndexByte(argument, '<'); start >= 0 {
+		if end := strings.IndexByte(argument[start:], '>'); end >= 0 {
+			return argument[start+1 : start+end]
+		}
+	}
+	if fields := strings.Fields(argument); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// ReadReply reads a possibly multiline reply, every line but the last has a '-' after the code
+func ReadReply(b *bufio.Reader) (*SmtpReply, error) {
+	reply := &SmtpReply{Lines: []string{}}
+	for {
+		line, err := readLine(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 3 || (len(line) > 3 && line[3] != ' ' && line[3] != '-') {
+			return nil, fmt.Errorf("invalid SMTP reply %q", line)
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("invalid SMTP reply code %q", line[:3])
+		}
+		if reply.Code != 0 && code != reply.Code {
+			return nil, fmt.Errorf("inconsistent SMTP reply codes %d and %d", reply.Code, code)
+		}
+		reply.Code = code
+
+		text := ""
+		if len(line) > 4 {
+			text = line[4:]
+		}
+		reply.Lines = append(reply.Lines, text)
+
+		if len(line) == 3 || line[3] == ' ' {
+			return reply, nil
+		}
+	}
+}
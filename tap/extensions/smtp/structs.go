@@ -0,0 +1,57 @@
+package main
+
+const (
+	messageCommand   = "MESSAGE" // the message sent after DATA, it has its own reply
+	authDataCommand  = "AUTH-DATA"
+	startTlsCommand  = "STARTTLS"
+	redactedValue    = "[REDACTED]"
+	greetingCode     = 220
+	startTlsCode     = 220
+	tlsHandshakeByte = 0x16
+)
+
+var commands = map[string]bool{
+	"HELO":     true,
+	"EHLO":     true,
+	"MAIL":     true,
+	"RCPT":     true,
+	"DATA":     true,
+	"RSET":     true,
+	"VRFY":     true,
+	"EXPN":     true,
+	"HELP":     true,
+	"NOOP":     true,
+	"QUIT":     true,
+	"AUTH":     true,
+	"STARTTLS": true,
+}
+
+type SmtpEnvelope struct {
+	From       string   `json:"from"`
+	Recipients []string `json:"recipients"`
+}
+
+type SmtpHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type SmtpMessage struct {
+	Envelope     SmtpEnvelope `json:"envelope"`
+	Headers      []SmtpHeader `json:"headers"`
+	Body         string       `json:"body"`
+	BodySize     int          `json:"bodySize"`
+	BodyRedacted bool         `json:"bodyRedacted"`
+}
+
+type SmtpCommand struct {
+	Command  string       `json:"command"`
+	Argument string       `json:"argument"`
+	Address  string       `json:"address,omitempty"` // the mailbox of MAIL FROM and RCPT TO
+	Message  *SmtpMessage `json:"message,omitempty"`
+}
+
+type SmtpReply struct {
+	Code  int      `json:"code"`
+	Lines []string `json:"lines"`
+}
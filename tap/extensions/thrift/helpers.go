@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+type ThriftPayload struct {
+	Data interface{}
+}
+
+type ThriftPayloader interface {
+	MarshalJSON() ([]byte, error)
+}
+
+func (h ThriftPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Data)
+}
+
+type ThriftWrapper struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Details interface{} `json:"details"`
+}
+
+// thriftPair is the stored form of a call and its reply
+type thriftPair struct {
+	Request struct {
+		Payload struct {
+			Details ThriftMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"request"`
+	Response struct {
+		Payload struct {
+			Details ThriftMessage `json:"details"`
+		} `json:"payload"`
+	} `json:"response"`
+}
+
+func representMessage(message *ThriftMessage) (representation []interface{}) {
+	details := []map[string]string{
+		{"name": "Method", "value": message.Method},
+	}
+	if message.Service != "" {
+		details = append(details, map[string]string{"name": "Service", "value": message.Service})
+	}
+	details = append(details, []map[string]string{
+		{"name": "Type", "value": message.Type},
+		{"name": "Sequence Id", "value": strconv.Itoa(int(message.SeqId))},
+		{"name": "Protocol", "value": message.Protocol},
+		{"name": "Transport", "value": message.Transport},
+		{"name": "Size", "value": strconv.Itoa(message.Size)},
+	}...)
+	representation = append(representation, representTable("Details", details))
+
+	if exception := message.Exception; exception != nil {
+		var rows []map[string]string
+		if exception.Declared {
+			rows = []map[string]string{
+				{"name": "Declared", "value": "true"},
+				{"name": "Field Id", "value": strconv.Itoa(int(exception.FieldId))},
+			}
+		} else {
+			rows = []map[string]string{
+				{"name": "Type", "value": getApplicationExceptionTypeName(exception.Type)},
+				{"name": "Message", "value": exception.Message},
+			}
+		}
+		representation = append(representation, representTable("Exception", rows))
+	}
+	return
+}
+
+func getApplicationExceptionTypeName(exceptionType int32) string {
+	if name, ok := applicationExceptionTypeNames[exceptionType]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", exceptionType)
+}
+
+func representTable(title string, rows []map[string]string) map[string]string {
+	data, _ := json.Marshal(rows)
+	return map[string]string{
+		"type":  api.TABLE,
+		"title": title,
+		"data":  string(data),
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var protocol api.Protocol = api.Protocol{
+	Name:            "thrift",
+	LongName:        "Apache Thrift",
+	Abbreviation:    "THRIFT",
+	Version:         "1",
+	BackgroundColor: "#6b2d8c",
+	ForegroundColor: "#ffffff",
+	FontSize:        11,
+	ReferenceLink:   "https://thrift.apache.org/",
+	Ports:           []string{"9090"},
+	Priority:        3,
+}
+
+func init() {
+	log.Println("Initializing Thrift extension...")
+}
+
+type dissecting string
+
+func (d dissecting) Register(extension *api.Extension) {
+	extension.Protocol = &protocol
+	extension.MatcherMap = reqResMatcher.openMessagesMap
+}
+
+func (d dissecting) Ping() {
+	log.Printf("pong %s\n", protocol.Name)
+}
+
+func (d dissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, superIdentifier *api.SuperIdentifier, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	serverPort := tcpID.DstPort
+	if !isClient {
+		serverPort = tcpID.SrcPort
+	}
+	if !isThriftPort(serverPort) {
+		return fmt.Errorf("port %s isn't a Thrift port", serverPort)
+	}
+
+	for {
+		message, err := ReadMessage(b)
+		if err != nil {
+			return err
+		}
+
+		isCall := message.Type == messageTypeNames[messageTypeCall] || message.Type == messageTypeNames[messageTypeOneway]
+		if isCall != isClient {
+			return fmt.Errorf("unexpected Thrift %s message", message.Type)
+		}
+		if isClient {
+			handleClientStream(tcpID, counterPair, superTimer, emitter, message)
+		} else {
+			handleServerStream(tcpID, counterPair, superTimer, emitter, message)
+		}
+	}
+}
+
+func isThriftPort(port string) bool {
+	for _, thriftPort := range protocol.Ports {
+		if port == thriftPort {
+			return true
+		}
+	}
+	return false
+}
+
+func (d dissecting) Analyze(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	entryBytes, _ := json.Marshal(item.Pair)
+	var pair thriftPair
+	json.Unmarshal(entryBytes, &pair)
+	call := &pair.Request.Payload.Details
+
+	service := "thrift"
+	if call.Service != "" {
+		service = call.Service
+	} else if resolvedDestination != "" {
+		service = resolvedDestination
+	} else if resolvedSource != "" {
+		service = resolvedSource
+	}
+
+	elapsedTime := item.Pair.Response.CaptureTime.Sub(item.Pair.Request.CaptureTime).Round(time.Millisecond).Milliseconds()
+	return &api.MizuEntry{
+		ProtocolName:            protocol.Name,
+		ProtocolLongName:        protocol.LongName,
+		ProtocolAbbreviation:    protocol.Abbreviation,
+		ProtocolVersion:         protocol.Version,
+		ProtocolBackgroundColor: protocol.BackgroundColor,
+		ProtocolForegroundColor: protocol.ForegroundColor,
+		ProtocolFontSize:        protocol.FontSize,
+		ProtocolReferenceLink:   protocol.ReferenceLink,
+		EntryId:                 entryId,
+		Entry:                   string(entryBytes),
+		Url:                     fmt.Sprintf("%s/%s", service, call.Method),
+		Method:                  call.Method,
+		Status:                  0,
+		RequestSenderIp:         item.ConnectionInfo.ClientIP,
+		Service:                 service,
+		Timestamp:               item.Timestamp,
+		ElapsedTime:             elapsedTime,
+		Path:                    call.Method,
+		ResolvedSource:          resolvedSource,
+		ResolvedDestination:     resolvedDestination,
+		SourceIp:                item.ConnectionInfo.ClientIP,
+		DestinationIp:           item.ConnectionInfo.ServerIP,
+		SourcePort:              item.ConnectionInfo.ClientPort,
+		DestinationPort:         item.ConnectionInfo.ServerPort,
+		IsOutgoing:              item.ConnectionInfo.IsOutgoing,
+	}
+}
+
+func (d dissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
+	return &api.BaseEntryDetails{
+		Id:              entry.EntryId,
+		Protocol:        protocol,
+		Url:             entry.Url,
+		RequestSenderIp: entry.RequestSenderIp,
+		Service:         entry.Service,
+		Summary:         entry.Path,
+		StatusCode:      entry.Status,
+		Method:          entry.Method,
+		Timestamp:       entry.Timestamp,
+		SourceIp:        entry.SourceIp,
+		DestinationIp:   entry.DestinationIp,
+		SourcePort:      entry.SourcePort,
+		DestinationPort: entry.DestinationPort,
+		IsOutgoing:      entry.IsOutgoing,
+		Latency:         entry.ElapsedTime,
+		Rules: api.ApplicableRules{
+			Latency: 0,
+			Status:  false,
+		},
+	}
+}
+
+func (d dissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []byte, bodySize int64, err error) {
+	p = protocol
+	var pair thriftPair
+	if err = json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return
+	}
+	bodySize = int64(pair.Request.Payload.Details.Size)
+
+	representation := map[string]interface{}{
+		"request":  representMessage(&pair.Request.Payload.Details),
+		"response": representMessage(&pair.Response.Payload.Details),
+	}
+	object, err = json.Marshal(representation)
+	return
+}
+
+var Dissector dissecting
+
+var ApiVersion = api.ApiVersion
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/api/apitest"
+)
+
+// a multiplexed calculator service over the framed transport and the binary protocol
+const capturedFramedBinaryClientStream = "" +
+	// add(1, 2), seqid 1
+	"\x00\x00\x00)\x80\x01\x00\x01\x00\x00\x00\x0eCalculator:add\x00\x00\x00\x01\x08\x00\x01\x00\x00\x00\x01\x08\x00\x02\x00\x00\x00\x02\x00" +
+	// divide(1, 0), seqid 2
+	"\x00\x00\x00,\x80\x01\x00\x01\x00\x00\x00\x11Calculator:divide\x00\x00\x00\x02\x08\x00\x01\x00\x00\x00\x01\x08\x00\x02\x00\x00\x00\x00\x00"
+
+const capturedFramedBinaryServerStream = "" +
+	// success, 3
+	"\x00\x00\x00\x22\x80\x01\x00\x02\x00\x00\x00\x0eCalculator:add\x00\x00\x00\x01\x08\x00\x00\x00\x00\x00\x03\x00" +
+	// the declared InvalidOperation exception, result field 1
+	"\x00\x00\x00B\x80\x01\x00\x02\x00\x00\x00\x11Calculator:divide\x00\x00\x00\x02\x0c\x00\x01\x08\x00\x01\x00\x00\x00\x04\x0b\x00\x02\x00\x00\x00\x12Cannot divide by 0\x00\x00"
+
+// a user service over the buffered transport and the compact protocol
+const capturedCompactClientStream = "" +
+	// ping(), seqid 7
+	"\x82!\x07\x04ping\x00" +
+	// getUser(42, ["a", "b"], true, {1: 5}), seqid 8
+	"\x82!\x08\x07getUser\x16T\x19(\x01a\x01b\x11\x1c\x15\x0a\x00\x00" +
+	// oneway log("hello"), seqid 9
+	"\x82\x81\x09\x03log\x18\x05hello\x00"
+
+const capturedCompactServerStream = "" +
+	// void success
+	"\x82A\x07\x04ping\x00" +
+	// an INTERNAL_ERROR application exception
+	"\x82a\x08\x07getUser\x18!Internal error processing getUser\x15\x0c\x00"
+
+func resetOpenMessages() {
+	reqResMatcher.openMessagesMap.Range(func(key, _ interface{}) bool {
+		reqResMatcher.openMessagesMap.Delete(key)
+		return true
+	})
+}
+
+// dissectSession feeds a captured session, the server stream first so every call completes a pair
+func dissectSession(t *testing.T, clientStream string, serverStream string) ([]*api.MizuEntry, error, error) {
+	resetOpenMessages()
+	return apitest.DissectSession(t, Dissector, &apitest.Session{ClientStream: clientStream, ServerStream: serverStream, ServerPort: "9090", ResolvedDestination: "users.default"})
+}
+
+func getPair(t *testing.T, entry *api.MizuEntry) *thriftPair {
+	var pair thriftPair
+	if err := json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		t.Fatalf("failed to unmarshal entry: %v", err)
+	}
+	return &pair
+}
+
+func TestDissectFramedBinary(t *testing.T) {
+	entries, clientErr, serverErr := dissectSession(t, capturedFramedBinaryClientStream, capturedFramedBinaryServerStream)
+	if clientErr != io.EOF || serverErr != io.EOF {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v", io.EOF, clientErr, serverErr)
+	}
+
+	expected := []struct {
+		method    string
+		url       string
+		seqId     int32
+		exception *ThriftException
+	}{
+		{method: "add", url: "Calculator/add", seqId: 1},
+		{method: "divide", url: "Calculator/divide", seqId: 2, exception: &ThriftException{Declared: true, FieldId: 1}},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		pair := getPair(t, entry)
+		call, reply := pair.Request.Payload.Details, pair.Response.Payload.Details
+		if entry.Method != expected[i].method || entry.Url != expected[i].url || entry.Service != "Calculator" {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v %v", expected[i], entry.Method, entry.Url, entry.Service)
+		}
+		if call.Type != "call" || reply.Type != "reply" || call.SeqId != expected[i].seqId || reply.SeqId != expected[i].seqId {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", expected[i], call, reply)
+		}
+		if call.Protocol != protocolBinary || call.Transport != transportFramed {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", "binary framed", call.Protocol, call.Transport)
+		}
+		if (reply.Exception == nil) != (expected[i].exception == nil) || (reply.Exception != nil && *reply.Exception != *expected[i].exception) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected[i].exception, reply.Exception)
+		}
+	}
+}
+
+func TestDissectBufferedCompact(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedCompactClientStream, capturedCompactServerStream)
+
+	expected := []struct {
+		method    string
+		callType  string
+		replyType string
+		seqId     int32
+	}{
+		{method: "ping", callType: "call", replyType: "reply", seqId: 7},
+		{method: "getUser", callType: "call", replyType: "exception", seqId: 8},
+		{method: "log", callType: "oneway", replyType: noReplyType, seqId: 9},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		pair := getPair(t, entry)
+		call, reply := pair.Request.Payload.Details, pair.Response.Payload.Details
+		if entry.Method != expected[i].method || entry.Service != "users.default" || call.SeqId != expected[i].seqId {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v %v", expected[i], entry.Method, entry.Service, call.SeqId)
+		}
+		if call.Type != expected[i].callType || reply.Type != expected[i].replyType {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", expected[i], call.Type, reply.Type)
+		}
+		if call.Protocol != protocolCompact || call.Transport != transportBuffered {
+			t.Errorf("unexpected result - expected: %v, actual: %v %v", "compact buffered", call.Protocol, call.Transport)
+		}
+	}
+
+	expectedException := ThriftException{Type: 6, Message: "Internal error processing getUser"}
+	if exception := getPair(t, entries[1]).Response.Payload.Details.Exception; exception == nil || *exception != expectedException {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedException, exception)
+	}
+}
+
+func TestRepresent(t *testing.T) {
+	entries, _, _ := dissectSession(t, capturedCompactClientStream, capturedCompactServerStream)
+
+	_, object, _, err := Dissector.Represent(entries[1])
+	if err != nil {
+		t.Fatalf("failed to represent entry: %v", err)
+	}
+	if representation := string(object); !strings.Contains(representation, "INTERNAL_ERROR") || !strings.Contains(representation, "getUser") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the method and the exception type", representation)
+	}
+}
+
+func TestDissectNotThrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		isClient bool
+		stream   string
+		tcpID    *api.TcpID
+	}{
+		{name: "HttpClient", isClient: true, stream: "GET / HTTP/1.1\r\n\r\n", tcpID: &api.TcpID{DstPort: "9090"}},
+		{name: "HttpServer", isClient: false, stream: "HTTP/1.1 200 OK\r\n\r\n", tcpID: &api.TcpID{SrcPort: "9090"}},
+		{name: "ReplyFromClient", isClient: true, stream: capturedCompactServerStream, tcpID: &api.TcpID{DstPort: "9090"}},
+		{name: "InvalidFrameContent", isClient: true, stream: "\x00\x00\x00\x04\x01\x02\x03\x04", tcpID: &api.TcpID{DstPort: "9090"}},
+		{name: "OtherPort", isClient: true, stream: capturedCompactClientStream, tcpID: &api.TcpID{DstPort: "9091"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emitter := &apitest.CollectingEmitter{}
+			err := Dissector.Dissect(bufio.NewReader(strings.NewReader(test.stream)), test.isClient, test.tcpID, &api.CounterPair{}, &api.SuperTimer{}, &api.SuperIdentifier{}, emitter, &api.TrafficFilteringOptions{})
+			if err == nil || err == io.EOF || len(emitter.Items) != 0 {
+				t.Errorf("unexpected result - expected: %v, actual: %v %v", "an error", err, len(emitter.Items))
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var reqResMatcher = createResponseRequestMatcher() // global
+
+// Key is {client_addr}:{client_port}->{dest_addr}:{dest_port},{seq_id}
+// replies carry the sequence id of their call, so pipelined calls are matched regardless of the order of the replies
+type requestResponseMatcher struct {
+	openMessagesMap *sync.Map
+}
+
+func createResponseRequestMatcher() requestResponseMatcher {
+	newMatcher := &requestResponseMatcher{openMessagesMap: &sync.Map{}}
+	return *newMatcher
+}
+
+func (matcher *requestResponseMatcher) registerRequest(ident string, message *ThriftMessage, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	requestThriftMessage := api.GenericMessage{
+		IsRequest:   true,
+		CaptureTime: captureTime,
+		Payload: ThriftPayload{
+			Data: &ThriftWrapper{
+				Method:  message.Method,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	// oneway calls have no reply
+	if message.Type == messageTypeNames[messageTypeOneway] {
+		responseThriftMessage := api.GenericMessage{
+			IsRequest:   false,
+			CaptureTime: captureTime,
+			Payload: ThriftPayload{
+				Data: &ThriftWrapper{
+					Method:  message.Method,
+					Url:     "",
+					Details: &ThriftMessage{Method: message.Method, Service: message.Service, Type: noReplyType, SeqId: message.SeqId, Protocol: message.Protocol, Transport: message.Transport},
+				},
+			},
+		}
+		return matcher.preparePair(&requestThriftMessage, &responseThriftMessage)
+	}
+
+	if response, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		responseThriftMessage := response.(*api.GenericMessage)
+		if responseThriftMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(&requestThriftMessage, responseThriftMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &requestThriftMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) registerResponse(ident string, message *ThriftMessage, captureTime time.Time) *api.OutputChannelItem {
+	key := genKey(splitIdent(ident))
+
+	responseThriftMessage := api.GenericMessage{
+		IsRequest:   false,
+		CaptureTime: captureTime,
+		Payload: ThriftPayload{
+			Data: &ThriftWrapper{
+				Method:  message.Method,
+				Url:     "",
+				Details: message,
+			},
+		},
+	}
+
+	if request, found := matcher.openMessagesMap.LoadAndDelete(key); found {
+		// Type assertion always succeeds because all of the map's values are of api.GenericMessage type
+		requestThriftMessage := request.(*api.GenericMessage)
+		if !requestThriftMessage.IsRequest {
+			return nil
+		}
+		return matcher.preparePair(requestThriftMessage, &responseThriftMessage)
+	}
+
+	matcher.openMessagesMap.Store(key, &responseThriftMessage)
+	return nil
+}
+
+func (matcher *requestResponseMatcher) preparePair(requestThriftMessage *api.GenericMessage, responseThriftMessage *api.GenericMessage) *api.OutputChannelItem {
+	return &api.OutputChannelItem{
+		Protocol:       protocol,
+		Timestamp:      requestThriftMessage.CaptureTime.UnixNano() / int64(time.Millisecond),
+		ConnectionInfo: nil,
+		Pair: &api.RequestResponsePair{
+			Request:  *requestThriftMessage,
+			Response: *responseThriftMessage,
+		},
+	}
+}
+
+func splitIdent(ident string) []string {
+	ident = strings.Replace(ident, "->", " ", -1)
+	return strings.Split(ident, " ")
+}
+
+func genKey(split []string) string {
+	key := fmt.Sprintf("%s:%s->%s:%s,%s", split[0], split[2], split[1], split[3], split[4])
+	return key
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const (
+	binaryProtocolVersion   = 0x80010000
+	binaryVersionMask       = 0xffff0000
+	compactProtocolId       = 0x82
+	compactProtocolVersion  = 1
+	compactVersionMask      = 0x1f
+	compactTypeShift        = 5
+	maxFrameSize            = 16 * 1024 * 1024
+	maxMethodNameLength     = 256
+	maxContainerSize        = 1024 * 1024
+	maxNestingDepth         = 64
+	applicationExceptionMsg = 1
+	applicationExceptionTyp = 2
+)
+
+var errNotThrift = errors.New("not a thrift message")
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// protocolReader reads the parts of a message the dissector looks into, everything else is skipped
+type protocolReader interface {
+	readMessageBegin() (name string, messageType byte, seqId int32, err error)
+	readFieldBegin() (fieldType byte, fieldId int16, err error)
+	readString() (string, error)
+	readI32() (int32, error)
+	skip(fieldType byte, depth int) error
+}
+
+// countingReader counts the bytes of an unframed message
+type countingReader struct {
+	r     byteReader
+	count int
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.count += n
+	return n, err
+}
+
+func (reader *countingReader) ReadByte() (byte, error) {
+	c, err := reader.r.ReadByte()
+	if err == nil {
+		reader.count++
+	}
+	return c, err
+}
+
+// ReadMessage reads a message of either protocol, framed or not
+func ReadMessage(b *bufio.Reader) (*ThriftMessage, error) {
+	first, err := b.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] == 0x80 || first[0] == compactProtocolId {
+		reader := &countingReader{r: b}
+		message, err := readMessage(reader, first[0], transportBuffered)
+		if err != nil {
+			return nil, err
+		}
+		message.Size = reader.count
+		return message, nil
+	}
+
+	var frameSize uint32
+	if err := binary.Read(b, binary.BigEndian, &frameSize); err != nil {
+		return nil, err
+	}
+	if frameSize < 2 || frameSize > maxFrameSize {
+		return nil, errNotThrift
+	}
+	frame := make([]byte, frameSize)
+	if _, err := io.ReadFull(b, frame); err != nil {
+		return nil, err
+	}
+	message, err := readMessage(bytes.NewReader(frame), frame[0], transportFramed)
+	if err != nil {
+		return nil, err
+	}
+	message.Size = int(frameSize)
+	return message, nil
+}
+
+func readMessage(r byteReader, first byte, transport string) (*ThriftMessage, error) {
+	var protocol protocolReader
+	message := &ThriftMessage{Transport: transport}
+	switch first {
+	case 0x80:
+		protocol, message.Protocol = &binaryProtocolReader{r: r}, protocolBinary
+	case compactProtocolId:
+		protocol, message.Protocol = &compactProtocolReader{r: r}, protocolCompact
+	default:
+		return nil, errNotThrift
+	}
+
+	name, messageType, seqId, err := protocol.readMessageBegin()
+	if err != nil {
+		return nil, err
+	}
+	typeName, ok := messageTypeNames[messageType]
+	if !ok || !isMethodName(name) {
+		return nil, errNotThrift
+	}
+	message.Type, message.SeqId = typeName, seqId
+	message.Method = name
+	if index := strings.Index(name, multiplexSeparator); index >= 0 {
+		message.Service, message.Method = name[:index], name[index+1:]
+	}
+
+	switch messageType {
+	case messageTypeException:
+		message.Exception, err = readApplicationException(protocol)
+	case messageTypeReply:
+		message.Exception, err = readResult(protocol)
+	default:
+		err = protocol.skip(typeStruct, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func isMethodName(name string) bool {
+	if name == "" || len(name) > maxMethodNameLength {
+		return false
+	}
+	for _, char := range name {
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '_' && char != '.' && char != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// readResult reads the result struct of a reply, a set field other than the success field 0 is a declared exception
+func readResult(protocol protocolReader) (exception *ThriftException, err error) {
+	for {
+		fieldType, fieldId, err := protocol.readFieldBegin()
+		if err != nil {
+			return nil, err
+		}
+		if fieldType == typeStop {
+			return exception, nil
+		}
+		if fieldId != 0 && fieldType == typeStruct {
+			exception = &ThriftException{Declared: true, FieldId: fieldId}
+		}
+		if err := protocol.skip(fieldType, 1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readApplicationException(protocol protocolReader) (*ThriftException, error) {
+	exception := &ThriftException{}
+	for {
+		fieldType, fieldId, err := protocol.readFieldBegin()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case fieldType == typeStop:
+			return exception, nil
+		case fieldId == applicationExceptionMsg && fieldType == typeString:
+			if exception.Message, err = protocol.readString(); err != nil {
+				return nil, err
+			}
+		case fieldId == applicationExceptionTyp && fieldType == typeI32:
+			if exception.Type, err = protocol.readI32(); err != nil {
+				return nil, err
+			}
+		default:
+			if err := protocol.skip(fieldType, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func readBytes(r byteReader, size int64) ([]byte, error) {
+	if size < 0 || size > maxFrameSize {
+		return nil, fmt.Errorf("invalid thrift length %d", size)
+	}
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+func discard(r byteReader, size int64) error {
+	if size < 0 || size > maxFrameSize {
+		return fmt.Errorf("invalid thrift length %d", size)
+	}
+	_, err := io.CopyN(io.Discard, r, size)
+	return err
+}
+
+func checkContainer(size int64, depth int) error {
+	if size < 0 || size > maxContainerSize {
+		return fmt.Errorf("invalid thrift container size %d", size)
+	}
+	if depth > maxNestingDepth {
+		return fmt.Errorf("thrift values nested deeper than %d", maxNestingDepth)
+	}
+	return nil
+}
+
+type binaryProtocolReader struct {
+	r byteReader
+}
+
+func (protocol *binaryProtocolReader) readMessageBegin() (string, byte, int32, error) {
+	version, err := protocol.readI32()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if uint32(version)&binaryVersionMask != binaryProtocolVersion {
+		return "", 0, 0, errNotThrift
+	}
+	name, err := protocol.readString()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	seqId, err := protocol.readI32()
+	return name, byte(version), seqId, err
+}
+
+func (protocol *binaryProtocolReader) readFieldBegin() (byte, int16, error) {
+	fieldType, err := protocol.r.ReadByte()
+	if err != nil || fieldType == typeStop {
+		return fieldType, 0, err
+	}
+	var fieldId int16
+	err = binary.Read(protocol.r, binary.BigEndian, &fieldId)
+	return fieldType, fieldId, err
+}
+
+func (protocol *binaryProtocolReader) readString() (string, error) {
+	size, err := protocol.readI32()
+	if err != nil {
+		return "", err
+	}
+	data, err := readBytes(protocol.r, int64(size))
+	return string(data), err
+}
+
+func (protocol *binaryProtocolReader) readI32() (int32, error) {
+	var value int32
+	err := binary.Read(protocol.r, binary.BigEndian, &value)
+	return value, err
+}
+
+func (protocol *binaryProtocolReader) skip(fieldType byte, depth int) error {
+	switch fieldType {
+	case typeBool, typeByte:
+		return discard(protocol.r, 1)
+	case typeI16:
+		return discard(protocol.r, 2)
+	case typeI32:
+		return discard(protocol.r, 4)
+	case typeDouble, typeI64:
+		return discard(protocol.r, 8)
+	case typeUuid:
+		return discard(protocol.r, 16)
+	case typeString:
+		size, err := protocol.readI32()
+		if err != nil {
+			return err
+		}
+		return discard(protocol.r, int64(size))
+	case typeStruct:
+		if err := checkContainer(0, depth); err != nil {
+			return err
+		}
+		for {
+			fieldType, _, err := protocol.readFieldBegin()
+			if err != nil || fieldType == typeStop {
+				return err
+			}
+			if err := protocol.skip(fieldType, depth+1); err != nil {
+				return err
+			}
+		}
+	case typeMap:
+		keyType, err := protocol.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		valueType, err := protocol.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		size, err := protocol.readI32()
+		if err != nil {
+			return err
+		}
+		if err := checkContainer(int64(size), depth); err != nil {
+			return err
+		}
+		for i := int32(0); i < size; i++ {
+			if err := protocol.skip(keyType, depth+1); err != nil {
+				return err
+			}
+			if err := protocol.skip(valueType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeSet, typeList:
+		elementType, err := protocol.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		size, err := protocol.readI32()
+		if err != nil {
+			return err
+		}
+		if err := checkContainer(int64(size), depth); err != nil {
+			return err
+		}
+		for i := int32(0); i < size; i++ {
+			if err := protocol.skip(elementType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown thrift type %d", fieldType)
+	}
+}
+
+// the types of the compact protocol, booleans fields carry their value in the type
+const (
+	compactTypeBoolTrue  = 1
+	compactTypeBoolFalse = 2
+	compactTypeByte      = 3
+	compactTypeI16       = 4
+	compactTypeI32       = 5
+	compactTypeI64       = 6
+	compactTypeDouble    = 7
+	compactTypeBinary    = 8
+	compactTypeList      = 9
+	compactTypeSet       = 10
+	compactTypeMap       = 11
+	compactTypeStruct    = 12
+	compactTypeUuid      = 13
+)
+
+var compactTypes = map[byte]byte{
+	compactTypeBoolTrue:  typeBool,
+	compactTypeBoolFalse: typeBool,
+	compactTypeByte:      typeByte,
+	compactTypeI16:       typeI16,
+	compactTypeI32:       typeI32,
+	compactTypeI64:       typeI64,
+	compactTypeDouble:    typeDouble,
+	compactTypeBinary:    typeString,
+	compactTypeList:      typeList,
+	compactTypeSet:       typeSet,
+	compactTypeMap:       typeMap,
+	compactTypeStruct:    typeStruct,
+	compactTypeUuid:      typeUuid,
+}
+
+type compactProtocolReader struct {
+	r            byteReader
+	lastFieldId  int16
+	isBoolField  bool // the value of the last read bool field was in its header
+	fieldIdStack []int16
+}
+
+func (protocol *compactProtocolReader) readMessageBegin() (string, byte, int32, error) {
+	protocolId, err := protocol.r.ReadByte()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	versionAndType, err := protocol.r.ReadByte()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if protocolId != compactProtocolId || versionAndType&compactVersionMask != compactProtocolVersion {
+		return "", 0, 0, errNotThrift
+	}
+	seqId, err := binary.ReadUvarint(protocol.r)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	name, err := protocol.readString()
+	return name, versionAndType >> compactTypeShift, int32(seqId), err
+}
+
+func (protocol *compactProtocolReader) readFieldBegin() (byte, int16, error) {
+	header, err := protocol.r.ReadByte()
+	if err != nil || header == typeStop {
+		return typeStop, 0, err
+	}
+
+	fieldType, ok := compactTypes[header&0x0f]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown thrift compact type %d", header&0x0f)
+	}
+	if delta := int16(header >> 4); delta != 0 {
+		protocol.lastFieldId += delta
+	} else {
+		fieldId, err := binary.ReadVarint(protocol.r)
+		if err != nil {
+			return 0, 0, err
+		}
+		protocol.lastFieldId = int16(fieldId)
+	}
+	protocol.isBoolField = fieldType == typeBool
+	return fieldType, protocol.lastFieldId, nil
+}
+
+func (protocol *compactProtocolReader) readString() (string, error) {
+	size, err := binary.ReadUvarint(protocol.r)
+	if err != nil {
+		return "", err
+	}
+	if size > maxFrameSize {
+		return "", fmt.Errorf("invalid thrift length %d", size)
+	}
+	data, err := readBytes(protocol.r, int64(size))
+	return string(data), err
+}
+
+func (protocol *compactProtocolReader) readI32() (int32, error) {
+	value, err := binary.ReadVarint(protocol.r)
+	return int32(value), err
+}
+
+func (protocol *compactProtocolReader) skip(fieldType byte, depth int) error {
+	isBoolField := protocol.isBoolField
+	protocol.isBoolField = false
+
+	switch fieldType {
+	case typeBool:
+		if isBoolField {
+			return nil
+		}
+		return discard(protocol.r, 1)
+	case typeByte:
+		return discard(protocol.r, 1)
+	case typeI16, typeI32, typeI64:
+		_, err := binary.ReadVarint(protocol.r)
+		return err
+	case typeDouble:
+		return discard(protocol.r, 8)
+	case typeUuid:
+		return discard(protocol.r, 16)
+	case typeString:
+		size, err := binary.ReadUvarint(protocol.r)
+		if err != nil {
+			return err
+		}
+		if size > maxFrameSize {
+			return fmt.Errorf("invalid thrift length %d", size)
+		}
+		return discard(protocol.r, int64(size))
+	case typeStruct:
+		if err := checkContainer(0, depth); err != nil {
+			return err
+		}
+		// field ids are deltas from the previous field of the same struct
+		protocol.fieldIdStack = append(protocol.fieldIdStack, protocol.lastFieldId)
+		protocol.lastFieldId = 0
+		for {
+			fieldType, _, err := protocol.readFieldBegin()
+			if err != nil {
+				return err
+			}
+			if fieldType == typeStop {
+				break
+			}
+			if err := protocol.skip(fieldType, depth+1); err != nil {
+				return err
+			}
+		}
+		protocol.lastFieldId = protocol.fieldIdStack[len(protocol.fieldIdStack)-1]
+		protocol.fieldIdStack = protocol.fieldIdStack[:len(protocol.fieldIdStack)-1]
+		return nil
+	case typeMap:
+		size, err := binary.ReadUvarint(protocol.r)
+		if err != nil {
+			return err
+		}
+		if err := checkContainer(int64(size), depth); err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		types, err := protocol.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		keyType, keyOk := compactTypes[types>>4]
+		valueType, valueOk := compactTypes[types&0x0f]
+		if !keyOk || !valueOk {
+			return fmt.Errorf("unknown thrift compact map types %d", types)
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := protocol.skip(keyType, depth+1); err != nil {
+				return err
+			}
+			if err := protocol.skip(valueType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeSet, typeList:
+		header, err := protocol.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		elementType, ok := compactTypes[header&0x0f]
+		if !ok {
+			return fmt.Errorf("unknown thrift compact type %d", header&0x0f)
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = binary.ReadUvarint(protocol.r); err != nil {
+				return err
+			}
+		}
+		if err := checkContainer(int64(size), depth); err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := protocol.skip(elementType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown thrift type %d", fieldType)
+	}
+}
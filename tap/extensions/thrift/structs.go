@@ -0,0 +1,78 @@
+package main
+
+const (
+	messageTypeCall      = 1
+	messageTypeReply     = 2
+	messageTypeException = 3
+	messageTypeOneway    = 4
+)
+
+var messageTypeNames = map[byte]string{
+	messageTypeCall:      "call",
+	messageTypeReply:     "reply",
+	messageTypeException: "exception",
+	messageTypeOneway:    "oneway",
+}
+
+// noReplyType is the type of the response paired with a oneway call
+const noReplyType = "none"
+
+// the types of the application exceptions raised by the framework
+var applicationExceptionTypeNames = map[int32]string{
+	0:  "UNKNOWN",
+	1:  "UNKNOWN_METHOD",
+	2:  "INVALID_MESSAGE_TYPE",
+	3:  "WRONG_METHOD_NAME",
+	4:  "BAD_SEQUENCE_ID",
+	5:  "MISSING_RESULT",
+	6:  "INTERNAL_ERROR",
+	7:  "PROTOCOL_ERROR",
+	8:  "INVALID_TRANSFORM",
+	9:  "INVALID_PROTOCOL",
+	10: "UNSUPPORTED_CLIENT_TYPE",
+}
+
+// the field types of the binary protocol, the compact protocol types are translated to them
+const (
+	typeStop   = 0
+	typeBool   = 2
+	typeByte   = 3
+	typeDouble = 4
+	typeI16    = 6
+	typeI32    = 8
+	typeI64    = 10
+	typeString = 11
+	typeStruct = 12
+	typeMap    = 13
+	typeSet    = 14
+	typeList   = 15
+	typeUuid   = 16
+)
+
+const (
+	protocolBinary     = "binary"
+	protocolCompact    = "compact"
+	transportFramed    = "framed"
+	transportBuffered  = "buffered"
+	multiplexSeparator = ":"
+)
+
+// ThriftException is either an application exception, raised by the framework, or an exception declared by the method.
+// Declared exceptions are carried by a reply in a result field other than 0, the success field.
+type ThriftException struct {
+	Declared bool   `json:"declared"`
+	FieldId  int16  `json:"fieldId,omitempty"`
+	Type     int32  `json:"type,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type ThriftMessage struct {
+	Method    string           `json:"method"`
+	Service   string           `json:"service,omitempty"` // set by the multiplexed protocol
+	Type      string           `json:"type"`
+	SeqId     int32            `json:"seqId"`
+	Protocol  string           `json:"protocol"`
+	Transport string           `json:"transport"`
+	Size      int              `json:"size"`
+	Exception *ThriftException `json:"exception,omitempty"`
+}
@@ -0,0 +1,212 @@
+package tap
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	ErrFlowPacketRetentionDisabled = errors.New("flow packet retention is disabled")
+	ErrInvalidFlow                 = errors.New("flow must be in the format <ip>:<port>-<ip>:<port>")
+)
+
+var retainedFlowPackets *flowPacketStore // global, nil unless RETAIN_FLOW_PACKETS is set
+
+type retainedPacket struct {
+	captureInfo gopacket.CaptureInfo
+	data        []byte
+}
+
+type flowPackets struct {
+	linkType     layers.LinkType
+	packets      []retainedPacket
+	sizeBytes    int
+	openedAt     time.Time
+	closedAt     time.Time
+	orderElement *list.Element // of the flow key in the flowsOrder of the store
+}
+
+/*
+ * Keeps the raw packets of the most recently active flows so a single flow can be exported as a pcap file.
+ * Only the first maxBytesPerFlow bytes of a flow are kept, which include its handshake,
+ * and the least recently active flow is evicted when there are more than maxFlows flows.
+ */
+type flowPacketStore struct {
+	flows           map[string]*flowPackets
+	flowsOrder      *list.List // of the flow keys, the least recently seen flow first, evicted first once there are maxFlows
+	maxBytesPerFlow int
+	maxFlows        int
+	lock            sync.Mutex
+}
+
+func newFlowPacketStore(maxBytesPerFlow int, maxFlows int) *flowPacketStore {
+	return &flowPacketStore{
+		flows:           make(map[string]*flowPackets),
+		flowsOrder:      list.New(),
+		maxBytesPerFlow: maxBytesPerFlow,
+		maxFlows:        maxFlows,
+	}
+}
+
+// GetFlowKey identifies a flow by its two endpoints, both directions of the connection share the same key
+func GetFlowKey(srcIp string, srcPort string, dstIp string, dstPort string) string {
+	src := net.JoinHostPort(srcIp, srcPort)
+	dst := net.JoinHostPort(dstIp, dstPort)
+	if dst < src {
+		src, dst = dst, src
+	}
+	return fmt.Sprintf("%s-%s", src, dst)
+}
+
+// WriteFlowPcap writes the retained packets of the flow as a pcap file, it returns false when no packets of the flow were retained
+func WriteFlowPcap(flow string, writer io.Writer) (bool, error) {
+	if retainedFlowPackets == nil {
+		return false, ErrFlowPacketRetentionDisabled
+	}
+
+	flowKey, err := parseFlow(flow)
+	if err != nil {
+		return false, err
+	}
+	return retainedFlowPackets.writePcap(flowKey, writer)
+}
+
+// GetFlowLifecycle returns when the connection of the flow was opened (its SYN) and closed (its last FIN or RST), either
+// time is zero when it wasn't observed
+func GetFlowLifecycle(flow string) (time.Time, time.Time, error) {
+	if retainedFlowPackets == nil {
+		return time.Time{}, time.Time{}, ErrFlowPacketRetentionDisabled
+	}
+
+	flowKey, err := parseFlow(flow)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return retainedFlowPackets.getLifecycle(flowKey)
+}
+
+// ParseFlowEndpoints splits a flow in the format <ip>:<port>-<ip>:<port> to the ip and the port of its endpoints
+func ParseFlowEndpoints(flow string) (string, string, string, string, error) {
+	endpoints := strings.Split(flow, "-")
+	if len(endpoints) != 2 {
+		return "", "", "", "", ErrInvalidFlow
+	}
+
+	srcIp, srcPort, err := net.SplitHostPort(endpoints[0])
+	if err != nil {
+		return "", "", "", "", ErrInvalidFlow
+	}
+	dstIp, dstPort, err := net.SplitHostPort(endpoints[1])
+	if err != nil {
+		return "", "", "", "", ErrInvalidFlow
+	}
+	return srcIp, srcPort, dstIp, dstPort, nil
+}
+
+func parseFlow(flow string) (string, error) {
+	srcIp, srcPort, dstIp, dstPort, err := ParseFlowEndpoints(flow)
+	if err != nil {
+		return "", err
+	}
+	return GetFlowKey(srcIp, srcPort, dstIp, dstPort), nil
+}
+
+func (store *flowPacketStore) add(packet gopacket.Packet, tcp *layers.TCP) {
+	networkFlow := packet.NetworkLayer().NetworkFlow()
+	flowKey := GetFlowKey(networkFlow.Src().String(), fmt.Sprintf("%d", tcp.SrcPort), networkFlow.Dst().String(), fmt.Sprintf("%d", tcp.DstPort))
+	data := packet.Data()
+	captureInfo := packet.Metadata().CaptureInfo
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	flow, ok := store.flows[flowKey]
+	if ok {
+		store.flowsOrder.MoveToBack(flow.orderElement)
+	} else {
+		if len(store.flows) >= store.maxFlows {
+			store.evictLeastRecentlySeen()
+		}
+		flow = &flowPackets{linkType: getLinkType(packet), orderElement: store.flowsOrder.PushBack(flowKey)}
+		store.flows[flowKey] = flow
+	}
+
+	// the lifecycle is tracked past the retained bytes, the handshake is always retained but the teardown usually isn't
+	if tcp.SYN && !tcp.ACK && flow.openedAt.IsZero() {
+		flow.openedAt = captureInfo.Timestamp
+	}
+	if tcp.FIN || tcp.RST {
+		flow.closedAt = captureInfo.Timestamp
+	}
+	if flow.sizeBytes+len(data) > store.maxBytesPerFlow {
+		return
+	}
+
+	packetData := make([]byte, len(data))
+	copy(packetData, data)
+	captureInfo.CaptureLength = len(packetData)
+	flow.packets = append(flow.packets, retainedPacket{captureInfo: captureInfo, data: packetData})
+	flow.sizeBytes += len(packetData)
+}
+
+func (store *flowPacketStore) evictLeastRecentlySeen() {
+	oldest := store.flowsOrder.Front()
+	store.flowsOrder.Remove(oldest)
+	delete(store.flows, oldest.Value.(string))
+}
+
+func (store *flowPacketStore) writePcap(flowKey string, writer io.Writer) (bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	flow, ok := store.flows[flowKey]
+	if !ok {
+		return false, nil
+	}
+
+	pcapWriter := pcapgo.NewWriterNanos(writer)
+	if err := pcapWriter.WriteFileHeader(uint32(store.maxBytesPerFlow), flow.linkType); err != nil {
+		return true, err
+	}
+	for _, packet := range flow.packets {
+		if err := pcapWriter.WritePacket(packet.captureInfo, packet.data); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (store *flowPacketStore) getLifecycle(flowKey string) (time.Time, time.Time, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	flow, ok := store.flows[flowKey]
+	if !ok {
+		return time.Time{}, time.Time{}, nil
+	}
+	return flow.openedAt, flow.closedAt, nil
+}
+
+func getLinkType(packet gopacket.Packet) layers.LinkType {
+	if linkLayer := packet.LinkLayer(); linkLayer != nil {
+		switch linkLayer.LayerType() {
+		case layers.LayerTypeEthernet:
+			return layers.LinkTypeEthernet
+		case layers.LayerTypeLinuxSLL:
+			return layers.LinkTypeLinuxSLL
+		case layers.LayerTypeLoopback:
+			return layers.LinkTypeLoop
+		}
+	}
+	return layers.LinkTypeRaw
+}
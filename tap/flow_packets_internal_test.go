@@ -0,0 +1,167 @@
+package tap
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func newTestTcpPacket(t *testing.T, srcIp string, srcPort int, dstIp string, dstPort int, payload string, timestamp time.Time) gopacket.Packet {
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{5, 4, 3, 2, 1, 0},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(srcIp), DstIP: net.ParseIP(dstIp)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), PSH: true, ACK: true}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatalf("failed to set network layer: %v", err)
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, ethernet, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatalf("failed to serialize packet: %v", err)
+	}
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: timestamp, CaptureLength: len(buffer.Bytes()), Length: len(buffer.Bytes())}
+	return packet
+}
+
+func addTestPacket(store *flowPacketStore, packet gopacket.Packet) {
+	store.add(packet, packet.Layer(layers.LayerTypeTCP).(*layers.TCP))
+}
+
+func readTestPcap(t *testing.T, pcap []byte) []gopacket.Packet {
+	reader, err := pcapgo.NewReader(bytes.NewReader(pcap))
+	if err != nil {
+		t.Fatalf("invalid pcap: %v", err)
+	}
+	if reader.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("unexpected result - expected: %v, actual: %v", layers.LinkTypeEthernet, reader.LinkType())
+	}
+
+	packets := make([]gopacket.Packet, 0)
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			return packets
+		}
+		if err != nil {
+			t.Fatalf("failed reading pcap packet: %v", err)
+		}
+		packets = append(packets, gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default))
+	}
+}
+
+func TestWriteFlowPcap(t *testing.T) {
+	store := newFlowPacketStore(MaxRetainedBytesPerFlowDefaultValue, MaxRetainedFlowsDefaultValue)
+	retainedFlowPackets = store
+	t.Cleanup(func() { retainedFlowPackets = nil })
+
+	now := time.Now()
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "GET / HTTP/1.1\r\n\r\n", now))
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "other flow", now))
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000, "HTTP/1.1 200 OK\r\n\r\n", now.Add(time.Millisecond)))
+
+	tests := []string{"10.0.0.1:40000-10.0.0.2:80", "10.0.0.2:80-10.0.0.1:40000"}
+	for _, flow := range tests {
+		t.Run(flow, func(t *testing.T) {
+			var pcap bytes.Buffer
+			found, err := WriteFlowPcap(flow, &pcap)
+			if err != nil || !found {
+				t.Fatalf("unexpected result - expected: %v, actual: %v (%v)", true, found, err)
+			}
+
+			packets := readTestPcap(t, pcap.Bytes())
+			expectedPayloads := []string{"GET / HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK\r\n\r\n"}
+			if len(packets) != len(expectedPayloads) {
+				t.Fatalf("unexpected result - expected: %v, actual: %v", len(expectedPayloads), len(packets))
+			}
+			for i, packet := range packets {
+				if payload := string(packet.Layer(layers.LayerTypeTCP).(*layers.TCP).Payload); payload != expectedPayloads[i] {
+					t.Errorf("unexpected result - expected: %v, actual: %v", expectedPayloads[i], payload)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFlowPcapNotRetained(t *testing.T) {
+	if _, err := WriteFlowPcap("10.0.0.1:1-10.0.0.2:2", io.Discard); err != ErrFlowPacketRetentionDisabled {
+		t.Errorf("unexpected result - expected: %v, actual: %v", ErrFlowPacketRetentionDisabled, err)
+	}
+
+	retainedFlowPackets = newFlowPacketStore(MaxRetainedBytesPerFlowDefaultValue, MaxRetainedFlowsDefaultValue)
+	t.Cleanup(func() { retainedFlowPackets = nil })
+
+	if found, err := WriteFlowPcap("10.0.0.1:1-10.0.0.2:2", io.Discard); found || err != nil {
+		t.Errorf("unexpected result - expected: %v, actual: %v (%v)", false, found, err)
+	}
+	if _, err := WriteFlowPcap("10.0.0.1-10.0.0.2", io.Discard); err != ErrInvalidFlow {
+		t.Errorf("unexpected result - expected: %v, actual: %v", ErrInvalidFlow, err)
+	}
+}
+
+func TestFlowPacketStoreLimits(t *testing.T) {
+	now := time.Now()
+	packet := newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "payload", now)
+	store := newFlowPacketStore(len(packet.Data())*2, 2)
+
+	for i := 0; i < 5; i++ {
+		addTestPacket(store, packet)
+	}
+	flowKey := GetFlowKey("10.0.0.1", "40000", "10.0.0.2", "80")
+	if retained := len(store.flows[flowKey].packets); retained != 2 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 2, retained)
+	}
+
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "payload", now.Add(time.Second)))
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.4", 40000, "10.0.0.2", 80, "payload", now.Add(2*time.Second)))
+	if _, ok := store.flows[flowKey]; ok || len(store.flows) != 2 {
+		t.Errorf("least recently seen flow should have been evicted")
+	}
+
+	// a flow seen again is the most recently seen one
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "payload", now.Add(3*time.Second)))
+	addTestPacket(store, newTestTcpPacket(t, "10.0.0.5", 40000, "10.0.0.2", 80, "payload", now.Add(4*time.Second)))
+	if _, ok := store.flows[GetFlowKey("10.0.0.3", "40000", "10.0.0.2", "80")]; !ok || len(store.flows) != 2 {
+		t.Errorf("the flow seen again shouldn't have been evicted")
+	}
+}
+
+func TestGetFlowLifecycle(t *testing.T) {
+	// a flow retaining a single packet, so the teardown is past the retained bytes
+	packet := newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "payload", time.Unix(100, 0))
+	retainedFlowPackets = newFlowPacketStore(len(packet.Data()), MaxRetainedFlowsDefaultValue)
+	t.Cleanup(func() { retainedFlowPackets = nil })
+
+	addFlaggedTestPacket := func(srcIp string, srcPort int, dstIp string, dstPort int, timestamp time.Time, setFlags func(tcp *layers.TCP)) {
+		packet := newTestTcpPacket(t, srcIp, srcPort, dstIp, dstPort, "", timestamp)
+		tcp := *packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		tcp.ACK = false
+		setFlags(&tcp)
+		retainedFlowPackets.add(packet, &tcp)
+	}
+	addFlaggedTestPacket("10.0.0.1", 40000, "10.0.0.2", 80, time.Unix(100, 0), func(tcp *layers.TCP) { tcp.SYN = true })
+	addFlaggedTestPacket("10.0.0.2", 80, "10.0.0.1", 40000, time.Unix(101, 0), func(tcp *layers.TCP) { tcp.SYN, tcp.ACK = true, true })
+	addTestPacket(retainedFlowPackets, newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "payload", time.Unix(102, 0)))
+	addFlaggedTestPacket("10.0.0.2", 80, "10.0.0.1", 40000, time.Unix(103, 0), func(tcp *layers.TCP) { tcp.FIN = true })
+	addFlaggedTestPacket("10.0.0.1", 40000, "10.0.0.2", 80, time.Unix(104, 0), func(tcp *layers.TCP) { tcp.FIN = true })
+	addTestPacket(retainedFlowPackets, newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "payload", time.Unix(105, 0)))
+
+	openedAt, closedAt, err := GetFlowLifecycle("10.0.0.2:80-10.0.0.1:40000")
+	if err != nil || !openedAt.Equal(time.Unix(100, 0)) || !closedAt.Equal(time.Unix(104, 0)) {
+		t.Errorf("unexpected result - expected: %v %v, actual: %v %v (%v)", time.Unix(100, 0), time.Unix(104, 0), openedAt, closedAt, err)
+	}
+	if openedAt, closedAt, err := GetFlowLifecycle("10.0.0.3:40000-10.0.0.2:80"); err != nil || !openedAt.IsZero() || !closedAt.IsZero() {
+		t.Errorf("unexpected result - expected: %v, actual: %v %v (%v)", "an unobserved lifecycle", openedAt, closedAt, err)
+	}
+}
@@ -11,9 +11,12 @@ package tap
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/up9inc/mizu/shared/logger"
@@ -58,6 +61,12 @@ type TapOpts struct {
 var hostMode bool                                 // global
 var extensions []*api.Extension                   // global
 var filteringOptions *api.TrafficFilteringOptions // global
+var portConflicts []api.PortConflict              // global
+var extensionsMutex sync.RWMutex                  // guards extensions and portConflicts
+
+var stopTapper = make(chan struct{})
+var tapperStopped = make(chan struct{})
+var stopTapperOnce sync.Once
 
 func inArrayInt(arr []int, valueToCheck int) bool {
 	for _, value := range arr {
@@ -78,9 +87,7 @@ func inArrayString(arr []string, valueToCheck string) bool {
 }
 
 func StartPassiveTapper(opts *TapOpts, outputItems chan *api.OutputChannelItem, extensionsRef []*api.Extension, options *api.TrafficFilteringOptions) {
-	hostMode = opts.HostMode
-	extensions = extensionsRef
-	filteringOptions = options
+	initPassiveTapper(opts, extensionsRef, options)
 
 	if GetMemoryProfilingEnabled() {
 		diagnose.StartMemoryProfiler(os.Getenv(MemoryProfilingDumpPath), os.Getenv(MemoryProfilingTimeIntervalSeconds))
@@ -89,6 +96,100 @@ func StartPassiveTapper(opts *TapOpts, outputItems chan *api.OutputChannelItem,
 	go startPassiveTapper(outputItems)
 }
 
+// ReadPcapFiles dissects the packets of the pcap and pcapng files in turn with the same reassembly and extensions as
+// StartPassiveTapper, it returns once the items of the files were emitted to outputItems. A file that fails to open
+// or to be read to its end, e.g. a truncated file, doesn't stop the other files, the items of its packets that could
+// be read are emitted and its error is returned with the errors of the other files.
+func ReadPcapFiles(opts *TapOpts, outputItems chan *api.OutputChannelItem, extensionsRef []*api.Extension, options *api.TrafficFilteringOptions, filenames []string) error {
+	initPassiveTapper(opts, extensionsRef, options)
+	diagnose.InitializeErrorsMap(*debug, *verbose, *quiet)
+	diagnose.InitializeTapperInternalStats()
+	diagnose.AppStats.SetStartTime(time.Now())
+
+	// the streams are flushed once each file is read, so the stale connections aren't cleaned
+	assembler := NewTcpAssembler(outputItems, NewTcpStreamMap())
+
+	var readErrors []string
+	for _, filename := range filenames {
+		if err := readPcapFile(assembler, filename); err != nil {
+			logger.Log.Errorf("Error reading the pcap file %s: %v", filename, err)
+			readErrors = append(readErrors, fmt.Sprintf("%s: %v", filename, err))
+		}
+	}
+
+	assembler.waitAndDump()
+	logger.Log.Infof("Read %d pcap files, AppStats: %v", len(filenames), diagnose.AppStats)
+
+	if len(readErrors) > 0 {
+		return fmt.Errorf("failed reading %d of %d pcap files: %s", len(readErrors), len(filenames), strings.Join(readErrors, "; "))
+	}
+	return nil
+}
+
+func readPcapFile(assembler *tcpAssembler, filename string) error {
+	packetSource, err := source.NewTcpPacketFileSource(filename, source.TcpPacketSourceBehaviour{
+		DecoderName: *decoder,
+		Lazy:        *lazy,
+	})
+	if err != nil {
+		return err
+	}
+	defer packetSource.Close()
+
+	logger.Log.Infof("Reading packets from %s", filename)
+	packets := make(chan source.TcpPacketInfo)
+	var readErr error
+	go func() {
+		defer close(packets)
+		if err := packetSource.ReadPackets(!*nodefrag, packets); err != io.EOF {
+			readErr = err
+		}
+	}()
+
+	assembler.processPackets(*hexdumppkt, packets, stopTapper)
+	// the packets are closed once readErr is set, unless the tapper was stopped before the file was read
+	for range packets {
+	}
+	return readErr
+}
+
+func initPassiveTapper(opts *TapOpts, extensionsRef []*api.Extension, options *api.TrafficFilteringOptions) {
+	hostMode = opts.HostMode
+	filteringOptions = options
+	UpdateExtensions(extensionsRef, options.ExtensionPortOwners)
+
+	if GetRetainFlowPacketsEnabled() {
+		retainedFlowPackets = newFlowPacketStore(GetMaxRetainedBytesPerFlow(), GetMaxRetainedFlows())
+	}
+
+	if GetIncludeTlsCertificatesEnabled() {
+		recentTlsHandshakes = newTlsHandshakeStore(maxRecentTlsHandshakes)
+	}
+}
+
+// StopPassiveTapper stops reading packets and flushes the open streams, it returns once the items of the streams were
+// emitted and none will be emitted anymore, so the output channel of the tapper can be closed
+func StopPassiveTapper() {
+	stopTapperOnce.Do(func() { close(stopTapper) })
+	<-tapperStopped
+}
+
+// UpdateExtensions replaces the extensions that dissect the new connections, the connections that were opened before
+// are dissected by the extensions they started with
+func UpdateExtensions(extensionsRef []*api.Extension, extensionPortOwners map[string]string) {
+	conflicts := api.ResolvePortConflicts(extensionsRef, extensionPortOwners)
+	extensionsMutex.Lock()
+	defer extensionsMutex.Unlock()
+	extensions = extensionsRef
+	portConflicts = conflicts
+}
+
+func getExtensions() ([]*api.Extension, []api.PortConflict) {
+	extensionsMutex.RLock()
+	defer extensionsMutex.RUnlock()
+	return extensions, portConflicts
+}
+
 func printPeriodicStats(cleaner *Cleaner) {
 	statsPeriod := time.Second * time.Duration(*statsevery)
 	ticker := time.NewTicker(statsPeriod)
@@ -130,6 +231,8 @@ func printPeriodicStats(cleaner *Cleaner) {
 }
 
 func startPassiveTapper(outputItems chan *api.OutputChannelItem) {
+	defer close(tapperStopped)
+
 	streamsMap := NewTcpStreamMap()
 	go streamsMap.closeTimedoutTcpStreamChannels()
 
@@ -179,7 +282,7 @@ func startPassiveTapper(outputItems chan *api.OutputChannelItem) {
 
 	go printPeriodicStats(&cleaner)
 
-	assembler.processPackets(*hexdumppkt, packets)
+	assembler.processPackets(*hexdumppkt, packets, stopTapper)
 
 	if diagnose.TapErrors.OutputLevel >= 2 {
 		assembler.dumpStreamPool()
@@ -0,0 +1,143 @@
+package tap
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var testHttpProtocol = &api.Protocol{Name: "http"}
+
+// requestLineDissector emits an item for each request line of the clients, it stands for the http extension
+type requestLineDissector struct {
+	api.Dissector
+}
+
+func (d *requestLineDissector) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, superIdentifier *api.SuperIdentifier, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	for {
+		line, err := b.ReadString('\n')
+		if isClient && strings.HasPrefix(line, "GET ") {
+			emitter.Emit(&api.OutputChannelItem{
+				Protocol:       *testHttpProtocol,
+				ConnectionInfo: &api.ConnectionInfo{ClientIP: tcpID.SrcIP, ClientPort: tcpID.SrcPort, ServerIP: tcpID.DstIP, ServerPort: tcpID.DstPort},
+				Pair:           &api.RequestResponsePair{Request: api.GenericMessage{IsRequest: true, Payload: strings.TrimSpace(line)}},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeTestPcapFile(t *testing.T, name string, packets ...gopacket.Packet) string {
+	filename := path.Join(t.TempDir(), name)
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("failed to create pcap: %v", err)
+	}
+	defer file.Close()
+
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatalf("failed to write pcap header: %v", err)
+	}
+	for _, packet := range packets {
+		if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+			t.Fatalf("failed to write pcap packet: %v", err)
+		}
+	}
+	return filename
+}
+
+func readTestPcapFiles(t *testing.T, filenames ...string) ([]string, error) {
+	outputItems := make(chan *api.OutputChannelItem, 100)
+	extension := &api.Extension{Protocol: testHttpProtocol, Dissector: &requestLineDissector{}}
+	err := ReadPcapFiles(&TapOpts{}, outputItems, []*api.Extension{extension}, &api.TrafficFilteringOptions{}, filenames)
+	close(outputItems)
+
+	requests := make([]string, 0)
+	for item := range outputItems {
+		requests = append(requests, item.Pair.Request.Payload.(string))
+	}
+	sort.Strings(requests)
+	return requests, err
+}
+
+func TestReadPcapFiles(t *testing.T) {
+	now := time.Now()
+	filename := writeTestPcapFile(t, "http.pcap",
+		newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "GET /orders HTTP/1.1\r\nHost: orders\r\n\r\n", now),
+		newTestTcpPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", now.Add(time.Millisecond)),
+		newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "GET /users HTTP/1.1\r\nHost: users\r\n\r\n", now.Add(2*time.Millisecond)),
+	)
+
+	requests, err := readTestPcapFiles(t, filename)
+	if err != nil {
+		t.Fatalf("failed reading pcap: %v", err)
+	}
+	expectedRequests := []string{"GET /orders HTTP/1.1", "GET /users HTTP/1.1"}
+	if strings.Join(requests, ",") != strings.Join(expectedRequests, ",") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedRequests, requests)
+	}
+}
+
+func TestReadPcapFilesTruncated(t *testing.T) {
+	now := time.Now()
+	filename := writeTestPcapFile(t, "truncated.pcap",
+		newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "GET /orders HTTP/1.1\r\nHost: orders\r\n\r\n", now),
+		newTestTcpPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80, "GET /users HTTP/1.1\r\nHost: users\r\n\r\n", now.Add(time.Millisecond)),
+	)
+	info, _ := os.Stat(filename)
+	if err := os.Truncate(filename, info.Size()-10); err != nil {
+		t.Fatalf("failed to truncate pcap: %v", err)
+	}
+	corruptFilename := path.Join(t.TempDir(), "corrupt.pcap")
+	ioutil.WriteFile(corruptFilename, []byte("not a pcap file"), 0600)
+	validFilename := writeTestPcapFile(t, "valid.pcap",
+		newTestTcpPacket(t, "10.0.0.4", 40000, "10.0.0.2", 80, "GET /payments HTTP/1.1\r\n\r\n", now),
+	)
+
+	requests, err := readTestPcapFiles(t, filename, corruptFilename, path.Join(t.TempDir(), "missing.pcap"), validFilename)
+	if err == nil || !strings.Contains(err.Error(), "failed reading 3 of 4 pcap files") || !strings.Contains(err.Error(), io.ErrUnexpectedEOF.Error()) {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "the errors of the 3 files", err)
+	}
+	// the packets before the truncation and the other files are still dissected
+	expectedRequests := []string{"GET /orders HTTP/1.1", "GET /payments HTTP/1.1"}
+	if strings.Join(requests, ",") != strings.Join(expectedRequests, ",") {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedRequests, requests)
+	}
+}
+
+func TestReadPcapngFile(t *testing.T) {
+	filename := path.Join(t.TempDir(), "http.pcapng")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("failed to create pcapng: %v", err)
+	}
+	writer, err := pcapgo.NewNgWriter(file, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatalf("failed to write pcapng header: %v", err)
+	}
+	packet := newTestTcpPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80, "GET /orders HTTP/1.1\r\n\r\n", time.Now())
+	if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+		t.Fatalf("failed to write pcapng packet: %v", err)
+	}
+	writer.Flush()
+	file.Close()
+
+	requests, err := readTestPcapFiles(t, filename)
+	if err != nil || len(requests) != 1 || requests[0] != "GET /orders HTTP/1.1" {
+		t.Errorf("unexpected result - expected: %v, actual: %v (%v)", "GET /orders HTTP/1.1", requests, err)
+	}
+}
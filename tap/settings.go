@@ -16,6 +16,12 @@ const (
 	MaxBufferedPagesTotalDefaultValue         = 5000
 	MaxBufferedPagesPerConnectionDefaultValue = 5000
 	TcpStreamChannelTimeoutMsDefaultValue     = 10000
+	RetainFlowPacketsEnvVarName               = "RETAIN_FLOW_PACKETS"
+	MaxRetainedBytesPerFlowEnvVarName         = "MAX_RETAINED_BYTES_PER_FLOW"
+	MaxRetainedFlowsEnvVarName                = "MAX_RETAINED_FLOWS"
+	MaxRetainedBytesPerFlowDefaultValue       = 1024 * 1024
+	MaxRetainedFlowsDefaultValue              = 1000
+	IncludeTlsCertificatesEnvVarName          = "INCLUDE_TLS_CERTIFICATES"
 )
 
 type globalSettings struct {
@@ -63,3 +69,27 @@ func GetTcpChannelTimeoutMs() time.Duration {
 func GetMemoryProfilingEnabled() bool {
 	return os.Getenv(MemoryProfilingEnabledEnvVarName) == "1"
 }
+
+func GetRetainFlowPacketsEnabled() bool {
+	return os.Getenv(RetainFlowPacketsEnvVarName) == "1"
+}
+
+func GetMaxRetainedBytesPerFlow() int {
+	valueFromEnv, err := strconv.Atoi(os.Getenv(MaxRetainedBytesPerFlowEnvVarName))
+	if err != nil {
+		return MaxRetainedBytesPerFlowDefaultValue
+	}
+	return valueFromEnv
+}
+
+func GetMaxRetainedFlows() int {
+	valueFromEnv, err := strconv.Atoi(os.Getenv(MaxRetainedFlowsEnvVarName))
+	if err != nil {
+		return MaxRetainedFlowsDefaultValue
+	}
+	return valueFromEnv
+}
+
+func GetIncludeTlsCertificatesEnabled() bool {
+	return os.Getenv(IncludeTlsCertificatesEnvVarName) == "1"
+}
@@ -1,14 +1,17 @@
 package source
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/ip4defrag"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
 	"github.com/up9inc/mizu/shared/logger"
 	"github.com/up9inc/mizu/tap/diagnose"
 )
@@ -16,6 +19,7 @@ import (
 type TcpPacketSource struct {
 	source    *gopacket.PacketSource
 	handle    *pcap.Handle
+	file      *os.File // set instead of handle when reading a file with NewTcpPacketFileSource
 	defragger *ip4defrag.IPv4Defragmenter
 	Behaviour *TcpPacketSourceBehaviour
 }
@@ -96,18 +100,80 @@ func NewTcpPacketSource(filename string, interfaceName string,
 	return result, nil
 }
 
+// pcapngMagic is the block type of the section header block starting a pcapng file
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// NewTcpPacketFileSource reads the packets of a pcap or pcapng file without libpcap, unlike reading the file with
+// NewTcpPacketSource. BPF filters aren't supported since compiling them requires libpcap.
+func NewTcpPacketFileSource(filename string, behaviour TcpPacketSourceBehaviour) (*TcpPacketSource, error) {
+	if behaviour.BpfFilter != "" {
+		return nil, fmt.Errorf("BPF filters aren't supported when reading %s", filename)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var packetDataSource gopacket.PacketDataSource
+	var linkType layers.LinkType
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(len(pcapngMagic)); err == nil && string(magic) == string(pcapngMagic) {
+		ngReader, err := pcapgo.NewNgReader(reader, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid pcapng file %s: %v", filename, err)
+		}
+		packetDataSource, linkType = ngReader, ngReader.LinkType()
+	} else {
+		pcapReader, err := pcapgo.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid pcap file %s: %v", filename, err)
+		}
+		packetDataSource, linkType = pcapReader, pcapReader.LinkType()
+	}
+
+	if behaviour.DecoderName == "" {
+		behaviour.DecoderName = linkType.String()
+	}
+	dec, ok := gopacket.DecodersByLayerName[behaviour.DecoderName]
+	if !ok {
+		file.Close()
+		return nil, fmt.Errorf("no decoder named %v", behaviour.DecoderName)
+	}
+
+	result := &TcpPacketSource{
+		file:      file,
+		defragger: ip4defrag.NewIPv4Defragmenter(),
+		Behaviour: &behaviour,
+	}
+	result.source = gopacket.NewPacketSource(packetDataSource, dec)
+	result.source.Lazy = behaviour.Lazy
+	result.source.NoCopy = true
+
+	return result, nil
+}
+
 func (source *TcpPacketSource) Close() {
 	if source.handle != nil {
 		source.handle.Close()
 	}
+	if source.file != nil {
+		source.file.Close()
+	}
 }
 
+// ReadPackets sends the packets of the source until it's exhausted, which returns io.EOF. The packets of a file source
+// can't be read past an error, e.g. a truncated or corrupt file, so the error is returned.
 func (source *TcpPacketSource) ReadPackets(ipdefrag bool, packets chan<- TcpPacketInfo) error {
 	for {
 		packet, err := source.source.NextPacket()
 
 		if err == io.EOF {
 			return err
+		} else if err != nil && source.file != nil {
+			return err
 		} else if err != nil {
 			if err.Error() != "Timeout Expired" {
 				logger.Log.Debugf("Error: %T", err)
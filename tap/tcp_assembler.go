@@ -57,60 +57,22 @@ func NewTcpAssembler(outputItems chan *api.OutputChannelItem, streamsMap *tcpStr
 	}
 }
 
-func (a *tcpAssembler) processPackets(dumpPacket bool, packets <-chan source.TcpPacketInfo) {
+// processPackets assembles the packets until the packets are exhausted, the count of packets to grab is reached, an
+// interrupt is caught or stop is closed, the open streams are flushed before it returns
+func (a *tcpAssembler) processPackets(dumpPacket bool, packets <-chan source.TcpPacketInfo, stop <-chan struct{}) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt)
 
-	for packetInfo := range packets {
-		packetsCount := diagnose.AppStats.IncPacketsCount()
-		logger.Log.Debugf("PACKET #%d", packetsCount)
-		packet := packetInfo.Packet
-		data := packet.Data()
-		diagnose.AppStats.UpdateProcessedBytes(uint64(len(data)))
-		if dumpPacket {
-			logger.Log.Debugf("Packet content (%d/0x%x) - %s", len(data), len(data), hex.Dump(data))
-		}
-
-		tcp := packet.Layer(layers.LayerTypeTCP)
-		if tcp != nil {
-			diagnose.AppStats.IncTcpPacketsCount()
-			tcp := tcp.(*layers.TCP)
-			if *checksum {
-				err := tcp.SetNetworkLayerForChecksum(packet.NetworkLayer())
-				if err != nil {
-					logger.Log.Fatalf("Failed to set network layer for checksum: %s\n", err)
-				}
-			}
-			c := context{
-				CaptureInfo: packet.Metadata().CaptureInfo,
-			}
-			diagnose.InternalStats.Totalsz += len(tcp.Payload)
-			logger.Log.Debugf("%s : %v -> %s : %v", packet.NetworkLayer().NetworkFlow().Src(), tcp.SrcPort, packet.NetworkLayer().NetworkFlow().Dst(), tcp.DstPort)
-			a.assemblerMutex.Lock()
-			a.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), tcp, &c)
-			a.assemblerMutex.Unlock()
-		}
-
-		done := *maxcount > 0 && int64(diagnose.AppStats.PacketsCount) >= *maxcount
-		if done {
-			errorMapLen, _ := diagnose.TapErrors.GetErrorsSummary()
-			logger.Log.Infof("Processed %v packets (%v bytes) in %v (errors: %v, errTypes:%v)",
-				diagnose.AppStats.PacketsCount,
-				diagnose.AppStats.ProcessedBytes,
-				time.Since(diagnose.AppStats.StartTime),
-				diagnose.TapErrors.ErrorsCount,
-				errorMapLen)
-		}
-
+	for done := false; !done; {
 		select {
+		case packetInfo, ok := <-packets:
+			done = !ok || a.processPacket(dumpPacket, packetInfo)
 		case <-signalChan:
 			logger.Log.Infof("Caught SIGINT: aborting")
 			done = true
-		default:
-			// NOP: continue
-		}
-		if done {
-			break
+		case <-stop:
+			logger.Log.Infof("Stopping the tapper")
+			done = true
 		}
 	}
 
@@ -120,6 +82,54 @@ func (a *tcpAssembler) processPackets(dumpPacket bool, packets <-chan source.Tcp
 	logger.Log.Debugf("Final flush: %d closed", closed)
 }
 
+// processPacket returns whether the count of packets to grab was reached
+func (a *tcpAssembler) processPacket(dumpPacket bool, packetInfo source.TcpPacketInfo) bool {
+	packetsCount := diagnose.AppStats.IncPacketsCount()
+	logger.Log.Debugf("PACKET #%d", packetsCount)
+	packet := packetInfo.Packet
+	data := packet.Data()
+	diagnose.AppStats.UpdateProcessedBytes(uint64(len(data)))
+	if dumpPacket {
+		logger.Log.Debugf("Packet content (%d/0x%x) - %s", len(data), len(data), hex.Dump(data))
+	}
+
+	tcp := packet.Layer(layers.LayerTypeTCP)
+	if tcp != nil {
+		diagnose.AppStats.IncTcpPacketsCount()
+		tcp := tcp.(*layers.TCP)
+		if *checksum {
+			err := tcp.SetNetworkLayerForChecksum(packet.NetworkLayer())
+			if err != nil {
+				logger.Log.Fatalf("Failed to set network layer for checksum: %s\n", err)
+			}
+		}
+		c := context{
+			CaptureInfo: packet.Metadata().CaptureInfo,
+		}
+		diagnose.InternalStats.Totalsz += len(tcp.Payload)
+		logger.Log.Debugf("%s : %v -> %s : %v", packet.NetworkLayer().NetworkFlow().Src(), tcp.SrcPort, packet.NetworkLayer().NetworkFlow().Dst(), tcp.DstPort)
+		a.assemblerMutex.Lock()
+		a.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), tcp, &c)
+		a.assemblerMutex.Unlock()
+
+		if retainedFlowPackets != nil {
+			retainedFlowPackets.add(packet, tcp)
+		}
+	}
+
+	done := *maxcount > 0 && int64(diagnose.AppStats.PacketsCount) >= *maxcount
+	if done {
+		errorMapLen, _ := diagnose.TapErrors.GetErrorsSummary()
+		logger.Log.Infof("Processed %v packets (%v bytes) in %v (errors: %v, errTypes:%v)",
+			diagnose.AppStats.PacketsCount,
+			diagnose.AppStats.ProcessedBytes,
+			time.Since(diagnose.AppStats.StartTime),
+			diagnose.TapErrors.ErrorsCount,
+			errorMapLen)
+	}
+	return done
+}
+
 func (a *tcpAssembler) dumpStreamPool() {
 	a.streamPool.Dump()
 }
@@ -47,6 +47,7 @@ type tcpReader struct {
 	extension          *api.Extension
 	emitter            api.Emitter
 	counterPair        *api.CounterPair
+	tlsParser          *tlsServerHandshakeParser // only set on the first server reader of a stream when certificates are included
 	sync.Mutex
 }
 
@@ -72,6 +73,9 @@ func (h *tcpReader) Read(p []byte) (int, error) {
 				// h.outboundLinkWriter.WriteOutboundLink(h.tcpID.SrcIP, h.tcpID.DstIP, numericPort, clientHello.SNI, TLSProtocol)
 			}
 		}
+		if h.tlsParser != nil && len(msg.bytes) > 0 {
+			h.handleTlsServerPayload(msg)
+		}
 	}
 	if !ok || len(h.data) == 0 {
 		return 0, io.EOF
@@ -82,6 +86,20 @@ func (h *tcpReader) Read(p []byte) (int, error) {
 	return l, nil
 }
 
+func (h *tcpReader) handleTlsServerPayload(msg tcpReaderDataMsg) {
+	if handshake := h.tlsParser.feed(msg.bytes); handshake != nil {
+		handshake.ServerIP = h.tcpID.SrcIP
+		handshake.ServerPort = h.tcpID.SrcPort
+		handshake.ClientIP = h.tcpID.DstIP
+		handshake.CapturedAt = msg.timestamp
+		recentTlsHandshakes.add(handshake)
+		h.emitter.Emit(newTlsHandshakeItem(handshake, h.tcpID))
+	}
+	if h.tlsParser.done {
+		h.tlsParser = nil
+	}
+}
+
 func (h *tcpReader) Close() {
 	h.Lock()
 	if !h.isClosed {
@@ -150,6 +150,9 @@ func (t *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.Ass
 			// This channel is read by an tcpReader object
 			diagnose.AppStats.IncReassembledTcpPayloadsCount()
 			timestamp := ac.GetCaptureInfo().Timestamp
+			// the fetched bytes are in the pages of the assembler, which reuses them once this call returns while
+			// the readers are still reading them
+			data := append([]byte(nil), data...)
 			if dir == reassembly.TCPDirClientToServer {
 				for i := range t.clients {
 					reader := &t.clients[i]
@@ -3,10 +3,12 @@ package tap
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/up9inc/mizu/shared/logger"
 	"github.com/up9inc/mizu/tap/api"
+	"github.com/up9inc/mizu/tap/diagnose"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers" // pulls in all layers decoders
@@ -26,6 +28,17 @@ type tcpStreamFactory struct {
 	ownIps             []string
 }
 
+var newStreamsPaused int32
+
+// SetNewStreamsPaused stops (or resumes) the reassembly of newly opened tcp streams, streams that are already reassembled are not affected
+func SetNewStreamsPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&newStreamsPaused, value)
+}
+
 type tcpStreamWrapper struct {
 	stream    *tcpStream
 	createdAt time.Time
@@ -65,6 +78,10 @@ func (factory *tcpStreamFactory) New(net, transport gopacket.Flow, tcp *layers.T
 	// }
 	props := factory.getStreamProps(srcIp, srcPort, dstIp, dstPort)
 	isTapTarget := props.isTapTarget
+	if isTapTarget && atomic.LoadInt32(&newStreamsPaused) == 1 {
+		isTapTarget = false
+		diagnose.AppStats.IncPausedTcpStreams()
+	}
 	stream := &tcpStream{
 		net:             net,
 		transport:       transport,
@@ -78,7 +95,12 @@ func (factory *tcpStreamFactory) New(net, transport gopacket.Flow, tcp *layers.T
 	}
 	if stream.isTapTarget {
 		stream.id = factory.streamsMap.nextId()
-		for i, extension := range extensions {
+		extensions, portConflicts := getExtensions()
+		for _, extension := range extensions {
+			if !api.ShouldDissectPort(extension, dstPort, portConflicts) {
+				continue
+			}
+			i := len(stream.clients)
 			counterPair := &api.CounterPair{
 				Request:  0,
 				Response: 0,
@@ -120,6 +142,10 @@ func (factory *tcpStreamFactory) New(net, transport gopacket.Flow, tcp *layers.T
 				counterPair:        counterPair,
 			})
 
+			if i == 0 && recentTlsHandshakes != nil {
+				stream.servers[i].tlsParser = &tlsServerHandshakeParser{}
+			}
+
 			factory.streamsMap.Store(stream.id, &tcpStreamWrapper{
 				stream:    stream,
 				createdAt: time.Now(),
@@ -46,6 +46,16 @@ func loadExtensions() ([]*tapApi.Extension, error) {
 		}
 
 		extension.Plug = plug
+		symApiVersion, err := plug.Lookup("ApiVersion")
+
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		if err := tapApi.CheckApiVersion(symApiVersion); err != nil {
+			return nil, errors.Errorf("%s: %v", file, err)
+		}
+
 		symDissector, err := plug.Lookup("Dissector")
 
 		if err != nil {
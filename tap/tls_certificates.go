@@ -0,0 +1,252 @@
+package tap
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/up9inc/mizu/shared/logger"
+)
+
+const (
+	maxRecentTlsHandshakes = 1000
+	maxTlsHandshakeBytes   = 128 * 1024 // certificate chains are usually a few KB, anything larger isn't followed
+
+	tlsRecordTypeChangeCipherSpec = 20
+	tlsRecordTypeHandshake        = 22
+
+	tlsHandshakeTypeServerHello     = 2
+	tlsHandshakeTypeCertificate     = 11
+	tlsHandshakeTypeServerHelloDone = 14
+
+	tlsExtensionSupportedVersions = 43
+	tlsVersion13                  = 0x0304
+)
+
+var recentTlsHandshakes *tlsHandshakeStore // global, nil unless INCLUDE_TLS_CERTIFICATES is set
+
+type TLSCertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// TLSHandshakeInfo describes the last handshake observed for a TLS server, the chain is ordered leaf first
+// and is empty when the session was resumed since no certificate is sent on resumption
+type TLSHandshakeInfo struct {
+	ServerIP       string               `json:"serverIp"`
+	ServerPort     string               `json:"serverPort"`
+	ClientIP       string               `json:"clientIp"`
+	SessionResumed bool                 `json:"sessionResumed"`
+	Certificates   []TLSCertificateInfo `json:"certificates"`
+	CapturedAt     time.Time            `json:"capturedAt"`
+}
+
+// GetRecentTLSHandshakes returns the last handshake of every recently seen TLS server, it's empty unless INCLUDE_TLS_CERTIFICATES is set
+func GetRecentTLSHandshakes() []TLSHandshakeInfo {
+	if recentTlsHandshakes == nil {
+		return []TLSHandshakeInfo{}
+	}
+	return recentTlsHandshakes.getAll()
+}
+
+/*
+ * Follows the server side of a TLS connection up to the end of its first flight and extracts the certificate chain.
+ * Only TLS 1.2 and earlier expose the certificates, in TLS 1.3 they are encrypted and the parser gives up after the ServerHello.
+ */
+type tlsServerHandshakeParser struct {
+	records        []byte // unparsed bytes of the record layer
+	handshake      []byte // unparsed bytes of the handshake protocol, messages may span records
+	sawServerHello bool
+	done           bool
+	result         *TLSHandshakeInfo
+}
+
+// feed consumes the next server payload, it returns the handshake info once, when the first flight is complete
+func (parser *tlsServerHandshakeParser) feed(data []byte) *TLSHandshakeInfo {
+	if parser.done {
+		return nil
+	}
+	if len(parser.records)+len(data) > maxTlsHandshakeBytes {
+		parser.done = true
+		return nil
+	}
+	parser.records = append(parser.records, data...)
+
+	for !parser.done && len(parser.records) >= 5 {
+		recordType := parser.records[0]
+		if parser.records[1] != 0x03 {
+			// not a TLS record, the connection isn't TLS
+			parser.done = true
+			break
+		}
+		recordLength := int(binary.BigEndian.Uint16(parser.records[3:5]))
+		if len(parser.records) < 5+recordLength {
+			return nil
+		}
+		fragment := parser.records[5 : 5+recordLength]
+		parser.records = parser.records[5+recordLength:]
+
+		switch recordType {
+		case tlsRecordTypeHandshake:
+			parser.handshake = append(parser.handshake, fragment...)
+			parser.parseHandshakeMessages()
+		case tlsRecordTypeChangeCipherSpec:
+			// an abbreviated handshake goes straight from the ServerHello to ChangeCipherSpec
+			if parser.sawServerHello && parser.result == nil {
+				parser.result = &TLSHandshakeInfo{SessionResumed: true, Certificates: []TLSCertificateInfo{}}
+			}
+			parser.done = true
+		default:
+			parser.done = true
+		}
+	}
+
+	if parser.done {
+		return parser.result
+	}
+	return nil
+}
+
+func (parser *tlsServerHandshakeParser) parseHandshakeMessages() {
+	for !parser.done && len(parser.handshake) >= 4 {
+		messageType := parser.handshake[0]
+		messageLength := int(parser.handshake[1])<<16 | int(parser.handshake[2])<<8 | int(parser.handshake[3])
+		if len(parser.handshake) < 4+messageLength {
+			return
+		}
+		body := parser.handshake[4 : 4+messageLength]
+		parser.handshake = parser.handshake[4+messageLength:]
+
+		switch messageType {
+		case tlsHandshakeTypeServerHello:
+			parser.sawServerHello = true
+			if isTls13ServerHello(body) {
+				parser.done = true
+			}
+		case tlsHandshakeTypeCertificate:
+			parser.result = &TLSHandshakeInfo{Certificates: parseCertificateChain(body)}
+		case tlsHandshakeTypeServerHelloDone:
+			parser.done = true
+		}
+	}
+}
+
+func isTls13ServerHello(body []byte) bool {
+	// version (2), random (32), session id (1 + length), cipher suite (2), compression method (1), extensions (2 + length)
+	offset := 34
+	if len(body) < offset+1 {
+		return false
+	}
+	offset += 1 + int(body[offset]) + 3
+	if len(body) < offset+2 {
+		return false
+	}
+	extensionsEnd := offset + 2 + int(binary.BigEndian.Uint16(body[offset:offset+2]))
+	offset += 2
+
+	for offset+4 <= extensionsEnd && offset+4 <= len(body) {
+		extensionType := binary.BigEndian.Uint16(body[offset : offset+2])
+		extensionLength := int(binary.BigEndian.Uint16(body[offset+2 : offset+4]))
+		offset += 4
+		if extensionType == tlsExtensionSupportedVersions && extensionLength == 2 && offset+2 <= len(body) {
+			return binary.BigEndian.Uint16(body[offset:offset+2]) == tlsVersion13
+		}
+		offset += extensionLength
+	}
+	return false
+}
+
+func parseCertificateChain(body []byte) []TLSCertificateInfo {
+	certificates := make([]TLSCertificateInfo, 0)
+	if len(body) < 3 {
+		return certificates
+	}
+
+	chain := body[3:]
+	for len(chain) >= 3 {
+		certificateLength := int(chain[0])<<16 | int(chain[1])<<8 | int(chain[2])
+		if len(chain) < 3+certificateLength {
+			break
+		}
+		certificate, err := x509.ParseCertificate(chain[3 : 3+certificateLength])
+		chain = chain[3+certificateLength:]
+		if err != nil {
+			logger.Log.Debugf("Failed parsing TLS certificate: %v", err)
+			continue
+		}
+
+		sans := make([]string, 0, len(certificate.DNSNames)+len(certificate.IPAddresses))
+		sans = append(sans, certificate.DNSNames...)
+		for _, ip := range certificate.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		certificates = append(certificates, TLSCertificateInfo{
+			Subject:   certificate.Subject.String(),
+			Issuer:    certificate.Issuer.String(),
+			SANs:      sans,
+			NotBefore: certificate.NotBefore,
+			NotAfter:  certificate.NotAfter,
+		})
+	}
+	return certificates
+}
+
+// tlsHandshakeStore keeps the last handshake of every server, the least recently seen server is evicted when full
+type tlsHandshakeStore struct {
+	handshakes map[string]TLSHandshakeInfo
+	maxServers int
+	lock       sync.Mutex
+}
+
+func newTlsHandshakeStore(maxServers int) *tlsHandshakeStore {
+	return &tlsHandshakeStore{
+		handshakes: make(map[string]TLSHandshakeInfo),
+		maxServers: maxServers,
+	}
+}
+
+func (store *tlsHandshakeStore) add(handshake *TLSHandshakeInfo) {
+	serverKey := net.JoinHostPort(handshake.ServerIP, handshake.ServerPort)
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.handshakes[serverKey]; !ok && len(store.handshakes) >= store.maxServers {
+		store.evictLeastRecentlySeen()
+	}
+	store.handshakes[serverKey] = *handshake
+}
+
+func (store *tlsHandshakeStore) evictLeastRecentlySeen() {
+	var oldestKey string
+	var oldestSeen time.Time
+	for key, handshake := range store.handshakes {
+		if oldestKey == "" || handshake.CapturedAt.Before(oldestSeen) {
+			oldestKey, oldestSeen = key, handshake.CapturedAt
+		}
+	}
+	delete(store.handshakes, oldestKey)
+}
+
+func (store *tlsHandshakeStore) getAll() []TLSHandshakeInfo {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	handshakes := make([]TLSHandshakeInfo, 0, len(store.handshakes))
+	for _, handshake := range store.handshakes {
+		handshakes = append(handshakes, handshake)
+	}
+	sort.Slice(handshakes, func(i, j int) bool {
+		if handshakes[i].ServerIP != handshakes[j].ServerIP {
+			return handshakes[i].ServerIP < handshakes[j].ServerIP
+		}
+		return handshakes[i].ServerPort < handshakes[j].ServerPort
+	})
+	return handshakes
+}
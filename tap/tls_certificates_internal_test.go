@@ -0,0 +1,185 @@
+package tap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, commonName string, sans []string, ips []net.IP, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Mizu"}},
+		DNSNames:              sans,
+		IPAddresses:           ips,
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return certificate, key
+}
+
+func uint24(length int) []byte {
+	return []byte{byte(length >> 16), byte(length >> 8), byte(length)}
+}
+
+func newTestHandshakeMessage(messageType byte, body []byte) []byte {
+	return append(append([]byte{messageType}, uint24(len(body))...), body...)
+}
+
+func newTestRecord(recordType byte, fragment []byte) []byte {
+	header := []byte{recordType, 0x03, 0x03, 0, 0}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(fragment)))
+	return append(header, fragment...)
+}
+
+func newTestServerHello(supportedVersion uint16) []byte {
+	body := make([]byte, 0)
+	body = append(body, 0x03, 0x03)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // empty session id
+	body = append(body, 0xc0, 0x2f, 0)       // cipher suite and compression method
+
+	extensions := make([]byte, 0)
+	if supportedVersion != 0 {
+		extensions = append(extensions, 0, tlsExtensionSupportedVersions, 0, 2, byte(supportedVersion>>8), byte(supportedVersion))
+	}
+	body = append(body, byte(len(extensions)>>8), byte(len(extensions)))
+	body = append(body, extensions...)
+	return newTestHandshakeMessage(tlsHandshakeTypeServerHello, body)
+}
+
+func newTestCertificateMessage(certificates ...*x509.Certificate) []byte {
+	chain := make([]byte, 0)
+	for _, certificate := range certificates {
+		chain = append(chain, uint24(len(certificate.Raw))...)
+		chain = append(chain, certificate.Raw...)
+	}
+	return newTestHandshakeMessage(tlsHandshakeTypeCertificate, append(uint24(len(chain)), chain...))
+}
+
+func feedInChunks(parser *tlsServerHandshakeParser, payload []byte, chunkSize int) *TLSHandshakeInfo {
+	var result *TLSHandshakeInfo
+	for len(payload) > 0 {
+		size := chunkSize
+		if size > len(payload) {
+			size = len(payload)
+		}
+		if handshake := parser.feed(payload[:size]); handshake != nil {
+			result = handshake
+		}
+		payload = payload[size:]
+	}
+	return result
+}
+
+func TestTlsServerHandshakeParserCertificateChain(t *testing.T) {
+	notAfter := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	ca, caKey := newTestCertificate(t, "Mizu Test CA", nil, nil, notAfter.Add(time.Hour), nil, nil)
+	leaf, _ := newTestCertificate(t, "api.example.com", []string{"api.example.com", "www.example.com"}, []net.IP{net.ParseIP("10.0.0.1")}, notAfter, ca, caKey)
+
+	// the Certificate message spans two records, as large chains do
+	certificateMessage := newTestCertificateMessage(leaf, ca)
+	payload := newTestRecord(tlsRecordTypeHandshake, append(newTestServerHello(0), certificateMessage[:100]...))
+	payload = append(payload, newTestRecord(tlsRecordTypeHandshake, append(certificateMessage[100:], newTestHandshakeMessage(tlsHandshakeTypeServerHelloDone, nil)...))...)
+
+	for _, chunkSize := range []int{len(payload), 1460, 7} {
+		handshake := feedInChunks(&tlsServerHandshakeParser{}, payload, chunkSize)
+		if handshake == nil {
+			t.Fatalf("expected a handshake with chunk size %v", chunkSize)
+		}
+
+		expected := []TLSCertificateInfo{
+			{
+				Subject:   "CN=api.example.com,O=Mizu",
+				Issuer:    "CN=Mizu Test CA,O=Mizu",
+				SANs:      []string{"api.example.com", "www.example.com", "10.0.0.1"},
+				NotBefore: notAfter.Add(-24 * time.Hour),
+				NotAfter:  notAfter,
+			},
+			{
+				Subject:   "CN=Mizu Test CA,O=Mizu",
+				Issuer:    "CN=Mizu Test CA,O=Mizu",
+				SANs:      []string{},
+				NotBefore: notAfter.Add(-23 * time.Hour),
+				NotAfter:  notAfter.Add(time.Hour),
+			},
+		}
+		if !reflect.DeepEqual(handshake.Certificates, expected) {
+			t.Errorf("unexpected result - expected: %v, actual: %v", expected, handshake.Certificates)
+		}
+		if handshake.SessionResumed {
+			t.Errorf("unexpected result - expected: %v, actual: %v", false, handshake.SessionResumed)
+		}
+	}
+}
+
+func TestTlsServerHandshakeParserSessionResumption(t *testing.T) {
+	parser := &tlsServerHandshakeParser{}
+	payload := newTestRecord(tlsRecordTypeHandshake, newTestServerHello(0))
+	payload = append(payload, newTestRecord(tlsRecordTypeChangeCipherSpec, []byte{1})...)
+
+	handshake := parser.feed(payload)
+	if handshake == nil || !handshake.SessionResumed || len(handshake.Certificates) != 0 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "resumed session without certificates", handshake)
+	}
+}
+
+func TestTlsServerHandshakeParserNoCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "TLS13", payload: append(newTestRecord(tlsRecordTypeHandshake, newTestServerHello(tlsVersion13)), newTestRecord(tlsRecordTypeChangeCipherSpec, []byte{1})...)},
+		{name: "NotTLS", payload: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := &tlsServerHandshakeParser{}
+			if handshake := parser.feed(test.payload); handshake != nil {
+				t.Errorf("unexpected result - expected: %v, actual: %v", nil, handshake)
+			}
+			if !parser.done {
+				t.Errorf("unexpected result - expected: %v, actual: %v", true, parser.done)
+			}
+		})
+	}
+}
+
+func TestTlsHandshakeStoreEviction(t *testing.T) {
+	store := newTlsHandshakeStore(2)
+	start := time.Now()
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		store.add(&TLSHandshakeInfo{ServerIP: ip, ServerPort: "443", CapturedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	handshakes := store.getAll()
+	if len(handshakes) != 2 || handshakes[0].ServerIP != "10.0.0.2" || handshakes[1].ServerIP != "10.0.0.3" {
+		t.Errorf("unexpected result - expected: %v, actual: %v", "10.0.0.2 and 10.0.0.3", handshakes)
+	}
+}
@@ -0,0 +1,217 @@
+package tap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/up9inc/mizu/shared/logger"
+	"github.com/up9inc/mizu/tap/api"
+)
+
+var TlsProtocol = api.Protocol{
+	Name:            "tls",
+	LongName:        "Transport Layer Security",
+	Abbreviation:    "TLS",
+	Version:         "1.2",
+	BackgroundColor: "#4b5563",
+	ForegroundColor: "#ffffff",
+	FontSize:        11,
+	ReferenceLink:   "https://datatracker.ietf.org/doc/html/rfc5246",
+	Ports:           []string{"443"},
+	Priority:        4,
+}
+
+// TlsExtension analyzes the handshake entries the tapper emits when INCLUDE_TLS_CERTIFICATES is set,
+// it's built in and never dissects a stream by itself since the handshake is followed by the tcp reader
+var TlsExtension = &api.Extension{
+	Protocol:  &TlsProtocol,
+	Dissector: tlsDissecting{},
+}
+
+type tlsHandshakeDetails struct {
+	Details TLSHandshakeInfo `json:"details"`
+}
+
+func newTlsHandshakeItem(handshake *TLSHandshakeInfo, tcpID *api.TcpID) *api.OutputChannelItem {
+	return &api.OutputChannelItem{
+		Protocol:  TlsProtocol,
+		Timestamp: handshake.CapturedAt.UnixNano() / 1000000,
+		ConnectionInfo: &api.ConnectionInfo{
+			ClientIP:   tcpID.DstIP,
+			ClientPort: tcpID.DstPort,
+			ServerIP:   tcpID.SrcIP,
+			ServerPort: tcpID.SrcPort,
+			IsOutgoing: false,
+		},
+		Pair: &api.RequestResponsePair{
+			Request: api.GenericMessage{
+				IsRequest:   true,
+				CaptureTime: handshake.CapturedAt,
+				Payload:     tlsHandshakeDetails{Details: *handshake},
+			},
+			Response: api.GenericMessage{
+				IsRequest:   false,
+				CaptureTime: handshake.CapturedAt,
+			},
+		},
+	}
+}
+
+// getTlsHandshake reads the handshake back from a pair, the payload is typed in standalone mode and decoded on the api-server
+func getTlsHandshake(pair interface{}) (*TLSHandshakeInfo, []byte, error) {
+	pairBytes, err := json.Marshal(pair)
+	if err != nil {
+		return nil, nil, err
+	}
+	var decoded struct {
+		Request struct {
+			Payload tlsHandshakeDetails `json:"payload"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(pairBytes, &decoded); err != nil {
+		return nil, nil, err
+	}
+	return &decoded.Request.Payload.Details, pairBytes, nil
+}
+
+func getTlsHandshakeSummary(handshake *TLSHandshakeInfo) string {
+	if handshake.SessionResumed {
+		return "session resumed"
+	}
+	if len(handshake.Certificates) == 0 {
+		return "no certificate"
+	}
+	return handshake.Certificates[0].Subject
+}
+
+type tlsDissecting struct{}
+
+func (d tlsDissecting) Register(extension *api.Extension) {
+	extension.Protocol = &TlsProtocol
+}
+
+func (d tlsDissecting) Ping() {
+	logger.Log.Infof("pong %s", TlsProtocol.Name)
+}
+
+func (d tlsDissecting) Dissect(b *bufio.Reader, isClient bool, tcpID *api.TcpID, counterPair *api.CounterPair, superTimer *api.SuperTimer, superIdentifier *api.SuperIdentifier, emitter api.Emitter, options *api.TrafficFilteringOptions) error {
+	return fmt.Errorf("the %s handshake is followed by the tcp reader", TlsProtocol.Name)
+}
+
+func (d tlsDissecting) Analyze(item *api.OutputChannelItem, entryId string, resolvedSource string, resolvedDestination string) *api.MizuEntry {
+	handshake, entryBytes, err := getTlsHandshake(item.Pair)
+	if err != nil {
+		logger.Log.Errorf("Failed reading TLS handshake: %v", err)
+		handshake = &TLSHandshakeInfo{}
+	}
+
+	service := fmt.Sprintf("%s:%s", item.ConnectionInfo.ServerIP, item.ConnectionInfo.ServerPort)
+	if resolvedDestination != "" {
+		service = resolvedDestination
+	}
+	summary := getTlsHandshakeSummary(handshake)
+
+	return &api.MizuEntry{
+		ProtocolName:            TlsProtocol.Name,
+		ProtocolLongName:        TlsProtocol.LongName,
+		ProtocolAbbreviation:    TlsProtocol.Abbreviation,
+		ProtocolVersion:         TlsProtocol.Version,
+		ProtocolBackgroundColor: TlsProtocol.BackgroundColor,
+		ProtocolForegroundColor: TlsProtocol.ForegroundColor,
+		ProtocolFontSize:        TlsProtocol.FontSize,
+		ProtocolReferenceLink:   TlsProtocol.ReferenceLink,
+		EntryId:                 entryId,
+		Entry:                   string(entryBytes),
+		Url:                     service,
+		Method:                  "handshake",
+		Status:                  0,
+		RequestSenderIp:         item.ConnectionInfo.ClientIP,
+		Service:                 service,
+		Timestamp:               item.Timestamp,
+		ElapsedTime:             0,
+		Path:                    summary,
+		ResolvedSource:          resolvedSource,
+		ResolvedDestination:     resolvedDestination,
+		SourceIp:                item.ConnectionInfo.ClientIP,
+		DestinationIp:           item.ConnectionInfo.ServerIP,
+		SourcePort:              item.ConnectionInfo.ClientPort,
+		DestinationPort:         item.ConnectionInfo.ServerPort,
+		IsOutgoing:              item.ConnectionInfo.IsOutgoing,
+	}
+}
+
+func (d tlsDissecting) Summarize(entry *api.MizuEntry) *api.BaseEntryDetails {
+	return &api.BaseEntryDetails{
+		Id:              entry.EntryId,
+		Protocol:        TlsProtocol,
+		Url:             entry.Url,
+		RequestSenderIp: entry.RequestSenderIp,
+		Service:         entry.Service,
+		Summary:         entry.Path,
+		StatusCode:      entry.Status,
+		Method:          entry.Method,
+		Timestamp:       entry.Timestamp,
+		SourceIp:        entry.SourceIp,
+		DestinationIp:   entry.DestinationIp,
+		SourcePort:      entry.SourcePort,
+		DestinationPort: entry.DestinationPort,
+		IsOutgoing:      entry.IsOutgoing,
+		Latency:         entry.ElapsedTime,
+		Rules: api.ApplicableRules{
+			Latency: 0,
+			Status:  false,
+		},
+	}
+}
+
+func (d tlsDissecting) Represent(entry *api.MizuEntry) (p api.Protocol, object []byte, bodySize int64, err error) {
+	p = TlsProtocol
+	var pair api.RequestResponsePair
+	if err = json.Unmarshal([]byte(entry.Entry), &pair); err != nil {
+		return
+	}
+	handshake, _, err := getTlsHandshake(pair)
+	if err != nil {
+		return
+	}
+
+	representation := map[string]interface{}{
+		"request":  representTlsHandshake(handshake),
+		"response": []interface{}{},
+	}
+	object, err = json.Marshal(representation)
+	return
+}
+
+func representTlsHandshake(handshake *TLSHandshakeInfo) []interface{} {
+	details, _ := json.Marshal([]map[string]string{
+		{"name": "Server", "value": fmt.Sprintf("%s:%s", handshake.ServerIP, handshake.ServerPort)},
+		{"name": "Client", "value": handshake.ClientIP},
+		{"name": "Session Resumed", "value": fmt.Sprintf("%t", handshake.SessionResumed)},
+	})
+	representation := []interface{}{
+		map[string]string{
+			"type":  api.TABLE,
+			"title": "Details",
+			"data":  string(details),
+		},
+	}
+
+	for i, certificate := range handshake.Certificates {
+		certificateDetails, _ := json.Marshal([]map[string]string{
+			{"name": "Subject", "value": certificate.Subject},
+			{"name": "Issuer", "value": certificate.Issuer},
+			{"name": "SANs", "value": strings.Join(certificate.SANs, ", ")},
+			{"name": "Not Before", "value": certificate.NotBefore.String()},
+			{"name": "Not After", "value": certificate.NotAfter.String()},
+		})
+		representation = append(representation, map[string]string{
+			"type":  api.TABLE,
+			"title": fmt.Sprintf("Certificate %d", i+1),
+			"data":  string(certificateDetails),
+		})
+	}
+	return representation
+}
@@ -0,0 +1,125 @@
+package tap
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/up9inc/mizu/tap/api"
+)
+
+type recordingEmitter struct {
+	items []*api.OutputChannelItem
+}
+
+func (e *recordingEmitter) Emit(item *api.OutputChannelItem) {
+	e.items = append(e.items, item)
+}
+
+func TestTcpReaderEmitsTlsHandshake(t *testing.T) {
+	previousHandshakes := recentTlsHandshakes
+	recentTlsHandshakes = newTlsHandshakeStore(maxRecentTlsHandshakes)
+	defer func() { recentTlsHandshakes = previousHandshakes }()
+
+	notAfter := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	leaf, _ := newTestCertificate(t, "api.example.com", []string{"api.example.com"}, nil, notAfter, nil, nil)
+	payload := newTestRecord(tlsRecordTypeHandshake, append(append(newTestServerHello(0), newTestCertificateMessage(leaf)...), newTestHandshakeMessage(tlsHandshakeTypeServerHelloDone, nil)...))
+
+	emitter := &recordingEmitter{}
+	reader := &tcpReader{
+		tcpID:     &api.TcpID{SrcIP: "10.0.0.1", SrcPort: "443", DstIP: "10.0.0.2", DstPort: "51000"},
+		emitter:   emitter,
+		tlsParser: &tlsServerHandshakeParser{},
+	}
+	capturedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	reader.handleTlsServerPayload(tcpReaderDataMsg{bytes: payload, timestamp: capturedAt})
+
+	if len(emitter.items) != 1 {
+		t.Fatalf("unexpected result - expected: %v, actual: %v", 1, len(emitter.items))
+	}
+	item := emitter.items[0]
+	if item.Protocol.Name != TlsProtocol.Name {
+		t.Errorf("unexpected result - expected: %v, actual: %v", TlsProtocol.Name, item.Protocol.Name)
+	}
+	expectedConnection := api.ConnectionInfo{ClientIP: "10.0.0.2", ClientPort: "51000", ServerIP: "10.0.0.1", ServerPort: "443"}
+	if *item.ConnectionInfo != expectedConnection {
+		t.Errorf("unexpected result - expected: %v, actual: %v", expectedConnection, *item.ConnectionInfo)
+	}
+	if item.Timestamp != capturedAt.UnixNano()/1000000 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", capturedAt.UnixNano()/1000000, item.Timestamp)
+	}
+	if handshakes := GetRecentTLSHandshakes(); len(handshakes) != 1 {
+		t.Errorf("unexpected result - expected: %v, actual: %v", 1, len(handshakes))
+	}
+}
+
+func TestTlsDissectorStoresCertificates(t *testing.T) {
+	notAfter := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	handshake := &TLSHandshakeInfo{
+		ServerIP:   "10.0.0.1",
+		ServerPort: "443",
+		ClientIP:   "10.0.0.2",
+		Certificates: []TLSCertificateInfo{
+			{Subject: "CN=api.example.com", Issuer: "CN=Mizu Test CA", SANs: []string{"api.example.com"}, NotBefore: notAfter.Add(-time.Hour), NotAfter: notAfter},
+		},
+		CapturedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	item := newTlsHandshakeItem(handshake, &api.TcpID{SrcIP: "10.0.0.1", SrcPort: "443", DstIP: "10.0.0.2", DstPort: "51000"})
+
+	// the api-server receives the pair json decoded from the tapper
+	itemBytes, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("failed marshalling the item: %v", err)
+	}
+	var decodedItem api.OutputChannelItem
+	if err := json.Unmarshal(itemBytes, &decodedItem); err != nil {
+		t.Fatalf("failed unmarshalling the item: %v", err)
+	}
+
+	for name, analyzed := range map[string]*api.OutputChannelItem{"dissected": item, "decoded": &decodedItem} {
+		entry := TlsExtension.Dissector.Analyze(analyzed, "entry", "", "")
+		if entry.ProtocolName != TlsProtocol.Name {
+			t.Errorf("%s: unexpected result - expected: %v, actual: %v", name, TlsProtocol.Name, entry.ProtocolName)
+		}
+		if entry.Path != "CN=api.example.com" {
+			t.Errorf("%s: unexpected result - expected: %v, actual: %v", name, "CN=api.example.com", entry.Path)
+		}
+		if entry.Service != "10.0.0.1:443" {
+			t.Errorf("%s: unexpected result - expected: %v, actual: %v", name, "10.0.0.1:443", entry.Service)
+		}
+
+		stored, _, err := getTlsHandshake(json.RawMessage(entry.Entry))
+		if err != nil {
+			t.Fatalf("%s: failed reading the stored handshake: %v", name, err)
+		}
+		if len(stored.Certificates) != 1 || !stored.Certificates[0].NotAfter.Equal(notAfter) {
+			t.Errorf("%s: unexpected result - expected: %v, actual: %v", name, handshake.Certificates, stored.Certificates)
+		}
+
+		_, representation, _, err := TlsExtension.Dissector.Represent(entry)
+		if err != nil {
+			t.Fatalf("%s: failed representing the entry: %v", name, err)
+		}
+		if !strings.Contains(string(representation), "Certificate 1") || !strings.Contains(string(representation), "api.example.com") {
+			t.Errorf("%s: unexpected representation: %s", name, representation)
+		}
+	}
+}
+
+func TestTlsDissectorSummary(t *testing.T) {
+	tests := []struct {
+		handshake TLSHandshakeInfo
+		expected  string
+	}{
+		{TLSHandshakeInfo{SessionResumed: true}, "session resumed"},
+		{TLSHandshakeInfo{}, "no certificate"},
+		{TLSHandshakeInfo{Certificates: []TLSCertificateInfo{{Subject: "CN=leaf"}, {Subject: "CN=ca"}}}, "CN=leaf"},
+	}
+
+	for _, test := range tests {
+		if actual := getTlsHandshakeSummary(&test.handshake); actual != test.expected {
+			t.Errorf("unexpected result - expected: %v, actual: %v", test.expected, actual)
+		}
+	}
+}
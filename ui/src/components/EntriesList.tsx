@@ -53,6 +53,7 @@ export const EntriesList: React.FC<EntriesListProps> = ({entries, setEntries, fo
     }, []);
 
     const filterEntries = useCallback((entry) => {
+        if(entry.isStreamInterruption) return entry;
         if(methodsFilter.length > 0 && !methodsFilter.includes(entry.method.toLowerCase())) return;
         if(pathFilter && entry.path?.toLowerCase()?.indexOf(pathFilter) === -1) return;
         if(serviceFilter && entry.service?.toLowerCase()?.indexOf(serviceFilter) === -1) return;
@@ -113,7 +114,9 @@ export const EntriesList: React.FC<EntriesListProps> = ({entries, setEntries, fo
                     </div>}
                     <ScrollableFeedVirtualized ref={scrollableRef} itemHeight={48} marginTop={10} onScroll={(isAtBottom) => onScrollEvent(isAtBottom)}>
                         {noMoreDataTop && !connectionOpen && <div id="noMoreDataTop" className={styles.noMoreDataAvailable}>No more data available</div>}
-                        {filteredEntries.map(entry => <EntryItem key={entry.id}
+                        {filteredEntries.map(entry => entry.isStreamInterruption ?
+                                                        <div key={entry.id} className={styles.streamInterruption}>Tapper reconnected after {entry.gapMs} ms</div> :
+                                                        <EntryItem key={entry.id}
                                                         entry={entry}
                                                         setFocusedEntryId={setFocusedEntryId}
                                                         isSelected={focusedEntryId === entry.id}
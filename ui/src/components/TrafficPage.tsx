@@ -74,25 +74,35 @@ export const TrafficPage: React.FC<TrafficPageProps> = ({setAnalyzeStatus, onTLS
         ws.current.onclose = () => setConnection(ConnectionStatus.Closed);
     }
 
+    const addEntries = (newEntries) => {
+        if (!newEntries?.length) return;
+        if (connection === ConnectionStatus.Paused) {
+            setNoMoreDataBottom(false)
+            return;
+        }
+        if (!focusedEntryId) setFocusedEntryId(newEntries[0].id)
+        setEntries([...entries, ...newEntries])
+        if(listEntry.current) {
+            if(isScrollable(listEntry.current.firstChild)) {
+                setDisableScrollList(true)
+            }
+        }
+    }
+
     if (ws.current) {
         ws.current.onmessage = e => {
             if (!e?.data) return;
             const message = JSON.parse(e.data);
             switch (message.messageType) {
                 case "entry":
-                    const entry = message.data
-                    if (connection === ConnectionStatus.Paused) {
-                        setNoMoreDataBottom(false)
-                        return;
-                    }
-                    if (!focusedEntryId) setFocusedEntryId(entry.id)
-                    let newEntries = [...entries];
-                    setEntries([...newEntries, entry])
-                    if(listEntry.current) {
-                        if(isScrollable(listEntry.current.firstChild)) {
-                            setDisableScrollList(true)
-                        }
-                    }
+                    addEntries([message.data]);
+                    break
+                case "entryBatch":
+                    addEntries(message.data);
+                    break
+                case "entryReference":
+                    // the entry was too large to broadcast, its details are fetched when it's focused
+                    addEntries([{...message.data, summary: message.data.preview}]);
                     break
                 case "status":
                     setTappingStatus(message.tappingStatus);
@@ -103,6 +113,12 @@ export const TrafficPage: React.FC<TrafficPageProps> = ({setAnalyzeStatus, onTLS
                 case "outboundLink":
                     onTLSDetected(message.Data.DstIP);
                     break;
+                case "streamInterruption":
+                    setEntries([...entries, {id: `interruption-${message.data.resumedAt}`, isStreamInterruption: true, gapMs: message.data.gapMs, timestamp: message.data.resumedAt}]);
+                    break;
+                case "schemaHandshake":
+                    // the ui reads the current version only, it's served together with the api
+                    break;
                 default:
                     console.error(`unsupported websocket message type, Got: ${message.messageType}`)
             }
@@ -3,7 +3,11 @@ import * as axios from "axios";
 const mizuAPIPathPrefix = "/mizu";
 
 // When working locally cp `cp .env.example .env`
-export const MizuWebsocketURL = process.env.REACT_APP_OVERRIDE_WS_URL ? process.env.REACT_APP_OVERRIDE_WS_URL : `ws://${window.location.host}${mizuAPIPathPrefix}/ws`;
+const mizuWebsocketBaseURL = process.env.REACT_APP_OVERRIDE_WS_URL ? process.env.REACT_APP_OVERRIDE_WS_URL : `ws://${window.location.host}${mizuAPIPathPrefix}/ws`;
+
+// Browsers can't set headers on websockets, the websocket token the page was opened with (?token=) is passed on as a query param
+const webSocketToken = new URLSearchParams(window.location.search).get("token");
+export const MizuWebsocketURL = webSocketToken ? `${mizuWebsocketBaseURL}?token=${encodeURIComponent(webSocketToken)}` : mizuWebsocketBaseURL;
 
 export default class Api {
 